@@ -0,0 +1,129 @@
+package worklet
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var daemonTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage tokens of the daemon's TCP API",
+	Long: `Issue, rotate and revoke the tokens requests to the daemon's TCP API
+authenticate with. The API is served when "api": {"listen": "127.0.0.1:7480"}
+is set in ~/.worklet/config.jsonc, over TLS with "tlsCert" and "tlsKey",
+which addresses other than loopback ones need. The Unix socket doesn't need
+a token.
+
+Each token has a role:
+  read-only  list forks and read their state
+  operator   also refresh forks and change notes, taps and chaos
+  admin      also register, unregister and swap forks and change their services
+
+Changes take effect immediately, without restarting the daemon.`,
+}
+
+var daemonTokenCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Issue a token",
+	Long: `Issue a token and print its secret, which isn't stored and can't be shown
+again. Creating a name that exists replaces its token.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDaemonTokenCreate,
+}
+
+var daemonTokenRotateCmd = &cobra.Command{
+	Use:   "rotate <name>",
+	Short: "Give a token a new secret, keeping its role",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := daemon.NewTokenStore()
+		if err != nil {
+			return err
+		}
+		secret, err := store.Rotate(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Println(secret)
+		return nil
+	},
+}
+
+var daemonTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <name>",
+	Short: "Revoke a token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := daemon.NewTokenStore()
+		if err != nil {
+			return err
+		}
+		if err := store.Revoke(args[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked token %s\n", args[0])
+		return nil
+	},
+}
+
+var daemonTokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tokens",
+	Args:  cobra.NoArgs,
+	RunE:  runDaemonTokenList,
+}
+
+var daemonTokenRole string
+
+func init() {
+	daemonTokenCreateCmd.Flags().StringVar(&daemonTokenRole, "role", string(daemon.RoleReadOnly), "Role of the token: read-only, operator or admin")
+
+	daemonTokenCmd.AddCommand(daemonTokenCreateCmd)
+	daemonTokenCmd.AddCommand(daemonTokenRotateCmd)
+	daemonTokenCmd.AddCommand(daemonTokenRevokeCmd)
+	daemonTokenCmd.AddCommand(daemonTokenListCmd)
+	daemonCmd.AddCommand(daemonTokenCmd)
+}
+
+func runDaemonTokenCreate(cmd *cobra.Command, args []string) error {
+	role, err := daemon.ParseRole(daemonTokenRole)
+	if err != nil {
+		return err
+	}
+	store, err := daemon.NewTokenStore()
+	if err != nil {
+		return err
+	}
+	secret, err := store.Issue(args[0], role)
+	if err != nil {
+		return err
+	}
+	fmt.Println(secret)
+	return nil
+}
+
+func runDaemonTokenList(cmd *cobra.Command, args []string) error {
+	store, err := daemon.NewTokenStore()
+	if err != nil {
+		return err
+	}
+	tokens, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No tokens")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tROLE\tCREATED")
+	for _, token := range tokens {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", token.Name, token.Role, token.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,242 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+// bulkConcurrency is how many sessions a bulk command works on at once
+const bulkConcurrency = 8
+
+var (
+	bulkProject string
+	bulkLabels  []string
+	bulkAll     bool
+	bulkStopped bool
+	rmForce     bool
+	rmVolumes   bool
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop [session-id...]",
+	Short: "Stop sessions",
+	Long: `Stop one or more running sessions, selected by ID, by project or by
+container label. Sessions are stopped concurrently and a summary of
+successes and failures is printed.
+
+Examples:
+  worklet stop abc123 def456              # Stop two sessions
+  worklet stop --project myapp            # Stop every session of myapp
+  worklet stop --label worklet.mode=copy  # Stop sessions by container label
+  worklet stop --all                      # Stop every session`,
+	RunE: withOutput(func(cmd *cobra.Command, args []string) error {
+		return runBulk(cmd, args, bulkAction{
+			verb:        "Stopped",
+			runningOnly: true,
+			op: func(ctx context.Context, session docker.SessionInfo) error {
+				return docker.StopSession(ctx, session.SessionID)
+			},
+		})
+	}),
+}
+
+var rmCmd = &cobra.Command{
+	Use:   "rm [session-id...]",
+	Short: "Remove sessions and their resources",
+	Long: `Remove one or more sessions with their networks, Docker-in-Docker
+volumes and temporary images, selected by ID, by project or by container
+label. Running sessions are removed too. Sessions are removed concurrently
+and a summary of successes and failures is printed.
+
+Removing sessions selected any other way than by ID asks for confirmation
+first, unless --force is given.
+
+Examples:
+  worklet rm abc123                     # Remove a session
+  worklet rm --all --stopped            # Remove every stopped session
+  worklet rm --project myapp --force    # Remove myapp's sessions without asking
+  worklet rm --project myapp --volumes  # Also remove myapp's pnpm store volume`,
+	RunE: withOutput(func(cmd *cobra.Command, args []string) error {
+		return runBulk(cmd, args, bulkAction{
+			verb:    "Removed",
+			confirm: "Remove %d sessions?",
+			op: func(ctx context.Context, session docker.SessionInfo) error {
+				if rmVolumes {
+					return docker.RemoveSessionForce(ctx, session.SessionID)
+				}
+				return docker.RemoveSession(ctx, session.SessionID)
+			},
+		})
+	}),
+}
+
+var restartCmd = &cobra.Command{
+	Use:   "restart [session-id...]",
+	Short: "Restart sessions",
+	Long: `Restart one or more sessions, selected by ID, by project or by container
+label. Stopped sessions are started. Sessions are restarted concurrently and
+a summary of successes and failures is printed.
+
+Examples:
+  worklet restart abc123            # Restart a session
+  worklet restart --project myapp   # Restart every session of myapp
+  worklet restart --all --stopped   # Start every stopped session`,
+	RunE: withOutput(func(cmd *cobra.Command, args []string) error {
+		return runBulk(cmd, args, bulkAction{
+			verb: "Restarted",
+			op: func(ctx context.Context, session docker.SessionInfo) error {
+				return docker.RestartSession(ctx, session.SessionID)
+			},
+		})
+	}),
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{stopCmd, rmCmd, restartCmd} {
+		cmd.Flags().StringVarP(&bulkProject, "project", "p", "", "Select sessions of a project")
+		cmd.Flags().StringArrayVarP(&bulkLabels, "label", "l", nil, "Select sessions by container label (key or key=value, repeatable)")
+		cmd.Flags().BoolVarP(&bulkAll, "all", "a", false, "Select every session")
+		addOutputFlags(cmd)
+	}
+	rmCmd.Flags().BoolVar(&bulkStopped, "stopped", false, "Only select sessions that aren't running")
+	restartCmd.Flags().BoolVar(&bulkStopped, "stopped", false, "Only select sessions that aren't running")
+	rmCmd.Flags().BoolVarP(&rmForce, "force", "f", false, "Don't ask for confirmation")
+	rmCmd.Flags().BoolVar(&rmVolumes, "volumes", false, "Also remove the project's pnpm store volume")
+}
+
+// bulkAction is an operation of a bulk command
+type bulkAction struct {
+	verb        string // Past tense for the summary
+	runningOnly bool   // Skip sessions that aren't running
+	confirm     string // Question asked before acting on sessions not selected by ID
+	op          func(context.Context, docker.SessionInfo) error
+}
+
+// runBulk selects sessions from the command line and applies an action to
+// them concurrently, then prints a summary
+func runBulk(cmd *cobra.Command, args []string, action bulkAction) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	selector := docker.SessionSelector{
+		SessionIDs: args,
+		Project:    bulkProject,
+		Labels:     bulkLabels,
+		Stopped:    bulkStopped,
+	}
+	if selector.IsEmpty() && !bulkAll {
+		return fmt.Errorf("specify session IDs, --project, --label or --all")
+	}
+	for _, label := range bulkLabels {
+		if key, _, _ := strings.Cut(label, "="); key == "" {
+			return fmt.Errorf("invalid label selector %q (expected key or key=value)", label)
+		}
+	}
+
+	all, err := docker.ListAllSessions(ctx)
+	if err != nil {
+		return err
+	}
+	sessions := docker.SelectSessions(all, selector)
+
+	if action.runningOnly {
+		var running []docker.SessionInfo
+		for _, session := range sessions {
+			if session.Status == "running" {
+				running = append(running, session)
+			}
+		}
+		sessions = running
+	}
+
+	if missing := missingSessions(args, all); len(missing) > 0 {
+		return fmt.Errorf("no such session: %s", strings.Join(missing, ", "))
+	}
+	if len(sessions) == 0 {
+		console.Println("No matching sessions")
+		return nil
+	}
+
+	if action.confirm != "" && len(args) == 0 && !rmForce {
+		for _, session := range sessions {
+			fmt.Printf("  %s (%s, %s)\n", session.SessionID, session.ProjectName, session.Status)
+		}
+		ok, err := confirm(fmt.Sprintf(action.confirm, len(sessions)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	results := docker.RunBulk(ctx, sessions, bulkConcurrency, action.op)
+	if console.Quiet() {
+		return printBulkIDs(os.Stdout, os.Stderr, results)
+	}
+	return printBulkSummary(os.Stdout, action.verb, results)
+}
+
+// missingSessions returns the session IDs that don't exist
+func missingSessions(ids []string, sessions []docker.SessionInfo) []string {
+	known := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		known[session.SessionID] = true
+	}
+	var missing []string
+	for _, id := range ids {
+		if !known[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// printBulkSummary prints the outcome for each session and a total, and
+// returns an error if any session failed
+func printBulkSummary(out io.Writer, verb string, results []docker.BulkResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(out, "✗ %s (%s): %v\n", result.Session.SessionID, result.Session.ProjectName, result.Err)
+			continue
+		}
+		fmt.Fprintf(out, "✓ %s (%s)\n", result.Session.SessionID, result.Session.ProjectName)
+	}
+
+	fmt.Fprintf(out, "%s %d of %d sessions", verb, len(results)-failed, len(results))
+	if failed > 0 {
+		fmt.Fprintf(out, ", %d failed\n", failed)
+		return fmt.Errorf("%d of %d sessions failed", failed, len(results))
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+// printBulkIDs prints the IDs of the sessions an action succeeded on, for
+// --quiet, and the failures to errOut. It returns an error if any failed.
+func printBulkIDs(out, errOut io.Writer, results []docker.BulkResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(errOut, "%s: %v\n", result.Session.SessionID, result.Err)
+			continue
+		}
+		fmt.Fprintln(out, result.Session.SessionID)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sessions failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package worklet
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/gitcache"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheMaxAge    time.Duration
+	cacheMaxSizeMB int64
+	cachePruneAll  bool
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the git clone cache",
+	Long: `Manage the bare-mirror cache used when running git URLs.
+
+Repeated 'worklet run <git-url>' calls fetch into a mirror under
+~/.worklet/git-cache and clone locally from it instead of re-cloning
+from the remote. Set WORKLET_GIT_CACHE=false to disable the cache.`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached repositories",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := gitcache.New()
+		if err != nil {
+			return fmt.Errorf("failed to open git cache: %w", err)
+		}
+
+		entries, err := cache.List()
+		if err != nil {
+			return fmt.Errorf("failed to list git cache: %w", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("Git cache is empty.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "URL\tSIZE\tLAST USED")
+		fmt.Fprintln(w, "---\t----\t---------")
+
+		var total int64
+		for _, entry := range entries {
+			total += entry.Size
+			fmt.Fprintf(w, "%s\t%s\t%s\n", entry.URL, formatSize(entry.Size), formatTime(entry.LastUsed))
+		}
+		w.Flush()
+
+		fmt.Printf("\nTotal: %s in %s\n", formatSize(total), cache.Dir())
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove stale cached repositories",
+	Long: `Remove cached repositories that have not been used recently, then evict
+the least recently used ones until the cache fits the size limit.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := gitcache.New()
+		if err != nil {
+			return fmt.Errorf("failed to open git cache: %w", err)
+		}
+
+		if cachePruneAll {
+			if err := cache.Clear(); err != nil {
+				return fmt.Errorf("failed to clear git cache: %w", err)
+			}
+			fmt.Println("Git cache cleared.")
+			return nil
+		}
+
+		removed, err := cache.Prune(cacheMaxAge, cacheMaxSizeMB<<20)
+		if err != nil {
+			return fmt.Errorf("failed to prune git cache: %w", err)
+		}
+		if len(removed) == 0 {
+			fmt.Println("Nothing to prune.")
+			return nil
+		}
+
+		var freed int64
+		for _, entry := range removed {
+			freed += entry.Size
+			fmt.Printf("Removed %s\n", entry.URL)
+		}
+		fmt.Printf("Freed %s\n", formatSize(freed))
+		return nil
+	},
+}
+
+func init() {
+	cachePruneCmd.Flags().DurationVar(&cacheMaxAge, "max-age", 30*24*time.Hour, "Remove repositories unused for longer than this (0 to disable)")
+	cachePruneCmd.Flags().Int64Var(&cacheMaxSizeMB, "max-size-mb", gitcache.DefaultMaxSize>>20, "Evict least recently used repositories above this size (0 to disable)")
+	cachePruneCmd.Flags().BoolVar(&cachePruneAll, "all", false, "Remove every cached repository")
+
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+}
+
+// formatSize renders a byte count in human readable units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
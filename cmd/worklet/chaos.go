@@ -0,0 +1,117 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/chaos"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	chaosServices    []string
+	chaosLatency     time.Duration
+	chaosJitter      time.Duration
+	chaosErrorRate   float64
+	chaosErrorStatus int
+)
+
+var chaosCmd = &cobra.Command{
+	Use:   "chaos",
+	Short: "Inject latency and errors into a session's HTTP traffic",
+	Long: `Slow down or fail requests the proxy passes to a session's HTTP
+services, to see how the rest of the system copes. Chaos is applied by the
+daemon at runtime and lasts until it is cleared or the daemon restarts.
+
+Injected errors are answered by the daemon without reaching the session and
+carry an X-Worklet-Chaos header.
+
+Examples:
+  worklet chaos set 3 --latency 300ms --jitter 100ms  # Slow every service down
+  worklet chaos set 3 -s api --error-rate 0.2         # Fail 20% of api requests
+  worklet chaos set 3 -s api --error-rate 1 --error-status 429
+  worklet chaos clear 3                               # Back to normal`,
+}
+
+var chaosSetCmd = &cobra.Command{
+	Use:   "set <session-id>",
+	Short: "Set the chaos of a session's HTTP services",
+	Long: `Set the chaos of a session's HTTP services, replacing what was set
+before for them. Without --service it applies to every HTTP service.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		config := chaos.Config{
+			LatencyMS:   int(chaosLatency / time.Millisecond),
+			JitterMS:    int(chaosJitter / time.Millisecond),
+			ErrorRate:   chaosErrorRate,
+			ErrorStatus: chaosErrorStatus,
+		}
+		if config.IsZero() {
+			return fmt.Errorf("specify --latency, --jitter or --error-rate (use 'worklet chaos clear' to remove chaos)")
+		}
+		if err := config.Validate(); err != nil {
+			return err
+		}
+
+		fork, err := setChaos(sessionID, chaosServices, config, false)
+		if err != nil {
+			return err
+		}
+		for _, svc := range fork.Services {
+			if c, ok := fork.Chaos[svc.Name]; ok {
+				fmt.Printf("Chaos for %s of session %s: %s\n", svc.Name, sessionID, c)
+			}
+		}
+		return nil
+	},
+}
+
+var chaosClearCmd = &cobra.Command{
+	Use:   "clear <session-id>",
+	Short: "Remove the chaos of a session's HTTP services",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		fork, err := setChaos(sessionID, chaosServices, chaos.Config{}, true)
+		if err != nil {
+			return err
+		}
+		if len(fork.Chaos) > 0 {
+			fmt.Printf("Cleared chaos; %d service(s) of session %s still have some\n", len(fork.Chaos), sessionID)
+		} else {
+			fmt.Printf("Cleared chaos for session %s\n", sessionID)
+		}
+		return nil
+	},
+}
+
+func init() {
+	chaosSetCmd.Flags().StringArrayVarP(&chaosServices, "service", "s", nil, "Only apply to this service (repeatable)")
+	chaosSetCmd.Flags().DurationVar(&chaosLatency, "latency", 0, "Delay added to every request")
+	chaosSetCmd.Flags().DurationVar(&chaosJitter, "jitter", 0, "Up to this much more delay, at random")
+	chaosSetCmd.Flags().Float64Var(&chaosErrorRate, "error-rate", 0, "Fraction of requests to fail, from 0 to 1")
+	chaosSetCmd.Flags().IntVar(&chaosErrorStatus, "error-status", chaos.DefaultErrorStatus, "Status of injected errors")
+	chaosClearCmd.Flags().StringArrayVarP(&chaosServices, "service", "s", nil, "Only clear this service (repeatable)")
+
+	chaosCmd.AddCommand(chaosSetCmd)
+	chaosCmd.AddCommand(chaosClearCmd)
+}
+
+// setChaos asks the daemon to set or clear the chaos of a session
+func setChaos(sessionID string, services []string, config chaos.Config, clear bool) (*daemon.ForkInfo, error) {
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("daemon is not running. Start it with: worklet daemon start")
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return client.SetChaos(ctx, sessionID, services, config, clear)
+}
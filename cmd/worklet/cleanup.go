@@ -2,7 +2,6 @@ package worklet
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/nolanleung/worklet/internal/docker"
 	"github.com/spf13/cobra"
@@ -22,24 +21,26 @@ Use --force to remove ALL orphaned resources including pnpm volumes.
 
 Examples:
   worklet cleanup        # Clean up orphaned resources (keeps pnpm volumes)
-  worklet cleanup --force # Clean up ALL orphaned resources`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		fmt.Println("Scanning for orphaned Docker resources...")
+  worklet cleanup --force # Clean up ALL orphaned resources
+  worklet cleanup -q      # Clean up without printing anything but errors`,
+	RunE: withOutput(func(cmd *cobra.Command, args []string) error {
+		console.Println("Scanning for orphaned Docker resources...")
 		
 		opts := docker.CleanupOptions{
 			Force: cleanupForce,
 		}
 		
 		if cleanupForce {
-			fmt.Println("Force mode enabled - will remove pnpm volumes")
+			console.Println("Force mode enabled - will remove pnpm volumes")
 		} else {
-			fmt.Println("Preserving pnpm volumes (use --force to remove)")
+			console.Println("Preserving pnpm volumes (use --force to remove)")
 		}
 		
 		return docker.CleanupAllOrphaned(context.Background(), opts)
-	},
+	}),
 }
 
 func init() {
 	cleanupCmd.Flags().BoolVarP(&cleanupForce, "force", "f", false, "Remove all orphaned resources including pnpm volumes")
+	addOutputFlags(cleanupCmd)
 }
\ No newline at end of file
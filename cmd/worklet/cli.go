@@ -10,7 +10,9 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/mergestat/timediff"
+	"github.com/nolanleung/worklet/internal/config"
 	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/notes"
 	"github.com/nolanleung/worklet/pkg/terminal"
 )
 
@@ -56,14 +58,15 @@ func (m *model) refresh() {
 	}
 
 	// Calculate proportional widths
-	// Approximate ratios: Project(15%), SessionID(20%), URL(50%), Created(15%)
+	// Approximate ratios: Project(15%), SessionID(15%), URL(40%), Created(10%), Note(20%)
 	projectWidth := max(12, availableWidth*15/100)
-	sessionWidth := max(16, availableWidth*20/100)
-	urlWidth := max(30, availableWidth*50/100)
-	createdWidth := max(10, availableWidth*15/100)
+	sessionWidth := max(12, availableWidth*15/100)
+	urlWidth := max(30, availableWidth*40/100)
+	createdWidth := max(10, availableWidth*10/100)
+	noteWidth := max(12, availableWidth*20/100)
 
 	// Adjust to fit exactly
-	totalWidth := projectWidth + sessionWidth + urlWidth + createdWidth
+	totalWidth := projectWidth + sessionWidth + urlWidth + createdWidth + noteWidth
 	if totalWidth < availableWidth {
 		// Add extra space to URL column
 		urlWidth += availableWidth - totalWidth
@@ -74,6 +77,7 @@ func (m *model) refresh() {
 		{Title: "Session ID", Width: sessionWidth},
 		{Title: "URL", Width: urlWidth},
 		{Title: "Created", Width: createdWidth},
+		{Title: "Note", Width: noteWidth},
 	}
 
 	sessions, err := docker.ListSessions(context.Background())
@@ -82,6 +86,14 @@ func (m *model) refresh() {
 		os.Exit(1)
 	}
 
+	// Notes are optional; a missing or unreadable store just shows none
+	sessionNotes := map[string]notes.Note{}
+	if store, err := notes.New(); err == nil {
+		if all, err := store.All(); err == nil {
+			sessionNotes = all
+		}
+	}
+
 	rows := []table.Row{}
 	for _, session := range sessions {
 		name := session.ProjectName
@@ -96,7 +108,7 @@ func (m *model) refresh() {
 			if subdomain == "" {
 				subdomain = session.Services[0].Name
 			}
-			url = fmt.Sprintf("http://%s.%s-%s.local.worklet.sh", subdomain, session.ProjectName, session.SessionID)
+			url = config.ServiceURL(subdomain, session.ProjectName, session.SessionID)
 		}
 		
 		rows = append(rows, table.Row{
@@ -104,6 +116,7 @@ func (m *model) refresh() {
 			session.SessionID,
 			url,
 			timediff.TimeDiff(session.CreatedAt),
+			sessionNotes[session.SessionID].Text,
 		})
 	}
 
@@ -255,6 +268,36 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 
+		case "r", "R":
+			// Don't allow other actions during confirmation
+			if m.showConfirmation {
+				return m, nil
+			}
+			// repeat the last run of the selected session's project
+			if !m.table.Focused() {
+				return m, nil
+			}
+			selected := m.table.SelectedRow()
+			if len(selected) == 0 {
+				return m, nil
+			}
+			session, err := docker.GetSessionInfo(context.Background(), selected[1])
+			if err != nil || session.WorkDir == "" {
+				return m, nil
+			}
+			executable, err := os.Executable()
+			if err != nil {
+				return m, nil
+			}
+
+			// Keep the run's output on screen until the user returns
+			c := exec.Command("sh", "-c", `"$0" rerun "$1"; printf '\nPress Enter to return to worklet'; read _`, executable, session.WorkDir)
+			return m, tea.ExecProcess(c, func(err error) tea.Msg {
+				// Show the new session
+				m.refresh()
+				return nil
+			})
+
 		case "d", "D":
 			// Delete the selected session - show confirmation
 			if m.showConfirmation {
@@ -336,7 +379,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			// Create the docker exec command
-			c := exec.Command("docker", "exec", "-it", "-e", "TERM="+term, session.ContainerID, "/bin/sh")
+			execArgs := append([]string{"exec", "-it", "-e", "TERM=" + term}, docker.ExecEnvArgs(session.SessionID)...)
+			execArgs = append(execArgs, docker.ExecUserArgs(session.ContainerID)...)
+			c := exec.Command("docker", append(append(execArgs, session.ContainerID), docker.ShellCommand()...)...)
 
 			// Use tea.ExecProcess to temporarily leave bubbletea and run the shell
 			return m, tea.ExecProcess(c, func(err error) tea.Msg {
@@ -377,7 +422,7 @@ func (m model) View() string {
 			helpText = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("241")).
 				Width(m.width - 2).
-				Render("\nEnter: Attach • O: Browser • C: VSCode • L: Logs • D: Delete • Q: Quit")
+				Render("\nEnter: Attach • O: Browser • C: VSCode • L: Logs • R: Run last command • D: Delete • Q: Quit")
 		}
 		
 		return styledTable + helpText + "\n"
@@ -393,7 +438,7 @@ func (m model) View() string {
 	} else {
 		helpText = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("241")).
-			Render("\nEnter: Attach • O: Browser • C: VSCode • L: Logs • D: Delete • Q: Quit")
+			Render("\nEnter: Attach • O: Browser • C: VSCode • L: Logs • R: Run last command • D: Delete • Q: Quit")
 	}
 	return baseStyle.Render(tableView) + helpText + "\n"
 }
@@ -0,0 +1,414 @@
+package worklet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/gitcache"
+	"golang.org/x/term"
+)
+
+// cloneSettings controls how much of a repository cloneRepository fetches
+type cloneSettings struct {
+	// Partial fetches commits and trees up front and blobs on demand
+	// (--filter=blob:none). Requires the git CLI.
+	Partial bool
+	// SparsePaths limits the checkout to these directories
+	SparsePaths []string
+	// Submodules initializes submodules recursively after checkout
+	Submodules bool
+	// MaxSize aborts the clone once it grows beyond this many bytes (0 for
+	// no limit)
+	MaxSize int64
+}
+
+// cleanSparsePaths normalizes user supplied sparse-checkout paths
+func cleanSparsePaths(paths []string) []string {
+	var cleaned []string
+	for _, p := range paths {
+		p = strings.Trim(path.Clean("/"+strings.TrimSpace(p)), "/")
+		if p != "" {
+			cleaned = append(cleaned, p)
+		}
+	}
+	return cleaned
+}
+
+// sparsePatterns converts sparse paths into go-git checkout patterns. Like
+// cone mode in the git CLI, top-level files (including .worklet.jsonc) are
+// always checked out.
+func sparsePatterns(repo *git.Repository, hash plumbing.Hash, paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	commit, err := repo.CommitObject(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree: %w", err)
+	}
+
+	var patterns []string
+	// go-git matches by prefix, so terminate directories to avoid
+	// matching siblings like "api-old" for "api"
+	for _, p := range paths {
+		patterns = append(patterns, p+"/")
+	}
+	for _, entry := range tree.Entries {
+		if entry.Mode.IsFile() {
+			patterns = append(patterns, entry.Name)
+		}
+	}
+
+	return patterns, nil
+}
+
+// partialCloneWithGit performs a blob-less clone using the git CLI, since
+// go-git doesn't support object filters
+func partialCloneWithGit(ctx context.Context, gitURL, targetDir, ref string, settings cloneSettings, out io.Writer) error {
+	args := []string{"clone", "--filter=blob:none", "--progress"}
+	if ref != "" && !isCommitHash(ref) {
+		args = append(args, "--branch", ref, "--single-branch")
+	}
+	if len(settings.SparsePaths) > 0 {
+		args = append(args, "--sparse")
+	}
+	args = append(args, gitURL, targetDir)
+
+	if err := runGit(ctx, "", out, args...); err != nil {
+		return err
+	}
+
+	if len(settings.SparsePaths) > 0 {
+		fmt.Fprintf(out, "Sparse checkout: %s\n", strings.Join(settings.SparsePaths, ", "))
+		sparseArgs := append([]string{"sparse-checkout", "set"}, settings.SparsePaths...)
+		if err := runGit(ctx, targetDir, out, sparseArgs...); err != nil {
+			return err
+		}
+	}
+
+	if ref != "" && isCommitHash(ref) {
+		fmt.Fprintf(out, "Checking out commit: %s\n", ref)
+		if err := runGit(ctx, targetDir, out, "checkout", "--detach", ref); err != nil {
+			return fmt.Errorf("commit '%s' not found in repository: %w", ref, err)
+		}
+	}
+
+	if settings.Submodules {
+		if err := runGit(ctx, targetDir, out, "submodule", "update", "--init", "--recursive", "--filter=blob:none"); err != nil {
+			fmt.Fprintf(out, "Warning: failed to initialize submodules: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// runGit runs a git CLI command, streaming its output to out
+func runGit(ctx context.Context, dir string, out io.Writer, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return nil
+}
+
+// updateSubmodules initializes and updates submodules recursively. When a
+// sparse checkout is in use, submodules outside the checked out paths are
+// skipped.
+func updateSubmodules(ctx context.Context, repo *git.Repository, auth transport.AuthMethod, sparsePaths []string, out io.Writer) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	submodules, err := worktree.Submodules()
+	if err != nil {
+		return fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	for _, sub := range submodules {
+		subPath := sub.Config().Path
+		if !inSparsePaths(subPath, sparsePaths) {
+			continue
+		}
+
+		fmt.Fprintf(out, "Updating submodule: %s\n", subPath)
+		err := sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+			Auth:              auth,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update submodule %s: %w", subPath, err)
+		}
+	}
+
+	return nil
+}
+
+// inSparsePaths reports whether p is inside one of the sparse paths. An
+// empty list matches everything.
+func inSparsePaths(p string, sparsePaths []string) bool {
+	if len(sparsePaths) == 0 {
+		return true
+	}
+	for _, sp := range sparsePaths {
+		if p == sp || strings.HasPrefix(p, sp+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors reported when the clone monitor cancels a clone
+var (
+	errCloneTooLarge = errors.New("repository exceeds the size limit")
+	errCloneStalled  = errors.New("clone stalled")
+)
+
+const (
+	// cloneStallTimeout cancels a clone that neither downloads nor prints
+	// anything for this long
+	cloneStallTimeout = 2 * time.Minute
+	// clonePollInterval is how often the clone monitor checks progress
+	clonePollInterval = time.Second
+)
+
+// cloneMonitor watches a clone's on-disk size and output to report progress,
+// enforce a size limit and cancel stalled transfers
+type cloneMonitor struct {
+	progress docker.ProgressFunc
+	dirs     []string
+	maxSize  int64
+	baseline []int64
+	cancel   context.CancelCauseFunc
+
+	mu           sync.Mutex
+	received     int64
+	lastActivity time.Time
+}
+
+// startCloneMonitor starts monitoring the directories a clone writes to. The
+// returned context is cancelled if the clone grows beyond maxSize (when
+// non-zero) or stalls; call stop once the clone returns.
+func startCloneMonitor(ctx context.Context, progress docker.ProgressFunc, maxSize int64, dirs ...string) (context.Context, *cloneMonitor, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	m := &cloneMonitor{
+		progress:     progress,
+		dirs:         dirs,
+		maxSize:      maxSize,
+		cancel:       cancel,
+		lastActivity: time.Now(),
+	}
+	// Existing data, like a cached mirror, doesn't count towards the limit
+	for _, dir := range dirs {
+		m.baseline = append(m.baseline, gitcache.DirSize(dir))
+	}
+
+	done := make(chan struct{})
+	go m.run(ctx, done)
+
+	return ctx, m, func() {
+		close(done)
+		cancel(nil)
+	}
+}
+
+// Touch records output from the clone, which counts as activity
+func (m *cloneMonitor) Touch() {
+	m.mu.Lock()
+	m.lastActivity = time.Now()
+	m.mu.Unlock()
+}
+
+// Received returns how many bytes the clone has written so far
+func (m *cloneMonitor) Received() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.received
+}
+
+// growth returns how much the largest directory has grown. A cached clone
+// writes the same objects to the mirror and then the checkout, so the
+// directories aren't summed.
+func (m *cloneMonitor) growth() int64 {
+	var largest int64
+	for i, dir := range m.dirs {
+		if grown := gitcache.DirSize(dir) - m.baseline[i]; grown > largest {
+			largest = grown
+		}
+	}
+	return largest
+}
+
+func (m *cloneMonitor) run(ctx context.Context, done chan struct{}) {
+	ticker := time.NewTicker(clonePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		received := m.growth()
+
+		m.mu.Lock()
+		if received != m.received {
+			m.received = received
+			m.lastActivity = time.Now()
+			m.progress.Update(docker.PhaseClone, fmt.Sprintf("%s transferred", formatSize(received)))
+		}
+		idle := time.Since(m.lastActivity)
+		m.mu.Unlock()
+
+		if m.maxSize > 0 && received > m.maxSize {
+			m.cancel(fmt.Errorf("%w (%s > %s)", errCloneTooLarge, formatSize(received), formatSize(m.maxSize)))
+			return
+		}
+		if idle > cloneStallTimeout {
+			m.cancel(fmt.Errorf("%w: no progress for %v", errCloneStalled, cloneStallTimeout))
+			return
+		}
+	}
+}
+
+// activityWriter marks the monitor active whenever output is written
+type activityWriter struct {
+	io.Writer
+	monitor *cloneMonitor
+}
+
+func (w activityWriter) Write(p []byte) (int, error) {
+	w.monitor.Touch()
+	return w.Writer.Write(p)
+}
+
+// githubRepoPattern extracts owner and repository from GitHub clone URLs
+var githubRepoPattern = regexp.MustCompile(`github\.com[/:]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+// remoteRepoSize asks the hosting API for a repository's size before
+// cloning. Only GitHub is supported; ok is false if the size is unknown.
+func remoteRepoSize(ctx context.Context, gitURL string) (size int64, ok bool) {
+	m := githubRepoPattern.FindStringSubmatch(gitURL)
+	if m == nil {
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://api.github.com/repos/%s/%s", m[1], m[2]), nil)
+	if err != nil {
+		return 0, false
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false
+	}
+
+	var repo struct {
+		Size int64 `json:"size"` // Kilobytes
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&repo); err != nil {
+		return 0, false
+	}
+	return repo.Size * 1024, true
+}
+
+// confirmRepoSize checks the remote's size against maxSize before cloning,
+// asking for confirmation on a terminal and refusing otherwise. It returns
+// the limit to enforce during the clone, which is lifted once the user has
+// agreed to a larger clone.
+func confirmRepoSize(ctx context.Context, gitURL string, maxSize int64) (int64, error) {
+	if maxSize <= 0 {
+		return 0, nil
+	}
+	size, ok := remoteRepoSize(ctx, normalizeGitURL(gitURL))
+	if !ok || size <= maxSize {
+		return maxSize, nil
+	}
+
+	fmt.Printf("Repository is about %s, larger than the %s limit.\n", formatSize(size), formatSize(maxSize))
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return 0, fmt.Errorf("%w; use --max-repo-size to raise the limit or --partial/--path to fetch less", errCloneTooLarge)
+	}
+
+	fmt.Print("Clone anyway? [y/N] ")
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response = strings.ToLower(strings.TrimSpace(response))
+	if response != "y" && response != "yes" {
+		return 0, fmt.Errorf("clone cancelled")
+	}
+	return 0, nil
+}
+
+// cloneContextError explains why a clone's context ended
+func cloneContextError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, context.DeadlineExceeded):
+		return fmt.Errorf("clone timed out; use --clone-timeout to allow longer")
+	case errors.Is(cause, errCloneTooLarge):
+		return fmt.Errorf("clone aborted: %v; use --max-repo-size to raise the limit or --partial/--path to fetch less", cause)
+	case errors.Is(cause, errCloneStalled):
+		return fmt.Errorf("clone aborted: %v", cause)
+	default:
+		return fmt.Errorf("clone cancelled")
+	}
+}
+
+// describeClone summarizes a finished clone as its HEAD commit and size
+func describeClone(dir string) string {
+	size := formatSize(gitcache.DirSize(filepath.Join(dir, ".git")))
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return size
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return size
+	}
+	return fmt.Sprintf("%s, %s", head.Hash().String()[:7], size)
+}
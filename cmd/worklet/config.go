@@ -0,0 +1,146 @@
+package worklet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	configMigrateDryRun bool
+	configConvertTo     string
+	configConvertDryRun bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the project config file",
+}
+
+var configMigrateCmd = &cobra.Command{
+	Use:   "migrate [dir]",
+	Short: "Upgrade the project config to the current schema version",
+	Long: `Older config files are upgraded in memory whenever worklet loads them.
+migrate rewrites the file in the current format so it no longer needs
+upgrading, and records the schema version in its "version" field. The file
+keeps its format, be it .worklet.jsonc, .worklet.yaml or .worklet.toml.
+
+Comments can't be carried over, so the original file is kept alongside it
+with a .bak suffix. Use --dry-run to print the result instead.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		data, configPath, format, err := config.ReadConfigFile(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		original, err := os.ReadFile(configPath)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		migratedJSON, from, changes, err := config.MigrateJSONC(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", configPath, err)
+		}
+		if from == config.CurrentVersion {
+			fmt.Printf("%s is already at version %d\n", configPath, config.CurrentVersion)
+			return nil
+		}
+		migrated, err := config.FromJSON(migratedJSON, format)
+		if err != nil {
+			return err
+		}
+
+		if configMigrateDryRun {
+			fmt.Print(string(migrated))
+			return nil
+		}
+
+		backupPath := configPath + ".bak"
+		if err := os.WriteFile(backupPath, original, 0644); err != nil {
+			return fmt.Errorf("failed to back up config file: %w", err)
+		}
+		if err := storage.WriteFileAtomic(configPath, migrated, 0644); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+
+		fmt.Printf("✓ Migrated %s from version %d to %d\n", configPath, from, config.CurrentVersion)
+		for _, change := range changes {
+			fmt.Printf("  - %s\n", change)
+		}
+		fmt.Printf("The original is at %s\n", backupPath)
+		return nil
+	},
+}
+
+var configConvertCmd = &cobra.Command{
+	Use:   "convert [dir]",
+	Short: "Convert the project config to JSONC, YAML or TOML",
+	Long: `Rewrites the project config in another format: .worklet.jsonc,
+.worklet.yaml or .worklet.toml, as chosen by --to. Worklet reads all three
+the same way, but a project may only have one, so the original file is
+renamed with a .bak suffix.
+
+Comments can't be carried over, and TOML can't express null values, which
+are left out. Use --dry-run to print the result instead.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		to, err := config.ParseConfigFormat(configConvertTo)
+		if err != nil {
+			return err
+		}
+
+		data, configPath, format, err := config.ReadConfigFile(dir)
+		if err != nil {
+			return fmt.Errorf("failed to read config file: %w", err)
+		}
+		if format == to {
+			return fmt.Errorf("%s is already %s", configPath, to)
+		}
+
+		converted, err := config.FromJSON(data, to)
+		if err != nil {
+			return err
+		}
+		if configConvertDryRun {
+			fmt.Print(string(converted))
+			return nil
+		}
+
+		targetPath := filepath.Join(filepath.Dir(configPath), config.ConfigFileName(to))
+		if err := storage.WriteFileAtomic(targetPath, converted, 0644); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+		backupPath := configPath + ".bak"
+		if err := os.Rename(configPath, backupPath); err != nil {
+			os.Remove(targetPath)
+			return fmt.Errorf("failed to back up config file: %w", err)
+		}
+
+		fmt.Printf("✓ Converted %s to %s\n", configPath, targetPath)
+		fmt.Printf("The original is at %s\n", backupPath)
+		return nil
+	},
+}
+
+func init() {
+	configMigrateCmd.Flags().BoolVar(&configMigrateDryRun, "dry-run", false, "Print the migrated config without writing it")
+	configConvertCmd.Flags().StringVar(&configConvertTo, "to", "", "Format to convert to: jsonc, yaml or toml")
+	configConvertCmd.Flags().BoolVar(&configConvertDryRun, "dry-run", false, "Print the converted config without writing it")
+	configConvertCmd.MarkFlagRequired("to")
+	configCmd.AddCommand(configMigrateCmd)
+	configCmd.AddCommand(configConvertCmd)
+}
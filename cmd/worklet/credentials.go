@@ -2,7 +2,11 @@ package worklet
 
 import (
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/nolanleung/worklet/internal/config"
 	"github.com/nolanleung/worklet/internal/docker"
 	"github.com/spf13/cobra"
 )
@@ -10,7 +14,92 @@ import (
 var credentialsCmd = &cobra.Command{
 	Use:   "credentials",
 	Short: "Manage credentials for external services",
-	Long:  `Manage credentials for external services like Claude that can be used inside worklet containers.`,
+	Long: `Manage credentials for external services like Claude, SSH and cloud providers
+that can be used inside worklet containers.`,
+}
+
+var credentialsClearForce bool
+
+var credentialsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List credential providers and whether they're configured",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROVIDER\tSTATUS\tSOURCE")
+		for _, provider := range docker.CredentialProviders() {
+			status := "not configured"
+			if provider.Configured() {
+				status = "configured"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", provider.Name(), status, provider.Description())
+		}
+		w.Flush()
+		fmt.Println("\nRun 'worklet credentials test <provider>' to check that a provider's credentials work.")
+		return nil
+	},
+}
+
+var credentialsSetupCmd = &cobra.Command{
+	Use:   "setup <provider>",
+	Short: "Set up a provider's credentials",
+	Long: `Set up a provider's credentials: store them in a Docker volume for claude
+and ssh, or log in with the cloud's CLI for providers exported from the host.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provider, err := docker.FindCredentialProvider(args[0])
+		if err != nil {
+			return err
+		}
+		return provider.Setup()
+	},
+}
+
+var credentialsTestCmd = &cobra.Command{
+	Use:   "test <provider>",
+	Short: "Check that a provider's credentials work",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provider, err := docker.FindCredentialProvider(args[0])
+		if err != nil {
+			return err
+		}
+		detail, err := provider.Test(cmd.Context())
+		if err != nil {
+			fmt.Printf("✗ %s credentials don't work: %v\n", provider.Name(), err)
+			fmt.Printf("  Run 'worklet credentials setup %s' to set them up\n", provider.Name())
+			return silentExit(cmd, 1)
+		}
+		fmt.Printf("✓ %s credentials work (%s)\n", provider.Name(), detail)
+		return nil
+	},
+}
+
+var credentialsClearCmd = &cobra.Command{
+	Use:   "clear <provider>",
+	Short: "Remove the credentials worklet stores for a provider",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provider, err := docker.FindCredentialProvider(args[0])
+		if err != nil {
+			return err
+		}
+		if !credentialsClearForce && provider.Configured() {
+			ok, err := confirm(fmt.Sprintf("Remove the stored %s credentials?", provider.Name()))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				fmt.Println("Cancelled.")
+				return nil
+			}
+		}
+		if err := provider.Clear(); err != nil {
+			return err
+		}
+		fmt.Printf("%s credentials have been cleared.\n", provider.Name())
+		return nil
+	},
 }
 
 var credentialsClaudeCmd = &cobra.Command{
@@ -27,48 +116,90 @@ This will store credentials in a Docker volume that's automatically mounted in w
 	RunE: runCredentialsClaudeSetup,
 }
 
+var credentialsClaudeLoginCmd = &cobra.Command{
+	Use:   "login [profile]",
+	Short: "Log a Claude profile in",
+	Long: `Run the Claude login process for a profile, the active one by default,
+replacing its credentials. Each profile is a separate account, stored in its
+own Docker volume.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCredentialsClaudeLogin,
+}
+
 var credentialsClaudeStatusCmd = &cobra.Command{
-	Use:   "status",
+	Use:   "status [profile]",
 	Short: "Check Claude credential status",
-	Long:  `Check if Claude credentials are configured.`,
+	Long: `Check the Claude credentials of a profile, or of every profile, reading
+them in a throwaway container to see whether their token is still usable.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: runCredentialsClaudeStatus,
 }
 
+var credentialsClaudeSwitchCmd = &cobra.Command{
+	Use:   "switch <profile>",
+	Short: "Switch the Claude profile sessions use",
+	Long: `Make a profile the one sessions use, unless their config picks one with
+run.credentials.claudeProfile.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runCredentialsClaudeSwitch,
+}
+
 var credentialsClaudeClearCmd = &cobra.Command{
-	Use:   "clear",
+	Use:   "clear [profile]",
 	Short: "Clear Claude credentials",
-	Long:  `Remove stored Claude credentials.`,
-	RunE: runCredentialsClaudeClear,
+	Long:  `Remove the stored Claude credentials of a profile, the active one by default.`,
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runCredentialsClaudeClear,
 }
 
 func init() {
 	// Add credentials command to root
 	rootCmd.AddCommand(credentialsCmd)
 	
+	// Add provider subcommands
+	credentialsClearCmd.Flags().BoolVarP(&credentialsClearForce, "force", "f", false, "Don't ask for confirmation")
+	credentialsCmd.AddCommand(credentialsListCmd)
+	credentialsCmd.AddCommand(credentialsSetupCmd)
+	credentialsCmd.AddCommand(credentialsTestCmd)
+	credentialsCmd.AddCommand(credentialsClearCmd)
+
 	// Add claude subcommand
 	credentialsCmd.AddCommand(credentialsClaudeCmd)
 	
 	// Add claude subcommands
 	credentialsClaudeCmd.AddCommand(credentialsClaudeSetupCmd)
+	credentialsClaudeCmd.AddCommand(credentialsClaudeLoginCmd)
 	credentialsClaudeCmd.AddCommand(credentialsClaudeStatusCmd)
+	credentialsClaudeCmd.AddCommand(credentialsClaudeSwitchCmd)
 	credentialsClaudeCmd.AddCommand(credentialsClaudeClearCmd)
 }
 
+// claudeProfileArg returns the profile named by a command's optional
+// argument, or the active one
+func claudeProfileArg(args []string) (string, error) {
+	if len(args) == 0 {
+		return config.ActiveClaudeProfile(), nil
+	}
+	return args[0], config.ValidateClaudeProfile(args[0])
+}
+
 func runCredentialsClaudeSetup(cmd *cobra.Command, args []string) error {
+	profile := config.ActiveClaudeProfile()
+
 	// Check current status first
-	configured, err := docker.CheckClaudeCredentials()
+	status, err := docker.CheckClaudeCredentials(profile)
 	if err != nil {
 		return fmt.Errorf("failed to check credential status: %w", err)
 	}
 	
-	if configured {
+	if status.Configured {
 		fmt.Println("Claude credentials are already configured.")
-		fmt.Println("Run 'worklet credentials claude clear' to remove them first if you want to reconfigure.")
+		fmt.Println("Run 'worklet credentials claude login' to log in again.")
 		return nil
 	}
 	
 	// Setup credentials
-	if err := docker.SetupClaudeCredentials(); err != nil {
+	if err := docker.SetupClaudeCredentials(profile); err != nil {
 		return fmt.Errorf("failed to setup Claude credentials: %w", err)
 	}
 	
@@ -84,38 +215,113 @@ func runCredentialsClaudeSetup(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runCredentialsClaudeLogin(cmd *cobra.Command, args []string) error {
+	profile, err := claudeProfileArg(args)
+	if err != nil {
+		return err
+	}
+	if err := docker.SetupClaudeCredentials(profile); err != nil {
+		return fmt.Errorf("failed to log in Claude profile %s: %w", profile, err)
+	}
+	if profile != config.ActiveClaudeProfile() {
+		fmt.Printf("Run 'worklet credentials claude switch %s' to use it in sessions, or set run.credentials.claudeProfile.\n", profile)
+	}
+	return nil
+}
+
 func runCredentialsClaudeStatus(cmd *cobra.Command, args []string) error {
-	configured, err := docker.CheckClaudeCredentials()
+	profiles := args
+	if len(args) == 0 {
+		var err error
+		if profiles, err = docker.ListClaudeProfiles(); err != nil {
+			return err
+		}
+		if len(profiles) == 0 {
+			fmt.Println("✗ Claude credentials are not configured")
+			fmt.Println("  Run 'worklet credentials claude setup' to configure")
+			return nil
+		}
+	} else if err := config.ValidateClaudeProfile(args[0]); err != nil {
+		return err
+	}
+
+	active := config.ActiveClaudeProfile()
+	for i, profile := range profiles {
+		status, err := docker.CheckClaudeCredentials(profile)
+		if err != nil {
+			return fmt.Errorf("failed to check credential status: %w", err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		name := profile
+		if profile == active {
+			name += " (active)"
+		}
+
+		if problem := status.Problem(); problem != "" {
+			fmt.Printf("✗ Claude profile %s: %s\n", name, problem)
+			fmt.Printf("  Run 'worklet credentials claude login %s' to log in\n", profile)
+			continue
+		}
+		fmt.Printf("✓ Claude profile %s is configured\n", name)
+		fmt.Printf("  Volume: %s\n", status.Volume)
+		switch {
+		case status.APIKey:
+			fmt.Println("  Login: API key")
+		case status.Subscription != "":
+			fmt.Printf("  Login: Claude account (%s)\n", status.Subscription)
+		}
+		if !status.ExpiresAt.IsZero() {
+			if time.Now().Before(status.ExpiresAt) {
+				fmt.Printf("  Token: valid until %s\n", status.ExpiresAt.Format("2006-01-02 15:04"))
+			} else {
+				fmt.Println("  Token: expired; Claude refreshes it on next use")
+			}
+		}
+	}
+	
+	return nil
+}
+
+func runCredentialsClaudeSwitch(cmd *cobra.Command, args []string) error {
+	profile := args[0]
+	if err := config.ValidateClaudeProfile(profile); err != nil {
+		return err
+	}
+	status, err := docker.CheckClaudeCredentials(profile)
 	if err != nil {
 		return fmt.Errorf("failed to check credential status: %w", err)
 	}
-	
-	if configured {
-		fmt.Println("✓ Claude credentials are configured")
-		fmt.Printf("  Volume: %s\n", docker.ClaudeCredentialsVolume)
-		fmt.Println("  Status: Ready to use in worklet containers")
-	} else {
-		fmt.Println("✗ Claude credentials are not configured")
-		fmt.Println("  Run 'worklet credentials claude setup' to configure")
+	if !status.Configured {
+		return fmt.Errorf("Claude profile %s isn't configured; run 'worklet credentials claude login %s' first", profile, profile)
 	}
-	
+	if err := config.SetActiveClaudeProfile(profile); err != nil {
+		return err
+	}
+	fmt.Printf("Sessions now use Claude profile %s\n", profile)
 	return nil
 }
 
 func runCredentialsClaudeClear(cmd *cobra.Command, args []string) error {
+	profile, err := claudeProfileArg(args)
+	if err != nil {
+		return err
+	}
+
 	// Check if credentials exist
-	configured, err := docker.CheckClaudeCredentials()
+	exists, err := docker.VolumeExists(config.ClaudeVolume(profile))
 	if err != nil {
 		return fmt.Errorf("failed to check credential status: %w", err)
 	}
 	
-	if !configured {
+	if !exists {
 		fmt.Println("No Claude credentials to clear.")
 		return nil
 	}
 	
 	// Confirm with user
-	fmt.Println("This will remove all stored Claude credentials.")
+	fmt.Printf("This will remove the stored Claude credentials of profile %s.\n", profile)
 	fmt.Print("Are you sure? (y/N): ")
 	
 	var response string
@@ -127,10 +333,17 @@ func runCredentialsClaudeClear(cmd *cobra.Command, args []string) error {
 	}
 	
 	// Clear credentials
-	if err := docker.ClearClaudeCredentials(); err != nil {
+	if err := docker.ClearClaudeCredentials(profile); err != nil {
 		return fmt.Errorf("failed to clear credentials: %w", err)
 	}
+
+	// Go back to the default profile rather than one that's gone
+	if profile == config.ActiveClaudeProfile() && profile != config.DefaultClaudeProfile {
+		if err := config.SetActiveClaudeProfile(config.DefaultClaudeProfile); err != nil {
+			return err
+		}
+	}
 	
 	fmt.Println("Claude credentials have been cleared.")
 	return nil
-}
\ No newline at end of file
+}
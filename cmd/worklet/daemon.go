@@ -3,15 +3,20 @@ package worklet
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/nolanleung/worklet/internal/logfile"
+	"github.com/nolanleung/worklet/internal/storage"
 	"github.com/nolanleung/worklet/internal/version"
 	"github.com/nolanleung/worklet/pkg/daemon"
 	"github.com/spf13/cobra"
@@ -39,13 +44,32 @@ var daemonStopCmd = &cobra.Command{
 var daemonStatusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Check daemon status",
-	RunE:  runDaemonStatus,
+	Long: `Show whether the daemon is running and the forks it has registered.
+
+With --verbose the daemon also runs its self-check and reports its socket
+latency, whether Docker and its event stream are reachable, its goroutine
+and open file counts, and any recovery actions it has taken, such as
+reconnecting the Docker event stream.`,
+	RunE: runDaemonStatus,
 }
 
 var daemonLogsCmd = &cobra.Command{
 	Use:   "logs",
 	Short: "View daemon logs",
-	RunE:  runDaemonLogs,
+	Long: `Show the daemon log, including logs rotated away, and follow new lines.
+
+The log is rotated when the daemon starts once it is over 10 MB; the last 5
+rotations are kept for up to a week. Without --since or --grep the last
+lines are shown and new ones followed, like tail -f; with either of them the
+matching lines are shown and the command exits, unless --follow is given.
+
+Examples:
+  worklet daemon logs                          # Last 100 lines, then follow
+  worklet daemon logs --since 2h               # Everything from the last two hours
+  worklet daemon logs --since "2024-05-01 09:00" --grep nginx
+  worklet daemon logs --grep 'abc123|def456' -f  # Follow two sessions`,
+	Args: cobra.NoArgs,
+	RunE: runDaemonLogs,
 }
 
 var daemonRestartCmd = &cobra.Command{
@@ -55,21 +79,54 @@ var daemonRestartCmd = &cobra.Command{
 	RunE:  runDaemonRestart,
 }
 
+var daemonInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Start the daemon at login",
+	Long: `Install the daemon with the system's service manager, a launchd agent on
+macOS or a systemd user unit on Linux, and start it. The service starts the
+daemon at login and restarts it if it crashes, and worklet run, daemon start
+and daemon stop go through it from then on. Run install again after moving
+the worklet binary; Homebrew installs are referenced through their stable
+bin symlink, so upgrades don't need it.`,
+	Args: cobra.NoArgs,
+	RunE: runDaemonInstall,
+}
+
+var daemonUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop starting the daemon at login",
+	Long:  `Stop the daemon and remove the service installed by 'worklet daemon install'.`,
+	Args:  cobra.NoArgs,
+	RunE:  runDaemonUninstall,
+}
+
 var daemonRefreshCmd = &cobra.Command{
 	Use:   "refresh",
 	Short: "Refresh daemon state",
-	Long:  `Refresh the daemon's state by discovering all running worklet containers and updating registrations. This is useful when containers are started/stopped outside of worklet.`,
-	RunE:  runDaemonRefresh,
+	Long:  `Refresh the daemon's state by discovering all running worklet containers and updating registrations and the proxy config. This is useful when containers are started/stopped outside of worklet. With --quiet only the IDs of the discovered forks are printed.`,
+	RunE:  withOutput(runDaemonRefresh),
 }
 
 var (
-	daemonForeground bool
-	daemonForceStart bool
+	daemonForeground    bool
+	daemonForceStart    bool
+	daemonStatusVerbose bool
+	daemonLogsSince     string
+	daemonLogsGrep      string
+	daemonLogsLines     int
+	daemonLogsFollow    bool
 )
 
 func init() {
 	daemonStartCmd.Flags().BoolVar(&daemonForeground, "foreground", false, "Run daemon in foreground")
 	daemonStartCmd.Flags().BoolVar(&daemonForceStart, "force", false, "Force start daemon even if another version is running")
+	daemonStatusCmd.Flags().BoolVarP(&daemonStatusVerbose, "verbose", "v", false, "Also show the daemon's self-check")
+	daemonLogsCmd.Flags().StringVar(&daemonLogsSince, "since", "", "Only show lines logged since a duration ago (2h) or a time (2024-05-01 09:00)")
+	daemonLogsCmd.Flags().StringVar(&daemonLogsGrep, "grep", "", "Only show lines matching a regular expression")
+	daemonLogsCmd.Flags().IntVarP(&daemonLogsLines, "lines", "n", 100, "Number of lines to show (0 for all)")
+	daemonLogsCmd.Flags().BoolVarP(&daemonLogsFollow, "follow", "f", false, "Keep showing new lines (the default without --since or --grep)")
+
+	addOutputFlags(daemonRefreshCmd)
 
 	daemonCmd.AddCommand(daemonStartCmd)
 	daemonCmd.AddCommand(daemonStopCmd)
@@ -77,6 +134,8 @@ func init() {
 	daemonCmd.AddCommand(daemonRefreshCmd)
 	daemonCmd.AddCommand(daemonStatusCmd)
 	daemonCmd.AddCommand(daemonLogsCmd)
+	daemonCmd.AddCommand(daemonInstallCmd)
+	daemonCmd.AddCommand(daemonUninstallCmd)
 }
 
 func runDaemonStart(cmd *cobra.Command, args []string) error {
@@ -151,6 +210,79 @@ func runDaemonStart(cmd *cobra.Command, args []string) error {
 	return StartDaemonBackground(socketPath)
 }
 
+func runDaemonInstall(cmd *cobra.Command, args []string) error {
+	service, err := currentDaemonService()
+	if err != nil {
+		return err
+	}
+	exePath, err := serviceExecutable()
+	if err != nil {
+		return err
+	}
+	logFile, err := daemonLogFile()
+	if err != nil {
+		return err
+	}
+	rotateDaemonLog(logFile)
+
+	// The service's daemon takes over from one started in the background
+	socketPath := daemon.GetDefaultSocketPath()
+	if daemon.IsDaemonRunning(socketPath) {
+		fmt.Println("Stopping running daemon...")
+		if err := runDaemonStop(cmd, args); err != nil {
+			return fmt.Errorf("failed to stop running daemon: %w", err)
+		}
+	}
+
+	if err := service.Install(exePath, logFile); err != nil {
+		return fmt.Errorf("failed to install %s: %w", service.Describe(), err)
+	}
+	fmt.Printf("Installed %s: %s\n", service.Describe(), service.path)
+
+	if !waitForDaemon(socketPath, 10*time.Second) {
+		return fmt.Errorf("daemon failed to start (check logs at %s)", logFile)
+	}
+	fmt.Println("Daemon started and will start at login")
+	fmt.Printf("Logs: %s\n", logFile)
+	return nil
+}
+
+func runDaemonUninstall(cmd *cobra.Command, args []string) error {
+	service, err := currentDaemonService()
+	if err != nil {
+		return err
+	}
+	if !service.Installed() {
+		return fmt.Errorf("the daemon is not installed as a service")
+	}
+
+	if err := service.Uninstall(); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s: %s\n", service.Describe(), service.path)
+	return nil
+}
+
+// daemonLogFile returns the path of the daemon log, creating its directory
+func daemonLogFile() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	logDir := filepath.Join(homeDir, ".worklet", "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create log directory: %w", err)
+	}
+	return filepath.Join(logDir, "daemon.log"), nil
+}
+
+// rotateDaemonLog rotates the daemon log before a daemon starts writing to it
+func rotateDaemonLog(logFile string) {
+	if err := logfile.Rotate(logFile, logfile.DefaultRotateOptions); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
 func runDaemonForeground(socketPath string) error {
 	d := daemon.NewDaemon(socketPath)
 
@@ -170,22 +302,33 @@ func runDaemonForeground(socketPath string) error {
 	return d.Stop()
 }
 
-// StartDaemonBackground starts the daemon process in the background
+// StartDaemonBackground starts the daemon process in the background, through
+// its service if it is installed
 func StartDaemonBackground(socketPath string) error {
+	// Prepare log file
+	logFile, err := daemonLogFile()
+	if err != nil {
+		return err
+	}
+	rotateDaemonLog(logFile)
+
+	if service := installedDaemonService(); service != nil {
+		if err := service.Start(); err != nil {
+			return fmt.Errorf("failed to start %s: %w", service.Describe(), err)
+		}
+		if !waitForDaemon(socketPath, 10*time.Second) {
+			return fmt.Errorf("daemon failed to start (check logs at %s)", logFile)
+		}
+		fmt.Printf("Daemon started through its %s\n", service.Describe())
+		return nil
+	}
+
 	// Get executable path
 	exePath, err := os.Executable()
 	if err != nil {
 		return fmt.Errorf("failed to get executable path: %w", err)
 	}
-
-	// Prepare log file
 	homeDir, _ := os.UserHomeDir()
-	logDir := filepath.Join(homeDir, ".worklet", "logs")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
-		return fmt.Errorf("failed to create log directory: %w", err)
-	}
-
-	logFile := filepath.Join(logDir, "daemon.log")
 
 	// Start daemon process
 	cmd := exec.Command(exePath, "daemon", "start", "--foreground")
@@ -207,7 +350,10 @@ func StartDaemonBackground(socketPath string) error {
 
 	// Save PID
 	pidFile := filepath.Join(homeDir, ".worklet", "daemon.pid")
-	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644); err != nil {
+	err = storage.WithLock(pidFile, func() error {
+		return storage.WriteFileAtomic(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)), 0644)
+	})
+	if err != nil {
 		// Try to kill the process if we can't save the PID
 		cmd.Process.Kill()
 		return fmt.Errorf("failed to save daemon PID: %w", err)
@@ -235,6 +381,15 @@ func runDaemonStop(cmd *cobra.Command, args []string) error {
 	// Read PID
 	pidData, err := os.ReadFile(pidFile)
 	if err != nil {
+		// A daemon run by its service has no PID file and is stopped through
+		// the service, so it isn't restarted
+		if service := installedDaemonService(); service != nil && os.IsNotExist(err) {
+			if err := service.Stop(); err != nil {
+				return fmt.Errorf("failed to stop %s: %w", service.Describe(), err)
+			}
+			fmt.Println("Daemon stopped successfully")
+			return nil
+		}
 		if os.IsNotExist(err) {
 			return fmt.Errorf("daemon is not running (PID file not found)")
 		}
@@ -284,6 +439,15 @@ func runDaemonStop(cmd *cobra.Command, args []string) error {
 func runDaemonStatus(cmd *cobra.Command, args []string) error {
 	socketPath := daemon.GetDefaultSocketPath()
 
+	service, serviceErr := currentDaemonService()
+	switch {
+	case serviceErr != nil:
+	case service.Installed():
+		fmt.Printf("Service: %s installed at %s\n", service.Describe(), service.path)
+	default:
+		fmt.Println("Service: not installed (run 'worklet daemon install' to start the daemon at login)")
+	}
+
 	if !daemon.IsDaemonRunning(socketPath) {
 		fmt.Println("Daemon is not running")
 		return nil
@@ -301,6 +465,18 @@ func runDaemonStatus(cmd *cobra.Command, args []string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if daemonStatusVerbose {
+		report, err := client.Health(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check daemon health: %w", err)
+		}
+		printHealthReport(report)
+	} else if report, err := client.Health(ctx); err == nil && (report.Nginx.Error != "" || len(report.Nginx.Disabled) > 0) {
+		// A rejected nginx config leaves routes out, so it's always shown
+		fmt.Println()
+		printNginxStatus(report.Nginx)
+	}
+
 	forks, err := client.ListForks(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to list forks: %w", err)
@@ -325,20 +501,134 @@ func runDaemonStatus(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// printHealthReport prints the daemon's self-check
+func printHealthReport(report *daemon.HealthReport) {
+	status := "healthy"
+	if !report.Healthy {
+		status = "degraded"
+	}
+	fmt.Printf("\nHealth: %s\n", status)
+	for _, problem := range report.Problems {
+		fmt.Printf("  ✗ %s\n", problem)
+	}
+
+	uptime := time.Duration(report.Uptime * float64(time.Second))
+	fmt.Printf("  Uptime:          %s\n", uptime.Round(time.Second))
+	fmt.Printf("  Socket latency:  %.1fms\n", report.AcceptLatency)
+	if report.DockerError != "" {
+		fmt.Printf("  Docker:          unreachable (%s)\n", report.DockerError)
+	} else {
+		fmt.Printf("  Docker:          reachable (ping %.1fms)\n", report.DockerLatency)
+	}
+	events := "disconnected"
+	if report.EventsConnected {
+		events = "connected"
+	}
+	if !report.LastEventAt.IsZero() {
+		events += fmt.Sprintf(", last event %s ago", time.Since(report.LastEventAt).Round(time.Second))
+	}
+	fmt.Printf("  Event stream:    %s, %d reconnects\n", events, report.EventReconnects)
+	fmt.Printf("  Goroutines:      %d\n", report.Goroutines)
+	switch {
+	case report.OpenFiles < 0:
+		fmt.Println("  Open files:      unknown")
+	case report.MaxOpenFiles > 0:
+		fmt.Printf("  Open files:      %d of %d\n", report.OpenFiles, report.MaxOpenFiles)
+	default:
+		fmt.Printf("  Open files:      %d\n", report.OpenFiles)
+	}
+
+	printNginxStatus(report.Nginx)
+
+	if len(report.Recoveries) > 0 {
+		fmt.Println("  Recoveries:")
+		for _, recovery := range report.Recoveries {
+			fmt.Printf("    %s  %s: %s\n", formatTime(recovery.At), recovery.Action, recovery.Reason)
+		}
+	}
+
+	if r := report.Reconciliation; r != nil {
+		fmt.Printf("\nStartup reconciliation (%s):\n", formatTime(r.At))
+		fmt.Printf("  Registered:      %d\n", len(r.Registered))
+		for _, pruned := range r.Pruned {
+			fmt.Printf("  Pruned %s: %s\n", pruned.ForkID, pruned.Reason)
+		}
+		for _, forkID := range r.Unhealthy {
+			fmt.Printf("  Unhealthy %s: routed, failing its health check\n", forkID)
+		}
+		for _, host := range r.RemovedRoutes {
+			fmt.Printf("  Removed route %s\n", host)
+		}
+	}
+}
+
+// printNginxStatus prints how the latest nginx config updates went
+func printNginxStatus(status daemon.NginxStatus) {
+	switch {
+	case status.Error != "" && status.RolledBack:
+		fmt.Printf("  nginx config:    reload failed %s, rolled back to the last good config\n", formatTime(status.FailedAt))
+	case status.Error != "":
+		fmt.Printf("  nginx config:    rejected %s, still serving the last good config\n", formatTime(status.FailedAt))
+	case !status.LastUpdateAt.IsZero():
+		fmt.Printf("  nginx config:    updated %s\n", formatTime(status.LastUpdateAt))
+	}
+	if status.Error != "" {
+		for _, line := range strings.Split(status.Error, "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	for _, forkID := range slices.Sorted(maps.Keys(status.Disabled)) {
+		fmt.Printf("  Routes of %s disabled, nginx rejected its config:\n", forkID)
+		for _, line := range strings.Split(status.Disabled[forkID], "\n") {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+}
+
 func runDaemonLogs(cmd *cobra.Command, args []string) error {
 	homeDir, _ := os.UserHomeDir()
 	logFile := filepath.Join(homeDir, ".worklet", "logs", "daemon.log")
 
-	if _, err := os.Stat(logFile); os.IsNotExist(err) {
+	if _, err := os.Stat(logFile); os.IsNotExist(err) && len(logfile.Rotated(logFile)) == 0 {
 		return fmt.Errorf("log file not found: %s", logFile)
 	}
 
-	// Use tail to show logs
-	tailCmd := exec.Command("tail", "-f", "-n", "100", logFile)
-	tailCmd.Stdout = os.Stdout
-	tailCmd.Stderr = os.Stderr
+	var filter logfile.Filter
+	if daemonLogsSince != "" {
+		since, err := logfile.ParseSince(daemonLogsSince, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = since
+	}
+	if daemonLogsGrep != "" {
+		pattern, err := regexp.Compile(daemonLogsGrep)
+		if err != nil {
+			return fmt.Errorf("invalid --grep pattern: %w", err)
+		}
+		filter.Pattern = pattern
+	}
+
+	// Queries show what matched and exit unless asked to follow
+	follow := daemonLogsFollow
+	if !cmd.Flags().Changed("follow") {
+		follow = daemonLogsSince == "" && daemonLogsGrep == ""
+	}
+	lines := daemonLogsLines
+	if !cmd.Flags().Changed("lines") && daemonLogsSince != "" {
+		lines = 0
+	}
 
-	return tailCmd.Run()
+	if err := logfile.Query(os.Stdout, logFile, filter, lines); err != nil {
+		return err
+	}
+	if !follow {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return logfile.Follow(ctx, os.Stdout, logFile, filter)
 }
 
 func runDaemonRestart(cmd *cobra.Command, args []string) error {
@@ -375,7 +665,7 @@ func runDaemonRefresh(cmd *cobra.Command, args []string) error {
 	}
 	defer client.Close()
 	
-	fmt.Println("Refreshing daemon state...")
+	console.Println("Refreshing daemon state...")
 	
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -390,10 +680,17 @@ func runDaemonRefresh(cmd *cobra.Command, args []string) error {
 	forks, err := client.ListForks(ctx)
 	if err != nil {
 		// Refresh succeeded but couldn't get list - not critical
-		fmt.Println("✓ Daemon refreshed successfully")
+		console.Println("✓ Daemon refreshed successfully")
 		return nil
 	}
 	
+	if console.Quiet() {
+		for _, fork := range forks {
+			console.Resultf("%s\n", fork.ForkID)
+		}
+		return nil
+	}
+
 	fmt.Println("✓ Daemon refreshed successfully")
 	fmt.Printf("\nDiscovered %d active fork(s):\n", len(forks))
 	
@@ -0,0 +1,210 @@
+package worklet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	swapTimeout    time.Duration
+	swapDrain      time.Duration
+	swapKeepOld    bool
+	swapKeepFailed bool
+)
+
+var deploySwapCmd = &cobra.Command{
+	Use:   "deploy-swap [dir]",
+	Short: "Start a new session and move the project's stable URLs to it",
+	Long: `Blue/green swap for a project: start a new session, wait until its HTTP
+services answer, then point the project's stable URLs at it and retire the
+session they pointed at before.
+
+Stable URLs leave out the session ID, e.g. http://api.myapp.local.worklet.sh
+for the api service of myapp, so they stay the same across swaps. The proxy
+switches them over in a single reload, so requests never reach a session
+that isn't up yet.
+
+If the new session doesn't become healthy within --timeout it is removed
+(unless --keep-failed is given) and the stable URLs keep pointing at the old
+session. The old session is removed once requests already in flight have had
+--drain to finish, unless --keep-old is given.
+
+Examples:
+  worklet deploy-swap                  # Swap the project in the current directory
+  worklet deploy-swap ./shop           # Swap another project
+  worklet deploy-swap --keep-old       # Keep the old session running`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDeploySwap,
+}
+
+func init() {
+	deploySwapCmd.Flags().DurationVar(&swapTimeout, "timeout", 5*time.Minute, "How long the new session has to become healthy")
+	deploySwapCmd.Flags().DurationVar(&swapDrain, "drain", 5*time.Second, "How long the old session keeps serving requests in flight before it's removed")
+	deploySwapCmd.Flags().BoolVar(&swapKeepOld, "keep-old", false, "Don't remove the old session after the swap")
+	deploySwapCmd.Flags().BoolVar(&swapKeepFailed, "keep-failed", false, "Don't remove the new session if it doesn't become healthy")
+}
+
+func runDeploySwap(cmd *cobra.Command, args []string) error {
+	dir := "."
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve directory: %w", err)
+	}
+	cfg, err := config.LoadConfigOrDetect(absDir, false)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	projectName := cfg.Name
+	if projectName == "" {
+		projectName = "worklet"
+	}
+
+	var services []config.ServiceConfig
+	for _, svc := range cfg.Services {
+		if !svc.IsStream() {
+			services = append(services, svc)
+		}
+	}
+	if len(services) == 0 {
+		return fmt.Errorf("%s has no HTTP services to route; add one to services in its worklet config", absDir)
+	}
+
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("daemon is not running. Start it with: worklet daemon start")
+	}
+	defer client.Close()
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	fmt.Printf("Starting a new session of %s...\n", projectName)
+	sessionID, err := startDetachedSession(ctx, absDir)
+	if err != nil {
+		return err
+	}
+
+	urls := make([]string, 0, len(services))
+	for _, svc := range services {
+		urls = append(urls, config.ServiceURL(serviceSubdomain(svc), projectName, sessionID))
+	}
+	fmt.Printf("Waiting for session %s to become healthy...\n", sessionID)
+	if err := waitHealthy(ctx, urls, swapTimeout); err != nil {
+		if !swapKeepFailed {
+			removeCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if rmErr := docker.RemoveSession(removeCtx, sessionID); rmErr != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to remove session %s: %v\n", sessionID, rmErr)
+			}
+		}
+		return fmt.Errorf("session %s %v; the stable URLs still point at the previous session", sessionID, err)
+	}
+
+	swapCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	stable, err := client.SetStable(swapCtx, projectName, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to swap session %s in: %w", sessionID, err)
+	}
+
+	fmt.Printf("Swapped session %s in. Stable URLs:\n", sessionID)
+	for _, svc := range services {
+		fmt.Printf("  - %s: %s\n", svc.Name, config.AliasURL(serviceSubdomain(svc), projectName))
+	}
+
+	if stable.Previous == "" {
+		return nil
+	}
+	if swapKeepOld {
+		fmt.Printf("Kept previous session %s running\n", stable.Previous)
+		return nil
+	}
+	time.Sleep(swapDrain)
+	removeCtx, cancelRemove := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancelRemove()
+	if err := docker.RemoveSession(removeCtx, stable.Previous); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to retire previous session %s: %v\n", stable.Previous, err)
+		return nil
+	}
+	fmt.Printf("Retired previous session %s\n", stable.Previous)
+	return nil
+}
+
+// serviceSubdomain returns the subdomain a service is served at
+func serviceSubdomain(svc config.ServiceConfig) string {
+	if svc.Subdomain == "" {
+		return svc.Name
+	}
+	return svc.Subdomain
+}
+
+// startDetachedSession runs 'worklet run' in dir and returns the ID of the
+// session it started. Progress and errors go to stderr.
+func startDetachedSession(ctx context.Context, dir string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate worklet executable: %w", err)
+	}
+
+	var stdout bytes.Buffer
+	c := exec.CommandContext(ctx, executable, "run", "--quiet")
+	c.Dir = dir
+	c.Stdout = &stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("worklet run failed: %w", err)
+	}
+
+	// Quiet runs print the session ID first, then the service URLs
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("worklet run didn't print a session ID")
+}
+
+// waitHealthy polls urls until every one of them answers, or timeout passes.
+// A URL the proxy doesn't route yet doesn't count, though its default
+// server answers it with a 404.
+func waitHealthy(ctx context.Context, urls []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		health := probeURLs(urls)
+		var waiting []string
+		for _, url := range urls {
+			if health[url] != urlUp {
+				waiting = append(waiting, url)
+			}
+		}
+		if len(waiting) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("didn't become healthy within %s (no answer from %s)", timeout, strings.Join(waiting, ", "))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
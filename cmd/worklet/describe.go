@@ -0,0 +1,184 @@
+package worklet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var describeJSON bool
+
+var describeCmd = &cobra.Command{
+	Use:   "describe <session-id> [other-session-id]",
+	Short: "Show what a session was created from",
+	Long: `Print a reproducibility manifest for a session: the image and its
+digest, the worklet version, git commit and config hash it was started
+with, the compose file hash, the names of its environment variables and
+its mounts. Environment values are never shown.
+
+With a second session ID only the fields that differ between the two
+sessions are printed. A manifest saved with --json can be started again
+with 'worklet recreate'.
+
+Examples:
+  worklet describe abc123            # Manifest of abc123
+  worklet describe abc123 --json     # As JSON, e.g. to keep for audits
+  worklet describe abc123 def456     # What differs between two sessions`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runDescribe,
+}
+
+func init() {
+	describeCmd.Flags().BoolVar(&describeJSON, "json", false, "Output as JSON")
+}
+
+func runDescribe(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+	defer cancel()
+
+	var descriptions []*docker.Description
+	for _, sessionID := range args {
+		desc, err := docker.Describe(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		descriptions = append(descriptions, desc)
+	}
+
+	if len(descriptions) == 2 {
+		diff := diffDescriptions(descriptions[0], descriptions[1])
+		if describeJSON {
+			return writeJSON(os.Stdout, diff)
+		}
+		printDescriptionDiff(os.Stdout, args[0], args[1], diff)
+		return nil
+	}
+
+	if describeJSON {
+		return writeJSON(os.Stdout, descriptions[0])
+	}
+	printDescription(os.Stdout, descriptions[0])
+	return nil
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// descriptionFields returns a description's fields as labelled strings in
+// display order, so descriptions can be printed and compared the same way
+func descriptionFields(desc *docker.Description) [][2]string {
+	// Sessions started by older versions have no provenance labels
+	recorded := desc.WorkletVersion != ""
+	orUnknown := func(s string) string {
+		switch {
+		case s != "":
+			return s
+		case recorded:
+			return "(none)"
+		default:
+			return "(unknown)"
+		}
+	}
+	digest := desc.ImageDigest
+	if digest == "" {
+		digest = "(none, built locally)"
+	}
+
+	fields := [][2]string{
+		{"Session", desc.SessionID},
+		{"Project", desc.ProjectName},
+		{"Container", desc.ContainerID},
+		{"Status", desc.Status},
+		{"Created", desc.CreatedAt.Local().Format(time.RFC3339)},
+		{"Workdir", desc.WorkDir},
+		{"Mode", orUnknown(desc.Mode)},
+		{"Image", desc.Image},
+		{"Image ID", desc.ImageID},
+		{"Image digest", digest},
+		{"Base image", orUnknown(desc.BaseImage)},
+		{"Base digest", orUnknown(desc.BaseImageDigest)},
+		{"Command", orUnknown(strings.Join(desc.Command, " "))},
+		{"Worklet version", orUnknown(desc.WorkletVersion)},
+		{"Git commit", orUnknown(desc.GitCommit)},
+		{"Config sha256", orUnknown(desc.ConfigHash)},
+		{"Compose sha256", orUnknown(desc.ComposeHash)},
+		{"Env", strings.Join(desc.EnvNames, " ")},
+	}
+
+	var mounts []string
+	for _, mount := range desc.Mounts {
+		m := fmt.Sprintf("%s:%s (%s", mount.Source, mount.Destination, mount.Type)
+		if mount.ReadOnly {
+			m += ", ro"
+		}
+		mounts = append(mounts, m+")")
+	}
+	fields = append(fields, [2]string{"Mounts", strings.Join(mounts, "\n")})
+
+	return fields
+}
+
+// printDescription writes a description as aligned "Field: value" lines
+func printDescription(out io.Writer, desc *docker.Description) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, field := range descriptionFields(desc) {
+		lines := strings.Split(field[1], "\n")
+		fmt.Fprintf(w, "%s:\t%s\n", field[0], lines[0])
+		for _, line := range lines[1:] {
+			fmt.Fprintf(w, "\t%s\n", line)
+		}
+	}
+	w.Flush()
+}
+
+// fieldDiff is a field whose value differs between two sessions
+type fieldDiff struct {
+	Field string `json:"field"`
+	A     string `json:"a"`
+	B     string `json:"b"`
+}
+
+// diffDescriptions returns the fields that differ between two descriptions,
+// ignoring the ones that always differ between sessions
+func diffDescriptions(a, b *docker.Description) []fieldDiff {
+	ignored := map[string]bool{"Session": true, "Container": true, "Status": true, "Created": true}
+
+	fieldsA, fieldsB := descriptionFields(a), descriptionFields(b)
+	var diffs []fieldDiff
+	for i := range fieldsA {
+		name := fieldsA[i][0]
+		if ignored[name] || fieldsA[i][1] == fieldsB[i][1] {
+			continue
+		}
+		diffs = append(diffs, fieldDiff{Field: name, A: fieldsA[i][1], B: fieldsB[i][1]})
+	}
+	return diffs
+}
+
+// printDescriptionDiff writes the differing fields of two sessions
+func printDescriptionDiff(out io.Writer, a, b string, diffs []fieldDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintf(out, "Sessions %s and %s have the same environment\n", a, b)
+		return
+	}
+	for i, diff := range diffs {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s:\n", diff.Field)
+		fmt.Fprintf(out, "  %s: %s\n", a, strings.ReplaceAll(diff.A, "\n", "\n    "))
+		fmt.Fprintf(out, "  %s: %s\n", b, strings.ReplaceAll(diff.B, "\n", "\n    "))
+	}
+}
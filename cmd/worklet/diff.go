@@ -0,0 +1,58 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var diffJSON bool
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <session-id>",
+	Short: "List the files a session changed in its workspace",
+	Long: `List the files a session has added (A), modified (M) or deleted (D) in its
+workspace, compared with the project directory it was started from.
+
+Only sessions with a copy-on-write workspace (run.copyStrategy "overlay")
+can be diffed, since their changes are kept apart from the project. The
+session must be running.
+
+Examples:
+  worklet diff abc123          # Changed files of abc123
+  worklet diff abc123 --json   # As JSON`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+		defer cancel()
+
+		changes, err := docker.WorkspaceDiff(ctx, args[0])
+		if err != nil {
+			return err
+		}
+
+		if diffJSON {
+			if changes == nil {
+				changes = []docker.WorkspaceChange{}
+			}
+			return writeJSON(os.Stdout, changes)
+		}
+
+		if len(changes) == 0 {
+			fmt.Println("No changes")
+			return nil
+		}
+		for _, change := range changes {
+			fmt.Printf("%s %s\n", change.Status, change.Path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffJSON, "json", false, "Output as JSON")
+}
@@ -0,0 +1,94 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var doctorGPU bool
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that this machine can run worklet sessions",
+	Long: `Check that Docker is reachable and the worklet daemon is running, and, for
+projects that pass GPUs into their sessions with run.gpus, that Docker can:
+the NVIDIA driver and the NVIDIA Container Toolkit must be installed.
+
+On macOS, it also warns when Docker Desktop shares files with gRPC FUSE or
+osxfs rather than VirtioFS, which makes mount mode much slower.
+
+It exits with status 1 if a check fails.
+
+Examples:
+  worklet doctor          # Check for the project in the current directory
+  worklet doctor --gpu    # Check GPU support even if the project doesn't use it`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().BoolVar(&doctorGPU, "gpu", false, "Check GPU support")
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+	defer cancel()
+
+	failed := false
+	check := func(name string, problems []string) {
+		if len(problems) == 0 {
+			fmt.Printf("✓ %s\n", name)
+			return
+		}
+		failed = true
+		fmt.Printf("✗ %s\n", name)
+		for _, problem := range problems {
+			fmt.Printf("    %s\n", problem)
+		}
+	}
+
+	var dockerProblems []string
+	if output, err := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}").CombinedOutput(); err != nil {
+		problem := strings.TrimSpace(string(output))
+		if problem == "" {
+			problem = err.Error()
+		}
+		dockerProblems = append(dockerProblems, problem)
+	}
+	check("Docker is reachable", dockerProblems)
+
+	var daemonProblems []string
+	if !daemon.IsDaemonRunning(daemon.GetDefaultSocketPath()) {
+		daemonProblems = append(daemonProblems, "not running; start it with 'worklet daemon start'")
+	}
+	check("Worklet daemon is running", daemonProblems)
+
+	// Slow file sharing is worth fixing, but sessions still run
+	if problems := docker.FileSharingProblems(); len(problems) > 0 {
+		fmt.Println("! File sharing is fast")
+		for _, problem := range problems {
+			fmt.Printf("    %s\n", problem)
+		}
+	}
+
+	gpu := doctorGPU
+	if cfg, err := config.LoadConfig("."); err == nil && len(cfg.Run.GPUs) > 0 {
+		gpu = true
+	}
+	if gpu {
+		check("GPUs can be passed into sessions", docker.GPUSupportProblems(ctx))
+	}
+
+	if failed {
+		return silentExit(cmd, 1)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package worklet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+)
+
+// printRunPlan prints what `worklet run` would do for dir without starting
+// anything
+func printRunPlan(dir string, cfg *config.WorkletConfig, sessionID string, cmdArgs []string) error {
+	composePath := getComposePath(dir, cfg)
+
+	plan, err := docker.PlanContainer(docker.RunOptions{
+		WorkDir:     dir,
+		Config:      cfg,
+		SessionID:   sessionID,
+		MountMode:   mountMode,
+		ExtraMounts: extraMounts,
+		ComposePath: composePath,
+		CmdArgs:     cmdArgs,
+		Ephemeral:   runEphemeral,
+		Interactive: runInteractive,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to plan container: %w", err)
+	}
+
+	fmt.Println("Dry run: nothing will be created or started")
+	fmt.Println()
+
+	// Where the config came from
+	if path, err := config.FindConfigFile(dir); err == nil {
+		fmt.Printf("Config:       %s\n", path)
+	} else {
+		projectType, _ := config.DetectProjectType(dir)
+		fmt.Printf("Config:       detected (project type: %s)\n", projectType)
+	}
+	fmt.Printf("Directory:    %s -> %s\n", dir, cfg.ContainerWorkDir())
+	fmt.Printf("Session ID:   %s (a new ID is assigned at launch)\n", sessionID)
+	fmt.Printf("Container:    %s\n", plan.ContainerName)
+	if plan.BaseImage != "" {
+		fmt.Printf("Image:        %s (workspace copied onto %s)\n", plan.Image, plan.BaseImage)
+	} else if plan.Overlay {
+		fmt.Printf("Image:        %s (workspace mounted copy-on-write)\n", plan.Image)
+	} else {
+		fmt.Printf("Image:        %s (workspace mounted)\n", plan.Image)
+	}
+	fmt.Printf("Isolation:    %s\n", plan.Isolation)
+	if plan.Internal {
+		fmt.Printf("Network:      %s (internal: the policy blocks egress)\n", plan.Network)
+	} else {
+		fmt.Printf("Network:      %s\n", plan.Network)
+	}
+	if composePath != "" {
+		fmt.Printf("Compose:      %s\n", composePath)
+	}
+	if len(plan.PolicyViolations) > 0 {
+		fmt.Printf("Policy:       ✗ blocked by %s\n", config.PolicyPath)
+		for _, violation := range plan.PolicyViolations {
+			fmt.Printf("                - %s\n", violation)
+		}
+	}
+
+	// Break the args down into the parts people usually want to check
+	var labels, envs, volumes []string
+	for i := 0; i < len(plan.Args)-1; i++ {
+		switch plan.Args[i] {
+		case "--label":
+			labels = append(labels, plan.Args[i+1])
+		case "-e":
+			envs = append(envs, plan.Args[i+1])
+		case "-v":
+			volumes = append(volumes, plan.Args[i+1])
+		default:
+			continue
+		}
+		i++
+	}
+
+	printPlanList("Labels", labels)
+	printPlanList("Environment", envs)
+	printPlanList("Mounts", volumes)
+	printPlanList("Volumes created if missing", plan.Volumes)
+
+	// Expected URLs
+	projectName := cfg.Name
+	if projectName == "" {
+		projectName = "worklet"
+	}
+	var urls []string
+	for _, svc := range cfg.Services {
+		if svc.IsStream() {
+			urls = append(urls, fmt.Sprintf("%s: %s on a localhost port assigned at start (port %d)", svc.Name, svc.Protocol, svc.Port))
+			continue
+		}
+		subdomain := svc.Subdomain
+		if subdomain == "" {
+			subdomain = svc.Name
+		}
+		url := config.ServiceURL(subdomain, projectName, sessionID)
+		urls = append(urls, fmt.Sprintf("%s: %s (port %d)", svc.Name, url, svc.Port))
+	}
+	printPlanList("URLs", urls)
+
+	fmt.Println("\nResolved config:")
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("  ", "  ")
+	if err := encoder.Encode(redactedConfig(cfg)); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	fmt.Printf("  %s", buf.String())
+
+	fmt.Println("\nDocker command:")
+	fmt.Printf("  docker %s\n", strings.Join(plan.Args, " "))
+
+	return nil
+}
+
+func printPlanList(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("\n%s:\n", title)
+	for _, item := range items {
+		fmt.Printf("  - %s\n", item)
+	}
+}
+
+// redactedConfig returns a copy of cfg with secret-looking environment
+// values hidden
+func redactedConfig(cfg *config.WorkletConfig) *config.WorkletConfig {
+	copied := *cfg
+	copied.Run.Environment = make(map[string]string, len(cfg.Run.Environment))
+	for key, value := range cfg.Run.Environment {
+		if docker.IsSecretEnvKey(key) {
+			value = "<redacted>"
+		}
+		copied.Run.Environment[key] = value
+	}
+	return &copied
+}
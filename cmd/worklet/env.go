@@ -0,0 +1,157 @@
+package worklet
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	envCheckSessionID string
+	envCheckShow      bool
+	envCheckMount     bool
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Inspect the environment sessions get",
+}
+
+var envTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Debug .env.example templates",
+}
+
+var envTemplateCheckCmd = &cobra.Command{
+	Use:   "check [dir]",
+	Short: "Show what a session's env templates would generate",
+	Long: `Runs the env templating a session start runs on the .env.example,
+.env.sample and .env.template files of a project, without writing anything.
+For each file it shows the env file it generates, whether an existing one is
+merged, each placeholder and what it resolved to, and the keys left empty.
+
+By default files are generated as for a copy-mode session, whose copy of the
+project gets them. --mount shows what mount mode writes into the project
+directory instead, where only the keys filled in from placeholders are
+rewritten in existing files.
+
+URLs use --session-id, or a random session ID. check exits with status 1 if
+any placeholder can't be resolved, such as one naming a service that isn't
+in .worklet.jsonc.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve directory: %w", err)
+		}
+
+		cfg, err := config.LoadConfigOrDetect(absDir, false)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		projectName := cfg.Name
+		if projectName == "" {
+			projectName = "worklet"
+		}
+		sessionID := envCheckSessionID
+		if sessionID == "" {
+			sessionID = randomSessionID()
+		}
+
+		if envCheckMount && !cfg.Run.WritesHostEnvFiles() {
+			fmt.Println("Note: run.writeEnvFiles is off, so mount mode doesn't write these files")
+			fmt.Println()
+		}
+
+		plans, err := config.PlanEnvFiles(absDir, absDir, sessionID, projectName, cfg.Services, config.EnvPlanOptions{Protect: envCheckMount, Addons: cfg.AddonInfos(projectName, sessionID)})
+		if err != nil {
+			return fmt.Errorf("failed to process env templates: %w", err)
+		}
+		if len(plans) == 0 {
+			fmt.Println("No .env.example, .env.sample or .env.template files found")
+			return nil
+		}
+		if len(cfg.Services) == 0 && len(cfg.Addons) == 0 {
+			fmt.Println("Note: no services or add-ons are defined, so sessions don't process env templates")
+			fmt.Println()
+		}
+
+		unresolved := 0
+		for i, plan := range plans {
+			if i > 0 {
+				fmt.Println()
+			}
+			action := "generated"
+			if plan.Merged {
+				action = "merged into the existing file"
+			}
+			fmt.Printf("%s → %s (%s)\n", plan.Template, plan.Target, action)
+
+			for _, placeholder := range plan.Placeholders {
+				if placeholder.Resolved {
+					value := placeholder.Value
+					if value == "" {
+						value = `""`
+					}
+					fmt.Printf("  ✓ %s → %s\n", placeholder.Text, value)
+				} else {
+					fmt.Printf("  ✗ %s is left as written\n", placeholder.Text)
+					unresolved++
+				}
+			}
+			if len(plan.Placeholders) == 0 {
+				fmt.Println("  No placeholders")
+			}
+			if len(plan.Empty) > 0 {
+				fmt.Printf("  Empty: %s\n", strings.Join(plan.Empty, ", "))
+			}
+			if plan.Merged && envCheckMount {
+				owned := "none"
+				if len(plan.Owned) > 0 {
+					owned = strings.Join(plan.Owned, ", ")
+				}
+				fmt.Printf("  Rewritten keys: %s\n", owned)
+			}
+			if plan.Backup != "" {
+				fmt.Printf("  Backup: %s\n", plan.Backup)
+			}
+
+			if envCheckShow {
+				fmt.Println()
+				for _, line := range strings.Split(strings.TrimRight(plan.Content, "\n"), "\n") {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+		}
+
+		if unresolved > 0 {
+			var services []string
+			for _, svc := range cfg.Services {
+				services = append(services, svc.Name)
+			}
+			fmt.Printf("\n%d placeholder(s) can't be resolved. Supported: {{services.<name>.url|host|port}}, {{session.id}}, {{project.name}}", unresolved)
+			if len(services) > 0 {
+				fmt.Printf("; services: %s", strings.Join(services, ", "))
+			}
+			fmt.Println()
+			return silentExit(cmd, 1)
+		}
+		return nil
+	},
+}
+
+func init() {
+	envTemplateCheckCmd.Flags().StringVar(&envCheckSessionID, "session-id", "", "Session ID to generate URLs for (default: a random one)")
+	envTemplateCheckCmd.Flags().BoolVar(&envCheckShow, "show", false, "Also print each generated file")
+	envTemplateCheckCmd.Flags().BoolVar(&envCheckMount, "mount", false, "Show what mount mode writes into the project directory")
+
+	envTemplateCmd.AddCommand(envTemplateCheckCmd)
+	envCmd.AddCommand(envTemplateCmd)
+}
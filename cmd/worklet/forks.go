@@ -4,14 +4,36 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/worktrees"
 	"github.com/nolanleung/worklet/pkg/daemon"
 	"github.com/spf13/cobra"
 )
 
 var (
 	forksDebug bool
+
+	forksPruneMaxCount  int
+	forksPruneMaxSizeMB int64
+	forksPruneMaxAge    time.Duration
+	forksPruneDryRun    bool
+	forksPruneForce     bool
+
+	forksRmForce bool
+
+	forksSyncFrom   string
+	forksSyncRebase bool
+	forksSyncNoPull bool
 )
 
 var forksCmd = &cobra.Command{
@@ -21,8 +43,322 @@ var forksCmd = &cobra.Command{
 	RunE:  runForks,
 }
 
+var forksPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove stale branch worktrees",
+	Long: `Remove branch worktrees created by 'worklet run --worktree' according to
+the retention policy: worktrees unused for longer than the maximum age go
+first, then the least recently used until the count and total size fit.
+
+Limits default to the "forks" section of ~/.worklet/config.jsonc:
+
+  "forks": {"maxCount": 10, "maxSizeMB": 20480, "maxAgeDays": 30}
+
+Pinned worktrees are never removed, and worktrees with uncommitted changes
+or a running session are kept unless --force is given.`,
+	RunE: runForksPrune,
+}
+
+var forksPinCmd = &cobra.Command{
+	Use:   "pin <worktree-path>",
+	Short: "Protect a branch worktree from pruning",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setWorktreePinned(args[0], true)
+	},
+}
+
+var forksUnpinCmd = &cobra.Command{
+	Use:   "unpin <worktree-path>",
+	Short: "Allow a pinned branch worktree to be pruned again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setWorktreePinned(args[0], false)
+	},
+}
+
+var forksRmCmd = &cobra.Command{
+	Use:   "rm <worktree-path>...",
+	Short: "Remove branch worktrees",
+	Long: `Remove branch worktrees created by 'worklet run --worktree'. Worktrees with
+uncommitted changes are only removed after confirmation, or with --force.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runForksRm,
+}
+
+var forksSyncCmd = &cobra.Command{
+	Use:   "sync [worktree-path|branch]",
+	Short: "Bring a branch worktree up to date with its source",
+	Long: `Update a branch worktree with the latest state of the repository it was
+created from. The source checkout is pulled first (fast-forward only), then
+its branch is merged into the worktree's branch, or rebased onto with
+--rebase. Uncommitted changes in the worktree are stashed and reapplied.
+
+The argument is a worktree directory or the branch of a worktree created
+with 'worklet run --worktree'; without one the current directory is used.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runForksSync,
+}
+
 func init() {
 	forksCmd.Flags().BoolVar(&forksDebug, "debug", false, "Enable debug logging")
+
+	forksPruneCmd.Flags().IntVar(&forksPruneMaxCount, "max-count", 0, "Keep at most this many worktrees (default from config)")
+	forksPruneCmd.Flags().Int64Var(&forksPruneMaxSizeMB, "max-size-mb", 0, "Keep the total size under this many MB (default from config)")
+	forksPruneCmd.Flags().DurationVar(&forksPruneMaxAge, "max-age", 0, "Remove worktrees unused for longer than this (default from config)")
+	forksPruneCmd.Flags().BoolVar(&forksPruneDryRun, "dry-run", false, "Show what would be removed without removing it")
+	forksPruneCmd.Flags().BoolVar(&forksPruneForce, "force", false, "Also remove worktrees with uncommitted changes or a running session")
+
+	forksRmCmd.Flags().BoolVarP(&forksRmForce, "force", "f", false, "Remove without asking, even with uncommitted changes")
+
+	forksCmd.AddCommand(forksPruneCmd)
+	forksSyncCmd.Flags().StringVar(&forksSyncFrom, "from", "", "Branch to sync from (default: the branch checked out in the source repository)")
+	forksSyncCmd.Flags().BoolVar(&forksSyncRebase, "rebase", false, "Rebase onto the source branch instead of merging it")
+	forksSyncCmd.Flags().BoolVar(&forksSyncNoPull, "no-pull", false, "Don't pull in the source repository first")
+
+	forksCmd.AddCommand(forksRmCmd)
+	forksCmd.AddCommand(forksSyncCmd)
+	forksCmd.AddCommand(forksPinCmd)
+	forksCmd.AddCommand(forksUnpinCmd)
+}
+
+func runForksPrune(cmd *cobra.Command, args []string) error {
+	store, err := worktrees.New()
+	if err != nil {
+		return err
+	}
+
+	retention := loadGlobalConfig().Forks
+	policy := worktrees.Policy{
+		MaxCount: retention.MaxCount,
+		MaxSize:  retention.MaxSizeMB << 20,
+		MaxAge:   time.Duration(retention.MaxAgeDays) * 24 * time.Hour,
+	}
+	if cmd.Flags().Changed("max-count") {
+		policy.MaxCount = forksPruneMaxCount
+	}
+	if cmd.Flags().Changed("max-size-mb") {
+		policy.MaxSize = forksPruneMaxSizeMB << 20
+	}
+	if cmd.Flags().Changed("max-age") {
+		policy.MaxAge = forksPruneMaxAge
+	}
+	if policy == (worktrees.Policy{}) {
+		return fmt.Errorf("no retention limits set; configure \"forks\" in ~/.worklet/config.jsonc or pass --max-count, --max-size-mb or --max-age")
+	}
+
+	list, err := store.List()
+	if err != nil {
+		return fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	var running []string
+	if !forksPruneForce {
+		sessions, err := docker.ListSessions(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to list running sessions: %w", err)
+		}
+		for _, session := range sessions {
+			running = append(running, session.WorkDir)
+		}
+	}
+
+	// Worktrees that have to be kept still count towards the limits, so
+	// older ones are selected in their place
+	keep := func(worktree worktrees.Worktree) bool {
+		if forksPruneForce {
+			return false
+		}
+		if usedBySession(worktree.Path, running) {
+			fmt.Printf("Keeping %s (a session is running in it, use --force to remove)\n", worktree.Path)
+			return true
+		}
+		if changed, err := worktrees.HasChanges(worktree.Path); err != nil || changed {
+			fmt.Printf("Keeping %s (uncommitted changes, use --force to remove)\n", worktree.Path)
+			return true
+		}
+		return false
+	}
+
+	var freed int64
+	removed := 0
+	for _, worktree := range worktrees.Select(list, policy, time.Now(), keep) {
+
+		if forksPruneDryRun {
+			fmt.Printf("Would remove %s (%s, last used %s)\n", worktree.Path, formatSize(worktree.Size), formatTime(worktree.LastUsed))
+		} else {
+			if err := store.Remove(worktree); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s\n", worktree.Path)
+		}
+		freed += worktree.Size
+		removed++
+	}
+
+	if removed == 0 {
+		fmt.Println("Nothing to prune.")
+		return nil
+	}
+	if forksPruneDryRun {
+		fmt.Printf("Would free %s\n", formatSize(freed))
+	} else {
+		fmt.Printf("Freed %s\n", formatSize(freed))
+	}
+	return nil
+}
+
+// usedBySession reports whether any of the session work directories is path
+// or inside it
+func usedBySession(path string, workDirs []string) bool {
+	for _, dir := range workDirs {
+		if dir == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(path, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func runForksRm(cmd *cobra.Command, args []string) error {
+	store, err := worktrees.New()
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		path, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		if err := worktrees.CheckLinked(path); err != nil {
+			return err
+		}
+
+		if !forksRmForce {
+			changed, err := worktrees.HasChanges(path)
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				changed = true
+			}
+			if changed {
+				ok, err := confirm(fmt.Sprintf("%s may have uncommitted changes. Remove anyway?", path))
+				if err != nil {
+					return err
+				}
+				if !ok {
+					fmt.Printf("Kept %s\n", path)
+					continue
+				}
+			}
+		}
+
+		if err := store.Remove(worktrees.Worktree{Path: path}); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %s\n", path)
+	}
+
+	return nil
+}
+
+func runForksSync(cmd *cobra.Command, args []string) error {
+	dir, err := resolveWorktreeDir(args)
+	if err != nil {
+		return err
+	}
+
+	branch, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("not a git repository: %s", dir)
+	}
+
+	sourceDir, err := mainWorktree(dir)
+	if err != nil {
+		return err
+	}
+
+	source := forksSyncFrom
+	if source == "" {
+		if source, err = gitOutput(sourceDir, "rev-parse", "--abbrev-ref", "HEAD"); err != nil {
+			return err
+		}
+		if source == "HEAD" {
+			return fmt.Errorf("%s has a detached HEAD; pass --from <branch>", sourceDir)
+		}
+	}
+	if source == branch {
+		return fmt.Errorf("%s is already on %s", dir, branch)
+	}
+
+	// Pulling only makes sense for the branch checked out in the source
+	if !forksSyncNoPull && forksSyncFrom == "" {
+		if _, err := gitOutput(sourceDir, "rev-parse", "--abbrev-ref", "@{upstream}"); err == nil {
+			fmt.Printf("Pulling %s in %s...\n", source, sourceDir)
+			pull := exec.Command("git", "pull", "--ff-only")
+			pull.Dir = sourceDir
+			pull.Stdout = os.Stdout
+			pull.Stderr = os.Stderr
+			if err := pull.Run(); err != nil {
+				fmt.Printf("Warning: failed to pull %s, syncing from the local branch: %v\n", source, err)
+			}
+		}
+	}
+
+	args = []string{"merge", "--autostash", "--no-edit", source}
+	action := "Merging"
+	if forksSyncRebase {
+		args = []string{"rebase", "--autostash", source}
+		action = "Rebasing onto"
+	}
+	fmt.Printf("%s %s in %s...\n", action, source, dir)
+
+	sync := exec.Command("git", args...)
+	sync.Dir = dir
+	sync.Stdout = os.Stdout
+	sync.Stderr = os.Stderr
+	if err := sync.Run(); err != nil {
+		return fmt.Errorf("failed to sync %s with %s; resolve the conflicts in %s and commit, or run 'git %s --abort'", branch, source, dir, args[0])
+	}
+
+	fmt.Printf("%s is up to date with %s\n", branch, source)
+	return nil
+}
+
+// mainWorktree returns the directory of the main working tree of the
+// repository containing dir, which is the source of its linked worktrees
+func mainWorktree(dir string) (string, error) {
+	output, err := gitOutput(dir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	// The main worktree is always listed first
+	line, _, _ := strings.Cut(output, "\n")
+	path, ok := strings.CutPrefix(line, "worktree ")
+	if !ok {
+		return "", fmt.Errorf("failed to find the source repository of %s", dir)
+	}
+	return path, nil
+}
+
+// setWorktreePinned pins or unpins the managed worktree at path
+func setWorktreePinned(path string, pinned bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if err := worktrees.SetPinned(absPath, pinned); err != nil {
+		return err
+	}
+
+	if pinned {
+		fmt.Printf("Pinned %s\n", absPath)
+	} else {
+		fmt.Printf("Unpinned %s\n", absPath)
+	}
+	return nil
 }
 
 func runForks(cmd *cobra.Command, args []string) error {
@@ -84,6 +420,8 @@ func runForks(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
+	sortByActivity(forks)
+
 	// Display forks with their DNS names
 	for i, fork := range forks {
 		if i > 0 {
@@ -97,24 +435,67 @@ func runForks(cmd *cobra.Command, args []string) error {
 		if fork.ContainerID != "" {
 			fmt.Printf("Container: %s\n", fork.ContainerID[:12])
 		}
-		fmt.Printf("Status: running\n")
+		if fork.Restarting {
+			fmt.Printf("Status: restarting (exited with code %d)\n", fork.LastExitCode)
+		} else {
+			fmt.Printf("Status: running\n")
+		}
+		if fork.RestartCount > 0 {
+			fmt.Printf("Restarts: %d (last exit code %d)\n", fork.RestartCount, fork.LastExitCode)
+		}
+		if !fork.LastActivityAt.IsZero() {
+			fmt.Printf("Last active: %s\n", formatTime(fork.LastActivityAt))
+		}
+		if note := fork.Metadata[daemon.NoteMetadataKey]; note != "" {
+			fmt.Printf("Note: %s\n", note)
+		}
+		for _, name := range slices.Sorted(maps.Keys(fork.Chaos)) {
+			fmt.Printf("Chaos: %s (%s)\n", name, fork.Chaos[name])
+		}
+		if len(fork.Taps) > 0 {
+			fmt.Printf("Recording: %s (worklet tap export %s)\n", strings.Join(fork.Taps, ", "), fork.ForkID)
+		}
 
 		if len(fork.Services) == 0 {
 			fmt.Println("Services: none")
 		} else {
 			fmt.Println("Services:")
 			for _, svc := range fork.Services {
-				// Generate URL for the service
-				subdomain := svc.Subdomain
-				if subdomain == "" {
-					subdomain = svc.Name
+				if svc.IsStream() {
+					fmt.Printf("  - %-15s → %s (port %d)\n", svc.Name, streamAddress(svc.Protocol, svc.HostPort), svc.Port)
+					continue
 				}
-				url := fmt.Sprintf("http://%s.%s-%s.local.worklet.sh", 
-					subdomain, fork.ProjectName, fork.ForkID)
-				fmt.Printf("  - %-15s → %s (port %d)\n", svc.Name, url, svc.Port)
+
+				url := forkServiceURL(fork, svc)
+				fmt.Printf("  - %-15s → %s (port %d)\n", svc.Name, formatURL(os.Stdout, url, forkHealth(fork)), svc.Port)
 			}
 		}
 	}
 
 	return nil
 }
+
+// sortByActivity sorts forks most recently used first
+func sortByActivity(forks []daemon.ForkInfo) {
+	sort.SliceStable(forks, func(i, j int) bool {
+		return forks[i].LastActivityAt.After(forks[j].LastActivityAt)
+	})
+}
+
+// forkServiceURL returns the URL of an HTTP service of a fork
+func forkServiceURL(fork daemon.ForkInfo, svc daemon.ServiceInfo) string {
+	subdomain := svc.Subdomain
+	if subdomain == "" {
+		subdomain = svc.Name
+	}
+	return config.ServiceURL(subdomain, fork.ProjectName, fork.ForkID)
+}
+
+// streamAddress returns the localhost address a TCP or UDP service is
+// proxied on
+func streamAddress(protocol string, hostPort int) string {
+	if hostPort == 0 {
+		return "(no proxy port available)"
+	}
+	return fmt.Sprintf("%s://localhost:%d", protocol, hostPort)
+}
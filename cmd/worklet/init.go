@@ -18,13 +18,17 @@ var (
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize a new .worklet.jsonc configuration file",
-	Long:  `Creates a .worklet.jsonc configuration file in the current directory with sensible defaults.`,
+	Long:  `Creates a .worklet.jsonc configuration file in the current directory with sensible defaults, replacing an existing config in any format after confirmation.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		configPath := ".worklet.jsonc"
 
-		// Check if config already exists
-		if _, err := os.Stat(configPath); err == nil && !initForce {
-			fmt.Print(".worklet.jsonc already exists. Overwrite? [y/N] ")
+		// Check if config already exists, in any format
+		existing, err := config.FindConfigFile(".")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if existing != "" && !initForce {
+			fmt.Printf("%s already exists. Overwrite? [y/N] ", filepath.Base(existing))
 			reader := bufio.NewReader(os.Stdin)
 			response, err := reader.ReadString('\n')
 			if err != nil {
@@ -42,13 +46,22 @@ var initCmd = &cobra.Command{
 		projectName := getProjectName()
 
 		// Generate config
-		config := generateConfig(projectName)
+		content := generateConfig(projectName)
 
 		// Write config file
-		if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
 			return fmt.Errorf("failed to write config file: %w", err)
 		}
 
+		// A config in another format is replaced, as only one may exist
+		if existing != "" && filepath.Base(existing) != configPath {
+			if err := os.Remove(existing); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", existing, err)
+			}
+			fmt.Printf("✓ Replaced %s with .worklet.jsonc\n", filepath.Base(existing))
+			return nil
+		}
+
 		fmt.Printf("✓ Created .worklet.jsonc\n")
 		return nil
 	},
@@ -62,7 +75,9 @@ func getProjectName() string {
 	// Try to get from current directory name
 	cwd, err := os.Getwd()
 	if err == nil {
-		return filepath.Base(cwd)
+		if name := config.SanitizeName(filepath.Base(cwd)); name != "" {
+			return name
+		}
 	}
 	return "my-project"
 }
@@ -95,6 +110,7 @@ func generateConfig(projectName string) string {
 func generateDefaultConfig(projectName string) string {
 	return fmt.Sprintf(`{
   // Worklet configuration file
+  "version": %d,
   "name": "%s",
   "run": {
     // Command to run in the container
@@ -113,7 +129,7 @@ func generateDefaultConfig(projectName string) string {
     // Example: ["/host/path:/container/path", "volume-name:/data"]
     "volumes": [],
   }
-}`, projectName)
+}`, config.CurrentVersion, projectName)
 }
 
 func formatConfigAsJSONC(cfg *config.WorkletConfig) string {
@@ -157,6 +173,7 @@ func formatConfigAsJSONC(cfg *config.WorkletConfig) string {
 	// Format the final JSONC
 	result := fmt.Sprintf(`{
   // Worklet configuration file
+  "version": %d,
   "name": "%s",
   "run": {
     // Container image
@@ -174,6 +191,7 @@ func formatConfigAsJSONC(cfg *config.WorkletConfig) string {
     // Additional volume mounts
     // Example: ["/host/path:/container/path", "volume-name:/data"]
     "volumes": %s`,
+		config.CurrentVersion,
 		escapeQuotes(cfg.Name),
 		escapeQuotes(cfg.Run.Image),
 		commandStr,
@@ -0,0 +1,353 @@
+package worklet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/fuzzy"
+	"github.com/nolanleung/worklet/internal/projects"
+	"github.com/nolanleung/worklet/internal/worktrees"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jumpPrint bool
+	jumpShell string
+	jumpLogin bool
+)
+
+// jumpDaemonTimeout bounds the wait for the session list, so a busy or
+// stuck daemon doesn't slow the switcher down
+const jumpDaemonTimeout = 500 * time.Millisecond
+
+// maxJumpMatches is how many matches the prompt shows
+const maxJumpMatches = 10
+
+var jumpCmd = &cobra.Command{
+	Use:   "jump [query]",
+	Short: "Quickly switch to a session, project or fork",
+	Long: `Fuzzy-match running session IDs, project names and branch worktrees
+(forks), and open the best match:
+
+  session   attach a shell to its container
+  project   attach to its running session, or open a shell in its directory
+  fork      the same, for the worktree
+
+With a query the best match is opened straight away. Without one, a prompt
+narrows the matches as you type; use the arrow keys and Enter to choose.
+Use --print to write the match's path (or session ID) instead, e.g. for
+cd "$(worklet jump -p shop)".
+
+Examples:
+  worklet jump          # Pick interactively
+  worklet jump shop     # Open the shop project or its session
+  worklet jump 3        # Attach to session 3
+  worklet jump 3 --shell zsh --login  # With a zsh login shell`,
+	RunE: runJump,
+}
+
+func init() {
+	jumpCmd.Flags().BoolVarP(&jumpPrint, "print", "p", false, "Print the match's path or session ID instead of opening it")
+	jumpCmd.Flags().StringVar(&jumpShell, "shell", "", "Shell to start in a session, e.g. zsh (default: run.shell or detected)")
+	jumpCmd.Flags().BoolVarP(&jumpLogin, "login", "l", false, "Start a login shell in a session, reading /etc/profile and ~/.profile")
+}
+
+// jumpTarget is something the switcher can open
+type jumpTarget struct {
+	kind    string   // "session", "project" or "fork"
+	label   string   // Shown in the prompt
+	detail  string   // URL or path shown next to the label
+	keys    []string // Matched against the query
+	path    string   // Directory of a project or fork
+	session *daemon.ForkInfo
+}
+
+// jumpMatch is a target that matches the query
+type jumpMatch struct {
+	target *jumpTarget
+	score  int
+}
+
+func runJump(cmd *cobra.Command, args []string) error {
+	targets := jumpTargets()
+	if len(targets) == 0 {
+		return fmt.Errorf("no sessions, projects or forks to jump to")
+	}
+
+	var target *jumpTarget
+	if len(args) > 0 {
+		query := strings.Join(args, " ")
+		matches := rankJumpTargets(targets, query)
+		if len(matches) == 0 {
+			return fmt.Errorf("nothing matches %q", query)
+		}
+		target = matches[0].target
+	} else {
+		if !isInteractiveTerminal() {
+			return fmt.Errorf("a query is required when not running in a terminal")
+		}
+
+		input := textinput.New()
+		input.Prompt = "jump> "
+		input.Placeholder = "session, project or fork"
+		input.Focus()
+		m := jumpModel{targets: targets, input: input}
+		m.matches = rankJumpTargets(targets, "")
+
+		final, err := tea.NewProgram(m).Run()
+		if err != nil {
+			return err
+		}
+		target = final.(jumpModel).chosen
+		if target == nil {
+			return nil
+		}
+	}
+
+	return openJumpTarget(cmd.Context(), target, targets)
+}
+
+// jumpTargets collects running sessions from the daemon, and projects and
+// forks from disk. It doesn't call Docker, so the prompt comes up quickly.
+func jumpTargets() []*jumpTarget {
+	var targets []*jumpTarget
+
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), jumpDaemonTimeout)
+		forks, err := client.ListForks(ctx)
+		cancel()
+		client.Close()
+		if err == nil {
+			for i := range forks {
+				fork := &forks[i]
+				detail := fork.WorkDir
+				if len(fork.Services) > 0 {
+					subdomain := fork.Services[0].Subdomain
+					if subdomain == "" {
+						subdomain = fork.Services[0].Name
+					}
+					detail = config.ServiceURL(subdomain, fork.ProjectName, fork.ForkID)
+				}
+				targets = append(targets, &jumpTarget{
+					kind:    "session",
+					label:   fmt.Sprintf("%s %s", fork.ForkID, fork.ProjectName),
+					detail:  detail,
+					keys:    []string{fork.ForkID, fork.ProjectName + "-" + fork.ForkID},
+					path:    fork.WorkDir,
+					session: fork,
+				})
+			}
+		}
+	}
+
+	if manager, err := projects.NewManager(); err == nil {
+		for _, p := range manager.List() {
+			targets = append(targets, &jumpTarget{
+				kind:   "project",
+				label:  p.DisplayName(),
+				detail: p.Path,
+				keys:   []string{p.DisplayName(), p.Path},
+				path:   p.Path,
+			})
+		}
+	}
+
+	if store, err := worktrees.New(); err == nil {
+		if list, err := store.Names(); err == nil {
+			for _, worktree := range list {
+				name := worktree.Repo + "/" + worktree.Branch
+				targets = append(targets, &jumpTarget{
+					kind:   "fork",
+					label:  name,
+					detail: worktree.Path,
+					keys:   []string{worktree.Branch, name},
+					path:   worktree.Path,
+				})
+			}
+		}
+	}
+
+	return targets
+}
+
+// rankJumpTargets returns the targets matching query, best first. Ties keep
+// the collection order: sessions, then projects by recent use, then forks.
+func rankJumpTargets(targets []*jumpTarget, query string) []jumpMatch {
+	var matches []jumpMatch
+	for _, target := range targets {
+		best, found := 0, false
+		for _, key := range target.keys {
+			if score, ok := fuzzy.Score(query, key); ok && (!found || score > best) {
+				best, found = score, true
+			}
+		}
+		if found {
+			matches = append(matches, jumpMatch{target: target, score: best})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+	return matches
+}
+
+// openJumpTarget attaches to or opens a shell in the chosen target
+func openJumpTarget(ctx context.Context, target *jumpTarget, targets []*jumpTarget) error {
+	if jumpPrint {
+		if target.kind == "session" {
+			fmt.Println(target.session.ForkID)
+		} else {
+			fmt.Println(target.path)
+		}
+		return nil
+	}
+
+	// A project or fork with a running session opens that session
+	session := target.session
+	if session == nil {
+		for _, other := range targets {
+			if other.session != nil && other.path == target.path {
+				session = other.session
+				break
+			}
+		}
+	}
+
+	var c *exec.Cmd
+	if session != nil {
+		containerID := session.ContainerID
+		if containerID == "" {
+			info, err := docker.GetSessionInfo(ctx, session.ForkID)
+			if err != nil {
+				return err
+			}
+			containerID = info.ContainerID
+		}
+
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = "xterm-256color"
+		}
+		fmt.Printf("Attaching to session %s (%s)\n", session.ForkID, session.ProjectName)
+		execArgs := append([]string{"exec", "-it", "-e", "TERM=" + term}, docker.ExecEnvArgs(session.ForkID)...)
+		execArgs = append(execArgs, docker.ExecUserArgs(containerID)...)
+		execArgs = append(execArgs, docker.ShellEnvArgs(jumpShell, jumpLogin)...)
+		c = exec.CommandContext(ctx, "docker", append(append(execArgs, containerID), docker.ShellCommand()...)...)
+	} else {
+		if info, err := os.Stat(target.path); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s no longer exists", target.path)
+		}
+		shell := os.Getenv("SHELL")
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		fmt.Printf("Opening a shell in %s (exit to return)\n", target.path)
+		c = exec.CommandContext(ctx, shell)
+		c.Dir = target.path
+	}
+
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		// The shell's own exit status isn't an error of jump's
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// jumpModel is the quick-switch prompt
+type jumpModel struct {
+	targets []*jumpTarget
+	matches []jumpMatch
+	input   textinput.Model
+	cursor  int
+	chosen  *jumpTarget
+}
+
+// Init implements tea.Model.
+func (m jumpModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// Update implements tea.Model.
+func (m jumpModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			return m, tea.Quit
+		case "enter":
+			if len(m.matches) > 0 {
+				m.chosen = m.matches[m.cursor].target
+			}
+			return m, tea.Quit
+		case "up", "ctrl+p":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+			return m, nil
+		case "down", "ctrl+n", "tab":
+			if m.cursor < min(len(m.matches), maxJumpMatches)-1 {
+				m.cursor++
+			}
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	previous := m.input.Value()
+	m.input, cmd = m.input.Update(msg)
+	if m.input.Value() != previous {
+		m.matches = rankJumpTargets(m.targets, m.input.Value())
+		m.cursor = 0
+	}
+	return m, cmd
+}
+
+// jumpSelectedStyle highlights the match Enter opens
+var jumpSelectedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#ffaa00")).Bold(true)
+
+// View implements tea.Model.
+func (m jumpModel) View() string {
+	if m.chosen != nil {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(m.input.View() + "\n")
+	for i, match := range m.matches {
+		if i == maxJumpMatches {
+			b.WriteString(helpStyle.Render(fmt.Sprintf("  … %d more", len(m.matches)-maxJumpMatches)) + "\n")
+			break
+		}
+		row := fmt.Sprintf("%-8s %-30s", match.target.kind, match.target.label)
+		if i == m.cursor {
+			row = jumpSelectedStyle.Render("> " + row)
+		} else {
+			row = "  " + row
+		}
+		b.WriteString(row + " " + helpStyle.Render(match.target.detail) + "\n")
+	}
+	if len(m.matches) == 0 {
+		b.WriteString(helpStyle.Render("  no matches") + "\n")
+	}
+	b.WriteString(helpStyle.Render("↑/↓ choose · enter open · esc cancel"))
+	return b.String()
+}
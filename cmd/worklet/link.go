@@ -2,12 +2,12 @@ package worklet
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 
+	"github.com/nolanleung/worklet/internal/config"
 	"github.com/spf13/cobra"
-	"github.com/tidwall/jsonc"
 )
 
 var (
@@ -39,22 +39,14 @@ func runLinkClaude(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get current directory: %w", err)
 	}
 
-	configPath := filepath.Join(cwd, ".worklet.jsonc")
-
-	// Check if config file exists
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+	// Read existing config, in whichever format it's in
+	jsonData, configPath, format, err := config.ReadConfigFile(cwd)
+	if errors.Is(err, os.ErrNotExist) {
 		return fmt.Errorf(".worklet.jsonc not found. Run 'worklet init' first")
+	} else if err != nil {
+		return err
 	}
 
-	// Read existing config
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
-	}
-
-	// Parse JSONC to JSON
-	jsonData := jsonc.ToJSON(data)
-
 	// Parse into a map to preserve structure and order
 	var configMap map[string]interface{}
 	if err := json.Unmarshal(jsonData, &configMap); err != nil {
@@ -85,14 +77,18 @@ func runLinkClaude(cmd *cobra.Command, args []string) error {
 	credentials["claude"] = true
 	runSection["credentials"] = credentials
 
-	// Marshal back to JSON with indentation
-	updatedJSON, err := json.MarshalIndent(configMap, "", "  ")
+	// Marshal back to the file's format
+	updatedJSON, err := json.Marshal(configMap)
 	if err != nil {
 		return fmt.Errorf("failed to marshal updated config: %w", err)
 	}
+	updated, err := config.FromJSON(updatedJSON, format)
+	if err != nil {
+		return err
+	}
 
 	// Write back to file
-	if err := os.WriteFile(configPath, updatedJSON, 0644); err != nil {
+	if err := os.WriteFile(configPath, updated, 0644); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
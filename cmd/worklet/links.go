@@ -0,0 +1,99 @@
+package worklet
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/nginx"
+	"github.com/nolanleung/worklet/pkg/daemon"
+)
+
+// urlHealth is how a service's URL answers, which its color shows
+type urlHealth int
+
+const (
+	urlUnknown  urlHealth = iota // Not checked
+	urlUp                        // The service answers
+	urlStarting                  // The proxy answers for a service that doesn't yet
+	urlDown                      // Nothing answers, or the service fails
+)
+
+// probeTimeout is how long a URL gets to answer a health probe
+const probeTimeout = time.Second
+
+// probeURLs checks how each URL answers, all at once. It's only worth the
+// wait when the answers are shown, so callers only probe in color.
+func probeURLs(urls []string) map[string]urlHealth {
+	client := &http.Client{
+		Timeout: probeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	health := make(map[string]urlHealth, len(urls))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			h := urlDown
+			if resp, err := client.Get(url); err == nil {
+				resp.Body.Close()
+				switch {
+				case resp.Header.Get(nginx.UnmatchedHeader) != "":
+					// The proxy doesn't route the URL's host yet
+					h = urlStarting
+				case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable ||
+					resp.StatusCode == http.StatusGatewayTimeout:
+					h = urlStarting
+				case resp.StatusCode < 500:
+					h = urlUp
+				}
+			}
+			mu.Lock()
+			health[url] = h
+			mu.Unlock()
+		}(url)
+	}
+	wg.Wait()
+	return health
+}
+
+// forkHealth is how the URLs of a registered fork are shown, going by what
+// the daemon knows of its container rather than requesting each URL: down
+// while it's waiting to be restarted, starting while it fails or has yet to
+// pass its health check
+func forkHealth(fork daemon.ForkInfo) urlHealth {
+	switch {
+	case fork.Restarting:
+		return urlDown
+	case fork.Unhealthy:
+		return urlStarting
+	}
+	return urlUp
+}
+
+// ANSI colors of URLs by health
+var urlColors = map[urlHealth]string{
+	urlUp:       "\x1b[32m",
+	urlStarting: "\x1b[33m",
+	urlDown:     "\x1b[31m",
+}
+
+// formatURL renders url for w: colored by health, and an http URL as an
+// OSC 8 hyperlink, when w is a terminal that shows them; plain otherwise
+func formatURL(w io.Writer, url string, health urlHealth) string {
+	text := url
+	if color, ok := urlColors[health]; ok && colorEnabled(w) {
+		text = color + text + "\x1b[0m"
+	}
+	if (strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) && hyperlinksEnabled(w) {
+		text = "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+	}
+	return text
+}
@@ -0,0 +1,51 @@
+package worklet
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// mountFlag backs --mount. On its own it enables mount mode, like the
+// original boolean flag; --mount=source[:target][:ro] additionally mounts
+// another host directory and can be repeated.
+type mountFlag struct {
+	enabled *bool
+	mounts  *[]config.MountConfig
+}
+
+func (f *mountFlag) String() string {
+	if f.enabled == nil || !*f.enabled {
+		return ""
+	}
+	return "true"
+}
+
+func (f *mountFlag) Set(value string) error {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		*f.enabled = enabled
+		return nil
+	}
+
+	mount, err := config.ParseMountSpec(value)
+	if err != nil {
+		return err
+	}
+	// Relative paths on the command line are relative to where worklet runs,
+	// not the project (which may be a fresh clone)
+	if !strings.HasPrefix(mount.Source, "~") {
+		if mount.Source, err = filepath.Abs(config.HostPath(mount.Source)); err != nil {
+			return err
+		}
+	}
+
+	*f.enabled = true
+	*f.mounts = append(*f.mounts, mount)
+	return nil
+}
+
+func (f *mountFlag) Type() string {
+	return "mount"
+}
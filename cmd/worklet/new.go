@@ -0,0 +1,138 @@
+package worklet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/templates"
+	"github.com/spf13/cobra"
+)
+
+var (
+	newList  bool
+	newNoRun bool
+	newIndex string
+)
+
+var newCmd = &cobra.Command{
+	Use:   "new [template] [directory]",
+	Short: "Create a project from a starter template and run it",
+	Long: `Create a project from a starter template, such as a Next.js app, a
+FastAPI service or a Go API, each with a .worklet.jsonc tuned for it, and
+run it with 'worklet run'.
+
+Templates come from a catalog downloaded from the worklet-templates
+repository; the last one downloaded is used when offline. Set
+templates.index in ~/.worklet/config.jsonc, WORKLET_TEMPLATES_INDEX or
+--index to use your own catalog, given as a URL or a file path.
+
+The project is created in directory, named after the template by default,
+which must not exist or be empty.
+
+Examples:
+  worklet new                  # List the available templates
+  worklet new nextjs           # Create ./nextjs from the nextjs template and run it
+  worklet new fastapi api      # Create ./api from the fastapi template
+  worklet new go-api --no-run  # Create the project without running it`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: withOutput(func(cmd *cobra.Command, args []string) error {
+		location := newIndex
+		if location == "" {
+			location = templates.IndexLocation(loadGlobalConfig().Templates.Index)
+		}
+
+		catalog, stale, err := templates.Load(location)
+		if err != nil {
+			return err
+		}
+		if stale {
+			fmt.Fprintf(os.Stderr, "Warning: couldn't download the template catalog from %s, using the last one downloaded\n", location)
+		}
+
+		if newList || len(args) == 0 {
+			printTemplates(catalog)
+			return nil
+		}
+
+		template, err := catalog.Find(args[0])
+		if err != nil {
+			return err
+		}
+		if platform := templates.Platform(); !template.Supports(platform) {
+			return fmt.Errorf("template %s doesn't support %s (supported: %v)", template.Name, platform, template.Platforms)
+		}
+
+		dir := template.Name
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		dir, err = filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", dir, err)
+		}
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return fmt.Errorf("%s already exists and isn't empty", dir)
+		}
+
+		checkout, err := createTempDirectory("template-" + template.Name)
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(checkout)
+
+		renderer := newProgressRenderer()
+		progress := docker.ProgressFunc(renderer.Handle)
+		progress.Start(docker.PhaseClone, template.Repo)
+		err = cloneRepository(cmd.Context(), template.Repo, checkout, template.Ref, cloneSettings{}, progress)
+		if err != nil {
+			progress.Fail(docker.PhaseClone, err)
+			renderer.Close()
+			return fmt.Errorf("failed to clone template %s: %w", template.Name, err)
+		}
+		progress.Done(docker.PhaseClone, describeClone(checkout))
+		renderer.Close()
+
+		if err := templates.Scaffold(template, checkout, dir); err != nil {
+			return err
+		}
+		console.Printf("Created %s from the %s template\n", dir, template.Name)
+
+		if newNoRun {
+			console.Printf("Start it with: cd %s && worklet run\n", shellJoin([]string{dir}))
+			return nil
+		}
+		console.Printf("Running in %s: worklet run\n", dir)
+		return runWorklet(cmd.Context(), dir, []string{"run"})
+	}),
+}
+
+func init() {
+	newCmd.Flags().BoolVar(&newList, "list", false, "List the available templates")
+	newCmd.Flags().BoolVar(&newNoRun, "no-run", false, "Create the project without running it")
+	newCmd.Flags().StringVar(&newIndex, "index", "", "URL or path of the template catalog to use")
+	addOutputFlags(newCmd)
+}
+
+// printTemplates lists a catalog's templates, marking those that don't run
+// on this machine's platform
+func printTemplates(catalog *templates.Catalog) {
+	if len(catalog.Templates) == 0 {
+		fmt.Println("No templates in the catalog")
+		return
+	}
+	platform := templates.Platform()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEMPLATE\tDESCRIPTION")
+	for _, t := range catalog.Templates {
+		description := t.Description
+		if !t.Supports(platform) {
+			description += fmt.Sprintf(" (not available on %s)", platform)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", t.Name, description)
+	}
+	w.Flush()
+	fmt.Println("\nCreate a project with: worklet new <template> [directory]")
+}
@@ -0,0 +1,80 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/notes"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var noteClear bool
+
+var noteCmd = &cobra.Command{
+	Use:   "note <session-id> [text...]",
+	Short: "Attach a note to a session",
+	Long: `Attach a free-form note to a session so you remember why it exists.
+Notes are shown by 'worklet forks' and in the interactive session list.
+
+Without text the current note is printed.
+
+Examples:
+  worklet note 3 "trying pg16 upgrade"
+  worklet note 3            # Print the note
+  worklet note 3 --clear    # Remove the note`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runNote,
+}
+
+func init() {
+	noteCmd.Flags().BoolVar(&noteClear, "clear", false, "Remove the note")
+}
+
+func runNote(cmd *cobra.Command, args []string) error {
+	sessionID := args[0]
+	text := strings.TrimSpace(strings.Join(args[1:], " "))
+
+	store, err := notes.New()
+	if err != nil {
+		return err
+	}
+
+	if !noteClear && text == "" {
+		note, err := store.Get(sessionID)
+		if err != nil {
+			return err
+		}
+		if note == "" {
+			fmt.Printf("Session %s has no note\n", sessionID)
+		} else {
+			fmt.Println(note)
+		}
+		return nil
+	}
+
+	if noteClear {
+		text = ""
+	}
+	if err := store.Set(sessionID, text); err != nil {
+		return fmt.Errorf("failed to save note: %w", err)
+	}
+
+	// Let a running daemon show the note without a restart
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		client.SetNote(ctx, sessionID, text)
+		cancel()
+		client.Close()
+	}
+
+	if text == "" {
+		fmt.Printf("Cleared note for session %s\n", sessionID)
+	} else {
+		fmt.Printf("Saved note for session %s\n", sessionID)
+	}
+	return nil
+}
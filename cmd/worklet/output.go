@@ -0,0 +1,138 @@
+package worklet
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	outputQuiet   bool
+	outputVerbose bool
+	noColor       bool // --no-color, for every command
+)
+
+// outputController decides what a command prints. Quiet commands print only
+// their results, such as session IDs and URLs; verbose ones also print the
+// docker commands they run and how long they took, to stderr.
+type outputController struct {
+	quiet   bool
+	verbose bool
+	out     io.Writer
+	err     io.Writer
+}
+
+// console is the output of the current command. Commands without the output
+// flags print everything.
+var console = &outputController{out: os.Stdout, err: os.Stderr}
+
+// addOutputFlags adds -q/--quiet and -v/--verbose to cmd
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVarP(&outputQuiet, "quiet", "q", false, "Only print results, such as session IDs and URLs")
+	cmd.Flags().BoolVarP(&outputVerbose, "verbose", "v", false, "Also print the docker commands run and timings")
+}
+
+// withOutput wraps the RunE of a command with output flags, setting up
+// console and the docker package's output from them for the command's run
+func withOutput(run func(cmd *cobra.Command, args []string) error) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		if outputQuiet && outputVerbose {
+			return fmt.Errorf("--quiet and --verbose can't be used together")
+		}
+
+		console = &outputController{quiet: outputQuiet, verbose: outputVerbose, out: os.Stdout, err: os.Stderr}
+		if console.quiet {
+			docker.Output = io.Discard
+		}
+		if console.verbose {
+			docker.CommandLog = console.err
+		}
+		defer func() {
+			console = &outputController{out: os.Stdout, err: os.Stderr}
+			docker.Output = os.Stdout
+			docker.CommandLog = nil
+		}()
+
+		started := time.Now()
+		err := run(cmd, args)
+		console.Verbosef("%s took %v\n", cmd.CommandPath(), time.Since(started).Round(time.Millisecond))
+		return err
+	}
+}
+
+// Writer returns where informational output goes: stdout, or nowhere when
+// quiet
+func (o *outputController) Writer() io.Writer {
+	if o.quiet {
+		return io.Discard
+	}
+	return o.out
+}
+
+// Printf prints informational output, which quiet mode leaves out
+func (o *outputController) Printf(format string, args ...any) {
+	fmt.Fprintf(o.Writer(), format, args...)
+}
+
+// Println prints a line of informational output, which quiet mode leaves out
+func (o *outputController) Println(args ...any) {
+	fmt.Fprintln(o.Writer(), args...)
+}
+
+// Resultf prints a command's result, which is always shown
+func (o *outputController) Resultf(format string, args ...any) {
+	fmt.Fprintf(o.out, format, args...)
+}
+
+// Verbosef prints details only shown in verbose mode, to stderr
+func (o *outputController) Verbosef(format string, args ...any) {
+	if o.verbose {
+		fmt.Fprintf(o.err, format, args...)
+	}
+}
+
+// Quiet reports whether only results are printed
+func (o *outputController) Quiet() bool {
+	return o.quiet
+}
+
+// Verbose reports whether details are printed
+func (o *outputController) Verbose() bool {
+	return o.verbose
+}
+
+// applyColorFlag makes --no-color also turn off color in the interactive
+// views and in the commands worklet runs, by setting NO_COLOR
+func applyColorFlag() {
+	if noColor {
+		os.Setenv("NO_COLOR", "1")
+	}
+}
+
+// colorEnabled reports whether w gets colored output: it's a terminal other
+// than a dumb one, and neither --no-color nor NO_COLOR is set
+func colorEnabled(w io.Writer) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// hyperlinksEnabled reports whether URLs written to w are OSC 8 hyperlinks.
+// Terminals that support color mostly support them or ignore them, except the
+// Linux console; FORCE_HYPERLINK=1 or 0 overrides the detection.
+func hyperlinksEnabled(w io.Writer) bool {
+	switch os.Getenv("FORCE_HYPERLINK") {
+	case "1":
+		return true
+	case "0":
+		return false
+	}
+	return colorEnabled(w) && os.Getenv("TERM") != "linux"
+}
@@ -0,0 +1,293 @@
+package worklet
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/gitauth"
+	"github.com/nolanleung/worklet/internal/pullrequest"
+	"github.com/spf13/cobra"
+)
+
+var (
+	prBase   string
+	prTitle  string
+	prBody   string
+	prDraft  bool
+	prRemote string
+	prNoPush bool
+)
+
+// Default templates when neither flags nor the project's "pr" config set them
+const (
+	defaultPRTitle = "{{.Subject}}"
+	defaultPRBody  = "{{range .Commits}}- {{.}}\n{{end}}"
+)
+
+// prTemplateData is available to the title and body templates
+type prTemplateData struct {
+	Branch  string   // Branch being proposed
+	Base    string   // Branch it merges into
+	Project string   // Project name from .worklet.jsonc, if any
+	Subject string   // Subject of the only commit, or the branch name if there are several
+	Commits []string // Commit subjects, oldest first
+}
+
+var prCmd = &cobra.Command{
+	Use:   "pr [worktree-path|branch]",
+	Short: "Push a branch and open a pull request",
+	Long: `Push a branch worktree's commits to its remote and open a pull request
+(GitHub) or merge request (GitLab) for them.
+
+The argument is a worktree directory or the branch of a worktree created
+with 'worklet run --worktree'. Without an argument the current directory is
+used. Uncommitted changes must be committed first.
+
+The API token comes from the same places as clone credentials: the host's
+entry in ~/.worklet/config.jsonc, GITHUB_TOKEN/GITLAB_TOKEN, or git's
+credential helpers. For self-hosted servers set "api" to "github" or
+"gitlab" on the host's entry.
+
+Title and body are Go templates with the fields .Branch, .Base, .Project,
+.Subject and .Commits. Defaults can be set in .worklet.jsonc:
+
+  "pr": {"title": "[{{.Project}}] {{.Subject}}", "base": "develop", "draft": true}
+
+Examples:
+  worklet pr                         # Open a PR for the current branch
+  worklet pr feat-x                  # Open a PR for the feat-x worktree
+  worklet pr feat-x --draft --base develop`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPR,
+}
+
+func init() {
+	prCmd.Flags().StringVar(&prBase, "base", "", "Branch to merge into (default: the remote's default branch)")
+	prCmd.Flags().StringVar(&prTitle, "title", "", "Title template")
+	prCmd.Flags().StringVar(&prBody, "body", "", "Body template")
+	prCmd.Flags().BoolVar(&prDraft, "draft", false, "Open as a draft")
+	prCmd.Flags().StringVar(&prRemote, "remote", "origin", "Remote to push to")
+	prCmd.Flags().BoolVar(&prNoPush, "no-push", false, "Don't push; the branch is already on the remote")
+}
+
+func runPR(cmd *cobra.Command, args []string) error {
+	dir, err := resolveWorktreeDir(args)
+	if err != nil {
+		return err
+	}
+
+	branch, err := gitOutput(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return fmt.Errorf("not a git repository: %s", dir)
+	}
+	if branch == "HEAD" {
+		return fmt.Errorf("%s has a detached HEAD; check out a branch first", dir)
+	}
+
+	if status, err := gitOutput(dir, "status", "--porcelain"); err != nil {
+		return err
+	} else if status != "" {
+		return fmt.Errorf("%s has uncommitted changes; commit them first", dir)
+	}
+
+	remoteURL, err := gitOutput(dir, "remote", "get-url", prRemote)
+	if err != nil {
+		return fmt.Errorf("no %s remote in %s", prRemote, dir)
+	}
+
+	projectConfig := &config.PRConfig{}
+	var projectName string
+	if cfg, err := config.LoadConfig(dir); err == nil {
+		projectName = cfg.Name
+		if cfg.PR != nil {
+			projectConfig = cfg.PR
+		}
+	}
+
+	base := firstNonEmpty(prBase, projectConfig.Base, defaultBranch(dir, prRemote))
+	if base == branch {
+		return fmt.Errorf("%s is the base branch; open a pull request from another branch", branch)
+	}
+
+	// Self-hosted servers name their API in the host config
+	global := loadGlobalConfig()
+	ep, err := transport.NewEndpoint(remoteURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse remote URL: %w", err)
+	}
+	hostConfig, _ := global.GitHost(ep.Host, ep.Port)
+	remote, err := pullrequest.ParseRemote(remoteURL, hostConfig.API)
+	if err != nil {
+		return err
+	}
+
+	// Credentials are looked up for the web URL so HTTP tokens apply to SSH remotes too
+	auth, _ := gitauth.DefaultResolver(global).Auth(fmt.Sprintf("https://%s/%s.git", remote.Host, remote.Path))
+	basic, _ := auth.(*http.BasicAuth)
+
+	if !prNoPush {
+		fmt.Printf("Pushing %s to %s...\n", branch, prRemote)
+		if err := pushBranch(dir, prRemote, remoteURL, branch, basic); err != nil {
+			return err
+		}
+	}
+
+	commits, err := commitSubjects(dir, prRemote+"/"+base)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("%s has no commits ahead of %s/%s", branch, prRemote, base)
+	}
+
+	data := prTemplateData{
+		Branch:  branch,
+		Base:    base,
+		Project: projectName,
+		Subject: branch,
+		Commits: commits,
+	}
+	if len(commits) == 1 {
+		data.Subject = commits[0]
+	}
+
+	title, err := renderPRTemplate("title", firstNonEmpty(prTitle, projectConfig.Title, defaultPRTitle), data)
+	if err != nil {
+		return err
+	}
+	body, err := renderPRTemplate("body", firstNonEmpty(prBody, projectConfig.Body, defaultPRBody), data)
+	if err != nil {
+		return err
+	}
+
+	token := ""
+	if basic != nil {
+		token = basic.Password
+	}
+
+	url, err := remote.Create(context.Background(), token, pullrequest.Request{
+		Title: strings.TrimSpace(title),
+		Body:  body,
+		Head:  branch,
+		Base:  base,
+		Draft: prDraft || projectConfig.Draft,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Opened %s\n", url)
+	return nil
+}
+
+// resolveWorktreeDir returns the worktree directory for a command's argument: a
+// directory, the branch of a managed worktree of the current repository, or
+// the current directory when there is no argument
+func resolveWorktreeDir(args []string) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if len(args) == 0 {
+		return cwd, nil
+	}
+
+	if info, err := os.Stat(args[0]); err == nil && info.IsDir() {
+		return args[0], nil
+	}
+
+	repoRoot, err := gitOutput(cwd, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("%s is not a directory, and the current directory is not a git repository", args[0])
+	}
+	path, err := findWorktree(repoRoot, args[0])
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		expected, err := worktreePath(repoRoot, args[0])
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no worktree for branch %s (expected %s)", args[0], expected)
+	}
+	return path, nil
+}
+
+// defaultBranch returns the remote's default branch, falling back to "main"
+func defaultBranch(dir, remote string) string {
+	ref, err := gitOutput(dir, "symbolic-ref", "--short", "refs/remotes/"+remote+"/HEAD")
+	if err != nil {
+		return "main"
+	}
+	return strings.TrimPrefix(ref, remote+"/")
+}
+
+// commitSubjects returns the subjects of commits on HEAD that aren't on
+// baseRef, oldest first
+func commitSubjects(dir, baseRef string) ([]string, error) {
+	output, err := gitOutput(dir, "log", "--reverse", "--format=%s", baseRef+"..HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits since %s: %w", baseRef, err)
+	}
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+// pushBranch pushes branch and sets its upstream. Stored HTTP credentials are
+// passed to git through the environment so they never appear in argv.
+func pushBranch(dir, remote, remoteURL, branch string, auth *http.BasicAuth) error {
+	cmd := exec.Command("git", "push", "--set-upstream", remote, branch)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	if auth != nil && strings.HasPrefix(remoteURL, "https://") {
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		cmd.Env = append(cmd.Env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials,
+		)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to push %s: %w", branch, err)
+	}
+	return nil
+}
+
+// renderPRTemplate executes a title or body template
+func renderPRTemplate(name, text string, data prTemplateData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+// firstNonEmpty returns the first non-empty string
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/spf13/cobra"
+)
+
+var (
+	prefetchList bool
+	prefetchDue  bool
+)
+
+var prefetchCmd = &cobra.Command{
+	Use:   "prefetch",
+	Short: "Pull the images sessions are likely to need",
+	Long: `Pull the images sessions are likely to need ahead of time, so starting one
+doesn't wait on a pull after an image was updated: the proxy's image, the
+default base image, the images of the projects run most in the last month
+and the images listed in prefetch.images of ~/.worklet/config.jsonc.
+
+The daemon does the same in the background while no session is starting,
+pulling each image again once its registry's interval has passed. Settings
+for a registry go under prefetch.registries, keyed by registry host:
+
+  "prefetch": {
+    "intervalHours": 6,
+    "projects": 5,
+    "images": ["postgres:16"],
+    "registries": {
+      "registry.corp:5000": {"disabled": true},
+      "ghcr.io": {"intervalHours": 24}
+    }
+  }
+
+Images built locally are left alone.
+
+Examples:
+  worklet prefetch          # Pull every image now
+  worklet prefetch --due    # Only pull images whose interval has passed
+  worklet prefetch --list   # Show which images would be pulled`,
+	Args: cobra.NoArgs,
+	RunE: runPrefetch,
+}
+
+func init() {
+	prefetchCmd.Flags().BoolVar(&prefetchList, "list", false, "List the images without pulling them")
+	prefetchCmd.Flags().BoolVar(&prefetchDue, "due", false, "Only pull images whose registry's interval has passed")
+}
+
+func runPrefetch(cmd *cobra.Command, args []string) error {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		return err
+	}
+	targets := docker.PrefetchTargets(global)
+	if len(targets) == 0 {
+		fmt.Println("No images to prefetch.")
+		return nil
+	}
+
+	if prefetchList {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "IMAGE\tREGISTRY\tWHY")
+		for _, target := range targets {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", target.Image, config.ImageRegistry(target.Image), target.Reason)
+		}
+		return w.Flush()
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var failed int
+	results, err := docker.Prefetch(ctx, global.Prefetch, targets, !prefetchDue, func(result docker.PrefetchResult) {
+		if result.Err != nil {
+			failed++
+			fmt.Printf("  %s: %v\n", result.Image, result.Err)
+			return
+		}
+		fmt.Printf("  %s: %s\n", result.Image, result.Status)
+	})
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		fmt.Println("No images are due to be pulled again.")
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to prefetch %d of %d images", failed, len(results))
+	}
+	return nil
+}
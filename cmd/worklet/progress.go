@@ -0,0 +1,214 @@
+package worklet
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"golang.org/x/term"
+)
+
+var phaseTitles = map[docker.Phase]string{
+	docker.PhaseClone:   "Cloning repository",
+	docker.PhaseScan:    "Scanning image",
+	docker.PhaseBuild:   "Building image",
+	docker.PhaseCreate:  "Creating container",
+	docker.PhaseInit:    "Running init scripts",
+	docker.PhaseHealthy: "Checking health",
+}
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progressRenderer prints startup phases, with an animated spinner on a
+// terminal and plain lines otherwise. Other output of the command goes
+// through it too while it's attached, so it never lands in the middle of a
+// spinner frame.
+type progressRenderer struct {
+	out io.Writer
+	tty bool
+
+	writeMu  sync.Mutex // Serializes writes to out
+	spinning bool       // A spinner frame is on the current line; guarded by writeMu
+
+	mu      sync.Mutex
+	phase   docker.Phase
+	message string
+	started time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// newProgressRenderer creates a renderer writing to stdout, or nowhere when
+// the command is quiet
+func newProgressRenderer() *progressRenderer {
+	return &progressRenderer{
+		out: console.Writer(),
+		tty: !console.Quiet() && term.IsTerminal(int(os.Stdout.Fd())),
+	}
+}
+
+// Attach sends the stdout output of the docker package and console through
+// the renderer until the returned function is called. It does nothing off a
+// terminal, where there's no spinner to interleave with.
+func (r *progressRenderer) Attach() func() {
+	if !r.tty {
+		return func() {}
+	}
+	previousDocker, previousConsole := docker.Output, console.out
+	if docker.Output == os.Stdout {
+		docker.Output = r
+	}
+	if console.out == os.Stdout {
+		console.out = r
+	}
+	return func() {
+		docker.Output = previousDocker
+		console.out = previousConsole
+	}
+}
+
+// Write writes other output, clearing a spinner frame first. The spinner
+// draws its next frame below it.
+func (r *progressRenderer) Write(p []byte) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	if r.spinning {
+		fmt.Fprint(r.out, "\r\033[K")
+		r.spinning = false
+	}
+	return r.out.Write(p)
+}
+
+// printf writes a line of the renderer's own, replacing any spinner frame
+func (r *progressRenderer) printf(format string, args ...any) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	fmt.Fprintf(r.out, format, args...)
+	r.spinning = false
+}
+
+// Handle renders a single progress event. It is a docker.ProgressFunc.
+func (r *progressRenderer) Handle(ev docker.ProgressEvent) {
+	title := phaseTitles[ev.Phase]
+	if title == "" {
+		title = string(ev.Phase)
+	}
+
+	switch ev.State {
+	case docker.PhaseStarted:
+		r.stopSpinner()
+		r.mu.Lock()
+		r.phase = ev.Phase
+		r.message = ""
+		r.started = time.Now()
+		r.mu.Unlock()
+		if r.tty {
+			r.startSpinner()
+		} else {
+			r.printf("==> %s\n", title)
+		}
+
+	case docker.PhaseProgress:
+		if r.tty {
+			r.mu.Lock()
+			r.message = ev.Message
+			r.mu.Unlock()
+		} else {
+			r.printf("    %s\n", ev.Message)
+		}
+
+	case docker.PhaseDone:
+		r.stopSpinner()
+		elapsed := r.elapsed()
+		detail := ""
+		if ev.Message != "" {
+			detail = ": " + ev.Message
+		}
+		if r.tty {
+			r.printf("\r\033[K✓ %s%s (%v)\n", title, detail, elapsed)
+		} else {
+			r.printf("    done%s (%v)\n", detail, elapsed)
+		}
+
+	case docker.PhaseFailed:
+		r.stopSpinner()
+		if r.tty {
+			r.printf("\r\033[K✗ %s failed\n", title)
+		} else {
+			r.printf("    failed: %v\n", ev.Err)
+		}
+	}
+}
+
+// Close stops any running spinner
+func (r *progressRenderer) Close() {
+	r.stopSpinner()
+}
+
+func (r *progressRenderer) elapsed() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Since(r.started).Round(100 * time.Millisecond)
+}
+
+func (r *progressRenderer) startSpinner() {
+	r.mu.Lock()
+	r.stop = make(chan struct{})
+	r.stopped = make(chan struct{})
+	stop, stopped := r.stop, r.stopped
+	r.mu.Unlock()
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+
+		for frame := 0; ; frame++ {
+			r.mu.Lock()
+			title := phaseTitles[r.phase]
+			line := fmt.Sprintf("%s %s (%v)", spinnerFrames[frame%len(spinnerFrames)], title, time.Since(r.started).Round(time.Second))
+			if r.message != "" {
+				line += " " + r.message
+			}
+			r.mu.Unlock()
+
+			// Keep the line within the terminal so \r can overwrite it
+			if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && len([]rune(line)) >= width {
+				line = string([]rune(line)[:width-1])
+			}
+			r.writeMu.Lock()
+			fmt.Fprintf(r.out, "\r\033[K%s", line)
+			r.spinning = true
+			r.writeMu.Unlock()
+
+			select {
+			case <-ticker.C:
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *progressRenderer) stopSpinner() {
+	r.mu.Lock()
+	stop, stopped := r.stop, r.stopped
+	r.stop, r.stopped = nil, nil
+	r.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-stopped
+	}
+
+	// Don't leave a frame for the next output to run into
+	r.writeMu.Lock()
+	if r.spinning {
+		fmt.Fprint(r.out, "\r\033[K")
+		r.spinning = false
+	}
+	r.writeMu.Unlock()
+}
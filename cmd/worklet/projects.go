@@ -3,7 +3,7 @@ package worklet
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 	"text/tabwriter"
 	"time"
 
@@ -17,10 +17,13 @@ var projectsCmd = &cobra.Command{
 	Long:  `Manage worklet project history and settings.`,
 }
 
+var projectsListGroup string
+
 var projectsListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all projects",
-	Long:  `List all projects in the worklet history.`,
+	Long: `List all projects in the worklet history. Favorites are listed first,
+then each group, then the ungrouped projects.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		manager, err := projects.NewManager()
 		if err != nil {
@@ -28,26 +31,40 @@ var projectsListCmd = &cobra.Command{
 		}
 
 		projectList := manager.List()
+		if projectsListGroup != "" {
+			var filtered []projects.Project
+			for _, p := range projectList {
+				if strings.EqualFold(p.Group, projectsListGroup) {
+					filtered = append(filtered, p)
+				}
+			}
+			projectList = filtered
+		}
 		if len(projectList) == 0 {
 			fmt.Println("No projects found.")
 			return nil
 		}
 
+		sections := projects.Sections(projectList)
+		grouped := len(sections) > 1 || sections[0].Name != "" || sections[0].Favorites
+
 		// Create a tabwriter for aligned output
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		fmt.Fprintln(w, "NAME\tPATH\tLAST ACCESSED\tRUNS")
 		fmt.Fprintln(w, "----\t----\t-------------\t----")
 
-		for _, p := range projectList {
-			name := p.Name
-			if name == "" {
-				name = filepath.Base(p.Path)
+		for _, section := range sections {
+			if grouped {
+				// Tabs keep the rows of every section aligned
+				fmt.Fprintf(w, "\t\t\t\n%s (%d)\t\t\t\n", strings.ToUpper(section.Title()), len(section.Projects))
+			}
+			for _, p := range section.Projects {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", 
+					p.DisplayName(), 
+					p.Path, 
+					formatTime(p.LastAccessed),
+					p.RunCount)
 			}
-			fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", 
-				name, 
-				p.Path, 
-				formatTime(p.LastAccessed),
-				p.RunCount)
 		}
 
 		w.Flush()
@@ -55,6 +72,87 @@ var projectsListCmd = &cobra.Command{
 	},
 }
 
+var projectsPinCmd = &cobra.Command{
+	Use:   "pin <project>",
+	Short: "Pin a project to the top of the list",
+	Long:  `Mark a project, given by name or path, as a favorite so it's listed first.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setFavorite(args[0], true)
+	},
+}
+
+var projectsUnpinCmd = &cobra.Command{
+	Use:   "unpin <project>",
+	Short: "Unpin a favorite project",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setFavorite(args[0], false)
+	},
+}
+
+var projectsGroupCmd = &cobra.Command{
+	Use:   "group <project> [group]",
+	Short: "Put a project in a group",
+	Long: `Put a project, given by name or path, in a group such as work, oss or
+experiments. Projects are listed by group. Without a group, the project is
+taken out of its group.
+
+Examples:
+  worklet projects group shop work   # List shop under work
+  worklet projects group shop        # Ungroup shop`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := projects.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to initialize project manager: %w", err)
+		}
+
+		project, err := manager.Find(args[0])
+		if err != nil {
+			return err
+		}
+
+		group := ""
+		if len(args) > 1 {
+			group = args[1]
+		}
+		if err := manager.SetGroup(project.Path, group); err != nil {
+			return fmt.Errorf("failed to update project: %w", err)
+		}
+
+		if group == "" {
+			fmt.Printf("Removed %s from its group\n", project.DisplayName())
+		} else {
+			fmt.Printf("Moved %s to group %s\n", project.DisplayName(), strings.TrimSpace(group))
+		}
+		return nil
+	},
+}
+
+// setFavorite pins or unpins the project with the given name or path
+func setFavorite(query string, favorite bool) error {
+	manager, err := projects.NewManager()
+	if err != nil {
+		return fmt.Errorf("failed to initialize project manager: %w", err)
+	}
+
+	project, err := manager.Find(query)
+	if err != nil {
+		return err
+	}
+	if err := manager.SetFavorite(project.Path, favorite); err != nil {
+		return fmt.Errorf("failed to update project: %w", err)
+	}
+
+	if favorite {
+		fmt.Printf("Pinned %s\n", project.DisplayName())
+	} else {
+		fmt.Printf("Unpinned %s\n", project.DisplayName())
+	}
+	return nil
+}
+
 var projectsRemoveCmd = &cobra.Command{
 	Use:   "remove <path>",
 	Short: "Remove a project from history",
@@ -131,6 +229,12 @@ var projectsInfoCmd = &cobra.Command{
 		fmt.Printf("  Path:          %s\n", project.Path)
 		fmt.Printf("  Last Accessed: %s\n", project.LastAccessed.Format(time.RFC3339))
 		fmt.Printf("  Run Count:     %d\n", project.RunCount)
+		if project.Group != "" {
+			fmt.Printf("  Group:         %s\n", project.Group)
+		}
+		if project.Favorite {
+			fmt.Printf("  Favorite:      yes\n")
+		}
 		
 		if project.ForkID != "" {
 			fmt.Printf("  Fork ID:       %s\n", project.ForkID)
@@ -183,6 +287,11 @@ func init() {
 	projectsCmd.AddCommand(projectsClearCmd)
 	projectsCmd.AddCommand(projectsInfoCmd)
 	projectsCmd.AddCommand(projectsCleanCmd)
+	projectsCmd.AddCommand(projectsPinCmd)
+	projectsCmd.AddCommand(projectsUnpinCmd)
+	projectsCmd.AddCommand(projectsGroupCmd)
+
+	projectsListCmd.Flags().StringVarP(&projectsListGroup, "group", "g", "", "Only list projects in this group")
 }
 
 func formatTime(t time.Time) string {
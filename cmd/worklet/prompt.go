@@ -0,0 +1,29 @@
+package worklet
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// confirm asks a yes/no question on the terminal, defaulting to no. It
+// returns an error without asking when stdin isn't a terminal, so scripts
+// must opt in with a flag instead.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("cannot ask %q without a terminal; use --force", question)
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	reader := bufio.NewReader(os.Stdin)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes", nil
+}
@@ -0,0 +1,328 @@
+package worklet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	psAll      bool
+	psWatch    bool
+	psInterval time.Duration
+)
+
+var psCmd = &cobra.Command{
+	Use:   "ps",
+	Short: "List sessions",
+	Long: `List the sessions the daemon has registered as a table, most recently used
+first, or with --all stopped ones too. The status shows whether a session is
+running, failing its health check or waiting to be restarted after a crash,
+next to how often it has restarted and when it was last used.
+
+With --watch the table is refreshed every --interval until interrupted,
+redrawn in place below the command rather than taking over the terminal, so
+it can be kept open in a side terminal. Sessions that appeared since the
+last refresh are marked with +, ones whose status changed with ~, and ones
+that went away are shown once more marked with -. In color they're green,
+yellow and red. When the output isn't a terminal, each refresh is printed
+after the last.
+
+Examples:
+  worklet ps                      # Running sessions
+  worklet ps -a                   # Include stopped sessions
+  worklet ps --watch              # Refresh every 2 seconds
+  worklet ps -w --interval 10s    # Refresh every 10 seconds`,
+	Args: cobra.NoArgs,
+	RunE: runPs,
+}
+
+func init() {
+	psCmd.Flags().BoolVarP(&psAll, "all", "a", false, "Include stopped sessions")
+	psCmd.Flags().BoolVarP(&psWatch, "watch", "w", false, "Refresh the table until interrupted")
+	psCmd.Flags().DurationVar(&psInterval, "interval", 2*time.Second, "Time between refreshes with --watch")
+}
+
+// psChange is how a session changed since the previous refresh
+type psChange string
+
+const (
+	psUnchanged psChange = " "
+	psAdded     psChange = "+"
+	psChanged   psChange = "~"
+	psRemoved   psChange = "-"
+)
+
+// ANSI colors of rows by change
+var psColors = map[psChange]string{
+	psAdded:   "\x1b[32m",
+	psChanged: "\x1b[33m",
+	psRemoved: "\x1b[31m",
+}
+
+// psSession is a session in the table: a fork the daemon has registered,
+// or with --all one only Docker knows of, such as a stopped one
+type psSession struct {
+	fork  daemon.ForkInfo
+	state string // Container state of a session the daemon hasn't registered
+}
+
+// status describes a session the way worklet forks does
+func (s psSession) status() string {
+	switch {
+	case s.state != "":
+		return s.state
+	case s.fork.Restarting:
+		return fmt.Sprintf("restarting (exit %d)", s.fork.LastExitCode)
+	case s.fork.Unhealthy:
+		return "unhealthy"
+	}
+	return "running"
+}
+
+// psRow is a session in the table and how it changed
+type psRow struct {
+	session psSession
+	change  psChange
+}
+
+func runPs(cmd *cobra.Command, args []string) error {
+	if psInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !psWatch {
+		sessions, err := listPsSessions(ctx)
+		if err != nil {
+			return err
+		}
+		rows := diffSessions(nil, sessions)
+		for i := range rows {
+			rows[i].change = psUnchanged
+		}
+		printPs(os.Stdout, rows, false)
+		return nil
+	}
+
+	live := term.IsTerminal(int(os.Stdout.Fd()))
+	color := colorEnabled(os.Stdout)
+	ticker := time.NewTicker(psInterval)
+	defer ticker.Stop()
+
+	var previous []psSession
+	drawn := 0
+	for refresh := 0; ; refresh++ {
+		sessions, err := listPsSessions(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		rows := diffSessions(previous, sessions)
+		if refresh == 0 {
+			// Everything is new on the first refresh, which isn't news
+			for i := range rows {
+				rows[i].change = psUnchanged
+			}
+		}
+		previous = sessions
+
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "Every %v: %d session(s), %s\n", psInterval, len(sessions), time.Now().Format("15:04:05"))
+		printPs(&buf, rows, true)
+		lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+
+		if live {
+			// Lines wider than the terminal would wrap and throw off how
+			// many lines the next refresh moves up over
+			if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+				for i, line := range lines {
+					lines[i] = truncateLine(line, width)
+				}
+			}
+			if drawn > 0 {
+				fmt.Printf("\x1b[%dA\x1b[J", drawn)
+			}
+			drawn = len(lines)
+		} else if refresh > 0 {
+			fmt.Println()
+		}
+
+		for i, line := range lines {
+			// Rows follow the two header lines
+			if i >= 2 && i-2 < len(rows) && color {
+				if code, ok := psColors[rows[i-2].change]; ok {
+					line = code + line + "\x1b[0m"
+				}
+			}
+			fmt.Println(line)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// listPsSessions lists the sessions ps shows: the daemon's forks, most
+// recently used first, then with --all the sessions it hasn't registered,
+// newest first
+func listPsSessions(ctx context.Context) ([]psSession, error) {
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("daemon is not running. Start it with: worklet daemon start")
+	}
+	defer client.Close()
+
+	forks, err := client.ListForks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forks: %w", err)
+	}
+	sortByActivity(forks)
+
+	sessions := make([]psSession, 0, len(forks))
+	registered := make(map[string]bool, len(forks))
+	for _, fork := range forks {
+		sessions = append(sessions, psSession{fork: fork})
+		registered[fork.ForkID] = true
+	}
+	if !psAll {
+		return sessions, nil
+	}
+
+	all, err := docker.ListAllSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].CreatedAt.After(all[j].CreatedAt) })
+	for _, session := range all {
+		if registered[session.SessionID] {
+			continue
+		}
+		sessions = append(sessions, psSession{
+			fork: daemon.ForkInfo{
+				ForkID:      session.SessionID,
+				ProjectName: session.ProjectName,
+				ContainerID: session.ContainerID,
+				WorkDir:     session.WorkDir,
+				StartedAt:   session.CreatedAt,
+			},
+			state: session.Status,
+		})
+	}
+	return sessions, nil
+}
+
+// diffSessions returns the rows of the table for sessions, compared with
+// the previous refresh: new and changed sessions are marked, and removed
+// ones are added back at the end marked as removed. Rows keep the order of
+// sessions.
+func diffSessions(previous, sessions []psSession) []psRow {
+	before := make(map[string]psSession, len(previous))
+	for _, session := range previous {
+		before[session.fork.ForkID] = session
+	}
+
+	var rows []psRow
+	current := make(map[string]bool, len(sessions))
+	for _, session := range sessions {
+		current[session.fork.ForkID] = true
+		change := psUnchanged
+		if old, ok := before[session.fork.ForkID]; !ok {
+			change = psAdded
+		} else if old.status() != session.status() || old.fork.RestartCount != session.fork.RestartCount {
+			change = psChanged
+		}
+		rows = append(rows, psRow{session: session, change: change})
+	}
+	for _, session := range previous {
+		if !current[session.fork.ForkID] {
+			session.state = "removed"
+			rows = append(rows, psRow{session: session, change: psRemoved})
+		}
+	}
+	return rows
+}
+
+// printPs writes rows as a table. With marks, the first column shows how
+// each session changed.
+func printPs(out io.Writer, rows []psRow, marks bool) {
+	if len(rows) == 0 {
+		if psAll {
+			fmt.Fprintln(out, "No sessions")
+		} else {
+			fmt.Fprintln(out, "No running sessions")
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := "SESSION\tPROJECT\tSTATUS\tRESTARTS\tLAST ACTIVE\tDIRECTORY\tURLS"
+	if marks {
+		header = " \t" + header
+	}
+	fmt.Fprintln(w, header)
+	for _, row := range rows {
+		fork := row.session.fork
+		active := "-"
+		if !fork.LastActivityAt.IsZero() {
+			active = formatAge(time.Since(fork.LastActivityAt)) + " ago"
+		}
+		var urls []string
+		for _, svc := range fork.Services {
+			if !svc.IsStream() {
+				urls = append(urls, forkServiceURL(fork, svc))
+			}
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%d\t%s\t%s\t%s", fork.ForkID, fork.ProjectName, row.session.status(), fork.RestartCount, active, fork.WorkDir, strings.Join(urls, " "))
+		if marks {
+			line = string(row.change) + "\t" + line
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+}
+
+// formatAge formats how long ago something happened in its largest unit,
+// such as "5m" or "3d"
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours())/24)
+	}
+}
+
+// truncateLine cuts line to width characters
+func truncateLine(line string, width int) string {
+	runes := []rune(line)
+	if len(runes) <= width {
+		return line
+	}
+	return string(runes[:width])
+}
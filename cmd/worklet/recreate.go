@@ -0,0 +1,113 @@
+package worklet
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/trace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recreateFile  string
+	recreateForce bool
+)
+
+var recreateCmd = &cobra.Command{
+	Use:   "recreate -f <manifest.json>",
+	Short: "Start a new session from a saved describe manifest",
+	Long: `Start a new session exactly as described by a manifest saved with
+'worklet describe <session-id> --json': from the same directory, in the same
+mount or copy mode, with the same command and with the base image pinned to
+the digest it had.
+
+Before anything is started the project is checked against the manifest.
+The git commit, the worklet config (including environment templates), the
+compose file and the worklet version must all match. Any difference is
+listed and the recreate fails unless --force is given. Manifests taken from
+a session with uncommitted changes can't be recreated exactly.
+
+Mounts added with --mount when the original session was started are not
+restored.
+
+Examples:
+  worklet describe abc123 --json > manifest.json
+  worklet recreate -f manifest.json          # Start an identical session
+  worklet recreate -f manifest.json --force  # Start it despite drift`,
+	Args: cobra.NoArgs,
+	RunE: runRecreate,
+}
+
+func init() {
+	recreateCmd.Flags().StringVarP(&recreateFile, "file", "f", "", "Manifest written by 'worklet describe --json'")
+	recreateCmd.Flags().BoolVar(&recreateForce, "force", false, "Recreate even if the inputs have drifted from the manifest")
+	recreateCmd.MarkFlagRequired("file")
+}
+
+func runRecreate(cmd *cobra.Command, args []string) error {
+	data, err := os.ReadFile(recreateFile)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest docker.Description
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	dir := manifest.WorkDir
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("project directory %s from the manifest no longer exists", dir)
+	}
+
+	cfg, err := config.LoadConfigOrDetect(dir, false)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	opts := docker.RunOptions{
+		WorkDir:     dir,
+		Config:      cfg,
+		MountMode:   manifest.Mode == docker.ModeMount,
+		ComposePath: getComposePath(dir, cfg),
+		CmdArgs:     manifest.Command,
+	}
+
+	if drift := docker.CheckDrift(&manifest, opts); len(drift) > 0 {
+		fmt.Fprintf(os.Stderr, "Inputs have drifted from %s:\n", recreateFile)
+		for _, d := range drift {
+			fmt.Fprintf(os.Stderr, "  - %s\n", d)
+		}
+		if !recreateForce {
+			return fmt.Errorf("refusing to recreate session %s from drifted inputs (use --force to recreate anyway)", manifest.SessionID)
+		}
+		fmt.Fprintln(os.Stderr, "Recreating anyway (--force)")
+	}
+
+	// Pin the base image to the digest it had. Locally built images have no
+	// digest and are used as tagged.
+	if manifest.BaseImageDigest != "" {
+		runImage = manifest.BaseImageDigest
+	} else if manifest.BaseImage != "" {
+		fmt.Fprintf(os.Stderr, "Warning: Base image %s has no registry digest; using it as tagged\n", manifest.BaseImage)
+	}
+	mountMode = opts.MountMode
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tr := trace.New()
+	ctx = trace.WithRecorder(ctx, tr)
+	if trace.Enabled() {
+		defer tr.PrintSummary(os.Stderr)
+	}
+
+	renderer := newProgressRenderer()
+	defer renderer.Close()
+
+	fmt.Printf("Recreating session %s of %s\n", manifest.SessionID, manifest.ProjectName)
+	return runInDirectoryWithCloned(ctx, dir, false, docker.ProgressFunc(renderer.Handle), manifest.Command...)
+}
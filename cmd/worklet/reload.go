@@ -0,0 +1,173 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var reloadDryRun bool
+
+var reloadCmd = &cobra.Command{
+	Use:   "reload <session-id>",
+	Short: "Apply config changes to a running session",
+	Long: `Re-read the project's worklet config and apply what changed to a running
+session, without restarting it.
+
+Applied in place:
+  - services: added, removed and changed services are routed by the proxy
+    straight away
+  - environment: variables added or changed in run.environment, and the
+    service URL variables, are set in shells and commands started in the
+    session from then on. Processes already running keep their environment.
+
+Anything else needs the session to be started again, and is listed: a
+changed run.initScript, removed environment variables and other settings
+such as the image, volumes or credentials. Sessions started by a worklet
+version without reload can only have their services and environment
+compared.
+
+Examples:
+  worklet reload abc123            # Apply changes to abc123
+  worklet reload abc123 --dry-run  # Only show what would change`,
+	Args: cobra.ExactArgs(1),
+	RunE: runReload,
+}
+
+func init() {
+	reloadCmd.Flags().BoolVar(&reloadDryRun, "dry-run", false, "Show what would change without applying it")
+}
+
+func runReload(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sessionID := args[0]
+	session, err := docker.GetSessionInfo(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(session.WorkDir); err != nil {
+		return fmt.Errorf("project directory %s of session %s no longer exists", session.WorkDir, sessionID)
+	}
+	cfg, err := config.LoadConfigOrDetect(session.WorkDir, false)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	plan, err := docker.PlanReload(ctx, session, cfg)
+	if err != nil {
+		return err
+	}
+
+	if !plan.InPlace() && len(plan.Restart) == 0 {
+		fmt.Printf("Session %s is up to date with %s\n", sessionID, session.WorkDir)
+		if plan.Incomplete {
+			fmt.Println("It was started by an older worklet, so only services and environment were compared.")
+		}
+		return nil
+	}
+
+	if plan.InPlace() {
+		if reloadDryRun {
+			fmt.Printf("Would apply to session %s:\n", sessionID)
+		} else {
+			fmt.Printf("Applying to session %s:\n", sessionID)
+		}
+		printReloadChanges(plan, cfg, sessionID)
+
+		if !reloadDryRun {
+			if plan.ServicesDiffer() {
+				if err := setSessionServices(ctx, sessionID, cfg); err != nil {
+					return err
+				}
+			}
+			if err := docker.SaveReloadState(sessionID, cfg); err != nil {
+				return fmt.Errorf("failed to save reloaded environment: %w", err)
+			}
+			fmt.Println("Reloaded.")
+		}
+	}
+
+	if len(plan.Restart) > 0 {
+		if plan.InPlace() {
+			fmt.Println()
+		}
+		fmt.Println("Needs the session to be started again:")
+		for _, change := range plan.Restart {
+			fmt.Printf("  - %s\n", change)
+		}
+		fmt.Println("Start a new session with 'worklet run' to apply them.")
+	}
+	if plan.Incomplete {
+		fmt.Println("\nSession was started by an older worklet, so its initScript and other settings couldn't be compared.")
+	}
+	return nil
+}
+
+// printReloadChanges lists what reload applies in place
+func printReloadChanges(plan *docker.ReloadPlan, cfg *config.WorkletConfig, sessionID string) {
+	projectName := cfg.Name
+	if projectName == "" {
+		projectName = "worklet"
+	}
+	services := make(map[string]config.ServiceConfig)
+	for _, svc := range cfg.Services {
+		services[svc.Name] = svc
+	}
+	describe := func(name string) string {
+		svc := services[name]
+		if svc.IsStream() {
+			return fmt.Sprintf("%s (%s port %d)", name, svc.Protocol, svc.Port)
+		}
+		subdomain := svc.Subdomain
+		if subdomain == "" {
+			subdomain = svc.Name
+		}
+		return fmt.Sprintf("%s → %s (port %d)", name, config.ServiceURL(subdomain, projectName, sessionID), svc.Port)
+	}
+
+	for _, name := range plan.ServicesAdded {
+		fmt.Printf("  + service %s\n", describe(name))
+	}
+	for _, name := range plan.ServicesChanged {
+		fmt.Printf("  ~ service %s\n", describe(name))
+	}
+	for _, name := range plan.ServicesRemoved {
+		fmt.Printf("  - service %s\n", name)
+	}
+	if len(plan.EnvChanged) > 0 {
+		fmt.Printf("  ~ environment %s (for new shells and commands)\n", strings.Join(plan.EnvChanged, ", "))
+	}
+}
+
+// setSessionServices has the daemon route the services cfg gives a session
+func setSessionServices(ctx context.Context, sessionID string, cfg *config.WorkletConfig) error {
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("daemon is not running. Start it with: worklet daemon start")
+	}
+	defer client.Close()
+
+	infos := make([]daemon.ServiceInfo, 0, len(cfg.Services))
+	for _, svc := range cfg.Services {
+		infos = append(infos, daemon.ServiceInfo{
+			Name:      svc.Name,
+			Port:      svc.Port,
+			Subdomain: svc.Subdomain,
+			Protocol:  svc.Protocol,
+			Host:      docker.ServiceHost(cfg, sessionID, svc),
+		})
+	}
+	if _, err := client.SetServices(ctx, sessionID, infos); err != nil {
+		return fmt.Errorf("failed to update services: %w", err)
+	}
+	return nil
+}
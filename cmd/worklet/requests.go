@@ -0,0 +1,442 @@
+package worklet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/nolanleung/worklet/internal/nginx"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	requestsService string
+	requestsMethod  string
+	requestsStatus  string
+	requestsTail    int
+	requestsPlain   bool
+)
+
+// requestsPollInterval is how often the activity log is checked for new
+// requests
+const requestsPollInterval = 500 * time.Millisecond
+
+// maxRequestRows is how many requests the viewer keeps
+const maxRequestRows = 1000
+
+var requestsCmd = &cobra.Command{
+	Use:   "requests <session-id>",
+	Short: "Watch the HTTP requests proxied to a session",
+	Long: `Stream the requests the proxy passes to a session's HTTP services, with
+their method, path, status, duration and service, as they happen.
+
+In a terminal the requests are shown in a live table:
+  /      filter by any text (method, status, service or path)
+  p      pause and resume
+  c      clear the table
+  q      quit
+
+Otherwise, or with --plain, one line is printed per request.
+
+Examples:
+  worklet requests 3                  # Watch every request to session 3
+  worklet requests 3 --status 5xx     # Only server errors
+  worklet requests 3 -s api --plain   # Requests to the api service, as lines`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRequests,
+}
+
+func init() {
+	requestsCmd.Flags().StringVarP(&requestsService, "service", "s", "", "Only show requests to this service")
+	requestsCmd.Flags().StringVarP(&requestsMethod, "method", "m", "", "Only show requests with this method")
+	requestsCmd.Flags().StringVar(&requestsStatus, "status", "", "Only show this status or class of statuses (e.g. 404, 5xx)")
+	requestsCmd.Flags().IntVarP(&requestsTail, "tail", "n", 50, "Number of earlier requests to show first")
+	requestsCmd.Flags().BoolVar(&requestsPlain, "plain", false, "Print a line per request instead of the live table")
+}
+
+func runRequests(cmd *cobra.Command, args []string) error {
+	filter := requestFilter{
+		sessionID: args[0],
+		service:   requestsService,
+		method:    strings.ToUpper(requestsMethod),
+		status:    strings.ToLower(requestsStatus),
+	}
+	if err := filter.validate(); err != nil {
+		return err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	tailer := &requestTailer{path: filepath.Join(homeDir, ".worklet", "nginx", nginx.ActivityLogFile)}
+
+	initial, err := tailer.start(filter, requestsTail)
+	if err != nil {
+		return err
+	}
+
+	if requestsPlain || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return streamRequests(cmd, tailer, filter, initial)
+	}
+
+	input := textinput.New()
+	input.Prompt = "/"
+	input.Placeholder = "filter"
+	m := requestsModel{
+		tailer:  tailer,
+		filter:  filter,
+		input:   input,
+		entries: initial,
+		table:   table.New(table.WithColumns(requestColumns(120)), table.WithFocused(true)),
+	}
+	m.table.SetStyles(requestTableStyles())
+	m.refreshRows()
+
+	_, err = tea.NewProgram(m, tea.WithAltScreen()).Run()
+	return err
+}
+
+// requestFilter selects the requests shown
+type requestFilter struct {
+	sessionID string
+	service   string
+	method    string
+	status    string // "404" or a class like "5xx"
+	text      string // Case-insensitive text typed in the viewer
+}
+
+func (f requestFilter) validate() error {
+	if f.status == "" {
+		return nil
+	}
+	if len(f.status) == 3 && f.status[0] >= '1' && f.status[0] <= '5' && f.status[1:] == "xx" {
+		return nil
+	}
+	if code, err := strconv.Atoi(f.status); err == nil && code >= 100 && code <= 599 {
+		return nil
+	}
+	return fmt.Errorf("invalid status %q (expected e.g. 404 or 5xx)", f.status)
+}
+
+// matches reports whether a request is shown
+func (f requestFilter) matches(entry nginx.AccessEntry) bool {
+	if entry.ForkID != f.sessionID {
+		return false
+	}
+	if f.service != "" && entry.Service != f.service {
+		return false
+	}
+	if f.method != "" && entry.Method != f.method {
+		return false
+	}
+	if f.status != "" {
+		status := strconv.Itoa(entry.Status)
+		if strings.HasSuffix(f.status, "xx") {
+			if status[:1] != f.status[:1] {
+				return false
+			}
+		} else if status != f.status {
+			return false
+		}
+	}
+	if f.text != "" {
+		haystack := strings.ToLower(fmt.Sprintf("%s %d %s %s", entry.Method, entry.Status, entry.Service, entry.URI))
+		if !strings.Contains(haystack, strings.ToLower(f.text)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestTailer follows the activity log, which the daemon truncates once it
+// grows large
+type requestTailer struct {
+	path   string
+	offset int64
+}
+
+// start returns the last n requests already logged that match the filter,
+// and positions the tailer at the end of the log
+func (t *requestTailer) start(filter requestFilter, n int) ([]nginx.AccessEntry, error) {
+	entries, err := t.read()
+	if err != nil {
+		return nil, err
+	}
+	var matched []nginx.AccessEntry
+	for _, entry := range entries {
+		if filter.matches(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	if n >= 0 && len(matched) > n {
+		matched = matched[len(matched)-n:]
+	}
+	return matched, nil
+}
+
+// read returns the requests logged since the last read
+func (t *requestTailer) read() ([]nginx.AccessEntry, error) {
+	file, err := os.Open(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open request log: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request log: %w", err)
+	}
+	if info.Size() < t.offset {
+		// Truncated by the daemon
+		t.offset = 0
+	}
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read request log: %w", err)
+	}
+
+	var entries []nginx.AccessEntry
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave a partially written line for the next read
+			break
+		}
+		t.offset += int64(len(line))
+		if entry, ok := nginx.ParseAccessLine(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// streamRequests prints a line per request until interrupted
+func streamRequests(cmd *cobra.Command, tailer *requestTailer, filter requestFilter, initial []nginx.AccessEntry) error {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, entry := range initial {
+		fmt.Println(formatRequestLine(entry))
+	}
+
+	ticker := time.NewTicker(requestsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			entries, err := tailer.read()
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if filter.matches(entry) {
+					fmt.Println(formatRequestLine(entry))
+				}
+			}
+		}
+	}
+}
+
+// formatRequestLine formats a request as a single line
+func formatRequestLine(entry nginx.AccessEntry) string {
+	return fmt.Sprintf("%s  %-10s %-7s %3d %8s  %s",
+		entry.Time.Local().Format("15:04:05.000"), entry.Service, entry.Method, entry.Status,
+		formatRequestDuration(entry.Duration), entry.URI)
+}
+
+// formatRequestDuration formats a request's duration in milliseconds or
+// seconds
+func formatRequestDuration(d time.Duration) string {
+	if d < time.Second {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	}
+	return fmt.Sprintf("%.2fs", d.Seconds())
+}
+
+// requestsTickMsg triggers a read of new requests
+type requestsTickMsg struct{}
+
+// requestsModel is the live request table
+type requestsModel struct {
+	tailer  *requestTailer
+	filter  requestFilter
+	input   textinput.Model
+	table   table.Model
+	entries []nginx.AccessEntry // Every request read, newest last
+	paused  bool
+	err     error
+	width   int
+	height  int
+}
+
+// Init implements tea.Model.
+func (m requestsModel) Init() tea.Cmd {
+	return requestsTick()
+}
+
+func requestsTick() tea.Cmd {
+	return tea.Tick(requestsPollInterval, func(time.Time) tea.Msg { return requestsTickMsg{} })
+}
+
+// Update implements tea.Model.
+func (m requestsModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.table.SetColumns(requestColumns(msg.Width))
+		m.table.SetHeight(max(3, msg.Height-5))
+		m.refreshRows()
+		return m, nil
+
+	case requestsTickMsg:
+		if !m.paused {
+			entries, err := m.tailer.read()
+			m.err = err
+			if len(entries) > 0 {
+				following := m.table.Cursor() >= len(m.table.Rows())-1
+				m.entries = append(m.entries, entries...)
+				if len(m.entries) > maxRequestRows {
+					m.entries = m.entries[len(m.entries)-maxRequestRows:]
+				}
+				m.refreshRows()
+				if following {
+					m.table.GotoBottom()
+				}
+			}
+		}
+		return m, requestsTick()
+
+	case tea.KeyMsg:
+		if m.input.Focused() {
+			switch msg.String() {
+			case "enter", "esc":
+				if msg.String() == "esc" {
+					m.input.SetValue("")
+				}
+				m.input.Blur()
+				m.table.Focus()
+			default:
+				var cmd tea.Cmd
+				m.input, cmd = m.input.Update(msg)
+				m.refreshRows()
+				return m, cmd
+			}
+			m.refreshRows()
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "/":
+			m.table.Blur()
+			return m, m.input.Focus()
+		case "p", " ":
+			m.paused = !m.paused
+			return m, nil
+		case "c":
+			m.entries = nil
+			m.refreshRows()
+			return m, nil
+		}
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// refreshRows rebuilds the table from the requests that match the filter
+func (m *requestsModel) refreshRows() {
+	filter := m.filter
+	filter.text = m.input.Value()
+
+	rows := []table.Row{}
+	for _, entry := range m.entries {
+		if !filter.matches(entry) {
+			continue
+		}
+		rows = append(rows, table.Row{
+			entry.Time.Local().Format("15:04:05.000"),
+			entry.Service,
+			entry.Method,
+			strconv.Itoa(entry.Status),
+			formatRequestDuration(entry.Duration),
+			entry.URI,
+		})
+	}
+	m.table.SetRows(rows)
+	if m.table.Cursor() >= len(rows) || m.table.Cursor() < 0 {
+		m.table.GotoBottom()
+	}
+}
+
+// View implements tea.Model.
+func (m requestsModel) View() string {
+	status := fmt.Sprintf("Session %s · %d requests", m.filter.sessionID, len(m.table.Rows()))
+	if m.paused {
+		status += " · paused"
+	}
+	if m.err != nil {
+		status += " · " + m.err.Error()
+	}
+
+	filterLine := m.input.View()
+	if !m.input.Focused() && m.input.Value() == "" {
+		filterLine = helpStyle.Render("/ filter · p pause · c clear · q quit")
+	}
+
+	return baseStyle.Render(m.table.View()) + "\n" + status + "\n" + filterLine
+}
+
+// helpStyle renders key hints
+var helpStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+// requestColumns sizes the table's columns to the terminal width, giving the
+// rest to the path
+func requestColumns(width int) []table.Column {
+	columns := []table.Column{
+		{Title: "Time", Width: 12},
+		{Title: "Service", Width: 12},
+		{Title: "Method", Width: 7},
+		{Title: "Status", Width: 6},
+		{Title: "Duration", Width: 9},
+	}
+	used := 0
+	for _, column := range columns {
+		used += column.Width + 2
+	}
+	return append(columns, table.Column{Title: "Path", Width: max(20, width-used-4)})
+}
+
+func requestTableStyles() table.Styles {
+	s := table.DefaultStyles()
+	s.Header = s.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(lipgloss.Color("240")).
+		BorderBottom(true).
+		Bold(false)
+	s.Selected = s.Selected.
+		Background(lipgloss.Color("#ffaa00ff")).
+		Foreground(lipgloss.Color("0")).
+		Bold(false)
+	return s
+}
@@ -0,0 +1,169 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/projects"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	rerunList  bool
+	rerunIndex int
+)
+
+var rerunCmd = &cobra.Command{
+	Use:   "rerun [project]",
+	Short: "Repeat a project's last worklet run",
+	Long: `Run a project again with the same command and flags as its last
+'worklet run', from the directory it was started in. The project is given
+by name or path; without one, the project in the current directory is
+used, or else the most recently run project.
+
+Each project keeps its last 10 runs. Use --list to show them and -n to
+repeat an earlier one.
+
+Examples:
+  worklet rerun               # Repeat the last run here, or of the last project
+  worklet rerun shop          # Repeat the last run of the shop project
+  worklet rerun shop --list   # Show shop's recent runs
+  worklet rerun shop -n 3     # Repeat the third most recent run`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manager, err := projects.NewManager()
+		if err != nil {
+			return fmt.Errorf("failed to initialize project manager: %w", err)
+		}
+
+		project, err := rerunProject(manager, args)
+		if err != nil {
+			return err
+		}
+
+		if rerunList {
+			fmt.Printf("Recent runs of %s:\n", project.DisplayName())
+			for i, run := range project.Runs {
+				fmt.Printf("%3d. %s  worklet %s\n", i+1, formatTime(run.Time), shellJoin(run.Command()))
+			}
+			return nil
+		}
+
+		if rerunIndex < 1 || rerunIndex > len(project.Runs) {
+			return fmt.Errorf("%s has %d recorded runs; -n must be between 1 and %d", project.DisplayName(), len(project.Runs), len(project.Runs))
+		}
+		return repeatRun(cmd.Context(), *project, project.Runs[rerunIndex-1])
+	},
+}
+
+func init() {
+	rerunCmd.Flags().BoolVar(&rerunList, "list", false, "List the project's recent runs instead of running one")
+	rerunCmd.Flags().IntVarP(&rerunIndex, "number", "n", 1, "Repeat the nth most recent run")
+}
+
+// rerunProject returns the named project, or the one to rerun by default
+func rerunProject(manager *projects.Manager, args []string) (*projects.Project, error) {
+	if len(args) > 0 {
+		project, err := manager.Find(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(project.Runs) == 0 {
+			return nil, fmt.Errorf("no recorded runs of %s; start one with 'worklet run'", project.DisplayName())
+		}
+		return project, nil
+	}
+
+	if cwd, err := os.Getwd(); err == nil {
+		if project, err := manager.GetProject(cwd); err == nil && len(project.Runs) > 0 {
+			return project, nil
+		}
+	}
+	for _, project := range manager.List() {
+		if len(project.Runs) > 0 {
+			return &project, nil
+		}
+	}
+	return nil, fmt.Errorf("no recorded runs; start one with 'worklet run'")
+}
+
+// repeatRun runs worklet again with a recorded run's arguments, in the
+// directory it was started in
+func repeatRun(ctx context.Context, project projects.Project, run projects.RunRecord) error {
+	dir := run.Dir
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = project.Path
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("neither %s nor %s exists anymore", run.Dir, project.Path)
+		}
+	}
+
+	fmt.Printf("Running in %s: worklet %s\n", dir, shellJoin(run.Command()))
+	return runWorklet(ctx, dir, run.Command())
+}
+
+// runWorklet runs worklet with args in dir, attached to the terminal
+func runWorklet(ctx context.Context, dir string, args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate worklet executable: %w", err)
+	}
+
+	c := exec.CommandContext(ctx, executable, args...)
+	c.Dir = dir
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("worklet run failed: %w", err)
+	}
+	return nil
+}
+
+// runFlagArgs returns the flags given to a command as --name=value
+// arguments that set them again
+func runFlagArgs(cmd *cobra.Command) []string {
+	var args []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		switch value := f.Value.(type) {
+		case *mountFlag:
+			// Extra mount sources are already absolute
+			if !*value.enabled {
+				args = append(args, "--mount=false")
+			} else if len(*value.mounts) == 0 {
+				args = append(args, "--mount")
+			}
+			for _, mount := range *value.mounts {
+				spec := mount.Source + ":" + mount.Target
+				if mount.ReadOnly {
+					spec += ":ro"
+				}
+				args = append(args, "--mount="+spec)
+			}
+		case pflag.SliceValue:
+			for _, item := range value.GetSlice() {
+				args = append(args, "--"+f.Name+"="+item)
+			}
+		default:
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// shellJoin quotes args for display as a shell command
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]#~!{}") {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
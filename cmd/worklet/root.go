@@ -1,12 +1,14 @@
 package worklet
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/nolanleung/worklet/internal/projects"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"golang.org/x/term"
 )
 
@@ -14,6 +16,10 @@ var rootCmd = &cobra.Command{
 	Use:   "worklet",
 	Short: "A CLI tool for running projects in Docker containers",
 	Long:  `Worklet helps you run projects in Docker containers with Docker-in-Docker support.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		applyColorFlag()
+		startTelemetry(cmd, args)
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Check if we're in an interactive terminal
 		if !isInteractiveTerminal() {
@@ -26,14 +32,72 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
+	started := time.Now()
+	cmd, err := rootCmd.ExecuteC()
+	stopTelemetry(err)
+	recordUsage(cmd, err, time.Since(started))
+	var exitErr exitCodeError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.code)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// exitCodeError makes worklet exit with a given code, for commands whose exit
+// status carries a result. It has already been reported.
+type exitCodeError struct {
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// silentExit returns an error that makes worklet exit with code without
+// cobra printing it or the usage
+func silentExit(cmd *cobra.Command, code int) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return exitCodeError{code: code}
+}
+
+// ExecuteArgs runs the CLI in-process with args, returning the command's
+// error instead of exiting. Flags are reset to their defaults first, so
+// values from an earlier run don't carry over.
+func ExecuteArgs(args []string) error {
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	defer rootCmd.SetArgs(nil)
+
+	_, err := rootCmd.ExecuteC()
+	return err
+}
+
+// resetFlags sets the flags of cmd and its subcommands back to their defaults
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
 func init() {
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output and hyperlinks (also NO_COLOR)")
+
 	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(newCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(linkCmd)
 	rootCmd.AddCommand(terminalCmd)
@@ -45,6 +109,33 @@ func init() {
 	rootCmd.AddCommand(codeCmd)
 	rootCmd.AddCommand(cleanupCmd)
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.AddCommand(cacheCmd)
+	rootCmd.AddCommand(prCmd)
+	rootCmd.AddCommand(noteCmd)
+	rootCmd.AddCommand(psCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(describeCmd)
+	rootCmd.AddCommand(recreateCmd)
+	rootCmd.AddCommand(stopCmd)
+	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(restartCmd)
+	rootCmd.AddCommand(tapCmd)
+	rootCmd.AddCommand(routeCmd)
+	rootCmd.AddCommand(chaosCmd)
+	rootCmd.AddCommand(requestsCmd)
+	rootCmd.AddCommand(telemetryCmd)
+	rootCmd.AddCommand(supportBundleCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(envCmd)
+	rootCmd.AddCommand(trustCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(rerunCmd)
+	rootCmd.AddCommand(jumpCmd)
+	rootCmd.AddCommand(waitCmd)
+	rootCmd.AddCommand(reloadCmd)
+	rootCmd.AddCommand(deploySwapCmd)
+	rootCmd.AddCommand(prefetchCmd)
+	rootCmd.AddCommand(doctorCmd)
 }
 
 // isInteractiveTerminal checks if we're running in an interactive terminal
@@ -81,10 +172,19 @@ func showNonInteractiveProjectList() error {
 	fmt.Println("Worklet Projects:")
 	fmt.Println()
 
+	// Favorites first, then by group
+	projectList = nil
+	for _, section := range projects.Sections(manager.List()) {
+		projectList = append(projectList, section.Projects...)
+	}
+
 	for i, p := range projectList {
-		name := p.Name
-		if name == "" {
-			name = filepath.Base(p.Path)
+		name := p.DisplayName()
+		if p.Favorite {
+			name += " ★"
+		}
+		if p.Group != "" {
+			name += fmt.Sprintf(" [%s]", p.Group)
 		}
 		fmt.Printf("%d. %s\n   %s\n", i+1, name, p.Path)
 		if i >= 9 {
@@ -0,0 +1,199 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/routes"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	routeFile        string
+	routeTarget      string
+	routeService     string
+	routeContentType string
+)
+
+var routeCmd = &cobra.Command{
+	Use:   "route",
+	Short: "Override paths of a session's services",
+	Long: `Answer paths of a session's HTTP services with a fixture file, or send
+them to a different session, instead of the session's own server. Handy for
+working on a frontend while its backend is broken, or for pinning a feature
+flag response.
+
+A path is matched exactly, or as a prefix when it ends in "*". Routes apply
+to every HTTP service of the session unless --service is given, and last
+until they are removed or the session is cleaned up.
+
+Examples:
+  worklet route add 3 /api/flags --file flags.json  # Serve a fixture
+  worklet route add 3 '/api/*' --to 5               # Use session 5's backend
+  worklet route add 3 '/api/*' --to 5/api           # ...its api service
+  worklet route ls 3
+  worklet route rm 3 /api/flags`,
+}
+
+var routeAddCmd = &cobra.Command{
+	Use:   "add <session-id> <path> (--file <fixture> | --to <session-id>[/<service>])",
+	Short: "Add a route override to a session",
+	Long: `Add a route override to a session, replacing any override of the same
+path. The fixture file is read again whenever the proxy config is
+regenerated; run 'worklet refresh' to pick up changes to it.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID, path := args[0], args[1]
+
+		route := routes.Route{
+			Path:    path,
+			Service: routeService,
+			Target:  routeTarget,
+		}
+		if routeFile != "" {
+			file, err := filepath.Abs(routeFile)
+			if err != nil {
+				return fmt.Errorf("failed to resolve %s: %w", routeFile, err)
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				return fmt.Errorf("failed to read fixture: %w", err)
+			}
+			if info.IsDir() {
+				return fmt.Errorf("fixture %s is a directory", routeFile)
+			}
+			route.File = file
+			route.ContentType = routeContentType
+			if route.ContentType == "" {
+				route.ContentType = fixtureContentType(file)
+			}
+		}
+		if route.Target != "" {
+			if targetID, _ := route.TargetSession(); targetID == sessionID {
+				return fmt.Errorf("a route can't send session %s to itself", sessionID)
+			}
+		}
+
+		store, err := routes.New()
+		if err != nil {
+			return err
+		}
+		if err := store.Add(sessionID, route); err != nil {
+			return err
+		}
+
+		fmt.Printf("Added route %s → %s for session %s\n", route.Path, route.Describe(), sessionID)
+		applyRoutes(sessionID)
+		return nil
+	},
+}
+
+var routeListCmd = &cobra.Command{
+	Use:     "ls <session-id>",
+	Aliases: []string{"list"},
+	Short:   "List a session's route overrides",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		store, err := routes.New()
+		if err != nil {
+			return err
+		}
+		sessionRoutes, err := store.Get(sessionID)
+		if err != nil {
+			return err
+		}
+		if len(sessionRoutes) == 0 {
+			fmt.Printf("Session %s has no route overrides\n", sessionID)
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PATH\tSERVICE\tANSWERED BY\tADDED")
+		for _, route := range sessionRoutes {
+			service := route.Service
+			if service == "" {
+				service = "(all)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", route.Path, service, route.Describe(), formatTime(route.CreatedAt))
+		}
+		return w.Flush()
+	},
+}
+
+var routeRemoveCmd = &cobra.Command{
+	Use:     "rm <session-id> <path>",
+	Aliases: []string{"remove"},
+	Short:   "Remove a route override from a session",
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID, path := args[0], args[1]
+
+		store, err := routes.New()
+		if err != nil {
+			return err
+		}
+		removed, err := store.Remove(sessionID, path, routeService)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("session %s has no route for %s", sessionID, path)
+		}
+
+		fmt.Printf("Removed route %s from session %s\n", path, sessionID)
+		applyRoutes(sessionID)
+		return nil
+	},
+}
+
+func init() {
+	routeAddCmd.Flags().StringVar(&routeFile, "file", "", "Fixture file to answer the path with")
+	routeAddCmd.Flags().StringVar(&routeTarget, "to", "", "Session, or session/service, to proxy the path to")
+	routeAddCmd.Flags().StringVarP(&routeService, "service", "s", "", "Only override this service")
+	routeAddCmd.Flags().StringVar(&routeContentType, "content-type", "", "Content type of the fixture (default: from its extension)")
+	routeAddCmd.MarkFlagsMutuallyExclusive("file", "to")
+	routeAddCmd.MarkFlagsOneRequired("file", "to")
+	routeRemoveCmd.Flags().StringVarP(&routeService, "service", "s", "", "Service the route was added for")
+
+	routeCmd.AddCommand(routeAddCmd)
+	routeCmd.AddCommand(routeListCmd)
+	routeCmd.AddCommand(routeRemoveCmd)
+}
+
+// fixtureContentType guesses a fixture's content type from its extension
+func fixtureContentType(file string) string {
+	contentType := mime.TypeByExtension(filepath.Ext(file))
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+// applyRoutes has a running daemon regenerate the proxy config with the
+// session's routes
+func applyRoutes(sessionID string) {
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		fmt.Println("The daemon isn't running; routes apply once it starts")
+		return
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.RefreshFork(ctx, sessionID); err != nil {
+		if daemon.IsNotFound(err) {
+			fmt.Printf("Session %s isn't running; routes apply once it starts\n", sessionID)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "Warning: Failed to update the proxy: %v\n", err)
+	}
+}
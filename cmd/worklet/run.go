@@ -2,40 +2,88 @@ package worklet
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"maps"
 	"net"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport"
-	"github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/google/uuid"
 	"github.com/nolanleung/worklet/internal/config"
 	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/gitauth"
+	"github.com/nolanleung/worklet/internal/gitcache"
 	"github.com/nolanleung/worklet/internal/projects"
+	"github.com/nolanleung/worklet/internal/trace"
 	"github.com/nolanleung/worklet/pkg/daemon"
 	"github.com/nolanleung/worklet/pkg/terminal"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
 	mountMode       bool
+	extraMounts     []config.MountConfig
 	tempMode        bool
 	withTerminal    bool
 	noTerminal      bool
 	openTerminal    bool
 	runTerminalPort int
 	linkClaude      bool
+	runDryRun       bool
+	noGitCache      bool
+	worktreeBranch  string
+	partialClone    bool
+	sparsePaths     []string
+	cloneSubmodules bool
+	maxRepoSizeMB   int64
+	cloneTimeout    time.Duration
+	runEphemeral    bool
+	runInteractive  bool
+	runSessionID    string
+	credentialsTTL  time.Duration
+	ignoreResources bool
+	runTimeReport   bool
+	runNoWait       bool
+	runDisplay      bool
+	runBrowsers     bool
+	runTimezone     string
+	runFaketime     string
+
+	// startupReport times the run when --time-report is given
+	startupReport *timeReport
+
+	// runImage overrides run.image; set by recreate to pin a digest
+	runImage string
+
+	// runWorkDirIsTemporary is set when the run's directory is a clone that
+	// is removed afterwards
+	runWorkDirIsTemporary bool
+
+	// runRepoURL is the repository URL when the run's directory is a clone,
+	// whose grants the user must trust
+	runRepoURL string
+	runTrust   bool
+
+	// runInvocation is the flags and arguments of the current worklet run,
+	// recorded in the project's history for worklet rerun
+	runInvocation projects.RunRecord
 )
 
 var runCmd = &cobra.Command{
@@ -47,9 +95,12 @@ All worklet sessions run in the background (detached mode). You can access runni
 
 By default, worklet run creates a persistent isolated environment. Use --mount to run directly in the current directory, or --temp to create a temporary environment that auto-cleans up.
 
+With --rm, the command runs in the foreground instead, like docker run --rm: its output is attached (and its input with -i), and the container, network, image and volumes are removed when it exits. worklet exits with the command's exit code. Such runs aren't registered with the daemon or the proxy.
+
 Examples:
   worklet run                                       # Run in persistent isolated environment
   worklet run --mount                               # Run with current directory mounted
+  worklet run --mount=../shared-lib:/libs/shared:ro # Also mount another directory read-only
   worklet run --temp                                # Run in temporary environment
   worklet run echo "hello"                          # Run echo command
   worklet run python app.py                         # Run Python script
@@ -58,13 +109,49 @@ Examples:
   worklet run github.com/user/repo                  # Clone and run (shortened format)
   worklet run git@github.com:user/repo.git          # Clone and run (SSH format)
   worklet run github.com/user/repo#branch           # Clone specific branch
-  worklet run github.com/user/repo@abc123def        # Clone specific commit`,
+  worklet run github.com/user/repo@abc123def        # Clone specific commit
+  worklet run github.com/org/monorepo --path services/api --partial  # Sparse, blob-less clone
+  worklet run --worktree feature-x                  # Run a git worktree of the current repo on branch feature-x
+  worklet run --dry-run                             # Show what would be run without starting it
+  worklet run --rm npm test                         # Run the tests in the foreground, then clean up
+  worklet run --rm -it                              # Throwaway interactive shell`,
 	Args: cobra.ArbitraryArgs,
-	RunE: func(cmd *cobra.Command, args []string) error {
+	RunE: withOutput(func(cmd *cobra.Command, args []string) error {
+		// Remember the invocation so it can be repeated with worklet rerun
+		runInvocation = projects.RunRecord{Flags: runFlagArgs(cmd), Args: args}
+		runInvocation.Dir, _ = os.Getwd()
+
 		// Handle conflicting flags
 		if withTerminal && noTerminal {
 			withTerminal = false
 		}
+		if runTimeReport && runEphemeral {
+			return fmt.Errorf("--time-report can't be used with --rm, which runs in the foreground until its command exits")
+		}
+		if runInteractive && !runEphemeral {
+			return fmt.Errorf("--interactive needs --rm; detached sessions are reached with worklet jump or docker exec")
+		}
+
+		// Cancel the run on Ctrl+C so partially created resources are rolled back
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// Trace the run so slow phases can be identified
+		tr := trace.New()
+		ctx = trace.WithRecorder(ctx, tr)
+		if trace.Enabled() || console.Verbose() {
+			defer tr.PrintSummary(os.Stderr)
+		}
+
+		renderer := newProgressRenderer()
+		defer renderer.Close()
+		defer renderer.Attach()()
+		progress := docker.ProgressFunc(renderer.Handle)
+		startupReport = nil
+		if runTimeReport {
+			startupReport = newTimeReport()
+			progress = startupReport.observe(progress)
+		}
 
 		var workDir string
 		var cmdArgs []string
@@ -73,6 +160,10 @@ Examples:
 
 		// Check if first argument is a git URL
 		if len(args) > 0 && isGitURL(args[0]) {
+			if worktreeBranch != "" {
+				return fmt.Errorf("--worktree can only be used with a local repository")
+			}
+
 			// Parse the URL and any reference
 			parsed := parseGitURLWithRef(args[0])
 
@@ -85,17 +176,42 @@ Examples:
 				return fmt.Errorf("failed to create temporary directory: %w", err)
 			}
 
+			// Check the repository's size before downloading it
+			maxSize, err := confirmRepoSize(ctx, parsed.URL, maxRepoSizeMB<<20)
+			if err != nil {
+				cleanupTempDirectory(tempDir)
+				return err
+			}
+
+			cloneCtx, cancelClone := ctx, context.CancelFunc(func() {})
+			if cloneTimeout > 0 {
+				cloneCtx, cancelClone = context.WithTimeout(ctx, cloneTimeout)
+			}
+
 			// Clone the repository with optional reference
-			if err := cloneRepository(parsed.URL, tempDir, parsed.Ref); err != nil {
+			endClone := tr.Start("clone")
+			progress.Start(docker.PhaseClone, parsed.URL)
+			err = cloneRepository(cloneCtx, parsed.URL, tempDir, parsed.Ref, cloneSettings{
+				Partial:     partialClone,
+				SparsePaths: cleanSparsePaths(sparsePaths),
+				Submodules:  cloneSubmodules,
+				MaxSize:     maxSize,
+			}, progress)
+			cancelClone()
+			endClone()
+			if err != nil {
+				progress.Fail(docker.PhaseClone, err)
 				// Clean up on failure
 				cleanupTempDirectory(tempDir)
 				return fmt.Errorf("failed to clone repository: %w", err)
 			}
+			progress.Done(docker.PhaseClone, describeClone(tempDir))
 
 			workDir = tempDir
 			cmdArgs = args[1:] // Remove the URL from command args
 			isClonedRepo = true
-			shouldCleanup = tempMode || !mountMode // Clean up unless explicitly mounting
+			runRepoURL = parsed.URL
+			shouldCleanup = tempMode || !mountMode || runDryRun // Clean up unless explicitly mounting
 
 			// Config detection will happen automatically in RunInDirectory
 		} else {
@@ -106,11 +222,26 @@ Examples:
 				return fmt.Errorf("failed to get current directory: %w", err)
 			}
 			cmdArgs = args
+
+			if worktreeBranch != "" && runDryRun {
+				console.Printf("Would create or reuse a git worktree for branch %s\n\n", worktreeBranch)
+			} else if worktreeBranch != "" {
+				workDir, err = ensureWorktree(workDir, worktreeBranch, console.Writer())
+				if err != nil {
+					return err
+				}
+				// Run the worktree in place so commits land in the main repository
+				mountMode = true
+			}
 		}
 
-		// Set up cleanup for cloned repositories
-		if isClonedRepo && shouldCleanup {
+		// Set up cleanup for cloned repositories, always cleaning up if the
+		// run was interrupted
+		if isClonedRepo {
 			defer func() {
+				if !shouldCleanup && ctx.Err() == nil {
+					return
+				}
 				if err := cleanupTempDirectory(workDir); err != nil {
 					log.Printf("Warning: Failed to clean up temporary directory: %v", err)
 				}
@@ -119,33 +250,63 @@ Examples:
 
 		// If mount mode is explicitly set for a cloned repo, inform the user
 		if mountMode && isClonedRepo {
-			fmt.Printf("Repository cloned to: %s\n", workDir)
-			fmt.Println("Note: Using --mount with a git URL will preserve the cloned directory")
+			console.Printf("Repository cloned to: %s\n", workDir)
+			console.Println("Note: Using --mount with a git URL will preserve the cloned directory")
 		}
 
 		// Run in the determined directory with cloned repo flag
-		return runInDirectoryWithClonedFlag(workDir, isClonedRepo && linkClaude, cmdArgs...)
-	},
+		runWorkDirIsTemporary = isClonedRepo && shouldCleanup
+		err := runInDirectoryWithClonedFlag(ctx, workDir, isClonedRepo && linkClaude, progress, cmdArgs...)
+
+		// An ephemeral run exits with its command's exit code
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			return silentExit(cmd, exitErr.code)
+		}
+		return err
+	}),
 }
 
 func init() {
-	runCmd.Flags().BoolVar(&mountMode, "mount", false, "Mount current directory instead of creating isolated environment")
+	mount := runCmd.Flags().VarPF(&mountFlag{enabled: &mountMode, mounts: &extraMounts}, "mount", "", "Mount current directory instead of creating isolated environment; --mount=source[:target][:ro] also mounts another host directory (repeatable)")
+	mount.NoOptDefVal = "true"
 	runCmd.Flags().BoolVar(&tempMode, "temp", false, "Create temporary environment that auto-cleans up")
 	runCmd.Flags().BoolVarP(&withTerminal, "with-terminal", "t", true, "Start terminal server for web-based container access")
 	runCmd.Flags().BoolVar(&noTerminal, "no-terminal", false, "Disable terminal server")
 	runCmd.Flags().BoolVar(&openTerminal, "open-terminal", false, "Open terminal in browser automatically")
 	runCmd.Flags().IntVar(&runTerminalPort, "terminal-port", 8181, "Port for terminal server (default: 8181)")
 	runCmd.Flags().BoolVar(&linkClaude, "link-claude", true, "Automatically link Claude credentials for cloned repositories")
+	runCmd.Flags().DurationVar(&credentialsTTL, "credentials-ttl", 0, "Revoke the session's Claude and SSH credentials after this long, e.g. 2h (overrides run.credentials.ttl)")
+	runCmd.Flags().BoolVar(&runTrust, "trust", false, "Allow a cloned repository's credentials, privileged mode and host mounts without asking, and remember it")
+	runCmd.Flags().BoolVar(&runDryRun, "dry-run", false, "Print the resolved config and docker run plan without starting anything")
+	runCmd.Flags().StringVar(&worktreeBranch, "worktree", "", "Run against a git worktree of the current repository with this branch checked out")
+	runCmd.Flags().BoolVar(&noGitCache, "no-git-cache", false, "Clone directly from the remote instead of through ~/.worklet/git-cache")
+	runCmd.Flags().BoolVar(&partialClone, "partial", false, "Partial clone (--filter=blob:none), fetching file contents on demand")
+	runCmd.Flags().StringSliceVar(&sparsePaths, "path", nil, "Only check out these paths of a cloned repository (repeatable)")
+	runCmd.Flags().Int64Var(&maxRepoSizeMB, "max-repo-size", 2048, "Abort cloning repositories larger than this many MB (0 for no limit)")
+	runCmd.Flags().DurationVar(&cloneTimeout, "clone-timeout", 15*time.Minute, "Give up on a clone that takes longer than this (0 for no timeout)")
+	runCmd.Flags().BoolVar(&cloneSubmodules, "submodules", true, "Initialize submodules of cloned repositories recursively")
+	runCmd.Flags().BoolVar(&runEphemeral, "rm", false, "Run in the foreground and remove the container and its resources when it exits")
+	runCmd.Flags().StringVar(&runSessionID, "id", "", "Use this session ID instead of allocating one")
+	runCmd.Flags().BoolVar(&runNoWait, "no-wait", false, "Return once the container is created instead of waiting up to 2 minutes for its init scripts")
+	runCmd.Flags().BoolVar(&runTimeReport, "time-report", false, "Print where startup time went, compared with the project's earlier runs")
+	runCmd.Flags().BoolVar(&ignoreResources, "ignore-resources", false, "Start the session even if the Docker host doesn't seem to have the memory or disk it needs")
+	runCmd.Flags().BoolVar(&runDisplay, "display", false, "Forward the display so GUI apps in the session can open windows (run.display \"auto\")")
+	runCmd.Flags().BoolVar(&runBrowsers, "browsers", false, "Install Chromium for end-to-end tests and serve its DevTools and VNC endpoints (run.browsers true)")
+	runCmd.Flags().StringVar(&runTimezone, "timezone", "", "Run the session in this timezone, e.g. Asia/Tokyo, or \"host\" (run.timezone)")
+	runCmd.Flags().StringVar(&runFaketime, "faketime", "", "Shift the session's clock with libfaketime, e.g. +30d or \"@2024-02-29 12:00:00\" (run.faketime)")
+	runCmd.Flags().BoolVarP(&runInteractive, "interactive", "i", false, "Attach stdin to an ephemeral run (--rm), with a terminal if stdin is one")
+	addOutputFlags(runCmd)
 }
 
 // RunInDirectory runs worklet in the specified directory (always detached)
 func RunInDirectory(dir string, cmdArgs ...string) error {
-	return runInDirectoryWithCloned(dir, false, cmdArgs...)
+	return runInDirectoryWithCloned(context.Background(), dir, false, nil, cmdArgs...)
 }
 
 // runInDirectoryWithClonedFlag runs worklet with cloned repo flag (always detached)
-func runInDirectoryWithClonedFlag(dir string, isClonedRepo bool, cmdArgs ...string) error {
-	return runInDirectoryWithCloned(dir, isClonedRepo, cmdArgs...)
+func runInDirectoryWithClonedFlag(ctx context.Context, dir string, isClonedRepo bool, progress docker.ProgressFunc, cmdArgs ...string) error {
+	return runInDirectoryWithCloned(ctx, dir, isClonedRepo, progress, cmdArgs...)
 }
 
 // AttachToContainer executes an interactive shell in an existing container for a session
@@ -165,7 +326,13 @@ func AttachToContainer(sessionID string) error {
 	containerName := strings.TrimPrefix(strings.TrimSpace(string(nameOutput)), "/")
 
 	// Execute an interactive shell using docker exec
-	cmd := exec.Command("docker", "exec", "-it", containerID, "/bin/sh")
+	term := os.Getenv("TERM")
+	if term == "" {
+		term = "xterm-256color"
+	}
+	execArgs := append([]string{"exec", "-it", "-e", "TERM=" + term}, docker.ExecEnvArgs(sessionID)...)
+	execArgs = append(execArgs, docker.ExecUserArgs(containerID)...)
+	cmd := exec.Command("docker", append(append(execArgs, containerID), docker.ShellCommand()...)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -180,32 +347,97 @@ func AttachToContainer(sessionID string) error {
 }
 
 // runInDirectoryWithCloned runs worklet with cloned repo flag (always detached)
-func runInDirectoryWithCloned(dir string, isClonedRepo bool, cmdArgs ...string) error {
+func runInDirectoryWithCloned(ctx context.Context, dir string, isClonedRepo bool, progress docker.ProgressFunc, cmdArgs ...string) error {
+	tr := trace.FromContext(ctx)
+
 	// Load config or detect project type
-	cfg, err := config.LoadConfigOrDetect(dir, isClonedRepo)
+	endConfig := tr.Start("config")
+	var cfg *config.WorkletConfig
+	var err error
+	switch {
+	case runRepoURL != "" && runDryRun:
+		// Base configs from outside a cloned repository aren't read until
+		// it's trusted, which a dry run doesn't ask
+		var extends string
+		cfg, extends, err = config.LoadConfigLocalOrDetect(dir, isClonedRepo)
+		if err == nil && extends != "" {
+			fmt.Fprintf(os.Stderr, "Note: not reading base config %s until %s is trusted\n", extends, runRepoURL)
+		}
+	case runRepoURL != "":
+		// A cloned repository must be trusted with what its config grants
+		cfg, err = loadTrustedRepoConfig(runRepoURL, dir, isClonedRepo)
+		if err != nil {
+			endConfig()
+			return err
+		}
+	default:
+		cfg, err = config.LoadConfigOrDetect(dir, isClonedRepo)
+	}
+	endConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Track project in history
+	// Install browsers and serve their endpoints for this run
+	if runBrowsers && cfg.Run.Browsers == nil {
+		cfg.Run.Browsers = &config.BrowsersConfig{CDP: true, VNC: true}
+		cfg.ApplyBrowsers()
+	}
+
+	// Set the session's clock for this run
+	if runTimezone != "" {
+		cfg.Run.Timezone = runTimezone
+	}
+	if runFaketime != "" {
+		cfg.Run.Faketime = runFaketime
+	}
+	if err := cfg.Run.ValidateClock(); err != nil {
+		return err
+	}
+
+	// Only print the plan in dry-run mode
+	if runDryRun {
+		// Dry runs don't reserve an ID with the daemon
+		return printRunPlan(dir, cfg, randomSessionID(), cmdArgs)
+	}
+
+	// Track project in history, with the run's command for worklet rerun
+	invocation := runInvocation
+	runInvocation = projects.RunRecord{}
 	if manager, err := projects.NewManager(); err == nil {
 		projectName := cfg.Name
 		if projectName == "" {
 			projectName = filepath.Base(dir)
 		}
 		manager.AddOrUpdate(dir, projectName)
+		if invocation.Dir != "" {
+			manager.RecordRun(dir, invocation)
+		}
 	}
 
-	// Ensure daemon is running for nginx proxy support
-	if err := ensureDaemonRunning(); err != nil {
-		log.Printf("Warning: Failed to start daemon: %v", err)
+	// Ensure daemon is running for nginx proxy support; ephemeral runs
+	// aren't proxied
+	if !runEphemeral {
+		endDaemon := tr.Start("daemon")
+		if err := ensureDaemonRunning(); err != nil {
+			log.Printf("Warning: Failed to start daemon: %v", err)
+		}
+		endDaemon()
 	}
 
-	// Get session ID from daemon or generate fallback
-	sessionID := getSessionID()
+	// Use the requested session ID, or get one from the daemon or generate
+	// a fallback
+	sessionID := runSessionID
+	if sessionID == "" {
+		sessionID = getSessionID(ctx, cfg)
+	}
+	sessionID, err = checkSessionID(ctx, cfg, sessionID, runSessionID != "")
+	if err != nil {
+		return err
+	}
 
 	// Handle terminal server if enabled
-	shouldStartTerminal := withTerminal && !noTerminal
+	shouldStartTerminal := withTerminal && !noTerminal && !runEphemeral
 	if shouldStartTerminal {
 		if err := startOrConnectTerminalServer(sessionID); err != nil {
 			// Don't fail the run command if terminal server fails
@@ -219,53 +451,169 @@ func runInDirectoryWithCloned(dir string, isClonedRepo bool, cmdArgs ...string)
 		isolation = "full"
 	}
 
-	// Start docker-compose services if configured
+	// Start docker-compose services if configured. With shared isolation
+	// they start on the host while the session container is created; with
+	// full isolation the entrypoint starts them inside the container, and
+	// meanwhile their images are cached on the host so later sessions load
+	// them instead of pulling them.
 	composePath := getComposePath(dir, cfg)
+	composeStarted := false
+	createdNetwork := false            // Whether the shared compose services' network is this run's
+	composeDone := make(chan struct{}) // Closed once shared compose services started or failed to
+	cacheDone := make(chan struct{})   // Closed once compose images are cached for full isolation
+	if composePath == "" || isolation == "full" {
+		close(composeDone)
+	}
+	if composePath == "" || isolation != "full" {
+		close(cacheDone)
+	}
 	if composePath != "" {
 		projectName := cfg.Name
 		if projectName == "" {
 			projectName = "worklet"
 		}
 
-		if err := docker.StartComposeServices(dir, composePath, sessionID, projectName, isolation); err != nil {
-			log.Printf("Warning: Failed to start compose services: %v", err)
+		if isolation == "full" {
+			console.Printf("Docker-compose services will be started inside the container from: %s\n", composePath)
+			go func() {
+				defer close(cacheDone)
+				if err := docker.CacheComposeImages(ctx, composePath); err != nil && ctx.Err() == nil {
+					log.Printf("Warning: %v", err)
+				}
+			}()
 		} else {
-			if isolation == "full" {
-				fmt.Printf("Docker-compose services will be started inside the container from: %s\n", composePath)
-			} else {
-				fmt.Printf("Started docker-compose services from: %s\n", composePath)
+			// Compose services and the container share the session network,
+			// so it's created before either starts
+			if exists, err := docker.NetworkExists("worklet-" + sessionID); err == nil {
+				createdNetwork = !exists
+			}
+			if err := docker.EnsureSessionNetworkExists(sessionID); err != nil {
+				return fmt.Errorf("failed to ensure session Docker network exists: %w", err)
 			}
+			go func() {
+				defer close(composeDone)
+				if err := docker.StartComposeServices(dir, composePath, sessionID, projectName, isolation); err != nil {
+					log.Printf("Warning: Failed to start compose services: %v", err)
+					return
+				}
+				composeStarted = true
+				console.Printf("Started docker-compose services from: %s\n", composePath)
+			}()
 		}
 	}
 
 	// Session discovery is now handled via Docker labels
 	// Sessions run detached, so no cleanup on exit needed
 
+	// Host-side compose services are torn down if the session never starts
+	stopCompose := func() {
+		<-composeDone
+		if composeStarted {
+			projectName := cfg.Name
+			if projectName == "" {
+				projectName = "worklet"
+			}
+			if err := docker.StopComposeServices(dir, composePath, sessionID, projectName, isolation); err != nil {
+				log.Printf("Warning: Failed to stop compose services: %v", err)
+			}
+		}
+		if createdNetwork {
+			docker.RemoveSessionNetworkSafe(sessionID)
+		}
+	}
+
 	// Run in Docker (always detached)
 	opts := docker.RunOptions{
 		WorkDir:     dir,
 		Config:      cfg,
 		SessionID:   sessionID,
 		MountMode:   mountMode,
+		ExtraMounts: extraMounts,
 		ComposePath: composePath,
 		CmdArgs:     cmdArgs,
+		TraceID:     tr.ID(),
+		Progress:    progress,
+		Image:       runImage,
+
+		TemporaryWorkDir: runWorkDirIsTemporary,
+		CredentialsTTL:   credentialsTTL,
+		IgnoreResources:  ignoreResources,
+	}
+	if runDisplay && cfg.Run.Display == "" {
+		opts.Display = config.DisplayAuto
+	}
+
+	// Worktrees need the main repository's git directory to commit
+	if worktreeBranch != "" {
+		if gitDir, err := gitCommonDir(dir); err == nil {
+			opts.GitDir = gitDir
+		} else {
+			log.Printf("Warning: Failed to locate git directory for worktree: %v", err)
+		}
+	}
+
+	if runEphemeral {
+		// The command may need the compose services straight away
+		<-composeDone
+		opts.Interactive = runInteractive
+		opts.TTY = runInteractive && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+		exitCode, err := docker.RunEphemeral(ctx, opts)
+		stopCompose()
+		if err != nil {
+			return fmt.Errorf("failed to run container: %w", err)
+		}
+		if exitCode != 0 {
+			return exitCodeError{code: exitCode}
+		}
+		return nil
 	}
 
-	containerID, err := docker.RunContainer(opts)
+	endRun := tr.Start("docker run")
+	containerID, err := docker.RunContainer(ctx, opts)
+	endRun()
 	if err != nil {
+		stopCompose()
 		return fmt.Errorf("failed to run container: %w", err)
 	}
 
+	// Wait for init scripts when showing progress, unless --no-wait. A
+	// failed start is kept for debugging.
+	if progress != nil && !runNoWait {
+		endReady := tr.Start("init")
+		err := docker.WaitForReady(ctx, containerID, readyTimeout, progress)
+		endReady()
+		if err != nil && ctx.Err() == nil {
+			return fmt.Errorf("session failed to start: %w", err)
+		}
+	}
+
+	// An interrupted start is rolled back, with or without progress
+	if ctx.Err() != nil {
+		console.Println("Interrupted, removing session resources...")
+		docker.RollbackSession(sessionID, cfg)
+		stopCompose()
+		return fmt.Errorf("run cancelled")
+	}
+
 	// Update project manager with container ID
 	if manager, err := projects.NewManager(); err == nil {
 		manager.UpdateForkStatus(dir, sessionID, true)
 	}
 
+	// Services are only reachable once compose is up too
+	<-composeDone
+
 	// Trigger daemon discovery for immediate nginx update
-	triggerDaemonDiscovery()
+	endDiscovery := tr.Start("discovery")
+	triggerDaemonDiscovery(ctx)
+	endDiscovery()
 
-	fmt.Printf("Container started in background with ID: %s\n", containerID[:12])
-	fmt.Printf("Session ID: %s\n", sessionID)
+	console.Printf("Container started in background with ID: %s\n", containerID[:12])
+	if console.Quiet() {
+		console.Resultf("%s\n", sessionID)
+	} else {
+		console.Printf("Session ID: %s\n", sessionID)
+	}
 	
 	// Get project name for URL generation
 	projectName := cfg.Name
@@ -275,28 +623,159 @@ func runInDirectoryWithCloned(dir string, isClonedRepo bool, cmdArgs ...string)
 	
 	// Display service URLs if services are defined
 	if len(cfg.Services) > 0 {
-		fmt.Println("Access your app at:")
+		hostPorts := streamHostPorts(ctx, sessionID)
+		urls := make(map[string]string)
+		for _, svc := range cfg.Services {
+			if !svc.IsStream() {
+				subdomain := svc.Subdomain
+				if subdomain == "" {
+					subdomain = svc.Name
+				}
+				urls[svc.Name] = config.ServiceURL(subdomain, projectName, sessionID)
+			}
+		}
+		var health map[string]urlHealth
+		if !console.Quiet() && colorEnabled(console.Writer()) {
+			health = probeURLs(slices.Collect(maps.Values(urls)))
+		}
+
+		console.Println("Access your app at:")
 		for _, svc := range cfg.Services {
-			subdomain := svc.Subdomain
-			if subdomain == "" {
-				subdomain = svc.Name
+			if svc.IsStream() {
+				printServiceURL(svc.Name, streamAddress(svc.Protocol, hostPorts[svc.Name]), svc.Port, urlUnknown)
+				continue
 			}
-			url := fmt.Sprintf("http://%s.%s-%s.local.worklet.sh", subdomain, projectName, sessionID)
-			fmt.Printf("  - %s: %s (port %d)\n", svc.Name, url, svc.Port)
+			printServiceURL(svc.Name, urls[svc.Name], svc.Port, health[urls[svc.Name]])
 		}
+		if cfg.Alias != "" && len(urls) > 0 && !console.Quiet() {
+			console.Println("Alias, for the most recently started healthy session:")
+			for _, svc := range cfg.Services {
+				if !svc.IsStream() {
+					console.Printf("  - %s: %s\n", svc.Name, config.AliasURL(serviceSubdomain(svc), cfg.Alias))
+				}
+			}
+		}
+		if domain := config.Domain(); domain != config.WorkletDomain {
+			if err := config.CheckDomainResolves(domain); err != nil {
+				console.Printf("Warning: %v\n", err)
+			}
+		}
+		printProxyPortHint()
 	} else if shouldStartTerminal {
 		// If no services defined but terminal is enabled, show terminal URL
-		fmt.Printf("Access terminal at: http://localhost:%d\n", runTerminalPort)
+		printServiceURL("terminal", fmt.Sprintf("http://localhost:%d", runTerminalPort), 0, urlUnknown)
 	}
-	
+
+	finishTimeReport(ctx, dir, cfg, sessionID)
+	<-cacheDone
 	return nil
 }
 
-func getSessionID() string {
-	// Generate a new session ID using UUID
-	// Format: first 8 characters of a UUID for readability
-	id := uuid.New().String()
-	return id[:8]
+// printServiceURL prints where a service of a new session is reached,
+// colored by health in a terminal, or just the URL when quiet
+func printServiceURL(name, url string, port int, health urlHealth) {
+	if console.Quiet() {
+		console.Resultf("%s\n", url)
+		return
+	}
+	link := formatURL(console.Writer(), url, health)
+	if port == 0 {
+		console.Printf("Access %s at: %s\n", name, link)
+	} else {
+		console.Printf("  - %s: %s (port %d)\n", name, link, port)
+	}
+}
+
+// printProxyPortHint explains, the first time session URLs carry a port,
+// that the proxy couldn't bind port 80 and how to let it
+func printProxyPortHint() {
+	port := config.ProxyHTTPPort()
+	if port == config.DefaultHTTPPort {
+		return
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	marker := filepath.Join(homeDir, ".worklet", "proxy-port-hint")
+	if _, err := os.Stat(marker); err == nil {
+		return
+	}
+
+	console.Printf("\nNote: the proxy couldn't bind port %d, so session URLs use port %d. To serve them on port %d:\n", config.DefaultHTTPPort, port, config.DefaultHTTPPort)
+	console.Printf("  - Rootless Docker: sudo setcap cap_net_bind_service=ep $(which rootlesskit), start\n")
+	console.Printf("    dockerd-rootless.sh under authbind --deep, or sudo sysctl net.ipv4.ip_unprivileged_port_start=80\n")
+	console.Printf("  - Another server is using port %d: stop it\n", config.DefaultHTTPPort)
+	console.Printf("Then run 'worklet daemon restart'. This note is only shown once.\n")
+	os.WriteFile(marker, nil, 0644)
+}
+
+// readyTimeout is how long run waits for init scripts before returning and
+// leaving them to finish in the background
+const readyTimeout = 2 * time.Minute
+
+// getSessionID asks the daemon for a session ID, which it checks against
+// existing containers and numbers per project when sessions.ids is
+// "sequential". Without a daemon a random ID is generated.
+func getSessionID(ctx context.Context, cfg *config.WorkletConfig) string {
+	socketPath := daemon.GetDefaultSocketPath()
+	if daemon.IsDaemonRunning(socketPath) {
+		client := daemon.NewClient(socketPath)
+		if err := client.Connect(); err == nil {
+			defer client.Close()
+
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+
+			project := cfg.Name
+			if project == "" {
+				project = "worklet"
+			}
+			sequential := loadGlobalConfig().Sessions.IDs == config.SessionIDsSequential
+			id, err := client.RequestForkID(ctx, project, sequential)
+			if err == nil {
+				return id
+			}
+			log.Printf("Warning: Failed to get a session ID from the daemon: %v", err)
+		}
+	}
+	return randomSessionID()
+}
+
+// checkSessionID validates a session ID and makes sure no container has the
+// session's name yet, so docker run doesn't fail with a name conflict. A
+// requested ID that's taken is an error; an allocated one gets a numeric
+// suffix.
+func checkSessionID(ctx context.Context, cfg *config.WorkletConfig, sessionID string, requested bool) (string, error) {
+	if err := config.ValidateSessionID(sessionID); err != nil {
+		return "", err
+	}
+
+	project := cfg.Name
+	if project == "" {
+		project = "worklet"
+	}
+	id := sessionID
+	for suffix := 2; ; suffix++ {
+		name := project + "-" + id
+		inUse, err := docker.ContainerNameInUse(ctx, name)
+		if err != nil {
+			// Leave it to docker run to report
+			return id, nil
+		}
+		if !inUse {
+			return id, nil
+		}
+		if requested {
+			return "", fmt.Errorf("session %s already exists (container %s); remove it with 'worklet rm %s' or pick another --id", id, name, id)
+		}
+		id = fmt.Sprintf("%s-%d", sessionID, suffix)
+	}
+}
+
+// randomSessionID returns the first 8 characters of a UUID
+func randomSessionID() string {
+	return uuid.New().String()[:8]
 }
 
 func getComposePath(workDir string, cfg *config.WorkletConfig) string {
@@ -319,16 +798,16 @@ func startOrConnectTerminalServer(sessionID string) error {
 	if running && lockInfo != nil {
 		// Terminal server is already running
 		port = lockInfo.Port
-		fmt.Printf("Terminal already running at: http://localhost:%d\n", port)
-		fmt.Printf("Connect to session: %s\n", sessionID)
+		console.Printf("Terminal already running at: http://localhost:%d\n", port)
+		console.Printf("Connect to session: %s\n", sessionID)
 	} else {
 		// Start new terminal server
 		port = runTerminalPort
 		if err := startTerminalServer(port); err != nil {
 			return fmt.Errorf("failed to start terminal server: %w", err)
 		}
-		fmt.Printf("Starting terminal server at: http://localhost:%d\n", port)
-		fmt.Printf("Connect to session: %s\n", sessionID)
+		console.Printf("Starting terminal server at: http://localhost:%d\n", port)
+		console.Printf("Connect to session: %s\n", sessionID)
 	}
 
 	// Open browser if requested
@@ -427,10 +906,12 @@ func parseGitURLWithRef(urlStr string) *gitURLRef {
 
 	// Check for commit reference (@ separator)
 	if idx := strings.LastIndex(urlStr, "@"); idx != -1 {
-		// Make sure it's not part of git@ SSH URL
-		if !strings.HasPrefix(urlStr, "git@") || strings.Count(urlStr[:idx], "@") > 0 {
+		// Make sure it's not the user part of an SSH or HTTP URL, like
+		// git@host:repo or ssh://git@host:7999/proj/repo.git
+		ref := urlStr[idx+1:]
+		if !strings.ContainsAny(ref, "/:") {
 			result.URL = urlStr[:idx]
-			result.Ref = urlStr[idx+1:]
+			result.Ref = ref
 			return result
 		}
 	}
@@ -474,6 +955,11 @@ func isGitURL(arg string) bool {
 		}
 	}
 
+	// Shorthands for hosts registered in the global config
+	if _, ok := loadGlobalConfig().ExpandShorthand(urlToCheck); ok {
+		return true
+	}
+
 	// Also check if it looks like a github/gitlab shorthand (e.g., "user/repo")
 	if matched, _ := regexp.MatchString(`^[\w-]+/[\w.-]+$`, urlToCheck); matched {
 		return true
@@ -482,14 +968,19 @@ func isGitURL(arg string) bool {
 	return false
 }
 
+// bitbucketServerBrowseURL matches Bitbucket Server repository web URLs
+var bitbucketServerBrowseURL = regexp.MustCompile(`^(https?://[^/]+(?:/[^/]+)*?)/projects/([^/]+)/repos/([^/]+)(?:/.*)?$`)
+
 // normalizeGitURL converts various git URL formats to a standard format
 func normalizeGitURL(urlStr string) string {
 	// Handle shortened formats like "github.com/user/repo"
 	if !strings.HasPrefix(urlStr, "http://") && !strings.HasPrefix(urlStr, "https://") &&
 		!strings.HasPrefix(urlStr, "git@") && !strings.HasPrefix(urlStr, "ssh://") &&
 		!strings.HasPrefix(urlStr, "git://") {
-		// Check if it's a github/gitlab/bitbucket shorthand
-		if strings.HasPrefix(urlStr, "github.com/") ||
+		// Check if it's a shorthand for a registered host, or for github/gitlab/bitbucket
+		if expanded, ok := loadGlobalConfig().ExpandShorthand(urlStr); ok {
+			urlStr = expanded
+		} else if strings.HasPrefix(urlStr, "github.com/") ||
 			strings.HasPrefix(urlStr, "gitlab.com/") ||
 			strings.HasPrefix(urlStr, "bitbucket.org/") {
 			urlStr = "https://" + urlStr
@@ -499,6 +990,15 @@ func normalizeGitURL(urlStr string) string {
 		}
 	}
 
+	// Registered hosts may use a non-standard SSH port
+	urlStr = loadGlobalConfig().ApplySSHPort(urlStr)
+
+	// Bitbucket Server browse URLs (/projects/KEY/repos/name/browse) clone
+	// from /scm/key/name.git
+	if m := bitbucketServerBrowseURL.FindStringSubmatch(urlStr); m != nil {
+		urlStr = fmt.Sprintf("%s/scm/%s/%s.git", m[1], strings.ToLower(m[2]), m[3])
+	}
+
 	// Ensure .git suffix for consistency
 	if !strings.HasSuffix(urlStr, ".git") &&
 		(strings.Contains(urlStr, "github.com") ||
@@ -511,19 +1011,49 @@ func normalizeGitURL(urlStr string) string {
 }
 
 // cloneRepository clones a git repository to a target directory with optional branch/commit
-func cloneRepository(gitURL, targetDir, ref string) error {
+func cloneRepository(ctx context.Context, gitURL, targetDir, ref string, settings cloneSettings, progress docker.ProgressFunc) error {
 	normalizedURL := normalizeGitURL(gitURL)
+	useCache := !noGitCache && gitcache.Enabled()
+
+	// Watch the clone's size so it can be reported and limited, including
+	// the cached mirror when fetching through it
+	monitorDirs := []string{targetDir}
+	if useCache && !settings.Partial {
+		if cache, err := gitcache.New(); err == nil {
+			monitorDirs = append(monitorDirs, cache.MirrorPath(normalizedURL))
+		}
+	}
+	ctx, monitor, stopMonitor := startCloneMonitor(ctx, progress, settings.MaxSize, monitorDirs...)
+	defer stopMonitor()
+	out := activityWriter{Writer: progress.Writer(docker.PhaseClone), monitor: monitor}
 
 	if ref != "" {
-		fmt.Printf("Cloning repository from %s (ref: %s)...\n", normalizedURL, ref)
+		fmt.Fprintf(out, "Cloning repository from %s (ref: %s)...\n", normalizedURL, ref)
 	} else {
-		fmt.Printf("Cloning repository from %s...\n", normalizedURL)
+		fmt.Fprintf(out, "Cloning repository from %s...\n", normalizedURL)
+	}
+
+	// Partial clones need the git CLI; fall back to a regular clone without it
+	if settings.Partial {
+		if _, err := exec.LookPath("git"); err == nil {
+			if err := partialCloneWithGit(ctx, normalizedURL, targetDir, ref, settings, out); err != nil {
+				if ctx.Err() != nil {
+					return cloneContextError(ctx)
+				}
+				return err
+			}
+			fmt.Fprintln(out, "Repository cloned successfully")
+			return nil
+		}
+		fmt.Fprintln(out, "Warning: git not found in PATH, falling back to a full clone")
 	}
 
 	// Configure clone options
 	cloneOpts := &git.CloneOptions{
 		URL:      normalizedURL,
-		Progress: os.Stdout,
+		Progress: out,
+		// Sparse checkouts are applied after cloning
+		NoCheckout: len(settings.SparsePaths) > 0,
 	}
 
 	// Handle branch vs commit reference
@@ -531,12 +1061,12 @@ func cloneRepository(gitURL, targetDir, ref string) error {
 		if isCommitHash(ref) {
 			// For commits, we need the full history
 			// Don't set Depth, clone all history
-			fmt.Println("Cloning full history to checkout specific commit...")
+			fmt.Fprintln(out, "Cloning full history to checkout specific commit...")
 		} else {
 			// For branches, set the reference name
 			cloneOpts.ReferenceName = plumbing.NewBranchReferenceName(ref)
 			cloneOpts.SingleBranch = true
-			fmt.Printf("Cloning branch: %s\n", ref)
+			fmt.Fprintf(out, "Cloning branch: %s\n", ref)
 		}
 	} else {
 		// Default shallow clone for faster cloning when no ref specified
@@ -549,9 +1079,17 @@ func cloneRepository(gitURL, targetDir, ref string) error {
 		cloneOpts.Auth = auth
 	}
 
-	// Perform the clone
-	repo, err := git.PlainClone(targetDir, false, cloneOpts)
+	// Perform the clone, going through the local mirror cache when enabled
+	var repo *git.Repository
+	if useCache {
+		repo, err = cloneViaCache(ctx, normalizedURL, targetDir, cloneOpts, out)
+	} else {
+		repo, err = git.PlainCloneContext(ctx, targetDir, false, cloneOpts)
+	}
 	if err != nil {
+		if ctx.Err() != nil {
+			return cloneContextError(ctx)
+		}
 		if err == transport.ErrAuthenticationRequired {
 			return fmt.Errorf("authentication required to clone repository. Please ensure you have proper credentials configured")
 		}
@@ -563,7 +1101,7 @@ func cloneRepository(gitURL, targetDir, ref string) error {
 
 	// If a commit hash was specified, checkout that commit
 	if ref != "" && isCommitHash(ref) {
-		fmt.Printf("Checking out commit: %s\n", ref)
+		fmt.Fprintf(out, "Checking out commit: %s\n", ref)
 
 		worktree, err := repo.Worktree()
 		if err != nil {
@@ -576,111 +1114,106 @@ func cloneRepository(gitURL, targetDir, ref string) error {
 			return fmt.Errorf("commit '%s' not found in repository: %w", ref, err)
 		}
 
+		sparse, err := sparsePatterns(repo, *hash, settings.SparsePaths)
+		if err != nil {
+			return err
+		}
+
 		// Checkout the specific commit
 		err = worktree.Checkout(&git.CheckoutOptions{
-			Hash: *hash,
+			Hash:                      *hash,
+			SparseCheckoutDirectories: sparse,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to checkout commit %s: %w", ref, err)
 		}
 
-		fmt.Printf("Checked out commit: %s\n", hash.String()[:7])
-	}
+		fmt.Fprintf(out, "Checked out commit: %s\n", hash.String()[:7])
+	} else if len(settings.SparsePaths) > 0 {
+		fmt.Fprintf(out, "Sparse checkout: %s\n", strings.Join(settings.SparsePaths, ", "))
 
-	fmt.Println("Repository cloned successfully")
-	return nil
-}
-
-// getGitAuth attempts to get authentication for git operations
-func getGitAuth(gitURL string) (transport.AuthMethod, error) {
-	// Parse the URL to determine the protocol
-	u, err := url.Parse(gitURL)
-	if err != nil {
-		// Try alternative parsing for SSH URLs
-		if strings.HasPrefix(gitURL, "git@") {
-			// SSH authentication
-			return getSshAuth()
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return fmt.Errorf("failed to get worktree: %w", err)
 		}
-		return nil, err
-	}
 
-	switch u.Scheme {
-	case "https", "http":
-		// Try to get credentials from environment or git credential helper
-		return getHttpAuth()
-	case "ssh", "git":
-		return getSshAuth()
-	default:
-		if strings.HasPrefix(gitURL, "git@") {
-			return getSshAuth()
+		head, err := repo.Head()
+		if err != nil {
+			return fmt.Errorf("failed to resolve HEAD: %w", err)
 		}
-	}
 
-	return nil, nil
-}
-
-// getHttpAuth gets HTTP authentication from environment variables
-func getHttpAuth() (transport.AuthMethod, error) {
-	// Check for GitHub token
-	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
-		return &http.BasicAuth{
-			Username: "oauth2",
-			Password: token,
-		}, nil
-	}
+		sparse, err := sparsePatterns(repo, head.Hash(), settings.SparsePaths)
+		if err != nil {
+			return err
+		}
 
-	// Check for GitLab token
-	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
-		return &http.BasicAuth{
-			Username: "oauth2",
-			Password: token,
-		}, nil
+		err = worktree.Checkout(&git.CheckoutOptions{
+			Branch:                    head.Name(),
+			SparseCheckoutDirectories: sparse,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to checkout sparse paths: %w", err)
+		}
 	}
 
-	// Check for generic git credentials
-	if username := os.Getenv("GIT_USERNAME"); username != "" {
-		if password := os.Getenv("GIT_PASSWORD"); password != "" {
-			return &http.BasicAuth{
-				Username: username,
-				Password: password,
-			}, nil
+	// Submodules are updated after checkout so relative URLs resolve
+	// against the real origin rather than the cache
+	if settings.Submodules {
+		if err := updateSubmodules(ctx, repo, cloneOpts.Auth, settings.SparsePaths, out); err != nil {
+			if ctx.Err() != nil {
+				return cloneContextError(ctx)
+			}
+			fmt.Fprintf(out, "Warning: %v\n", err)
 		}
 	}
 
-	return nil, nil
+	fmt.Fprintln(out, "Repository cloned successfully")
+	return nil
 }
 
-// getSshAuth gets SSH authentication
-func getSshAuth() (transport.AuthMethod, error) {
-	// Try to use SSH agent first
-	auth, err := ssh.NewSSHAgentAuth("git")
+// cloneViaCache syncs the remote into the local mirror cache and clones from
+// there, falling back to a direct clone if the cache can't be used
+func cloneViaCache(ctx context.Context, gitURL, targetDir string, cloneOpts *git.CloneOptions, out io.Writer) (*git.Repository, error) {
+	cache, err := gitcache.New()
+	if err == nil {
+		_, err = cache.Sync(ctx, gitURL, cloneOpts.Auth, out)
+	}
 	if err == nil {
-		return auth, nil
+		return cache.Clone(ctx, gitURL, targetDir, cloneOpts)
 	}
 
-	// Fall back to default SSH key
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
+	// Auth and cancellation errors would fail a direct clone too
+	if ctx.Err() != nil || errors.Is(err, transport.ErrAuthenticationRequired) {
 		return nil, err
 	}
 
-	// Try common SSH key locations
-	keyPaths := []string{
-		filepath.Join(homeDir, ".ssh", "id_rsa"),
-		filepath.Join(homeDir, ".ssh", "id_ed25519"),
-		filepath.Join(homeDir, ".ssh", "id_ecdsa"),
-	}
+	fmt.Fprintf(out, "Warning: git cache unavailable (%v), cloning directly\n", err)
+	return git.PlainCloneContext(ctx, targetDir, false, cloneOpts)
+}
 
-	for _, keyPath := range keyPaths {
-		if _, err := os.Stat(keyPath); err == nil {
-			auth, err := ssh.NewPublicKeysFromFile("git", keyPath, "")
-			if err == nil {
-				return auth, nil
-			}
-		}
-	}
+// getGitAuth resolves authentication for git operations from the global
+// config, environment, git credential helpers and SSH keys
+func getGitAuth(gitURL string) (transport.AuthMethod, error) {
+	return gitauth.DefaultResolver(loadGlobalConfig()).Auth(gitURL)
+}
+
+var (
+	globalConfigOnce sync.Once
+	globalConfig     *config.GlobalConfig
+)
 
-	return nil, fmt.Errorf("no SSH key found")
+// loadGlobalConfig loads ~/.worklet/config.jsonc once, falling back to an
+// empty config if it can't be read
+func loadGlobalConfig() *config.GlobalConfig {
+	globalConfigOnce.Do(func() {
+		var err error
+		globalConfig, err = config.LoadGlobalConfig()
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			globalConfig = &config.GlobalConfig{}
+		}
+	})
+	return globalConfig
 }
 
 // createTempDirectory creates a temporary directory for cloned repositories
@@ -720,7 +1253,7 @@ func cleanupTempDirectory(dir string) error {
 		return fmt.Errorf("refusing to clean non-temporary directory: %s", dir)
 	}
 
-	fmt.Printf("Cleaning up temporary directory: %s\n", dir)
+	console.Printf("Cleaning up temporary directory: %s\n", dir)
 	return os.RemoveAll(dir)
 }
 
@@ -734,17 +1267,17 @@ func ensureDaemonRunning() error {
 	}
 
 	// Start daemon in background
-	log.Println("Starting worklet daemon for nginx proxy support...")
+	console.Println("Starting worklet daemon for nginx proxy support...")
 	if err := StartDaemonBackground(socketPath); err != nil {
 		return fmt.Errorf("failed to start daemon: %w", err)
 	}
 
-	log.Println("Worklet daemon started successfully")
+	console.Println("Worklet daemon started successfully")
 	return nil
 }
 
 // triggerDaemonDiscovery tells the daemon to discover containers immediately
-func triggerDaemonDiscovery() {
+func triggerDaemonDiscovery(ctx context.Context) {
 	socketPath := daemon.GetDefaultSocketPath()
 
 	// Check if daemon is running
@@ -760,7 +1293,7 @@ func triggerDaemonDiscovery() {
 	}
 	defer client.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	if err := client.TriggerDiscovery(ctx); err != nil {
@@ -768,6 +1301,36 @@ func triggerDaemonDiscovery() {
 	}
 }
 
+// streamHostPorts returns the proxy ports the daemon assigned to a
+// session's TCP and UDP services, keyed by service name
+func streamHostPorts(ctx context.Context, sessionID string) map[string]int {
+	ports := make(map[string]int)
+
+	socketPath := daemon.GetDefaultSocketPath()
+	if !daemon.IsDaemonRunning(socketPath) {
+		return ports
+	}
+	client := daemon.NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		return ports
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	fork, err := client.GetForkInfo(ctx, sessionID)
+	if err != nil {
+		return ports
+	}
+	for _, svc := range fork.Services {
+		if svc.IsStream() {
+			ports[svc.Name] = svc.HostPort
+		}
+	}
+	return ports
+}
+
 // extractRepoNameFromURL extracts repository name from git URL
 func extractRepoNameFromURL(gitURL string) string {
 	// Normalize the URL first
@@ -0,0 +1,259 @@
+package worklet
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/pkg/daemon"
+)
+
+const (
+	launchdLabel = "dev.worklet.daemon"
+	systemdUnit  = "worklet-daemon.service"
+)
+
+// daemonService is the daemon installed with the platform's service
+// manager, so it starts at login: a launchd agent on macOS or a systemd user
+// unit on Linux
+type daemonService struct {
+	manager string // "launchd" or "systemd"
+	path    string // The plist or unit file
+}
+
+// currentDaemonService returns the daemon service of this platform
+func currentDaemonService() (*daemonService, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return &daemonService{
+			manager: "launchd",
+			path:    filepath.Join(homeDir, "Library", "LaunchAgents", launchdLabel+".plist"),
+		}, nil
+	case "linux":
+		configDir := os.Getenv("XDG_CONFIG_HOME")
+		if configDir == "" {
+			configDir = filepath.Join(homeDir, ".config")
+		}
+		return &daemonService{
+			manager: "systemd",
+			path:    filepath.Join(configDir, "systemd", "user", systemdUnit),
+		}, nil
+	default:
+		return nil, fmt.Errorf("installing the daemon as a service is not supported on %s", runtime.GOOS)
+	}
+}
+
+// installedDaemonService returns the daemon service if it is installed, or
+// nil
+func installedDaemonService() *daemonService {
+	service, err := currentDaemonService()
+	if err != nil || !service.Installed() {
+		return nil
+	}
+	return service
+}
+
+// Installed reports whether the service file exists
+func (s *daemonService) Installed() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+// Describe returns the kind of service for messages
+func (s *daemonService) Describe() string {
+	if s.manager == "launchd" {
+		return "launchd agent"
+	}
+	return "systemd user unit"
+}
+
+// Install writes the service file for the worklet executable at exePath,
+// logging to logFile, and loads it so the daemon starts now and at login
+func (s *daemonService) Install(exePath, logFile string) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(s.path), err)
+	}
+
+	var content string
+	if s.manager == "launchd" {
+		content = renderLaunchdPlist(exePath, logFile, serviceEnvironment())
+	} else {
+		content = renderSystemdUnit(exePath, logFile, serviceEnvironment())
+	}
+	if err := os.WriteFile(s.path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+
+	if s.manager == "launchd" {
+		// Replace an agent loaded from an older plist
+		runServiceCommand("launchctl", "bootout", launchdTarget())
+		return runServiceCommand("launchctl", "bootstrap", launchdDomain(), s.path)
+	}
+	if err := runServiceCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+	return runServiceCommand("systemctl", "--user", "enable", "--now", systemdUnit)
+}
+
+// Uninstall stops the daemon and removes the service file
+func (s *daemonService) Uninstall() error {
+	if s.manager == "launchd" {
+		runServiceCommand("launchctl", "bootout", launchdTarget())
+	} else {
+		runServiceCommand("systemctl", "--user", "disable", "--now", systemdUnit)
+	}
+
+	if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", s.path, err)
+	}
+	if s.manager == "systemd" {
+		runServiceCommand("systemctl", "--user", "daemon-reload")
+	}
+	return nil
+}
+
+// Start asks the service manager to start the daemon
+func (s *daemonService) Start() error {
+	if s.manager == "launchd" {
+		return runServiceCommand("launchctl", "kickstart", launchdTarget())
+	}
+	return runServiceCommand("systemctl", "--user", "start", systemdUnit)
+}
+
+// Stop asks the service manager to stop the daemon. It stays installed and
+// starts again at the next login.
+func (s *daemonService) Stop() error {
+	if s.manager == "launchd" {
+		// A clean exit isn't restarted, since KeepAlive only covers failures
+		return runServiceCommand("launchctl", "kill", "SIGTERM", launchdTarget())
+	}
+	return runServiceCommand("systemctl", "--user", "stop", systemdUnit)
+}
+
+// launchdDomain is the launchd domain of the user's login session
+func launchdDomain() string {
+	return fmt.Sprintf("gui/%d", os.Getuid())
+}
+
+// launchdTarget is the daemon's agent in launchdDomain
+func launchdTarget() string {
+	return launchdDomain() + "/" + launchdLabel
+}
+
+// runServiceCommand runs a service manager command, including its output in
+// the error
+func runServiceCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w\n%s", name, strings.Join(args, " "), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// serviceEnvironment returns the variables the service keeps from the
+// installing shell: PATH, so docker is found, and the socket path if it was
+// changed
+func serviceEnvironment() map[string]string {
+	env := map[string]string{"PATH": os.Getenv("PATH")}
+	if socket := os.Getenv(daemon.SocketPathEnv); socket != "" {
+		env[daemon.SocketPathEnv] = socket
+	}
+	return env
+}
+
+// serviceExecutable returns the path the service should run worklet from.
+// Homebrew installs into a versioned Cellar directory that upgrades remove, so
+// its stable symlink in the prefix's bin directory is used instead.
+func serviceExecutable() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	if prefix, _, ok := strings.Cut(exePath, "/Cellar/"); ok {
+		linked := filepath.Join(prefix, "bin", filepath.Base(exePath))
+		if _, err := os.Stat(linked); err == nil {
+			return linked, nil
+		}
+	}
+	return exePath, nil
+}
+
+// renderLaunchdPlist returns a launchd agent that runs the daemon in the
+// foreground at login and restarts it if it crashes
+func renderLaunchdPlist(exePath, logFile string, env map[string]string) string {
+	escape := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+`)
+	fmt.Fprintf(&b, "  <key>Label</key>\n  <string>%s</string>\n", launchdLabel)
+	b.WriteString("  <key>ProgramArguments</key>\n  <array>\n")
+	for _, arg := range []string{exePath, "daemon", "start", "--foreground"} {
+		fmt.Fprintf(&b, "    <string>%s</string>\n", escape(arg))
+	}
+	b.WriteString("  </array>\n")
+	b.WriteString("  <key>EnvironmentVariables</key>\n  <dict>\n")
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		fmt.Fprintf(&b, "    <key>%s</key>\n    <string>%s</string>\n", escape(key), escape(env[key]))
+	}
+	b.WriteString("  </dict>\n")
+	b.WriteString("  <key>RunAtLoad</key>\n  <true/>\n")
+	b.WriteString("  <key>KeepAlive</key>\n  <dict>\n    <key>SuccessfulExit</key>\n    <false/>\n  </dict>\n")
+	fmt.Fprintf(&b, "  <key>StandardOutPath</key>\n  <string>%s</string>\n", escape(logFile))
+	fmt.Fprintf(&b, "  <key>StandardErrorPath</key>\n  <string>%s</string>\n", escape(logFile))
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+// renderSystemdUnit returns a systemd user unit that runs the daemon in the
+// foreground at login and restarts it if it crashes
+func renderSystemdUnit(exePath, logFile string, env map[string]string) string {
+	quote := func(s string) string {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\nDescription=worklet daemon\n\n[Service]\n")
+	fmt.Fprintf(&b, "ExecStart=%s daemon start --foreground\n", quote(exePath))
+	for _, key := range slices.Sorted(maps.Keys(env)) {
+		fmt.Fprintf(&b, "Environment=%s\n", quote(key+"="+env[key]))
+	}
+	b.WriteString("Restart=on-failure\nRestartSec=5\n")
+	fmt.Fprintf(&b, "StandardOutput=append:%s\nStandardError=append:%s\n", logFile, logFile)
+	b.WriteString("\n[Install]\nWantedBy=default.target\n")
+	return b.String()
+}
+
+// waitForDaemon waits up to timeout for the daemon to accept connections
+func waitForDaemon(socketPath string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if daemon.IsDaemonRunning(socketPath) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
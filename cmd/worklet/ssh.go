@@ -11,6 +11,7 @@ var sshCmd = &cobra.Command{
 	Use:   "ssh",
 	Short: "Manage SSH credentials for worklet containers",
 	Long:  `Commands for managing SSH credentials that can be used inside worklet containers.`,
+	Deprecated: `use "worklet credentials setup|test|clear ssh"`,
 }
 
 var sshSetupCmd = &cobra.Command{
@@ -0,0 +1,165 @@
+package worklet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	statsJSON     bool
+	statsNoStream bool
+	statsInterval time.Duration
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [session-id]",
+	Short: "Show live resource usage of sessions",
+	Long: `Stream CPU, memory, network and block IO usage of running sessions.
+
+Without a session ID every running session is shown as one row, totalling
+the session container and its compose services. With a session ID each of
+its containers is listed, including containers started by its
+Docker-in-Docker daemon. Those are already included in the session
+container's usage, so they are marked with * and left out of the total.
+
+With --json one JSON object per session is written for every sample.
+
+Examples:
+  worklet stats                  # Live usage of all sessions
+  worklet stats abc123           # Live usage of abc123's containers
+  worklet stats --json | jq .    # Stream samples as JSON
+  worklet stats --no-stream      # Print a single sample`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runStats,
+}
+
+func init() {
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Write samples as JSON lines")
+	statsCmd.Flags().BoolVar(&statsNoStream, "no-stream", false, "Print a single sample and exit")
+	statsCmd.Flags().DurationVar(&statsInterval, "interval", 2*time.Second, "Time between samples")
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	if statsInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	sessionID := ""
+	if len(args) > 0 {
+		sessionID = args[0]
+	}
+
+	live := !statsJSON && !statsNoStream && term.IsTerminal(int(os.Stdout.Fd()))
+	encoder := json.NewEncoder(os.Stdout)
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		samples, err := sampleSessions(ctx, sessionID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if statsJSON {
+			for _, sample := range samples {
+				if err := encoder.Encode(sample); err != nil {
+					return err
+				}
+			}
+		} else {
+			if live {
+				// Redraw in place
+				fmt.Print("\033[H\033[2J")
+			}
+			printStats(os.Stdout, samples, sessionID != "")
+		}
+
+		if statsNoStream {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleSessions collects one sample for the given session, or for all
+// running sessions when sessionID is empty
+func sampleSessions(ctx context.Context, sessionID string) ([]docker.SessionStats, error) {
+	var sessions []docker.SessionInfo
+	if sessionID != "" {
+		session, err := docker.GetSessionInfo(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	} else {
+		var err error
+		sessions, err = docker.ListSessions(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docker.CollectStats(ctx, sessions)
+}
+
+// printStats writes a sample as a table, one row per session or, with
+// perContainer, one row per container followed by the session total
+func printStats(out io.Writer, samples []docker.SessionStats, perContainer bool) {
+	if len(samples) == 0 {
+		fmt.Fprintln(out, "No running sessions")
+		return
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCPU %\tMEM\tNET I/O\tBLOCK I/O\tPIDS")
+
+	row := func(name string, stats docker.ContainerStats) {
+		mem := formatSize(int64(stats.MemUsage))
+		if stats.MemLimit > 0 {
+			mem += " / " + formatSize(int64(stats.MemLimit))
+		}
+		fmt.Fprintf(w, "%s\t%.2f%%\t%s\t%s / %s\t%s / %s\t%d\n",
+			name, stats.CPUPercent, mem,
+			formatSize(int64(stats.NetRx)), formatSize(int64(stats.NetTx)),
+			formatSize(int64(stats.BlockRead)), formatSize(int64(stats.BlockWrite)),
+			stats.PIDs)
+	}
+
+	for _, sample := range samples {
+		if !perContainer {
+			row(fmt.Sprintf("%s (%s)", sample.SessionID, sample.ProjectName), sample.Total)
+			continue
+		}
+		for _, container := range sample.Containers {
+			name := container.Name
+			if container.Nested {
+				name = "* " + name
+			}
+			row(name, container)
+		}
+		row("TOTAL", sample.Total)
+	}
+	w.Flush()
+}
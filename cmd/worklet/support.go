@@ -0,0 +1,242 @@
+package worklet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/nginx"
+	"github.com/nolanleung/worklet/internal/support"
+	"github.com/nolanleung/worklet/internal/version"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+// supportLogSize is how much of the end of each log goes into a bundle
+const supportLogSize = 5 << 20
+
+var supportBundleOutput string
+
+var supportBundleCmd = &cobra.Command{
+	Use:   "support-bundle",
+	Short: "Collect logs and diagnostics for a bug report",
+	Long: `Gather the daemon log, the nginx config and logs, docker inspect output for
+worklet containers, your configs and version information into a tarball to
+attach to a bug report.
+
+Tokens, passwords and other secret-looking values, and every environment
+variable value, are redacted. Look through the bundle before sharing it.`,
+	Args: cobra.NoArgs,
+	RunE: runSupportBundle,
+}
+
+func init() {
+	supportBundleCmd.Flags().StringVarP(&supportBundleOutput, "output", "o", "", "Path of the tarball (default: worklet-support-<time>.tar.gz)")
+}
+
+func runSupportBundle(cmd *cobra.Command, args []string) error {
+	output := supportBundleOutput
+	if output == "" {
+		output = fmt.Sprintf("worklet-support-%s.tar.gz", time.Now().Format("20060102-150405"))
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+	workletDir := filepath.Join(homeDir, ".worklet")
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+	defer file.Close()
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), 30*time.Second)
+	defer cancel()
+
+	bundle := support.NewBundle(file)
+
+	bundle.Add("version.txt", []byte(supportVersionInfo(ctx)))
+	collectDaemon(ctx, bundle, workletDir)
+	collectNginx(ctx, bundle, workletDir)
+	collectContainers(ctx, bundle)
+	collectConfigs(bundle)
+
+	if err := bundle.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write bundle: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", output)
+	fmt.Println("Secrets are redacted, but look through it before attaching it to a bug report.")
+	return nil
+}
+
+// supportVersionInfo describes the CLI, daemon, Docker and host versions
+func supportVersionInfo(ctx context.Context) string {
+	var b strings.Builder
+	info := version.GetInfo()
+	fmt.Fprintf(&b, "CLI version: %s\n", info.Version)
+	fmt.Fprintf(&b, "CLI commit:  %s\n", info.GitCommit)
+	fmt.Fprintf(&b, "CLI built:   %s\n", info.BuildTime)
+	fmt.Fprintf(&b, "Go:          %s\n", runtime.Version())
+	fmt.Fprintf(&b, "OS/Arch:     %s/%s\n", runtime.GOOS, runtime.GOARCH)
+
+	socketPath := daemon.GetDefaultSocketPath()
+	if !daemon.IsDaemonRunning(socketPath) {
+		b.WriteString("Daemon:      not running\n")
+	} else {
+		client := daemon.NewClient(socketPath)
+		if err := client.Connect(); err != nil {
+			fmt.Fprintf(&b, "Daemon:      %v\n", err)
+		} else {
+			defer client.Close()
+			if daemonVersion, err := client.GetVersion(ctx); err != nil {
+				fmt.Fprintf(&b, "Daemon:      %v\n", err)
+			} else {
+				fmt.Fprintf(&b, "Daemon:      %s (started %s)\n", daemonVersion.Version, daemonVersion.StartTime)
+			}
+		}
+	}
+
+	b.WriteString("\n")
+	if out, err := exec.CommandContext(ctx, "docker", "version").CombinedOutput(); err != nil {
+		fmt.Fprintf(&b, "docker version: %v\n%s", err, out)
+	} else {
+		b.Write(out)
+	}
+	return b.String()
+}
+
+// collectDaemon adds the daemon log and its registered forks
+func collectDaemon(ctx context.Context, bundle *support.Bundle, workletDir string) {
+	logPath := filepath.Join(workletDir, "logs", "daemon.log")
+	if err := bundle.AddFile("daemon/daemon.log", logPath, supportLogSize); err != nil {
+		bundle.Missing("daemon/daemon.log", err)
+	}
+
+	socketPath := daemon.GetDefaultSocketPath()
+	if !daemon.IsDaemonRunning(socketPath) {
+		bundle.Missing("daemon/forks.json", fmt.Errorf("daemon is not running"))
+		return
+	}
+	client := daemon.NewClient(socketPath)
+	if err := client.Connect(); err != nil {
+		bundle.Missing("daemon/forks.json", err)
+		return
+	}
+	defer client.Close()
+
+	forks, err := client.ListForks(ctx)
+	if err != nil {
+		bundle.Missing("daemon/forks.json", err)
+		return
+	}
+	addRedactedJSON(bundle, "daemon/forks.json", forks)
+}
+
+// collectNginx adds the proxy's config, including the forks' include files
+// and any nginx rejected, its activity log and container log
+func collectNginx(ctx context.Context, bundle *support.Bundle, workletDir string) {
+	nginxDir := filepath.Join(workletDir, "nginx")
+	names := []string{"nginx.conf", "activity.log"}
+	for _, includeDir := range []string{nginx.HTTPIncludeDir, nginx.StreamIncludeDir} {
+		includes, _ := filepath.Glob(filepath.Join(nginxDir, includeDir, "*.conf*"))
+		for _, include := range includes {
+			names = append(names, includeDir+"/"+filepath.Base(include))
+		}
+	}
+	for _, name := range names {
+		if err := bundle.AddFile("nginx/"+name, filepath.Join(nginxDir, filepath.FromSlash(name)), supportLogSize); err != nil {
+			bundle.Missing("nginx/"+name, err)
+		}
+	}
+
+	out, err := exec.CommandContext(ctx, "docker", "logs", "--tail", "2000", "worklet-nginx-proxy").CombinedOutput()
+	if err != nil {
+		if msg := bytes.TrimSpace(out); len(msg) > 0 {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		bundle.Missing("nginx/container.log", err)
+		return
+	}
+	bundle.Add("nginx/container.log", out)
+}
+
+// collectContainers adds docker inspect output for session containers and
+// the proxy, with environment values redacted
+func collectContainers(ctx context.Context, bundle *support.Bundle) {
+	out, err := exec.CommandContext(ctx, "docker", "ps", "-a", "--filter", "label=worklet.session=true", "--format", "{{.Names}}").Output()
+	if err != nil {
+		bundle.Missing("docker/", fmt.Errorf("failed to list containers: %w", err))
+		return
+	}
+	names := append(strings.Fields(string(out)), "worklet-nginx-proxy")
+
+	for _, name := range names {
+		file := "docker/" + name + ".json"
+		out, err := exec.CommandContext(ctx, "docker", "inspect", name).Output()
+		if err != nil {
+			bundle.Missing(file, err)
+			continue
+		}
+		redacted, err := support.RedactJSON(out)
+		if err != nil {
+			bundle.Missing(file, err)
+			continue
+		}
+		bundle.Add(file, redacted)
+	}
+}
+
+// collectConfigs adds the global config and the current directory's
+// project config, redacted
+func collectConfigs(bundle *support.Bundle) {
+	paths := map[string]string{}
+	if path, err := config.GlobalConfigPath(); err == nil {
+		paths["config/config.jsonc"] = path
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if path, err := config.FindConfigFile(cwd); err == nil {
+			paths["config/project"+filepath.Base(path)] = path
+		}
+	}
+
+	for name, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			bundle.Missing(name, err)
+			continue
+		}
+		redacted, err := support.RedactJSON(data)
+		if err != nil {
+			bundle.Missing(name, err)
+			continue
+		}
+		bundle.Add(name, redacted)
+	}
+}
+
+// addRedactedJSON adds v to the bundle as redacted JSON
+func addRedactedJSON(bundle *support.Bundle, name string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		data, err = support.RedactJSON(data)
+	}
+	if err != nil {
+		bundle.Missing(name, err)
+		return
+	}
+	bundle.Add(name, data)
+}
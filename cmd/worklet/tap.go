@@ -0,0 +1,164 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/har"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tapServices []string
+	tapAppend   bool
+	tapOutput   string
+)
+
+var tapCmd = &cobra.Command{
+	Use:   "tap",
+	Short: "Record a session's HTTP traffic",
+	Long: `Record the requests and responses the proxy passes to a session's HTTP
+services, and export them as a HAR file. HAR files open in the network tab
+of browser dev tools and in most HTTP tools, which makes it easy to replay
+or share a frontend/backend integration bug found in a session.
+
+Bodies are recorded up to 1MB each. Traffic of upgraded connections such as
+WebSockets isn't recorded. Recording stops when the daemon restarts.
+
+Examples:
+  worklet tap start 3                # Record every HTTP service of session 3
+  worklet tap start 3 --service api  # Record only the api service
+  worklet tap export 3 -o bug.har    # Save what was recorded
+  worklet tap stop 3                 # Stop recording`,
+}
+
+var tapStartCmd = &cobra.Command{
+	Use:   "start <session-id>",
+	Short: "Start recording a session's HTTP services",
+	Long: `Start recording requests to a session's HTTP services. Anything recorded
+earlier for the session is discarded unless --append is given.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		path, err := har.RecordingPath(sessionID)
+		if err != nil {
+			return err
+		}
+		if !tapAppend {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to discard previous recording: %w", err)
+			}
+		}
+
+		fork, err := setTap(sessionID, tapServices, true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Recording %s of session %s\n", strings.Join(fork.Taps, ", "), sessionID)
+		fmt.Printf("Export it with: worklet tap export %s -o %s.har\n", sessionID, sessionID)
+		return nil
+	},
+}
+
+var tapStopCmd = &cobra.Command{
+	Use:   "stop <session-id>",
+	Short: "Stop recording a session's HTTP services",
+	Long: `Stop recording requests to a session's HTTP services. What was recorded
+is kept until the next 'worklet tap start' and can still be exported.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		fork, err := setTap(sessionID, tapServices, false)
+		if err != nil {
+			return err
+		}
+		if len(fork.Taps) > 0 {
+			fmt.Printf("Still recording %s of session %s\n", strings.Join(fork.Taps, ", "), sessionID)
+		} else {
+			fmt.Printf("Stopped recording session %s\n", sessionID)
+		}
+		return nil
+	},
+}
+
+var tapExportCmd = &cobra.Command{
+	Use:   "export <session-id>",
+	Short: "Export a session's recording as a HAR file",
+	Long: `Write what was recorded for a session as a HAR 1.2 file, to stdout
+unless --output is given. Recording doesn't need to be stopped first.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		path, err := har.RecordingPath(sessionID)
+		if err != nil {
+			return err
+		}
+		entries, err := har.ReadEntries(path)
+		if err != nil {
+			return err
+		}
+		if len(tapServices) > 0 {
+			var filtered []har.Entry
+			for _, entry := range entries {
+				for _, service := range tapServices {
+					if entry.Service == service {
+						filtered = append(filtered, entry)
+						break
+					}
+				}
+			}
+			entries = filtered
+		}
+		if len(entries) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: Nothing recorded for session %s\n", sessionID)
+		}
+
+		if tapOutput == "" {
+			return writeJSON(os.Stdout, har.Build(entries))
+		}
+
+		file, err := os.Create(tapOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", tapOutput, err)
+		}
+		defer file.Close()
+		if err := writeJSON(file, har.Build(entries)); err != nil {
+			return fmt.Errorf("failed to write %s: %w", tapOutput, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d requests to %s\n", len(entries), tapOutput)
+		return nil
+	},
+}
+
+func init() {
+	tapStartCmd.Flags().StringArrayVarP(&tapServices, "service", "s", nil, "Only record this service (repeatable)")
+	tapStartCmd.Flags().BoolVar(&tapAppend, "append", false, "Keep what was recorded before")
+	tapStopCmd.Flags().StringArrayVarP(&tapServices, "service", "s", nil, "Only stop recording this service (repeatable)")
+	tapExportCmd.Flags().StringArrayVarP(&tapServices, "service", "s", nil, "Only export requests to this service (repeatable)")
+	tapExportCmd.Flags().StringVarP(&tapOutput, "output", "o", "", "Write the HAR file here instead of stdout")
+
+	tapCmd.AddCommand(tapStartCmd)
+	tapCmd.AddCommand(tapStopCmd)
+	tapCmd.AddCommand(tapExportCmd)
+}
+
+// setTap asks the daemon to start or stop recording a session
+func setTap(sessionID string, services []string, enabled bool) (*daemon.ForkInfo, error) {
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		return nil, fmt.Errorf("daemon is not running. Start it with: worklet daemon start")
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return client.SetTap(ctx, sessionID, services, enabled)
+}
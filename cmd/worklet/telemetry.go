@@ -0,0 +1,204 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/trace"
+	"github.com/nolanleung/worklet/internal/usage"
+	"github.com/nolanleung/worklet/internal/version"
+	"github.com/spf13/cobra"
+)
+
+// telemetryFlushTimeout bounds how long exiting waits for spans and metrics
+// to be sent
+const telemetryFlushTimeout = 5 * time.Second
+
+var (
+	shutdownTelemetry = func(context.Context) error { return nil }
+	endCommandSpan    = func(error) {}
+)
+
+// startTelemetry sets up OTLP export when a collector is configured and
+// starts a span covering the command, whose duration is also recorded as a
+// metric. The daemon process is long-lived, so it traces its operations
+// individually instead.
+func startTelemetry(cmd *cobra.Command, args []string) {
+	telemetry := loadGlobalConfig().Telemetry
+	cfg := trace.ExportConfig{Endpoint: telemetry.Endpoint, Headers: telemetry.Headers}
+	if !trace.ExportEnabled(cfg) {
+		return
+	}
+
+	isDaemon := cmd == daemonStartCmd && daemonForeground
+	service := "worklet"
+	if isDaemon {
+		service = "worklet-daemon"
+	}
+
+	shutdown, err := trace.SetupExport(cmd.Context(), service, version.Version, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: telemetry disabled: %v\n", err)
+		return
+	}
+	shutdownTelemetry = shutdown
+
+	if !isDaemon {
+		ctx, end := trace.StartSpan(cmd.Context(), cmd.CommandPath())
+		cmd.SetContext(ctx)
+		endCommandSpan = end
+	}
+}
+
+// stopTelemetry ends the command span and flushes pending spans and metrics
+func stopTelemetry(err error) {
+	endCommandSpan(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryFlushTimeout)
+	defer cancel()
+	if err := shutdownTelemetry(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to export telemetry: %v\n", err)
+	}
+}
+
+// usageFlushTimeout bounds how long exiting waits to send usage statistics
+const usageFlushTimeout = 3 * time.Second
+
+var telemetryCmd = &cobra.Command{
+	Use:   "telemetry",
+	Short: "Manage anonymous usage statistics",
+	Long: `Usage statistics are off unless you turn them on. When on, worklet records
+the name of each command you run, how long it took, whether it succeeded or
+the category of its failure (e.g. "docker" or "git"), and the worklet
+version, OS and architecture, under a random ID. Arguments, paths, project
+names and error messages are never recorded.
+
+Events are queued in ~/.worklet/usage and sent in batches to the collector
+WORKLET_TELEMETRY_ENDPOINT names. There is no default collector, so nothing
+is recorded or sent without one. Setting DO_NOT_TRACK=1 or
+WORKLET_TELEMETRY=off disables them regardless.
+
+Traces and metrics sent to your own OpenTelemetry collector are configured
+separately, under "telemetry" in ~/.worklet/config.jsonc.`,
+}
+
+var telemetryOnCmd = &cobra.Command{
+	Use:   "on",
+	Short: "Send anonymous usage statistics",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := usage.New()
+		if err != nil {
+			return err
+		}
+		if _, err := store.SetEnabled(true); err != nil {
+			return err
+		}
+		fmt.Println("Usage statistics are on. Thank you!")
+		if usage.Endpoint() == "" {
+			fmt.Printf("No endpoint is configured, so nothing is recorded or sent until %s names one.\n", usage.EndpointEnv)
+		}
+		if usage.DisabledByEnv() {
+			fmt.Println("They won't be sent while DO_NOT_TRACK or WORKLET_TELEMETRY disables them.")
+		}
+		return nil
+	},
+}
+
+var telemetryOffCmd = &cobra.Command{
+	Use:   "off",
+	Short: "Stop sending usage statistics and drop queued ones",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := usage.New()
+		if err != nil {
+			return err
+		}
+		if _, err := store.SetEnabled(false); err != nil {
+			return err
+		}
+		fmt.Println("Usage statistics are off.")
+		return nil
+	},
+}
+
+var telemetryStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether usage statistics, traces and metrics are sent",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := usage.New()
+		if err != nil {
+			return err
+		}
+		settings, err := store.Settings()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case usage.DisabledByEnv():
+			fmt.Println("Usage statistics: off (disabled by environment)")
+		case settings.Enabled && usage.Endpoint() == "":
+			fmt.Printf("Usage statistics: on, but not sent (no endpoint configured; set %s)\n", usage.EndpointEnv)
+		case settings.Enabled:
+			fmt.Println("Usage statistics: on")
+			fmt.Printf("  Install ID: %s\n", settings.InstallID)
+			fmt.Printf("  Endpoint:   %s\n", usage.Endpoint())
+			if events, err := store.Pending(); err == nil {
+				fmt.Printf("  Queued:     %d events\n", len(events))
+			}
+		default:
+			fmt.Println("Usage statistics: off")
+		}
+
+		telemetry := loadGlobalConfig().Telemetry
+		if trace.ExportEnabled(trace.ExportConfig{Endpoint: telemetry.Endpoint, Headers: telemetry.Headers}) {
+			fmt.Println("Traces and metrics: sent to your OpenTelemetry collector")
+		} else {
+			fmt.Println("Traces and metrics: off")
+		}
+		return nil
+	},
+}
+
+func init() {
+	telemetryCmd.AddCommand(telemetryOnCmd)
+	telemetryCmd.AddCommand(telemetryOffCmd)
+	telemetryCmd.AddCommand(telemetryStatusCmd)
+}
+
+// recordUsage queues an anonymous event for the command when usage
+// statistics are on, and sends the queue once it's due. Failures are
+// ignored so statistics never get in the way of a command.
+func recordUsage(cmd *cobra.Command, err error, duration time.Duration) {
+	if cmd == nil || cmd.Hidden || (cmd == daemonStartCmd && daemonForeground) {
+		return
+	}
+	if usage.Endpoint() == "" {
+		return
+	}
+	store, storeErr := usage.New()
+	if storeErr != nil || !store.Enabled() {
+		return
+	}
+
+	store.Record(usage.Event{
+		Command:    cmd.CommandPath(),
+		Outcome:    usage.Categorize(err),
+		DurationMS: duration.Milliseconds(),
+		Version:    version.Version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+	})
+
+	if store.Due(time.Now()) {
+		ctx, cancel := context.WithTimeout(context.Background(), usageFlushTimeout)
+		defer cancel()
+		store.Flush(ctx, http.DefaultClient, usage.Endpoint())
+	}
+}
@@ -53,7 +53,7 @@ func init() {
 		cmd.Flags().IntVarP(&terminalPort, "port", "p", 8181, "Port to run the terminal server on")
 		cmd.Flags().BoolVarP(&openBrowser, "open", "o", true, "Open browser automatically")
 		cmd.Flags().StringVar(&terminalCORSOrigin, "cors-origin", "*", "CORS allowed origin (use '*' to allow all origins)")
-		cmd.Flags().BoolVar(&proxyEnabled, "proxy", false, "Enable reverse proxy for *.local.worklet.sh domains")
+		cmd.Flags().BoolVar(&proxyEnabled, "proxy", false, "Enable reverse proxy for session domains")
 	}
 	
 	rootCmd.AddCommand(terminalCmd)
@@ -0,0 +1,228 @@
+package worklet
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/projects"
+	"github.com/nolanleung/worklet/internal/trace"
+)
+
+// startupPhaseNames names the startup phases in the time report
+var startupPhaseNames = map[docker.Phase]string{
+	docker.PhaseClone:  "clone",
+	docker.PhaseScan:   "image scan",
+	docker.PhaseBuild:  "image build",
+	docker.PhaseCreate: "container create",
+	docker.PhaseInit:   "init script",
+}
+
+// Phases of the time report that aren't progress phases
+const (
+	phaseDaemon        = "daemon ensure"
+	phaseFirstResponse = "first response"
+)
+
+// firstResponseTimeout is how long the time report waits for a session's
+// HTTP services to answer
+const firstResponseTimeout = 2 * time.Minute
+
+// timeReport times the phases of a `worklet run --time-report`
+type timeReport struct {
+	start time.Time
+
+	mu      sync.Mutex
+	started map[docker.Phase]time.Time
+	phases  []timedPhase
+}
+
+// timedPhase is a phase of the report and when it started
+type timedPhase struct {
+	start time.Time
+	projects.PhaseTiming
+}
+
+// newTimeReport starts timing a run
+func newTimeReport() *timeReport {
+	return &timeReport{start: time.Now(), started: make(map[docker.Phase]time.Time)}
+}
+
+// observe returns a progress func timing the phases it's told about before
+// passing them on to next
+func (r *timeReport) observe(next docker.ProgressFunc) docker.ProgressFunc {
+	return func(ev docker.ProgressEvent) {
+		if name, ok := startupPhaseNames[ev.Phase]; ok {
+			r.mu.Lock()
+			switch ev.State {
+			case docker.PhaseStarted:
+				r.started[ev.Phase] = time.Now()
+			case docker.PhaseDone, docker.PhaseFailed:
+				if start, ok := r.started[ev.Phase]; ok {
+					r.phases = append(r.phases, timedPhase{start, projects.PhaseTiming{Name: name, Duration: time.Since(start)}})
+					delete(r.started, ev.Phase)
+				}
+			}
+			r.mu.Unlock()
+		}
+		next(ev)
+	}
+}
+
+// add records a phase timed elsewhere
+func (r *timeReport) add(name string, start time.Time, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.phases = append(r.phases, timedPhase{start, projects.PhaseTiming{Name: name, Duration: d}})
+}
+
+// waitFirstResponse times how long it takes for every one of urls to
+// answer. It returns false if they don't within firstResponseTimeout.
+func (r *timeReport) waitFirstResponse(ctx context.Context, urls []string) bool {
+	if len(urls) == 0 {
+		return true
+	}
+	start := time.Now()
+	deadline := start.Add(firstResponseTimeout)
+	for {
+		answered := true
+		for _, health := range probeURLs(urls) {
+			if health != urlUp {
+				answered = false
+			}
+		}
+		if answered {
+			r.add(phaseFirstResponse, start, time.Since(start))
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// timing returns the run's timing, with its phases in the order they
+// started. The daemon phase is taken from the run's trace.
+func (r *timeReport) timing(tr *trace.Recorder, mode string) projects.StartupTiming {
+	for _, span := range tr.Spans() {
+		if span.Name == "daemon" {
+			r.add(phaseDaemon, span.Start, span.Duration)
+		}
+	}
+
+	r.mu.Lock()
+	phases := append([]timedPhase{}, r.phases...)
+	r.mu.Unlock()
+	sort.SliceStable(phases, func(i, j int) bool { return phases[i].start.Before(phases[j].start) })
+
+	timing := projects.StartupTiming{Time: r.start, Mode: mode, Total: time.Since(r.start)}
+	for _, phase := range phases {
+		timing.Phases = append(timing.Phases, phase.PhaseTiming)
+	}
+	return timing
+}
+
+// finishTimeReport waits for a new session's HTTP services to answer, then
+// prints where its startup time went and adds it to the project's history
+func finishTimeReport(ctx context.Context, dir string, cfg *config.WorkletConfig, sessionID string) {
+	report := startupReport
+	if report == nil {
+		return
+	}
+	projectName := cfg.Name
+	if projectName == "" {
+		projectName = "worklet"
+	}
+	var urls []string
+	for _, svc := range cfg.Services {
+		if !svc.IsStream() {
+			urls = append(urls, config.ServiceURL(serviceSubdomain(svc), projectName, sessionID))
+		}
+	}
+	answered := report.waitFirstResponse(ctx, urls)
+
+	mode := "copy"
+	if mountMode {
+		mode = "mount"
+	}
+	timing := report.timing(trace.FromContext(ctx), mode)
+	var history []projects.StartupTiming
+	if manager, err := projects.NewManager(); err == nil {
+		if project, err := manager.GetProject(dir); err == nil {
+			history = project.Timings
+		}
+		if err := manager.RecordTiming(dir, timing); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save startup time: %v\n", err)
+		}
+	}
+
+	fmt.Fprintln(os.Stderr)
+	printTimeReport(os.Stderr, projectName, timing, history)
+	if !answered {
+		fmt.Fprintf(os.Stderr, "The session's services didn't answer within %s, so the first response isn't included.\n", firstResponseTimeout)
+	}
+}
+
+// printTimeReport writes where a run's startup time went, comparing each
+// phase with the median of the project's earlier runs in the same mode
+func printTimeReport(w io.Writer, name string, timing projects.StartupTiming, history []projects.StartupTiming) {
+	var earlier []projects.StartupTiming
+	for _, past := range history {
+		if past.Mode == timing.Mode {
+			earlier = append(earlier, past)
+		}
+	}
+
+	fmt.Fprintf(w, "Startup time of %s (%s mode): %s\n", name, timing.Mode, formatPhaseDuration(timing.Total))
+	for _, phase := range timing.Phases {
+		var durations []time.Duration
+		for _, past := range earlier {
+			if d, ok := past.Phase(phase.Name); ok {
+				durations = append(durations, d)
+			}
+		}
+		fmt.Fprintf(w, "  %-18s %8s%s\n", phase.Name, formatPhaseDuration(phase.Duration), compareWithMedian(phase.Duration, durations))
+	}
+	var totals []time.Duration
+	for _, past := range earlier {
+		totals = append(totals, past.Total)
+	}
+	fmt.Fprintf(w, "  %-18s %8s%s\n", "total", formatPhaseDuration(timing.Total), compareWithMedian(timing.Total, totals))
+	if len(earlier) == 0 {
+		fmt.Fprintln(w, "Later runs with --time-report are compared with this one.")
+	}
+}
+
+// compareWithMedian flags a duration well over the median of earlier ones.
+// It needs a few earlier runs to go on.
+func compareWithMedian(d time.Duration, earlier []time.Duration) string {
+	if len(earlier) < 3 {
+		return ""
+	}
+	sorted := append([]time.Duration{}, earlier...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+	if d > median*3/2 && d-median > time.Second {
+		return fmt.Sprintf("  ▲ %s slower than the median of %d runs (%s)", formatPhaseDuration(d-median), len(earlier), formatPhaseDuration(median))
+	}
+	return ""
+}
+
+// formatPhaseDuration rounds a duration for the time report
+func formatPhaseDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
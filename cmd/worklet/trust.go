@@ -0,0 +1,151 @@
+package worklet
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/trust"
+	"github.com/spf13/cobra"
+)
+
+// loadTrustedRepoConfig returns a cloned repository's config once the user
+// allowed what it grants. The config is first loaded without base configs
+// from outside the repository, which are only read once they're allowed
+// too, and then asked about for what they add.
+func loadTrustedRepoConfig(repo, dir string, isClonedRepo bool) (*config.WorkletConfig, error) {
+	cfg, extends, err := config.LoadConfigLocalOrDetect(dir, isClonedRepo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := confirmRepoTrust(repo, cfg, extends); err != nil {
+		return nil, err
+	}
+	if extends == "" {
+		return cfg, nil
+	}
+	if cfg, err = config.LoadConfigOrDetect(dir, isClonedRepo); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg, confirmRepoTrust(repo, cfg, "")
+}
+
+// confirmRepoTrust asks the user to allow what a cloned repository's config
+// grants its session, and the base config it extends from outside the
+// repository if any, unless they allowed it before. With --trust it's
+// allowed without asking.
+func confirmRepoTrust(repo string, cfg *config.WorkletConfig, extends string) error {
+	grants := trust.Grants(cfg, mountMode)
+	if extends != "" {
+		grants = append(grants, trust.ExtendsGrant(extends))
+	}
+	if len(grants) == 0 {
+		return nil
+	}
+	store, err := trust.New()
+	if err != nil {
+		return err
+	}
+	unapproved, err := store.Unapproved(repo, grants)
+	if err != nil {
+		return err
+	}
+	if len(unapproved) == 0 {
+		return nil
+	}
+
+	if !runTrust {
+		fmt.Printf("%s asks for access to:\n", repo)
+		for _, grant := range unapproved {
+			fmt.Printf("  - %s\n", grant)
+		}
+		ok, err := confirm("Allow it?")
+		if err != nil {
+			return fmt.Errorf("%s needs approval, but there's no terminal to ask on; rerun with --trust to allow it", repo)
+		}
+		if !ok {
+			return fmt.Errorf("not running %s: access not allowed", repo)
+		}
+	}
+	if err := store.Approve(repo, grants); err != nil {
+		return fmt.Errorf("failed to remember approval: %w", err)
+	}
+	return nil
+}
+
+var trustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Manage cloned repositories allowed credentials and host access",
+	Long: `When worklet run clones a repository whose config grants its session
+credentials, the host's Docker daemon, a privileged container, the
+host's display, host devices or host paths, it asks first and remembers the answer per repository. Asking again
+only happens when the config grants something new.`,
+}
+
+var trustListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trusted repositories and what they were allowed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := trust.New()
+		if err != nil {
+			return err
+		}
+		approvals, err := store.All()
+		if err != nil {
+			return err
+		}
+		if len(approvals) == 0 {
+			fmt.Println("No trusted repositories.")
+			return nil
+		}
+
+		repos := make([]string, 0, len(approvals))
+		for repo := range approvals {
+			repos = append(repos, repo)
+		}
+		sort.Strings(repos)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tAPPROVED\tACCESS")
+		for _, repo := range repos {
+			approval := approvals[repo]
+			for i, grant := range approval.Grants {
+				if i == 0 {
+					fmt.Fprintf(w, "%s\t%s\t%s\n", repo, formatTime(approval.ApprovedAt), grant)
+				} else {
+					fmt.Fprintf(w, "\t\t%s\n", grant)
+				}
+			}
+		}
+		return w.Flush()
+	},
+}
+
+var trustRevokeCmd = &cobra.Command{
+	Use:   "revoke <repository>",
+	Short: "Forget what a repository was allowed, so it's asked again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := trust.New()
+		if err != nil {
+			return err
+		}
+		found, err := store.Revoke(args[0])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%s isn't trusted", args[0])
+		}
+		fmt.Printf("✓ Revoked trust in %s\n", trust.RepoKey(args[0]))
+		return nil
+	},
+}
+
+func init() {
+	trustCmd.AddCommand(trustListCmd)
+	trustCmd.AddCommand(trustRevokeCmd)
+}
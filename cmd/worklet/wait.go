@@ -0,0 +1,89 @@
+package worklet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+	"github.com/spf13/cobra"
+)
+
+var waitTimeout time.Duration
+
+// waitTimeoutExitCode is returned when --timeout expires, as by timeout(1)
+const waitTimeoutExitCode = 124
+
+var waitCmd = &cobra.Command{
+	Use:   "wait <session-id>",
+	Short: "Wait for a session's command to exit",
+	Long: `Block until a session's main command exits, print its exit code and exit
+with it, so scripts can build on detached runs. A session that has already
+exited returns straight away; if its container has been removed, the exit
+code recorded by the daemon is used.
+
+With --timeout, worklet wait gives up after the duration and exits with
+code 124.
+
+Examples:
+  worklet wait 3                  # Wait for session 3
+  worklet wait 3 --timeout 10m    # Give up after ten minutes`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessionID := args[0]
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if waitTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, waitTimeout)
+			defer cancel()
+		}
+
+		code, err := docker.WaitSession(ctx, sessionID)
+		if errors.Is(err, docker.ErrSessionNotFound) {
+			code, err = recordedExitCode(ctx, sessionID)
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			fmt.Fprintf(os.Stderr, "Timed out after %s waiting for session %s\n", waitTimeout, sessionID)
+			return silentExit(cmd, waitTimeoutExitCode)
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(code)
+		if code != 0 {
+			return silentExit(cmd, code)
+		}
+		return nil
+	},
+}
+
+func init() {
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "Give up after this long (e.g. 30s, 10m); 0 waits forever")
+}
+
+// recordedExitCode returns the exit code the daemon recorded for a session
+// whose container is gone
+func recordedExitCode(ctx context.Context, sessionID string) (int, error) {
+	client := daemon.NewClient(daemon.GetDefaultSocketPath())
+	if err := client.Connect(); err != nil {
+		return -1, fmt.Errorf("session %s not found", sessionID)
+	}
+	defer client.Close()
+
+	exit, err := client.GetExit(ctx, sessionID)
+	if daemon.IsNotFound(err) {
+		return -1, fmt.Errorf("session %s not found", sessionID)
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to get exit status: %w", err)
+	}
+	return exit.ExitCode, nil
+}
@@ -0,0 +1,183 @@
+package worklet
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/worktrees"
+)
+
+// unsafeBranchChars matches characters that can't appear in a worktree directory name
+var unsafeBranchChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// worktreePath returns the managed directory for a branch's worktree of the
+// repository rooted at repoRoot:
+// ~/.worklet/worktrees/<repo>-<hash>/<branch>-<hash>. The branch's hash
+// keeps branches whose names sanitize alike, such as feat/x and feat-x,
+// apart.
+func worktreePath(repoRoot, branch string) (string, error) {
+	repoDir, err := worktreeRepoDir(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(repoDir, fmt.Sprintf("%s-%s", sanitizeBranch(branch), shortHash(branch, 6))), nil
+}
+
+// legacyWorktreePath returns where worktrees were created before their
+// directories carried the branch's hash
+func legacyWorktreePath(repoRoot, branch string) (string, error) {
+	repoDir, err := worktreeRepoDir(repoRoot)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(repoDir, sanitizeBranch(branch)), nil
+}
+
+// worktreeRepoDir returns the directory holding the worktrees of the
+// repository rooted at repoRoot
+func worktreeRepoDir(repoRoot string) (string, error) {
+	store, err := worktrees.New()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(store.Dir(), fmt.Sprintf("%s-%s", filepath.Base(repoRoot), shortHash(repoRoot, 8))), nil
+}
+
+// sanitizeBranch turns a branch name into a directory name
+func sanitizeBranch(branch string) string {
+	return strings.Trim(unsafeBranchChars.ReplaceAllString(branch, "-"), "-")
+}
+
+// shortHash returns the first n hex digits of s's SHA-256
+func shortHash(s string, n int) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:n]
+}
+
+// findWorktree returns the existing worktree of branch of the repository
+// rooted at repoRoot, or "" if there is none. It fails if the worktree at
+// the branch's path has another branch checked out, rather than let a
+// session or command act on the wrong branch.
+func findWorktree(repoRoot, branch string) (string, error) {
+	path, err := worktreePath(repoRoot, branch)
+	if err != nil {
+		return "", err
+	}
+	legacy, err := legacyWorktreePath(repoRoot, branch)
+	if err != nil {
+		return "", err
+	}
+
+	for _, candidate := range []string{path, legacy} {
+		if _, err := os.Stat(filepath.Join(candidate, ".git")); err != nil {
+			continue
+		}
+		head, err := gitOutput(candidate, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("failed to read the branch of the worktree at %s: %w", candidate, err)
+		}
+		if head == branch {
+			return candidate, nil
+		}
+		// A legacy directory may belong to a branch that sanitizes alike
+		if candidate == path {
+			return "", fmt.Errorf("the worktree at %s has %s checked out, not %s", candidate, head, branch)
+		}
+	}
+	return "", nil
+}
+
+// ensureWorktree creates (or reuses) a git worktree of the repository
+// containing dir with branch checked out, creating the branch from HEAD if
+// it doesn't exist. It returns the worktree directory.
+func ensureWorktree(dir, branch string, out io.Writer) (string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", fmt.Errorf("--worktree requires git in PATH")
+	}
+
+	repoRoot, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", dir)
+	}
+
+	if err := exec.Command("git", "check-ref-format", "--branch", branch).Run(); err != nil {
+		return "", fmt.Errorf("invalid branch name: %s", branch)
+	}
+
+	// Reuse an existing worktree so repeated runs keep uncommitted work
+	existing, err := findWorktree(repoRoot, branch)
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		fmt.Fprintf(out, "Using existing worktree for %s at %s\n", branch, existing)
+		return existing, nil
+	}
+
+	path, err := worktreePath(repoRoot, branch)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+
+	// Check out the branch if it exists, otherwise create it from HEAD
+	args := []string{"worktree", "add", path, branch}
+	if err := exec.Command("git", "-C", repoRoot, "show-ref", "--verify", "--quiet", "refs/heads/"+branch).Run(); err != nil {
+		args = []string{"worktree", "add", "-b", branch, path}
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoRoot
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to create worktree for %s: %w", branch, err)
+	}
+
+	// Record the checkout so changes can be detected even if git can't
+	// read the worktree later
+	if err := worktrees.WriteManifest(path); err != nil {
+		fmt.Fprintf(out, "Warning: %v\n", err)
+	}
+
+	fmt.Fprintf(out, "Created worktree for %s at %s\n", branch, path)
+	return path, nil
+}
+
+// gitCommonDir returns the absolute path of the main repository's .git
+// directory for a worktree. The worktree's .git file points there by
+// absolute path, so it has to be mounted at the same path in the container
+// for git to work.
+func gitCommonDir(dir string) (string, error) {
+	commonDir, err := gitOutput(dir, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(dir, commonDir)
+	}
+	return filepath.Clean(commonDir), nil
+}
+
+// gitOutput runs a git command in dir and returns its trimmed stdout
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,85 @@
+// Package chaos describes faults injected into a session's HTTP traffic,
+// so resilience behavior can be exercised in a worklet environment.
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultErrorStatus is returned for injected errors unless another status is
+// configured
+const DefaultErrorStatus = http.StatusServiceUnavailable
+
+// Config is the chaos applied to a service's requests
+type Config struct {
+	LatencyMS   int     `json:"latency_ms,omitempty"`   // Added to every request
+	JitterMS    int     `json:"jitter_ms,omitempty"`    // Up to this much more, at random
+	ErrorRate   float64 `json:"error_rate,omitempty"`   // Fraction of requests answered with ErrorStatus
+	ErrorStatus int     `json:"error_status,omitempty"` // Status of injected errors
+}
+
+// IsZero reports whether the config injects nothing
+func (c Config) IsZero() bool {
+	return c.LatencyMS == 0 && c.JitterMS == 0 && c.ErrorRate == 0
+}
+
+// Validate checks that the config's values are in range
+func (c Config) Validate() error {
+	if c.LatencyMS < 0 || c.JitterMS < 0 {
+		return fmt.Errorf("latency and jitter can't be negative")
+	}
+	if c.ErrorRate < 0 || c.ErrorRate > 1 {
+		return fmt.Errorf("error rate %v must be between 0 and 1", c.ErrorRate)
+	}
+	if c.ErrorStatus != 0 && (c.ErrorStatus < 400 || c.ErrorStatus > 599) {
+		return fmt.Errorf("error status %d must be a 4xx or 5xx status", c.ErrorStatus)
+	}
+	return nil
+}
+
+// Status returns the status of injected errors
+func (c Config) Status() int {
+	if c.ErrorStatus == 0 {
+		return DefaultErrorStatus
+	}
+	return c.ErrorStatus
+}
+
+// Delay returns how long to hold a request: the latency plus a random part
+// of the jitter
+func (c Config) Delay(rnd *rand.Rand) time.Duration {
+	delay := time.Duration(c.LatencyMS) * time.Millisecond
+	if c.JitterMS > 0 {
+		delay += time.Duration(rnd.Int63n(int64(c.JitterMS)*int64(time.Millisecond) + 1))
+	}
+	return delay
+}
+
+// ShouldFail decides at random, at the error rate, whether to answer a
+// request with an injected error
+func (c Config) ShouldFail(rnd *rand.Rand) bool {
+	return c.ErrorRate > 0 && rnd.Float64() < c.ErrorRate
+}
+
+// String describes the config, e.g. "200ms ±50ms latency, 10% 503 errors"
+func (c Config) String() string {
+	var parts []string
+	if c.LatencyMS > 0 || c.JitterMS > 0 {
+		latency := fmt.Sprintf("%dms", c.LatencyMS)
+		if c.JitterMS > 0 {
+			latency += fmt.Sprintf(" ±%dms", c.JitterMS)
+		}
+		parts = append(parts, latency+" latency")
+	}
+	if c.ErrorRate > 0 {
+		parts = append(parts, fmt.Sprintf("%g%% %d errors", c.ErrorRate*100, c.Status()))
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
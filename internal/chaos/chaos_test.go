@@ -0,0 +1,82 @@
+package chaos
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	fixed := Config{LatencyMS: 200}
+	if got := fixed.Delay(rnd); got != 200*time.Millisecond {
+		t.Errorf("Delay() = %v, want 200ms", got)
+	}
+
+	jittered := Config{LatencyMS: 100, JitterMS: 50}
+	for i := 0; i < 100; i++ {
+		got := jittered.Delay(rnd)
+		if got < 100*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("Delay() = %v, want between 100ms and 150ms", got)
+		}
+	}
+}
+
+func TestShouldFail(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	if (Config{}).ShouldFail(rnd) {
+		t.Error("a zero error rate should never fail")
+	}
+
+	always := Config{ErrorRate: 1}
+	for i := 0; i < 100; i++ {
+		if !always.ShouldFail(rnd) {
+			t.Fatal("an error rate of 1 should always fail")
+		}
+	}
+
+	half := Config{ErrorRate: 0.5}
+	failed := 0
+	for i := 0; i < 1000; i++ {
+		if half.ShouldFail(rnd) {
+			failed++
+		}
+	}
+	if failed < 400 || failed > 600 {
+		t.Errorf("%d of 1000 requests failed at a rate of 0.5", failed)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config  Config
+		wantErr bool
+	}{
+		{Config{LatencyMS: 200, JitterMS: 50, ErrorRate: 0.1}, false},
+		{Config{ErrorRate: 1, ErrorStatus: 429}, false},
+		{Config{LatencyMS: -1}, true},
+		{Config{ErrorRate: 1.5}, true},
+		{Config{ErrorRate: 0.1, ErrorStatus: 200}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := map[string]Config{
+		"none":                                {},
+		"200ms latency":                       {LatencyMS: 200},
+		"200ms ±50ms latency, 10% 503 errors": {LatencyMS: 200, JitterMS: 50, ErrorRate: 0.1},
+		"25% 429 errors":                      {ErrorRate: 0.25, ErrorStatus: 429},
+	}
+	for want, config := range tests {
+		if got := config.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
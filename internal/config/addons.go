@@ -0,0 +1,276 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/env"
+)
+
+// AddonConfig is a common backing service worklet runs next to the session
+// on its network, for projects that don't need a compose file
+type AddonConfig struct {
+	Type    string `json:"type"`              // AddonMinIO, AddonMailHog, AddonRedis or AddonPostgres
+	Name    string `json:"name,omitempty"`    // Name in templates, env vars and its subdomain (default: Type)
+	Version string `json:"version,omitempty"` // Image tag (default: the add-on's)
+}
+
+// Types of add-ons
+const (
+	AddonMinIO    = "minio"    // S3 compatible object storage, with its console at the add-on's subdomain
+	AddonMailHog  = "mailhog"  // SMTP server catching mail, with its inbox at the add-on's subdomain
+	AddonRedis    = "redis"    // Redis
+	AddonPostgres = "postgres" // PostgreSQL
+)
+
+// addonUser is the user add-ons with accounts are set up with, and the name
+// of the database PostgreSQL creates
+const addonUser = "worklet"
+
+// addonKind is how a type of add-on is run and reached
+type addonKind struct {
+	image    string // Image without its tag
+	version  string // Default tag
+	port     int    // Port sessions connect to
+	webPort  int    // Port of its web interface, served at its subdomain
+	scheme   string // Scheme of its URL
+	user     bool   // Whether it has a user
+	password bool   // Whether it has a password
+	env      func(password string) []string
+	command  func(password string) []string
+}
+
+var addonKinds = map[string]addonKind{
+	AddonMinIO: {
+		image: "minio/minio", version: "latest", port: 9000, webPort: 9001, scheme: "http", user: true, password: true,
+		env: func(password string) []string {
+			return []string{"MINIO_ROOT_USER=" + addonUser, "MINIO_ROOT_PASSWORD=" + password}
+		},
+		command: func(string) []string { return []string{"server", "/data", "--console-address", ":9001"} },
+	},
+	AddonMailHog: {
+		image: "mailhog/mailhog", version: "latest", port: 1025, webPort: 8025, scheme: "smtp",
+	},
+	AddonRedis: {
+		image: "redis", version: "7-alpine", port: 6379, scheme: "redis", password: true,
+		command: func(password string) []string { return []string{"redis-server", "--requirepass", password} },
+	},
+	AddonPostgres: {
+		image: "postgres", version: "16-alpine", port: 5432, scheme: "postgres", user: true, password: true,
+		env: func(password string) []string {
+			return []string{"POSTGRES_USER=" + addonUser, "POSTGRES_PASSWORD=" + password, "POSTGRES_DB=" + addonUser}
+		},
+	},
+}
+
+var (
+	addonName    = regexp.MustCompile(`^[a-z][a-z0-9]{0,19}$`)
+	addonVersion = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// UnmarshalJSON also accepts a type, optionally with a version, such as
+// "postgres" or "postgres:15"
+func (a *AddonConfig) UnmarshalJSON(data []byte) error {
+	var spec string
+	if err := json.Unmarshal(data, &spec); err == nil {
+		a.Type, a.Version, _ = strings.Cut(spec, ":")
+		a.Name = ""
+		return nil
+	}
+	type plain AddonConfig
+	return json.Unmarshal(data, (*plain)(a))
+}
+
+// AddonName returns the name the add-on goes by
+func (a AddonConfig) AddonName() string {
+	if a.Name == "" {
+		return a.Type
+	}
+	return a.Name
+}
+
+// validate checks the type, name and version
+func (a AddonConfig) validate() error {
+	if _, ok := addonKinds[a.Type]; !ok {
+		return fmt.Errorf("invalid addons type %q (must be minio, mailhog, redis or postgres)", a.Type)
+	}
+	if !addonName.MatchString(a.AddonName()) {
+		return fmt.Errorf("invalid addons name %q: use up to 20 lowercase letters and digits, starting with a letter", a.AddonName())
+	}
+	if a.Version != "" && !addonVersion.MatchString(a.Version) {
+		return fmt.Errorf("invalid addons version %q", a.Version)
+	}
+	return nil
+}
+
+// validateAddons checks the add-ons and that their names are unique,
+// including among the services
+func validateAddons(addons []AddonConfig, services []ServiceConfig) error {
+	names := make(map[string]bool)
+	for _, svc := range services {
+		names[svc.Name] = true
+	}
+	for _, addon := range addons {
+		if err := addon.validate(); err != nil {
+			return err
+		}
+		if names[addon.AddonName()] {
+			return fmt.Errorf("addon %s: a service or add-on already has that name; set the add-on's name", addon.AddonName())
+		}
+		names[addon.AddonName()] = true
+	}
+	return nil
+}
+
+// Image returns the image the add-on runs
+func (a AddonConfig) Image() string {
+	kind := addonKinds[a.Type]
+	version := a.Version
+	if version == "" {
+		version = kind.version
+	}
+	return kind.image + ":" + version
+}
+
+// WebPort returns the port of the add-on's web interface, served at its
+// subdomain, or 0 if it has none
+func (a AddonConfig) WebPort() int {
+	return addonKinds[a.Type].webPort
+}
+
+// ContainerName returns the name of the add-on's container, which sessions
+// reach it at
+func (a AddonConfig) ContainerName(projectName, sessionID string) string {
+	return fmt.Sprintf("%s-%s-%s", projectName, sessionID, a.AddonName())
+}
+
+// Info returns how a session reaches the add-on and its credentials
+func (a AddonConfig) Info(projectName, sessionID string) env.AddonInfo {
+	kind := addonKinds[a.Type]
+	info := env.AddonInfo{
+		Name: a.AddonName(),
+		Host: a.ContainerName(projectName, sessionID),
+		Port: kind.port,
+	}
+	if kind.user {
+		info.User = addonUser
+	}
+	if kind.password {
+		info.Password = AddonPassword(sessionID, info.Name)
+	}
+	if a.Type == AddonPostgres {
+		info.Database = addonUser
+	}
+
+	credentials := ""
+	if info.Password != "" {
+		credentials = info.User + ":" + info.Password + "@"
+	}
+	info.URL = fmt.Sprintf("%s://%s%s:%d", kind.scheme, credentials, info.Host, info.Port)
+	if info.Database != "" {
+		info.URL += "/" + info.Database
+	}
+	if a.Type == AddonMinIO {
+		// S3 clients take the credentials apart from the endpoint
+		info.URL = fmt.Sprintf("http://%s:%d", info.Host, info.Port)
+	}
+	return info
+}
+
+// ContainerEnv returns the environment the add-on's container is started with
+func (a AddonConfig) ContainerEnv(sessionID string) []string {
+	if kind := addonKinds[a.Type]; kind.env != nil {
+		return kind.env(AddonPassword(sessionID, a.AddonName()))
+	}
+	return nil
+}
+
+// ContainerCommand returns the command the add-on's container runs, or nil
+// for its image's
+func (a AddonConfig) ContainerCommand(sessionID string) []string {
+	if kind := addonKinds[a.Type]; kind.command != nil {
+		return kind.command(AddonPassword(sessionID, a.AddonName()))
+	}
+	return nil
+}
+
+// AddonInfos returns how a session reaches each of the project's add-ons
+func (c *WorkletConfig) AddonInfos(projectName, sessionID string) []env.AddonInfo {
+	var infos []env.AddonInfo
+	for _, addon := range c.Addons {
+		infos = append(infos, addon.Info(projectName, sessionID))
+	}
+	return infos
+}
+
+// ApplyAddons adds services serving the add-ons' web interfaces at their
+// subdomains
+func (c *WorkletConfig) ApplyAddons() {
+	for _, addon := range c.Addons {
+		port := addon.WebPort()
+		if port == 0 || c.hasService(addon.AddonName()) {
+			continue
+		}
+		c.Services = append(c.Services, ServiceConfig{Name: addon.AddonName(), Port: port, Subdomain: addon.AddonName(), Addon: addon.AddonName()})
+	}
+}
+
+// hasService reports whether the project has a service named name
+func (c *WorkletConfig) hasService(name string) bool {
+	for _, svc := range c.Services {
+		if svc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddonPassword returns the password of a session's add-on. It's derived
+// from a key kept in ~/.worklet/addons.key, so every command working with
+// the session comes up with the same one without storing it.
+func AddonPassword(sessionID, name string) string {
+	mac := hmac.New(sha256.New, addonKey())
+	mac.Write([]byte(sessionID + "/" + name))
+	return hex.EncodeToString(mac.Sum(nil))[:24]
+}
+
+// addonKey returns the key add-on passwords are derived from, creating it
+// the first time
+func addonKey() []byte {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	path := filepath.Join(homeDir, ".worklet", "addons.key")
+	if key, err := os.ReadFile(path); err == nil && len(key) > 0 {
+		return key
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil
+	}
+	// Another process may have created it meanwhile; use theirs
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if existing, err := os.ReadFile(path); err == nil && len(existing) > 0 {
+			return existing
+		}
+		return nil
+	}
+	defer file.Close()
+	if _, err := file.Write(key); err != nil {
+		return nil
+	}
+	return key
+}
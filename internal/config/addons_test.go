@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAddonConfig(t *testing.T) {
+	tempHome, err := os.MkdirTemp("", "worklet-addons-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempHome)
+	t.Setenv("HOME", tempHome)
+
+	var cfg WorkletConfig
+	input := `{"services": [{"name": "web", "port": 3000}], "addons": ["postgres:15", "redis", {"type": "minio", "name": "storage"}, "mailhog"]}`
+	if err := json.Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateAddons(cfg.Addons, cfg.Services); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Addons[0].Image(); got != "postgres:15" {
+		t.Errorf("Image() = %s, want postgres:15", got)
+	}
+	if got := cfg.Addons[1].Image(); got != "redis:7-alpine" {
+		t.Errorf("Image() = %s, want redis:7-alpine", got)
+	}
+
+	infos := cfg.AddonInfos("shop", "abc123")
+	postgres := infos[0]
+	if postgres.Host != "shop-abc123-postgres" || postgres.Password == "" {
+		t.Errorf("unexpected postgres %+v", postgres)
+	}
+	if want := "postgres://worklet:" + postgres.Password + "@shop-abc123-postgres:5432/worklet"; postgres.URL != want {
+		t.Errorf("URL = %s, want %s", postgres.URL, want)
+	}
+	if !strings.HasPrefix(infos[1].URL, "redis://:") {
+		t.Errorf("unexpected redis URL %s", infos[1].URL)
+	}
+	if infos[2].Name != "storage" || infos[2].URL != "http://shop-abc123-storage:9000" {
+		t.Errorf("unexpected minio %+v", infos[2])
+	}
+	if infos[3].URL != "smtp://shop-abc123-mailhog:1025" || infos[3].Password != "" {
+		t.Errorf("unexpected mailhog %+v", infos[3])
+	}
+
+	// The password is the same every time for a session, and differs
+	// between sessions
+	if AddonPassword("abc123", "postgres") != postgres.Password || AddonPassword("def456", "postgres") == postgres.Password {
+		t.Error("expected a stable password per session")
+	}
+	if env := cfg.Addons[0].ContainerEnv("abc123"); len(env) != 3 || env[1] != "POSTGRES_PASSWORD="+postgres.Password {
+		t.Errorf("unexpected postgres env %v", env)
+	}
+
+	// Web interfaces are served at the add-ons' subdomains
+	cfg.ApplyAddons()
+	cfg.ApplyAddons()
+	if len(cfg.Services) != 3 || cfg.Services[1].Name != "storage" || cfg.Services[1].Port != 9001 || cfg.Services[2].Addon != "mailhog" {
+		t.Errorf("unexpected services %+v", cfg.Services)
+	}
+}
+
+func TestValidateAddons(t *testing.T) {
+	services := []ServiceConfig{{Name: "web", Port: 3000}}
+	invalid := []string{
+		`["mysql"]`,
+		`["redis", "redis"]`,
+		`[{"type": "redis", "name": "web"}]`,
+		`[{"type": "redis", "name": "Cache_1"}]`,
+		`["postgres:16 alpine"]`,
+	}
+	for _, input := range invalid {
+		var addons []AddonConfig
+		if err := json.Unmarshal([]byte(input), &addons); err == nil && validateAddons(addons, services) == nil {
+			t.Errorf("expected %s to be invalid", input)
+		}
+	}
+}
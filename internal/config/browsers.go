@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// BrowsersConfig installs browsers for end-to-end tests into the session
+// image and serves them through the proxy
+type BrowsersConfig struct {
+	Install []string `json:"install,omitempty"` // Playwright browsers: chromium, firefox and/or webkit (default: chromium)
+	CDP     bool     `json:"cdp,omitempty"`     // Run Chromium with the DevTools Protocol on BrowserCDPPort
+	VNC     bool     `json:"vnc,omitempty"`     // Run a virtual display and serve it with noVNC on BrowserVNCPort
+}
+
+const (
+	// BrowserCDPPort serves the DevTools Protocol of the session's Chromium,
+	// at the "cdp" subdomain
+	BrowserCDPPort = 9222
+	// BrowserVNCPort serves the virtual display in a browser through noVNC,
+	// at the "vnc" subdomain
+	BrowserVNCPort = 6080
+	// BrowserDisplay is the virtual display headed browsers open on when
+	// run.browsers.vnc is set
+	BrowserDisplay = ":99"
+)
+
+// playwrightBrowsers are the browsers run.browsers.install accepts
+var playwrightBrowsers = map[string]bool{"chromium": true, "firefox": true, "webkit": true}
+
+// UnmarshalJSON also accepts true, for Chromium with both endpoints
+func (b *BrowsersConfig) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		if !enabled {
+			return fmt.Errorf("invalid run.browsers: use true or an object, or leave it out")
+		}
+		*b = BrowsersConfig{CDP: true, VNC: true}
+		return nil
+	}
+	type plain BrowsersConfig
+	return json.Unmarshal(data, (*plain)(b))
+}
+
+// validate checks the browsers to install
+func (b *BrowsersConfig) validate() error {
+	if b == nil {
+		return nil
+	}
+	for _, browser := range b.Install {
+		if !playwrightBrowsers[browser] {
+			return fmt.Errorf("invalid run.browsers.install entry %q (must be chromium, firefox or webkit)", browser)
+		}
+	}
+	return nil
+}
+
+// Browsers returns the browsers to install
+func (b *BrowsersConfig) Browsers() []string {
+	if b == nil {
+		return nil
+	}
+	if len(b.Install) == 0 || (b.CDP && !slices.Contains(b.Install, "chromium")) {
+		// The DevTools endpoint is served by Chromium
+		return append([]string{"chromium"}, b.Install...)
+	}
+	return b.Install
+}
+
+// ApplyBrowsers adds the services run.browsers serves, unless the project
+// already has services of those names
+func (c *WorkletConfig) ApplyBrowsers() {
+	b := c.Run.Browsers
+	if b == nil {
+		return
+	}
+	add := func(name string, port int) {
+		if c.hasService(name) {
+			return
+		}
+		c.Services = append(c.Services, ServiceConfig{Name: name, Port: port, Subdomain: name})
+	}
+	if b.CDP {
+		add("cdp", BrowserCDPPort)
+	}
+	if b.VNC {
+		add("vnc", BrowserVNCPort)
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestBrowsersConfig(t *testing.T) {
+	tests := []struct {
+		input    string
+		browsers []string
+		services []string
+	}{
+		{`true`, []string{"chromium"}, []string{"cdp", "vnc"}},
+		{`{"install": ["firefox"]}`, []string{"firefox"}, nil},
+		{`{"install": ["firefox"], "cdp": true}`, []string{"chromium", "firefox"}, []string{"cdp"}},
+		{`{"install": ["chromium", "webkit"], "vnc": true}`, []string{"chromium", "webkit"}, []string{"vnc"}},
+	}
+
+	for _, tt := range tests {
+		var cfg WorkletConfig
+		if err := json.Unmarshal([]byte(`{"run": {"browsers": `+tt.input+`}}`), &cfg); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if err := cfg.Run.Browsers.validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+		}
+		if got := cfg.Run.Browsers.Browsers(); !reflect.DeepEqual(got, tt.browsers) {
+			t.Errorf("%s: Browsers() = %v, want %v", tt.input, got, tt.browsers)
+		}
+		// Applying twice doesn't add the services again
+		cfg.ApplyBrowsers()
+		cfg.ApplyBrowsers()
+		var services []string
+		for _, svc := range cfg.Services {
+			services = append(services, svc.Subdomain)
+		}
+		if !reflect.DeepEqual(services, tt.services) {
+			t.Errorf("%s: services = %v, want %v", tt.input, services, tt.services)
+		}
+	}
+
+	var cfg WorkletConfig
+	if err := json.Unmarshal([]byte(`{"run": {"browsers": {"install": ["edge"]}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Run.Browsers.validate() == nil {
+		t.Error("expected edge to be invalid")
+	}
+	if err := json.Unmarshal([]byte(`{"run": {"browsers": false}}`), &cfg); err == nil {
+		t.Error("expected false to be invalid")
+	}
+}
+
+func TestApplyBrowsersKeepsServices(t *testing.T) {
+	cfg := WorkletConfig{
+		Run:      RunConfig{Browsers: &BrowsersConfig{CDP: true, VNC: true}},
+		Services: []ServiceConfig{{Name: "vnc", Port: 5901, Subdomain: "screen"}},
+	}
+	cfg.ApplyBrowsers()
+	if len(cfg.Services) != 2 || cfg.Services[0].Port != 5901 || cfg.Services[1].Port != BrowserCDPPort {
+		t.Errorf("unexpected services %+v", cfg.Services)
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// DefaultClaudeProfile is the Claude credentials profile used until another
+// is switched to. Its volume keeps the name from before profiles existed.
+const DefaultClaudeProfile = "default"
+
+var claudeProfilePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// ValidateClaudeProfile checks the name of a Claude credentials profile,
+// which becomes part of its volume's name
+func ValidateClaudeProfile(name string) error {
+	if !claudeProfilePattern.MatchString(name) {
+		return fmt.Errorf("invalid Claude profile %q: use up to 32 lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// ClaudeVolume returns the Docker volume holding a Claude profile's
+// credentials
+func ClaudeVolume(profile string) string {
+	if profile == "" || profile == DefaultClaudeProfile {
+		return "worklet-claude-credentials"
+	}
+	return "worklet-claude-credentials-" + profile
+}
+
+// activeClaudeProfilePath returns the file naming the profile chosen with
+// `worklet credentials claude switch`
+func activeClaudeProfilePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "claude-profile"), nil
+}
+
+// ActiveClaudeProfile returns the Claude profile sessions use unless their
+// config names one
+func ActiveClaudeProfile() string {
+	path, err := activeClaudeProfilePath()
+	if err != nil {
+		return DefaultClaudeProfile
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DefaultClaudeProfile
+	}
+	if profile := strings.TrimSpace(string(data)); ValidateClaudeProfile(profile) == nil {
+		return profile
+	}
+	return DefaultClaudeProfile
+}
+
+// SetActiveClaudeProfile makes profile the one sessions use unless their
+// config names one
+func SetActiveClaudeProfile(profile string) error {
+	if err := ValidateClaudeProfile(profile); err != nil {
+		return err
+	}
+	path, err := activeClaudeProfilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create worklet directory: %w", err)
+	}
+	return storage.WriteFileAtomic(path, []byte(profile+"\n"), 0644)
+}
+
+// ClaudeProfileName returns the Claude profile a session uses: the one its
+// config names, or else the active one
+func (c *CredentialConfig) ClaudeProfileName() string {
+	if c != nil && c.ClaudeProfile != "" {
+		return c.ClaudeProfile
+	}
+	return ActiveClaudeProfile()
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// TimezoneHost is the run.timezone value that gives sessions the host's
+// timezone
+const TimezoneHost = "host"
+
+// faketimeLayout is the layout of absolute run.faketime dates
+const faketimeLayout = "2006-01-02 15:04:05"
+
+var (
+	timezoneName     = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_+-]*(/[A-Za-z0-9_+-]+)*$`)
+	faketimeRelative = regexp.MustCompile(`^[+-][0-9]+(\.[0-9]+)?[smhdy]?$`)
+)
+
+// ValidateClock checks run.timezone and run.faketime
+func (r RunConfig) ValidateClock() error {
+	if r.Timezone != "" && r.Timezone != TimezoneHost && !timezoneName.MatchString(r.Timezone) {
+		return fmt.Errorf("invalid run.timezone %q: use an IANA name such as Europe/Berlin, or %q", r.Timezone, TimezoneHost)
+	}
+	if r.Faketime == "" || faketimeRelative.MatchString(r.Faketime) {
+		return nil
+	}
+	date := r.Faketime
+	if date[0] == '@' {
+		date = date[1:]
+	}
+	if _, err := time.Parse(faketimeLayout, date); err != nil {
+		return fmt.Errorf("invalid run.faketime %q: use an offset such as +2d or -3h, a date to freeze at such as \"2024-02-29 12:00:00\", or one to start from such as \"@2024-02-29 12:00:00\"", r.Faketime)
+	}
+	return nil
+}
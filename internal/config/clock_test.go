@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestValidateClock(t *testing.T) {
+	valid := []RunConfig{
+		{},
+		{Timezone: "host"},
+		{Timezone: "America/Argentina/Buenos_Aires"},
+		{Timezone: "Etc/GMT+3"},
+		{Faketime: "+2d"},
+		{Faketime: "-1.5h"},
+		{Faketime: "2024-02-29 12:00:00"},
+		{Faketime: "@2024-02-29 12:00:00"},
+	}
+	for _, run := range valid {
+		if err := run.ValidateClock(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", run, err)
+		}
+	}
+
+	invalid := []RunConfig{
+		{Timezone: "/etc/localtime"},
+		{Timezone: "Europe/../Berlin"},
+		{Faketime: "tomorrow"},
+		{Faketime: "2d"},
+		{Faketime: "2024-02-30 12:00:00"},
+		{Faketime: "@2024-02-29"},
+	}
+	for _, run := range invalid {
+		if err := run.ValidateClock(); err == nil {
+			t.Errorf("%+v: expected an error", run)
+		}
+	}
+}
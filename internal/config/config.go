@@ -2,19 +2,44 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/tidwall/jsonc"
+	"github.com/docker/go-units"
 )
 
 type WorkletConfig struct {
-	Name     string          `json:"name"` // Project name used for container naming
+	Version  int             `json:"version,omitempty"` // Schema version; see CurrentVersion
+	Name     string          `json:"name"`              // Project name used for container naming
 	Run      RunConfig       `json:"run"`
 	Services []ServiceConfig `json:"services"`
+	PR       *PRConfig       `json:"pr,omitempty"` // Defaults for `worklet pr`
+	// Addons are backing services, such as PostgreSQL or MinIO, run next to
+	// each session without a compose file
+	Addons []AddonConfig `json:"addons,omitempty"`
+	// Alias is a name, such as "myapp-dev", the most recently started
+	// healthy session is also served under, e.g. at
+	// api.myapp-dev.local.worklet.sh
+	Alias string `json:"alias,omitempty"`
+}
+
+// PRConfig holds defaults for pull requests opened by `worklet pr`. Title
+// and Body are Go templates; see cmd/worklet/pr.go for the fields.
+type PRConfig struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Base  string `json:"base,omitempty"`  // Branch to merge into (default: the remote's default branch)
+	Draft bool   `json:"draft,omitempty"` // Open as a draft
 }
 
 type RunConfig struct {
@@ -26,43 +51,521 @@ type RunConfig struct {
 	Isolation   string            `json:"isolation"`  // "full" for DinD, "shared" for socket mount (default: "shared")
 	InitScript  []string          `json:"initScript"` // Commands to run on container start
 	Credentials *CredentialConfig `json:"credentials,omitempty"`
-	ComposePath string            `json:"composePath"` // Path to docker-compose.yml file
+	ComposePath string            `json:"composePath"`           // Path to docker-compose.yml file
+	WorkdirPath string            `json:"workdirPath,omitempty"` // Absolute path of the project inside the container (default: /workspace)
+	Mounts      []MountConfig     `json:"mounts,omitempty"`      // Extra host directories mounted in mount mode
+	Include     []string          `json:"include,omitempty"`     // Only copy matching paths into copy-mode images (gitignore syntax)
+	// How copy mode provides the workspace: "image" (default) copies it into
+	// a temporary image, "overlay" mounts it read-only under a copy-on-write
+	// layer kept in a volume
+	CopyStrategy string `json:"copyStrategy,omitempty"`
+	// Docker restart policy of the session container: "no" (default),
+	// "on-failure[:max-retries]", "unless-stopped" or "always"
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+	// Whether mount mode writes the env files generated from .env.example
+	// templates into the project directory on the host (default: true)
+	WriteEnvFiles *bool `json:"writeEnvFiles,omitempty"`
+	// Memory limit of the session container, e.g. "4g". Starting a session
+	// reserves it on the host; see `worklet run --ignore-resources`.
+	Memory string `json:"memory,omitempty"`
+	// Whether mount mode gives files the session creates as root in the
+	// project to the host user (default: true)
+	KeepHostOwnership *bool `json:"keepHostOwnership,omitempty"`
+	// Options of the Docker daemon full isolation sessions run
+	Dind *DindConfig `json:"dind,omitempty"`
+	// GPUs passed into the session: "all" or a list of device indexes or
+	// UUIDs. Needs the NVIDIA Container Toolkit; see `worklet doctor`.
+	GPUs GPUList `json:"gpus,omitempty"`
+	// Host devices passed into the session, e.g. serial ports or /dev/snd
+	Devices []DeviceConfig `json:"devices,omitempty"`
+	// Display lets GUI apps in the session open windows on your screen:
+	// DisplayAuto, DisplayX11 or DisplayWayland (default: off)
+	Display string `json:"display,omitempty"`
+	// Browsers for end-to-end tests, with DevTools and VNC endpoints
+	Browsers *BrowsersConfig `json:"browsers,omitempty"`
+	// Names added to the session's /etc/hosts, e.g. {"api.local": "host-gateway"}
+	ExtraHosts ExtraHosts `json:"extraHosts,omitempty"`
+	// Timezone of the session: an IANA name such as "Europe/Berlin", or
+	// TimezoneHost for the host's (default: the image's, usually UTC)
+	Timezone string `json:"timezone,omitempty"`
+	// Faketime shifts the session's clock with libfaketime: an offset such
+	// as "+2d", a date to freeze at, or "@" and a date to start from
+	Faketime string `json:"faketime,omitempty"`
+	// User the session's command and shells run as: a name or uid,
+	// optionally with ":group" or ":gid" (default: the image's user)
+	User string `json:"user,omitempty"`
+	// Shell that shells in the session start, by name or path (default:
+	// the user's login shell if it's bash, zsh or fish, else the first of
+	// those the image has, else sh)
+	Shell string `json:"shell,omitempty"`
+	// Whether shells are login shells, reading /etc/profile and ~/.profile
+	LoginShell bool `json:"loginShell,omitempty"`
+	// Consistency of the project's bind mount in mount mode; see
+	// MountConfig.Consistency
+	Consistency string `json:"consistency,omitempty"`
+	// Directories of the project that mount mode keeps in named volumes,
+	// e.g. ["node_modules"]
+	CacheVolumes CacheVolumes `json:"cacheVolumes,omitempty"`
+}
+
+// WritesHostEnvFiles reports whether mount mode writes generated env files
+// into the project directory
+func (r RunConfig) WritesHostEnvFiles() bool {
+	return r.WriteEnvFiles == nil || *r.WriteEnvFiles
+}
+
+// KeepsHostOwnership reports whether mount mode hands files created as
+// root in the project back to the host user
+func (r RunConfig) KeepsHostOwnership() bool {
+	return r.KeepHostOwnership == nil || *r.KeepHostOwnership
+}
+
+// MemoryLimit returns run.memory in bytes, or 0 if it isn't set
+func (r RunConfig) MemoryLimit() (int64, error) {
+	if r.Memory == "" {
+		return 0, nil
+	}
+	limit, err := units.RAMInBytes(r.Memory)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid run.memory %q: use a size such as 512m or 4g", r.Memory)
+	}
+	return limit, nil
+}
+
+// Values of run.display
+const (
+	DisplayAuto    = "auto"    // Whatever the host has: WSLg, Wayland and/or X11, or XQuartz on macOS
+	DisplayX11     = "x11"     // X11 only, which most browsers and GUI toolkits use in containers
+	DisplayWayland = "wayland" // Wayland only
+)
+
+// Values of run.copyStrategy
+const (
+	CopyStrategyImage   = "image"
+	CopyStrategyOverlay = "overlay"
+)
+
+// MountConfig is an extra host directory mounted alongside the project in
+// mount mode
+type MountConfig struct {
+	Source   string `json:"source"`             // Host path, absolute, ~-prefixed or relative to the project
+	Target   string `json:"target"`             // Absolute path inside the container
+	ReadOnly bool   `json:"readOnly,omitempty"` // Mount read-only
+	// Consistency of the bind mount on Docker Desktop for macOS with osxfs
+	// file sharing: ConsistencyConsistent, ConsistencyCached or
+	// ConsistencyDelegated
+	Consistency string `json:"consistency,omitempty"`
+}
+
+// ParseMountSpec parses a --mount value of the form source[:target][:options],
+// where options are ro or rw and a consistency, comma-separated as for
+// docker run -v. Without a target the directory is mounted at /mnt/<name>.
+// A source may be a Windows path with a drive letter, such as C:\src\lib.
+func ParseMountSpec(spec string) (MountConfig, error) {
+	parts := strings.Split(spec, ":")
+	// The colon after a drive letter doesn't separate the target. Elsewhere
+	// than on Windows, "a:/b" mounts a directory named a at /b.
+	if windowsDriveSpec.MatchString(spec) || (runtime.GOOS == "windows" && windowsDrivePath.MatchString(spec)) {
+		parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+	}
+
+	var mount MountConfig
+	if last := parts[len(parts)-1]; len(parts) > 1 && parseMountOptions(last, &mount) {
+		parts = parts[:len(parts)-1]
+	}
+
+	switch len(parts) {
+	case 1:
+		mount.Source = parts[0]
+	case 2:
+		mount.Source, mount.Target = parts[0], parts[1]
+	default:
+		return MountConfig{}, fmt.Errorf("invalid mount %q: expected source[:target][:ro,cached]", spec)
+	}
+
+	if mount.Source == "" {
+		return MountConfig{}, fmt.Errorf("invalid mount %q: missing source path", spec)
+	}
+	if mount.Target == "" {
+		name := baseName(mount.Source)
+		if name == "" || name == "." || name == ".." {
+			name = filepath.Base(filepath.Clean(HostPath(mount.Source)))
+		}
+		mount.Target = path.Join("/mnt", name)
+	}
+
+	return mount, nil
+}
+
+// parseMountOptions sets the options in a comma-separated list of them on
+// mount, reporting false if it isn't one
+func parseMountOptions(options string, mount *MountConfig) bool {
+	parsed := *mount
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "ro", "rw":
+			parsed.ReadOnly = option == "ro"
+		case ConsistencyConsistent, ConsistencyCached, ConsistencyDelegated:
+			parsed.Consistency = option
+		default:
+			return false
+		}
+	}
+	*mount = parsed
+	return true
 }
 
 type CredentialConfig struct {
 	Claude bool `json:"claude,omitempty"` // Mount Claude credentials volume
 	SSH    bool `json:"ssh,omitempty"`    // Mount SSH credentials volume
+	// ClaudeProfile picks the Claude credentials profile, e.g. "work",
+	// instead of the active one
+	ClaudeProfile string `json:"claudeProfile,omitempty"`
+	// TTL limits how long a session has the credentials, e.g. "2h". The
+	// session gets copies, which the daemon removes once it expires.
+	TTL string `json:"ttl,omitempty"`
+
+	// Short-lived cloud credentials exported from the host's CLIs, which
+	// the daemon refreshes while the session runs
+	AWS        bool   `json:"aws,omitempty"`        // AWS CLI profile, e.g. from aws sso login
+	AWSProfile string `json:"awsProfile,omitempty"` // Profile to export (default: $AWS_PROFILE or "default")
+	GCP        bool   `json:"gcp,omitempty"`        // gcloud access token and application default credentials
+	Azure      bool   `json:"azure,omitempty"`      // Azure CLI login
+
+	// Kubeconfig gives the session the host's kube contexts, only those
+	// matching KubeContexts if any are given, e.g. ["kind-*", "staging"]
+	Kubeconfig   bool     `json:"kubeconfig,omitempty"`
+	KubeContexts []string `json:"kubeContexts,omitempty"`
+	// DockerAuth gives the session the host's registry logins, with
+	// credential helpers resolved, for pulling private images
+	DockerAuth bool `json:"dockerAuth,omitempty"`
+}
+
+// Any reports whether any credentials are granted
+func (c *CredentialConfig) Any() bool {
+	return c != nil && (c.Claude || c.SSH || len(c.Exported()) > 0)
+}
+
+// validate checks the TTL, Claude profile and kube context patterns
+func (c *CredentialConfig) validate() error {
+	if _, err := c.TTLDuration(); err != nil {
+		return err
+	}
+	if c == nil {
+		return nil
+	}
+	if c.ClaudeProfile != "" {
+		if err := ValidateClaudeProfile(c.ClaudeProfile); err != nil {
+			return fmt.Errorf("run.credentials.claudeProfile: %w", err)
+		}
+	}
+	for _, pattern := range c.KubeContexts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid run.credentials.kubeContexts pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Credentials exported from the host into a session's credentials directory
+const (
+	CredentialAWS        = "aws"
+	CredentialGCP        = "gcp"
+	CredentialAzure      = "azure"
+	CredentialKubeconfig = "kubeconfig"
+	CredentialDockerAuth = "docker"
+)
+
+// Exported lists the credentials granted that are exported from the host
+func (c *CredentialConfig) Exported() []string {
+	if c == nil {
+		return nil
+	}
+	var exported []string
+	if c.AWS {
+		exported = append(exported, CredentialAWS)
+	}
+	if c.GCP {
+		exported = append(exported, CredentialGCP)
+	}
+	if c.Azure {
+		exported = append(exported, CredentialAzure)
+	}
+	if c.Kubeconfig {
+		exported = append(exported, CredentialKubeconfig)
+	}
+	if c.DockerAuth {
+		exported = append(exported, CredentialDockerAuth)
+	}
+	return exported
+}
+
+// TTLDuration returns the parsed TTL, zero when there's none
+func (c *CredentialConfig) TTLDuration() (time.Duration, error) {
+	if c == nil || c.TTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid run.credentials.ttl %q (must be a duration such as 30m or 2h)", c.TTL)
+	}
+	return ttl, nil
 }
 
 type ServiceConfig struct {
 	Name      string `json:"name"`      // Service name (e.g., "api", "frontend")
 	Port      int    `json:"port"`      // Port the service runs on inside container
 	Subdomain string `json:"subdomain"` // Subdomain prefix (e.g., "api" for api.project-name.worklet.sh)
+	// Protocol is "http" (default), or "tcp" or "udp" for services such as
+	// databases, which are reached on a localhost port instead of a subdomain
+	Protocol string `json:"protocol,omitempty"`
+	// Addon is set on the services worklet adds for add-ons' web
+	// interfaces, which are served by the add-on's container
+	Addon string `json:"-"`
 }
 
+// IsStream reports whether the service is proxied as a TCP or UDP stream
+// rather than over HTTP
+func (s ServiceConfig) IsStream() bool {
+	return s.Protocol == "tcp" || s.Protocol == "udp"
+}
+
+// ContainerWorkDir returns the path the project is mounted or copied to
+// inside the container
+func (c *WorkletConfig) ContainerWorkDir() string {
+	if c.Run.WorkdirPath == "" {
+		return DefaultWorkdirPath
+	}
+	return path.Clean(c.Run.WorkdirPath)
+}
+
+// validateWorkdirPath checks that workdirPath is an absolute path that
+// doesn't shadow the container's root
+func validateWorkdirPath(p string) error {
+	if p == "" {
+		return nil
+	}
+	if !path.IsAbs(p) {
+		return fmt.Errorf("run.workdirPath must be an absolute path: %s", p)
+	}
+	if path.Clean(p) == "/" {
+		return fmt.Errorf("run.workdirPath cannot be /")
+	}
+	return nil
+}
+
+// validateRestartPolicy checks that restartPolicy is one Docker accepts
+func validateRestartPolicy(policy string) error {
+	name, retries, hasRetries := strings.Cut(policy, ":")
+	switch name {
+	case "", "no", "always", "unless-stopped":
+		if hasRetries {
+			return fmt.Errorf("run.restartPolicy %q: only on-failure takes a retry count", policy)
+		}
+	case "on-failure":
+		if n, err := strconv.Atoi(retries); hasRetries && (err != nil || n < 0) {
+			return fmt.Errorf("run.restartPolicy %q: invalid retry count", policy)
+		}
+	default:
+		return fmt.Errorf("invalid run.restartPolicy %q (must be no, on-failure[:max-retries], unless-stopped or always)", policy)
+	}
+	return nil
+}
+
+// validateUser checks that user is a name or uid, optionally with a group
+// or gid, as docker run --user takes it
+func validateUser(user string) error {
+	if user == "" {
+		return nil
+	}
+	name, group, hasGroup := strings.Cut(user, ":")
+	if !userName.MatchString(name) || (hasGroup && !userName.MatchString(group)) {
+		return fmt.Errorf("invalid run.user %q: use a name or uid, optionally with :group or :gid", user)
+	}
+	return nil
+}
+
+var userName = regexp.MustCompile(`^([a-z_][a-z0-9_.-]{0,31}|[0-9]+)$`)
+
+var shellName = regexp.MustCompile(`^[A-Za-z0-9_./+-]+$`)
+
+// LoadConfig loads the project config in dir: .worklet.jsonc, .worklet.yaml
+// (or .yml) or .worklet.toml, merged onto the base configs it extends.
+// Without one, the error satisfies errors.Is(err, os.ErrNotExist).
 func LoadConfig(dir string) (*WorkletConfig, error) {
-	configPath := filepath.Join(dir, ".worklet.jsonc")
+	config, _, err := loadConfig(dir, false)
+	return config, err
+}
+
+// LoadConfigLocal is LoadConfig for a config that isn't trusted yet, such
+// as a cloned repository's: base configs outside its directory, downloaded
+// or local, aren't read. The source of the first one it extends is
+// returned, to be allowed before LoadConfig reads it.
+func LoadConfigLocal(dir string) (*WorkletConfig, string, error) {
+	return loadConfig(dir, true)
+}
 
-	data, err := os.ReadFile(configPath)
+func loadConfig(dir string, local bool) (*WorkletConfig, string, error) {
+	data, path, _, err := ReadConfigFile(dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, "", fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Strip JSONC comments
-	jsonData := jsonc.ToJSON(data)
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, "", fmt.Errorf("failed to parse config file: %w", err)
+	}
+	// Upgrade older schema versions in memory
+	if _, _, err := Migrate(doc); err != nil {
+		return nil, "", err
+	}
+	doc, skipped, err := applyExtends(doc, filepath.Dir(path), local)
+	if err != nil {
+		return nil, "", err
+	}
+	config, err := parseConfigDoc(doc)
+	if err != nil {
+		return nil, "", err
+	}
+	return config, skipped, nil
+}
+
+// renamedProjects are the invalid names loadedName has warned about
+var renamedProjects sync.Map
+
+// loadedName returns the project name to use for name as set in a config.
+// Configs written before names were checked may have one that's no longer
+// valid, such as "my.app": it's sanitized with a warning rather than
+// refused, unless nothing usable is left.
+func loadedName(name string) (string, error) {
+	err := ValidateName(name)
+	if err == nil {
+		return name, nil
+	}
+	sanitized := SanitizeName(name)
+	if sanitized == "" {
+		return "", err
+	}
+	if _, warned := renamedProjects.LoadOrStore(name, true); !warned {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using %q until \"name\" is changed\n", err, sanitized)
+	}
+	return sanitized, nil
+}
+
+// parseConfigDoc decodes and validates a config document with its base
+// configs merged in
+func parseConfigDoc(doc map[string]any) (*WorkletConfig, error) {
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
 
 	var config WorkletConfig
 	if err := json.Unmarshal(jsonData, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
+	if config.Name != "" {
+		name, err := loadedName(config.Name)
+		if err != nil {
+			return nil, err
+		}
+		config.Name = name
+	}
+	if config.Alias != "" && !domainLabel.MatchString(config.Alias) {
+		return nil, fmt.Errorf("invalid alias %q: use lowercase letters, digits and '-', starting and ending with a letter or digit", config.Alias)
+	}
+	if err := validateWorkdirPath(config.Run.WorkdirPath); err != nil {
+		return nil, err
+	}
+	if err := validateRestartPolicy(config.Run.RestartPolicy); err != nil {
+		return nil, err
+	}
+	if err := config.Run.Credentials.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Run.Dind.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Run.GPUs.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Run.ValidateClock(); err != nil {
+		return nil, err
+	}
+	if err := validateUser(config.Run.User); err != nil {
+		return nil, err
+	}
+	if config.Run.Shell != "" && !shellName.MatchString(config.Run.Shell) {
+		return nil, fmt.Errorf("invalid run.shell %q: use a name such as zsh or a path such as /bin/bash", config.Run.Shell)
+	}
+	if err := config.Run.ExtraHosts.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateConsistency("run.consistency", config.Run.Consistency); err != nil {
+		return nil, err
+	}
+	for _, mount := range config.Run.Mounts {
+		if err := validateConsistency("consistency of mount "+mount.Source, mount.Consistency); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.Run.CacheVolumes.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Run.Browsers.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateAddons(config.Addons, config.Services); err != nil {
+		return nil, err
+	}
+	config.ApplyBrowsers()
+	config.ApplyAddons()
+	for _, device := range config.Run.Devices {
+		if err := device.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if config.Run.Memory != "" {
+		if _, err := config.Run.MemoryLimit(); err != nil {
+			return nil, err
+		}
+	}
+	switch config.Run.Display {
+	case "", DisplayAuto, DisplayX11, DisplayWayland:
+	default:
+		return nil, fmt.Errorf("invalid run.display %q (must be auto, x11 or wayland)", config.Run.Display)
+	}
+	switch config.Run.CopyStrategy {
+	case "", CopyStrategyImage, CopyStrategyOverlay:
+	default:
+		return nil, fmt.Errorf("invalid run.copyStrategy %q (must be image or overlay)", config.Run.CopyStrategy)
+	}
+	for _, svc := range config.Services {
+		switch svc.Protocol {
+		case "", "http", "tcp", "udp":
+		default:
+			return nil, fmt.Errorf("service %s: invalid protocol %q (must be http, tcp or udp)", svc.Name, svc.Protocol)
+		}
+	}
+
 	return &config, nil
 }
 
-// LoadConfigOrDetect loads config from .worklet.jsonc or detects project type
+// LoadConfigOrDetect loads the project config or detects project type
 func LoadConfigOrDetect(dir string, isClonedRepo bool) (*WorkletConfig, error) {
+	config, _, err := loadConfigOrDetect(dir, isClonedRepo, false)
+	return config, err
+}
+
+// LoadConfigLocalOrDetect is LoadConfigOrDetect with LoadConfigLocal
+func LoadConfigLocalOrDetect(dir string, isClonedRepo bool) (*WorkletConfig, string, error) {
+	return loadConfigOrDetect(dir, isClonedRepo, true)
+}
+
+func loadConfigOrDetect(dir string, isClonedRepo, local bool) (*WorkletConfig, string, error) {
 	// First try to load existing config
-	config, err := LoadConfig(dir)
+	config, skipped, err := loadConfig(dir, local)
 	if err == nil {
 		// If it's a cloned repo and Claude is not enabled, enable it if credentials exist
 		if isClonedRepo && (config.Run.Credentials == nil || !config.Run.Credentials.Claude) {
@@ -74,20 +577,20 @@ func LoadConfigOrDetect(dir string, isClonedRepo bool) (*WorkletConfig, error) {
 				config.Run.Credentials.Claude = true
 			}
 		}
-		return config, nil
+		return config, skipped, nil
 	}
 
 	// If config doesn't exist, try to detect project type
-	if os.IsNotExist(err) || strings.Contains(err.Error(), "no such file") {
+	if errors.Is(err, os.ErrNotExist) || strings.Contains(err.Error(), "no such file") {
 		projectType, detectErr := DetectProjectType(dir)
 		if detectErr != nil {
-			return nil, fmt.Errorf("failed to detect project type: %w", detectErr)
+			return nil, "", fmt.Errorf("failed to detect project type: %w", detectErr)
 		}
 
 		// Generate default config based on detected type
 		defaultConfig, genErr := GenerateDefaultConfig(dir, projectType, isClonedRepo)
 		if genErr != nil {
-			return nil, genErr
+			return nil, "", genErr
 		}
 
 		// Log what we detected
@@ -102,18 +605,18 @@ func LoadConfigOrDetect(dir string, isClonedRepo bool) (*WorkletConfig, error) {
 			}
 		}
 
-		return defaultConfig, nil
+		return defaultConfig, "", nil
 	}
 
 	// If it's another error, return it
-	return nil, err
+	return nil, "", err
 }
 
-// hasClaudeCredentials checks if Claude credentials are configured
+// hasClaudeCredentials checks if the active Claude profile is configured
 func hasClaudeCredentials() bool {
 	// Import cycle prevention - we'll check this differently
 	// For now, we'll use a simple volume check
-	cmd := exec.Command("docker", "volume", "inspect", "worklet-claude-credentials")
+	cmd := exec.Command("docker", "volume", "inspect", ClaudeVolume(ActiveClaudeProfile()))
 	err := cmd.Run()
 	return err == nil
 }
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMountSpec(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected MountConfig
+		wantErr  bool
+	}{
+		{"/data", MountConfig{Source: "/data", Target: "/mnt/data"}, false},
+		{"/data:ro", MountConfig{Source: "/data", Target: "/mnt/data", ReadOnly: true}, false},
+		{"../lib:/libs/lib", MountConfig{Source: "../lib", Target: "/libs/lib"}, false},
+		{"../lib:/libs/lib:ro", MountConfig{Source: "../lib", Target: "/libs/lib", ReadOnly: true}, false},
+		{"../lib:/libs/lib:rw", MountConfig{Source: "../lib", Target: "/libs/lib"}, false},
+		{`C:\src\lib`, MountConfig{Source: `C:\src\lib`, Target: "/mnt/lib"}, false},
+		{`C:\src\lib:/libs/lib:ro`, MountConfig{Source: `C:\src\lib`, Target: "/libs/lib", ReadOnly: true}, false},
+		{`..\lib`, MountConfig{Source: `..\lib`, Target: "/mnt/lib"}, false},
+		{"../lib:/libs/lib:ro,cached", MountConfig{Source: "../lib", Target: "/libs/lib", ReadOnly: true, Consistency: "cached"}, false},
+		{"/data:delegated", MountConfig{Source: "/data", Target: "/mnt/data", Consistency: "delegated"}, false},
+		{":/libs", MountConfig{}, true},
+		{"a:b:c:d", MountConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMountSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMountSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("ParseMountSpec(%q) = %+v, want %+v", tt.spec, got, tt.expected)
+		}
+	}
+}
+
+func TestValidateRestartPolicy(t *testing.T) {
+	valid := []string{"", "no", "always", "unless-stopped", "on-failure", "on-failure:3"}
+	for _, policy := range valid {
+		if err := validateRestartPolicy(policy); err != nil {
+			t.Errorf("validateRestartPolicy(%q) = %v, want nil", policy, err)
+		}
+	}
+
+	invalid := []string{"sometimes", "always:3", "on-failure:", "on-failure:-1", "on-failure:x"}
+	for _, policy := range invalid {
+		if err := validateRestartPolicy(policy); err == nil {
+			t.Errorf("validateRestartPolicy(%q) = nil, want an error", policy)
+		}
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	valid := []string{"", "node", "1000", "1000:1000", "dev:staff", "_apt"}
+	for _, user := range valid {
+		if err := validateUser(user); err != nil {
+			t.Errorf("validateUser(%q) = %v, want nil", user, err)
+		}
+	}
+
+	invalid := []string{"Dev", "1000:", ":1000", "dev user", "dev;rm", "-dev"}
+	for _, user := range invalid {
+		if err := validateUser(user); err == nil {
+			t.Errorf("validateUser(%q) = nil, want an error", user)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"myapp", "My_App", "api-2"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"my app", "my.app", "-app", "app-", "@acme/app", "this-project-name-is-far-too-long-for-a-host"} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := map[string]string{
+		"@acme/My App": "acme-my-app",
+		"my.site.com":  "my-site-com",
+		"api_server":   "api_server",
+		"---":          "",
+	}
+	for input, want := range tests {
+		if got := SanitizeName(input); got != want {
+			t.Errorf("SanitizeName(%q) = %q, want %q", input, got, want)
+		}
+		if got := SanitizeName(input); got != "" && ValidateName(got) != nil {
+			t.Errorf("SanitizeName(%q) = %q, which isn't valid", input, got)
+		}
+	}
+}
+
+func TestLoadConfigSanitizesOldNames(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-name-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]string{
+		"my.app": "my-app",
+		"this-project-name-is-far-too-long-for-a-host": "this-project-name-is-far-too-long-for-a",
+		"My_App": "My_App",
+	}
+	for name, want := range tests {
+		data := `{"name": "` + name + `", "run": {"image": "node:20"}}`
+		if err := os.WriteFile(filepath.Join(dir, ".worklet.jsonc"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadConfig(dir)
+		if err != nil {
+			t.Errorf("LoadConfig() with name %q error = %v", name, err)
+			continue
+		}
+		if cfg.Name != want {
+			t.Errorf("LoadConfig() with name %q: Name = %q, want %q", name, cfg.Name, want)
+		}
+	}
+
+	// Nothing usable is still an error
+	data := `{"name": "...", "run": {"image": "node:20"}}`
+	if err := os.WriteFile(filepath.Join(dir, ".worklet.jsonc"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(dir); err == nil {
+		t.Error("LoadConfig() accepted name \"...\"")
+	}
+}
+
+func TestValidateSessionID(t *testing.T) {
+	for _, id := range []string{"3f9c2a1e", "12", "feature-x-2"} {
+		if err := ValidateSessionID(id); err != nil {
+			t.Errorf("ValidateSessionID(%q) = %v", id, err)
+		}
+	}
+	for _, id := range []string{"", "Feature", "a_b", "x-", "network", "nginx-proxy", "overlay-1", "pnpm-store-x", "abcdefghijklmnopqrstu"} {
+		if err := ValidateSessionID(id); err == nil {
+			t.Errorf("ValidateSessionID(%q) succeeded, want an error", id)
+		}
+	}
+}
+
+func TestClaudeProfiles(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-claude-profile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	if got := ActiveClaudeProfile(); got != DefaultClaudeProfile {
+		t.Errorf("ActiveClaudeProfile() = %q before switching, want %q", got, DefaultClaudeProfile)
+	}
+	if got := ClaudeVolume(DefaultClaudeProfile); got != "worklet-claude-credentials" {
+		t.Errorf("default profile volume = %q, want the original volume", got)
+	}
+	if got := ClaudeVolume("work"); got != "worklet-claude-credentials-work" {
+		t.Errorf("ClaudeVolume(work) = %q", got)
+	}
+
+	if err := SetActiveClaudeProfile("work"); err != nil {
+		t.Fatal(err)
+	}
+	creds := &CredentialConfig{Claude: true}
+	if got := creds.ClaudeProfileName(); got != "work" {
+		t.Errorf("ClaudeProfileName() = %q, want the active profile", got)
+	}
+	creds.ClaudeProfile = "personal"
+	if got := creds.ClaudeProfileName(); got != "personal" {
+		t.Errorf("ClaudeProfileName() = %q, want the config's profile", got)
+	}
+
+	for _, name := range []string{"", "Work", "../x", "a b"} {
+		if err := ValidateClaudeProfile(name); err == nil {
+			t.Errorf("ValidateClaudeProfile(%q) succeeded", name)
+		}
+	}
+	if err := ValidateSessionID("claude-credentials-work"); err == nil {
+		t.Error("session ID clashing with a Claude profile volume was accepted")
+	}
+}
+
+func TestConfigAlias(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-alias-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(alias string) {
+		data := `{"name": "shop", "alias": "` + alias + `", "run": {"image": "node:20"}}`
+		if err := os.WriteFile(filepath.Join(dir, ".worklet.jsonc"), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("shop-dev")
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Alias != "shop-dev" {
+		t.Errorf("Alias = %q, want shop-dev", cfg.Alias)
+	}
+
+	for _, alias := range []string{"Shop", "shop.dev", "-shop", "shop_dev"} {
+		write(alias)
+		if _, err := LoadConfig(dir); err == nil {
+			t.Errorf("LoadConfig() accepted alias %q", alias)
+		}
+	}
+}
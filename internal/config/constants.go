@@ -3,4 +3,7 @@ package config
 const (
 	// WorkletDomain is the base domain for all worklet services
 	WorkletDomain = "local.worklet.sh"
+
+	// DefaultWorkdirPath is where the project lives inside the container
+	DefaultWorkdirPath = "/workspace"
 )
\ No newline at end of file
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DetectDependencyDirs finds the directories of the project in dir that
+// package managers install dependencies or build native output into, which
+// are large, slow to reach through a VM's file sharing and hold binaries
+// for the platform they were built on: node_modules of the project and its
+// npm, yarn or pnpm workspace packages, a uv project's .venv (or an
+// existing one) and a Cargo project's target. The directories are relative
+// to dir, with slashes.
+func DetectDependencyDirs(dir string) []string {
+	var dirs []string
+	if fileExists(filepath.Join(dir, "package.json")) {
+		dirs = append(dirs, "node_modules")
+		for _, pkg := range nodeWorkspacePackages(dir) {
+			dirs = append(dirs, path.Join(pkg, "node_modules"))
+		}
+	}
+	if fileExists(filepath.Join(dir, "uv.lock")) || isDir(filepath.Join(dir, ".venv")) {
+		dirs = append(dirs, ".venv")
+	}
+	if fileExists(filepath.Join(dir, "Cargo.toml")) {
+		dirs = append(dirs, "target")
+	}
+	return dirs
+}
+
+// nodeWorkspacePackages returns the package directories of the npm, yarn
+// or pnpm workspace in dir, relative to it with slashes
+func nodeWorkspacePackages(dir string) []string {
+	var patterns []string
+	if pkg, err := ReadPackageJSON(dir); err == nil {
+		patterns = pkg.WorkspacePatterns()
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "pnpm-workspace.yaml")); err == nil {
+		var workspace struct {
+			Packages []string `yaml:"packages"`
+		}
+		if yaml.Unmarshal(data, &workspace) == nil {
+			patterns = append(patterns, workspace.Packages...)
+		}
+	}
+
+	var excluded []string
+	for _, pattern := range patterns {
+		if exclusion, ok := strings.CutPrefix(pattern, "!"); ok {
+			excluded = append(excluded, path.Clean(strings.TrimPrefix(exclusion, "./")))
+		}
+	}
+
+	seen := make(map[string]bool)
+	var packages []string
+	for _, pattern := range patterns {
+		// Patterns leaving the workspace don't add packages
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+		pattern = path.Clean(strings.TrimPrefix(pattern, "./"))
+		if pattern == "." || path.IsAbs(pattern) || strings.HasPrefix(pattern, "..") {
+			continue
+		}
+		// filepath.Glob has no **, so packages are looked for one level
+		// below it, where they nearly always are
+		pattern = strings.ReplaceAll(pattern, "**", "*")
+		matches, _ := filepath.Glob(filepath.Join(dir, filepath.FromSlash(pattern)))
+		for _, match := range matches {
+			rel, err := filepath.Rel(dir, match)
+			if err != nil || !fileExists(filepath.Join(match, "package.json")) {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if !seen[rel] && !strings.Contains("/"+rel+"/", "/node_modules/") && !matchesAny(excluded, rel) {
+				seen[rel] = true
+				packages = append(packages, rel)
+			}
+		}
+	}
+	sort.Strings(packages)
+	return packages
+}
+
+// matchesAny reports whether name matches one of the path.Match patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(strings.ReplaceAll(pattern, "**", "*"), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// fileExists reports whether p exists
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// isDir reports whether p is a directory
+func isDir(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && info.IsDir()
+}
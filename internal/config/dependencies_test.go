@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectDependencyDirs(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{
+			name:     "npm workspaces",
+			files:    map[string]string{"package.json": `{"workspaces": ["packages/*", "!packages/skip"]}`, "packages/web/package.json": "{}", "packages/api/package.json": "{}", "packages/skip/package.json": "{}", "packages/docs/README.md": ""},
+			expected: []string{"node_modules", "packages/api/node_modules", "packages/web/node_modules"},
+		},
+		{
+			name:     "yarn workspaces object",
+			files:    map[string]string{"package.json": `{"workspaces": {"packages": ["./apps/*"]}}`, "apps/site/package.json": "{}"},
+			expected: []string{"node_modules", "apps/site/node_modules"},
+		},
+		{
+			name:     "pnpm workspace",
+			files:    map[string]string{"package.json": "{}", "pnpm-workspace.yaml": "packages:\n  - 'libs/**'\n  - '../outside/*'\n", "libs/ui/package.json": "{}"},
+			expected: []string{"node_modules", "libs/ui/node_modules"},
+		},
+		{
+			name:     "uv and cargo",
+			files:    map[string]string{"uv.lock": "", "pyproject.toml": "", "Cargo.toml": ""},
+			expected: []string{".venv", "target"},
+		},
+		{
+			name:     "pip without a virtualenv",
+			files:    map[string]string{"requirements.txt": ""},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		dir, err := os.MkdirTemp("", "worklet-dependencies-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		for name, content := range tt.files {
+			file := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := DetectDependencyDirs(dir); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.expected)
+		}
+	}
+}
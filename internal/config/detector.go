@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/nolanleung/worklet/internal/env"
@@ -24,6 +25,23 @@ type PackageJSON struct {
 	Name    string            `json:"name"`
 	Scripts map[string]string `json:"scripts"`
 	Main    string            `json:"main"`
+	// Workspaces is a list of package directory globs, or an object with
+	// them under "packages", as yarn also accepts
+	Workspaces json.RawMessage `json:"workspaces,omitempty"`
+}
+
+// WorkspacePatterns returns the globs of the workspace's package
+// directories
+func (p *PackageJSON) WorkspacePatterns() []string {
+	var patterns []string
+	if json.Unmarshal(p.Workspaces, &patterns) == nil {
+		return patterns
+	}
+	var workspaces struct {
+		Packages []string `json:"packages"`
+	}
+	json.Unmarshal(p.Workspaces, &workspaces)
+	return workspaces.Packages
 }
 
 // DetectProjectType detects the type of project in the given directory
@@ -274,10 +292,26 @@ func DetectEnvExampleFiles(dir string) ([]string, error) {
 	return envFiles, nil
 }
 
+// envLineEnding returns the line ending env file content uses: "\r\n" for
+// files saved on Windows, else "\n"
+func envLineEnding(content string) string {
+	if strings.Contains(content, "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// envLines splits env file content into lines, without the line endings or
+// a byte order mark editors on Windows may start the file with
+func envLines(content string) []string {
+	content = strings.TrimPrefix(content, "\ufeff")
+	return strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+}
+
 // parseEnvFile parses environment file content into a map
 func parseEnvFile(content string) map[string]string {
 	envMap := make(map[string]string)
-	lines := strings.Split(content, "\n")
+	lines := envLines(content)
 	
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
@@ -310,14 +344,15 @@ func parseEnvFile(content string) map[string]string {
 	return envMap
 }
 
-// formatEnvFile formats a map back into environment file content
+// formatEnvFile formats a map back into environment file content, with the
+// original content's line endings
 func formatEnvFile(envMap map[string]string, originalContent string) string {
 	// Parse original content to preserve order and comments
 	var result []string
 	processedKeys := make(map[string]bool)
 	
 	if originalContent != "" {
-		lines := strings.Split(originalContent, "\n")
+		lines := envLines(originalContent)
 		for _, line := range lines {
 			trimmedLine := strings.TrimSpace(line)
 			
@@ -366,7 +401,7 @@ func formatEnvFile(envMap map[string]string, originalContent string) string {
 		}
 	}
 	
-	return strings.Join(result, "\n")
+	return strings.Join(result, envLineEnding(originalContent))
 }
 
 // mergeEnvMaps merges two environment maps, with updates taking precedence
@@ -392,14 +427,45 @@ func mergeEnvMaps(existing, updates map[string]string) map[string]string {
 	return merged
 }
 
-// ProcessEnvFilesWithTemplating processes .env.example files and applies templating
-// srcDir is the source directory to read .env.example files from
-// targetDir is the directory where processed .env files will be written (can be different from srcDir)
-func ProcessEnvFilesWithTemplating(srcDir, targetDir string, sessionID string, projectName string, services []ServiceConfig) error {
+// EnvFilePlan is the env file processing one .env.example file generates
+type EnvFilePlan struct {
+	Template     string            // Path of the .env.example file, relative to the source directory
+	Target       string            // Path of the generated file, relative to the target directory
+	Merged       bool              // The target exists, and its values are merged with the template's
+	Content      string            // What the target is written with
+	Placeholders []env.Placeholder // Template placeholders, resolved or not
+	Empty        []string          // Keys left with an empty value in Content
+	Owned        []string          // With Protect, the keys worklet rewrites in an existing target
+	Backup       string            // With Protect, where the target's current content is kept, if it changes
+}
+
+// EnvPlanOptions changes how env files are generated
+type EnvPlanOptions struct {
+	// Protect is for env files written into the user's working tree: of an
+	// existing file, only the keys the template fills in from placeholders
+	// are rewritten, the previous file is backed up, and the file is marked
+	// as managed by worklet.
+	Protect bool
+	// Addons are the session's add-ons, for {{addons.<name>.<property>}}
+	// placeholders
+	Addons []env.AddonInfo
+}
+
+// Env files written with Protect start with a line beginning with
+// managedEnvMarker, and their content from before that is kept with
+// envBackupSuffix
+const (
+	managedEnvMarker = "# Managed by worklet"
+	envBackupSuffix  = ".worklet.bak"
+)
+
+// PlanEnvFiles works out the env files ProcessEnvFilesWithTemplating
+// generates, without writing anything
+func PlanEnvFiles(srcDir, targetDir string, sessionID string, projectName string, services []ServiceConfig, opts EnvPlanOptions) ([]EnvFilePlan, error) {
 	// Find all .env.example files in source directory
 	envExampleFiles, err := DetectEnvExampleFiles(srcDir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Convert ServiceConfig to env.ServiceInfo
@@ -417,9 +483,12 @@ func ProcessEnvFilesWithTemplating(srcDir, targetDir string, sessionID string, p
 		SessionID:   sessionID,
 		ProjectName: projectName,
 		Services:    serviceInfos,
+		Domain:      Domain(),
+		HTTPPort:    ProxyHTTPPort(),
+		Addons:      opts.Addons,
 	}
 
-	// Process each .env.example file
+	var plans []EnvFilePlan
 	for _, exampleFile := range envExampleFiles {
 		// Read the example file from source directory
 		examplePath := filepath.Join(srcDir, exampleFile)
@@ -439,45 +508,170 @@ func ProcessEnvFilesWithTemplating(srcDir, targetDir string, sessionID string, p
 		} else {
 			continue
 		}
+		plan := EnvFilePlan{Template: exampleFile, Target: targetFile}
 
-		// Write to target directory (which may be different from source)
-		targetPath := filepath.Join(targetDir, targetFile)
+		// Process template
+		processedContent, placeholders := env.ProcessTemplateWithPlaceholders(string(content), ctx)
+		plan.Placeholders = placeholders
 
-		// Create parent directories in target if needed
-		targetSubdir := filepath.Dir(targetFile)
-		if targetSubdir != "." {
-			fullTargetDir := filepath.Join(targetDir, targetSubdir)
-			if err := os.MkdirAll(fullTargetDir, 0755); err != nil {
-				return fmt.Errorf("failed to create target directory %s: %w", fullTargetDir, err)
+		// Parse the processed .env.example into a map
+		exampleEnvMap := parseEnvFile(processedContent)
+
+		// Keys whose values come from placeholders are the ones worklet
+		// owns
+		var owned []string
+		for key, value := range parseEnvFile(string(content)) {
+			if strings.Contains(value, "{{") {
+				owned = append(owned, key)
 			}
 		}
+		sort.Strings(owned)
 
-		// Process template
-		processedContent := env.ProcessTemplate(string(content), ctx)
-		
-		// Parse the processed .env.example into a map
-		exampleEnvMap := parseEnvFile(processedContent)
-		
-		var finalContent string
-		
-		// Check if target .env already exists
-		if existingContent, err := os.ReadFile(targetPath); err == nil {
+		// Check if target .env already exists, in the target directory
+		// (which may be different from source)
+		existingContent, err := os.ReadFile(filepath.Join(targetDir, targetFile))
+		if err == nil {
 			// Target exists, merge with existing content
 			existingEnvMap := parseEnvFile(string(existingContent))
-			
-			// Merge maps: existing values are kept, but overridden by example values
-			mergedEnvMap := mergeEnvMaps(existingEnvMap, exampleEnvMap)
-			
+
+			var mergedEnvMap map[string]string
+			if opts.Protect {
+				// Only owned keys are updated; the user's other values stay
+				mergedEnvMap = mergeOwnedEnvKeys(existingEnvMap, exampleEnvMap, owned)
+			} else {
+				// Merge maps: existing values are kept, but overridden by example values
+				mergedEnvMap = mergeEnvMaps(existingEnvMap, exampleEnvMap)
+			}
+
 			// Format back to env file, preserving original structure where possible
-			finalContent = formatEnvFile(mergedEnvMap, string(existingContent))
+			plan.Content = formatEnvFile(mergedEnvMap, string(existingContent))
+			plan.Merged = true
 		} else {
 			// Target doesn't exist, use processed content directly
-			finalContent = formatEnvFile(exampleEnvMap, processedContent)
+			plan.Content = formatEnvFile(exampleEnvMap, processedContent)
+		}
+
+		if opts.Protect {
+			plan.Owned = owned
+			plan.Content = markManagedEnvFile(plan.Content, exampleFile, filepath.Base(targetFile)+envBackupSuffix, owned)
+			// Only the file from before worklet managed it is backed up, so
+			// later sessions don't overwrite the user's own version
+			if plan.Merged && string(existingContent) != plan.Content && !isManagedEnvFile(string(existingContent)) {
+				plan.Backup = targetFile + envBackupSuffix
+			}
+		}
+
+		for key, value := range parseEnvFile(plan.Content) {
+			if value == "" {
+				plan.Empty = append(plan.Empty, key)
+			}
+		}
+		sort.Strings(plan.Empty)
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// mergeOwnedEnvKeys merges an env template's values into an existing env
+// file's, only overriding the keys worklet owns. Keys the file doesn't have
+// are added.
+func mergeOwnedEnvKeys(existing, updates map[string]string, owned []string) map[string]string {
+	merged := make(map[string]string, len(existing))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range updates {
+		if _, ok := existing[k]; !ok {
+			merged[k] = v
+		}
+	}
+	for _, k := range owned {
+		if v, ok := updates[k]; ok && (v != "" || existing[k] == "") {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// isManagedEnvFile reports whether env file content has the managed marker
+func isManagedEnvFile(content string) bool {
+	for _, line := range envLines(content) {
+		if strings.HasPrefix(line, managedEnvMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+// markManagedEnvFile puts the managed marker line at the top of env file
+// content, replacing an earlier one
+func markManagedEnvFile(content, template, backup string, owned []string) string {
+	lines := envLines(content)
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, managedEnvMarker) {
+			kept = append(kept, line)
+		}
+	}
+
+	marker := fmt.Sprintf("%s from %s: ", managedEnvMarker, template)
+	if len(owned) > 0 {
+		marker += fmt.Sprintf("%s rewritten each session, other values kept. ", strings.Join(owned, ", "))
+	} else {
+		marker += "values are kept. "
+	}
+	marker += fmt.Sprintf("The version from before worklet managed it is saved as %s.", backup)
+	eol := envLineEnding(content)
+	return marker + eol + strings.Join(kept, eol)
+}
+
+// ProcessEnvFilesWithTemplating processes .env.example files and applies templating
+// srcDir is the source directory to read .env.example files from
+// targetDir is the directory where processed .env files will be written (can be different from srcDir)
+func ProcessEnvFilesWithTemplating(srcDir, targetDir string, sessionID string, projectName string, services []ServiceConfig, addons []env.AddonInfo) error {
+	return writeEnvFiles(srcDir, targetDir, sessionID, projectName, services, EnvPlanOptions{Addons: addons})
+}
+
+// ProcessHostEnvFiles is ProcessEnvFilesWithTemplating for env files written
+// into the project directory on the host, as in mount mode: the user's
+// values are protected as described by EnvPlanOptions.Protect.
+func ProcessHostEnvFiles(dir string, sessionID string, projectName string, services []ServiceConfig, addons []env.AddonInfo) error {
+	return writeEnvFiles(dir, dir, sessionID, projectName, services, EnvPlanOptions{Protect: true, Addons: addons})
+}
+
+// writeEnvFiles writes the env files PlanEnvFiles works out
+func writeEnvFiles(srcDir, targetDir string, sessionID string, projectName string, services []ServiceConfig, opts EnvPlanOptions) error {
+	plans, err := PlanEnvFiles(srcDir, targetDir, sessionID, projectName, services, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, plan := range plans {
+		// Create parent directories in target if needed
+		targetSubdir := filepath.Dir(plan.Target)
+		if targetSubdir != "." {
+			fullTargetDir := filepath.Join(targetDir, targetSubdir)
+			if err := os.MkdirAll(fullTargetDir, 0755); err != nil {
+				return fmt.Errorf("failed to create target directory %s: %w", fullTargetDir, err)
+			}
+		}
+
+		// Keep the current content before changing it
+		if plan.Backup != "" {
+			current, err := os.ReadFile(filepath.Join(targetDir, plan.Target))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", plan.Target, err)
+			}
+			if err := os.WriteFile(filepath.Join(targetDir, plan.Backup), current, 0644); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", plan.Target, err)
+			}
 		}
 
 		// Write final content to target file
-		if err := os.WriteFile(targetPath, []byte(finalContent), 0644); err != nil {
-			return fmt.Errorf("failed to write %s: %w", targetFile, err)
+		if err := os.WriteFile(filepath.Join(targetDir, plan.Target), []byte(plan.Content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", plan.Target, err)
 		}
 	}
 
@@ -486,13 +680,15 @@ func ProcessEnvFilesWithTemplating(srcDir, targetDir string, sessionID string, p
 
 // GenerateDefaultConfig generates a default config based on detected project type
 func GenerateDefaultConfig(dir string, projectType ProjectType, isClonedRepo bool) (*WorkletConfig, error) {
-	projectName := filepath.Base(dir)
+	// Directory and package names can hold characters container names
+	// and hostnames can't
+	projectName := SanitizeName(filepath.Base(dir))
 
 	switch projectType {
 	case ProjectTypeNodeJS:
 		// Try to use package.json name if available
-		if pkg, err := ReadPackageJSON(dir); err == nil && pkg.Name != "" {
-			projectName = pkg.Name
+		if pkg, err := ReadPackageJSON(dir); err == nil && SanitizeName(pkg.Name) != "" {
+			projectName = SanitizeName(pkg.Name)
 		}
 
 		command, err := DetectNodeCommand(dir)
@@ -581,8 +777,6 @@ func GenerateDefaultConfig(dir string, projectType ProjectType, isClonedRepo boo
 				Environment: map[string]string{
 					"PYTHONUNBUFFERED":                "1",
 					"COREPACK_ENABLE_DOWNLOAD_PROMPT": "0",
-					"DOCKER_TLS_CERTDIR":              "",
-					"DOCKER_DRIVER":                   "overlay2",
 				},
 				Privileged: true,
 				Isolation:  "full",
@@ -162,6 +162,25 @@ KEY3='single quotes'
 	}
 }
 
+func TestEnvFileWindowsLineEndings(t *testing.T) {
+	content := "\ufeffKEY1=old\r\n# Comment\r\nKEY2=\"quoted\"\r\n"
+
+	parsed := parseEnvFile(content)
+	if parsed["KEY1"] != "old" || parsed["KEY2"] != "quoted" {
+		t.Errorf("expected CRLF and the byte order mark to be stripped, got %q", parsed)
+	}
+
+	result := formatEnvFile(map[string]string{"KEY1": "new", "KEY2": "quoted"}, content)
+	if expected := "KEY1=new\r\n# Comment\r\nKEY2=\"quoted\"\r\n"; result != expected {
+		t.Errorf("expected the file's line endings kept, got %q", result)
+	}
+
+	marked := markManagedEnvFile(result, ".env.example", ".env.worklet.bak", nil)
+	if strings.Count(marked, "\n") != strings.Count(marked, "\r\n") {
+		t.Errorf("expected only CRLF line endings, got %q", marked)
+	}
+}
+
 func TestProcessEnvFilesWithTemplatingMerge(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir, err := os.MkdirTemp("", "worklet-test-*")
@@ -213,7 +232,7 @@ EMPTY_PLACEHOLDER=
 	}
 	
 	// Process the files
-	err = ProcessEnvFilesWithTemplating(tmpDir, tmpDir, "test-session", "test-project", services)
+	err = ProcessEnvFilesWithTemplating(tmpDir, tmpDir, "test-session", "test-project", services, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -264,4 +283,117 @@ EMPTY_PLACEHOLDER=
 	if !strings.Contains(result, "# Existing config") {
 		t.Error("Comments were not preserved")
 	}
-}
\ No newline at end of file
+}
+func TestPlanEnvFiles(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "worklet-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	envExample := "APP_URL={{services.app.url}}\nAPI_URL={{services.api.url}}\nSESSION={{ session.id }}\nOTHER={{unknown}}\nSECRET=\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ".env.example"), []byte(envExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plans, err := PlanEnvFiles(tmpDir, tmpDir, "s1", "shop", []ServiceConfig{{Name: "app", Port: 3000}}, EnvPlanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plans) != 1 {
+		t.Fatalf("PlanEnvFiles() returned %d plans, want 1", len(plans))
+	}
+	plan := plans[0]
+	if plan.Template != ".env.example" || plan.Target != ".env" || plan.Merged {
+		t.Errorf("plan = %s → %s (merged %v), want a new .env", plan.Template, plan.Target, plan.Merged)
+	}
+
+	resolved := make(map[string]bool)
+	for _, placeholder := range plan.Placeholders {
+		resolved[placeholder.Text] = placeholder.Resolved
+	}
+	want := map[string]bool{
+		"{{services.app.url}}": true,
+		"{{ session.id }}":     true,
+		"{{services.api.url}}": false,
+		"{{unknown}}":          false,
+	}
+	for text, ok := range want {
+		if got, found := resolved[text]; !found || got != ok {
+			t.Errorf("placeholder %s: resolved = %v (found %v), want %v", text, got, found, ok)
+		}
+	}
+	if len(plan.Empty) != 1 || plan.Empty[0] != "SECRET" {
+		t.Errorf("Empty = %v, want [SECRET]", plan.Empty)
+	}
+
+	// Nothing is written
+	if _, err := os.Stat(filepath.Join(tmpDir, ".env")); !os.IsNotExist(err) {
+		t.Errorf("PlanEnvFiles() wrote .env")
+	}
+}
+
+func TestProcessHostEnvFilesProtectsUserValues(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "worklet-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	envExample := "APP_URL={{services.app.url}}\nDEBUG=false\nNEW_KEY=default\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ".env.example"), []byte(envExample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	existing := "APP_URL=http://localhost:3000\nDEBUG=true\nMY_KEY=mine\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ".env"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	services := []ServiceConfig{{Name: "app", Port: 3000}}
+	if err := ProcessHostEnvFiles(tmpDir, "s1", "shop", services, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := string(data)
+
+	if !strings.HasPrefix(result, managedEnvMarker) {
+		t.Errorf(".env doesn't start with the managed marker:\n%s", result)
+	}
+	for _, want := range []string{"APP_URL=http://app.shop-s1.", "DEBUG=true", "MY_KEY=mine", "NEW_KEY=default"} {
+		if !strings.Contains(result, want) {
+			t.Errorf(".env is missing %q:\n%s", want, result)
+		}
+	}
+	backup, err := os.ReadFile(filepath.Join(tmpDir, ".env.worklet.bak"))
+	if err != nil || string(backup) != existing {
+		t.Errorf(".env.worklet.bak = %q, %v; want the previous .env", backup, err)
+	}
+
+	// Processing again keeps one marker and leaves an unchanged file alone
+	os.Remove(filepath.Join(tmpDir, ".env.worklet.bak"))
+	if err := ProcessHostEnvFiles(tmpDir, "s1", "shop", services, nil); err != nil {
+		t.Fatal(err)
+	}
+	again, _ := os.ReadFile(filepath.Join(tmpDir, ".env"))
+	if string(again) != result || strings.Count(string(again), managedEnvMarker) != 1 {
+		t.Errorf("processing again changed .env:\n%s", again)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, ".env.worklet.bak")); !os.IsNotExist(err) {
+		t.Errorf("an unchanged .env was backed up")
+	}
+
+	// Another session's rewrite keeps the backup of the user's own .env
+	if err := os.WriteFile(filepath.Join(tmpDir, ".env.worklet.bak"), []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ProcessHostEnvFiles(tmpDir, "s2", "shop", services, nil); err != nil {
+		t.Fatal(err)
+	}
+	backup, err = os.ReadFile(filepath.Join(tmpDir, ".env.worklet.bak"))
+	if err != nil || string(backup) != existing {
+		t.Errorf(".env.worklet.bak = %q, %v; want the user's .env", backup, err)
+	}
+}
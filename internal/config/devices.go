@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DeviceConfig is a host device passed into the session, such as a serial
+// port, a sound card or the USB bus
+type DeviceConfig struct {
+	Path        string `json:"path"`                  // Host device or device directory, e.g. "/dev/ttyUSB0" or "/dev/snd"
+	Target      string `json:"target,omitempty"`      // Path inside the container (default: same as Path)
+	Permissions string `json:"permissions,omitempty"` // Any of r(ead), w(rite) and m(knod) (default: "rwm")
+	// CgroupRule also allows devices that appear under Path while the
+	// session runs, such as a phone plugged in for ADB, e.g. "c 189:* rwm".
+	// Path is then mounted as a directory instead of passed as a device.
+	CgroupRule string `json:"cgroupRule,omitempty"`
+}
+
+// UnmarshalJSON also accepts docker run's --device shorthand,
+// "host[:container][:permissions]"
+func (d *DeviceConfig) UnmarshalJSON(data []byte) error {
+	var spec string
+	if err := json.Unmarshal(data, &spec); err == nil {
+		parsed, err := ParseDeviceSpec(spec)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	}
+	type plain DeviceConfig
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+// ParseDeviceSpec parses a device of the form host[:container][:permissions]
+func ParseDeviceSpec(spec string) (DeviceConfig, error) {
+	parts := strings.Split(spec, ":")
+	var device DeviceConfig
+	if last := parts[len(parts)-1]; len(parts) > 1 && devicePermissions.MatchString(last) {
+		device.Permissions = last
+		parts = parts[:len(parts)-1]
+	}
+	switch len(parts) {
+	case 1:
+		device.Path = parts[0]
+	case 2:
+		device.Path, device.Target = parts[0], parts[1]
+	default:
+		return DeviceConfig{}, fmt.Errorf("invalid device %q: expected host[:container][:permissions]", spec)
+	}
+	return device, nil
+}
+
+var (
+	devicePermissions = regexp.MustCompile(`^[rwm]{1,3}$`)
+	deviceCgroupRule  = regexp.MustCompile(`^[abc] (\d+|\*):(\d+|\*) [rwm]{1,3}$`)
+)
+
+// validate checks the paths, permissions and cgroup rule
+func (d DeviceConfig) validate() error {
+	if !path.IsAbs(d.Path) {
+		return fmt.Errorf("invalid run.devices path %q: must be absolute", d.Path)
+	}
+	if d.Target != "" && !path.IsAbs(d.Target) {
+		return fmt.Errorf("invalid run.devices target %q: must be absolute", d.Target)
+	}
+	if d.Permissions != "" && !devicePermissions.MatchString(d.Permissions) {
+		return fmt.Errorf("invalid run.devices permissions %q: use any of r, w and m", d.Permissions)
+	}
+	if d.CgroupRule != "" && !deviceCgroupRule.MatchString(d.CgroupRule) {
+		return fmt.Errorf("invalid run.devices cgroupRule %q: expected \"<type> <major>:<minor> <permissions>\", e.g. \"c 189:* rwm\"", d.CgroupRule)
+	}
+	return nil
+}
+
+// ContainerPath returns where the device is inside the container
+func (d DeviceConfig) ContainerPath() string {
+	if d.Target == "" {
+		return d.Path
+	}
+	return d.Target
+}
+
+// DockerArgs returns the docker run arguments passing the device in
+func (d DeviceConfig) DockerArgs() []string {
+	if d.CgroupRule != "" {
+		// New device nodes only show up through a mount of the directory
+		return []string{"--device-cgroup-rule", d.CgroupRule, "-v", d.Path + ":" + d.ContainerPath()}
+	}
+	spec := d.Path + ":" + d.ContainerPath()
+	if d.Permissions != "" {
+		spec += ":" + d.Permissions
+	}
+	return []string{"--device", spec}
+}
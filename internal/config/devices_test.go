@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDeviceDockerArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"/dev/ttyUSB0"`, []string{"--device", "/dev/ttyUSB0:/dev/ttyUSB0"}},
+		{`"/dev/ttyUSB0:/dev/ttyS0"`, []string{"--device", "/dev/ttyUSB0:/dev/ttyS0"}},
+		{`"/dev/snd:rw"`, []string{"--device", "/dev/snd:/dev/snd:rw"}},
+		{`{"path": "/dev/ttyACM0", "target": "/dev/arduino", "permissions": "rw"}`, []string{"--device", "/dev/ttyACM0:/dev/arduino:rw"}},
+		{`{"path": "/dev/bus/usb", "cgroupRule": "c 189:* rwm"}`, []string{"--device-cgroup-rule", "c 189:* rwm", "-v", "/dev/bus/usb:/dev/bus/usb"}},
+	}
+
+	for _, tt := range tests {
+		var device DeviceConfig
+		if err := json.Unmarshal([]byte(tt.input), &device); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if err := device.validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+		}
+		if got := device.DockerArgs(); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: DockerArgs() = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestDeviceValidate(t *testing.T) {
+	invalid := []string{
+		`"dev/ttyUSB0"`,
+		`"/dev/ttyUSB0:ttyS0"`,
+		`{"path": "/dev/ttyUSB0", "permissions": "x"}`,
+		`{"path": "/dev/bus/usb", "cgroupRule": "usb 189 rwm"}`,
+		`"/dev/a:/dev/b:/dev/c:rw"`,
+	}
+	for _, input := range invalid {
+		var device DeviceConfig
+		if err := json.Unmarshal([]byte(input), &device); err == nil && device.validate() == nil {
+			t.Errorf("expected %s to be invalid", input)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DindConfig sets options of the Docker daemon a full isolation session
+// runs. They're written to its /etc/docker/daemon.json.
+type DindConfig struct {
+	StorageDriver      string   `json:"storageDriver,omitempty"`      // e.g. "overlay2" or "vfs" (default: chosen by dockerd)
+	InsecureRegistries []string `json:"insecureRegistries,omitempty"` // Registries reached over plain HTTP, e.g. "registry.corp:5000"
+	RegistryMirrors    []string `json:"registryMirrors,omitempty"`    // Mirrors of Docker Hub, e.g. "https://mirror.gcr.io"
+	MTU                int      `json:"mtu,omitempty"`                // MTU of the daemon's networks, e.g. 1400 behind a VPN
+	DataRoot           string   `json:"dataRoot,omitempty"`           // Where the daemon keeps its data (default: /var/lib/docker)
+}
+
+// DefaultDindDataRoot is where a session's Docker daemon keeps its data
+// unless run.dind.dataRoot moves it
+const DefaultDindDataRoot = "/var/lib/docker"
+
+var storageDriverName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// validate checks the storage driver, registries, MTU and data root
+func (d *DindConfig) validate() error {
+	if d == nil {
+		return nil
+	}
+	if d.StorageDriver != "" && !storageDriverName.MatchString(d.StorageDriver) {
+		return fmt.Errorf("invalid run.dind.storageDriver %q", d.StorageDriver)
+	}
+	for _, registry := range d.InsecureRegistries {
+		if registry == "" || strings.Contains(registry, "://") || strings.ContainsAny(registry, " \t") {
+			return fmt.Errorf("invalid run.dind.insecureRegistries entry %q: use host[:port] or a CIDR, without a scheme", registry)
+		}
+	}
+	for _, mirror := range d.RegistryMirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid run.dind.registryMirrors entry %q: must be an http or https URL", mirror)
+		}
+	}
+	if d.MTU != 0 && (d.MTU < 68 || d.MTU > 65535) {
+		return fmt.Errorf("invalid run.dind.mtu %d (must be between 68 and 65535)", d.MTU)
+	}
+	if d.DataRoot != "" && (!path.IsAbs(d.DataRoot) || path.Clean(d.DataRoot) == "/") {
+		return fmt.Errorf("invalid run.dind.dataRoot %q: must be an absolute path other than /", d.DataRoot)
+	}
+	return nil
+}
+
+// DataRootPath returns where the session's Docker daemon keeps its data
+func (d *DindConfig) DataRootPath() string {
+	if d == nil || d.DataRoot == "" {
+		return DefaultDindDataRoot
+	}
+	return path.Clean(d.DataRoot)
+}
+
+// DaemonJSON renders the options as a dockerd daemon.json. mirror, if not
+// empty, is the host[:port] of a plain HTTP mirror to use ahead of the
+// configured ones, such as the daemon's registry mirror. It returns nil
+// when there's nothing to set.
+func (d *DindConfig) DaemonJSON(mirror string) ([]byte, error) {
+	var dind DindConfig
+	if d != nil {
+		dind = *d
+	}
+	options := make(map[string]any)
+	if dind.StorageDriver != "" {
+		options["storage-driver"] = dind.StorageDriver
+	}
+	insecure := dind.InsecureRegistries
+	mirrors := dind.RegistryMirrors
+	if mirror != "" {
+		insecure = append([]string{mirror}, insecure...)
+		mirrors = append([]string{"http://" + mirror}, mirrors...)
+	}
+	if len(insecure) > 0 {
+		options["insecure-registries"] = insecure
+	}
+	if len(mirrors) > 0 {
+		options["registry-mirrors"] = mirrors
+	}
+	if dind.MTU != 0 {
+		options["mtu"] = dind.MTU
+	}
+	if dind.DataRoot != "" {
+		options["data-root"] = dind.DataRootPath()
+	}
+	if len(options) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(options)
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestDindValidate(t *testing.T) {
+	invalid := []DindConfig{
+		{StorageDriver: "overlay 2"},
+		{InsecureRegistries: []string{"http://registry.corp:5000"}},
+		{RegistryMirrors: []string{"mirror.gcr.io"}},
+		{MTU: 20},
+		{DataRoot: "docker"},
+		{DataRoot: "/"},
+	}
+	for _, dind := range invalid {
+		if err := dind.validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", dind)
+		}
+	}
+
+	valid := DindConfig{
+		StorageDriver:      "vfs",
+		InsecureRegistries: []string{"registry.corp:5000", "10.0.0.0/8"},
+		RegistryMirrors:    []string{"https://mirror.gcr.io"},
+		MTU:                1400,
+		DataRoot:           "/data/docker",
+	}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	var unset *DindConfig
+	if err := unset.validate(); err != nil {
+		t.Errorf("unexpected error for no dind block: %v", err)
+	}
+}
+
+func TestDindDaemonJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		dind     *DindConfig
+		mirror   string
+		expected string
+	}{
+		{"unset", nil, "", ""},
+		{"mirror only", nil, "worklet-registry-mirror:5000",
+			`{"insecure-registries":["worklet-registry-mirror:5000"],"registry-mirrors":["http://worklet-registry-mirror:5000"]}`},
+		{"all options", &DindConfig{
+			StorageDriver:      "vfs",
+			InsecureRegistries: []string{"registry.corp:5000"},
+			RegistryMirrors:    []string{"https://mirror.gcr.io"},
+			MTU:                1400,
+			DataRoot:           "/data/docker/",
+		}, "worklet-registry-mirror:5000",
+			`{"data-root":"/data/docker","insecure-registries":["worklet-registry-mirror:5000","registry.corp:5000"],"mtu":1400,"registry-mirrors":["http://worklet-registry-mirror:5000","https://mirror.gcr.io"],"storage-driver":"vfs"}`},
+	}
+
+	for _, tt := range tests {
+		data, err := tt.dind.DaemonJSON(tt.mirror)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(data) != tt.expected {
+			t.Errorf("%s: DaemonJSON = %s, want %s", tt.name, data, tt.expected)
+		}
+	}
+
+	if got := (&DindConfig{DataRoot: "/data/docker/"}).DataRootPath(); got != "/data/docker" {
+		t.Errorf("DataRootPath = %q, want /data/docker", got)
+	}
+	if got := (*DindConfig)(nil).DataRootPath(); got != DefaultDindDataRoot {
+		t.Errorf("DataRootPath = %q, want %s", got, DefaultDindDataRoot)
+	}
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var (
+	domainOnce sync.Once
+	domain     string
+)
+
+// Domain returns the base domain of session URLs: the global config's
+// domain, or local.worklet.sh. The global config is read once per process.
+func Domain() string {
+	domainOnce.Do(func() {
+		domain = WorkletDomain
+		if global, err := LoadGlobalConfig(); err == nil && global.Domain != "" {
+			domain = global.Domain
+		}
+	})
+	return domain
+}
+
+// domainLabel matches a single DNS label
+var domainLabel = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// normalizeDomain lowercases a configured domain and drops a leading "*."
+// or trailing dot, and checks that what remains is a valid domain name
+func normalizeDomain(d string) (string, error) {
+	normalized := strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "*."), ".")
+	labels := strings.Split(normalized, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("invalid domain %q: expected a name like dev.example.test", d)
+	}
+	for _, label := range labels {
+		if !domainLabel.MatchString(label) {
+			return "", fmt.Errorf("invalid domain %q: %q is not a valid DNS label", d, label)
+		}
+	}
+	return normalized, nil
+}
+
+// CheckDomainResolves looks up a name under the session domain, which
+// only resolves if the domain has a wildcard record
+func CheckDomainResolves(d string) error {
+	name := "worklet-check." + d
+	addrs, err := net.LookupHost(name)
+	if err != nil {
+		return fmt.Errorf("%s does not resolve; session URLs under %s need a wildcard DNS record (*.%s): %w", name, d, d, err)
+	}
+	if len(addrs) == 0 {
+		return fmt.Errorf("%s resolves to no addresses", name)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// maxExtendsDepth bounds chains of configs extending each other
+const maxExtendsDepth = 8
+
+// extendsCacheTTL is how long a downloaded base config is used before it's
+// downloaded again. Pinned base configs are used for as long as they're
+// cached, as their content can't change.
+const extendsCacheTTL = time.Hour
+
+// extendsFetchTimeout bounds downloading a base config
+const extendsFetchTimeout = 30 * time.Second
+
+// extendsClient downloads https base configs
+var extendsClient = &http.Client{Timeout: extendsFetchTimeout}
+
+// Extends is the base config a project config builds on, given by its
+// "extends" field as either a source string or an object with the source
+// and a SHA-256 checksum pinning its content:
+//
+//	"extends": "../base.jsonc"
+//	"extends": {"source": "https://example.com/worklet/base.jsonc", "sha256": "..."}
+//
+// A source is a path relative to the config extending it, an https URL, or
+// git+<repository URL>#<ref>:<path> for a file in a git repository.
+type Extends struct {
+	Source string `json:"source"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// parseExtends reads the "extends" field of a parsed config document
+func parseExtends(raw any) (Extends, error) {
+	switch v := raw.(type) {
+	case string:
+		return Extends{Source: v}, nil
+	case map[string]any:
+		var ext Extends
+		data, _ := json.Marshal(v)
+		if err := json.Unmarshal(data, &ext); err != nil || ext.Source == "" {
+			return Extends{}, fmt.Errorf("invalid extends: needs a source")
+		}
+		ext.SHA256 = strings.ToLower(ext.SHA256)
+		return ext, nil
+	}
+	return Extends{}, fmt.Errorf("invalid extends: must be a source or {\"source\": ..., \"sha256\": ...}")
+}
+
+// resolveSource makes a source relative to base, the location of the
+// config naming it, absolute: a directory for local configs, a URL for
+// downloaded ones
+func resolveSource(source, base string) (string, error) {
+	switch {
+	case strings.HasPrefix(source, "git+"), strings.HasPrefix(source, "https://"):
+		return source, nil
+	case strings.HasPrefix(source, "http://"):
+		return "", fmt.Errorf("extends %s: base configs must be downloaded over https", source)
+	}
+	if strings.HasPrefix(base, "https://") {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("extends %s: %w", source, err)
+		}
+		ref, err := url.Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("extends %s: %w", source, err)
+		}
+		return baseURL.ResolveReference(ref).String(), nil
+	}
+	if strings.HasPrefix(base, "git+") {
+		return "", fmt.Errorf("extends %s: a config from a git repository can only extend an https or git source", source)
+	}
+
+	if strings.HasPrefix(source, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		source = filepath.Join(homeDir, source[2:])
+	}
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(base, source)
+	}
+	return filepath.Clean(source), nil
+}
+
+// applyExtends merges the base configs doc extends, in turn, under it.
+// dir is the directory of the config doc was read from. With local, base
+// configs outside dir aren't read: the chain stops at the first one, whose
+// source is returned.
+func applyExtends(doc map[string]any, dir string, local bool) (map[string]any, string, error) {
+	var chain []string
+	location := dir
+	for depth := 0; ; depth++ {
+		raw, ok := doc["extends"]
+		if !ok {
+			return doc, "", nil
+		}
+		delete(doc, "extends")
+		if depth == maxExtendsDepth {
+			return nil, "", fmt.Errorf("extends: more than %d base configs deep", maxExtendsDepth)
+		}
+
+		ext, err := parseExtends(raw)
+		if err != nil {
+			return nil, "", err
+		}
+		source, err := resolveSource(ext.Source, location)
+		if err != nil {
+			return nil, "", err
+		}
+		if local && !isLocalSource(source, dir) {
+			return doc, source, nil
+		}
+		for _, seen := range chain {
+			if seen == source {
+				return nil, "", fmt.Errorf("extends %s: configs extend each other", ext.Source)
+			}
+		}
+		chain = append(chain, source)
+
+		base, err := loadBaseConfig(source, ext.SHA256)
+		if err != nil {
+			return nil, "", fmt.Errorf("extends %s: %w", ext.Source, err)
+		}
+		doc = mergeConfigDocs(base, doc)
+
+		// Sources the base config extends are relative to it
+		switch {
+		case strings.HasPrefix(source, "https://"), strings.HasPrefix(source, "git+"):
+			location = source
+		default:
+			location = filepath.Dir(source)
+		}
+	}
+}
+
+// isLocalSource reports whether an absolute source is a file within dir,
+// following symlinks
+func isLocalSource(source, dir string) bool {
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "git+") {
+		return false
+	}
+	if resolved, err := filepath.EvalSymlinks(source); err == nil {
+		source = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	rel, err := filepath.Rel(dir, source)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// loadBaseConfig reads and migrates the base config at an absolute source,
+// checking it against sum if one is given
+func loadBaseConfig(source, sum string) (map[string]any, error) {
+	var raw []byte
+	var err error
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "git+") {
+		raw, err = fetchBaseConfig(source, sum)
+	} else {
+		raw, err = os.ReadFile(source)
+		if err == nil && sum != "" && checksum(raw) != sum {
+			err = fmt.Errorf("checksum mismatch: got sha256 %s", checksum(raw))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	format := FormatJSONC
+	if f, err := FormatOf(baseConfigPath(source)); err == nil {
+		format = f
+	}
+	data, err := ToJSON(raw, format)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if _, _, err := Migrate(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// baseConfigPath returns the file path part of a source, which gives its
+// format
+func baseConfigPath(source string) string {
+	if strings.HasPrefix(source, "git+") {
+		_, _, path, _ := parseGitSource(source)
+		return path
+	}
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" {
+		return u.Path
+	}
+	return source
+}
+
+// mergeConfigDocs returns override merged onto base: objects are merged key
+// by key, anything else in override, lists included, replaces base's value
+func mergeConfigDocs(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseObject, baseIsObject := merged[key].(map[string]any)
+		object, isObject := value.(map[string]any)
+		if baseIsObject && isObject {
+			merged[key] = mergeConfigDocs(baseObject, object)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// checksum returns the hex SHA-256 of data
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// extendsCachePath returns where the downloaded copy of source is kept
+func extendsCachePath(source string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "extends", checksum([]byte(source))[:16]), nil
+}
+
+// fetchBaseConfig returns the content of an https or git source. Copies are
+// cached: a pinned one is used while it matches sum, an unpinned one for
+// extendsCacheTTL, and either when downloading fails.
+func fetchBaseConfig(source, sum string) ([]byte, error) {
+	cachePath, cacheErr := extendsCachePath(source)
+	var cached []byte
+	if cacheErr == nil {
+		if info, err := os.Stat(cachePath); err == nil {
+			if data, err := os.ReadFile(cachePath); err == nil {
+				cached = data
+				if sum != "" && checksum(data) == sum {
+					return data, nil
+				}
+				if sum == "" && time.Since(info.ModTime()) < extendsCacheTTL {
+					return data, nil
+				}
+			}
+		}
+	}
+
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "git+") {
+		data, err = fetchGitFile(source)
+	} else {
+		data, err = fetchURL(source)
+	}
+	if err != nil {
+		if cached != nil && (sum == "" || checksum(cached) == sum) {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using the cached copy\n", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+	if sum != "" && checksum(data) != sum {
+		return nil, fmt.Errorf("checksum mismatch: got sha256 %s", checksum(data))
+	}
+
+	if cacheErr == nil {
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			storage.WriteFileAtomic(cachePath, data, 0644)
+		}
+	}
+	return data, nil
+}
+
+func fetchURL(source string) ([]byte, error) {
+	resp, err := extendsClient.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download base config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download base config: %s returned %s", source, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download base config: %w", err)
+	}
+	return data, nil
+}
+
+// parseGitSource splits git+<repository URL>#<ref>:<path>. The ref defaults
+// to HEAD and the path to .worklet.jsonc.
+func parseGitSource(source string) (repo, ref, path string, err error) {
+	repo, fragment, _ := strings.Cut(strings.TrimPrefix(source, "git+"), "#")
+	ref, path, _ = strings.Cut(fragment, ":")
+	if repo == "" {
+		return "", "", "", fmt.Errorf("invalid git source %q: expected git+<repository URL>#<ref>:<path>", source)
+	}
+	// Anything else, such as a local path or an ext:: command, isn't a
+	// repository a base config is shared from
+	if !strings.HasPrefix(repo, "https://") && !strings.HasPrefix(repo, "ssh://") && !strings.HasPrefix(repo, "git@") {
+		return "", "", "", fmt.Errorf("invalid git source %q: the repository must be an https://, ssh:// or git@ URL", source)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return "", "", "", fmt.Errorf("invalid git source %q: invalid ref %q", source, ref)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if path == "" {
+		path = ConfigFileNames[0]
+	}
+	return repo, ref, strings.TrimPrefix(path, "/"), nil
+}
+
+// fetchGitFile reads a file of a git source by fetching just its ref
+func fetchGitFile(source string) ([]byte, error) {
+	repo, ref, path, err := parseGitSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "worklet-extends-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), extendsFetchTimeout)
+	defer cancel()
+	git := func(args ...string) ([]byte, error) {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = tmpDir
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		return cmd.Output()
+	}
+
+	if _, err := git("init", "-q"); err != nil {
+		return nil, fmt.Errorf("failed to fetch base config: git init: %w", err)
+	}
+	if _, err := git("fetch", "-q", "--depth", "1", "--", repo, ref); err != nil {
+		return nil, fmt.Errorf("failed to fetch %s from %s: %w", ref, repo, err)
+	}
+	data, err := git("show", "FETCH_HEAD:"+path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s at %s in %s: %w", path, ref, repo, err)
+	}
+	return data, nil
+}
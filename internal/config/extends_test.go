@@ -0,0 +1,154 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfigExtends(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-extends-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, filepath.Join(dir, "org", "root.yaml"), `run:
+  image: org/base:1
+  isolation: full
+  environment:
+    LOG_LEVEL: info
+    REGION: eu
+`)
+	writeTestFile(t, filepath.Join(dir, "org", "base.jsonc"), `{
+  // Team defaults
+  "extends": "root.yaml",
+  "run": {"environment": {"LOG_LEVEL": "warn"}, "command": ["make", "dev"]}
+}`)
+	writeTestFile(t, filepath.Join(dir, "app", ".worklet.jsonc"), `{
+  "extends": "../org/base.jsonc",
+  "name": "app",
+  "run": {"environment": {"PORT": "3000"}, "command": ["npm", "start"]}
+}`)
+
+	cfg, err := LoadConfig(filepath.Join(dir, "app"))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.Name != "app" || cfg.Run.Image != "org/base:1" || cfg.Run.Isolation != "full" {
+		t.Errorf("LoadConfig() name = %q, image = %q, isolation = %q", cfg.Name, cfg.Run.Image, cfg.Run.Isolation)
+	}
+	if strings.Join(cfg.Run.Command, " ") != "npm start" {
+		t.Errorf("Run.Command = %v, want the project's list to replace the base's", cfg.Run.Command)
+	}
+	want := map[string]string{"LOG_LEVEL": "warn", "REGION": "eu", "PORT": "3000"}
+	for key, value := range want {
+		if cfg.Run.Environment[key] != value {
+			t.Errorf("Run.Environment[%s] = %q, want %q", key, cfg.Run.Environment[key], value)
+		}
+	}
+
+	// Configs extending each other are an error
+	writeTestFile(t, filepath.Join(dir, "org", "root.yaml"), "extends: base.jsonc\n")
+	if _, err := LoadConfig(filepath.Join(dir, "app")); err == nil || !strings.Contains(err.Error(), "extend each other") {
+		t.Errorf("LoadConfig() error = %v, want a cycle error", err)
+	}
+}
+
+func TestLoadConfigExtendsURL(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-extends-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	base := `{"run": {"image": "org/base:2"}}`
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(base))
+	}))
+	defer server.Close()
+	defer func(client *http.Client) { extendsClient = client }(extendsClient)
+	extendsClient = server.Client()
+
+	dir := filepath.Join(home, "app")
+	writeTestFile(t, filepath.Join(dir, ".worklet.jsonc"), `{
+  "extends": {"source": "`+server.URL+`/base.jsonc", "sha256": "`+checksum([]byte(base))+`"},
+  "name": "app"
+}`)
+
+	for i := 0; i < 2; i++ {
+		cfg, err := LoadConfig(dir)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if cfg.Run.Image != "org/base:2" {
+			t.Errorf("Run.Image = %q, want the base's", cfg.Run.Image)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("base config downloaded %d times, want once and then cached", requests)
+	}
+
+	writeTestFile(t, filepath.Join(dir, ".worklet.jsonc"), `{
+  "extends": {"source": "`+server.URL+`/base.jsonc", "sha256": "`+checksum([]byte("other"))+`"}
+}`)
+	if _, err := LoadConfig(dir); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("LoadConfig() error = %v, want a checksum mismatch", err)
+	}
+}
+
+func TestLoadConfigLocal(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-extends-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestFile(t, filepath.Join(dir, "org", "base.jsonc"), `{"run": {"image": "org/base:1"}}`)
+	writeTestFile(t, filepath.Join(dir, "app", "local.jsonc"), `{"extends": "../org/base.jsonc", "run": {"command": ["make"]}}`)
+	writeTestFile(t, filepath.Join(dir, "app", ".worklet.jsonc"), `{"extends": "local.jsonc", "name": "app"}`)
+
+	cfg, extends, err := LoadConfigLocal(filepath.Join(dir, "app"))
+	if err != nil {
+		t.Fatalf("LoadConfigLocal() error = %v", err)
+	}
+	if extends != filepath.Join(dir, "org", "base.jsonc") {
+		t.Errorf("LoadConfigLocal() extends = %q, want the base config outside the directory", extends)
+	}
+	if cfg.Run.Image != "" || strings.Join(cfg.Run.Command, " ") != "make" {
+		t.Errorf("LoadConfigLocal() image = %q, command = %v, want only the configs within the directory", cfg.Run.Image, cfg.Run.Command)
+	}
+}
+
+func TestParseGitSource(t *testing.T) {
+	repo, ref, path, err := parseGitSource("git+https://github.com/acme/base.git#v2:base.jsonc")
+	if err != nil || repo != "https://github.com/acme/base.git" || ref != "v2" || path != "base.jsonc" {
+		t.Errorf("parseGitSource() = %q, %q, %q, %v", repo, ref, path, err)
+	}
+	for _, source := range []string{
+		"git+--upload-pack=touch /tmp/x#main",
+		"git+ext::sh -c touch% /tmp/x#main",
+		"git+/srv/repo.git#main",
+		"git+https://github.com/acme/base.git#--upload-pack=x",
+	} {
+		if _, _, _, err := parseGitSource(source); err == nil {
+			t.Errorf("parseGitSource(%q) error = nil, want an error", source)
+		}
+	}
+}
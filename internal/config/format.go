@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tidwall/jsonc"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormat is the format of a project config file
+type ConfigFormat string
+
+const (
+	FormatJSONC ConfigFormat = "jsonc"
+	FormatYAML  ConfigFormat = "yaml"
+	FormatTOML  ConfigFormat = "toml"
+)
+
+// ConfigFileNames are the project config files worklet reads. A project has
+// at most one of them.
+var ConfigFileNames = []string{".worklet.jsonc", ".worklet.yaml", ".worklet.yml", ".worklet.toml"}
+
+// ConfigFileName returns the name of a project config file in format
+func ConfigFileName(format ConfigFormat) string {
+	return ".worklet." + string(format)
+}
+
+// ParseConfigFormat parses a format name as given on the command line
+func ParseConfigFormat(name string) (ConfigFormat, error) {
+	switch strings.ToLower(name) {
+	case "jsonc", "json":
+		return FormatJSONC, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "toml":
+		return FormatTOML, nil
+	}
+	return "", fmt.Errorf("unknown config format %q (must be jsonc, yaml or toml)", name)
+}
+
+// FormatOf returns the format of a config file from its extension
+func FormatOf(path string) (ConfigFormat, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "json" {
+		return FormatJSONC, nil
+	}
+	return ParseConfigFormat(ext)
+}
+
+// FindConfigFile returns the path of the project config file in dir. If
+// there is none the error satisfies os.IsNotExist; more than one is an
+// error, as it isn't clear which applies.
+func FindConfigFile(dir string) (string, error) {
+	var found []string
+	for _, name := range ConfigFileNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", &os.PathError{Op: "open", Path: filepath.Join(dir, ConfigFileNames[0]), Err: os.ErrNotExist}
+	case 1:
+		return filepath.Join(dir, found[0]), nil
+	}
+	return "", fmt.Errorf("found %s in %s; keep only one", strings.Join(found, " and "), dir)
+}
+
+// ToJSON decodes config file data in format into plain JSON, the form the
+// rest of config loading works on. Comments are dropped.
+func ToJSON(data []byte, format ConfigFormat) ([]byte, error) {
+	var doc map[string]any
+	switch format {
+	case FormatJSONC:
+		return jsonc.ToJSON(data), nil
+	case FormatYAML:
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	case FormatTOML:
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return out, nil
+}
+
+// FromJSON encodes a JSON config document in format. Keys are sorted, whole
+// numbers stay integers, and TOML leaves out null values, which it can't
+// express.
+func FromJSON(data []byte, format ConfigFormat) ([]byte, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	normalizeNumbers(doc)
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatJSONC:
+		out, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode config: %w", err)
+		}
+		buf.Write(out)
+		buf.WriteByte('\n')
+	case FormatYAML:
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, fmt.Errorf("failed to encode config: %w", err)
+		}
+		enc.Close()
+	case FormatTOML:
+		enc := toml.NewEncoder(&buf)
+		enc.Indent = ""
+		if err := enc.Encode(dropNulls(doc)); err != nil {
+			return nil, fmt.Errorf("failed to encode config: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeNumbers replaces the json.Numbers in a decoded JSON value with
+// int64 or float64, so whole numbers aren't written as floats
+func normalizeNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeNumbers(value)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// dropNulls removes null values from a decoded JSON value
+func dropNulls(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+			} else {
+				v[key] = dropNulls(value)
+			}
+		}
+	case []any:
+		kept := v[:0]
+		for _, value := range v {
+			if value != nil {
+				kept = append(kept, dropNulls(value))
+			}
+		}
+		return kept
+	}
+	return v
+}
+
+// ReadConfigFile reads the project config file in dir as plain JSON, and
+// returns its path and format
+func ReadConfigFile(dir string) (data []byte, path string, format ConfigFormat, err error) {
+	path, err = FindConfigFile(dir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	format, err = FormatOf(path)
+	if err != nil {
+		return nil, "", "", err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	data, err = ToJSON(raw, format)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return data, path, format, nil
+}
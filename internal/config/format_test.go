@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		".worklet.yaml": `name: shop
+run:
+  image: node:20
+services:
+  - name: web
+    port: 3000
+    subdomain: app
+`,
+		".worklet.toml": `name = "shop"
+
+[run]
+image = "node:20"
+
+[[services]]
+name = "web"
+port = 3000
+subdomain = "app"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			dir, err := os.MkdirTemp("", "worklet-format-test-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig(dir)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if cfg.Name != "shop" || cfg.Run.Image != "node:20" {
+				t.Errorf("LoadConfig() name = %q, image = %q", cfg.Name, cfg.Run.Image)
+			}
+			if len(cfg.Services) != 1 || cfg.Services[0].Port != 3000 || cfg.Services[0].Subdomain != "app" {
+				t.Errorf("LoadConfig() services = %+v", cfg.Services)
+			}
+		})
+	}
+}
+
+func TestFindConfigFileConflict(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-format-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := FindConfigFile(dir); !os.IsNotExist(err) {
+		t.Errorf("FindConfigFile() error = %v without a config, want not exist", err)
+	}
+
+	for _, name := range []string{".worklet.jsonc", ".worklet.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := FindConfigFile(dir); err == nil || os.IsNotExist(err) {
+		t.Errorf("FindConfigFile() error = %v with two configs, want a conflict", err)
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	original := []byte(`{
+  // The shop
+  "name": "shop",
+  "run": {"image": "node:20", "isolation": null},
+  "services": [{"name": "web", "port": 3000, "subdomain": "app"}]
+}`)
+	data, err := ToJSON(original, FormatJSONC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []ConfigFormat{FormatYAML, FormatTOML, FormatJSONC} {
+		converted, err := FromJSON(data, format)
+		if err != nil {
+			t.Fatalf("FromJSON(%s) error = %v", format, err)
+		}
+		if format == FormatTOML && strings.Contains(string(converted), "isolation") {
+			t.Errorf("FromJSON(toml) kept a null value:\n%s", converted)
+		}
+		if strings.Contains(string(converted), "3000.0") {
+			t.Errorf("FromJSON(%s) wrote an integer as a float:\n%s", format, converted)
+		}
+
+		back, err := ToJSON(converted, format)
+		if err != nil {
+			t.Fatalf("ToJSON(%s) error = %v\n%s", format, err, converted)
+		}
+		var cfg WorkletConfig
+		if err := json.Unmarshal(back, &cfg); err != nil {
+			t.Fatalf("%s round trip: %v", format, err)
+		}
+		if cfg.Name != "shop" || len(cfg.Services) != 1 || cfg.Services[0].Port != 3000 {
+			t.Errorf("%s round trip = %+v", format, cfg)
+		}
+	}
+}
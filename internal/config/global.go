@@ -0,0 +1,312 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tidwall/jsonc"
+)
+
+// GlobalConfig holds user-wide settings from ~/.worklet/config.jsonc
+type GlobalConfig struct {
+	Git       GitConfig       `json:"git"`
+	Forks     ForksConfig     `json:"forks"`
+	Sessions  SessionsConfig  `json:"sessions"`
+	Telemetry TelemetryConfig `json:"telemetry"`
+
+	Notifications NotificationsConfig `json:"notifications"`
+	Templates     TemplatesConfig     `json:"templates"`
+	Network       NetworkConfig       `json:"network"`
+	Scan          ScanConfig          `json:"scan"`
+	Prefetch      PrefetchConfig      `json:"prefetch"`
+
+	RegistryMirror RegistryMirrorConfig `json:"registryMirror"`
+	Dotfiles       DotfilesConfig       `json:"dotfiles"`
+	API            APIConfig            `json:"api"`
+
+	// Domain replaces local.worklet.sh as the base domain of session URLs,
+	// e.g. "dev.mycorp.test". It needs a wildcard DNS record pointing at
+	// the machine running the nginx proxy.
+	Domain string `json:"domain,omitempty"`
+}
+
+// SessionsConfig controls running sessions
+type SessionsConfig struct {
+	// IdleStopMinutes stops session containers with no proxied HTTP requests
+	// or exec activity for this many minutes. Zero never stops them.
+	IdleStopMinutes int `json:"idleStopMinutes,omitempty"`
+
+	// IDs is how new session IDs look: SessionIDsRandom (the default) or
+	// SessionIDsSequential
+	IDs string `json:"ids,omitempty"`
+}
+
+// Values of SessionsConfig.IDs
+const (
+	SessionIDsRandom     = "random"     // 8 hex characters, e.g. "3f9c2a1e"
+	SessionIDsSequential = "sequential" // Numbered per project: 1, 2, 3...
+)
+
+// NetworkConfig controls session networks and the proxy's addresses
+type NetworkConfig struct {
+	// IPv6 gives session networks IPv6 addresses and has the proxy listen on
+	// IPv6 too. Unset enables it where the host and Docker support it; true
+	// requires it and false turns it off.
+	IPv6 *bool `json:"ipv6,omitempty"`
+}
+
+// RegistryMirrorConfig has the daemon run a registry:2 pull-through cache
+// of Docker Hub that the Docker daemons of full isolation sessions use as a
+// mirror, so an image is only downloaded once however many sessions pull it.
+// Docker only consults mirrors for Docker Hub images.
+type RegistryMirrorConfig struct {
+	Enabled  bool   `json:"enabled,omitempty"`
+	Username string `json:"username,omitempty"` // Docker Hub login, to raise its pull rate limit
+	Token    string `json:"token,omitempty"`    // Docker Hub password or access token
+	TokenEnv string `json:"tokenEnv,omitempty"` // Environment variable to read the token from instead
+}
+
+// ResolveToken returns the configured token, reading it from TokenEnv if set
+func (m RegistryMirrorConfig) ResolveToken() string {
+	if m.TokenEnv != "" {
+		if token := os.Getenv(m.TokenEnv); token != "" {
+			return token
+		}
+	}
+	return m.Token
+}
+
+// APIConfig has the daemon also serve its API over TCP, for tools on other
+// machines or in containers. Requests need a token issued with
+// 'worklet daemon token create', whose role limits what they may do.
+// Addresses other than loopback ones need a TLS certificate, as tokens would
+// otherwise cross the network in cleartext.
+type APIConfig struct {
+	Listen  string `json:"listen,omitempty"`  // Address to listen on, e.g. "127.0.0.1:7480"
+	TLSCert string `json:"tlsCert,omitempty"` // PEM certificate file to serve TLS with
+	TLSKey  string `json:"tlsKey,omitempty"`  // PEM private key file of TLSCert
+}
+
+// DotfilesConfig installs your dotfiles in every session, so shells in it
+// have your aliases, prompt and editor config. They come from a git
+// repository or a local directory.
+type DotfilesConfig struct {
+	Repo    string `json:"repo,omitempty"`    // Git URL, or a shorthand for a host under git.hosts
+	Ref     string `json:"ref,omitempty"`     // Branch or tag of Repo (default: its default branch)
+	Path    string `json:"path,omitempty"`    // Local directory instead of a repository
+	Install string `json:"install,omitempty"` // Command installing them (default: their install script, or linking them into the home directory)
+}
+
+// Enabled reports whether dotfiles are configured
+func (d DotfilesConfig) Enabled() bool {
+	return d.Repo != "" || d.Path != ""
+}
+
+// TemplatesConfig sets where `worklet new` finds starter projects
+type TemplatesConfig struct {
+	// Index is the URL or path of the template catalog, replacing the
+	// default one
+	Index string `json:"index,omitempty"`
+}
+
+// NotificationsConfig announces sessions whose main command exited on its
+// own, rather than being stopped. The daemon sends them.
+type NotificationsConfig struct {
+	Desktop      bool   `json:"desktop,omitempty"`      // Show a desktop notification (macOS and Linux)
+	Webhook      string `json:"webhook,omitempty"`      // POST a JSON event to this URL
+	FailuresOnly bool   `json:"failuresOnly,omitempty"` // Only announce non-zero exit codes
+}
+
+// TelemetryConfig sends traces and metrics of CLI commands and daemon
+// operations to an OpenTelemetry collector. The standard OTEL_EXPORTER_OTLP_* environment
+// variables override it.
+type TelemetryConfig struct {
+	Endpoint string            `json:"endpoint,omitempty"` // OTLP/HTTP URL, e.g. "http://localhost:4318"
+	Headers  map[string]string `json:"headers,omitempty"`  // Extra headers sent to the collector
+}
+
+// ForksConfig sets the retention policy for the branch worktrees under
+// ~/.worklet/worktrees, applied by `worklet forks prune`. Zero disables a
+// limit.
+type ForksConfig struct {
+	MaxCount   int   `json:"maxCount,omitempty"`   // Keep at most this many worktrees
+	MaxSizeMB  int64 `json:"maxSizeMB,omitempty"`  // Keep the total size under this many MB
+	MaxAgeDays int   `json:"maxAgeDays,omitempty"` // Remove worktrees unused for longer than this
+}
+
+// GitConfig holds settings for cloning git URLs
+type GitConfig struct {
+	// Hosts holds per-host settings keyed by host name, optionally with a
+	// port (e.g. "git.corp.example" or "bitbucket.corp:7999")
+	Hosts map[string]GitHostConfig `json:"hosts,omitempty"`
+}
+
+// GitHostConfig holds credentials and URL settings for a single git host
+type GitHostConfig struct {
+	Username string `json:"username,omitempty"` // HTTP username, or SSH user (default: "git")
+	Token    string `json:"token,omitempty"`    // HTTP token or password
+	TokenEnv string `json:"tokenEnv,omitempty"` // Environment variable to read the token from instead
+	SSHKey   string `json:"sshKey,omitempty"`   // Private key path for SSH remotes
+
+	// Shorthand URLs like "git.corp.example/user/repo" expand using these
+	Protocol string `json:"protocol,omitempty"` // "https" (default) or "ssh"
+	SSHPort  int    `json:"sshPort,omitempty"`  // SSH port if not 22, also applied to git@host:path URLs
+
+	API string `json:"api,omitempty"` // "github" or "gitlab", for opening pull requests on self-hosted servers; "gitlab" or "bitbucket" also sends it GITLAB_TOKEN or BITBUCKET_TOKEN
+}
+
+// ExpandShorthand expands "host/owner/repo" into a clone URL for a host with
+// an entry in the config. It returns false if s isn't a shorthand for a
+// configured host.
+func (c *GlobalConfig) ExpandShorthand(s string) (string, bool) {
+	host, path, ok := strings.Cut(s, "/")
+	if !ok || path == "" || strings.Contains(host, ":") || strings.Contains(host, "@") {
+		return "", false
+	}
+	hostConfig, ok := c.GitHost(host, 0)
+	if !ok {
+		return "", false
+	}
+
+	if hostConfig.Protocol == "ssh" {
+		user := hostConfig.Username
+		if user == "" {
+			user = "git"
+		}
+		if hostConfig.SSHPort > 0 {
+			return fmt.Sprintf("ssh://%s@%s:%d/%s", user, host, hostConfig.SSHPort, path), true
+		}
+		return fmt.Sprintf("%s@%s:%s", user, host, path), true
+	}
+
+	return fmt.Sprintf("https://%s/%s", host, path), true
+}
+
+// ApplySSHPort rewrites a scp-style "user@host:path" URL into ssh:// form
+// when the host has a custom SSH port, since scp syntax can't carry a port
+func (c *GlobalConfig) ApplySSHPort(s string) string {
+	if strings.Contains(s, "://") {
+		return s
+	}
+	userHost, path, ok := strings.Cut(s, ":")
+	if !ok {
+		return s
+	}
+	user, host, ok := strings.Cut(userHost, "@")
+	if !ok {
+		return s
+	}
+	hostConfig, ok := c.GitHost(host, 0)
+	if !ok || hostConfig.SSHPort == 0 {
+		return s
+	}
+	return fmt.Sprintf("ssh://%s@%s:%d/%s", user, host, hostConfig.SSHPort, strings.TrimPrefix(path, "/"))
+}
+
+// GlobalConfigPath returns the path of the global config file
+func GlobalConfigPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "config.jsonc"), nil
+}
+
+// LoadGlobalConfig loads ~/.worklet/config.jsonc. A missing file is not an
+// error and yields an empty config.
+func LoadGlobalConfig() (*GlobalConfig, error) {
+	path, err := GlobalConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return LoadGlobalConfigFrom(path)
+}
+
+// LoadGlobalConfigFrom loads a global config file from path
+func LoadGlobalConfigFrom(path string) (*GlobalConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &GlobalConfig{}, nil
+		}
+		return nil, fmt.Errorf("failed to read global config: %w", err)
+	}
+
+	var config GlobalConfig
+	if err := json.Unmarshal(jsonc.ToJSON(data), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse global config: %w", err)
+	}
+
+	if config.Domain != "" {
+		domain, err := normalizeDomain(config.Domain)
+		if err != nil {
+			return nil, err
+		}
+		config.Domain = domain
+	}
+
+	switch config.Sessions.IDs {
+	case "", SessionIDsRandom, SessionIDsSequential:
+	default:
+		return nil, fmt.Errorf("invalid sessions.ids %q (must be %s or %s)", config.Sessions.IDs, SessionIDsRandom, SessionIDsSequential)
+	}
+
+	if webhook := config.Notifications.Webhook; webhook != "" {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid notifications.webhook %q: must be an http or https URL", webhook)
+		}
+	}
+
+	if err := config.Scan.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Prefetch.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Dotfiles.Repo != "" && config.Dotfiles.Path != "" {
+		return nil, fmt.Errorf("dotfiles takes a repo or a path, not both")
+	}
+
+	if mirror := config.RegistryMirror; mirror.Username != "" && mirror.Token == "" && mirror.TokenEnv == "" {
+		return nil, fmt.Errorf("registryMirror.username needs a token or tokenEnv")
+	}
+
+	return &config, nil
+}
+
+// GitHost returns the settings for host, preferring an entry that includes
+// the port. Host names are matched case-insensitively.
+func (c *GlobalConfig) GitHost(host string, port int) (GitHostConfig, bool) {
+	var candidates []string
+	if port > 0 {
+		candidates = append(candidates, fmt.Sprintf("%s:%d", host, port))
+	}
+	candidates = append(candidates, host)
+
+	for _, candidate := range candidates {
+		for name, hostConfig := range c.Git.Hosts {
+			if strings.EqualFold(name, candidate) {
+				return hostConfig, true
+			}
+		}
+	}
+
+	return GitHostConfig{}, false
+}
+
+// ResolveToken returns the configured token, reading it from TokenEnv if set
+func (h GitHostConfig) ResolveToken() string {
+	if h.TokenEnv != "" {
+		if token := os.Getenv(h.TokenEnv); token != "" {
+			return token
+		}
+	}
+	return h.Token
+}
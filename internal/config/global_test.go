@@ -0,0 +1,172 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandShorthand(t *testing.T) {
+	global := &GlobalConfig{Git: GitConfig{Hosts: map[string]GitHostConfig{
+		"git.corp.example": {},
+		"gitea.internal":   {Protocol: "ssh", SSHPort: 2222},
+		"gitlab.internal":  {Protocol: "ssh", Username: "gitlab"},
+	}}}
+
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"git.corp.example/user/repo", "https://git.corp.example/user/repo", true},
+		{"gitea.internal/user/repo", "ssh://git@gitea.internal:2222/user/repo", true},
+		{"gitlab.internal/group/sub/repo", "gitlab@gitlab.internal:group/sub/repo", true},
+		{"unknown.example/user/repo", "", false},
+		{"user/repo", "", false},
+		{"git.corp.example", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := global.ExpandShorthand(tt.input)
+		if ok != tt.ok || got != tt.expected {
+			t.Errorf("ExpandShorthand(%q) = %q, %v; want %q, %v", tt.input, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestApplySSHPort(t *testing.T) {
+	global := &GlobalConfig{Git: GitConfig{Hosts: map[string]GitHostConfig{
+		"gitea.internal": {SSHPort: 2222},
+	}}}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"git@gitea.internal:user/repo.git", "ssh://git@gitea.internal:2222/user/repo.git"},
+		{"git@github.com:user/repo.git", "git@github.com:user/repo.git"},
+		{"https://gitea.internal/user/repo.git", "https://gitea.internal/user/repo.git"},
+	}
+
+	for _, tt := range tests {
+		if got := global.ApplySSHPort(tt.input); got != tt.expected {
+			t.Errorf("ApplySSHPort(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"dev.mycorp.test", "dev.mycorp.test", false},
+		{"*.Dev.MyCorp.test.", "dev.mycorp.test", false},
+		{"localhost", "", true},
+		{"http://dev.mycorp.test", "", true},
+		{"dev..test", "", true},
+		{"-dev.test", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeDomain(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("normalizeDomain(%q) = %q, %v; want %q, error %v", tt.input, got, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadGlobalConfigWebhook(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-global-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.jsonc")
+
+	tests := []struct {
+		webhook string
+		ok      bool
+	}{
+		{"https://hooks.example.com/worklet", true},
+		{"http://localhost:8080/hook", true},
+		{"hooks.example.com/worklet", false},
+		{"ftp://hooks.example.com", false},
+	}
+	for _, tt := range tests {
+		data := `{"notifications": {"desktop": true, "webhook": "` + tt.webhook + `"}}`
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		global, err := LoadGlobalConfigFrom(path)
+		if (err == nil) != tt.ok {
+			t.Errorf("webhook %q: err = %v, want ok = %v", tt.webhook, err, tt.ok)
+		}
+		if err == nil && (!global.Notifications.Desktop || global.Notifications.Webhook != tt.webhook) {
+			t.Errorf("webhook %q: notifications = %+v", tt.webhook, global.Notifications)
+		}
+	}
+}
+
+func TestLoadGlobalConfigRegistryMirror(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-global-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.jsonc")
+
+	tests := []struct {
+		mirror string
+		ok     bool
+	}{
+		{`{"enabled": true}`, true},
+		{`{"enabled": true, "username": "me", "tokenEnv": "DOCKERHUB_TOKEN"}`, true},
+		{`{"enabled": true, "username": "me"}`, false},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(`{"registryMirror": `+tt.mirror+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		global, err := LoadGlobalConfigFrom(path)
+		if (err == nil) != tt.ok {
+			t.Errorf("registryMirror %s: err = %v, want ok = %v", tt.mirror, err, tt.ok)
+		}
+		if err == nil && !global.RegistryMirror.Enabled {
+			t.Errorf("registryMirror %s: expected it to be enabled", tt.mirror)
+		}
+	}
+}
+
+func TestLoadGlobalConfigDotfiles(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-global-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.jsonc")
+
+	tests := []struct {
+		dotfiles string
+		enabled  bool
+		ok       bool
+	}{
+		{`{}`, false, true},
+		{`{"repo": "github.com/me/dotfiles", "ref": "main"}`, true, true},
+		{`{"path": "~/dotfiles", "install": "make install"}`, true, true},
+		{`{"repo": "github.com/me/dotfiles", "path": "~/dotfiles"}`, false, false},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(`{"dotfiles": `+tt.dotfiles+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		global, err := LoadGlobalConfigFrom(path)
+		if (err == nil) != tt.ok {
+			t.Errorf("dotfiles %s: err = %v, want ok = %v", tt.dotfiles, err, tt.ok)
+		}
+		if err == nil && global.Dotfiles.Enabled() != tt.enabled {
+			t.Errorf("dotfiles %s: Enabled() = %v, want %v", tt.dotfiles, global.Dotfiles.Enabled(), tt.enabled)
+		}
+	}
+}
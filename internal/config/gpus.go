@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// GPUList is run.gpus: "all", or a list of the GPUs to pass in by index or
+// UUID, e.g. [0, 1] or ["GPU-3a2c..."]
+type GPUList []string
+
+// UnmarshalJSON accepts "all", a single device, or a list of devices given
+// as strings or numbers
+func (g *GPUList) UnmarshalJSON(data []byte) error {
+	var single any
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	items, ok := single.([]any)
+	if !ok {
+		items = []any{single}
+	}
+	var devices GPUList
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			devices = append(devices, strings.TrimSpace(v))
+		case float64:
+			if v < 0 || v != float64(int(v)) {
+				return fmt.Errorf("invalid run.gpus device %v", v)
+			}
+			devices = append(devices, fmt.Sprint(int(v)))
+		default:
+			return fmt.Errorf("invalid run.gpus: use \"all\" or a list of device indexes or UUIDs")
+		}
+	}
+	*g = devices
+	return nil
+}
+
+// MarshalJSON writes "all" back as a string
+func (g GPUList) MarshalJSON() ([]byte, error) {
+	if g.All() {
+		return json.Marshal("all")
+	}
+	return json.Marshal([]string(g))
+}
+
+// All reports whether every GPU is passed in
+func (g GPUList) All() bool {
+	return len(g) == 1 && g[0] == "all"
+}
+
+// validate checks that devices are named and "all" stands alone
+func (g GPUList) validate() error {
+	for _, device := range g {
+		if device == "" || strings.ContainsAny(device, ", \t\"") {
+			return fmt.Errorf("invalid run.gpus device %q", device)
+		}
+		if device == "all" && len(g) > 1 {
+			return fmt.Errorf("invalid run.gpus: \"all\" can't be combined with other devices")
+		}
+	}
+	return nil
+}
+
+// DockerFlag returns the value of docker run's --gpus for the devices
+func (g GPUList) DockerFlag() string {
+	if g.All() {
+		return "all"
+	}
+	// Docker reads the value as CSV, so a list needs quoting
+	return fmt.Sprintf(`"device=%s"`, strings.Join(g, ","))
+}
+
+// VisibleDevices returns the value of NVIDIA_VISIBLE_DEVICES for the devices
+func (g GPUList) VisibleDevices() string {
+	return strings.Join(g, ",")
+}
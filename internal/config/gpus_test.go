@@ -0,0 +1,47 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGPUList(t *testing.T) {
+	tests := []struct {
+		input   string
+		flag    string
+		visible string
+	}{
+		{`"all"`, "all", "all"},
+		{`0`, `"device=0"`, "0"},
+		{`[0, 1]`, `"device=0,1"`, "0,1"},
+		{`["GPU-3a2c", 2]`, `"device=GPU-3a2c,2"`, "GPU-3a2c,2"},
+	}
+
+	for _, tt := range tests {
+		var gpus GPUList
+		if err := json.Unmarshal([]byte(tt.input), &gpus); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if err := gpus.validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+		}
+		if got := gpus.DockerFlag(); got != tt.flag {
+			t.Errorf("%s: DockerFlag() = %s, want %s", tt.input, got, tt.flag)
+		}
+		if got := gpus.VisibleDevices(); got != tt.visible {
+			t.Errorf("%s: VisibleDevices() = %s, want %s", tt.input, got, tt.visible)
+		}
+	}
+
+	data, err := json.Marshal(GPUList{"all"})
+	if err != nil || string(data) != `"all"` {
+		t.Errorf("Marshal(all) = %s, %v", data, err)
+	}
+
+	for _, input := range []string{`-1`, `1.5`, `true`, `["all", 0]`, `["0,1"]`} {
+		var gpus GPUList
+		if err := json.Unmarshal([]byte(input), &gpus); err == nil && gpus.validate() == nil {
+			t.Errorf("expected %s to be invalid", input)
+		}
+	}
+}
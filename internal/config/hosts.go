@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// HostGateway is the address of the Docker host as seen from containers,
+// which Docker fills in for an extra host
+const HostGateway = "host-gateway"
+
+// ExtraHosts is run.extraHosts: names added to the session's /etc/hosts,
+// mapped to an IP address or HostGateway
+type ExtraHosts map[string]string
+
+// UnmarshalJSON also accepts a list of "name:ip" or "name=ip" entries, as
+// in compose files
+func (h *ExtraHosts) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		hosts := make(ExtraHosts)
+		for _, entry := range list {
+			// IPv6 addresses have colons, so split at the first separator
+			name, ip, ok := strings.Cut(entry, "=")
+			if !ok {
+				name, ip, ok = strings.Cut(entry, ":")
+			}
+			if !ok {
+				return fmt.Errorf("invalid run.extraHosts entry %q: expected name:ip", entry)
+			}
+			hosts[strings.TrimSpace(name)] = strings.TrimSpace(ip)
+		}
+		*h = hosts
+		return nil
+	}
+	var hosts map[string]string
+	if err := json.Unmarshal(data, &hosts); err != nil {
+		return fmt.Errorf("invalid run.extraHosts: use an object of names to IPs or a list of name:ip entries")
+	}
+	*h = hosts
+	return nil
+}
+
+var hostName = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+// validate checks the names and addresses
+func (h ExtraHosts) validate() error {
+	for name, ip := range h {
+		if !hostName.MatchString(name) {
+			return fmt.Errorf("invalid run.extraHosts name %q", name)
+		}
+		if ip != HostGateway && net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid run.extraHosts address %q for %s: use an IP address or %q", ip, name, HostGateway)
+		}
+	}
+	return nil
+}
+
+// DockerArgs returns the docker run arguments adding the hosts, by name
+func (h ExtraHosts) DockerArgs() []string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var args []string
+	for _, name := range names {
+		args = append(args, "--add-host", name+":"+h[name])
+	}
+	return args
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtraHostsDockerArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`{"api.local": "host-gateway", "db": "10.0.0.5"}`, []string{"--add-host", "api.local:host-gateway", "--add-host", "db:10.0.0.5"}},
+		{`["db:10.0.0.5", "api.local=host-gateway"]`, []string{"--add-host", "api.local:host-gateway", "--add-host", "db:10.0.0.5"}},
+		{`["v6=fd00::1"]`, []string{"--add-host", "v6:fd00::1"}},
+		{`{}`, nil},
+	}
+
+	for _, tt := range tests {
+		var hosts ExtraHosts
+		if err := json.Unmarshal([]byte(tt.input), &hosts); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if err := hosts.validate(); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+		}
+		if got := hosts.DockerArgs(); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: DockerArgs() = %v, want %v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestExtraHostsValidate(t *testing.T) {
+	invalid := []string{
+		`{"api.local": "localhost"}`,
+		`{"-api": "10.0.0.5"}`,
+		`{"api local": "10.0.0.5"}`,
+		`["api.local"]`,
+		`"api.local:10.0.0.5"`,
+	}
+
+	for _, input := range invalid {
+		var hosts ExtraHosts
+		if err := json.Unmarshal([]byte(input), &hosts); err != nil {
+			continue
+		}
+		if err := hosts.validate(); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/tidwall/jsonc"
+)
+
+// CurrentVersion is the .worklet.jsonc schema version this build reads and
+// writes. Files without a version field are version 0.
+const CurrentVersion = 1
+
+// migration upgrades a parsed config document from version to version+1 in
+// place and returns a line describing each change it made
+type migration func(doc map[string]any) []string
+
+// migrations[i] upgrades version i to i+1
+var migrations = []migration{
+	migrateForkBlock,
+}
+
+// migrateForkBlock replaces the original "fork" block with the top-level
+// "name". Its other settings (description, exclude, includeGit) have had no
+// effect since copy mode switched to run.include.
+func migrateForkBlock(doc map[string]any) []string {
+	fork, ok := doc["fork"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	var changes []string
+	if name, ok := fork["name"].(string); ok && name != "" {
+		if _, exists := doc["name"]; !exists {
+			doc["name"] = name
+			changes = append(changes, fmt.Sprintf("moved fork.name to name (%q)", name))
+		}
+	}
+	for _, key := range []string{"description", "exclude", "includeGit"} {
+		if _, ok := fork[key]; ok {
+			changes = append(changes, fmt.Sprintf("removed unused fork.%s", key))
+		}
+	}
+	delete(doc, "fork")
+	return changes
+}
+
+// documentVersion returns the version field of a parsed config document
+func documentVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+	v, ok := raw.(float64)
+	if !ok || v < 0 || v != math.Trunc(v) {
+		return 0, fmt.Errorf("invalid version %v: must be a non-negative integer", raw)
+	}
+	if int(v) > CurrentVersion {
+		return 0, fmt.Errorf("config version %d is newer than this worklet supports (%d); upgrade worklet", int(v), CurrentVersion)
+	}
+	return int(v), nil
+}
+
+// Migrate upgrades a parsed config document to CurrentVersion in place. It
+// returns the version the document started at and a line for each change.
+func Migrate(doc map[string]any) (from int, changes []string, err error) {
+	from, err = documentVersion(doc)
+	if err != nil {
+		return 0, nil, err
+	}
+	for v := from; v < CurrentVersion; v++ {
+		changes = append(changes, migrations[v](doc)...)
+	}
+	if from < CurrentVersion {
+		doc["version"] = CurrentVersion
+		changes = append(changes, fmt.Sprintf("set version to %d", CurrentVersion))
+	}
+	return from, changes, nil
+}
+
+// MigrateJSONC migrates the contents of a .worklet.jsonc file and returns
+// the upgraded document as indented JSON. Comments aren't preserved.
+func MigrateJSONC(data []byte) (out []byte, from int, changes []string, err error) {
+	var doc map[string]any
+	if err := json.Unmarshal(jsonc.ToJSON(data), &doc); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	from, changes, err = Migrate(doc)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	out, err = json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return append(out, '\n'), from, changes, nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateForkBlock(t *testing.T) {
+	legacy := `{
+  // Original format
+  "fork": {
+    "name": "shop",
+    "description": "Development fork",
+    "exclude": ["node_modules"],
+    "includeGit": true
+  },
+  "run": {"image": "node:20", "command": ["sh"]}
+}`
+
+	out, from, changes, err := MigrateJSONC([]byte(legacy))
+	if err != nil {
+		t.Fatalf("MigrateJSONC failed: %v", err)
+	}
+	if from != 0 {
+		t.Errorf("from = %d, want 0", from)
+	}
+	if len(changes) != 5 {
+		t.Errorf("changes = %q, want the name move, three removals and the version", changes)
+	}
+	for _, want := range []string{`"name": "shop"`, `"version": 1`, `"image": "node:20"`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("migrated config is missing %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(string(out), `"fork"`) {
+		t.Errorf("migrated config still has the fork block:\n%s", out)
+	}
+
+	// Migrating again changes nothing
+	again, from, changes, err := MigrateJSONC(out)
+	if err != nil || from != CurrentVersion || len(changes) != 0 || string(again) != string(out) {
+		t.Errorf("second migration = %q, %d, %q, %v; want it unchanged", again, from, changes, err)
+	}
+}
+
+func TestMigrateKeepsTopLevelName(t *testing.T) {
+	out, _, _, err := MigrateJSONC([]byte(`{"name": "new", "fork": {"name": "old"}}`))
+	if err != nil {
+		t.Fatalf("MigrateJSONC failed: %v", err)
+	}
+	if !strings.Contains(string(out), `"name": "new"`) {
+		t.Errorf("top-level name was overwritten:\n%s", out)
+	}
+}
+
+func TestMigrateRejectsUnknownVersions(t *testing.T) {
+	for _, doc := range []string{`{"version": 99}`, `{"version": "1"}`, `{"version": 1.5}`, `{"version": -1}`} {
+		if _, _, _, err := MigrateJSONC([]byte(doc)); err == nil {
+			t.Errorf("MigrateJSONC(%s) succeeded, want an error", doc)
+		}
+	}
+}
+
+func TestLoadConfigMigratesInMemory(t *testing.T) {
+	dir, err := os.MkdirTemp("", "config-migrate-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	legacy := []byte(`{"fork": {"name": "shop"}, "run": {"image": "node:20"}}`)
+	configPath := filepath.Join(dir, ".worklet.jsonc")
+	if err := os.WriteFile(configPath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if cfg.Name != "shop" || cfg.Version != CurrentVersion || cfg.Run.Image != "node:20" {
+		t.Errorf("LoadConfig = %+v, want name shop at version %d", cfg, CurrentVersion)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if string(data) != string(legacy) {
+		t.Errorf("LoadConfig rewrote the file: %s", data)
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Consistency values of run.consistency and mounts, which Docker Desktop on
+// macOS used to trade consistency between host and container for speed.
+// VirtioFS and gRPC FUSE file sharing ignore them.
+const (
+	ConsistencyConsistent = "consistent" // Host and container always see the same content (Docker's default)
+	ConsistencyCached     = "cached"     // The host's view is authoritative; the container may see changes late
+	ConsistencyDelegated  = "delegated"  // The container's view is authoritative; the host may see changes late
+)
+
+// validateConsistency checks a consistency value of the setting named by
+// field
+func validateConsistency(field, consistency string) error {
+	switch consistency {
+	case "", ConsistencyConsistent, ConsistencyCached, ConsistencyDelegated:
+		return nil
+	}
+	return fmt.Errorf("invalid %s %q (must be consistent, cached or delegated)", field, consistency)
+}
+
+// CacheVolumes is run.cacheVolumes: directories of the project that mount
+// mode keeps in named volumes instead of the bind mount, such as
+// node_modules, whose many small files are slow to reach through Docker
+// Desktop's file sharing. It's true or false to turn the directories
+// DetectDependencyDirs finds on or off on every platform, or a list of
+// directories relative to the project. Unset, the detected ones are used
+// where files are shared with a VM.
+type CacheVolumes struct {
+	Set   bool     // Given in the config
+	Auto  bool     // Use the automatic directories
+	Paths []string // Directories given instead
+}
+
+// UnmarshalJSON accepts true, false or a list of directories
+func (c *CacheVolumes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var auto bool
+	if err := json.Unmarshal(data, &auto); err == nil {
+		*c = CacheVolumes{Set: true, Auto: auto}
+		return nil
+	}
+	var paths []string
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return fmt.Errorf("invalid run.cacheVolumes: use true, false or a list of directories in the project")
+	}
+	*c = CacheVolumes{Set: true, Paths: paths}
+	return nil
+}
+
+// MarshalJSON writes the form UnmarshalJSON reads
+func (c CacheVolumes) MarshalJSON() ([]byte, error) {
+	if c.Paths != nil {
+		return json.Marshal(c.Paths)
+	}
+	if !c.Set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(c.Auto)
+}
+
+// validate checks that the directories are inside the project
+func (c CacheVolumes) validate() error {
+	for _, dir := range c.Paths {
+		cleaned := path.Clean(strings.ReplaceAll(dir, `\`, "/"))
+		if dir == "" || path.IsAbs(cleaned) || isWindowsAbs(dir) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("invalid run.cacheVolumes directory %q: use a directory inside the project, e.g. node_modules", dir)
+		}
+	}
+	return nil
+}
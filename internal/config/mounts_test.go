@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCacheVolumesJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CacheVolumes
+	}{
+		{`null`, CacheVolumes{}},
+		{`true`, CacheVolumes{Set: true, Auto: true}},
+		{`false`, CacheVolumes{Set: true}},
+		{`["node_modules", "web/node_modules"]`, CacheVolumes{Set: true, Paths: []string{"node_modules", "web/node_modules"}}},
+	}
+
+	for _, tt := range tests {
+		var run RunConfig
+		if err := json.Unmarshal([]byte(`{"cacheVolumes": `+tt.input+`}`), &run); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if !reflect.DeepEqual(run.CacheVolumes, tt.expected) {
+			t.Errorf("%s: got %+v, want %+v", tt.input, run.CacheVolumes, tt.expected)
+		}
+
+		// Configs are marshaled again when extended or reformatted
+		data, err := json.Marshal(run)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again RunConfig
+		if err := json.Unmarshal(data, &again); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(again.CacheVolumes, tt.expected) {
+			t.Errorf("%s: got %+v after a round trip, want %+v", tt.input, again.CacheVolumes, tt.expected)
+		}
+	}
+
+	var run RunConfig
+	if err := json.Unmarshal([]byte(`{"cacheVolumes": "node_modules"}`), &run); err == nil {
+		t.Error("expected an error for a string")
+	}
+}
+
+func TestCacheVolumesValidate(t *testing.T) {
+	valid := CacheVolumes{Set: true, Paths: []string{"node_modules", `web\node_modules`, ".venv"}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, dir := range []string{"", ".", "../node_modules", "/node_modules", `C:\node_modules`, "a/../.."} {
+		if err := (CacheVolumes{Set: true, Paths: []string{dir}}).validate(); err == nil {
+			t.Errorf("expected an error for %q", dir)
+		}
+	}
+}
+
+func TestValidateConsistency(t *testing.T) {
+	for _, consistency := range []string{"", "consistent", "cached", "delegated"} {
+		if err := validateConsistency("run.consistency", consistency); err != nil {
+			t.Errorf("%q: unexpected error: %v", consistency, err)
+		}
+	}
+	if err := validateConsistency("run.consistency", "fast"); err == nil {
+		t.Error("expected an error for an unknown consistency")
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Project names and session IDs make up container, network and volume names
+// and the session's hostnames, e.g. web.myapp-3f9c2a1e.local.worklet.sh, so
+// they're kept to what all of those accept and short enough that the
+// "myapp-3f9c2a1e" label stays under the 63 characters DNS allows.
+const (
+	MaxNameLength      = 40
+	MaxSessionIDLength = 20
+)
+
+var (
+	namePattern      = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+	sessionIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	invalidNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+)
+
+// reservedSessionIDs would give a session the name of one of worklet's own
+// containers, networks or volumes, which are named "worklet-<id>"
+var reservedSessionIDs = []string{"network", "nginx-proxy", "claude-credentials", "ssh-credentials"}
+
+// reservedSessionIDPrefixes are the prefixes of worklet's own volume and
+// image names after "worklet-", which cleanup tells apart from sessions
+var reservedSessionIDPrefixes = []string{"overlay-", "pnpm-store-", "cache-", "temp-", "claude-credentials-"}
+
+// ValidateName checks a project name set in .worklet.jsonc
+func ValidateName(name string) error {
+	switch {
+	case len(name) > MaxNameLength:
+		return fmt.Errorf("invalid name %q: must be at most %d characters", name, MaxNameLength)
+	case !namePattern.MatchString(name) || strings.HasSuffix(name, "-"):
+		return fmt.Errorf("invalid name %q: use letters, digits, '-' and '_', starting with a letter or digit (e.g. %q)", name, SanitizeName(name))
+	}
+	return nil
+}
+
+// SanitizeName turns a name worklet derives, such as a directory or npm
+// package name, into a valid project name: "@acme/My App" becomes
+// "acme-my-app". It returns "" if nothing usable is left.
+func SanitizeName(name string) string {
+	name = invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	name = strings.Trim(name, "-_")
+	if len(name) > MaxNameLength {
+		name = strings.TrimRight(name[:MaxNameLength], "-_")
+	}
+	return name
+}
+
+// ValidateSessionID checks a session ID given with --id or allocated for a
+// run
+func ValidateSessionID(id string) error {
+	switch {
+	case len(id) > MaxSessionIDLength:
+		return fmt.Errorf("invalid session ID %q: must be at most %d characters", id, MaxSessionIDLength)
+	case !sessionIDPattern.MatchString(id) || strings.HasSuffix(id, "-"):
+		return fmt.Errorf("invalid session ID %q: use lowercase letters, digits and '-', starting with a letter or digit", id)
+	}
+	for _, reserved := range reservedSessionIDs {
+		if id == reserved {
+			return fmt.Errorf("invalid session ID %q: it is reserved for worklet's own %s", id, "worklet-"+reserved)
+		}
+	}
+	for _, prefix := range reservedSessionIDPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return fmt.Errorf("invalid session ID %q: IDs starting with %q are reserved", id, prefix)
+		}
+	}
+	return nil
+}
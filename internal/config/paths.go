@@ -0,0 +1,68 @@
+package config
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// windowsDrivePath matches Windows paths starting with a drive letter, such
+// as C:\src or C:/src
+var windowsDrivePath = regexp.MustCompile(`^[A-Za-z]:([\\/]|$)`)
+
+// windowsDriveSpec matches mount specs whose source is a drive-letter path
+// written with backslashes, which can't be anything else
+var windowsDriveSpec = regexp.MustCompile(`^[A-Za-z]:\\`)
+
+// isWindowsAbs reports whether p is an absolute Windows path, with a drive
+// letter or a \\server\share prefix, whatever OS worklet runs on
+func isWindowsAbs(p string) bool {
+	return windowsDrivePath.MatchString(p) || strings.HasPrefix(p, `\\`)
+}
+
+// VolumeSource returns the source of a docker -v volume spec, a host path
+// or a volume name, or "" for an anonymous volume given only a target. A
+// source may be a Windows path with a drive letter, such as C:\data, since
+// volume names are at least two characters long.
+func VolumeSource(spec string) string {
+	if windowsDrivePath.MatchString(spec) {
+		if i := strings.Index(spec[2:], ":"); i >= 0 {
+			return spec[:i+2]
+		}
+		return ""
+	}
+	source, _, ok := strings.Cut(spec, ":")
+	if !ok {
+		return ""
+	}
+	return source
+}
+
+// IsHostPathSource reports whether the source of a volume spec is a host
+// path rather than a volume name
+func IsHostPathSource(source string) bool {
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, "~") || strings.HasPrefix(source, ".") || isWindowsAbs(source)
+}
+
+// HostPath converts a path from worklet.json or a flag to the host's form.
+// worklet.json is shared between platforms, so relative and ~-prefixed
+// paths may use / or \ as separators on any OS. Absolute paths are left as
+// they are.
+func HostPath(p string) string {
+	if p == "" || strings.HasPrefix(p, "/") || isWindowsAbs(p) {
+		return p
+	}
+	return filepath.FromSlash(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// baseName is filepath.Base for paths with either separator
+func baseName(p string) string {
+	p = strings.TrimRight(p, `/\`)
+	if i := strings.LastIndexAny(p, `/\`); i >= 0 {
+		p = p[i+1:]
+	}
+	if p == "" || windowsDrivePath.MatchString(p) {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHostPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"", ""},
+		{"/abs/path", "/abs/path"},
+		{`C:\src\app`, `C:\src\app`},
+		{`\\server\share`, `\\server\share`},
+		{"docker/compose.yml", filepath.Join("docker", "compose.yml")},
+		{`docker\compose.yml`, filepath.Join("docker", "compose.yml")},
+		{`..\shared`, filepath.Join("..", "shared")},
+		{`~\shared`, filepath.Join("~", "shared")},
+	}
+
+	for _, tt := range tests {
+		if got := HostPath(tt.path); got != tt.expected {
+			t.Errorf("HostPath(%q) = %q, want %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestVolumeSource(t *testing.T) {
+	tests := []struct {
+		spec     string
+		expected string
+	}{
+		{"/data", ""},
+		{"cache:/cache", "cache"},
+		{"/etc:/host-etc:ro", "/etc"},
+		{`C:\data:/data`, `C:\data`},
+		{"C:/data:/data:ro", "C:/data"},
+	}
+
+	for _, tt := range tests {
+		if got := VolumeSource(tt.spec); got != tt.expected {
+			t.Errorf("VolumeSource(%q) = %q, want %q", tt.spec, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/tidwall/jsonc"
+)
+
+// PolicyPath is where administrators install the organization policy that
+// constrains what sessions may do
+var PolicyPath = "/etc/worklet/policy.jsonc"
+
+// Values of Policy.Egress
+const (
+	EgressAllow = "allow" // Sessions reach any host (default)
+	EgressNone  = "none"  // Sessions only reach each other and the proxy
+)
+
+// Policy constrains the sessions any project config may start. Project
+// configs can't loosen it.
+type Policy struct {
+	// ForbidSharedIsolation rejects "isolation": "shared", which gives the
+	// session the host's Docker socket
+	ForbidSharedIsolation bool `json:"forbidSharedIsolation,omitempty"`
+
+	// ForbidPrivilegedMountMode rejects privileged containers, full
+	// isolation included, when the project directory is mounted from the
+	// host
+	ForbidPrivilegedMountMode bool `json:"forbidPrivilegedMountMode,omitempty"`
+
+	// AllowedImages restricts session base images to those matching one of
+	// these patterns, e.g. "ghcr.io/acme/*" or "node:*". Empty allows any.
+	AllowedImages []string `json:"allowedImages,omitempty"`
+
+	// Egress is EgressAllow or EgressNone, which creates session networks
+	// as internal Docker networks without outside access
+	Egress string `json:"egress,omitempty"`
+
+	// Scan turns on scanning session base images for vulnerabilities, with
+	// thresholds users can only make stricter
+	Scan *ScanConfig `json:"scan,omitempty"`
+}
+
+// LoadPolicy reads the policy at PolicyPath. Without one it returns nil.
+// Unknown settings are an error rather than being ignored, so that a typo
+// doesn't leave a rule unenforced.
+func LoadPolicy() (*Policy, error) {
+	data, err := os.ReadFile(PolicyPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", PolicyPath, err)
+	}
+
+	var policy Policy
+	dec := json.NewDecoder(bytes.NewReader(jsonc.ToJSON(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", PolicyPath, err)
+	}
+	switch policy.Egress {
+	case "", EgressAllow, EgressNone:
+	default:
+		return nil, fmt.Errorf("invalid policy %s: egress %q (must be allow or none)", PolicyPath, policy.Egress)
+	}
+	if policy.Scan != nil {
+		if err := policy.Scan.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid policy %s: %w", PolicyPath, err)
+		}
+	}
+	for _, pattern := range policy.AllowedImages {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid policy %s: image pattern %q: %w", PolicyPath, pattern, err)
+		}
+	}
+	return &policy, nil
+}
+
+// BlocksEgress reports whether session networks are cut off from outside
+func (p *Policy) BlocksEgress() bool {
+	return p != nil && p.Egress == EgressNone
+}
+
+// PolicyRun describes the session a policy is checked against
+type PolicyRun struct {
+	Image      string // Base image
+	Isolation  string // "full" or "shared"
+	MountMode  bool
+	Privileged bool // run.privileged
+}
+
+// PolicyError lists the ways a session breaks the policy
+type PolicyError struct {
+	Violations []string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("blocked by the policy in %s:\n  - %s\nAsk your administrator if you need an exception",
+		PolicyPath, strings.Join(e.Violations, "\n  - "))
+}
+
+// Check returns a *PolicyError if run breaks the policy. A nil policy
+// allows anything.
+func (p *Policy) Check(run PolicyRun) error {
+	if p == nil {
+		return nil
+	}
+
+	var violations []string
+	if p.ForbidSharedIsolation && run.Isolation == "shared" {
+		violations = append(violations, `shared isolation is forbidden; use "isolation": "full"`)
+	}
+	if p.ForbidPrivilegedMountMode && run.MountMode {
+		if run.Isolation == "full" {
+			violations = append(violations, `full isolation runs privileged, which is forbidden in mount mode; run in copy mode or use "isolation": "shared"`)
+		} else if run.Privileged {
+			violations = append(violations, `"privileged": true is forbidden in mount mode`)
+		}
+	}
+	if len(p.AllowedImages) > 0 && !p.allowsImage(run.Image) {
+		violations = append(violations, fmt.Sprintf("image %s isn't allowed (allowed: %s)", run.Image, strings.Join(p.AllowedImages, ", ")))
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// allowsImage reports whether image matches one of the allowed patterns,
+// as written, without its tag or digest, or with Docker Hub's implicit
+// registry added to either
+func (p *Policy) allowsImage(image string) bool {
+	candidates := []string{image}
+	if repo := imageRepository(image); repo != image {
+		candidates = append(candidates, repo)
+	}
+	for _, candidate := range append([]string(nil), candidates...) {
+		if full := dockerHubName(candidate); full != candidate {
+			candidates = append(candidates, full)
+		}
+	}
+
+	for _, pattern := range p.AllowedImages {
+		for _, candidate := range candidates {
+			if ok, _ := path.Match(pattern, candidate); ok {
+				return true
+			}
+			if ok, _ := path.Match(dockerHubName(pattern), candidate); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// imageRepository strips the tag or digest from an image reference
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// dockerHubName returns the fully qualified name of an image on Docker
+// Hub, e.g. docker.io/library/node:20 for node:20
+func dockerHubName(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return image
+	}
+	if !found {
+		image = "library/" + image
+	}
+	return "docker.io/" + image
+}
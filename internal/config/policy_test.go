@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPolicy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-policy-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { PolicyPath = path }(PolicyPath)
+	PolicyPath = filepath.Join(dir, "policy.jsonc")
+
+	policy, err := LoadPolicy()
+	if err != nil || policy != nil {
+		t.Fatalf("LoadPolicy() = %v, %v without a policy file, want nil", policy, err)
+	}
+	if err := policy.Check(PolicyRun{Image: "anything", Isolation: "shared", MountMode: true, Privileged: true}); err != nil {
+		t.Errorf("nil policy Check() = %v, want nil", err)
+	}
+
+	os.WriteFile(PolicyPath, []byte(`{"forbidSharedIsolaton": true}`), 0644)
+	if _, err := LoadPolicy(); err == nil {
+		t.Error("LoadPolicy() accepted a misspelled setting")
+	}
+
+	os.WriteFile(PolicyPath, []byte(`{
+  // Org rules
+  "forbidSharedIsolation": true,
+  "forbidPrivilegedMountMode": true,
+  "allowedImages": ["ghcr.io/acme/*", "node"],
+  "egress": "none"
+}`), 0644)
+	policy, err = LoadPolicy()
+	if err != nil {
+		t.Fatalf("LoadPolicy() error = %v", err)
+	}
+	if !policy.BlocksEgress() {
+		t.Error("BlocksEgress() = false, want true")
+	}
+
+	tests := []struct {
+		name       string
+		run        PolicyRun
+		violations int
+	}{
+		{"allowed", PolicyRun{Image: "ghcr.io/acme/dev:1", Isolation: "full"}, 0},
+		{"docker hub image by repository", PolicyRun{Image: "docker.io/library/node:20", Isolation: "full"}, 0},
+		{"pinned digest", PolicyRun{Image: "node@sha256:abc", Isolation: "full"}, 0},
+		{"other image", PolicyRun{Image: "ghcr.io/other/dev:1", Isolation: "full"}, 1},
+		{"shared isolation", PolicyRun{Image: "node:20", Isolation: "shared"}, 1},
+		{"full isolation in mount mode", PolicyRun{Image: "node:20", Isolation: "full", MountMode: true}, 1},
+		{"shared privileged in mount mode", PolicyRun{Image: "python:3", Isolation: "shared", MountMode: true, Privileged: true}, 3},
+		{"shared privileged in copy mode", PolicyRun{Image: "node:20", Isolation: "shared", Privileged: true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.run)
+			var policyErr *PolicyError
+			switch {
+			case tt.violations == 0 && err != nil:
+				t.Errorf("Check() = %v, want nil", err)
+			case tt.violations > 0 && !errors.As(err, &policyErr):
+				t.Errorf("Check() = %v, want a PolicyError", err)
+			case tt.violations > 0 && len(policyErr.Violations) != tt.violations:
+				t.Errorf("Check() violations = %q, want %d", policyErr.Violations, tt.violations)
+			}
+		})
+	}
+}
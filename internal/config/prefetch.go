@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Prefetch defaults
+const (
+	DefaultPrefetchInterval = 6 * time.Hour
+	DefaultPrefetchProjects = 5
+)
+
+// PrefetchConfig controls the images the daemon pulls while no session is
+// starting, so a run after an image was updated doesn't wait on the pull:
+// the proxy's image, the default base image and the images of the projects
+// run most. `worklet prefetch` pulls the same images on demand.
+type PrefetchConfig struct {
+	Disabled      bool     `json:"disabled,omitempty"`      // Don't prefetch in the background
+	IntervalHours int      `json:"intervalHours,omitempty"` // How often images are pulled again (default: 6)
+	Projects      int      `json:"projects,omitempty"`      // How many of the most run projects have their images pulled (default: 5)
+	Images        []string `json:"images,omitempty"`        // Extra images to keep pulled
+
+	// Registries holds per-registry settings keyed by registry host, e.g.
+	// "docker.io", "ghcr.io" or "registry.corp:5000"
+	Registries map[string]RegistryPrefetchConfig `json:"registries,omitempty"`
+}
+
+// RegistryPrefetchConfig holds prefetch settings for a single registry
+type RegistryPrefetchConfig struct {
+	Disabled      bool `json:"disabled,omitempty"`      // Never prefetch images from this registry
+	IntervalHours int  `json:"intervalHours,omitempty"` // Overrides prefetch.intervalHours for its images
+}
+
+// Validate checks the intervals, project count and images
+func (p *PrefetchConfig) Validate() error {
+	if p.IntervalHours < 0 {
+		return fmt.Errorf("invalid prefetch.intervalHours %d: must not be negative", p.IntervalHours)
+	}
+	if p.Projects < 0 {
+		return fmt.Errorf("invalid prefetch.projects %d: must not be negative", p.Projects)
+	}
+	for _, image := range p.Images {
+		if strings.TrimSpace(image) == "" || strings.ContainsAny(image, " \t") {
+			return fmt.Errorf("invalid prefetch.images entry %q", image)
+		}
+	}
+	for name, registry := range p.Registries {
+		if registry.IntervalHours < 0 {
+			return fmt.Errorf("invalid prefetch.registries.%s.intervalHours %d: must not be negative", name, registry.IntervalHours)
+		}
+	}
+	return nil
+}
+
+// ProjectCount returns how many of the most run projects have their images
+// prefetched
+func (p PrefetchConfig) ProjectCount() int {
+	if p.Projects == 0 {
+		return DefaultPrefetchProjects
+	}
+	return p.Projects
+}
+
+// registry returns the settings for a registry host, matched
+// case-insensitively
+func (p PrefetchConfig) registry(host string) (RegistryPrefetchConfig, bool) {
+	for name, registry := range p.Registries {
+		if strings.EqualFold(normalizeRegistry(name), host) {
+			return registry, true
+		}
+	}
+	return RegistryPrefetchConfig{}, false
+}
+
+// Prefetches reports whether images from a registry are prefetched
+func (p PrefetchConfig) Prefetches(registry string) bool {
+	settings, _ := p.registry(registry)
+	return !settings.Disabled
+}
+
+// Interval returns how often images from a registry are pulled again
+func (p PrefetchConfig) Interval(registry string) time.Duration {
+	if settings, ok := p.registry(registry); ok && settings.IntervalHours > 0 {
+		return time.Duration(settings.IntervalHours) * time.Hour
+	}
+	if p.IntervalHours > 0 {
+		return time.Duration(p.IntervalHours) * time.Hour
+	}
+	return DefaultPrefetchInterval
+}
+
+// ImageRegistry returns the registry host an image is pulled from, e.g.
+// "docker.io" for "nginx:alpine" and "ghcr.io" for "ghcr.io/org/app:1"
+func ImageRegistry(image string) string {
+	first, _, ok := strings.Cut(image, "/")
+	// Like Docker, a first path component is only a registry host if it
+	// looks like one
+	if !ok || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return "docker.io"
+	}
+	return normalizeRegistry(first)
+}
+
+// normalizeRegistry lower-cases a registry host and folds Docker Hub's
+// aliases into "docker.io"
+func normalizeRegistry(host string) string {
+	host = strings.ToLower(host)
+	switch host {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return host
+}
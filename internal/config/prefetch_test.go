@@ -0,0 +1,83 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImageRegistry(t *testing.T) {
+	tests := []struct {
+		image    string
+		expected string
+	}{
+		{"nginx:alpine", "docker.io"},
+		{"worklet/base:latest", "docker.io"},
+		{"ghcr.io/org/app:1", "ghcr.io"},
+		{"registry.corp:5000/team/app", "registry.corp:5000"},
+		{"localhost/app", "localhost"},
+		{"index.docker.io/library/redis", "docker.io"},
+		{"GHCR.io/org/app", "ghcr.io"},
+	}
+
+	for _, tt := range tests {
+		if got := ImageRegistry(tt.image); got != tt.expected {
+			t.Errorf("ImageRegistry(%q) = %q, want %q", tt.image, got, tt.expected)
+		}
+	}
+}
+
+func TestPrefetchRegistrySettings(t *testing.T) {
+	prefetch := PrefetchConfig{
+		IntervalHours: 12,
+		Registries: map[string]RegistryPrefetchConfig{
+			"registry.corp:5000": {Disabled: true},
+			"GHCR.IO":            {IntervalHours: 24},
+			"index.docker.io":    {IntervalHours: 2},
+		},
+	}
+
+	if prefetch.Prefetches("registry.corp:5000") {
+		t.Error("expected registry.corp:5000 to be disabled")
+	}
+	if !prefetch.Prefetches("quay.io") {
+		t.Error("expected unconfigured registries to be prefetched")
+	}
+
+	intervals := map[string]time.Duration{
+		"ghcr.io":   24 * time.Hour,
+		"docker.io": 2 * time.Hour,
+		"quay.io":   12 * time.Hour,
+	}
+	for registry, expected := range intervals {
+		if got := prefetch.Interval(registry); got != expected {
+			t.Errorf("Interval(%q) = %s, want %s", registry, got, expected)
+		}
+	}
+
+	if got := (PrefetchConfig{}).Interval("docker.io"); got != DefaultPrefetchInterval {
+		t.Errorf("default interval = %s, want %s", got, DefaultPrefetchInterval)
+	}
+	if got := (PrefetchConfig{}).ProjectCount(); got != DefaultPrefetchProjects {
+		t.Errorf("default project count = %d, want %d", got, DefaultPrefetchProjects)
+	}
+}
+
+func TestPrefetchValidate(t *testing.T) {
+	invalid := []PrefetchConfig{
+		{IntervalHours: -1},
+		{Projects: -2},
+		{Images: []string{""}},
+		{Images: []string{"nginx alpine"}},
+		{Registries: map[string]RegistryPrefetchConfig{"ghcr.io": {IntervalHours: -1}}},
+	}
+	for _, prefetch := range invalid {
+		if err := prefetch.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", prefetch)
+		}
+	}
+
+	valid := PrefetchConfig{IntervalHours: 6, Projects: 3, Images: []string{"postgres:16"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
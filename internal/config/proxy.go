@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// DefaultHTTPPort is the host port the nginx proxy serves session URLs on
+const DefaultHTTPPort = 80
+
+// proxyPortPath returns the path of the file recording the host port the
+// proxy serves session URLs on when it isn't DefaultHTTPPort
+func proxyPortPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "proxy-port"), nil
+}
+
+// ProxyHTTPPort returns the host port the proxy serves session URLs on, as
+// recorded by the daemon when it started the proxy. It is read each time,
+// as the daemon may restart the proxy on another port.
+func ProxyHTTPPort() int {
+	path, err := proxyPortPath()
+	if err != nil {
+		return DefaultHTTPPort
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return DefaultHTTPPort
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || port <= 0 || port > 65535 {
+		return DefaultHTTPPort
+	}
+	return port
+}
+
+// SaveProxyHTTPPort records the host port the proxy serves session URLs on
+func SaveProxyHTTPPort(port int) error {
+	path, err := proxyPortPath()
+	if err != nil {
+		return err
+	}
+	if port == DefaultHTTPPort {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove proxy port: %w", err)
+		}
+		return nil
+	}
+	if err := storage.WriteFileAtomic(path, []byte(strconv.Itoa(port)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save proxy port: %w", err)
+	}
+	return nil
+}
+
+// ServiceHost returns the host name a session's service is served at
+func ServiceHost(subdomain, projectName, sessionID string) string {
+	return fmt.Sprintf("%s.%s-%s.%s", subdomain, projectName, sessionID, Domain())
+}
+
+// AliasHost returns the host name a service is served at under a name that
+// stays the same across sessions, such as the project's stable name
+func AliasHost(subdomain, alias string) string {
+	return fmt.Sprintf("%s.%s.%s", subdomain, alias, Domain())
+}
+
+// AliasURL returns the URL of AliasHost, with the proxy's port when it isn't
+// DefaultHTTPPort
+func AliasURL(subdomain, alias string) string {
+	return HTTPURL(AliasHost(subdomain, alias), ProxyHTTPPort())
+}
+
+// ServiceURL returns the URL a session's service is served at, with the
+// proxy's port when it isn't DefaultHTTPPort
+func ServiceURL(subdomain, projectName, sessionID string) string {
+	return HTTPURL(ServiceHost(subdomain, projectName, sessionID), ProxyHTTPPort())
+}
+
+// HTTPURL returns the http URL of host on port, leaving out the default port
+func HTTPURL(host string, port int) string {
+	if port == 0 || port == DefaultHTTPPort {
+		return "http://" + host
+	}
+	return fmt.Sprintf("http://%s:%d", host, port)
+}
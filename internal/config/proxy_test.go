@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProxyHTTPPort(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-config-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	if port := ProxyHTTPPort(); port != DefaultHTTPPort {
+		t.Errorf("ProxyHTTPPort() = %d without a saved port, want %d", port, DefaultHTTPPort)
+	}
+	if url := ServiceURL("web", "shop", "abc123"); url != "http://web.shop-abc123."+Domain() {
+		t.Errorf("ServiceURL() = %q, want no port", url)
+	}
+
+	if err := SaveProxyHTTPPort(8480); err != nil {
+		t.Fatal(err)
+	}
+	if port := ProxyHTTPPort(); port != 8480 {
+		t.Errorf("ProxyHTTPPort() = %d, want 8480", port)
+	}
+	if url := ServiceURL("web", "shop", "abc123"); url != "http://web.shop-abc123."+Domain()+":8480" {
+		t.Errorf("ServiceURL() = %q, want the fallback port", url)
+	}
+
+	if err := SaveProxyHTTPPort(DefaultHTTPPort); err != nil {
+		t.Fatal(err)
+	}
+	if port := ProxyHTTPPort(); port != DefaultHTTPPort {
+		t.Errorf("ProxyHTTPPort() = %d after saving the default, want %d", port, DefaultHTTPPort)
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Vulnerability severities, from lowest to highest
+var Severities = []string{"low", "medium", "high", "critical"}
+
+// Values of ScanConfig.Scanner
+const (
+	ScannerAuto  = "auto" // Trivy, or Grype if only it is installed
+	ScannerTrivy = "trivy"
+	ScannerGrype = "grype"
+)
+
+// ScanConfig scans session base images for vulnerabilities before their
+// first run, with Trivy or Grype. In the global config it's off unless
+// Scanner is set; in the policy any scan section turns it on.
+type ScanConfig struct {
+	Scanner string `json:"scanner,omitempty"` // ScannerAuto, ScannerTrivy or ScannerGrype
+	WarnAt  string `json:"warnAt,omitempty"`  // Lowest severity warned about (default: "high")
+	BlockAt string `json:"blockAt,omitempty"` // Lowest severity that stops the session (default: none)
+	// Required stops sessions when no scanner is installed (policy only)
+	Required bool `json:"required,omitempty"`
+}
+
+// SeverityRank returns where severity ranks in Severities, or -1 for
+// severities below them, such as "negligible" and "unknown"
+func SeverityRank(severity string) int {
+	severity = strings.ToLower(severity)
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateSeverity checks a severity threshold
+func validateSeverity(field, severity string) error {
+	if severity != "" && SeverityRank(severity) < 0 {
+		return fmt.Errorf("invalid %s %q (must be %s)", field, severity, strings.Join(Severities, ", "))
+	}
+	return nil
+}
+
+// Validate checks the scanner and thresholds
+func (s *ScanConfig) Validate() error {
+	switch s.Scanner {
+	case "", ScannerAuto, ScannerTrivy, ScannerGrype:
+	default:
+		return fmt.Errorf("invalid scan.scanner %q (must be auto, trivy or grype)", s.Scanner)
+	}
+	if err := validateSeverity("scan.warnAt", s.WarnAt); err != nil {
+		return err
+	}
+	return validateSeverity("scan.blockAt", s.BlockAt)
+}
+
+// ScanSettings returns the image scan settings from the global config and
+// the policy, and whether scanning is on at all. The policy's scanner is
+// used over the user's, and the stricter of their thresholds applies.
+func ScanSettings(global ScanConfig, policy *Policy) (ScanConfig, bool) {
+	settings := global
+	enabled := global.Scanner != ""
+	if policy != nil && policy.Scan != nil {
+		enabled = true
+		if policy.Scan.Scanner != "" {
+			settings.Scanner = policy.Scan.Scanner
+		}
+		settings.WarnAt = stricterSeverity(settings.WarnAt, policy.Scan.WarnAt)
+		settings.BlockAt = stricterSeverity(settings.BlockAt, policy.Scan.BlockAt)
+		settings.Required = policy.Scan.Required
+	}
+	if settings.Scanner == "" {
+		settings.Scanner = ScannerAuto
+	}
+	if settings.WarnAt == "" {
+		settings.WarnAt = "high"
+	}
+	settings.WarnAt = stricterSeverity(settings.WarnAt, settings.BlockAt)
+	return settings, enabled
+}
+
+// stricterSeverity returns the lower of two thresholds, where "" is none
+func stricterSeverity(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	case SeverityRank(b) < SeverityRank(a):
+		return b
+	}
+	return a
+}
@@ -0,0 +1,35 @@
+package config
+
+import "testing"
+
+func TestScanSettings(t *testing.T) {
+	if _, enabled := ScanSettings(ScanConfig{}, nil); enabled {
+		t.Error("ScanSettings() enabled scanning without a scanner or policy")
+	}
+
+	settings, enabled := ScanSettings(ScanConfig{Scanner: ScannerGrype}, nil)
+	if !enabled || settings.Scanner != ScannerGrype || settings.WarnAt != "high" || settings.BlockAt != "" {
+		t.Errorf("ScanSettings() = %+v, %v, want grype warning at high", settings, enabled)
+	}
+
+	// The policy turns scanning on, and only makes thresholds stricter
+	policy := &Policy{Scan: &ScanConfig{BlockAt: "critical", Required: true}}
+	settings, enabled = ScanSettings(ScanConfig{BlockAt: "medium", WarnAt: "low"}, policy)
+	if !enabled || settings.Scanner != ScannerAuto || settings.BlockAt != "medium" || settings.WarnAt != "low" || !settings.Required {
+		t.Errorf("ScanSettings() = %+v, %v, want the user's stricter thresholds", settings, enabled)
+	}
+	settings, _ = ScanSettings(ScanConfig{BlockAt: "critical"}, &Policy{Scan: &ScanConfig{BlockAt: "high"}})
+	if settings.BlockAt != "high" {
+		t.Errorf("ScanSettings() blockAt = %q, want the policy's stricter high", settings.BlockAt)
+	}
+
+	// Warnings start no higher than blocking
+	settings, _ = ScanSettings(ScanConfig{Scanner: ScannerTrivy, BlockAt: "medium"}, nil)
+	if settings.WarnAt != "medium" {
+		t.Errorf("ScanSettings() warnAt = %q, want medium", settings.WarnAt)
+	}
+
+	if err := (&ScanConfig{BlockAt: "severe"}).Validate(); err == nil {
+		t.Error("Validate() accepted an unknown severity")
+	}
+}
@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// LabelAddonSession marks the containers of a session's add-ons with the
+// session's ID. They aren't labelled as sessions, so session commands and
+// the daemon leave them alone.
+const LabelAddonSession = "worklet.addon.session"
+
+// addonRunArgs returns the docker run arguments of a session's add-ons
+func addonRunArgs(opts RunOptions) [][]string {
+	projectName := containerProjectName(opts.Config)
+	var runs [][]string
+	for _, addon := range opts.Config.Addons {
+		args := []string{"run", "-d",
+			"--name", addon.ContainerName(projectName, opts.SessionID),
+			"--network", GetSessionNetworkName(opts.SessionID),
+			// Also reachable by its name alone from the session
+			"--network-alias", addon.AddonName(),
+			"--label", fmt.Sprintf("%s=%s", LabelAddonSession, opts.SessionID),
+			"--label", fmt.Sprintf("worklet.addon.name=%s", addon.AddonName()),
+		}
+		if opts.Config.Run.RestartPolicy != "" && !opts.Ephemeral {
+			args = append(args, "--restart", opts.Config.Run.RestartPolicy)
+		}
+		for _, env := range addon.ContainerEnv(opts.SessionID) {
+			args = append(args, "-e", env)
+		}
+		args = append(args, addon.Image())
+		args = append(args, addon.ContainerCommand(opts.SessionID)...)
+		runs = append(runs, args)
+	}
+	return runs
+}
+
+// ServiceHost returns the container serving svc in the session cfg
+// describes, if it isn't the session's own: an add-on's web interface is
+// served by the add-on's container
+func ServiceHost(cfg *config.WorkletConfig, sessionID string, svc config.ServiceConfig) string {
+	if svc.Addon == "" {
+		return ""
+	}
+	for _, addon := range cfg.Addons {
+		if addon.AddonName() == svc.Addon {
+			return addon.ContainerName(containerProjectName(cfg), sessionID)
+		}
+	}
+	return ""
+}
+
+// startAddons starts the containers of a session's add-ons on its network,
+// replacing any left over from an earlier session of the same ID
+func startAddons(ctx context.Context, opts RunOptions) error {
+	if len(opts.Config.Addons) == 0 {
+		return nil
+	}
+	RemoveAddons(ctx, opts.SessionID)
+	for i, args := range addonRunArgs(opts) {
+		addon := opts.Config.Addons[i]
+		opts.Progress.Update(PhaseCreate, fmt.Sprintf("Starting add-on %s (%s)", addon.AddonName(), addon.Image()))
+		if output, err := dockerCommand(ctx, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start add-on %s: %w\n%s", addon.AddonName(), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// addonContainers returns the IDs of a session's add-on containers
+func addonContainers(ctx context.Context, sessionID string) []string {
+	output, err := dockerCommand(ctx, "ps", "-aq", "--filter", fmt.Sprintf("label=%s=%s", LabelAddonSession, sessionID)).Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(output))
+}
+
+// RemoveAddons removes a session's add-on containers and their data
+func RemoveAddons(ctx context.Context, sessionID string) {
+	if containers := addonContainers(ctx, sessionID); len(containers) > 0 {
+		dockerCommand(ctx, append([]string{"rm", "-f", "-v"}, containers...)...).Run()
+	}
+}
+
+// stopAddons stops a session's add-on containers along with the session
+func stopAddons(ctx context.Context, sessionID string) error {
+	containers := addonContainers(ctx, sessionID)
+	if len(containers) == 0 {
+		return nil
+	}
+	if output, err := dockerCommand(ctx, append([]string{"stop"}, containers...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to stop add-ons: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// startStoppedAddons starts a session's add-on containers again, before the
+// session that connects to them
+func startStoppedAddons(ctx context.Context, sessionID string) error {
+	containers := addonContainers(ctx, sessionID)
+	if len(containers) == 0 {
+		return nil
+	}
+	if output, err := dockerCommand(ctx, append([]string{"start"}, containers...)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to start add-ons: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestAddonRunArgs(t *testing.T) {
+	tempHome, err := os.MkdirTemp("", "worklet-addons-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempHome)
+	t.Setenv("HOME", tempHome)
+
+	cfg := &config.WorkletConfig{
+		Name:   "shop",
+		Addons: []config.AddonConfig{{Type: config.AddonPostgres}, {Type: config.AddonMinIO, Name: "storage"}},
+	}
+	cfg.ApplyAddons()
+	opts := RunOptions{WorkDir: "/home/me/shop", Config: cfg, SessionID: "abc123", MountMode: true}
+
+	runs := addonRunArgs(opts)
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 add-ons, got %v", runs)
+	}
+	postgres := strings.Join(runs[0], " ")
+	for _, expected := range []string{"--name shop-abc123-postgres", "--network worklet-abc123", "--network-alias postgres", "--label " + LabelAddonSession + "=abc123", "-e POSTGRES_PASSWORD=" + config.AddonPassword("abc123", "postgres"), "postgres:16-alpine"} {
+		if !strings.Contains(postgres, expected) {
+			t.Errorf("expected %s in %v", expected, runs[0])
+		}
+	}
+	if !strings.HasSuffix(strings.Join(runs[1], " "), "minio/minio:latest server /data --console-address :9001") {
+		t.Errorf("unexpected minio command %v", runs[1])
+	}
+
+	// The session gets the add-ons' addresses and routes their consoles
+	args, err := buildRunArgs(opts, "worklet/base:latest", "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"-e WORKLET_ADDON_POSTGRES_HOST=shop-abc123-postgres", "-e WORKLET_ADDON_STORAGE_URL=http://shop-abc123-storage:9000", "--label worklet.service.storage.host=shop-abc123-storage"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+#!/bin/sh
+# Installs the browsers in $WORKLET_BROWSERS with their system dependencies,
+# plus a virtual display served over noVNC, on top of a session's base image
+set -e
+
+if command -v apt-get >/dev/null 2>&1; then
+    export DEBIAN_FRONTEND=noninteractive
+    apt-get update
+    apt-get install -y --no-install-recommends \
+        ca-certificates \
+        fonts-liberation \
+        fonts-noto-color-emoji \
+        novnc \
+        procps \
+        python3 \
+        websockify \
+        x11vnc \
+        xvfb
+    # Browsers from Playwright where Node.js is available, with the
+    # libraries they need; the distribution's Chromium otherwise
+    if command -v npx >/dev/null 2>&1; then
+        npx -y playwright@latest install --with-deps $WORKLET_BROWSERS
+    else
+        for browser in $WORKLET_BROWSERS; do
+            case "$browser" in
+                chromium) apt-get install -y --no-install-recommends chromium ;;
+                firefox) apt-get install -y --no-install-recommends firefox-esr ;;
+                *) echo "Warning: $browser needs Node.js to install with Playwright; skipping" >&2 ;;
+            esac
+        done
+    fi
+    rm -rf /var/lib/apt/lists/*
+elif command -v apk >/dev/null 2>&1; then
+    # Playwright's browsers don't run on musl, so use Alpine's
+    apk add --no-cache font-liberation novnc procps python3 websockify x11vnc xvfb
+    for browser in $WORKLET_BROWSERS; do
+        case "$browser" in
+            chromium) apk add --no-cache chromium ;;
+            firefox) apk add --no-cache firefox ;;
+            *) echo "Warning: $browser isn't available on Alpine; skipping" >&2 ;;
+        esac
+    done
+else
+    echo "run.browsers needs a Debian, Ubuntu or Alpine based image" >&2
+    exit 1
+fi
+
+# Let the display's web address open the viewer
+if [ -f /usr/share/novnc/vnc.html ] && [ ! -e /usr/share/novnc/index.html ]; then
+    ln -s vnc.html /usr/share/novnc/index.html
+fi
@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+//go:embed browsers-setup.sh
+var browsersSetupScript string
+
+//go:embed worklet-browsers.sh
+var browsersStartScript string
+
+//go:embed cdp-proxy.py
+var cdpProxyScript string
+
+const (
+	// browsersImageRepository holds the browsers layers built on top of
+	// session base images
+	browsersImageRepository = "worklet-browsers"
+	// browsersStartCommand starts a session's browser endpoints
+	browsersStartCommand = "/usr/local/bin/worklet-browsers"
+)
+
+// browsersImageName returns the name of the browsers layer for a base
+// image, by the base image's ID, the browsers and the scripts that set it up
+func browsersImageName(baseImageID string, browsers []string) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{baseImageID, strings.Join(browsers, ","), browsersSetupScript, browsersStartScript, cdpProxyScript}, "\n")))
+	return fmt.Sprintf("%s:%x", browsersImageRepository, hash[:6])
+}
+
+// ensureBrowsersImage builds the browsers layer on top of the session's base
+// image, unless it was built already, and returns its name. It keeps the
+// base image's entrypoint, started after the browser endpoints.
+func ensureBrowsersImage(ctx context.Context, opts RunOptions) (string, error) {
+	baseImage := opts.baseImage()
+	// Pulls the base image if it isn't here yet
+	entrypoint, err := imageEntrypoint(ctx, baseImage)
+	if err != nil {
+		return "", err
+	}
+	output, err := dockerCommand(ctx, "image", "inspect", "--format", "{{.Id}}\n{{.Config.User}}", baseImage).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", baseImage, err)
+	}
+	id, user, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	browsers := opts.Config.Run.Browsers.Browsers()
+	imageName := browsersImageName(id, browsers)
+	if dockerCommand(ctx, "image", "inspect", imageName).Run() == nil {
+		return imageName, nil
+	}
+
+	buildDir, err := os.MkdirTemp("", "worklet-browsers-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(buildDir)
+	files := map[string]string{
+		"setup.sh":             browsersSetupScript,
+		"worklet-browsers":     browsersStartScript,
+		"worklet-cdp-proxy.py": cdpProxyScript,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(buildDir, name), []byte(content), 0755); err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	entrypointJSON, err := json.Marshal(append([]string{browsersStartCommand}, entrypoint...))
+	if err != nil {
+		return "", err
+	}
+	dockerfile := fmt.Sprintf(`FROM %s
+USER root
+ENV PLAYWRIGHT_BROWSERS_PATH=/ms-playwright
+COPY setup.sh /tmp/worklet-browsers-setup.sh
+RUN WORKLET_BROWSERS=%q sh /tmp/worklet-browsers-setup.sh && rm /tmp/worklet-browsers-setup.sh
+COPY worklet-browsers %s
+COPY worklet-cdp-proxy.py /usr/local/lib/worklet-cdp-proxy.py
+ENTRYPOINT %s
+`, baseImage, strings.Join(browsers, " "), browsersStartCommand, entrypointJSON)
+	// Installing needs root, but the session runs as the base image's user
+	if user = strings.TrimSpace(user); user != "" {
+		dockerfile += "USER " + user + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return "", fmt.Errorf("failed to write Dockerfile: %w", err)
+	}
+
+	cmd := dockerCommand(ctx, "build", "-t", imageName, buildDir)
+	writer := opts.Progress.Writer(PhaseBuild)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to build browsers image: %w\n%s", err, writer.Output())
+	}
+	return imageName, nil
+}
+
+// browsersEnv returns the environment that tells worklet-browsers which
+// endpoints to start, and points headed browsers at the virtual display
+func browsersEnv(b *config.BrowsersConfig, displayForwarded bool) []string {
+	var env []string
+	if b.VNC {
+		env = append(env,
+			"WORKLET_BROWSERS_VNC=1",
+			fmt.Sprintf("WORKLET_BROWSERS_VNC_PORT=%d", config.BrowserVNCPort))
+		// A forwarded display takes precedence over the virtual one
+		if !displayForwarded {
+			env = append(env, "DISPLAY="+config.BrowserDisplay)
+		}
+	}
+	if b.CDP {
+		env = append(env,
+			"WORKLET_BROWSERS_CDP=1",
+			fmt.Sprintf("WORKLET_BROWSERS_CDP_PORT=%d", config.BrowserCDPPort))
+	}
+	if len(env) > 0 {
+		env = append(env, "WORKLET_BROWSERS_DISPLAY="+config.BrowserDisplay)
+	}
+	return env
+}
@@ -0,0 +1,50 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestBuildRunArgsBrowsers(t *testing.T) {
+	opts := RunOptions{
+		WorkDir:   "/home/me/app",
+		Config:    &config.WorkletConfig{Name: "test", Run: config.RunConfig{Browsers: &config.BrowsersConfig{CDP: true, VNC: true}}},
+		SessionID: "abc123",
+		MountMode: true,
+	}
+	args, err := buildRunArgs(opts, "worklet-browsers:0123456789ab", "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"-e WORKLET_BROWSERS_CDP=1", "-e WORKLET_BROWSERS_VNC=1", "-e DISPLAY=:99", "WORKLET_INIT_SCRIPT=" + browsersStartCommand} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+
+	// The image's entrypoint starts the endpoints without a Docker daemon,
+	// and a forwarded display is kept
+	opts.Config.Run.Isolation = "shared"
+	opts.DisplayArgs = []string{"-e", "DISPLAY=:0"}
+	args, err = buildRunArgs(opts, "worklet-browsers:0123456789ab", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined = strings.Join(args, " ")
+	if strings.Contains(joined, browsersStartCommand) || strings.Contains(joined, "-e DISPLAY=:99") {
+		t.Errorf("unexpected browsers start or virtual display in %v", args)
+	}
+}
+
+func TestBrowsersImageName(t *testing.T) {
+	name := browsersImageName("sha256:abc", []string{"chromium"})
+	if !strings.HasPrefix(name, browsersImageRepository+":") || name != browsersImageName("sha256:abc", []string{"chromium"}) {
+		t.Errorf("unexpected name %s", name)
+	}
+	if name == browsersImageName("sha256:def", []string{"chromium"}) || name == browsersImageName("sha256:abc", []string{"chromium", "firefox"}) {
+		t.Error("expected the name to change with the base image and browsers")
+	}
+}
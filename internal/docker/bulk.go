@@ -0,0 +1,137 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SessionSelector picks sessions for a bulk operation. A session must match
+// every field that is set.
+type SessionSelector struct {
+	SessionIDs []string // Any of these sessions
+	Project    string   // Sessions of this project
+	Labels     []string // "key=value" or "key" container label selectors
+	Stopped    bool     // Only sessions that aren't running
+}
+
+// IsEmpty reports whether the selector has no criteria, which selects every
+// session
+func (s SessionSelector) IsEmpty() bool {
+	return len(s.SessionIDs) == 0 && s.Project == "" && len(s.Labels) == 0 && !s.Stopped
+}
+
+// Matches reports whether a session is selected
+func (s SessionSelector) Matches(session SessionInfo) bool {
+	if len(s.SessionIDs) > 0 {
+		found := false
+		for _, id := range s.SessionIDs {
+			if session.SessionID == id {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if s.Project != "" && !strings.EqualFold(session.ProjectName, s.Project) {
+		return false
+	}
+	for _, selector := range s.Labels {
+		key, value, hasValue := strings.Cut(selector, "=")
+		actual, ok := session.Labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	if s.Stopped && session.Status == "running" {
+		return false
+	}
+	return true
+}
+
+// SelectSessions returns the sessions matched by a selector
+func SelectSessions(sessions []SessionInfo, selector SessionSelector) []SessionInfo {
+	var selected []SessionInfo
+	for _, session := range sessions {
+		if selector.Matches(session) {
+			selected = append(selected, session)
+		}
+	}
+	return selected
+}
+
+// BulkResult is the outcome of a bulk operation on one session
+type BulkResult struct {
+	Session SessionInfo
+	Err     error
+}
+
+// RunBulk applies op to each session, at most concurrency at a time, and
+// returns the results in the order of sessions
+func RunBulk(ctx context.Context, sessions []SessionInfo, concurrency int, op func(context.Context, SessionInfo) error) []BulkResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]BulkResult, len(sessions))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		results[i].Session = session
+		wg.Add(1)
+		go func(i int, session SessionInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return
+			}
+			results[i].Err = op(ctx, session)
+		}(i, session)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// RestartSession restarts a worklet session container, starting it if it
+// was stopped
+func RestartSession(ctx context.Context, sessionID string) error {
+	session, err := findSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session info: %w", err)
+	}
+
+	// The session connects to its add-ons as it starts
+	if err := startStoppedAddons(ctx, sessionID); err != nil {
+		return err
+	}
+
+	cmd := dockerCommand(ctx, "restart", session.ContainerID)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to restart container: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// findSession returns a session by ID, whether or not it is running
+func findSession(ctx context.Context, sessionID string) (*SessionInfo, error) {
+	sessions, err := ListAllSessions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		if session.SessionID == sessionID {
+			return &session, nil
+		}
+	}
+
+	return nil, fmt.Errorf("session %s not found", sessionID)
+}
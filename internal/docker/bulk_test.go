@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSelectSessions(t *testing.T) {
+	sessions := []SessionInfo{
+		{SessionID: "1", ProjectName: "myapp", Status: "running", Labels: map[string]string{LabelMode: "mount"}},
+		{SessionID: "2", ProjectName: "MyApp", Status: "exited", Labels: map[string]string{LabelMode: "copy"}},
+		{SessionID: "3", ProjectName: "other", Status: "exited", Labels: map[string]string{}},
+	}
+
+	tests := []struct {
+		name     string
+		selector SessionSelector
+		want     []string
+	}{
+		{"empty selects all", SessionSelector{}, []string{"1", "2", "3"}},
+		{"ids", SessionSelector{SessionIDs: []string{"1", "3"}}, []string{"1", "3"}},
+		{"project ignores case", SessionSelector{Project: "myapp"}, []string{"1", "2"}},
+		{"stopped", SessionSelector{Stopped: true}, []string{"2", "3"}},
+		{"label value", SessionSelector{Labels: []string{LabelMode + "=copy"}}, []string{"2"}},
+		{"label presence", SessionSelector{Labels: []string{LabelMode}}, []string{"1", "2"}},
+		{"combined", SessionSelector{Project: "myapp", Stopped: true}, []string{"2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, session := range SelectSessions(sessions, tt.selector) {
+				got = append(got, session.SessionID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	var sessions []SessionInfo
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		sessions = append(sessions, SessionInfo{SessionID: id})
+	}
+
+	var running, peak int32
+	results := RunBulk(context.Background(), sessions, 2, func(ctx context.Context, session SessionInfo) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+
+		if session.SessionID == "3" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent operations, got %d", peak)
+	}
+	for i, result := range results {
+		if result.Session.SessionID != sessions[i].SessionID {
+			t.Errorf("result %d is for session %s, want %s", i, result.Session.SessionID, sessions[i].SessionID)
+		}
+		if (result.Err != nil) != (result.Session.SessionID == "3") {
+			t.Errorf("unexpected error for session %s: %v", result.Session.SessionID, result.Err)
+		}
+	}
+}
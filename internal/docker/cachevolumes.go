@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// cacheVolumePrefix starts the names of cache volumes, which are
+// "worklet-cache-<project>.<directory>". Project names have no dots, so the
+// first one ends the project.
+const cacheVolumePrefix = "worklet-cache-"
+
+// invalidVolumeChars matches characters Docker doesn't allow in volume names
+var invalidVolumeChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// cacheVolumeName returns the volume that keeps a project's directory, which
+// the project's sessions share
+func cacheVolumeName(projectName, dir string) string {
+	return cacheVolumePrefix + projectName + "." + invalidVolumeChars.ReplaceAllString(dir, "-")
+}
+
+// cacheVolumeProject returns the project of a cache volume, or "" if volume
+// isn't one
+func cacheVolumeProject(volume string) string {
+	name, ok := strings.CutPrefix(volume, cacheVolumePrefix)
+	if !ok {
+		return ""
+	}
+	project, _, _ := strings.Cut(name, ".")
+	return project
+}
+
+// vmFileSharing reports whether bind mounts reach host files through a VM's
+// file sharing, as with Docker Desktop on macOS and Windows, which is slow
+// for directories of many small files
+func vmFileSharing() bool {
+	return (runtime.GOOS == "darwin" || runtime.GOOS == "windows") && remoteDockerHost() == ""
+}
+
+// cacheVolumeDirs returns the directories of the project that mount mode
+// keeps in cache volumes, relative to it with slashes
+func cacheVolumeDirs(opts RunOptions) []string {
+	cacheVolumes := opts.Config.Run.CacheVolumes
+	if cacheVolumes.Paths != nil {
+		dirs := make([]string, 0, len(cacheVolumes.Paths))
+		for _, dir := range cacheVolumes.Paths {
+			dirs = append(dirs, path.Clean(strings.ReplaceAll(dir, `\`, "/")))
+		}
+		return dirs
+	}
+	if cacheVolumes.Set && !cacheVolumes.Auto {
+		return nil
+	}
+	if !cacheVolumes.Set && !vmFileSharing() {
+		return nil
+	}
+	return config.DetectDependencyDirs(opts.WorkDir)
+}
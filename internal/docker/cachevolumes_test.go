@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestCacheVolumeName(t *testing.T) {
+	tests := []struct {
+		dir      string
+		expected string
+	}{
+		{"node_modules", "worklet-cache-shop.node_modules"},
+		{"web/node_modules", "worklet-cache-shop.web-node_modules"},
+		{".venv", "worklet-cache-shop..venv"},
+	}
+	for _, tt := range tests {
+		name := cacheVolumeName("shop", tt.dir)
+		if name != tt.expected {
+			t.Errorf("cacheVolumeName(%q) = %q, want %q", tt.dir, name, tt.expected)
+		}
+		if project := cacheVolumeProject(name); project != "shop" {
+			t.Errorf("cacheVolumeProject(%q) = %q, want shop", name, project)
+		}
+	}
+	if project := cacheVolumeProject("worklet-pnpm-store-shop"); project != "" {
+		t.Errorf("expected no project for a pnpm volume, got %q", project)
+	}
+}
+
+func TestBuildRunArgsCacheVolumes(t *testing.T) {
+	workDir, err := os.MkdirTemp("", "worklet-cache-volumes-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	if err := os.WriteFile(filepath.Join(workDir, "package.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RunOptions{
+		WorkDir:   workDir,
+		Config:    &config.WorkletConfig{Name: "shop", Run: config.RunConfig{Isolation: "shared", Consistency: "delegated"}},
+		SessionID: "abc123",
+		MountMode: true,
+	}
+
+	// Automatic everywhere with true
+	opts.Config.Run.CacheVolumes = config.CacheVolumes{Set: true, Auto: true}
+	args, err := buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{
+		"-v " + workDir + ":/workspace:delegated",
+		"-v worklet-cache-shop.node_modules:/workspace/node_modules",
+	} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+
+	// A list replaces the automatic directories
+	opts.Config.Run.CacheVolumes = config.CacheVolumes{Set: true, Paths: []string{`web\node_modules`}}
+	if dirs := cacheVolumeDirs(opts); !reflect.DeepEqual(dirs, []string{"web/node_modules"}) {
+		t.Errorf("expected the listed directory, got %v", dirs)
+	}
+
+	opts.Config.Run.CacheVolumes = config.CacheVolumes{Set: true}
+	if dirs := cacheVolumeDirs(opts); len(dirs) != 0 {
+		t.Errorf("expected no cache volumes when turned off, got %v", dirs)
+	}
+}
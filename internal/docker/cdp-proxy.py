@@ -0,0 +1,74 @@
+"""Relays DevTools Protocol connections to a Chromium that only accepts them
+for localhost, rewriting the debugger URLs it returns to the address the
+client used. Usage: worklet-cdp-proxy.py <listen port> <chromium port>
+
+Chromium's own check of the Origin header is bypassed by relaying, so it's
+done here instead: DevTools clients such as Playwright and Puppeteer send
+no Origin, while a web page always does, and one from another site must
+not drive the browser."""
+
+import http.client
+import http.server
+import select
+import socket
+import sys
+import urllib.parse
+
+listen_port, chromium_port = int(sys.argv[1]), int(sys.argv[2])
+chromium_host = "localhost:%d" % chromium_port
+
+
+class Handler(http.server.BaseHTTPRequestHandler):
+    def do_GET(self):
+        if not self.origin_allowed():
+            self.send_error(403, "DevTools connections from other origins aren't allowed")
+            return
+        if self.headers.get("Upgrade", "").lower() == "websocket":
+            self.relay_websocket()
+            return
+        upstream = http.client.HTTPConnection("127.0.0.1", chromium_port, timeout=30)
+        upstream.request("GET", self.path, headers={"Host": chromium_host})
+        response = upstream.getresponse()
+        body = response.read()
+        host = self.headers.get("Host", "localhost:%d" % listen_port)
+        scheme = "wss" if self.headers.get("X-Forwarded-Proto") == "https" else "ws"
+        body = body.replace(b"ws://" + chromium_host.encode(), (scheme + "://" + host).encode())
+        body = body.replace(b"ws=" + chromium_host.encode(), b"ws=" + host.encode())
+        self.send_response(response.status)
+        self.send_header("Content-Type", response.getheader("Content-Type", "application/json"))
+        self.send_header("Content-Length", str(len(body)))
+        self.end_headers()
+        self.wfile.write(body)
+
+    def origin_allowed(self):
+        """Allows requests without an Origin, and ones from the endpoint's own"""
+        origin = self.headers.get("Origin")
+        if origin is None:
+            return True
+        return urllib.parse.urlsplit(origin).netloc.lower() == self.headers.get("Host", "").lower()
+
+    def relay_websocket(self):
+        upstream = socket.create_connection(("127.0.0.1", chromium_port))
+        lines = ["GET %s HTTP/1.1" % self.path]
+        for key, value in self.headers.items():
+            if key.lower() in ("host", "origin"):
+                continue
+            lines.append("%s: %s" % (key, value))
+        lines.append("Host: " + chromium_host)
+        upstream.sendall(("\r\n".join(lines) + "\r\n\r\n").encode())
+        client = self.connection
+        sockets = [client, upstream]
+        while True:
+            readable, _, _ = select.select(sockets, [], [])
+            for source in readable:
+                data = source.recv(65536)
+                if not data:
+                    upstream.close()
+                    return
+                (upstream if source is client else client).sendall(data)
+
+    def log_message(self, format, *args):
+        pass
+
+
+http.server.ThreadingHTTPServer(("0.0.0.0", listen_port), Handler).serve_forever()
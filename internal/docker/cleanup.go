@@ -3,8 +3,10 @@ package docker
 import (
 	"context"
 	"fmt"
-	"os/exec"
 	"strings"
+
+	"github.com/nolanleung/worklet/internal/notes"
+	"github.com/nolanleung/worklet/internal/routes"
 )
 
 // CleanupOptions configures cleanup behavior
@@ -16,21 +18,26 @@ type CleanupOptions struct {
 func CleanupSession(ctx context.Context, sessionID string, opts CleanupOptions) error {
 	var errors []string
 	
-	// 1. Get session info before removal
-	session, err := GetSessionInfo(ctx, sessionID)
+	// 1. Get session info before removal, including stopped sessions
+	session, err := findSession(ctx, sessionID)
 	if err != nil {
 		// Session might already be partially removed, continue with cleanup
 		session = &SessionInfo{SessionID: sessionID}
 	}
 	
-	// 2. Remove container (force removal)
+	// 2. Remove container (force removal), once files it created as root
+	// in a mounted project are handed back to the host user
 	if session.ContainerID != "" {
-		cmd := exec.CommandContext(ctx, "docker", "rm", "-f", session.ContainerID)
+		restoreHostOwnership(ctx, session.ContainerID)
+		cmd := dockerCommand(ctx, "rm", "-f", session.ContainerID)
 		if err := cmd.Run(); err != nil {
 			errors = append(errors, fmt.Sprintf("container removal: %v", err))
 		}
 	}
 	
+	// Remove the session's add-ons, which are on its network
+	RemoveAddons(ctx, sessionID)
+
 	// 3. Remove session network
 	networkName := GetSessionNetworkName(sessionID)
 	if err := RemoveNetwork(networkName); err != nil {
@@ -49,19 +56,34 @@ func CleanupSession(ctx context.Context, sessionID string, opts CleanupOptions)
 		}
 	}
 	
-	// 5. Remove temporary image (if exists)
+	// 5. Remove the copy-on-write workspace, exported credentials, X
+	// cookie and reload state (if any)
+	removeOverlay(sessionID)
+	RemoveExportedCredentials(sessionID)
+	removeXAuthority(sessionID)
+	RemoveReloadState(sessionID)
+	
+	// 6. Remove temporary image (if exists)
 	if session.ProjectName != "" {
 		imageName := fmt.Sprintf("worklet-temp-%s-%s", 
 			strings.ToLower(session.ProjectName), sessionID)
-		cmd := exec.CommandContext(ctx, "docker", "rmi", imageName)
+		cmd := dockerCommand(ctx, "rmi", imageName)
 		cmd.Run() // Ignore errors as image might not exist
 	}
 	
-	// 6. Only remove pnpm volume if Force is true
+	// 7. Only remove pnpm volume if Force is true
 	if opts.Force && session.ProjectName != "" {
 		cleanupProjectVolumes(ctx, session.ProjectName, opts.Force)
 	}
 	
+	// 8. Forget the session's note and route overrides
+	if store, err := notes.New(); err == nil {
+		store.Remove(sessionID)
+	}
+	if store, err := routes.New(); err == nil {
+		store.Clear(sessionID)
+	}
+	
 	if len(errors) > 0 {
 		return fmt.Errorf("cleanup had errors: %s", strings.Join(errors, "; "))
 	}
@@ -85,6 +107,17 @@ func cleanupProjectVolumes(ctx context.Context, projectName string, force bool)
 	// Remove pnpm store volume
 	pnpmVolume := fmt.Sprintf("worklet-pnpm-store-%s", projectName)
 	RemoveVolume(pnpmVolume) // Ignore errors
+
+	// Remove the project's cache volumes
+	output, err := dockerCommand(ctx, "volume", "ls", "--format", "{{.Name}}", "--filter", "name="+cacheVolumePrefix+projectName+".").Output()
+	if err != nil {
+		return
+	}
+	for _, vol := range strings.Fields(string(output)) {
+		if cacheVolumeProject(vol) == projectName {
+			RemoveVolume(vol) // Ignore errors
+		}
+	}
 }
 
 // CleanupAllOrphaned removes all orphaned Docker resources
@@ -110,9 +143,9 @@ func CleanupAllOrphaned(ctx context.Context, opts CleanupOptions) error {
 	}
 	
 	if len(cleaned) > 0 {
-		fmt.Printf("Cleaned up: %s\n", strings.Join(cleaned, ", "))
+		fmt.Fprintf(Output, "Cleaned up: %s\n", strings.Join(cleaned, ", "))
 	} else {
-		fmt.Println("No orphaned resources found")
+		fmt.Fprintln(Output, "No orphaned resources found")
 	}
 	
 	return nil
@@ -120,7 +153,7 @@ func CleanupAllOrphaned(ctx context.Context, opts CleanupOptions) error {
 
 // CleanupOrphanedVolumes removes worklet volumes not associated with running containers
 func CleanupOrphanedVolumes(ctx context.Context, opts CleanupOptions) (int, error) {
-	cmd := exec.Command("docker", "volume", "ls", "--format", "{{.Name}}")
+	cmd := dockerCommand(context.Background(), "volume", "ls", "--format", "{{.Name}}")
 	output, err := cmd.Output()
 	if err != nil {
 		return 0, fmt.Errorf("failed to list volumes: %w", err)
@@ -149,9 +182,14 @@ func CleanupOrphanedVolumes(ctx context.Context, opts CleanupOptions) (int, erro
 		// Check session DinD volumes (worklet-sessionid)
 		if strings.HasPrefix(vol, "worklet-") && 
 		   !strings.Contains(vol, "pnpm-store") && 
+		   !strings.HasPrefix(vol, cacheVolumePrefix) && 
 		   !strings.Contains(vol, "credentials") {
-			// Extract session ID (everything after "worklet-")
+			// Extract session ID (everything after "worklet-", or
+			// "worklet-overlay-" for copy-on-write workspaces)
 			sessionID := strings.TrimPrefix(vol, "worklet-")
+			if id, ok := strings.CutPrefix(vol, "worklet-overlay-"); ok {
+				sessionID = id
+			}
 			
 			// Skip if it's the main network volume
 			if sessionID == "network" {
@@ -162,7 +200,7 @@ func CleanupOrphanedVolumes(ctx context.Context, opts CleanupOptions) (int, erro
 			if !activeSessionIDs[sessionID] {
 				if err := RemoveVolume(vol); err == nil {
 					removedCount++
-					fmt.Printf("Removed orphaned volume: %s\n", vol)
+					fmt.Fprintf(Output, "Removed orphaned volume: %s\n", vol)
 				}
 			}
 		}
@@ -173,10 +211,18 @@ func CleanupOrphanedVolumes(ctx context.Context, opts CleanupOptions) (int, erro
 			if !activeProjects[projectName] {
 				if err := RemoveVolume(vol); err == nil {
 					removedCount++
-					fmt.Printf("Removed orphaned pnpm volume: %s\n", vol)
+					fmt.Fprintf(Output, "Removed orphaned pnpm volume: %s\n", vol)
 				}
 			}
 		}
+		
+		// Cache volumes are kept for the project's next session, like pnpm's
+		if project := cacheVolumeProject(vol); opts.Force && project != "" && !activeProjects[project] {
+			if err := RemoveVolume(vol); err == nil {
+				removedCount++
+				fmt.Fprintf(Output, "Removed orphaned cache volume: %s\n", vol)
+			}
+		}
 	}
 	
 	return removedCount, nil
@@ -184,7 +230,7 @@ func CleanupOrphanedVolumes(ctx context.Context, opts CleanupOptions) (int, erro
 
 // CleanupOrphanedImages removes temporary worklet images
 func CleanupOrphanedImages(ctx context.Context) (int, error) {
-	cmd := exec.Command("docker", "images", "--format", "{{.Repository}}:{{.Tag}}")
+	cmd := dockerCommand(context.Background(), "images", "--format", "{{.Repository}}:{{.Tag}}")
 	output, err := cmd.Output()
 	if err != nil {
 		return 0, fmt.Errorf("failed to list images: %w", err)
@@ -214,10 +260,10 @@ func CleanupOrphanedImages(ctx context.Context) (int, error) {
 		imgName := strings.Split(img, ":")[0]
 		
 		if strings.HasPrefix(imgName, "worklet-temp-") && !activeImages[imgName] {
-			cmd := exec.Command("docker", "rmi", img)
+			cmd := dockerCommand(context.Background(), "rmi", img)
 			if err := cmd.Run(); err == nil {
 				removedCount++
-				fmt.Printf("Removed orphaned image: %s\n", img)
+				fmt.Fprintf(Output, "Removed orphaned image: %s\n", img)
 			}
 		}
 	}
@@ -0,0 +1,148 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+//go:embed faketime-setup.sh
+var faketimeSetupScript string
+
+const (
+	// faketimeImageRepository holds the libfaketime layers built on top of
+	// session images
+	faketimeImageRepository = "worklet-faketime"
+	// faketimeLib is where the faketime layer links libfaketime
+	faketimeLib = "/usr/local/lib/worklet-faketime.so.1"
+	// zoneinfoDir holds the timezone database on Linux
+	zoneinfoDir = "/usr/share/zoneinfo"
+)
+
+// faketimeSkipCommands don't get a fake clock, since TLS certificates and
+// leases stop being valid for them
+var faketimeSkipCommands = []string{"dockerd", "containerd", "containerd-shim-runc-v2", "runc"}
+
+// hostTimezone returns the IANA name of the host's timezone, or "" if it
+// can't tell
+func hostTimezone() string {
+	if tz := os.Getenv("TZ"); tz != "" && !strings.HasPrefix(tz, ":") {
+		return tz
+	}
+	// /etc/localtime links into the timezone database on Linux and macOS
+	target, err := filepath.EvalSymlinks("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	if _, name, ok := strings.Cut(filepath.ToSlash(target), "zoneinfo/"); ok {
+		return name
+	}
+	return ""
+}
+
+// timezoneArgs returns the docker run arguments setting the session's
+// timezone, with the host's timezone database mounted in if zoneinfo isn't ""
+// for images that don't have one
+func timezoneArgs(timezone, zoneinfo string) []string {
+	args := []string{"-e", "TZ=" + timezone}
+	if zoneinfo != "" {
+		args = append(args, "-v", zoneinfo+":"+zoneinfoDir+":ro")
+	}
+	return args
+}
+
+// prepareTimezone returns the docker run arguments for run.timezone
+func prepareTimezone(opts RunOptions) []string {
+	timezone := opts.Config.Run.Timezone
+	if timezone == "" {
+		return nil
+	}
+	if timezone == config.TimezoneHost {
+		if timezone = hostTimezone(); timezone == "" {
+			fmt.Fprintln(Output, "Warning: Couldn't tell the host's timezone; the session keeps the image's")
+			return nil
+		}
+	}
+	// Docker Desktop doesn't share /usr, and a remote daemon's host has its
+	// own, so elsewhere the image needs tzdata
+	var zoneinfo string
+	if runtime.GOOS == "linux" && remoteDockerHost() == "" && fileExists(filepath.Join(zoneinfoDir, timezone)) {
+		zoneinfo = zoneinfoDir
+	}
+	return timezoneArgs(timezone, zoneinfo)
+}
+
+// faketimeEnv returns the environment that preloads libfaketime with the
+// session's clock
+func faketimeEnv(faketime string) []string {
+	return []string{
+		"LD_PRELOAD=" + faketimeLib,
+		"FAKETIME=" + faketime,
+		// Timeouts and sleeps keep working
+		"DONT_FAKE_MONOTONIC=1",
+		"FAKETIME_SKIP_CMDS=" + strings.Join(faketimeSkipCommands, ","),
+	}
+}
+
+// faketimeImageName returns the name of the libfaketime layer for an image,
+// by the image's ID and the script that sets it up
+func faketimeImageName(baseImageID string) string {
+	hash := sha256.Sum256([]byte(baseImageID + "\n" + faketimeSetupScript))
+	return fmt.Sprintf("%s:%x", faketimeImageRepository, hash[:6])
+}
+
+// ensureFaketimeImage builds the libfaketime layer on top of the session's
+// image, unless it was built already, and returns its name
+func ensureFaketimeImage(ctx context.Context, opts RunOptions) (string, error) {
+	baseImage := opts.sessionImage()
+	// Pulls the image if it isn't here yet
+	if _, err := imageEntrypoint(ctx, baseImage); err != nil {
+		return "", err
+	}
+	output, err := dockerCommand(ctx, "image", "inspect", "--format", "{{.Id}}\n{{.Config.User}}", baseImage).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", baseImage, err)
+	}
+	id, user, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	imageName := faketimeImageName(id)
+	if dockerCommand(ctx, "image", "inspect", imageName).Run() == nil {
+		return imageName, nil
+	}
+
+	buildDir, err := os.MkdirTemp("", "worklet-faketime-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(buildDir)
+	if err := os.WriteFile(filepath.Join(buildDir, "setup.sh"), []byte(faketimeSetupScript), 0755); err != nil {
+		return "", fmt.Errorf("failed to write setup.sh: %w", err)
+	}
+	dockerfile := fmt.Sprintf(`FROM %s
+USER root
+COPY setup.sh /tmp/worklet-faketime-setup.sh
+RUN WORKLET_FAKETIME_LIB=%s sh /tmp/worklet-faketime-setup.sh && rm /tmp/worklet-faketime-setup.sh
+`, baseImage, faketimeLib)
+	// Installing needs root, but the session runs as the image's user
+	if user = strings.TrimSpace(user); user != "" {
+		dockerfile += "USER " + user + "\n"
+	}
+	if err := os.WriteFile(filepath.Join(buildDir, "Dockerfile"), []byte(dockerfile), 0644); err != nil {
+		return "", fmt.Errorf("failed to write Dockerfile: %w", err)
+	}
+
+	cmd := dockerCommand(ctx, "build", "-t", imageName, buildDir)
+	writer := opts.Progress.Writer(PhaseBuild)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to build faketime image: %w\n%s", err, writer.Output())
+	}
+	return imageName, nil
+}
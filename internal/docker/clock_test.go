@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestTimezoneArgs(t *testing.T) {
+	if got, want := timezoneArgs("Asia/Tokyo", ""), []string{"-e", "TZ=Asia/Tokyo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("timezoneArgs() = %v, want %v", got, want)
+	}
+	want := []string{"-e", "TZ=Asia/Tokyo", "-v", "/usr/share/zoneinfo:/usr/share/zoneinfo:ro"}
+	if got := timezoneArgs("Asia/Tokyo", zoneinfoDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("timezoneArgs() = %v, want %v", got, want)
+	}
+}
+
+func TestBuildRunArgsFaketime(t *testing.T) {
+	opts := RunOptions{
+		WorkDir:       "/home/me/app",
+		Config:        &config.WorkletConfig{Name: "test", Run: config.RunConfig{Faketime: "+30d"}},
+		SessionID:     "abc123",
+		MountMode:     true,
+		FaketimeImage: "worklet-faketime:0123456789ab",
+	}
+	if image := opts.sessionImage(); image != opts.FaketimeImage {
+		t.Errorf("sessionImage() = %s, want the faketime layer", image)
+	}
+	args, err := buildRunArgs(opts, opts.sessionImage(), "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"-e LD_PRELOAD=" + faketimeLib, "-e FAKETIME=+30d", "-e DONT_FAKE_MONOTONIC=1", "FAKETIME_SKIP_CMDS=dockerd,"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+}
+
+func TestFaketimeImageName(t *testing.T) {
+	name := faketimeImageName("sha256:abc")
+	if !strings.HasPrefix(name, faketimeImageRepository+":") || name != faketimeImageName("sha256:abc") {
+		t.Errorf("unexpected name %s", name)
+	}
+	if name == faketimeImageName("sha256:def") {
+		t.Error("expected the name to change with the base image")
+	}
+}
@@ -1,13 +1,14 @@
 package docker
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/nolanleung/worklet/internal/config"
 	"gopkg.in/yaml.v3"
 )
 
@@ -46,7 +47,7 @@ func StartComposeServices(workDir, composePath, sessionID, projectName string, i
 
 	// In full isolation mode, compose will be started inside the container by the entrypoint script
 	if isolation == "full" {
-		fmt.Printf("Docker-compose will be started inside the container (full isolation mode)\n")
+		fmt.Fprintf(Output, "Docker-compose will be started inside the container (full isolation mode)\n")
 		return nil
 	}
 
@@ -75,13 +76,13 @@ func StartComposeServices(workDir, composePath, sessionID, projectName string, i
 	env = append(env, fmt.Sprintf("WORKLET_NETWORK=%s", networkName))
 
 	// Execute docker-compose up
-	cmd := exec.Command("docker", args...)
+	cmd := dockerCommand(context.Background(), args...)
 	cmd.Dir = workDir
 	cmd.Env = env
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = Output
 	cmd.Stderr = os.Stderr
 
-	fmt.Printf("Starting docker-compose services with project name: %s\n", composeProjectName)
+	fmt.Fprintf(Output, "Starting docker-compose services with project name: %s\n", composeProjectName)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to start docker-compose services: %w", err)
 	}
@@ -119,12 +120,12 @@ func StopComposeServices(workDir, composePath, sessionID, projectName string, is
 	}
 
 	// Execute docker-compose down
-	cmd := exec.Command("docker", args...)
+	cmd := dockerCommand(context.Background(), args...)
 	cmd.Dir = workDir
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = Output
 	cmd.Stderr = os.Stderr
 
-	fmt.Printf("Stopping docker-compose services for project: %s\n", composeProjectName)
+	fmt.Fprintf(Output, "Stopping docker-compose services for project: %s\n", composeProjectName)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to stop docker-compose services: %w", err)
 	}
@@ -219,7 +220,7 @@ func GetComposeServicesForDaemon(composePath, sessionID, projectName string) ([]
 // connectComposeContainersToNetwork connects all compose containers to the worklet session network
 func connectComposeContainersToNetwork(workDir, composePath, projectName, networkName string) error {
 	// Get list of containers for this compose project
-	cmd := exec.Command("docker", "compose", "-f", composePath, "-p", projectName, "ps", "-q")
+	cmd := dockerCommand(context.Background(), "compose", "-f", composePath, "-p", projectName, "ps", "-q")
 	cmd.Dir = workDir
 	output, err := cmd.Output()
 	if err != nil {
@@ -234,10 +235,10 @@ func connectComposeContainersToNetwork(workDir, composePath, projectName, networ
 			continue
 		}
 
-		connectCmd := exec.Command("docker", "network", "connect", networkName, containerID)
+		connectCmd := dockerCommand(context.Background(), "network", "connect", networkName, containerID)
 		if err := connectCmd.Run(); err != nil {
 			// Log warning but don't fail - container might already be connected
-			fmt.Printf("Warning: Failed to connect container %s to network %s: %v\n", containerID, networkName, err)
+			fmt.Fprintf(Output, "Warning: Failed to connect container %s to network %s: %v\n", containerID, networkName, err)
 		}
 	}
 
@@ -261,6 +262,7 @@ func fileExists(path string) bool {
 func GetComposePath(workDir string, composePath string) string {
 	// If explicitly configured, use that path
 	if composePath != "" {
+		composePath = config.HostPath(composePath)
 		if filepath.IsAbs(composePath) {
 			return composePath
 		}
@@ -1,20 +1,27 @@
 package docker
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
 )
 
 const (
-	// ClaudeCredentialsVolume is the name of the Docker volume for Claude credentials
+	// ClaudeCredentialsVolume is the name of the Docker volume for the
+	// default profile's Claude credentials
 	ClaudeCredentialsVolume = "worklet-claude-credentials"
 )
 
 // VolumeExists checks if a Docker volume exists
 func VolumeExists(volumeName string) (bool, error) {
-	cmd := exec.Command("docker", "volume", "inspect", volumeName)
+	cmd := dockerCommand(context.Background(), "volume", "inspect", volumeName)
 	err := cmd.Run()
 	if err != nil {
 		// Check if it's just a "not found" error
@@ -37,7 +44,7 @@ func CreateVolume(volumeName string) error {
 		return nil
 	}
 
-	cmd := exec.Command("docker", "volume", "create", volumeName)
+	cmd := dockerCommand(context.Background(), "volume", "create", volumeName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to create volume: %w, output: %s", err, output)
@@ -48,7 +55,7 @@ func CreateVolume(volumeName string) error {
 
 // RemoveVolume removes a Docker volume
 func RemoveVolume(volumeName string) error {
-	cmd := exec.Command("docker", "volume", "rm", volumeName)
+	cmd := dockerCommand(context.Background(), "volume", "rm", volumeName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to remove volume: %w, output: %s", err, output)
@@ -56,14 +63,16 @@ func RemoveVolume(volumeName string) error {
 	return nil
 }
 
-// SetupClaudeCredentials runs an interactive container to set up Claude credentials
-func SetupClaudeCredentials() error {
+// SetupClaudeCredentials runs an interactive container to log a Claude
+// profile in, replacing any credentials it had
+func SetupClaudeCredentials(profile string) error {
+	volume := config.ClaudeVolume(profile)
 	// Ensure volume exists
-	if err := CreateVolume(ClaudeCredentialsVolume); err != nil {
+	if err := CreateVolume(volume); err != nil {
 		return fmt.Errorf("failed to create credentials volume: %w", err)
 	}
 
-	fmt.Println("Setting up Claude credentials...")
+	fmt.Printf("Setting up Claude credentials for profile %s...\n", profile)
 	fmt.Println("This will run Claude's login process in a container.")
 	fmt.Println()
 
@@ -71,7 +80,7 @@ func SetupClaudeCredentials() error {
 	// Mount the volume at /claude-config to store all Claude files
 	args := []string{
 		"run", "--rm", "-it",
-		"-v", fmt.Sprintf("%s:/claude-config", ClaudeCredentialsVolume),
+		"-v", fmt.Sprintf("%s:/claude-config", volume),
 		"--entrypoint", "sh",
 		"worklet/base:latest",
 		"-c",
@@ -89,7 +98,7 @@ func SetupClaudeCredentials() error {
 		cp /root/.claude.json.backup /claude-config/.claude.json.backup 2>/dev/null || true`,
 	}
 
-	cmd := exec.Command("docker", args...)
+	cmd := dockerCommand(context.Background(), args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -102,40 +111,111 @@ func SetupClaudeCredentials() error {
 	return nil
 }
 
-// CheckClaudeCredentials checks if Claude credentials are configured
-func CheckClaudeCredentials() (bool, error) {
-	// Check if volume exists
-	exists, err := VolumeExists(ClaudeCredentialsVolume)
-	if err != nil {
-		return false, err
+// ClaudeCredentialStatus describes the credentials stored for a Claude
+// profile
+type ClaudeCredentialStatus struct {
+	Profile      string
+	Volume       string
+	Configured   bool      // A login or API key is stored
+	APIKey       bool      // Logged in with an API key rather than an account
+	Subscription string    // The account's plan, e.g. "pro" or "max"
+	ExpiresAt    time.Time // When the access token expires; zero if unknown
+	CanRefresh   bool      // Claude can renew an expired access token itself
+}
+
+// Problem returns why the profile's credentials won't work, or "" if they
+// should
+func (s *ClaudeCredentialStatus) Problem() string {
+	if !s.Configured {
+		return "not configured"
+	}
+	if !s.ExpiresAt.IsZero() && !time.Now().Before(s.ExpiresAt) && !s.CanRefresh {
+		return "access token expired and can't be refreshed; log in again"
 	}
+	return ""
+}
 
-	if !exists {
-		return false, nil
+// claudeStatusScript prints a profile's OAuth credentials, then a line
+// with "apikey" if its config holds an API key
+const claudeStatusScript = `cat /claude-config/.claude/.credentials.json 2>/dev/null
+echo
+echo ---
+grep -q '"primaryApiKey"' /claude-config/.claude.json 2>/dev/null && echo apikey
+true`
+
+// CheckClaudeCredentials reads a Claude profile's credentials in a
+// throwaway container and checks that they're usable
+func CheckClaudeCredentials(profile string) (*ClaudeCredentialStatus, error) {
+	status := &ClaudeCredentialStatus{Profile: profile, Volume: config.ClaudeVolume(profile)}
+
+	// Check if volume exists
+	exists, err := VolumeExists(status.Volume)
+	if err != nil || !exists {
+		return status, err
 	}
 
-	// Run a container to check if credentials and config files exist
 	args := []string{
 		"run", "--rm",
-		"-v", fmt.Sprintf("%s:/root/claude-config:ro", ClaudeCredentialsVolume),
+		"-v", fmt.Sprintf("%s:/claude-config:ro", status.Volume),
 		"--entrypoint", "sh",
 		"alpine",
-		"-c",
-		"test -f /claude-config/.credentials.json && echo 'configured' || echo 'not configured'",
+		"-c", claudeStatusScript,
 	}
-
-	cmd := exec.Command("docker", args...)
-	output, err := cmd.Output()
+	output, err := dockerCommand(context.Background(), args...).Output()
 	if err != nil {
-		return false, fmt.Errorf("failed to check credentials: %w", err)
+		return nil, fmt.Errorf("failed to check credentials: %w", err)
 	}
+	return parseClaudeStatus(status, string(output)), nil
+}
+
+// parseClaudeStatus fills in status from the output of claudeStatusScript
+func parseClaudeStatus(status *ClaudeCredentialStatus, output string) *ClaudeCredentialStatus {
+	credentials, rest, _ := strings.Cut(output, "\n---\n")
+	status.APIKey = strings.TrimSpace(rest) == "apikey"
+	status.Configured = status.APIKey
 
-	return strings.TrimSpace(string(output)) == "configured", nil
+	var stored struct {
+		OAuth *struct {
+			AccessToken      string `json:"accessToken"`
+			RefreshToken     string `json:"refreshToken"`
+			ExpiresAt        int64  `json:"expiresAt"` // Unix milliseconds
+			SubscriptionType string `json:"subscriptionType"`
+		} `json:"claudeAiOauth"`
+	}
+	if json.Unmarshal([]byte(strings.TrimSpace(credentials)), &stored) == nil && stored.OAuth != nil && stored.OAuth.AccessToken != "" {
+		status.Configured = true
+		status.APIKey = false
+		status.Subscription = stored.OAuth.SubscriptionType
+		status.CanRefresh = stored.OAuth.RefreshToken != ""
+		if stored.OAuth.ExpiresAt > 0 {
+			status.ExpiresAt = time.UnixMilli(stored.OAuth.ExpiresAt)
+		}
+	}
+	return status
+}
+
+// ListClaudeProfiles returns the Claude profiles with a credentials volume
+func ListClaudeProfiles() ([]string, error) {
+	output, err := dockerCommand(context.Background(), "volume", "ls", "--format", "{{.Name}}", "--filter", "name="+ClaudeCredentialsVolume).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+	var profiles []string
+	for _, volume := range strings.Fields(string(output)) {
+		if volume == ClaudeCredentialsVolume {
+			profiles = append(profiles, config.DefaultClaudeProfile)
+		} else if profile, ok := strings.CutPrefix(volume, ClaudeCredentialsVolume+"-"); ok && config.ValidateClaudeProfile(profile) == nil {
+			profiles = append(profiles, profile)
+		}
+	}
+	sort.Strings(profiles)
+	return profiles, nil
 }
 
-// ClearClaudeCredentials removes Claude credentials
-func ClearClaudeCredentials() error {
-	exists, err := VolumeExists(ClaudeCredentialsVolume)
+// ClearClaudeCredentials removes a Claude profile's credentials
+func ClearClaudeCredentials(profile string) error {
+	volume := config.ClaudeVolume(profile)
+	exists, err := VolumeExists(volume)
 	if err != nil {
 		return err
 	}
@@ -145,41 +225,136 @@ func ClearClaudeCredentials() error {
 		return nil
 	}
 
-	return RemoveVolume(ClaudeCredentialsVolume)
+	return RemoveVolume(volume)
 }
 
-// GetCredentialVolumeMounts returns volume mount arguments for credential volumes
-func GetCredentialVolumeMounts(mountClaude bool) []string {
+// GetCredentialVolumeMounts returns volume mount arguments for the Claude
+// credentials volume, if it exists
+func GetCredentialVolumeMounts(claudeVolume string) []string {
 	var mounts []string
 
-	if mountClaude {
+	if claudeVolume != "" {
 		// Check if volume exists
-		if exists, _ := VolumeExists(ClaudeCredentialsVolume); exists {
+		if exists, _ := VolumeExists(claudeVolume); exists {
 			// Mount the volume at a temporary location
-			mounts = append(mounts, "-v", fmt.Sprintf("%s:/claude-config", ClaudeCredentialsVolume))
+			mounts = append(mounts, "-v", fmt.Sprintf("%s:/claude-config", claudeVolume))
 		}
 	}
 
 	return mounts
 }
 
-// GetCredentialInitScript returns initialization commands for setting up credentials
-func GetCredentialInitScript(mountClaude bool) string {
-	if !mountClaude {
+// GetCredentialInitScript returns initialization commands for setting up
+// the Claude credentials in claudeVolume
+func GetCredentialInitScript(claudeVolume string) string {
+	if claudeVolume == "" {
 		return ""
 	}
 
 	// Check if volume exists
-	if exists, _ := VolumeExists(ClaudeCredentialsVolume); !exists {
+	if exists, _ := VolumeExists(claudeVolume); !exists {
 		return ""
 	}
 
-	// Return script to set up Claude config symlinks
+	// Return script to set up Claude config symlinks in the home directory
+	// of the session's user, which needs to be able to write through them
 	return `# Set up Claude configuration
 if [ -d /claude-config ]; then
-	mkdir -p /root
-	ln -sf /claude-config/.claude /root/.claude
-	ln -sf /claude-config/.claude.json /root/.claude.json
-	ln -sf /claude-config/.claude.json.backup /root/.claude.json.backup
+	home="${WORKLET_HOME:-$HOME}"
+	mkdir -p "$home"
+	ln -sf /claude-config/.claude "$home/.claude"
+	ln -sf /claude-config/.claude.json "$home/.claude.json"
+	ln -sf /claude-config/.claude.json.backup "$home/.claude.json.backup"
+	[ -z "$WORKLET_USER" ] || chown -R "$WORKLET_USER" /claude-config 2>/dev/null || true
 fi`
 }
+
+// LabelCredentialsExpires records when a session's time-boxed credentials
+// expire, in RFC 3339, for the daemon to revoke them
+const LabelCredentialsExpires = "worklet.credentials.expires"
+
+// credentialsTTL returns how long the session opts describes has its
+// credentials, zero for as long as it runs
+func credentialsTTL(opts RunOptions) time.Duration {
+	if !opts.Config.Run.Credentials.Any() {
+		return 0
+	}
+	if opts.CredentialsTTL > 0 {
+		return opts.CredentialsTTL
+	}
+	ttl, _ := opts.Config.Run.Credentials.TTLDuration()
+	return ttl
+}
+
+// checkCredentialsTTL returns an error if the session opts describes has
+// time-boxed credentials it could keep reading past their expiry. Revoking
+// them unmounts their volumes, which needs CAP_SYS_ADMIN: without it a
+// shared-isolation session keeps the volumes mounted.
+func checkCredentialsTTL(opts RunOptions) error {
+	if credentialsTTL(opts) == 0 {
+		return nil
+	}
+	if isolationMode(opts.Config) == "shared" && !opts.Config.Run.Privileged {
+		return fmt.Errorf("credentials ttl needs full isolation or \"privileged\": true, as a shared-isolation session can't unmount its credentials volumes on expiry")
+	}
+	return nil
+}
+
+// timeBoxedCredentialScript sets up copies of the credentials, rather than
+// links to them, so they can be removed on expiry. The volumes are
+// unmounted once copied where the container is allowed to, and nothing is
+// set up when a restarted session's credentials have already expired.
+func timeBoxedCredentialScript(claude, ssh bool) string {
+	var script strings.Builder
+	script.WriteString(`# Set up credentials until they expire
+if [ "$(date +%s)" -lt "${WORKLET_CREDENTIALS_EXPIRES:-0}" ]; then
+`)
+	if claude {
+		script.WriteString(`	if [ -d /claude-config ]; then
+		home="${WORKLET_HOME:-$HOME}"
+		mkdir -p "$home"
+		cp -a /claude-config/.claude "$home/.claude" 2>/dev/null || true
+		cp -a /claude-config/.claude.json /claude-config/.claude.json.backup "$home/" 2>/dev/null || true
+		[ -z "$WORKLET_USER" ] || chown -R "$WORKLET_USER" "$home/.claude" "$home/.claude.json" "$home/.claude.json.backup" 2>/dev/null || true
+		umount /claude-config 2>/dev/null || true
+	fi
+`)
+	}
+	if ssh {
+		script.WriteString(GetSSHInitScript(true))
+		script.WriteString("\n\tumount /ssh-config 2>/dev/null || true\n")
+	}
+	script.WriteString("fi")
+	return script.String()
+}
+
+// revokeCredentialsScript removes a session's copies of its credentials,
+// its exported credentials included, and stops its SSH agents. It prints
+// "mounted" if a credentials volume is still mounted, which happens when
+// the container can't unmount it. The copies are in root's home directory
+// and, with run.user, the user's.
+const revokeCredentialsScript = `for home in /root $(awk -F: -v u="${WORKLET_USER%%:*}" '$1 == u || $3 == u { print $6; exit }' /etc/passwd); do
+	rm -rf "$home/.claude" "$home/.claude.json" "$home/.claude.json.backup"
+	rm -f "$home"/.ssh/id_*
+done
+rm -rf ` + exportedCredentialsDir + `/* 2>/dev/null
+for p in /proc/[0-9]*; do
+	if [ "$(cat "$p/comm" 2>/dev/null)" = ssh-agent ]; then kill "${p#/proc/}" 2>/dev/null; fi
+done
+umount /claude-config /ssh-config 2>/dev/null
+if grep -qE ' /(claude|ssh)-config ' /proc/mounts; then echo mounted; fi
+true`
+
+// RevokeCredentials removes the time-boxed credentials of a running session
+// container. It returns an error if their volumes are still mounted, as
+// the session can then still read them.
+func RevokeCredentials(ctx context.Context, containerID string) error {
+	output, err := dockerCommand(ctx, "exec", "-u", "0", containerID, "sh", "-c", revokeCredentialsScript).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to revoke credentials: %w\nOutput: %s", err, string(output))
+	}
+	if strings.Contains(string(output), "mounted") {
+		return fmt.Errorf("removed the session's copies of its credentials, but couldn't unmount their volumes")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package docker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestParseClaudeStatus(t *testing.T) {
+	oauth := func(expiresIn time.Duration, refreshToken string) string {
+		return fmt.Sprintf(`{"claudeAiOauth": {"accessToken": "a", "refreshToken": %q, "expiresAt": %d, "subscriptionType": "max"}}`,
+			refreshToken, time.Now().Add(expiresIn).UnixMilli()) + "\n---\n"
+	}
+
+	tests := []struct {
+		name       string
+		output     string
+		configured bool
+		problem    bool
+	}{
+		{"nothing stored", "\n---\n", false, true},
+		{"valid token", oauth(time.Hour, "r"), true, false},
+		{"expired, refreshable", oauth(-time.Hour, "r"), true, false},
+		{"expired for good", oauth(-time.Hour, ""), true, true},
+		{"API key", "\n---\napikey\n", true, false},
+	}
+	for _, tt := range tests {
+		status := parseClaudeStatus(&ClaudeCredentialStatus{Profile: "default"}, tt.output)
+		if status.Configured != tt.configured {
+			t.Errorf("%s: Configured = %v, want %v", tt.name, status.Configured, tt.configured)
+		}
+		if problem := status.Problem(); (problem != "") != tt.problem {
+			t.Errorf("%s: Problem() = %q", tt.name, problem)
+		}
+	}
+
+	status := parseClaudeStatus(&ClaudeCredentialStatus{}, oauth(time.Hour, "r"))
+	if status.Subscription != "max" || !status.CanRefresh || time.Until(status.ExpiresAt) < 59*time.Minute {
+		t.Errorf("parsed status = %+v", status)
+	}
+}
+
+func TestFindCredentialProvider(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, provider := range CredentialProviders() {
+		if seen[provider.Name()] {
+			t.Errorf("provider %s is listed twice", provider.Name())
+		}
+		seen[provider.Name()] = true
+		found, err := FindCredentialProvider(provider.Name())
+		if err != nil || found.Name() != provider.Name() {
+			t.Errorf("FindCredentialProvider(%s) = %v, %v", provider.Name(), found, err)
+		}
+	}
+	if _, err := FindCredentialProvider("nope"); err == nil {
+		t.Error("expected an error for an unknown provider")
+	}
+}
+
+func TestCheckCredentialsTTL(t *testing.T) {
+	tests := []struct {
+		name       string
+		isolation  string
+		privileged bool
+		ttl        string
+		wantErr    bool
+	}{
+		{name: "full", isolation: "full", ttl: "2h"},
+		{name: "default", ttl: "2h"},
+		{name: "shared", isolation: "shared", ttl: "2h", wantErr: true},
+		{name: "shared privileged", isolation: "shared", privileged: true, ttl: "2h"},
+		{name: "shared without ttl", isolation: "shared"},
+	}
+	for _, tt := range tests {
+		cfg := &config.WorkletConfig{}
+		cfg.Run.Isolation = tt.isolation
+		cfg.Run.Privileged = tt.privileged
+		cfg.Run.Credentials = &config.CredentialConfig{Claude: true, TTL: tt.ttl}
+		err := checkCredentialsTTL(RunOptions{Config: cfg})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkCredentialsTTL() error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
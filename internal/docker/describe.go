@@ -0,0 +1,274 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/version"
+)
+
+// Labels recording how a session container was created, so the environment
+// can be audited or recreated later
+const (
+	LabelVersion     = "worklet.version"
+	LabelGitCommit   = "worklet.git.commit"     // HEAD of the project, with "-dirty" for uncommitted changes
+	LabelConfigHash  = "worklet.config.sha256"  // Effective worklet config
+	LabelComposeHash = "worklet.compose.sha256" // Compose file, if any
+	LabelMode        = "worklet.mode"           // ModeMount, ModeCopy or ModeOverlay
+	LabelBaseImage   = "worklet.image.base"     // Image the workspace was copied onto or mounted into
+	LabelCommand     = "worklet.command"        // JSON array of the command arguments, if any
+)
+
+// Values of LabelMode
+const (
+	ModeMount   = "mount"   // The project is mounted
+	ModeCopy    = "copy"    // The project was copied into an image
+	ModeOverlay = "overlay" // The project is mounted under a copy-on-write layer
+)
+
+// provenanceLabels returns the provenance labels for a session container
+func provenanceLabels(opts RunOptions) map[string]string {
+	mode := ModeCopy
+	if opts.MountMode {
+		mode = ModeMount
+	} else if useOverlay(opts) {
+		mode = ModeOverlay
+	}
+	labels := map[string]string{
+		LabelVersion:   version.Version,
+		LabelMode:      mode,
+		LabelBaseImage: opts.baseImage(),
+	}
+
+	if commit := gitCommit(opts.WorkDir); commit != "" {
+		labels[LabelGitCommit] = commit
+	}
+	if data, err := json.Marshal(opts.Config); err == nil {
+		labels[LabelConfigHash] = sha256Hex(data)
+	}
+	if opts.ComposePath != "" {
+		if data, err := os.ReadFile(opts.ComposePath); err == nil {
+			labels[LabelComposeHash] = sha256Hex(data)
+		}
+	}
+	if len(opts.CmdArgs) > 0 {
+		if data, err := json.Marshal(opts.CmdArgs); err == nil {
+			labels[LabelCommand] = string(data)
+		}
+	}
+
+	return labels
+}
+
+// gitCommit returns HEAD of the repository at dir, suffixed with "-dirty" if
+// it has uncommitted changes, or "" if dir isn't a git repository
+func gitCommit(dir string) string {
+	output, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	commit := strings.TrimSpace(string(output))
+
+	if status, err := exec.Command("git", "-C", dir, "status", "--porcelain").Output(); err == nil && len(strings.TrimSpace(string(status))) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// sha256Hex returns the hex-encoded SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// MountDescription is a volume or bind mount of a session container
+type MountDescription struct {
+	Type        string `json:"type"`
+	Source      string `json:"source"` // Volume name or host path
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"read_only,omitempty"`
+}
+
+// Description is a reproducibility manifest for a session: what it was
+// created from and how it is configured. Environment values are left out as
+// they may hold secrets.
+type Description struct {
+	SessionID       string             `json:"session_id"`
+	ProjectName     string             `json:"project_name"`
+	ContainerID     string             `json:"container_id"`
+	Status          string             `json:"status"`
+	CreatedAt       time.Time          `json:"created_at"`
+	WorkDir         string             `json:"workdir"`
+	Mode            string             `json:"mode,omitempty"` // "mount", "copy" or "overlay"
+	Image           string             `json:"image"`
+	ImageID         string             `json:"image_id"`
+	ImageDigest     string             `json:"image_digest,omitempty"` // Registry digest, when the image was pulled
+	BaseImage       string             `json:"base_image,omitempty"`
+	BaseImageDigest string             `json:"base_image_digest,omitempty"`
+	Command         []string           `json:"command,omitempty"`
+	WorkletVersion  string             `json:"worklet_version,omitempty"`
+	GitCommit       string             `json:"git_commit,omitempty"`
+	ConfigHash      string             `json:"config_sha256,omitempty"`
+	ComposeHash     string             `json:"compose_sha256,omitempty"`
+	EnvNames        []string           `json:"env_names"`
+	Mounts          []MountDescription `json:"mounts"`
+	Services        []ServiceInfo      `json:"services,omitempty"`
+}
+
+// Describe builds the reproducibility manifest of a session, running or
+// stopped. Sessions created before provenance labels were recorded have
+// empty version, commit and hash fields.
+func Describe(ctx context.Context, sessionID string) (*Description, error) {
+	session, err := findSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := dockerCommand(ctx, "inspect", session.ContainerID).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	var inspected []struct {
+		Created time.Time `json:"Created"`
+		Image   string    `json:"Image"`
+		Config  struct {
+			Image  string            `json:"Image"`
+			Env    []string          `json:"Env"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+		Mounts []struct {
+			Type        string `json:"Type"`
+			Name        string `json:"Name"`
+			Source      string `json:"Source"`
+			Destination string `json:"Destination"`
+			RW          bool   `json:"RW"`
+		} `json:"Mounts"`
+	}
+	if err := json.Unmarshal(output, &inspected); err != nil {
+		return nil, fmt.Errorf("failed to parse container details: %w", err)
+	}
+	if len(inspected) == 0 {
+		return nil, fmt.Errorf("container %s not found", session.ContainerID)
+	}
+	info := inspected[0]
+	labels := info.Config.Labels
+
+	desc := &Description{
+		SessionID:      session.SessionID,
+		ProjectName:    session.ProjectName,
+		ContainerID:    session.ContainerID,
+		Status:         session.Status,
+		CreatedAt:      info.Created,
+		WorkDir:        session.WorkDir,
+		Mode:           labels[LabelMode],
+		Image:          info.Config.Image,
+		ImageID:        info.Image,
+		ImageDigest:    imageDigest(ctx, info.Image),
+		BaseImage:      labels[LabelBaseImage],
+		WorkletVersion: labels[LabelVersion],
+		GitCommit:      labels[LabelGitCommit],
+		ConfigHash:     labels[LabelConfigHash],
+		ComposeHash:    labels[LabelComposeHash],
+		EnvNames:       []string{},
+		Mounts:         []MountDescription{},
+		Services:       session.Services,
+	}
+	if desc.BaseImage != "" {
+		desc.BaseImageDigest = imageDigest(ctx, desc.BaseImage)
+	}
+	if command := labels[LabelCommand]; command != "" {
+		json.Unmarshal([]byte(command), &desc.Command)
+	}
+
+	for _, env := range info.Config.Env {
+		name, _, _ := strings.Cut(env, "=")
+		desc.EnvNames = append(desc.EnvNames, name)
+	}
+	sort.Strings(desc.EnvNames)
+
+	for _, mount := range info.Mounts {
+		source := mount.Source
+		if mount.Type == "volume" {
+			source = mount.Name
+		}
+		desc.Mounts = append(desc.Mounts, MountDescription{
+			Type:        mount.Type,
+			Source:      source,
+			Destination: mount.Destination,
+			ReadOnly:    !mount.RW,
+		})
+	}
+	sort.Slice(desc.Mounts, func(i, j int) bool {
+		return desc.Mounts[i].Destination < desc.Mounts[j].Destination
+	})
+
+	return desc, nil
+}
+
+// imageDigest returns the first registry digest of an image, or "" for
+// images that were built locally
+func imageDigest(ctx context.Context, imageID string) string {
+	output, err := dockerCommand(ctx, "image", "inspect", "--format", "{{json .RepoDigests}}", imageID).Output()
+	if err != nil {
+		return ""
+	}
+	var digests []string
+	if err := json.Unmarshal(output, &digests); err != nil || len(digests) == 0 {
+		return ""
+	}
+	return digests[0]
+}
+
+// CheckDrift compares a session manifest against the inputs a new session
+// would be started from and returns a description of each difference. A
+// manifest taken from uncommitted changes always drifts, as those changes
+// can't be restored.
+func CheckDrift(manifest *Description, opts RunOptions) []string {
+	return driftFrom(manifest, provenanceLabels(opts))
+}
+
+// driftFrom compares a manifest against the provenance labels of a new session
+func driftFrom(manifest *Description, labels map[string]string) []string {
+	var drift []string
+
+	if manifest.WorkletVersion == "" || manifest.Mode == "" {
+		drift = append(drift, "manifest has no provenance; the session was started by an older worklet")
+		return drift
+	}
+	if strings.HasSuffix(manifest.GitCommit, "-dirty") {
+		drift = append(drift, fmt.Sprintf("git commit: manifest was taken from uncommitted changes on %s", strings.TrimSuffix(manifest.GitCommit, "-dirty")))
+	} else if current := labels[LabelGitCommit]; current != manifest.GitCommit {
+		drift = append(drift, fmt.Sprintf("git commit: manifest %s, now %s", orNone(manifest.GitCommit), orNone(current)))
+	}
+
+	checks := []struct {
+		name, want, got string
+	}{
+		{"worklet version", manifest.WorkletVersion, labels[LabelVersion]},
+		{"config sha256", manifest.ConfigHash, labels[LabelConfigHash]},
+		{"compose sha256", manifest.ComposeHash, labels[LabelComposeHash]},
+	}
+	for _, check := range checks {
+		if check.want != check.got {
+			drift = append(drift, fmt.Sprintf("%s: manifest %s, now %s", check.name, orNone(check.want), orNone(check.got)))
+		}
+	}
+
+	return drift
+}
+
+// orNone returns s, or "(none)" if it is empty
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestProvenanceLabels(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-provenance-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	composePath := filepath.Join(dir, "compose.yml")
+	if err := os.WriteFile(composePath, []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	opts := RunOptions{
+		WorkDir:     dir,
+		Config:      &config.WorkletConfig{Name: "test"},
+		ComposePath: composePath,
+	}
+
+	labels := provenanceLabels(opts)
+	commit := labels[LabelGitCommit]
+	if len(commit) != 40 {
+		t.Errorf("expected a clean commit hash, got %q", commit)
+	}
+	if labels[LabelConfigHash] == "" || labels[LabelComposeHash] == "" || labels[LabelVersion] == "" {
+		t.Errorf("expected config, compose and version labels, got %v", labels)
+	}
+	if labels[LabelMode] != "copy" || labels[LabelBaseImage] != "worklet/base:latest" {
+		t.Errorf("expected copy mode from worklet/base:latest, got %v", labels)
+	}
+	if _, ok := labels[LabelCommand]; ok {
+		t.Errorf("expected no command label without arguments, got %q", labels[LabelCommand])
+	}
+
+	// The command is recorded as JSON so arguments keep their boundaries
+	opts.CmdArgs = []string{"npm", "run", "dev server"}
+	if command := provenanceLabels(opts)[LabelCommand]; command != `["npm","run","dev server"]` {
+		t.Errorf("unexpected command label %q", command)
+	}
+	opts.CmdArgs = nil
+
+	// Changing the config changes its hash
+	opts.Config = &config.WorkletConfig{Name: "other"}
+	if provenanceLabels(opts)[LabelConfigHash] == labels[LabelConfigHash] {
+		t.Error("expected a different config hash for a different config")
+	}
+
+	// Uncommitted changes mark the commit dirty
+	if err := os.WriteFile(composePath, []byte("services: {app: {}}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dirty := provenanceLabels(opts)
+	if dirty[LabelGitCommit] != commit+"-dirty" {
+		t.Errorf("expected %s-dirty, got %q", commit, dirty[LabelGitCommit])
+	}
+	if dirty[LabelComposeHash] == labels[LabelComposeHash] {
+		t.Error("expected the compose hash to change with the file")
+	}
+}
+
+func TestDriftFrom(t *testing.T) {
+	manifest := &Description{
+		Mode:           "copy",
+		WorkletVersion: "1.0.0",
+		GitCommit:      "abc",
+		ConfigHash:     "config",
+		ComposeHash:    "compose",
+	}
+	labels := map[string]string{
+		LabelVersion:     "1.0.0",
+		LabelGitCommit:   "abc",
+		LabelConfigHash:  "config",
+		LabelComposeHash: "compose",
+	}
+
+	if drift := driftFrom(manifest, labels); len(drift) != 0 {
+		t.Errorf("expected no drift, got %v", drift)
+	}
+
+	labels[LabelGitCommit] = "abc-dirty"
+	labels[LabelConfigHash] = "changed"
+	delete(labels, LabelComposeHash)
+	if drift := driftFrom(manifest, labels); len(drift) != 3 {
+		t.Errorf("expected commit, config and compose drift, got %v", drift)
+	}
+
+	// Uncommitted changes in the manifest can't be recreated
+	manifest.GitCommit = "abc-dirty"
+	labels = map[string]string{LabelVersion: "1.0.0", LabelGitCommit: "abc-dirty", LabelConfigHash: "config", LabelComposeHash: "compose"}
+	if drift := driftFrom(manifest, labels); len(drift) != 1 {
+		t.Errorf("expected a dirty manifest to drift, got %v", drift)
+	}
+
+	// Sessions from before provenance was recorded can't be checked
+	if drift := driftFrom(&Description{}, labels); len(drift) != 1 {
+		t.Errorf("expected a manifest without provenance to drift, got %v", drift)
+	}
+}
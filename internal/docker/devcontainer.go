@@ -1,11 +1,15 @@
 package docker
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"path"
 	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
 )
 
 // DevContainerConfig represents the devcontainer.json structure
@@ -57,7 +61,7 @@ func GetUserVSCodeExtensions() ([]string, error) {
 }
 
 // GenerateDevContainerConfig creates devcontainer.json content
-func GenerateDevContainerConfig(projectName string) (string, error) {
+func GenerateDevContainerConfig(projectName, workspaceFolder string) (string, error) {
 	if projectName == "" {
 		projectName = "Worklet Session"
 	}
@@ -83,7 +87,7 @@ func GenerateDevContainerConfig(projectName string) (string, error) {
 
 	config := DevContainerConfig{
 		Name:            projectName,
-		WorkspaceFolder: "/workspace",
+		WorkspaceFolder: workspaceFolder,
 		RemoteUser:      "root",
 		Customizations: DevContainerCustom{
 			VSCode: DevContainerVSCode{
@@ -105,31 +109,32 @@ func GenerateDevContainerConfig(projectName string) (string, error) {
 }
 
 // EnsureDevContainerConfig ensures container has devcontainer.json
-func EnsureDevContainerConfig(containerID string, projectName string) error {
+func EnsureDevContainerConfig(containerID string, projectName string, workspaceFolder string) error {
 	if containerID == "" {
 		return fmt.Errorf("container ID is required")
 	}
 
 	// Generate config
-	config, err := GenerateDevContainerConfig(projectName)
+	config, err := GenerateDevContainerConfig(projectName, workspaceFolder)
 	if err != nil {
 		return fmt.Errorf("failed to generate devcontainer config: %w", err)
 	}
 
 	// Create .devcontainer directory in container
-	mkdirCmd := exec.Command("docker", "exec", containerID, "mkdir", "-p", "/workspace/.devcontainer")
+	devcontainerDir := path.Join(workspaceFolder, ".devcontainer")
+	mkdirCmd := dockerCommand(context.Background(), "exec", containerID, "mkdir", "-p", devcontainerDir)
 	if err := mkdirCmd.Run(); err != nil {
 		// Don't fail if directory creation fails (might already exist)
 		// Just log it for debugging
-		fmt.Printf("Warning: Could not create .devcontainer directory: %v\n", err)
+		fmt.Fprintf(Output, "Warning: Could not create .devcontainer directory: %v\n", err)
 	}
 
 	// Write config to container using a here-document approach for proper escaping
 	// Use base64 encoding to avoid any shell escaping issues
 	encodedConfig := base64.StdEncoding.EncodeToString([]byte(config))
 	
-	writeCmd := exec.Command("docker", "exec", containerID, "sh", "-c",
-		fmt.Sprintf(`echo "%s" | base64 -d > /workspace/.devcontainer/devcontainer.json`, encodedConfig))
+	writeCmd := dockerCommand(context.Background(), "exec", containerID, "sh", "-c",
+		fmt.Sprintf(`echo "%s" | base64 -d > %s/devcontainer.json`, encodedConfig, devcontainerDir))
 	
 	if err := writeCmd.Run(); err != nil {
 		return fmt.Errorf("failed to write devcontainer config: %w", err)
@@ -140,7 +145,7 @@ func EnsureDevContainerConfig(containerID string, projectName string) error {
 
 // GetProjectNameFromContainer retrieves the project name from container labels
 func GetProjectNameFromContainer(containerID string) string {
-	cmd := exec.Command("docker", "inspect", 
+	cmd := dockerCommand(context.Background(), "inspect", 
 		"--format", "{{index .Config.Labels \"worklet.project.name\"}}", 
 		containerID)
 	
@@ -155,4 +160,25 @@ func GetProjectNameFromContainer(containerID string) string {
 	}
 	
 	return projectName
-}
\ No newline at end of file
+}
+
+// GetContainerWorkDir returns the project path inside a session container,
+// falling back to the default for containers created before it was
+// configurable
+func GetContainerWorkDir(containerID string) string {
+	cmd := dockerCommand(context.Background(), "inspect",
+		"--format", "{{index .Config.Labels \"worklet.container.workdir\"}}",
+		containerID)
+
+	output, err := cmd.Output()
+	if err != nil {
+		return config.DefaultWorkdirPath
+	}
+
+	workDir := strings.TrimSpace(string(output))
+	if workDir == "" || workDir == "<no value>" {
+		return config.DefaultWorkdirPath
+	}
+
+	return workDir
+}
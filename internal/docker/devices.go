@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// deviceWarnings returns why devices may not make it into a session: Docker
+// Desktop runs containers in a VM that doesn't see this machine's devices,
+// and a device that doesn't exist makes docker run fail
+func deviceWarnings(devices []config.DeviceConfig) []string {
+	if len(devices) == 0 || remoteDockerHost() != "" {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return []string{fmt.Sprintf("run.devices needs Docker on Linux; Docker Desktop on %s can't pass this machine's devices into containers", runtime.GOOS)}
+	}
+	var warnings []string
+	for _, device := range devices {
+		if _, err := os.Stat(device.Path); err != nil {
+			if device.CgroupRule != "" {
+				continue // Devices may appear once something is plugged in
+			}
+			warnings = append(warnings, fmt.Sprintf("device %s doesn't exist; plug it in or remove it from run.devices", device.Path))
+		}
+	}
+	return warnings
+}
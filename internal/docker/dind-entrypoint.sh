@@ -5,6 +5,53 @@ set -e
 # Users must use Ctrl+P, Ctrl+Q to detach from the session
 trap '' INT TERM HUP
 
+# Prints the /etc/passwd entry of a user name or uid
+user_entry() {
+    awk -F: -v u="$1" '$1 == u || $3 == u { print; exit }' /etc/passwd
+}
+
+# Create the session's user (run.user) if the image doesn't have it. Setup
+# runs as root; the session's command runs as the user.
+if [ -n "$WORKLET_USER" ]; then
+    user_name="${WORKLET_USER%%:*}"
+    if [ -z "$(user_entry "$user_name")" ]; then
+        # A uid without a name gets one, which tools such as ssh need
+        case "$user_name" in
+            *[!0-9]*) new_user="$user_name"; new_uid="" ;;
+            *) new_user="worklet"; new_uid="$user_name" ;;
+        esac
+        if command -v useradd >/dev/null 2>&1; then
+            useradd -m -s /bin/sh ${new_uid:+-o -u "$new_uid"} "$new_user"
+        else
+            adduser -D -s /bin/sh ${new_uid:+-u "$new_uid"} "$new_user"
+        fi
+    fi
+    WORKLET_HOME=$(user_entry "$user_name" | cut -d: -f6)
+    export WORKLET_HOME
+
+    # Copy mode images create the user when they're built
+    if [ "$WORKLET_USER_SETUP" = 1 ]; then
+        exit 0
+    fi
+fi
+
+# Runs the session's command, as its user if it has one
+run() {
+    if [ -z "$WORKLET_USER" ]; then
+        exec "$@"
+    fi
+    entry=$(user_entry "${WORKLET_USER%%:*}")
+    export HOME="$WORKLET_HOME" USER="$(echo "$entry" | cut -d: -f1)"
+    group=$(echo "$entry" | cut -d: -f4)
+    case "$WORKLET_USER" in
+        *:*) group="${WORKLET_USER#*:}" ;;
+    esac
+    if command -v setpriv >/dev/null 2>&1; then
+        exec setpriv --reuid="$(echo "$entry" | cut -d: -f3)" --regid="$group" --init-groups "$@"
+    fi
+    exec su -p -s /bin/sh "$USER" -c 'exec "$@"' sh "$@"
+}
+
 # Start Docker daemon in the background if we're in full isolation mode
 if [ "$WORKLET_ISOLATION" = "full" ]; then
     echo "Starting Docker daemon in full isolation mode..."
@@ -13,6 +60,12 @@ if [ "$WORKLET_ISOLATION" = "full" ]; then
     mkdir -p /var/run
     mkdir -p /var/log
     
+    # Daemon options from run.dind and the host's registry mirror
+    if [ -n "$WORKLET_DOCKERD_CONFIG" ]; then
+        mkdir -p /etc/docker
+        printf '%s\n' "$WORKLET_DOCKERD_CONFIG" > /etc/docker/daemon.json
+    fi
+    
     # Function to start Docker daemon with a specific storage driver
     start_dockerd() {
         local driver=$1
@@ -119,6 +172,16 @@ if [ "$WORKLET_ISOLATION" = "full" ]; then
             fi
         fi
         
+        # Load the services' images saved on the host instead of pulling them
+        if [ -d /worklet-image-cache ] && docker compose version >/dev/null 2>&1; then
+            for image in $(docker compose -f "$WORKLET_COMPOSE_FILE" config --images 2>/dev/null); do
+                cached="/worklet-image-cache/$(echo "$image" | tr '/:@' '___').tar"
+                if [ -f "$cached" ] && docker load -q -i "$cached" >/dev/null 2>&1; then
+                    echo "Loaded $image from the image cache"
+                fi
+            done
+        fi
+
         # Generate compose project name
         COMPOSE_PROJECT_NAME="${WORKLET_PROJECT_NAME}-${WORKLET_SESSION_ID}"
         
@@ -157,20 +220,20 @@ echo ""
 
 # Execute the provided command or shell
 if [ $# -eq 0 ]; then
-    exec sh
+    run sh
 elif [ $# -eq 1 ]; then
     # Single argument - check if it contains spaces (likely a multi-word command)
     case "$1" in
         *" "*)
             # Contains spaces, use shell to parse it
-            exec sh -c "$1"
+            run sh -c "$1"
             ;;
         *)
             # Single command, execute directly
-            exec "$1"
+            run "$1"
             ;;
     esac
 else
     # Multiple arguments, execute directly
-    exec "$@"
+    run "$@"
 fi
\ No newline at end of file
@@ -0,0 +1,214 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+const (
+	// containerXAuthority is where a session finds the X cookie it was given
+	containerXAuthority = "/tmp/.worklet-xauthority"
+	// containerWaylandRuntime is the XDG_RUNTIME_DIR holding the Wayland
+	// socket inside a session
+	containerWaylandRuntime = "/tmp/worklet-runtime"
+	// wslgDir is where WSL 2 mounts WSLg's X11, Wayland and PulseAudio sockets
+	wslgDir = "/mnt/wslg"
+)
+
+// displayHost is what display forwarding looks at on this machine
+type displayHost struct {
+	GOOS   string
+	Getenv func(string) string
+	Exists func(string) bool
+}
+
+// localDisplayHost describes this machine
+func localDisplayHost() displayHost {
+	return displayHost{
+		GOOS:   runtime.GOOS,
+		Getenv: os.Getenv,
+		Exists: func(path string) bool {
+			_, err := os.Stat(path)
+			return err == nil
+		},
+	}
+}
+
+// displayMode returns how the session's display is forwarded, or "" if it
+// isn't
+func (opts RunOptions) displayMode() string {
+	if opts.Display != "" {
+		return opts.Display
+	}
+	return opts.Config.Run.Display
+}
+
+// displayForwarding returns the docker run arguments that let GUI apps in a
+// session open windows on host's screen in mode, and notes on anything the
+// user has to set up themselves. xauthority is the X cookie file to mount,
+// if any.
+func displayForwarding(mode string, host displayHost, xauthority string) (args, notes []string) {
+	x11 := mode == config.DisplayAuto || mode == config.DisplayX11
+	wayland := mode == config.DisplayAuto || mode == config.DisplayWayland
+
+	switch host.GOOS {
+	case "darwin":
+		if !x11 {
+			return nil, []string{"Wayland can't be forwarded from macOS; use run.display \"x11\" with XQuartz"}
+		}
+		return []string{"-e", "DISPLAY=host.docker.internal:0"}, []string{
+			"Windows open through XQuartz: install it, enable \"Allow connections from network clients\" in its Security settings, restart it and run 'xhost +localhost'",
+		}
+	case "windows":
+		if !x11 {
+			return nil, []string{"Wayland can't be forwarded from Windows; use run.display \"x11\" with an X server such as VcXsrv"}
+		}
+		return []string{"-e", "DISPLAY=host.docker.internal:0.0"}, []string{
+			"Windows open through an X server on this machine: start VcXsrv (or another) with access control disabled, or run worklet inside WSL 2 to use WSLg",
+		}
+	}
+
+	// WSLg serves both X11 and Wayland from the WSL 2 distribution
+	if host.Exists(wslgDir) {
+		args = append(args, "-v", wslgDir+":"+wslgDir)
+		if x11 {
+			display := host.Getenv("DISPLAY")
+			if display == "" {
+				display = ":0"
+			}
+			args = append(args, "-v", wslgDir+"/.X11-unix:/tmp/.X11-unix:ro", "-e", "DISPLAY="+display)
+		}
+		if wayland {
+			args = append(args,
+				"-e", "WAYLAND_DISPLAY=wayland-0",
+				"-e", "XDG_RUNTIME_DIR="+wslgDir+"/runtime-dir")
+		}
+		args = append(args, "-e", "PULSE_SERVER=unix:"+wslgDir+"/PulseServer")
+		return args, nil
+	}
+
+	if wayland {
+		socket := host.Getenv("WAYLAND_DISPLAY")
+		if socket != "" && !filepath.IsAbs(socket) {
+			socket = filepath.Join(host.Getenv("XDG_RUNTIME_DIR"), socket)
+		}
+		if socket != "" && filepath.IsAbs(socket) && host.Exists(socket) {
+			args = append(args,
+				"-v", socket+":"+containerWaylandRuntime+"/wayland-0",
+				"-e", "WAYLAND_DISPLAY=wayland-0",
+				"-e", "XDG_RUNTIME_DIR="+containerWaylandRuntime)
+		} else if mode == config.DisplayWayland {
+			notes = append(notes, "No Wayland display to forward: WAYLAND_DISPLAY isn't set or its socket doesn't exist")
+		}
+	}
+
+	if x11 {
+		display := host.Getenv("DISPLAY")
+		switch {
+		case display == "":
+			if mode == config.DisplayX11 || len(args) == 0 {
+				notes = append(notes, "No X11 display to forward: DISPLAY isn't set")
+			}
+		case !strings.HasPrefix(display, ":"):
+			// e.g. localhost:10.0 from ssh -X, which listens on the host's
+			// loopback the session can't reach
+			notes = append(notes, fmt.Sprintf("Can't forward X11 display %s: only local displays such as :0 are forwarded", display))
+		case !host.Exists("/tmp/.X11-unix"):
+			notes = append(notes, "Can't forward X11: /tmp/.X11-unix doesn't exist")
+		default:
+			args = append(args,
+				"-v", "/tmp/.X11-unix:/tmp/.X11-unix:ro",
+				"-e", "DISPLAY="+display,
+				// Shared memory isn't shared with the host's X server
+				"-e", "QT_X11_NO_MITSHM=1")
+			if xauthority != "" {
+				args = append(args,
+					"-v", xauthority+":"+containerXAuthority+":ro",
+					"-e", "XAUTHORITY="+containerXAuthority)
+			}
+		}
+	}
+	return args, notes
+}
+
+// xauthorityPath returns where a session's X cookie is kept
+func xauthorityPath(sessionID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "display", sessionID+".xauth"), nil
+}
+
+// writeXAuthority gives a session a cookie for the X display. The host's
+// cookie is tied to its hostname, which the container doesn't share, so
+// it's rewritten to match any host. Without xauth, the host's cookie file
+// is used as it is.
+func writeXAuthority(ctx context.Context, sessionID, display string) string {
+	if _, err := exec.LookPath("xauth"); err == nil {
+		if path, err := xauthorityPath(sessionID); err == nil && os.MkdirAll(filepath.Dir(path), 0700) == nil {
+			output, err := exec.CommandContext(ctx, "xauth", "nlist", display).Output()
+			if err == nil && len(output) > 0 {
+				var cookies bytes.Buffer
+				for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+					// The first field is the address family; ffff is any
+					if len(line) > 4 {
+						cookies.WriteString("ffff" + line[4:] + "\n")
+					}
+				}
+				merge := exec.CommandContext(ctx, "xauth", "-f", path, "nmerge", "-")
+				merge.Stdin = &cookies
+				if merge.Run() == nil {
+					return path
+				}
+			}
+		}
+	}
+	if path := os.Getenv("XAUTHORITY"); path != "" {
+		return path
+	}
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		if path := filepath.Join(homeDir, ".Xauthority"); fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// prepareDisplay works out the display forwarding arguments of a session,
+// printing anything the user has to set up
+func prepareDisplay(ctx context.Context, opts RunOptions) []string {
+	mode := opts.displayMode()
+	if mode == "" {
+		return nil
+	}
+	if host := remoteDockerHost(); host != "" {
+		fmt.Fprintf(Output, "Warning: Docker daemon is remote (%s); the display isn't forwarded\n", host)
+		return nil
+	}
+	host := localDisplayHost()
+	var xauthority string
+	if display := host.Getenv("DISPLAY"); host.GOOS == "linux" && strings.HasPrefix(display, ":") && !host.Exists(wslgDir) {
+		xauthority = writeXAuthority(ctx, opts.SessionID, display)
+	}
+	args, notes := displayForwarding(mode, host, xauthority)
+	for _, note := range notes {
+		fmt.Fprintf(Output, "Note: %s\n", note)
+	}
+	return args
+}
+
+// removeXAuthority removes the X cookie written for a session, if any
+func removeXAuthority(sessionID string) {
+	if path, err := xauthorityPath(sessionID); err == nil {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,108 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func fakeDisplayHost(goos string, env map[string]string, paths ...string) displayHost {
+	return displayHost{
+		GOOS:   goos,
+		Getenv: func(key string) string { return env[key] },
+		Exists: func(path string) bool {
+			for _, p := range paths {
+				if p == path {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+func TestDisplayForwarding(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		host     displayHost
+		expected []string
+		absent   []string
+		notes    int
+	}{
+		{
+			name:     "x11",
+			mode:     config.DisplayAuto,
+			host:     fakeDisplayHost("linux", map[string]string{"DISPLAY": ":1"}, "/tmp/.X11-unix"),
+			expected: []string{"-v /tmp/.X11-unix:/tmp/.X11-unix:ro", "-e DISPLAY=:1", "-e XAUTHORITY=" + containerXAuthority},
+			absent:   []string{"WAYLAND_DISPLAY"},
+		},
+		{
+			name: "wayland and x11",
+			mode: config.DisplayAuto,
+			host: fakeDisplayHost("linux", map[string]string{"DISPLAY": ":0", "WAYLAND_DISPLAY": "wayland-1", "XDG_RUNTIME_DIR": "/run/user/1000"},
+				"/tmp/.X11-unix", "/run/user/1000/wayland-1"),
+			expected: []string{"-v /run/user/1000/wayland-1:" + containerWaylandRuntime + "/wayland-0", "-e WAYLAND_DISPLAY=wayland-0", "-e DISPLAY=:0"},
+		},
+		{
+			name:     "wayland only",
+			mode:     config.DisplayWayland,
+			host:     fakeDisplayHost("linux", map[string]string{"DISPLAY": ":0", "WAYLAND_DISPLAY": "/tmp/wl", "XDG_RUNTIME_DIR": "/run/user/1000"}, "/tmp/.X11-unix", "/tmp/wl"),
+			expected: []string{"-v /tmp/wl:" + containerWaylandRuntime + "/wayland-0"},
+			absent:   []string{"-e DISPLAY=", "X11"},
+		},
+		{
+			name:     "wslg",
+			mode:     config.DisplayAuto,
+			host:     fakeDisplayHost("linux", map[string]string{"DISPLAY": ":0"}, wslgDir),
+			expected: []string{"-v /mnt/wslg:/mnt/wslg", "-v /mnt/wslg/.X11-unix:/tmp/.X11-unix:ro", "-e XDG_RUNTIME_DIR=/mnt/wslg/runtime-dir", "-e PULSE_SERVER=unix:/mnt/wslg/PulseServer"},
+			absent:   []string{"XAUTHORITY"},
+		},
+		{
+			name:   "ssh forwarded display",
+			mode:   config.DisplayX11,
+			host:   fakeDisplayHost("linux", map[string]string{"DISPLAY": "localhost:10.0"}, "/tmp/.X11-unix"),
+			absent: []string{"-e DISPLAY="},
+			notes:  1,
+		},
+		{
+			name:  "no display",
+			mode:  config.DisplayAuto,
+			host:  fakeDisplayHost("linux", nil),
+			notes: 1,
+		},
+		{
+			name:     "macOS",
+			mode:     config.DisplayAuto,
+			host:     fakeDisplayHost("darwin", nil),
+			expected: []string{"-e DISPLAY=host.docker.internal:0"},
+			notes:    1,
+		},
+		{
+			name:  "wayland on windows",
+			mode:  config.DisplayWayland,
+			host:  fakeDisplayHost("windows", nil),
+			notes: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, notes := displayForwarding(tt.mode, tt.host, "/home/me/.worklet/display/abc.xauth")
+			joined := strings.Join(args, " ")
+			for _, expected := range tt.expected {
+				if !strings.Contains(joined, expected) {
+					t.Errorf("expected %s in %v", expected, args)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(joined, absent) {
+					t.Errorf("expected no %s in %v", absent, args)
+				}
+			}
+			if len(notes) != tt.notes {
+				t.Errorf("expected %d notes, got %v", tt.notes, notes)
+			}
+		})
+	}
+}
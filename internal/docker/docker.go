@@ -1,18 +1,20 @@
 package docker
 
 import (
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/nolanleung/worklet/internal/config"
 	"github.com/nolanleung/worklet/internal/env"
+	"github.com/nolanleung/worklet/internal/fscopy"
 )
 
 //go:embed dind-entrypoint.sh
@@ -26,41 +28,512 @@ type RunOptions struct {
 	MountMode   bool
 	ComposePath string // Resolved compose path
 	CmdArgs     []string
+	TraceID     string               // Trace ID of the worklet run that created the container
+	Progress    ProgressFunc         // Optional startup progress reporting
+	GitDir      string               // Main repository .git directory when WorkDir is a git worktree
+	ExtraMounts []config.MountConfig // Mounts from --mount flags, added to run.mounts in mount mode
+	Image       string               // Overrides run.image, e.g. to pin it to a digest
+	// CredentialsTTL overrides run.credentials.ttl
+	CredentialsTTL time.Duration
+	// TemporaryWorkDir is set when WorkDir is removed after the run, such as
+	// a fresh clone, so copy mode must copy it rather than mount it
+	TemporaryWorkDir bool
+	// IgnoreResources starts the session even if the Docker host doesn't
+	// seem to have the memory or disk it needs
+	IgnoreResources bool
+	// ImageCache is the image cache directory full isolation sessions load
+	// their compose services' images from; prepareRun sets it
+	ImageCache string
+	// RegistryMirror is the address of the registry mirror a full isolation
+	// session's Docker daemon pulls Docker Hub images through; prepareRun
+	// sets it
+	RegistryMirror string
+	// Display overrides run.display
+	Display string
+	// DisplayArgs are the docker run arguments forwarding the display into
+	// the session; prepareRun sets them
+	DisplayArgs []string
+	// BrowsersImage is the base image with run.browsers installed, which
+	// the session runs instead; prepareRun sets it
+	BrowsersImage string
+	// TimezoneArgs are the docker run arguments setting run.timezone;
+	// prepareRun sets them
+	TimezoneArgs []string
+	// FaketimeImage is the session's image with libfaketime installed for
+	// run.faketime, which the session runs instead; prepareRun sets it
+	FaketimeImage string
+	// Dotfiles is the host directory of the dotfiles the global config
+	// installs in sessions, and DotfilesInstall the command installing
+	// them; RunContainer sets them
+	Dotfiles        string
+	DotfilesInstall string
+	// HostOwner is the uid:gid mount mode hands files created as root back
+	// to; RunContainer and RunEphemeral set it
+	HostOwner string
+
+	// Ephemeral runs the container in the foreground, removed on exit and
+	// hidden from the daemon; see RunEphemeral
+	Ephemeral   bool
+	Interactive bool // Attach stdin (Ephemeral only)
+	TTY         bool // Allocate a terminal (Ephemeral only)
 }
 
-// RunContainer runs a container in detached mode and returns the container ID
-func RunContainer(opts RunOptions) (string, error) {
-	var imageName string
-	var err error
+// baseImage returns the image a session is started from, before the
+// workspace is copied in
+func (opts RunOptions) baseImage() string {
+	if opts.Image != "" {
+		return opts.Image
+	}
+	if opts.Config.Run.Image != "" {
+		return opts.Config.Run.Image
+	}
+	return defaultBaseImage
+}
+
+// sessionImage returns the image the session runs, or has the workspace
+// copied into: the base image, with browsers if run.browsers installs them
+// and libfaketime for run.faketime
+func (opts RunOptions) sessionImage() string {
+	if opts.FaketimeImage != "" {
+		return opts.FaketimeImage
+	}
+	if opts.BrowsersImage != "" {
+		return opts.BrowsersImage
+	}
+	return opts.baseImage()
+}
+
+// RunContainer runs a container in detached mode and returns the container ID.
+// If it fails or ctx is cancelled part way through, anything it created for
+// the session is removed again, but nothing another session with the same
+// ID already had.
+func RunContainer(ctx context.Context, opts RunOptions) (containerID string, err error) {
+	if err := CheckPolicy(opts); err != nil {
+		return "", err
+	}
+	if err := checkCredentialsTTL(opts); err != nil {
+		return "", err
+	}
+	if err := CheckResources(ctx, opts); err != nil {
+		return "", err
+	}
+	rollback, err := startRollback(ctx, opts)
+	if err != nil {
+		return "", err
+	}
 
 	// Ensure session-specific Docker network exists before running container
 	if err := EnsureSessionNetworkExists(opts.SessionID); err != nil {
 		return "", fmt.Errorf("failed to ensure session Docker network exists: %w", err)
 	}
 
-	// In copy mode, build a temporary image with the workspace files
-	if !opts.MountMode {
-		imageName, err = buildCopyImage(opts.WorkDir, opts.Config, opts.SessionID)
+	// Roll back partially created resources on failure
+	defer func() {
+		if err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("run cancelled: %w", ctx.Err())
+			}
+			rollback.run()
+		}
+	}()
+
+	if opts.MountMode {
+		opts.HostOwner = hostOwner(opts.Config)
+	}
+	opts.Dotfiles, opts.DotfilesInstall = prepareDotfiles(ctx, opts)
+	args, cleanup, err := prepareRun(ctx, opts)
+	defer cleanup()
+	if err != nil {
+		return "", err
+	}
+
+	// Execute docker command and capture output to get container ID
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	// docker run writes the ID of the container it creates to the cidfile
+	// even when starting it fails, so exactly that container is rolled back
+	cidDir, err := os.MkdirTemp("", "worklet-cid-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(cidDir)
+	cidFile := filepath.Join(cidDir, "cid")
+	if len(args) > 0 && args[0] == "run" {
+		args = append([]string{"run", "--cidfile", cidFile}, args[1:]...)
+	}
+
+	opts.Progress.Start(PhaseCreate, "Creating container")
+	cmd := dockerCommand(ctx, args...)
+	output, err := cmd.Output()
+	if cid, readErr := os.ReadFile(cidFile); readErr == nil {
+		rollback.containerID = strings.TrimSpace(string(cid))
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if strings.Contains(string(exitErr.Stderr), "is already in use") {
+				// Another run took the session's name since startRollback
+				// looked, so what the session ID names is that run's
+				rollback.conflict = true
+			}
+			err = fmt.Errorf("docker command failed: %w\nStderr: %s", err, exitErr.Stderr)
+		} else {
+			err = fmt.Errorf("docker command failed: %w", err)
+		}
+		opts.Progress.Fail(PhaseCreate, err)
+		return "", err
+	}
+
+	// Extract container ID from output
+	containerID = strings.TrimSpace(string(output))
+	if containerID == "" {
+		err := fmt.Errorf("failed to get container ID from docker run output")
+		opts.Progress.Fail(PhaseCreate, err)
+		return "", err
+	}
+	opts.Progress.Done(PhaseCreate, containerID[:min(12, len(containerID))])
+
+	// Keep files the session creates as root owned by the host user
+	startOwnershipShim(ctx, containerID, opts)
+
+	// Give shells in the session the user's aliases, prompt and editor config
+	installDotfiles(ctx, containerID, opts)
+
+	// Set up devcontainer configuration for VSCode support
+	projectName := containerProjectName(opts.Config)
+	
+	// Generate and write devcontainer.json (non-blocking, best effort)
+	go func() {
+		// Small delay to ensure container is fully started
+		time.Sleep(1 * time.Second)
+		if err := EnsureDevContainerConfig(containerID, projectName, opts.Config.ContainerWorkDir()); err != nil {
+			// Log warning but don't fail - VSCode will still work without it
+			fmt.Fprintf(Output, "Note: Could not set up VSCode extensions auto-sync: %v\n", err)
+		}
+	}()
+
+	return containerID, nil
+}
+
+// prepareRun builds the image or copy-on-write workspace a session container
+// needs and returns its docker run arguments. cleanup removes temporary
+// files once the container has started; it is never nil.
+func prepareRun(ctx context.Context, opts RunOptions) (args []string, cleanup func(), err error) {
+	cleanup = func() {}
+	var imageName string
+
+	// Host paths are resolved on the daemon's machine, not this one
+	if opts.MountMode {
+		if host := remoteDockerHost(); host != "" {
+			fmt.Fprintf(Output, "Warning: Docker daemon is remote (%s); mounted paths must exist on that host\n", host)
+		}
+	} else if len(opts.Config.Run.Mounts) > 0 || len(opts.ExtraMounts) > 0 {
+		fmt.Fprintln(Output, "Note: Extra mounts are only used in mount mode (--mount)")
+	}
+
+	if creds := opts.Config.Run.Credentials; creds != nil && creds.Claude {
+		if profile := creds.ClaudeProfileName(); profile != config.DefaultClaudeProfile {
+			if exists, _ := VolumeExists(config.ClaudeVolume(profile)); !exists {
+				fmt.Fprintf(Output, "Warning: Claude profile %s isn't configured; run 'worklet credentials claude login %s'\n", profile, profile)
+			}
+		}
+	}
+
+	if ttl := credentialsTTL(opts); ttl > 0 {
+		fmt.Fprintf(Output, "Credentials are revoked after %v, at %s\n", ttl, time.Now().Add(ttl).Format("15:04"))
+	}
+
+	writeExportedCredentials(ctx, opts)
+
+	for _, warning := range deviceWarnings(opts.Config.Run.Devices) {
+		fmt.Fprintf(Output, "Warning: %s\n", warning)
+	}
+
+	if len(opts.Config.Run.GPUs) > 0 {
+		for _, problem := range GPUSupportProblems(ctx) {
+			fmt.Fprintf(Output, "Warning: run.gpus may not work: %s (see 'worklet doctor')\n", problem)
+		}
+	}
+
+	opts.DisplayArgs = prepareDisplay(ctx, opts)
+
+	// Check the base image for vulnerabilities before it first runs
+	if err := scanImage(ctx, opts); err != nil {
+		return nil, cleanup, err
+	}
+
+	// Install browsers in a layer on top of the base image, shared by
+	// every session of the same image
+	if opts.Config.Run.Browsers != nil {
+		opts.Progress.Start(PhaseBuild, "Installing browsers")
+		opts.BrowsersImage, err = ensureBrowsersImage(ctx, opts)
+		if err != nil {
+			opts.Progress.Fail(PhaseBuild, err)
+			return nil, cleanup, fmt.Errorf("failed to install browsers: %w", err)
+		}
+		opts.Progress.Done(PhaseBuild, opts.BrowsersImage)
+	}
+
+	// Install libfaketime in a layer on top, shared the same way
+	if opts.Config.Run.Faketime != "" {
+		opts.Progress.Start(PhaseBuild, "Installing libfaketime")
+		opts.FaketimeImage, err = ensureFaketimeImage(ctx, opts)
 		if err != nil {
-			return "", fmt.Errorf("failed to build copy image: %w", err)
+			opts.Progress.Fail(PhaseBuild, err)
+			return nil, cleanup, fmt.Errorf("failed to install libfaketime: %w", err)
 		}
+		opts.Progress.Done(PhaseBuild, opts.FaketimeImage)
+	}
+	opts.TimezoneArgs = prepareTimezone(opts)
+
+	// A copy-on-write workspace needs the project on the Docker host for the
+	// life of the session
+	if useOverlay(opts) {
+		if reason := overlayUnavailable(opts); reason != "" {
+			fmt.Fprintf(Output, "Note: Copying the workspace into an image since %s\n", reason)
+			cfg := *opts.Config
+			cfg.Run.CopyStrategy = config.CopyStrategyImage
+			opts.Config = &cfg
+		}
+	}
+
+	if useOverlay(opts) {
+		// Mount the project read-only under a copy-on-write layer instead of
+		// copying it
+		imageName = opts.sessionImage()
+		opts.Progress.Start(PhaseBuild, "Preparing copy-on-write workspace")
+		if err := prepareOverlay(ctx, opts, imageName); err != nil {
+			opts.Progress.Fail(PhaseBuild, err)
+			return nil, cleanup, fmt.Errorf("failed to prepare copy-on-write workspace: %w", err)
+		}
+		opts.Progress.Done(PhaseBuild, overlayVolumeName(opts.SessionID))
+	} else if !opts.MountMode {
+		// In copy mode, build a temporary image with the workspace files
+		opts.Progress.Start(PhaseBuild, "Building image with workspace files")
+		imageName, err = buildCopyImage(ctx, opts.WorkDir, opts.Config, opts.sessionImage(), opts.SessionID, opts.Progress)
+		if err != nil {
+			opts.Progress.Fail(PhaseBuild, err)
+			return nil, cleanup, fmt.Errorf("failed to build copy image: %w", err)
+		}
+		opts.Progress.Done(PhaseBuild, imageName)
 		// Note: We don't clean up the image here since container will be running
 	} else {
 		// In mount mode, use the configured image
-		imageName = opts.Config.Run.Image
-		if imageName == "" {
-			imageName = "worklet/base:latest"
-		}
+		imageName = opts.sessionImage()
 
-		// Process environment templates for mount mode (write to host directory)
-		if err := processEnvironmentTemplates(opts.WorkDir, opts.WorkDir, opts); err != nil {
+		// Process environment templates for mount mode (write to host
+		// directory), unless the project turned that off
+		if !opts.Config.Run.WritesHostEnvFiles() {
+			fmt.Fprintf(Output, "Not writing env files into %s: run.writeEnvFiles is off\n", opts.WorkDir)
+		} else if err := processHostEnvironmentTemplates(opts); err != nil {
 			// Log warning but don't fail the container start
-			fmt.Printf("Warning: Failed to process environment templates: %v\n", err)
+			fmt.Fprintf(Output, "Warning: Failed to process environment templates: %v\n", err)
+		}
+	}
+
+	// Let the session's Docker daemon load compose images saved on the host
+	if useImageCache(opts) {
+		if dir, err := ImageCacheDir(); err == nil && os.MkdirAll(dir, 0755) == nil {
+			opts.ImageCache = dir
+		}
+	}
+
+	// Let the session's Docker daemon pull through the registry mirror
+	opts.RegistryMirror = useRegistryMirror(ctx, opts)
+
+	// Start the add-ons the session connects to
+	if err := startAddons(ctx, opts); err != nil {
+		return nil, cleanup, err
+	}
+
+	// In full isolation mount mode, the entrypoint script is mounted from a temp file
+	var scriptPath string
+	if opts.MountMode && isolationMode(opts.Config) == "full" {
+		scriptPath, err = getEntrypointScriptPath()
+		if err != nil {
+			return nil, cleanup, fmt.Errorf("failed to get entrypoint script path: %w", err)
+		}
+		// Remove the temp script file once the container has started
+		cleanup = func() { os.Remove(scriptPath) }
+	}
+
+	args, err = buildRunArgs(opts, imageName, scriptPath)
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	// Create pnpm store volume if this is a pnpm project
+	if _, err := os.Stat(filepath.Join(opts.WorkDir, "pnpm-lock.yaml")); err == nil {
+		if err := ensureDockerVolumeExists(pnpmStoreVolumeName(containerProjectName(opts.Config))); err != nil {
+			return nil, cleanup, fmt.Errorf("failed to create pnpm store volume: %w", err)
 		}
 	}
 
-	// Build docker run command for detached mode
+	return args, cleanup, nil
+}
+
+// RunEphemeral runs a session container in the foreground with its output,
+// and with opts.Interactive its input, attached, like docker run --rm. When
+// the command exits, the container and everything created for it are
+// removed. It returns the command's exit code.
+func RunEphemeral(ctx context.Context, opts RunOptions) (exitCode int, err error) {
+	opts.Ephemeral = true
+
+	if err := CheckPolicy(opts); err != nil {
+		return -1, err
+	}
+	if err := CheckResources(ctx, opts); err != nil {
+		return -1, err
+	}
+
+	rollback, err := startRollback(ctx, opts)
+	if err != nil {
+		return -1, err
+	}
+	if err := EnsureSessionNetworkExists(opts.SessionID); err != nil {
+		return -1, fmt.Errorf("failed to ensure session Docker network exists: %w", err)
+	}
+	defer rollback.run()
+
+	if opts.MountMode {
+		opts.HostOwner = hostOwner(opts.Config)
+	}
+	args, cleanup, err := prepareRun(ctx, opts)
+	defer cleanup()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("run cancelled: %w", ctx.Err())
+		}
+		return -1, err
+	}
+	if ctx.Err() != nil {
+		return -1, fmt.Errorf("run cancelled: %w", ctx.Err())
+	}
+
+	// Not tied to ctx: the docker CLI forwards Ctrl+C to the container and
+	// returns once it has exited
+	cmd := dockerCommand(context.Background(), args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if !opts.Interactive {
+		cmd.Stdin = nil
+	}
+	if opts.MountMode && opts.HostOwner != "" {
+		go startEphemeralOwnershipShim(opts)
+	}
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), nil
+		}
+		return -1, fmt.Errorf("docker command failed: %w", err)
+	}
+	return 0, nil
+}
+
+// RollbackSession removes the resources RunContainer creates for a session:
+// the container, the copy-mode image or overlay, the DinD volume, the exported
+// credentials, the X cookie, the add-ons and the session network.
+// It is best effort and ignores resources that don't exist. It removes them
+// by the session's names, so it's only for a session whose container is
+// known to be this run's; a failing RunContainer rolls back on its own.
+func RollbackSession(sessionID string, cfg *config.WorkletConfig) {
+	// Use a fresh context since the run's context may already be cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	containerName := fmt.Sprintf("%s-%s", containerProjectName(cfg), sessionID)
+	dockerCommand(ctx, "rm", "-f", containerName).Run()
+	dockerCommand(ctx, "rmi", copyImageName(cfg, sessionID)).Run()
+	dockerCommand(ctx, "volume", "rm", fmt.Sprintf("worklet-%s", sessionID)).Run()
+	removeOverlay(sessionID)
+	RemoveExportedCredentials(sessionID)
+	removeXAuthority(sessionID)
+	RemoveReloadState(sessionID)
+	RemoveAddons(ctx, sessionID)
+
+	if err := RemoveSessionNetworkSafe(sessionID); err != nil {
+		fmt.Fprintf(Output, "Warning: failed to remove network for session %s: %v\n", sessionID, err)
+	}
+}
+
+// sessionRollback records what a run creates for a session, so that
+// rolling it back removes only that. Session IDs are reserved before a run,
+// but a race can still give two runs the same one, and the other run's
+// container, DinD volume and network must survive this one failing.
+type sessionRollback struct {
+	sessionID   string
+	cfg         *config.WorkletConfig
+	network     bool   // The session network didn't exist before the run
+	volume      bool   // The DinD volume didn't exist before the run
+	containerID string // Container docker run created, from its cidfile
+	conflict    bool   // docker run found the session's container name taken
+}
+
+// startRollback records which of the session's resources exist before a
+// run. It refuses to run a session whose container already exists.
+func startRollback(ctx context.Context, opts RunOptions) (*sessionRollback, error) {
+	containerName := fmt.Sprintf("%s-%s", containerProjectName(opts.Config), opts.SessionID)
+	if dockerCommand(ctx, "container", "inspect", containerName).Run() == nil {
+		return nil, fmt.Errorf("session %s already has a container named %s", opts.SessionID, containerName)
+	}
+
+	rollback := &sessionRollback{sessionID: opts.SessionID, cfg: opts.Config}
+	// Resources that can't be checked are assumed to exist, so they're kept
+	if exists, err := NetworkExists(fmt.Sprintf("worklet-%s", opts.SessionID)); err == nil {
+		rollback.network = !exists
+	}
+	if exists, err := VolumeExists(fmt.Sprintf("worklet-%s", opts.SessionID)); err == nil {
+		rollback.volume = !exists
+	}
+	return rollback, nil
+}
+
+// run removes what the run created. After a name conflict, the resources
+// named after the session ID are the other run's and are left alone.
+func (r *sessionRollback) run() {
+	// Use a fresh context since the run's context may already be cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if r.containerID != "" {
+		dockerCommand(ctx, "rm", "-f", r.containerID).Run()
+	}
+	if !r.conflict {
+		dockerCommand(ctx, "rmi", copyImageName(r.cfg, r.sessionID)).Run()
+		if r.volume {
+			dockerCommand(ctx, "volume", "rm", fmt.Sprintf("worklet-%s", r.sessionID)).Run()
+		}
+		removeOverlay(r.sessionID)
+		RemoveExportedCredentials(r.sessionID)
+		removeXAuthority(r.sessionID)
+		RemoveReloadState(r.sessionID)
+		RemoveAddons(ctx, r.sessionID)
+	}
+	if r.network {
+		if err := RemoveSessionNetworkSafe(r.sessionID); err != nil {
+			fmt.Fprintf(Output, "Warning: failed to remove network for session %s: %v\n", r.sessionID, err)
+		}
+	}
+}
+
+// buildRunArgs builds the docker run arguments for a session container.
+// It has no side effects so it can also be used to plan a run.
+func buildRunArgs(opts RunOptions, imageName, scriptPath string) ([]string, error) {
+	// Build docker run command for detached mode, or attached for an
+	// ephemeral run
 	args := []string{"run", "-d"}
+	if opts.Ephemeral {
+		args = []string{"run", "--rm"}
+		if opts.Interactive {
+			args = append(args, "-i")
+		}
+		if opts.TTY {
+			args = append(args, "-t")
+		}
+	}
 
 	// Add container name using project name and session ID
 	projectName := opts.Config.Name
@@ -70,33 +543,173 @@ func RunContainer(opts RunOptions) (string, error) {
 	containerName := fmt.Sprintf("%s-%s", projectName, opts.SessionID)
 	args = append(args, "--name", containerName)
 
+	// Let Docker restart the session after a crash or OOM kill
+	if opts.Config.Run.RestartPolicy != "" && !opts.Ephemeral {
+		args = append(args, "--restart", opts.Config.Run.RestartPolicy)
+	}
+
+	// Cap the session's memory
+	if opts.Config.Run.Memory != "" {
+		args = append(args, "--memory", opts.Config.Run.Memory)
+	}
+
+	// Pass GPUs in through the NVIDIA Container Toolkit
+	if gpus := opts.Config.Run.GPUs; len(gpus) > 0 {
+		args = append(args, "--gpus", gpus.DockerFlag())
+		args = append(args, "-e", "NVIDIA_VISIBLE_DEVICES="+gpus.VisibleDevices())
+		args = append(args, "-e", "NVIDIA_DRIVER_CAPABILITIES=compute,utility")
+	}
+
+	// Pass host devices in
+	for _, device := range opts.Config.Run.Devices {
+		args = append(args, device.DockerArgs()...)
+	}
+
+	// Let GUI apps open windows on the host's screen
+	args = append(args, opts.DisplayArgs...)
+
+	// Tell the browsers layer which endpoints to start
+	if browsers := opts.Config.Run.Browsers; browsers != nil {
+		for _, env := range browsersEnv(browsers, len(opts.DisplayArgs) > 0) {
+			args = append(args, "-e", env)
+		}
+	}
+
+	// Add names to the session's /etc/hosts
+	args = append(args, opts.Config.Run.ExtraHosts.DockerArgs()...)
+
+	// Have sh shells read the dotfiles
+	for _, env := range dotfilesEnv(opts) {
+		args = append(args, "-e", env)
+	}
+
+	// Set the session's clock
+	args = append(args, opts.TimezoneArgs...)
+	if faketime := opts.Config.Run.Faketime; faketime != "" {
+		for _, env := range faketimeEnv(faketime) {
+			args = append(args, "-e", env)
+		}
+	}
+
+	// Where the project lives inside the container
+	containerWorkDir := opts.Config.ContainerWorkDir()
+
 	// Add to session-specific worklet network for container-to-container communication
 	networkName := GetSessionNetworkName(opts.SessionID)
 	args = append(args, "--network", networkName)
 
-	// Add worklet labels for terminal discovery
-	args = append(args, "--label", "worklet.session=true")
+	// Add worklet labels for terminal discovery. Ephemeral containers are
+	// labelled apart so the daemon and session commands leave them alone.
+	if opts.Ephemeral {
+		args = append(args, "--label", "worklet.ephemeral=true")
+	} else {
+		args = append(args, "--label", "worklet.session=true")
+	}
 	args = append(args, "--label", fmt.Sprintf("worklet.session.id=%s", opts.SessionID))
+	if opts.RegistryMirror != "" {
+		args = append(args, "--label", LabelUsesRegistryMirror+"=true")
+	}
 	args = append(args, "--label", fmt.Sprintf("worklet.project.name=%s", projectName))
 	args = append(args, "--label", fmt.Sprintf("worklet.workdir=%s", opts.WorkDir))
+	args = append(args, "--label", fmt.Sprintf("worklet.container.workdir=%s", containerWorkDir))
+	// Let the daemon tell a project that was since deleted from a clone that
+	// was only ever temporary
+	args = append(args, "--label", fmt.Sprintf("worklet.workdir.temporary=%t", opts.TemporaryWorkDir))
+	if configFile, err := config.FindConfigFile(opts.WorkDir); !opts.TemporaryWorkDir && err == nil {
+		args = append(args, "--label", fmt.Sprintf("worklet.config.file=%s", configFile))
+	}
+	if opts.TraceID != "" {
+		args = append(args, "--label", fmt.Sprintf("worklet.trace.id=%s", opts.TraceID))
+	}
+
+	// Record what the session was created from for `worklet describe`
+	provenance := provenanceLabels(opts)
+	for _, key := range []string{LabelVersion, LabelGitCommit, LabelConfigHash, LabelComposeHash, LabelMode, LabelBaseImage, LabelCommand} {
+		if value, ok := provenance[key]; ok {
+			args = append(args, "--label", fmt.Sprintf("%s=%s", key, value))
+		}
+	}
 
 	// Add service labels for discovery
 	for _, svc := range opts.Config.Services {
 		args = append(args, "--label", fmt.Sprintf("worklet.service.%s.port=%d", svc.Name, svc.Port))
 		args = append(args, "--label", fmt.Sprintf("worklet.service.%s.subdomain=%s", svc.Name, svc.Subdomain))
+		if svc.Protocol != "" {
+			args = append(args, "--label", fmt.Sprintf("worklet.service.%s.protocol=%s", svc.Name, svc.Protocol))
+		}
+		if host := ServiceHost(opts.Config, opts.SessionID, svc); host != "" {
+			// Served by the add-on's container rather than the session's
+			args = append(args, "--label", fmt.Sprintf("worklet.service.%s.host=%s", svc.Name, host))
+		}
+	}
+
+	// Let the daemon serve the session under the project's alias
+	if opts.Config.Alias != "" {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", LabelAlias, opts.Config.Alias))
+	}
+
+	// Record what `worklet reload` compares the session against
+	reload := reloadLabels(opts.Config)
+	for _, key := range []string{LabelEnvKeys, LabelInitHash, LabelStaticHash} {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, reload[key]))
 	}
 
 	// In mount mode, add volume mount
 	if opts.MountMode {
 		absWorkDir, err := filepath.Abs(opts.WorkDir)
 		if err != nil {
-			return "", fmt.Errorf("failed to get absolute path: %w", err)
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		args = append(args, "-v", mountArg(config.MountConfig{Source: absWorkDir, Target: containerWorkDir, Consistency: opts.Config.Run.Consistency}))
+
+		// A worktree's .git file references the main repository by absolute
+		// path, so mount it at the same path
+		if opts.GitDir != "" {
+			args = append(args, "-v", fmt.Sprintf("%s:%s", opts.GitDir, opts.GitDir))
+		}
+
+		// Extra host directories from config and --mount flags
+		mounts := append(append([]config.MountConfig{}, opts.Config.Run.Mounts...), opts.ExtraMounts...)
+		resolved, err := resolveMounts(absWorkDir, containerWorkDir, mounts)
+		if err != nil {
+			return nil, err
+		}
+		for _, mount := range resolved {
+			args = append(args, "-v", mountArg(mount))
+		}
+
+		// Dependency directories kept in volumes rather than the bind mount
+		for _, dir := range cacheVolumeDirs(opts) {
+			args = append(args, "-v", fmt.Sprintf("%s:%s", cacheVolumeName(projectName, dir), path.Join(containerWorkDir, dir)))
 		}
-		args = append(args, "-v", fmt.Sprintf("%s:/workspace", absWorkDir))
+
+		// Record who files created as root are handed back to
+		if opts.HostOwner != "" {
+			args = append(args, "--label", fmt.Sprintf("%s=%s", LabelHostOwner, opts.HostOwner))
+		}
+	}
+
+	// In overlay copy mode, the project is mounted read-only and the overlay
+	// entrypoint mounts it at the working directory under a copy-on-write
+	// layer kept in a volume
+	overlay := useOverlay(opts)
+	if overlay {
+		absWorkDir, err := filepath.Abs(opts.WorkDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+		seedDir, err := overlaySeedPath(opts.SessionID)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-v", fmt.Sprintf("%s:%s:ro", absWorkDir, overlayLowerDir))
+		args = append(args, "-v", fmt.Sprintf("%s:%s", overlayVolumeName(opts.SessionID), overlayStateDir))
+		args = append(args, "-v", fmt.Sprintf("%s:%s:ro", seedDir, overlaySeedDir))
+		args = append(args, "-e", fmt.Sprintf("WORKLET_OVERLAY_TARGET=%s", containerWorkDir))
 	}
 
 	// Always set working directory
-	args = append(args, "-w", "/workspace")
+	args = append(args, "-w", containerWorkDir)
 
 	// Determine isolation mode (default to "full" if not specified)
 	isolation := opts.Config.Run.Isolation
@@ -114,29 +727,29 @@ func RunContainer(opts RunOptions) (string, error) {
 		// Set isolation mode environment variable
 		args = append(args, "-e", "WORKLET_ISOLATION=full")
 
-		// Set Docker environment variables for DinD
-		args = append(args, "-e", "DOCKER_TLS_CERTDIR=")
-		args = append(args, "-e", "DOCKER_DRIVER=overlay2")
+		// Options of the session's Docker daemon, which the entrypoint
+		// writes to its daemon.json
+		daemonJSON, err := opts.Config.Run.Dind.DaemonJSON(opts.RegistryMirror)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render Docker daemon options: %w", err)
+		}
+		if daemonJSON != nil {
+			args = append(args, "-e", "WORKLET_DOCKERD_CONFIG="+string(daemonJSON))
+		}
 
 		// Create volume for Docker data
-		args = append(args, "-v", fmt.Sprintf("worklet-%s:/var/lib/docker", opts.SessionID))
+		args = append(args, "-v", fmt.Sprintf("worklet-%s:%s", opts.SessionID, opts.Config.Run.Dind.DataRootPath()))
 
 		// In mount mode, we need to mount the entrypoint script since it's not in the base image
 		// In copy mode, the entrypoint script is already included in the built image
 		if opts.MountMode {
-			// Mount the entrypoint script
-			scriptPath, err := getEntrypointScriptPath()
-			if err != nil {
-				return "", fmt.Errorf("failed to get entrypoint script path: %w", err)
-			}
-			// Ensure cleanup of temp script file
-			defer os.Remove(scriptPath)
-
 			args = append(args, "-v", fmt.Sprintf("%s:/entrypoint.sh:ro", scriptPath))
 		}
 
-		// Set entrypoint
-		args = append(args, "--entrypoint", "/entrypoint.sh")
+		// Set entrypoint; the overlay entrypoint runs it in overlay mode
+		if !overlay {
+			args = append(args, "--entrypoint", "/entrypoint.sh")
+		}
 
 	case "shared":
 		// Shared Docker daemon via socket mount
@@ -148,7 +761,26 @@ func RunContainer(opts RunOptions) (string, error) {
 		}
 
 	default:
-		return "", fmt.Errorf("invalid isolation mode: %s (must be 'full' or 'shared')", isolation)
+		return nil, fmt.Errorf("invalid isolation mode: %s (must be 'full' or 'shared')", isolation)
+	}
+
+	// Run as run.user. The Docker daemon of full isolation needs root, so
+	// there the entrypoint starts as root and runs the command as the user.
+	if user := opts.Config.Run.User; user != "" {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", LabelUser, user))
+		args = append(args, "-e", "WORKLET_USER="+user)
+		if isolation != "full" {
+			args = append(args, "--user", user)
+		}
+	}
+
+	// Mounting the overlay needs CAP_SYS_ADMIN, which privileged containers
+	// already have
+	if overlay {
+		if isolation != "full" && !opts.Config.Run.Privileged {
+			args = append(args, "--cap-add", "SYS_ADMIN", "--security-opt", "apparmor=unconfined")
+		}
+		args = append(args, "--entrypoint", overlaySeedDir+"/overlay.sh")
 	}
 
 	// Add environment variables
@@ -162,6 +794,9 @@ func RunContainer(opts RunOptions) (string, error) {
 		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
 	}
 
+	// Pick the shell shells in the session start
+	args = append(args, ShellEnvArgs(opts.Config.Run.Shell, opts.Config.Run.LoginShell)...)
+
 	// Disable Corepack prompts for Node.js projects
 	args = append(args, "-e", "COREPACK_ENABLE_DOWNLOAD_PROMPT=0")
 
@@ -176,10 +811,14 @@ func RunContainer(opts RunOptions) (string, error) {
 		// Check if compose file exists
 		if _, err := os.Stat(opts.ComposePath); err == nil {
 			// Mount the compose file into the container
-			args = append(args, "-v", fmt.Sprintf("%s:/workspace/docker-compose.yml:ro", opts.ComposePath))
-			args = append(args, "-e", "WORKLET_COMPOSE_FILE=/workspace/docker-compose.yml")
+			composeTarget := path.Join(containerWorkDir, "docker-compose.yml")
+			args = append(args, "-v", fmt.Sprintf("%s:%s:ro", opts.ComposePath, composeTarget))
+			args = append(args, "-e", fmt.Sprintf("WORKLET_COMPOSE_FILE=%s", composeTarget))
+			if opts.ImageCache != "" {
+				args = append(args, "-v", fmt.Sprintf("%s:%s:ro", opts.ImageCache, imageCacheMount))
+			}
 		} else {
-			fmt.Printf("Warning: Compose file not found: %s\n", opts.ComposePath)
+			fmt.Fprintf(Output, "Warning: Compose file not found: %s\n", opts.ComposePath)
 		}
 	}
 
@@ -191,11 +830,28 @@ func RunContainer(opts RunOptions) (string, error) {
 		initScripts = append(initScripts, opts.Config.Run.InitScript...)
 	}
 
-	// Add credential init scripts if needed
-	if opts.Config.Run.Credentials != nil {
+	// The browsers layer's entrypoint starts its endpoints, but the Docker
+	// daemon's replaces it
+	if opts.Config.Run.Browsers != nil && isolation == "full" {
+		initScripts = append([]string{browsersStartCommand}, initScripts...)
+	}
+
+	// Add credential init scripts if needed. Time-boxed credentials are
+	// copied in until they expire, when the daemon removes them.
+	if ttl := credentialsTTL(opts); ttl > 0 {
+		expires := time.Now().Add(ttl)
+		args = append(args, "--label", fmt.Sprintf("%s=%s", LabelCredentialsExpires, expires.UTC().Format(time.RFC3339)))
+		args = append(args, "-e", fmt.Sprintf("WORKLET_CREDENTIALS_EXPIRES=%d", expires.Unix()))
+		claudeExists, _ := VolumeExists(config.ClaudeVolume(opts.Config.Run.Credentials.ClaudeProfileName()))
+		sshExists, _ := VolumeExists(SSHCredentialsVolume)
+		creds := opts.Config.Run.Credentials
+		script := timeBoxedCredentialScript(creds.Claude && claudeExists, creds.SSH && sshExists)
+		initScripts = append([]string{script}, initScripts...)
+	} else if opts.Config.Run.Credentials != nil {
 		// Add Claude credential init script
 		if opts.Config.Run.Credentials.Claude {
-			if credInitScript := GetCredentialInitScript(true); credInitScript != "" {
+			claudeVolume := config.ClaudeVolume(opts.Config.Run.Credentials.ClaudeProfileName())
+			if credInitScript := GetCredentialInitScript(claudeVolume); credInitScript != "" {
 				// Prepend credential setup to ensure it runs first
 				initScripts = append([]string{credInitScript}, initScripts...)
 			}
@@ -223,10 +879,7 @@ func RunContainer(opts RunOptions) (string, error) {
 
 	// Add pnpm store volume if this is a pnpm project
 	if _, err := os.Stat(filepath.Join(opts.WorkDir, "pnpm-lock.yaml")); err == nil {
-		pnpmStoreVolume := fmt.Sprintf("worklet-pnpm-store-%s", projectName)
-		if err := ensureDockerVolumeExists(pnpmStoreVolume); err != nil {
-			return "", fmt.Errorf("failed to create pnpm store volume: %w", err)
-		}
+		pnpmStoreVolume := pnpmStoreVolumeName(projectName)
 		args = append(args, "-v", fmt.Sprintf("%s:/pnpm/store", pnpmStoreVolume))
 	}
 
@@ -234,7 +887,8 @@ func RunContainer(opts RunOptions) (string, error) {
 	if opts.Config.Run.Credentials != nil {
 		// Mount Claude credentials
 		if opts.Config.Run.Credentials.Claude {
-			credentialMounts := GetCredentialVolumeMounts(true)
+			claudeVolume := config.ClaudeVolume(opts.Config.Run.Credentials.ClaudeProfileName())
+			credentialMounts := GetCredentialVolumeMounts(claudeVolume)
 			args = append(args, credentialMounts...)
 		}
 		
@@ -243,6 +897,9 @@ func RunContainer(opts RunOptions) (string, error) {
 			sshMounts := GetSSHVolumeMounts(true)
 			args = append(args, sshMounts...)
 		}
+
+		// Mount the credentials exported from the host
+		args = append(args, exportedCredentialArgs(opts.SessionID, opts.Config.Run.Credentials)...)
 	}
 
 	// Add image (use temporary image in copy mode, configured image in mount mode)
@@ -253,46 +910,18 @@ func RunContainer(opts RunOptions) (string, error) {
 		args = append(args, opts.CmdArgs...)
 	} else if len(opts.Config.Run.Command) > 0 {
 		args = append(args, opts.Config.Run.Command...)
+	} else if opts.Ephemeral {
+		// An ephemeral run without a command is a shell
+		args = append(args, ShellCommand()...)
 	} else {
 		// Default to sleep for detached containers
 		args = append(args, "sleep", "infinity")
 	}
 
-	// Execute docker command and capture output to get container ID
-	cmd := exec.Command("docker", args...)
-	output, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("docker command failed: %w\nStderr: %s", err, exitErr.Stderr)
-		}
-		return "", fmt.Errorf("docker command failed: %w", err)
-	}
-
-	// Extract container ID from output
-	containerID := strings.TrimSpace(string(output))
-	if containerID == "" {
-		return "", fmt.Errorf("failed to get container ID from docker run output")
-	}
-
-	// Set up devcontainer configuration for VSCode support
-	projectName = opts.Config.Name
-	if projectName == "" {
-		projectName = "worklet"
-	}
-	
-	// Generate and write devcontainer.json (non-blocking, best effort)
-	go func() {
-		// Small delay to ensure container is fully started
-		time.Sleep(1 * time.Second)
-		if err := EnsureDevContainerConfig(containerID, projectName); err != nil {
-			// Log warning but don't fail - VSCode will still work without it
-			fmt.Printf("Note: Could not set up VSCode extensions auto-sync: %v\n", err)
-		}
-	}()
-
-	return containerID, nil
+	return args, nil
 }
 
+
 // getEntrypointScriptPath extracts the embedded entrypoint script to a temp file
 func getEntrypointScriptPath() (string, error) {
 	// Create a temporary file for the script
@@ -324,19 +953,9 @@ func getEntrypointScriptPath() (string, error) {
 }
 
 // buildCopyImage builds a temporary Docker image with the workspace files copied in
-func buildCopyImage(workDir string, cfg *config.WorkletConfig, sessionID string) (string, error) {
+func buildCopyImage(ctx context.Context, workDir string, cfg *config.WorkletConfig, baseImage, sessionID string, progress ProgressFunc) (string, error) {
 	// Generate unique image name
-	projectName := cfg.Name
-	if projectName == "" {
-		projectName = "worklet"
-	}
-	imageName := fmt.Sprintf("worklet-temp-%s-%s", strings.ToLower(projectName), sessionID)
-
-	// Get base image
-	baseImage := cfg.Run.Image
-	if baseImage == "" {
-		baseImage = "worklet/base:latest"
-	}
+	imageName := copyImageName(cfg, sessionID)
 
 	// Create temporary directory for build context
 	buildDir, err := os.MkdirTemp("", "worklet-build-*")
@@ -356,9 +975,13 @@ func buildCopyImage(workDir string, cfg *config.WorkletConfig, sessionID string)
 	dockerfileContent := fmt.Sprintf(`FROM %s
 COPY entrypoint.sh /entrypoint.sh
 RUN chmod +x /entrypoint.sh
-COPY workspace /workspace
-WORKDIR /workspace
-`, baseImage)
+COPY workspace %[2]s
+WORKDIR %[2]s
+`, baseImage, cfg.ContainerWorkDir())
+	// Create run.user and give it the workspace
+	if user := cfg.Run.User; user != "" {
+		dockerfileContent += fmt.Sprintf("USER root\nRUN WORKLET_USER=%[1]s WORKLET_USER_SETUP=1 /entrypoint.sh && chown -R %[1]s %[2]s\n", user, cfg.ContainerWorkDir())
+	}
 
 	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644); err != nil {
 		return "", fmt.Errorf("failed to write Dockerfile: %w", err)
@@ -370,8 +993,13 @@ WORKDIR /workspace
 		return "", fmt.Errorf("failed to create workspace directory: %w", err)
 	}
 
-	// Copy files to build context, respecting .dockerignore patterns
-	if err := copyWorkspace(workDir, workspaceDir, []string{}); err != nil {
+	// Copy files to build context, respecting .dockerignore and .workletignore
+	if progress != nil {
+		progress.Update(PhaseBuild, "Copying workspace files")
+	} else {
+		fmt.Fprintf(Output, "Copying workspace files from %s to %s...\n", workDir, workspaceDir)
+	}
+	if err := copyWorkspace(workDir, workspaceDir, []string{}, cfg.Run.Include); err != nil {
 		return "", fmt.Errorf("failed to copy workspace: %w", err)
 	}
 
@@ -383,15 +1011,30 @@ WORKDIR /workspace
 	}
 	if err := processEnvironmentTemplates(workDir, workspaceDir, opts); err != nil {
 		// Log warning but don't fail the build
-		fmt.Printf("Warning: Failed to process environment templates: %v\n", err)
+		fmt.Fprintf(Output, "Warning: Failed to process environment templates: %v\n", err)
+	}
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
 	}
 
 	// Build the image
-	cmd := exec.Command("docker", "build", "-t", imageName, buildDir)
-	cmd.Stdout = os.Stdout
+	cmd := dockerCommand(ctx, "build", "-t", imageName, buildDir)
+	if progress != nil {
+		// Route build output through progress, keeping it for error reports
+		writer := progress.Writer(PhaseBuild)
+		cmd.Stdout = writer
+		cmd.Stderr = writer
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("failed to build image: %w\n%s", err, writer.Output())
+		}
+		return imageName, nil
+	}
+
+	cmd.Stdout = Output
 	cmd.Stderr = os.Stderr
 
-	fmt.Printf("Building temporary image with copied files...\n")
+	fmt.Fprintf(Output, "Building temporary image with copied files...\n")
 	if err := cmd.Run(); err != nil {
 		return "", fmt.Errorf("failed to build image: %w", err)
 	}
@@ -401,153 +1044,42 @@ WORKDIR /workspace
 
 // removeImage removes a Docker image
 func removeImage(imageName string) error {
-	cmd := exec.Command("docker", "rmi", imageName)
+	cmd := dockerCommand(context.Background(), "rmi", imageName)
 	return cmd.Run()
 }
 
-// copyWorkspace copies files from source to destination, respecting exclude patterns
-func copyWorkspace(src, dst string, excludePatterns []string) error {
-	fmt.Printf("Copying workspace files from %s to %s...\n", src, dst)
-	// Create gitignore patterns from config excludes
-	var patterns []gitignore.Pattern
-
-	// Always exclude .dockerignore itself
-	patterns = append(patterns, gitignore.ParsePattern(".dockerignore", nil))
+// WorkletIgnoreFile lists paths, in .dockerignore syntax, that are left out
+// of workspace copies without affecting the project's own Docker builds
+const WorkletIgnoreFile = ".workletignore"
 
-	// Add patterns from excludePatterns parameter
-	for _, pattern := range excludePatterns {
-		pattern = strings.TrimSpace(pattern)
-		if pattern != "" && !strings.HasPrefix(pattern, "#") {
-			patterns = append(patterns, gitignore.ParsePattern(pattern, nil))
-		}
-	}
+// copyWorkspace copies files from source to destination, respecting
+// .dockerignore, .workletignore and the exclude and include patterns
+func copyWorkspace(src, dst string, excludePatterns, includePatterns []string) error {
+	return fscopy.Copy(src, dst, workspaceCopyOptions(excludePatterns, includePatterns))
+}
 
-	// Read and parse .dockerignore file if it exists
-	dockerignorePath := filepath.Join(src, ".dockerignore")
-	if data, err := os.ReadFile(dockerignorePath); err == nil {
-		lines := strings.Split(string(data), "\n")
-		for _, line := range lines {
-			line = strings.TrimSpace(line)
-			if line != "" && !strings.HasPrefix(line, "#") {
-				patterns = append(patterns, gitignore.ParsePattern(line, nil))
-			}
-		}
+// workspaceCopyOptions returns the filtering applied to copied workspaces.
+// .workletignore is read last, so its negations can re-include paths that
+// .dockerignore excludes.
+func workspaceCopyOptions(excludePatterns, includePatterns []string) fscopy.Options {
+	return fscopy.Options{
+		Excludes:    excludePatterns,
+		Includes:    includePatterns,
+		IgnoreFiles: []string{".dockerignore", WorkletIgnoreFile},
 	}
-
-	// Create matcher with all patterns
-	matcher := gitignore.NewMatcher(patterns)
-
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Get relative path
-		relPath, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
-		}
-
-		// Skip the root directory itself
-		if relPath == "." {
-			return nil
-		}
-
-		// Convert path to components for matcher
-		pathComponents := strings.Split(relPath, string(filepath.Separator))
-
-		// Check if path should be excluded BEFORE following symlinks
-		if matcher.Match(pathComponents, info.IsDir()) {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// Check if this is a symlink
-		linkInfo, err := os.Lstat(path)
-		if err != nil {
-			return err
-		}
-
-		// Construct destination path
-		dstPath := filepath.Join(dst, relPath)
-
-		// Handle symlinks specially
-		if linkInfo.Mode()&os.ModeSymlink != 0 {
-			// Read the symlink target
-			target, err := os.Readlink(path)
-			if err != nil {
-				// If we can't read the symlink, skip it
-				fmt.Printf("Warning: Skipping unreadable symlink: %s\n", relPath)
-				return nil
-			}
-
-			// Resolve the absolute path of the target
-			absoluteTarget := target
-			if !filepath.IsAbs(target) {
-				absoluteTarget = filepath.Join(filepath.Dir(path), target)
-			}
-
-			// Check if the target is within the source directory
-			absTarget, err := filepath.Abs(absoluteTarget)
-			if err != nil {
-				// Skip symlinks we can't resolve
-				fmt.Printf("Warning: Skipping unresolvable symlink: %s\n", relPath)
-				return nil
-			}
-
-			absSrc, err := filepath.Abs(src)
-			if err != nil {
-				return err
-			}
-
-			// If the symlink points outside the workspace, skip it
-			if !strings.HasPrefix(absTarget, absSrc) {
-				fmt.Printf("Info: Skipping symlink pointing outside workspace: %s -> %s\n", relPath, target)
-				return nil
-			}
-
-			// For symlinks pointing inside the workspace, copy as regular files/directories
-			// This handles the case where symlinks point to already copied content
-			targetInfo, err := os.Stat(path)
-			if err != nil {
-				// If we can't stat the target, skip the symlink
-				fmt.Printf("Warning: Skipping broken symlink: %s\n", relPath)
-				return nil
-			}
-
-			if targetInfo.IsDir() {
-				// For directory symlinks, create the directory but don't recurse
-				// The actual content will be copied when we walk to the real directory
-				return os.MkdirAll(dstPath, targetInfo.Mode())
-			}
-
-			// For file symlinks, copy the file content
-			return copyFile(path, dstPath)
-		}
-
-		// Handle regular files and directories
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, info.Mode())
-		}
-
-		// Copy file
-		return copyFile(path, dstPath)
-	})
 }
 
 // ensureDockerVolumeExists creates a Docker volume if it doesn't exist
 func ensureDockerVolumeExists(volumeName string) error {
 	// Check if volume already exists
-	cmd := exec.Command("docker", "volume", "inspect", volumeName)
+	cmd := dockerCommand(context.Background(), "volume", "inspect", volumeName)
 	if err := cmd.Run(); err == nil {
 		// Volume already exists
 		return nil
 	}
 
 	// Create the volume
-	cmd = exec.Command("docker", "volume", "create", volumeName)
+	cmd = dockerCommand(context.Background(), "volume", "create", volumeName)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to create Docker volume %s: %w", volumeName, err)
 	}
@@ -555,40 +1087,12 @@ func ensureDockerVolumeExists(volumeName string) error {
 	return nil
 }
 
-// copyFile copies a single file
-func copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer sourceFile.Close()
-
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, sourceFile)
-	if err != nil {
-		return err
-	}
-
-	// Copy file permissions
-	sourceInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-
-	return os.Chmod(dst, sourceInfo.Mode())
-}
-
 // processEnvironmentTemplates processes .env.example files with templating
 // srcDir is where to read .env.example files from
 // targetDir is where to write processed .env files to
 func processEnvironmentTemplates(srcDir, targetDir string, opts RunOptions) error {
-	// Only process templates if we have services defined
-	if len(opts.Config.Services) == 0 {
+	// Only process templates if we have services or add-ons defined
+	if len(opts.Config.Services) == 0 && len(opts.Config.Addons) == 0 {
 		return nil
 	}
 
@@ -605,9 +1109,24 @@ func processEnvironmentTemplates(srcDir, targetDir string, opts RunOptions) erro
 		opts.SessionID,
 		projectName,
 		opts.Config.Services,
+		opts.Config.AddonInfos(projectName, opts.SessionID),
 	)
 }
 
+// processHostEnvironmentTemplates processes .env.example files into the
+// project directory on the host, protecting the user's values
+func processHostEnvironmentTemplates(opts RunOptions) error {
+	if len(opts.Config.Services) == 0 && len(opts.Config.Addons) == 0 {
+		return nil
+	}
+
+	projectName := opts.Config.Name
+	if projectName == "" {
+		projectName = "worklet"
+	}
+	return config.ProcessHostEnvFiles(opts.WorkDir, opts.SessionID, projectName, opts.Config.Services, opts.Config.AddonInfos(projectName, opts.SessionID))
+}
+
 // getServiceEnvironmentVariables generates environment variables for services
 func getServiceEnvironmentVariables(cfg *config.WorkletConfig, sessionID string) map[string]string {
 	// Convert ServiceConfig to env.ServiceInfo
@@ -631,6 +1150,9 @@ func getServiceEnvironmentVariables(cfg *config.WorkletConfig, sessionID string)
 		SessionID:   sessionID,
 		ProjectName: projectName,
 		Services:    serviceInfos,
+		Domain:      config.Domain(),
+		HTTPPort:    config.ProxyHTTPPort(),
+		Addons:      cfg.AddonInfos(projectName, sessionID),
 	}
 
 	// Get service environment variables
@@ -1,9 +1,16 @@
 package docker
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
 )
 
 func TestCopyWorkspace(t *testing.T) {
@@ -76,7 +83,7 @@ logs/
 	configExcludes := []string{".git", "*.bak"}
 	
 	// Run copyWorkspace
-	if err := copyWorkspace(srcDir, dstDir, configExcludes); err != nil {
+	if err := copyWorkspace(srcDir, dstDir, configExcludes, nil); err != nil {
 		t.Fatalf("copyWorkspace failed: %v", err)
 	}
 
@@ -160,7 +167,7 @@ func TestCopyWorkspaceWithoutDockerignore(t *testing.T) {
 	configExcludes := []string{"node_modules", "*.log", "dist"}
 	
 	// Run copyWorkspace
-	if err := copyWorkspace(srcDir, dstDir, configExcludes); err != nil {
+	if err := copyWorkspace(srcDir, dstDir, configExcludes, nil); err != nil {
 		t.Fatalf("copyWorkspace failed: %v", err)
 	}
 
@@ -176,4 +183,602 @@ func TestCopyWorkspaceWithoutDockerignore(t *testing.T) {
 			t.Errorf("File should have been excluded: %s", file)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestRedactArgs(t *testing.T) {
+	args := []string{"run", "-e", "API_TOKEN=abc", "-e", "PORT=3000", "-v", "secret:/data", "-e", "DB_PASSWORD=hunter2"}
+
+	redacted := RedactArgs(args)
+
+	expected := []string{"run", "-e", "API_TOKEN=<redacted>", "-e", "PORT=3000", "-v", "secret:/data", "-e", "DB_PASSWORD=<redacted>"}
+	for i := range expected {
+		if redacted[i] != expected[i] {
+			t.Errorf("arg %d: expected %q, got %q", i, expected[i], redacted[i])
+		}
+	}
+
+	// The original args must not be modified
+	if args[2] != "API_TOKEN=abc" {
+		t.Errorf("RedactArgs modified its input: %q", args[2])
+	}
+}
+
+func TestBuildRunArgsMountsWorktreeGitDir(t *testing.T) {
+	workDir, err := os.MkdirTemp("", "worklet-test-worktree-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	opts := RunOptions{
+		WorkDir:   workDir,
+		Config:    &config.WorkletConfig{Name: "test"},
+		SessionID: "abc123",
+		MountMode: true,
+		GitDir:    "/home/user/repo/.git",
+	}
+
+	args, err := buildRunArgs(opts, "worklet/base:latest", "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-v" && args[i+1] == "/home/user/repo/.git:/home/user/repo/.git" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected git dir to be mounted at the same path, got args %v", args)
+	}
+}
+
+func TestBuildRunArgsUsesWorkdirPath(t *testing.T) {
+	workDir, err := os.MkdirTemp("", "worklet-test-workdir-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	composePath := filepath.Join(workDir, "docker-compose.yml")
+	if err := os.WriteFile(composePath, []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RunOptions{
+		WorkDir: workDir,
+		Config: &config.WorkletConfig{
+			Name: "test",
+			Run:  config.RunConfig{WorkdirPath: "/go/src/example.com/app"},
+		},
+		SessionID:   "abc123",
+		MountMode:   true,
+		ComposePath: composePath,
+	}
+
+	args, err := buildRunArgs(opts, "worklet/base:latest", "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"-w": "/go/src/example.com/app",
+		"-v": workDir + ":/go/src/example.com/app",
+		"-e": "WORKLET_COMPOSE_FILE=/go/src/example.com/app/docker-compose.yml",
+	}
+	for flag, value := range expected {
+		found := false
+		for i := 0; i < len(args)-1; i++ {
+			if args[i] == flag && args[i+1] == value {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected %s %s in args %v", flag, value, args)
+		}
+	}
+}
+
+func TestResolveMounts(t *testing.T) {
+	workDir, err := os.MkdirTemp("", "worklet-test-mounts-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := os.Mkdir(filepath.Join(workDir, "shared"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := resolveMounts(workDir, "/workspace", []config.MountConfig{
+		{Source: "shared", Target: "/libs/shared/", ReadOnly: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mountArg(resolved[0]); got != filepath.Join(workDir, "shared")+":/libs/shared:ro" {
+		t.Errorf("unexpected mount %q", got)
+	}
+
+	// worklet.json written on Windows
+	resolved, err = resolveMounts(workDir, "/workspace", []config.MountConfig{{Source: `.\shared`, Target: "/libs/shared"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved[0].Source != filepath.Join(workDir, "shared") {
+		t.Errorf("expected backslashes to separate the relative source, got %q", resolved[0].Source)
+	}
+
+	invalid := [][]config.MountConfig{
+		{{Source: "missing", Target: "/missing"}},
+		{{Source: "shared", Target: "relative"}},
+		{{Source: "shared", Target: "/workspace"}},
+		{{Source: "shared", Target: "/a"}, {Source: "shared", Target: "/a"}},
+	}
+	for _, mounts := range invalid {
+		if _, err := resolveMounts(workDir, "/workspace", mounts); err == nil {
+			t.Errorf("expected error for %+v", mounts)
+		}
+	}
+}
+
+func TestCopyWorkspaceWithIncludes(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "worklet-test-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "worklet-test-dst-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	testFiles := []string{
+		"package.json",
+		"README.md",
+		"services/api/main.go",
+		"services/api/node_modules/dep/index.js",
+		"services/web/index.js",
+		"packages/shared/lib.go",
+		"packages/other/lib.go",
+		"docs/guide.md",
+	}
+	for _, path := range testFiles {
+		fullPath := filepath.Join(srcDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	includes := []string{"/package.json", "services/api", "packages/shared/"}
+	if err := copyWorkspace(srcDir, dstDir, []string{"node_modules/"}, includes); err != nil {
+		t.Fatalf("copyWorkspace failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"package.json":                           true,
+		"services/api/main.go":                   true,
+		"packages/shared/lib.go":                 true,
+		"README.md":                              false,
+		"services/api/node_modules/dep/index.js": false,
+		"services/web/index.js":                  false,
+		"packages/other/lib.go":                  false,
+		"docs/guide.md":                          false,
+	}
+	for path, shouldExist := range expected {
+		_, err := os.Stat(filepath.Join(dstDir, path))
+		if shouldExist && err != nil {
+			t.Errorf("Expected file to be included: %s", path)
+		}
+		if !shouldExist && err == nil {
+			t.Errorf("Expected file to be skipped: %s", path)
+		}
+	}
+
+	// Directories outside the includes aren't created
+	if _, err := os.Stat(filepath.Join(dstDir, "docs")); err == nil {
+		t.Error("Expected docs directory not to be created")
+	}
+}
+
+func TestCopyWorkspaceWorkletIgnore(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "worklet-test-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	dstDir, err := os.MkdirTemp("", "worklet-test-dst-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	files := map[string]string{
+		"main.go":         "package main",
+		"data/dump.sql":   "large dump",
+		"dist/bundle.js":  "build output",
+		"dist/keep.txt":   "re-included",
+		".dockerignore":   "dist/*\n",
+		WorkletIgnoreFile: "# Local data\ndata/\n!dist/keep.txt\n",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(srcDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := copyWorkspace(srcDir, dstDir, nil, nil); err != nil {
+		t.Fatalf("copyWorkspace failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"main.go":         true,
+		"dist/keep.txt":   true,
+		"data/dump.sql":   false,
+		"dist/bundle.js":  false,
+		".dockerignore":   false,
+		WorkletIgnoreFile: false,
+	}
+	for path, shouldExist := range expected {
+		_, err := os.Stat(filepath.Join(dstDir, path))
+		if shouldExist && err != nil {
+			t.Errorf("Expected file to be copied: %s", path)
+		}
+		if !shouldExist && err == nil {
+			t.Errorf("Expected file to be excluded: %s", path)
+		}
+	}
+}
+
+func TestBuildRunArgsOverlay(t *testing.T) {
+	workDir, err := os.MkdirTemp("", "worklet-test-overlay-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+	t.Setenv("HOME", workDir)
+
+	for _, isolation := range []string{"shared", "full"} {
+		opts := RunOptions{
+			WorkDir: workDir,
+			Config: &config.WorkletConfig{
+				Name: "test",
+				Run:  config.RunConfig{Isolation: isolation, CopyStrategy: config.CopyStrategyOverlay},
+			},
+			SessionID: "abc123",
+		}
+
+		args, err := buildRunArgs(opts, "node:20", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pairs := make(map[string]bool)
+		for i := 0; i < len(args)-1; i++ {
+			pairs[args[i]+" "+args[i+1]] = true
+		}
+		expected := []string{
+			"-v " + workDir + ":/worklet/lower:ro",
+			"-v worklet-overlay-abc123:/worklet/state",
+			"-v " + filepath.Join(workDir, ".worklet", "overlay", "abc123") + ":/worklet/seed:ro",
+			"-e WORKLET_OVERLAY_TARGET=/workspace",
+			"--entrypoint /worklet/seed/overlay.sh",
+			"--label worklet.mode=overlay",
+		}
+		if isolation == "shared" {
+			expected = append(expected, "--cap-add SYS_ADMIN")
+		}
+		for _, pair := range expected {
+			if !pairs[pair] {
+				t.Errorf("%s isolation: expected %s in args %v", isolation, pair, args)
+			}
+		}
+		if pairs["--entrypoint /entrypoint.sh"] {
+			t.Errorf("%s isolation: the overlay entrypoint should replace /entrypoint.sh: %v", isolation, args)
+		}
+	}
+}
+
+func TestBuildRunArgsEphemeral(t *testing.T) {
+	opts := RunOptions{
+		WorkDir: "/tmp/project",
+		Config: &config.WorkletConfig{
+			Name: "test",
+			Run:  config.RunConfig{Isolation: "shared", RestartPolicy: "on-failure"},
+		},
+		SessionID:   "abc123",
+		MountMode:   true,
+		Ephemeral:   true,
+		Interactive: true,
+		TTY:         true,
+	}
+
+	args, err := buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joined := strings.Join(args, " ")
+	if !strings.HasPrefix(joined, "run --rm -i -t ") {
+		t.Errorf("expected an attached --rm run, got %v", args)
+	}
+	if !strings.HasSuffix(joined, " node:20 "+strings.Join(ShellCommand(), " ")) {
+		t.Errorf("expected a shell by default, got %v", args)
+	}
+	for _, unwanted := range []string{"-d", "--restart", "worklet.session=true"} {
+		for _, arg := range args {
+			if arg == unwanted {
+				t.Errorf("ephemeral args should not contain %s: %v", unwanted, args)
+			}
+		}
+	}
+	if !strings.Contains(joined, "--label worklet.ephemeral=true") {
+		t.Errorf("expected the ephemeral label, got %v", args)
+	}
+}
+
+func TestBuildRunArgsUser(t *testing.T) {
+	opts := RunOptions{
+		WorkDir:   "/tmp/project",
+		Config:    &config.WorkletConfig{Name: "test", Run: config.RunConfig{Isolation: "shared", User: "node"}},
+		SessionID: "abc123",
+		MountMode: true,
+	}
+
+	args, err := buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"--user node", "--label " + LabelUser + "=node", "-e WORKLET_USER=node"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+
+	// Full isolation starts as root for the Docker daemon and leaves the
+	// user to the entrypoint
+	opts.Config.Run.Isolation = "full"
+	args, err = buildRunArgs(opts, "node:20", "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined = strings.Join(args, " ")
+	if strings.Contains(joined, "--user") || !strings.Contains(joined, "-e WORKLET_USER=node") {
+		t.Errorf("expected the user to be left to the entrypoint, got %v", args)
+	}
+	if reason := overlayUnavailable(opts); reason == "" {
+		t.Error("expected the overlay to be unavailable with run.user")
+	}
+}
+
+func TestBuildRunArgsCredentialsTTL(t *testing.T) {
+	opts := RunOptions{
+		WorkDir: "/tmp/project",
+		Config: &config.WorkletConfig{
+			Name: "test",
+			Run: config.RunConfig{
+				Isolation:   "shared",
+				Credentials: &config.CredentialConfig{SSH: true, TTL: "2h"},
+			},
+		},
+		SessionID: "abc123",
+	}
+
+	args, err := buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expires time.Time
+	var expiresEnv string
+	for i := 0; i < len(args)-1; i++ {
+		if value, ok := strings.CutPrefix(args[i+1], LabelCredentialsExpires+"="); ok && args[i] == "--label" {
+			expires, err = time.Parse(time.RFC3339, value)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if value, ok := strings.CutPrefix(args[i+1], "WORKLET_CREDENTIALS_EXPIRES="); ok && args[i] == "-e" {
+			expiresEnv = value
+		}
+	}
+	if until := time.Until(expires); until < 119*time.Minute || until > 2*time.Hour {
+		t.Errorf("credentials expire in %v, want 2h", until)
+	}
+	if expiresEnv != fmt.Sprint(expires.Unix()) {
+		t.Errorf("WORKLET_CREDENTIALS_EXPIRES = %q, want %d", expiresEnv, expires.Unix())
+	}
+
+	// --credentials-ttl overrides the config, and without credentials
+	// there's nothing to expire
+	opts.CredentialsTTL = 10 * time.Minute
+	if ttl := credentialsTTL(opts); ttl != 10*time.Minute {
+		t.Errorf("credentialsTTL() = %v, want the override", ttl)
+	}
+	opts.Config.Run.Credentials.SSH = false
+	if ttl := credentialsTTL(opts); ttl != 0 {
+		t.Errorf("credentialsTTL() = %v without credentials, want 0", ttl)
+	}
+}
+
+func TestExportedCredentials(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-exported-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	// A stand-in aws CLI exporting an SSO profile
+	bin := filepath.Join(home, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fakeAWS := `#!/bin/sh
+case "$2" in
+export-credentials) echo '{"Version": 1, "AccessKeyId": "ASIAEXAMPLE", "SecretAccessKey": "secret", "SessionToken": "token"}' ;;
+get) echo us-west-2 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "aws"), []byte(fakeAWS), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	creds := &config.CredentialConfig{AWS: true, AWSProfile: "dev", GCP: true, Kubeconfig: true}
+	args := strings.Join(exportedCredentialArgs("abc123", creds), " ")
+	for _, want := range []string{
+		"--label " + LabelExportedCredentials + "=aws,gcp,kubeconfig",
+		"--label " + LabelAWSProfile + "=dev",
+		"-v " + filepath.Join(home, ".worklet", "credentials", "abc123") + ":/run/worklet/credentials",
+		"-e AWS_PROFILE=dev",
+		"-e AWS_SHARED_CREDENTIALS_FILE=/run/worklet/credentials/aws/credentials",
+		"-e GOOGLE_APPLICATION_CREDENTIALS=/run/worklet/credentials/gcp/application_default_credentials.json",
+		"-e KUBECONFIG=/run/worklet/credentials/kubeconfig/config",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("exported credential args %q missing %q", args, want)
+		}
+	}
+
+	labels := map[string]string{LabelExportedCredentials: "aws", LabelAWSProfile: "dev"}
+	if err := RefreshExportedCredentials(context.Background(), "abc123", labels); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(home, ".worklet", "credentials", "abc123", "aws")
+	credentials, err := os.ReadFile(filepath.Join(dir, "credentials"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[dev]\naws_access_key_id = ASIAEXAMPLE\naws_secret_access_key = secret\naws_session_token = token\n"; string(credentials) != want {
+		t.Errorf("credentials file = %q, want %q", credentials, want)
+	}
+	awsConfig, _ := os.ReadFile(filepath.Join(dir, "config"))
+	if want := "[profile dev]\nregion = us-west-2\n"; string(awsConfig) != want {
+		t.Errorf("config file = %q, want %q", awsConfig, want)
+	}
+
+	RemoveExportedCredentials("abc123")
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("exported credentials still exist after removal: %v", err)
+	}
+
+	if args := exportedCredentialArgs("abc123", &config.CredentialConfig{SSH: true}); args != nil {
+		t.Errorf("exported credential args without any = %q, want none", args)
+	}
+}
+
+func TestFilterKubeconfig(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+current-context: prod
+contexts:
+- name: prod
+  context: {cluster: prod-cluster, user: admin}
+- name: kind-dev
+  context: {cluster: kind-dev, user: kind-dev}
+clusters:
+- name: prod-cluster
+  cluster: {server: https://prod.example.com}
+- name: kind-dev
+  cluster: {server: https://127.0.0.1:6443}
+users:
+- name: admin
+  user: {token: prod-secret}
+- name: kind-dev
+  user: {token: dev-secret}
+`
+	filtered, err := filterKubeconfig([]byte(kubeconfig), []string{"kind-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"current-context: kind-dev", "https://127.0.0.1:6443", "dev-secret"} {
+		if !strings.Contains(string(filtered), want) {
+			t.Errorf("filtered kubeconfig missing %q:\n%s", want, filtered)
+		}
+	}
+	for _, unwanted := range []string{"prod-cluster", "prod-secret"} {
+		if strings.Contains(string(filtered), unwanted) {
+			t.Errorf("filtered kubeconfig still has %q:\n%s", unwanted, filtered)
+		}
+	}
+
+	if _, err := filterKubeconfig([]byte(kubeconfig), []string{"staging"}); err == nil {
+		t.Error("expected an error when no context matches")
+	}
+}
+
+func TestWriteDockerAuth(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-docker-auth-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// One login in the config and one kept by a stand-in credential helper
+	hostConfig := `{"auths": {"ghcr.io": {"auth": "dXNlcjpwYXNz"}, "registry.example.com": {}}, "credsStore": "fake"}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(hostConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	helper := `#!/bin/sh
+case "$1" in
+list) echo '{"registry.example.com": "bot"}' ;;
+get) read registry; echo '{"ServerURL": "'$registry'", "Username": "bot", "Secret": "s3cret"}' ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker-credential-fake"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	out := filepath.Join(dir, "session")
+	if err := os.MkdirAll(out, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDockerAuth(context.Background(), out); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(out, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Auths map[string]dockerAuth `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if got := written.Auths["ghcr.io"].Auth; got != "dXNlcjpwYXNz" {
+		t.Errorf("ghcr.io auth = %q, want the config's", got)
+	}
+	// bot:s3cret
+	if got := written.Auths["registry.example.com"].Auth; got != "Ym90OnMzY3JldA==" {
+		t.Errorf("registry.example.com auth = %q, want the helper's login", got)
+	}
+	if strings.Contains(string(data), "credsStore") {
+		t.Error("session Docker config still names the host's credential helper")
+	}
+}
+
+func TestRedactEnvArgs(t *testing.T) {
+	args := []string{"run", "-e", "TOKEN=secret", "--env", "DEBUG", "--label", "a=b", "-e", "X=1=2"}
+	got := strings.Join(redactEnvArgs(args), " ")
+	want := "run -e TOKEN=*** --env DEBUG --label a=b -e X=***"
+	if got != want {
+		t.Errorf("redactEnvArgs = %q, want %q", got, want)
+	}
+	if args[2] != "TOKEN=secret" {
+		t.Errorf("redactEnvArgs changed its argument: %q", args)
+	}
+}
@@ -0,0 +1,34 @@
+#!/bin/sh
+# Installs the dotfiles read as a tar archive from stdin in the home
+# directory, the way GitHub Codespaces does: with their install script if
+# they have one, or by linking the dotfiles at their top level
+set -e
+
+dir="$HOME/.dotfiles"
+rm -rf "$dir"
+mkdir -p "$dir"
+tar -x -C "$dir"
+cd "$dir"
+
+if [ -n "$WORKLET_DOTFILES_INSTALL" ]; then
+    exec sh -c "$WORKLET_DOTFILES_INSTALL"
+fi
+for script in install.sh install bootstrap.sh bootstrap script/bootstrap setup.sh setup script/setup; do
+    if [ -f "$script" ]; then
+        chmod +x "$script"
+        exec "./$script"
+    fi
+done
+
+for file in .[!.]*; do
+    case "$file" in
+        .git|.github|.gitignore|.gitmodules|.DS_Store) continue ;;
+    esac
+    [ -e "$file" ] || continue
+    # Keep what the image has next to it
+    if [ -e "$HOME/$file" ] && [ ! -L "$HOME/$file" ]; then
+        rm -rf "$HOME/$file.orig"
+        mv "$HOME/$file" "$HOME/$file.orig"
+    fi
+    ln -sfn "$dir/$file" "$HOME/$file"
+done
@@ -0,0 +1,238 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/gitauth"
+)
+
+//go:embed dotfiles-install.sh
+var dotfilesInstallScript string
+
+// dotfilesShrc is the file interactive sh shells in sessions with dotfiles
+// read through $ENV. sh has no rc file of its own, unlike bash and zsh.
+const dotfilesShrc = "/etc/worklet/shrc"
+
+const dotfilesShrcContent = `# Interactive sh shells in worklet sessions read this through $ENV
+if [ -f "$HOME/.shrc" ]; then . "$HOME/.shrc"; fi
+`
+
+// dotfilesCloneTimeout bounds fetching the dotfiles repository, so a slow
+// git host doesn't hold up sessions that can do without them
+const dotfilesCloneTimeout = 30 * time.Second
+
+// prepareDotfiles returns the host directory holding the dotfiles the
+// global config installs in sessions, cloning or updating their repository,
+// and the command installing them. It is best effort: without them the
+// session starts as it would otherwise.
+func prepareDotfiles(ctx context.Context, opts RunOptions) (dir, install string) {
+	global, err := config.LoadGlobalConfig()
+	if err != nil || !global.Dotfiles.Enabled() {
+		return "", ""
+	}
+	dotfiles := global.Dotfiles
+
+	if dotfiles.Path != "" {
+		dir = dotfiles.Path
+		if dir == "~" || strings.HasPrefix(dir, "~/") {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return "", ""
+			}
+			dir = filepath.Join(homeDir, dir[1:])
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			fmt.Fprintf(Output, "Warning: dotfiles directory %s not found; sessions start without them\n", dir)
+			return "", ""
+		}
+		return dir, dotfiles.Install
+	}
+
+	repo := dotfiles.Repo
+	if expanded, ok := global.ExpandShorthand(repo); ok {
+		repo = expanded
+	}
+	dir, err = dotfilesRepoDir(repo, dotfiles.Ref)
+	if err != nil {
+		return "", ""
+	}
+	if err := cloneDotfiles(ctx, global, repo, dotfiles.Ref, dir); err != nil {
+		if _, statErr := os.Stat(dir); statErr != nil {
+			fmt.Fprintf(Output, "Warning: failed to clone dotfiles; sessions start without them: %v\n", err)
+			return "", ""
+		}
+		fmt.Fprintf(Output, "Warning: failed to update dotfiles; using the copy from before: %v\n", err)
+	}
+	return dir, dotfiles.Install
+}
+
+// dotfilesRepoDir returns where the dotfiles repository is kept on the host
+func dotfilesRepoDir(repo, ref string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	hash := sha256.Sum256([]byte(repo + "#" + ref))
+	return filepath.Join(homeDir, ".worklet", "dotfiles", fmt.Sprintf("%x", hash[:6])), nil
+}
+
+// cloneDotfiles clones the latest commit of the dotfiles repository's ref
+// into dir, replacing the copy there once it has succeeded
+func cloneDotfiles(ctx context.Context, global *config.GlobalConfig, repo, ref, dir string) error {
+	ctx, cancel := context.WithTimeout(ctx, dotfilesCloneTimeout)
+	defer cancel()
+	auth, err := gitauth.DefaultResolver(global).Auth(repo)
+	if err != nil {
+		auth = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create dotfiles directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), ".clone-*")
+	if err != nil {
+		return fmt.Errorf("failed to create dotfiles directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	clone := func(refName plumbing.ReferenceName) error {
+		_, err := git.PlainCloneContext(ctx, tmpDir, false, &git.CloneOptions{
+			URL:           repo,
+			Auth:          auth,
+			ReferenceName: refName,
+			SingleBranch:  true,
+			Depth:         1,
+		})
+		return err
+	}
+	if ref == "" {
+		err = clone("")
+	} else if err = clone(plumbing.NewBranchReferenceName(ref)); err != nil {
+		os.RemoveAll(tmpDir)
+		err = clone(plumbing.NewTagReferenceName(ref))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to clone %s: %w", repo, err)
+	}
+
+	os.RemoveAll(dir)
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return fmt.Errorf("failed to replace dotfiles: %w", err)
+	}
+	return nil
+}
+
+// dotfilesEnv returns the environment that has interactive sh shells read
+// the dotfiles, unless run.environment sets ENV itself
+func dotfilesEnv(opts RunOptions) []string {
+	if opts.Dotfiles == "" {
+		return nil
+	}
+	if _, ok := opts.Config.Run.Environment["ENV"]; ok {
+		return nil
+	}
+	return []string{"ENV=" + dotfilesShrc}
+}
+
+// writeDotfilesArchive writes dir as a tar archive, without its .git
+// directory
+func writeDotfilesArchive(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		if rel == ".git" {
+			return filepath.SkipDir
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		// Owned by whoever unpacks them
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// installDotfiles copies the dotfiles into a session's container and
+// installs them in the home directory of its user. It is best effort: the
+// session works without them.
+func installDotfiles(ctx context.Context, container string, opts RunOptions) {
+	if opts.Dotfiles == "" {
+		return
+	}
+	opts.Progress.Update(PhaseInit, "Installing dotfiles")
+
+	shrc := dockerCommand(ctx, "exec", "-i", "-u", "0", container, "sh", "-c", "mkdir -p "+path.Dir(dotfilesShrc)+" && cat > "+dotfilesShrc)
+	shrc.Stdin = strings.NewReader(dotfilesShrcContent)
+	if output, err := shrc.CombinedOutput(); err != nil {
+		fmt.Fprintf(Output, "Warning: failed to set up dotfiles for sh: %v: %s\n", err, strings.TrimSpace(string(output)))
+	}
+
+	args := []string{"exec", "-i"}
+	if user := opts.Config.Run.User; user != "" {
+		if err := waitForUser(ctx, container, user); err != nil {
+			fmt.Fprintf(Output, "Warning: failed to install dotfiles: %v\n", err)
+			return
+		}
+		args = append(args, "-u", user)
+	}
+	if opts.DotfilesInstall != "" {
+		args = append(args, "-e", "WORKLET_DOTFILES_INSTALL="+opts.DotfilesInstall)
+	}
+	args = append(args, container, "sh", "-c", dotfilesInstallScript, "worklet-dotfiles")
+	cmd := dockerCommand(ctx, args...)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeDotfilesArchive(opts.Dotfiles, writer))
+	}()
+	cmd.Stdin = reader
+	output, err := cmd.CombinedOutput()
+	reader.Close()
+	if err != nil {
+		fmt.Fprintf(Output, "Warning: failed to install dotfiles: %v\n%s\n", err, strings.TrimSpace(string(output)))
+	}
+}
@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestWriteDotfilesArchive(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-dotfiles-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		".bashrc":               "alias ll='ls -l'\n",
+		".config/nvim/init.vim": "set number\n",
+		".git/HEAD":             "ref: refs/heads/main\n",
+		"install.sh":            "#!/bin/sh\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(".bashrc", filepath.Join(dir, ".zshrc")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDotfilesArchive(dir, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	reader := tar.NewReader(&buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		if header.Name == ".zshrc" && header.Linkname != ".bashrc" {
+			t.Errorf(".zshrc links to %q, want .bashrc", header.Linkname)
+		}
+		if header.Uid != 0 || header.Uname != "" {
+			t.Errorf("%s is owned by %d (%s)", header.Name, header.Uid, header.Uname)
+		}
+	}
+	sort.Strings(names)
+	expected := []string{".bashrc", ".config/", ".config/nvim/", ".config/nvim/init.vim", ".zshrc", "install.sh"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("archive has %v, want %v", names, expected)
+	}
+}
+
+func TestDotfilesEnv(t *testing.T) {
+	opts := RunOptions{Config: &config.WorkletConfig{}}
+	if env := dotfilesEnv(opts); env != nil {
+		t.Errorf("expected no environment without dotfiles, got %v", env)
+	}
+	opts.Dotfiles = "/home/me/.worklet/dotfiles/abc"
+	if env, want := dotfilesEnv(opts), []string{"ENV=" + dotfilesShrc}; !reflect.DeepEqual(env, want) {
+		t.Errorf("dotfilesEnv() = %v, want %v", env, want)
+	}
+	opts.Config.Run.Environment = map[string]string{"ENV": "/etc/profile"}
+	if env := dotfilesEnv(opts); env != nil {
+		t.Errorf("expected run.environment's ENV to be kept, got %v", env)
+	}
+}
@@ -0,0 +1,533 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+// Labels recording the credentials exported into a session, for the daemon
+// to refresh them: the credentials, comma-separated, and the AWS profile
+const (
+	LabelExportedCredentials = "worklet.credentials.exported"
+	LabelAWSProfile          = "worklet.credentials.aws-profile"
+)
+
+// ExportedCredentialsRefreshInterval is how often the daemon exports a
+// running session's credentials again. It's well within the hour that
+// STS, SSO and gcloud access tokens last.
+const ExportedCredentialsRefreshInterval = 10 * time.Minute
+
+// exportedCredentialsDir is where a session's exported credentials are
+// mounted
+const exportedCredentialsDir = "/run/worklet/credentials"
+
+// exportCommandTimeout bounds each CLI call exporting credentials
+const exportCommandTimeout = 30 * time.Second
+
+// exportedCredentialsPath returns the host directory holding a session's
+// exported credentials, mounted at exportedCredentialsDir
+func exportedCredentialsPath(sessionID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "credentials", sessionID), nil
+}
+
+// awsProfile returns the AWS CLI profile a session's credentials come from
+func awsProfile(creds *config.CredentialConfig) string {
+	if creds != nil && creds.AWSProfile != "" {
+		return creds.AWSProfile
+	}
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// exportedCredentialArgs returns the docker run arguments giving a session
+// its exported credentials: the labels, the mount and the environment
+// pointing each CLI and SDK at them
+func exportedCredentialArgs(sessionID string, creds *config.CredentialConfig) []string {
+	exported := creds.Exported()
+	if len(exported) == 0 {
+		return nil
+	}
+	hostDir, err := exportedCredentialsPath(sessionID)
+	if err != nil {
+		return nil
+	}
+
+	args := []string{
+		"--label", fmt.Sprintf("%s=%s", LabelExportedCredentials, strings.Join(exported, ",")),
+		"-v", fmt.Sprintf("%s:%s", hostDir, exportedCredentialsDir),
+	}
+	for _, name := range exported {
+		dir := path.Join(exportedCredentialsDir, name)
+		switch name {
+		case config.CredentialAWS:
+			profile := awsProfile(creds)
+			args = append(args,
+				"--label", fmt.Sprintf("%s=%s", LabelAWSProfile, profile),
+				"-e", "AWS_SHARED_CREDENTIALS_FILE="+path.Join(dir, "credentials"),
+				"-e", "AWS_CONFIG_FILE="+path.Join(dir, "config"),
+				"-e", "AWS_PROFILE="+profile,
+			)
+		case config.CredentialGCP:
+			args = append(args,
+				"-e", "GOOGLE_APPLICATION_CREDENTIALS="+path.Join(dir, "application_default_credentials.json"),
+				"-e", "CLOUDSDK_AUTH_ACCESS_TOKEN_FILE="+path.Join(dir, "access_token"),
+			)
+		case config.CredentialAzure:
+			args = append(args, "-e", "AZURE_CONFIG_DIR="+dir)
+		case config.CredentialKubeconfig:
+			args = append(args, "-e", "KUBECONFIG="+path.Join(dir, "config"))
+		case config.CredentialDockerAuth:
+			args = append(args, "-e", "DOCKER_CONFIG="+dir)
+		}
+	}
+	return args
+}
+
+// writeExportedCredentials exports the credentials a session is granted
+// before it starts. A CLI that isn't logged in is a warning, so the
+// session still starts.
+func writeExportedCredentials(ctx context.Context, opts RunOptions) {
+	creds := opts.Config.Run.Credentials
+	if len(creds.Exported()) == 0 {
+		return
+	}
+	if host := remoteDockerHost(); host != "" {
+		fmt.Fprintf(Output, "Warning: Docker daemon is remote (%s); exported credentials are written on this machine and won't reach the session\n", host)
+	}
+	if err := WriteExportedCredentials(ctx, opts.SessionID, creds); err != nil {
+		fmt.Fprintf(Output, "Warning: %v\n", err)
+	}
+}
+
+// WriteExportedCredentials exports the current credentials of the host's
+// CLIs into a session's credentials directory. Files are replaced
+// atomically, so a running session never reads a partial one.
+func WriteExportedCredentials(ctx context.Context, sessionID string, creds *config.CredentialConfig) error {
+	hostDir, err := exportedCredentialsPath(sessionID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, name := range creds.Exported() {
+		dir := filepath.Join(hostDir, name)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("failed to create credentials directory: %w", err)
+		}
+		if err := exportCredential(ctx, name, dir, creds); err != nil {
+			errs = append(errs, fmt.Errorf("%s credentials: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// exportCredential writes one kind of exported credentials into dir
+func exportCredential(ctx context.Context, name, dir string, creds *config.CredentialConfig) error {
+	switch name {
+	case config.CredentialAWS:
+		return writeAWSCredentials(ctx, dir, awsProfile(creds))
+	case config.CredentialGCP:
+		return writeGCPCredentials(ctx, dir)
+	case config.CredentialAzure:
+		return writeAzureCredentials(ctx, dir)
+	case config.CredentialKubeconfig:
+		return writeKubeconfig(ctx, dir, creds.KubeContexts)
+	case config.CredentialDockerAuth:
+		return writeDockerAuth(ctx, dir)
+	}
+	return fmt.Errorf("unknown credentials %q", name)
+}
+
+// RefreshExportedCredentials exports the credentials of a running session
+// again, from the labels recording them. The kubeconfig isn't, so that
+// changes the session makes to it, such as switching context, stick.
+func RefreshExportedCredentials(ctx context.Context, sessionID string, labels map[string]string) error {
+	creds := &config.CredentialConfig{AWSProfile: labels[LabelAWSProfile]}
+	for _, name := range strings.Split(labels[LabelExportedCredentials], ",") {
+		switch name {
+		case config.CredentialAWS:
+			creds.AWS = true
+		case config.CredentialGCP:
+			creds.GCP = true
+		case config.CredentialAzure:
+			creds.Azure = true
+		case config.CredentialDockerAuth:
+			creds.DockerAuth = true
+		}
+	}
+	return WriteExportedCredentials(ctx, sessionID, creds)
+}
+
+// RemoveExportedCredentials deletes a session's exported credentials from
+// the host. It is best effort.
+func RemoveExportedCredentials(sessionID string) {
+	if hostDir, err := exportedCredentialsPath(sessionID); err == nil {
+		os.RemoveAll(hostDir)
+	}
+}
+
+// exportCommand runs a CLI that exports credentials and returns its stdout
+func exportCommand(ctx context.Context, stdin string, name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("%s isn't installed", name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, exportCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s %s failed: %s", name, args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("%s %s failed: %w", name, args[0], err)
+	}
+	return output, nil
+}
+
+// writeAWSCredentials exports the temporary credentials of an AWS CLI
+// profile, which resolves SSO and assumed roles, as a credentials file
+// with the profile's region alongside
+func writeAWSCredentials(ctx context.Context, dir, profile string) error {
+	output, err := exportCommand(ctx, "", "aws", "configure", "export-credentials", "--profile", profile, "--format", "process")
+	if err != nil {
+		return fmt.Errorf("%w (run aws sso login --profile %s?)", err, profile)
+	}
+	var exported struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		SessionToken    string `json:"SessionToken"`
+	}
+	if err := json.Unmarshal(output, &exported); err != nil {
+		return fmt.Errorf("failed to parse exported credentials: %w", err)
+	}
+
+	credentials := fmt.Sprintf("[%s]\naws_access_key_id = %s\naws_secret_access_key = %s\n",
+		profile, exported.AccessKeyID, exported.SecretAccessKey)
+	if exported.SessionToken != "" {
+		credentials += fmt.Sprintf("aws_session_token = %s\n", exported.SessionToken)
+	}
+	if err := storage.WriteFileAtomic(filepath.Join(dir, "credentials"), []byte(credentials), 0600); err != nil {
+		return err
+	}
+
+	section := "profile " + profile
+	if profile == "default" {
+		section = "default"
+	}
+	awsConfig := fmt.Sprintf("[%s]\n", section)
+	if region, err := exportCommand(ctx, "", "aws", "configure", "get", "region", "--profile", profile); err == nil {
+		awsConfig += fmt.Sprintf("region = %s\n", strings.TrimSpace(string(region)))
+	}
+	return storage.WriteFileAtomic(filepath.Join(dir, "config"), []byte(awsConfig), 0600)
+}
+
+// gcloudConfigDir returns the directory gcloud keeps its configuration in
+func gcloudConfigDir() (string, error) {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".config", "gcloud"), nil
+}
+
+// writeGCPCredentials writes a fresh gcloud access token, which the gcloud
+// CLI in the session uses, and copies the application default credentials
+// for the client libraries
+func writeGCPCredentials(ctx context.Context, dir string) error {
+	token, err := exportCommand(ctx, "", "gcloud", "auth", "print-access-token")
+	if err != nil {
+		return fmt.Errorf("%w (run gcloud auth login?)", err)
+	}
+	if err := storage.WriteFileAtomic(filepath.Join(dir, "access_token"), []byte(strings.TrimSpace(string(token))), 0600); err != nil {
+		return err
+	}
+
+	configDir, err := gcloudConfigDir()
+	if err != nil {
+		return err
+	}
+	adc, err := os.ReadFile(filepath.Join(configDir, "application_default_credentials.json"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read application default credentials: %w", err)
+	}
+	return storage.WriteFileAtomic(filepath.Join(dir, "application_default_credentials.json"), adc, 0600)
+}
+
+// azureConfigFiles are the files of the Azure CLI's configuration directory
+// that hold its login
+var azureConfigFiles = []string{"azureProfile.json", "msal_token_cache.json", "service_principal_entries.json", "clouds.config", "config"}
+
+// writeAzureCredentials refreshes the Azure CLI's access token on the host
+// and copies its login into the session's Azure configuration directory
+func writeAzureCredentials(ctx context.Context, dir string) error {
+	if _, err := exportCommand(ctx, "", "az", "account", "get-access-token", "--output", "none"); err != nil {
+		return fmt.Errorf("%w (run az login?)", err)
+	}
+
+	configDir := os.Getenv("AZURE_CONFIG_DIR")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		configDir = filepath.Join(homeDir, ".azure")
+	}
+	for _, name := range azureConfigFiles {
+		data, err := os.ReadFile(filepath.Join(configDir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if err := storage.WriteFileAtomic(filepath.Join(dir, name), data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostKubeconfig returns the host's kubeconfig with certificates and keys
+// inlined, so it works without the files it refers to. Without kubectl the
+// first file of $KUBECONFIG or ~/.kube/config is read as it is.
+func hostKubeconfig(ctx context.Context) ([]byte, error) {
+	if _, err := exec.LookPath("kubectl"); err == nil {
+		return exportCommand(ctx, "", "kubectl", "config", "view", "--raw", "--flatten")
+	}
+	kubeconfig, _, _ := strings.Cut(os.Getenv("KUBECONFIG"), string(os.PathListSeparator))
+	if kubeconfig == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		kubeconfig = filepath.Join(homeDir, ".kube", "config")
+	}
+	data, err := os.ReadFile(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	return data, nil
+}
+
+// writeKubeconfig writes the host's kubeconfig for a session, keeping only
+// the contexts matching patterns, when there are any, and the clusters and
+// users they use
+func writeKubeconfig(ctx context.Context, dir string, patterns []string) error {
+	data, err := hostKubeconfig(ctx)
+	if err != nil {
+		return err
+	}
+	filtered, err := filterKubeconfig(data, patterns)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFileAtomic(filepath.Join(dir, "config"), filtered, 0600)
+}
+
+// filterKubeconfig keeps the contexts of a kubeconfig whose names match one
+// of patterns, and the clusters and users they refer to. The current
+// context is kept if it matches, otherwise the first context kept becomes
+// current.
+func filterKubeconfig(data []byte, patterns []string) ([]byte, error) {
+	var kubeconfig map[string]any
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+	if len(patterns) == 0 {
+		return data, nil
+	}
+
+	matches := func(name string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	named := func(entry any) string {
+		m, _ := entry.(map[string]any)
+		name, _ := m["name"].(string)
+		return name
+	}
+
+	var contexts []any
+	clusters := make(map[string]bool)
+	users := make(map[string]bool)
+	for _, entry := range list(kubeconfig["contexts"]) {
+		if !matches(named(entry)) {
+			continue
+		}
+		contexts = append(contexts, entry)
+		kubeContext, _ := entry.(map[string]any)["context"].(map[string]any)
+		if cluster, ok := kubeContext["cluster"].(string); ok {
+			clusters[cluster] = true
+		}
+		if user, ok := kubeContext["user"].(string); ok {
+			users[user] = true
+		}
+	}
+	if len(contexts) == 0 {
+		return nil, fmt.Errorf("no kube context matches %s", strings.Join(patterns, ", "))
+	}
+
+	keep := func(entries any, names map[string]bool) []any {
+		var kept []any
+		for _, entry := range list(entries) {
+			if names[named(entry)] {
+				kept = append(kept, entry)
+			}
+		}
+		return kept
+	}
+	kubeconfig["contexts"] = contexts
+	kubeconfig["clusters"] = keep(kubeconfig["clusters"], clusters)
+	kubeconfig["users"] = keep(kubeconfig["users"], users)
+	if current, _ := kubeconfig["current-context"].(string); !matches(current) {
+		kubeconfig["current-context"] = named(contexts[0])
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(kubeconfig); err != nil {
+		return nil, fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	enc.Close()
+	return buf.Bytes(), nil
+}
+
+// list returns a decoded YAML value as a list, nil if it isn't one
+func list(v any) []any {
+	l, _ := v.([]any)
+	return l
+}
+
+// dockerConfigDir returns the directory the host's Docker CLI keeps its
+// configuration in
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".docker"), nil
+}
+
+// dockerAuth is a registry login in a Docker CLI config file
+type dockerAuth struct {
+	Auth          string `json:"auth,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// writeDockerAuth writes a Docker CLI config holding only the host's
+// registry logins. Logins kept by credential helpers, which the session
+// doesn't have, are resolved into the file.
+func writeDockerAuth(ctx context.Context, dir string) error {
+	configDir, err := dockerConfigDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no Docker config in %s (run docker login?)", configDir)
+	} else if err != nil {
+		return fmt.Errorf("failed to read Docker config: %w", err)
+	}
+	var hostConfig struct {
+		Auths       map[string]dockerAuth `json:"auths"`
+		CredsStore  string                `json:"credsStore"`
+		CredHelpers map[string]string     `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(data, &hostConfig); err != nil {
+		return fmt.Errorf("failed to parse Docker config: %w", err)
+	}
+
+	// Registries and the helper holding each one's login, "" when it's in
+	// the config itself
+	helpers := make(map[string]string)
+	for registry := range hostConfig.Auths {
+		helpers[registry] = hostConfig.CredsStore
+	}
+	if hostConfig.CredsStore != "" {
+		if output, err := exportCommand(ctx, "", "docker-credential-"+hostConfig.CredsStore, "list"); err == nil {
+			var listed map[string]string
+			if json.Unmarshal(output, &listed) == nil {
+				for registry := range listed {
+					helpers[registry] = hostConfig.CredsStore
+				}
+			}
+		}
+	}
+	for registry, helper := range hostConfig.CredHelpers {
+		helpers[registry] = helper
+	}
+
+	auths := make(map[string]dockerAuth)
+	var errs []error
+	for registry, helper := range helpers {
+		if auth := hostConfig.Auths[registry]; auth.Auth != "" || auth.IdentityToken != "" {
+			auths[registry] = auth
+			continue
+		}
+		if helper == "" {
+			continue
+		}
+		output, err := exportCommand(ctx, registry, "docker-credential-"+helper, "get")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", registry, err))
+			continue
+		}
+		var login struct {
+			Username string `json:"Username"`
+			Secret   string `json:"Secret"`
+		}
+		if err := json.Unmarshal(output, &login); err != nil {
+			errs = append(errs, fmt.Errorf("%s: failed to parse docker-credential-%s output: %w", registry, helper, err))
+			continue
+		}
+		if login.Username == "<token>" {
+			auths[registry] = dockerAuth{IdentityToken: login.Secret}
+		} else {
+			auths[registry] = dockerAuth{Auth: base64.StdEncoding.EncodeToString([]byte(login.Username + ":" + login.Secret))}
+		}
+	}
+
+	out, err := json.MarshalIndent(map[string]any{"auths": auths}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := storage.WriteFileAtomic(filepath.Join(dir, "config.json"), out, 0600); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
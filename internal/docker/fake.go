@@ -0,0 +1,369 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+)
+
+// FakeContainer is a container in a FakeRuntime
+type FakeContainer struct {
+	ID           string            `json:"id"`
+	Name         string            `json:"name"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	State        string            `json:"state,omitempty"` // "running" (default), "exited" or "restarting"
+	ExitCode     int               `json:"exit_code,omitempty"`
+	RestartCount int               `json:"restart_count,omitempty"`
+	Health       string            `json:"health,omitempty"` // "starting", "healthy" or "unhealthy"; empty without a health check
+	Created      time.Time         `json:"created,omitempty"`
+}
+
+// FakeRuntime is an in-memory Runtime. Changes made through its methods are
+// reported to Events subscribers the way Docker reports them.
+type FakeRuntime struct {
+	mu          sync.Mutex
+	containers  map[string]*FakeContainer
+	subscribers map[chan events.Message]filters.Args
+	pingErr     error
+}
+
+// NewFakeRuntime returns a fake with no containers
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		containers:  make(map[string]*FakeContainer),
+		subscribers: make(map[chan events.Message]filters.Args),
+	}
+}
+
+// Load adds the containers in a JSON file
+func (f *FakeRuntime) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read fake containers: %w", err)
+	}
+	var containers []FakeContainer
+	if err := json.Unmarshal(data, &containers); err != nil {
+		return fmt.Errorf("failed to parse fake containers: %w", err)
+	}
+	for _, c := range containers {
+		f.Add(c)
+	}
+	return nil
+}
+
+// Reset removes every container and event subscriber without reporting
+// events
+func (f *FakeRuntime) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.containers = make(map[string]*FakeContainer)
+	f.subscribers = make(map[chan events.Message]filters.Args)
+	f.pingErr = nil
+}
+
+// Subscribers returns how many event streams are open
+func (f *FakeRuntime) Subscribers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subscribers)
+}
+
+// Add creates a container, running unless its state says otherwise
+func (f *FakeRuntime) Add(c FakeContainer) {
+	if c.State == "" {
+		c.State = "running"
+	}
+	if c.Name == "" {
+		c.Name = c.ID
+	}
+	if c.Created.IsZero() {
+		c.Created = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.containers[c.ID] = &c
+	f.publish(&c, events.ActionCreate)
+	if c.State == "running" {
+		f.publish(&c, events.ActionStart)
+	}
+}
+
+// Start starts a container
+func (f *FakeRuntime) Start(id string) error {
+	return f.update(id, func(c *FakeContainer) {
+		c.State = "running"
+		f.publish(c, events.ActionStart)
+	})
+}
+
+// Exit makes a container exit with a code. If restarting, it's left in the
+// restarting state, as Docker does under a restart policy.
+func (f *FakeRuntime) Exit(id string, exitCode int, restarting bool) error {
+	return f.update(id, func(c *FakeContainer) {
+		c.State = "exited"
+		if restarting {
+			c.State = "restarting"
+			c.RestartCount++
+		}
+		c.ExitCode = exitCode
+		f.publish(c, events.ActionDie)
+	})
+}
+
+// Exec reports a command run in a container
+func (f *FakeRuntime) Exec(id, command string) error {
+	return f.update(id, func(c *FakeContainer) {
+		f.publish(c, events.Action(string(events.ActionExecStart)+": "+command))
+	})
+}
+
+// Remove removes a container
+func (f *FakeRuntime) Remove(id string) error {
+	return f.update(id, func(c *FakeContainer) {
+		if c.State == "running" {
+			c.State = "exited"
+			f.publish(c, events.ActionKill)
+			f.publish(c, events.ActionDie)
+		}
+		delete(f.containers, c.ID)
+		f.publish(c, events.ActionDestroy)
+	})
+}
+
+// SetHealth changes a container's health check status
+func (f *FakeRuntime) SetHealth(id, status string) error {
+	return f.update(id, func(c *FakeContainer) {
+		c.Health = status
+		f.publish(c, events.Action(string(events.ActionHealthStatus)+": "+status))
+	})
+}
+
+// update applies fn to a container found by ID or name while holding the lock
+func (f *FakeRuntime) update(idOrName string, fn func(*FakeContainer)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.find(idOrName)
+	if c == nil {
+		return errdefs.NotFound(fmt.Errorf("no such container: %s", idOrName))
+	}
+	fn(c)
+	return nil
+}
+
+// find returns a container by ID or name. The caller must hold mu.
+func (f *FakeRuntime) find(idOrName string) *FakeContainer {
+	if c, ok := f.containers[idOrName]; ok {
+		return c
+	}
+	for _, c := range f.containers {
+		if c.Name == idOrName || "/"+c.Name == idOrName {
+			return c
+		}
+	}
+	return nil
+}
+
+// publish sends an event to matching subscribers, dropping it for any that
+// aren't keeping up. The caller must hold mu.
+func (f *FakeRuntime) publish(c *FakeContainer, action events.Action) {
+	attributes := map[string]string{"name": c.Name}
+	for k, v := range c.Labels {
+		attributes[k] = v
+	}
+	if action == events.ActionDie {
+		attributes["exitCode"] = strconv.Itoa(c.ExitCode)
+	}
+
+	now := time.Now()
+	msg := events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: c.ID, Attributes: attributes},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+	for ch, args := range f.subscribers {
+		if !args.ExactMatch("type", string(msg.Type)) || !args.FuzzyMatch("event", string(action)) || !args.MatchKVList("label", c.Labels) {
+			continue
+		}
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// ContainerList implements Runtime. Names are matched with their leading
+// slash, as Docker does.
+func (f *FakeRuntime) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var list []container.Summary
+	for _, c := range f.containers {
+		if !options.All && c.State != "running" {
+			continue
+		}
+		if !options.Filters.MatchKVList("label", c.Labels) || !options.Filters.Match("name", "/"+c.Name) || !options.Filters.FuzzyMatch("id", c.ID) {
+			continue
+		}
+		status := c.State
+		if c.Health != "" {
+			status += " (" + c.Health + ")"
+		}
+		list = append(list, container.Summary{
+			ID:      c.ID,
+			Names:   []string{"/" + c.Name},
+			Labels:  c.Labels,
+			State:   container.ContainerState(c.State),
+			Status:  status,
+			Created: c.Created.Unix(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// ContainerInspect implements Runtime.
+func (f *FakeRuntime) ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.find(containerID)
+	if c == nil {
+		return container.InspectResponse{}, errdefs.NotFound(fmt.Errorf("no such container: %s", containerID))
+	}
+	var health *container.Health
+	if c.Health != "" {
+		health = &container.Health{Status: container.HealthStatus(c.Health)}
+	}
+	return container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:      c.ID,
+			Name:    "/" + c.Name,
+			Created: c.Created.Format(time.RFC3339Nano),
+			State: &container.State{
+				Status:     container.ContainerState(c.State),
+				Running:    c.State == "running",
+				Restarting: c.State == "restarting",
+				ExitCode:   c.ExitCode,
+				Health:     health,
+			},
+			RestartCount: c.RestartCount,
+		},
+		Config: &container.Config{Labels: c.Labels},
+	}, nil
+}
+
+// ContainerStop implements Runtime.
+func (f *FakeRuntime) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	return f.update(containerID, func(c *FakeContainer) {
+		if c.State != "running" {
+			return
+		}
+		c.State = "exited"
+		c.ExitCode = 0
+		f.publish(c, events.ActionKill)
+		f.publish(c, events.ActionDie)
+	})
+}
+
+// fakeWaitInterval is how often ContainerWait checks a fake container
+const fakeWaitInterval = 100 * time.Millisecond
+
+// ContainerWait implements Runtime, reporting when a container is neither
+// running nor restarting. The condition is ignored.
+func (f *FakeRuntime) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	results := make(chan container.WaitResponse, 1)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			info, err := f.ContainerInspect(ctx, containerID)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !info.State.Running && !info.State.Restarting {
+				results <- container.WaitResponse{StatusCode: int64(info.State.ExitCode)}
+				return
+			}
+			select {
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			case <-time.After(fakeWaitInterval):
+			}
+		}
+	}()
+	return results, errs
+}
+
+// NetworkList implements Runtime. The fake has no networks.
+func (f *FakeRuntime) NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error) {
+	return nil, nil
+}
+
+// NetworkInspect implements Runtime. The fake has no networks.
+func (f *FakeRuntime) NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error) {
+	return network.Inspect{}, errdefs.NotFound(fmt.Errorf("network %s not found", networkID))
+}
+
+// NetworkRemove implements Runtime. The fake has no networks.
+func (f *FakeRuntime) NetworkRemove(ctx context.Context, networkID string) error {
+	return errdefs.NotFound(fmt.Errorf("network %s not found", networkID))
+}
+
+// Events implements Runtime. The stream ends when ctx is done.
+func (f *FakeRuntime) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	messages := make(chan events.Message, 100)
+	errs := make(chan error, 1)
+
+	f.mu.Lock()
+	f.subscribers[messages] = options.Filters
+	f.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		delete(f.subscribers, messages)
+		f.mu.Unlock()
+	}()
+	return messages, errs
+}
+
+// Ping implements Runtime, failing with the error set by SetPingError
+func (f *FakeRuntime) Ping(ctx context.Context) (types.Ping, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.pingErr != nil {
+		return types.Ping{}, f.pingErr
+	}
+	return types.Ping{APIVersion: "fake"}, nil
+}
+
+// SetPingError makes Ping fail with err, as if Docker were unreachable, or
+// succeed again when err is nil
+func (f *FakeRuntime) SetPingError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pingErr = err
+}
+
+// Close implements Runtime. The fake stays usable.
+func (f *FakeRuntime) Close() error {
+	return nil
+}
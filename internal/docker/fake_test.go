@@ -0,0 +1,127 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+	"github.com/nolanleung/worklet/internal/nginx"
+)
+
+func sessionLabels(id string) map[string]string {
+	return map[string]string{
+		"worklet.session":      "true",
+		"worklet.session.id":   id,
+		"worklet.project.name": "demo",
+	}
+}
+
+func TestFakeRuntimeList(t *testing.T) {
+	fake := NewFakeRuntime()
+	fake.Add(FakeContainer{ID: "c1", Name: "demo-1", Labels: sessionLabels("1")})
+	fake.Add(FakeContainer{ID: "c2", Name: "demo-2", Labels: sessionLabels("2"), State: "exited"})
+	fake.Add(FakeContainer{ID: "c3", Name: "postgres"})
+
+	sessionFilter := filters.NewArgs(filters.Arg("label", "worklet.session=true"))
+	running, err := fake.ContainerList(context.Background(), container.ListOptions{Filters: sessionFilter})
+	if err != nil {
+		t.Fatalf("ContainerList failed: %v", err)
+	}
+	if len(running) != 1 || running[0].ID != "c1" {
+		t.Errorf("running sessions = %v, want only c1", running)
+	}
+
+	all, _ := fake.ContainerList(context.Background(), container.ListOptions{All: true, Filters: sessionFilter})
+	if len(all) != 2 {
+		t.Errorf("got %d sessions including stopped ones, want 2", len(all))
+	}
+
+	info, err := fake.ContainerInspect(context.Background(), "demo-1")
+	if err != nil {
+		t.Fatalf("ContainerInspect failed: %v", err)
+	}
+	if info.ID != "c1" || !info.State.Running || info.Config.Labels["worklet.session.id"] != "1" {
+		t.Errorf("unexpected inspect result: %+v", info.ContainerJSONBase)
+	}
+
+	if _, err := fake.ContainerInspect(context.Background(), "missing"); !errdefs.IsNotFound(err) {
+		t.Errorf("inspecting a missing container returned %v, want a not found error", err)
+	}
+}
+
+func TestFakeRuntimeEvents(t *testing.T) {
+	fake := NewFakeRuntime()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventFilters := filters.NewArgs(
+		filters.Arg("type", string(events.ContainerEventType)),
+		filters.Arg("label", "worklet.session=true"),
+		filters.Arg("event", string(events.ActionStart)),
+		filters.Arg("event", string(events.ActionDie)),
+		filters.Arg("event", string(events.ActionExecStart)),
+	)
+	messages, _ := fake.Events(ctx, events.ListOptions{Filters: eventFilters})
+
+	fake.Add(FakeContainer{ID: "c3", Name: "postgres"})
+	fake.Add(FakeContainer{ID: "c1", Labels: sessionLabels("1")})
+	fake.Exec("c1", "sh")
+	fake.Exit("c1", 137, true)
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case msg := <-messages:
+			got = append(got, string(msg.Action)+" "+msg.Actor.ID+" "+msg.Actor.Attributes["exitCode"])
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v", got)
+		}
+	}
+	want := []string{"start c1 ", "exec_start: sh c1 ", "die c1 137"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+
+	info, _ := fake.ContainerInspect(context.Background(), "c1")
+	if !info.State.Restarting || info.RestartCount != 1 {
+		t.Errorf("State = %+v, RestartCount = %d, want restarting once", info.State, info.RestartCount)
+	}
+}
+
+func TestFakeNginxManager(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fake-nginx-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	nm, err := NewNginxManager(dir, NewFakeRuntime())
+	if err != nil {
+		t.Fatalf("NewNginxManager failed: %v", err)
+	}
+	if err := nm.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	configs := nginx.Configs{Main: "events {}\n", Files: map[string]string{"conf.d/abc123.conf": "server {}\n"}}
+	if _, err := nm.UpdateConfig(context.Background(), configs); err != nil {
+		t.Fatalf("UpdateConfig failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, nginxConfigFile))
+	if err != nil {
+		t.Fatalf("config wasn't written: %v", err)
+	}
+	if string(data) != "events {}\n" {
+		t.Errorf("config = %q", data)
+	}
+	if config, err := nm.ReadConfig(); err != nil || !strings.Contains(config, "server {}") {
+		t.Errorf("ReadConfig() = %q, %v; want the fork's include", config, err)
+	}
+}
@@ -0,0 +1,27 @@
+#!/bin/sh
+# Installs libfaketime on top of a session's image and links it where
+# sessions preload it from
+set -e
+
+if command -v apt-get >/dev/null 2>&1; then
+    export DEBIAN_FRONTEND=noninteractive
+    apt-get update
+    apt-get install -y --no-install-recommends libfaketime
+    rm -rf /var/lib/apt/lists/*
+elif command -v apk >/dev/null 2>&1; then
+    apk add --no-cache libfaketime
+elif command -v dnf >/dev/null 2>&1; then
+    dnf install -y libfaketime
+    dnf clean all
+else
+    echo "run.faketime needs a Debian, Ubuntu, Alpine or Fedora based image" >&2
+    exit 1
+fi
+
+lib=$(find / -xdev -name libfaketime.so.1 2>/dev/null | head -n 1)
+if [ -z "$lib" ]; then
+    echo "libfaketime.so.1 wasn't installed" >&2
+    exit 1
+fi
+mkdir -p "$(dirname "$WORKLET_FAKETIME_LIB")"
+ln -sf "$lib" "$WORKLET_FAKETIME_LIB"
@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// How Docker Desktop on macOS shares host files with its VM, which decides
+// how fast bind mounts are
+const (
+	FileSharingVirtioFS = "virtiofs" // Fastest, the default since Docker Desktop 4.22
+	FileSharingGRPCFuse = "grpcfuse"
+	FileSharingOSXFS    = "osxfs" // Legacy; the only one that honours mount consistency
+)
+
+// dockerDesktopSettingsFiles are Docker Desktop's settings files in its
+// group container, newest first
+var dockerDesktopSettingsFiles = []string{"settings-store.json", "settings.json"}
+
+// FileSharing returns how Docker Desktop on macOS shares files, or "" if
+// worklet can't tell, such as with other Docker runtimes or elsewhere than
+// on macOS
+func FileSharing() string {
+	if runtime.GOOS != "darwin" || remoteDockerHost() != "" {
+		return ""
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return fileSharingFromSettings(filepath.Join(homeDir, "Library", "Group Containers", "group.com.docker"))
+}
+
+// fileSharingFromSettings reads the file sharing implementation from the
+// Docker Desktop settings in dir
+func fileSharingFromSettings(dir string) string {
+	for _, name := range dockerDesktopSettingsFiles {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		var raw map[string]any
+		if err := json.Unmarshal(data, &raw); err != nil {
+			continue
+		}
+		// settings-store.json capitalizes the keys settings.json has
+		settings := make(map[string]any, len(raw))
+		for key, value := range raw {
+			settings[strings.ToLower(key)] = value
+		}
+		if enabled, ok := settings["usevirtualizationframeworkvirtiofs"].(bool); ok && enabled {
+			return FileSharingVirtioFS
+		}
+		if enabled, ok := settings["usegrpcfuse"].(bool); ok {
+			if enabled {
+				return FileSharingGRPCFuse
+			}
+			return FileSharingOSXFS
+		}
+		// VirtioFS is the default when neither is set
+		return FileSharingVirtioFS
+	}
+	return ""
+}
+
+// FileSharingProblems returns advice for making mount mode faster, when
+// Docker Desktop shares files with something slower than VirtioFS
+func FileSharingProblems() []string {
+	switch sharing := FileSharing(); sharing {
+	case FileSharingGRPCFuse, FileSharingOSXFS:
+		return []string{
+			"Docker Desktop shares files with " + sharing + ", which makes mount mode slow",
+			"choose VirtioFS under Settings > General > \"Choose file sharing implementation\"",
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSharingFromSettings(t *testing.T) {
+	tests := []struct {
+		file     string
+		settings string
+		expected string
+	}{
+		{"settings-store.json", `{"UseVirtualizationFrameworkVirtioFS": true, "UseGrpcfuse": false}`, FileSharingVirtioFS},
+		{"settings-store.json", `{"UseVirtualizationFrameworkVirtioFS": false, "UseGrpcfuse": true}`, FileSharingGRPCFuse},
+		{"settings.json", `{"useVirtualizationFrameworkVirtioFS": false, "useGrpcfuse": false}`, FileSharingOSXFS},
+		{"settings.json", `{}`, FileSharingVirtioFS},
+		{"other.json", `{"UseGrpcfuse": true}`, ""},
+	}
+
+	for _, tt := range tests {
+		dir, err := os.MkdirTemp("", "worklet-filesharing-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		if err := os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.settings), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := fileSharingFromSettings(dir); got != tt.expected {
+			t.Errorf("%s %s: got %q, want %q", tt.file, tt.settings, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// nvidiaToolkitBinaries are installed by the NVIDIA Container Toolkit, which
+// Docker needs to pass GPUs in
+var nvidiaToolkitBinaries = []string{"nvidia-ctk", "nvidia-container-cli", "nvidia-container-runtime-hook"}
+
+// GPUSupportProblems returns what stands in the way of passing NVIDIA GPUs
+// into sessions, or nothing if Docker looks able to. Things only checked
+// on the Docker host are skipped when it's another machine.
+func GPUSupportProblems(ctx context.Context) []string {
+	if runtime.GOOS == "darwin" && remoteDockerHost() == "" {
+		return []string{"Docker on macOS can't pass GPUs into containers"}
+	}
+	output, err := dockerCommand(ctx, "info", "--format", "{{json .Runtimes}} {{.OperatingSystem}}").Output()
+	if err != nil {
+		return []string{"Docker isn't reachable"}
+	}
+	info := string(output)
+	// Docker Desktop passes GPUs in through WSL 2 without the toolkit
+	if strings.Contains(info, "Docker Desktop") {
+		return nil
+	}
+
+	var problems []string
+	toolkit := strings.Contains(info, "nvidia")
+	if runtime.GOOS == "linux" && remoteDockerHost() == "" {
+		if _, err := exec.LookPath("nvidia-smi"); err != nil {
+			problems = append(problems, "nvidia-smi isn't installed, so the NVIDIA driver seems to be missing")
+		}
+		for _, binary := range nvidiaToolkitBinaries {
+			if _, err := exec.LookPath(binary); err == nil {
+				toolkit = true
+			}
+		}
+	}
+	if !toolkit {
+		problems = append(problems, "the NVIDIA Container Toolkit isn't set up for Docker; install it and run 'sudo nvidia-ctk runtime configure --runtime=docker'")
+	}
+	return problems
+}
@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestBuildRunArgsGPUs(t *testing.T) {
+	opts := RunOptions{
+		WorkDir:   "/home/me/app",
+		Config:    &config.WorkletConfig{Name: "test", Run: config.RunConfig{GPUs: config.GPUList{"0", "1"}}},
+		SessionID: "abc123",
+		MountMode: true,
+	}
+	args, err := buildRunArgs(opts, "pytorch/pytorch", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{`--gpus "device=0,1"`, "-e NVIDIA_VISIBLE_DEVICES=0,1", "-e NVIDIA_DRIVER_CAPABILITIES=compute,utility"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+
+	opts.Config.Run.GPUs = nil
+	args, err = buildRunArgs(opts, "pytorch/pytorch", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), "--gpus") {
+		t.Errorf("expected no GPUs without run.gpus, got %v", args)
+	}
+}
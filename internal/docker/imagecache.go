@@ -0,0 +1,155 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// imageCacheMount is where full isolation sessions find the image cache.
+// The entrypoint loads the compose services' images from it into the
+// session's Docker daemon instead of pulling them.
+const imageCacheMount = "/worklet-image-cache"
+
+// imageCacheMaxAge is how long a cached image is kept after it was last
+// saved or used
+const imageCacheMaxAge = 30 * 24 * time.Hour
+
+// ImageCacheDir returns the directory holding images saved for full
+// isolation sessions, ~/.worklet/image-cache
+func ImageCacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "image-cache"), nil
+}
+
+// imageCacheFile returns the name an image is saved under in the cache.
+// The entrypoint derives the same name with tr '/:@' '___'.
+func imageCacheFile(image string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(image) + ".tar"
+}
+
+// useImageCache reports whether a session can load its compose services'
+// images from the cache: it runs them in its own Docker daemon, and the
+// cache is on the Docker host
+func useImageCache(opts RunOptions) bool {
+	return isolationMode(opts.Config) == "full" && opts.ComposePath != "" && remoteDockerHost() == ""
+}
+
+// CacheComposeImages pulls the images of a compose file's services on the
+// host and saves them into the image cache, so full isolation sessions load
+// them from disk instead of each pulling them from the registry. Images
+// whose cached copy is current are skipped, as are services that are only
+// built. Cached images unused for a month are removed.
+func CacheComposeImages(ctx context.Context, composePath string) error {
+	// A remote daemon's sessions can't mount a cache on this machine
+	if remoteDockerHost() != "" {
+		return nil
+	}
+	services, err := ParseComposeServices(composePath)
+	if err != nil {
+		return err
+	}
+	dir, err := ImageCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create image cache: %w", err)
+	}
+
+	var failed []string
+	seen := make(map[string]bool)
+	for _, svc := range services {
+		if svc.Image == "" || seen[svc.Image] {
+			continue
+		}
+		seen[svc.Image] = true
+		if err := cacheImage(ctx, dir, svc.Image); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failed = append(failed, fmt.Sprintf("%s: %v", svc.Image, err))
+		}
+	}
+
+	pruneImageCache(dir, imageCacheMaxAge)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to cache images: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// cacheImage makes sure the cache holds the current version of image
+func cacheImage(ctx context.Context, dir, image string) error {
+	if dockerCommand(ctx, "image", "inspect", image).Run() != nil {
+		if output, err := dockerCommand(ctx, "pull", "--quiet", image).CombinedOutput(); err != nil {
+			return fmt.Errorf("pull failed: %s", strings.TrimSpace(string(output)))
+		}
+	}
+	output, err := dockerCommand(ctx, "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return fmt.Errorf("failed to inspect image: %w", err)
+	}
+	id := strings.TrimSpace(string(output))
+
+	path := filepath.Join(dir, imageCacheFile(image))
+	idPath := strings.TrimSuffix(path, ".tar") + ".id"
+	if cached, err := os.ReadFile(idPath); err == nil && string(cached) == id {
+		if _, err := os.Stat(path); err == nil {
+			// Mark it used so it isn't pruned
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return nil
+		}
+	}
+
+	// Save next to the cache entry and rename it into place, so sessions
+	// never load a partly written image
+	file, err := os.CreateTemp(dir, "save-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmp := file.Name()
+	file.Close()
+	if output, err := dockerCommand(ctx, "save", "-o", tmp, image).CombinedOutput(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("save failed: %s", strings.TrimSpace(string(output)))
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return storage.WriteFileAtomic(idPath, []byte(id), 0644)
+}
+
+// pruneImageCache removes cached images older than maxAge
+func pruneImageCache(dir string, maxAge time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".tar") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		os.Remove(path)
+		os.Remove(strings.TrimSuffix(path, ".tar") + ".id")
+	}
+}
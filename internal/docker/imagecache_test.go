@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestImageCacheFile(t *testing.T) {
+	tests := map[string]string{
+		"postgres:16":                    "postgres_16.tar",
+		"ghcr.io/acme/api:1.2":           "ghcr.io_acme_api_1.2.tar",
+		"redis@sha256:abc":               "redis_sha256_abc.tar",
+		"localhost:5000/team/web:latest": "localhost_5000_team_web_latest.tar",
+	}
+	for image, want := range tests {
+		if got := imageCacheFile(image); got != want {
+			t.Errorf("imageCacheFile(%q) = %q, want %q", image, got, want)
+		}
+	}
+}
+
+func TestPruneImageCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-image-cache-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"old.tar", "old.id", "new.tar", "new.id"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	longAgo := time.Now().Add(-2 * imageCacheMaxAge)
+	os.Chtimes(filepath.Join(dir, "old.tar"), longAgo, longAgo)
+
+	pruneImageCache(dir, imageCacheMaxAge)
+
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, " ") != "new.id new.tar" {
+		t.Errorf("cache holds %v after pruning, want only the new image", names)
+	}
+}
+
+func TestBuildRunArgsImageCache(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-image-cache-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	composePath := filepath.Join(dir, "docker-compose.yml")
+	if err := os.WriteFile(composePath, []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RunOptions{
+		WorkDir:     dir,
+		Config:      &config.WorkletConfig{Name: "test", Run: config.RunConfig{Isolation: "full"}},
+		SessionID:   "abc123",
+		MountMode:   true,
+		ComposePath: composePath,
+		ImageCache:  "/home/me/.worklet/image-cache",
+	}
+	args, err := buildRunArgs(opts, "node:20", "/tmp/entrypoint.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(args, " "), "-v /home/me/.worklet/image-cache:"+imageCacheMount+":ro") {
+		t.Errorf("expected the image cache mount, got %v", args)
+	}
+}
@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+var (
+	hostIPv6Once sync.Once
+	hostIPv6     bool
+)
+
+// HostSupportsIPv6 reports whether the host has IPv6 enabled, judged by an
+// interface that is up having an IPv6 address
+func HostSupportsIPv6() bool {
+	hostIPv6Once.Do(func() {
+		interfaces, err := net.Interfaces()
+		if err != nil {
+			return
+		}
+		for _, iface := range interfaces {
+			if iface.Flags&net.FlagUp == 0 {
+				continue
+			}
+			addrs, err := iface.Addrs()
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil && ipNet.IP.To16() != nil {
+					hostIPv6 = true
+					return
+				}
+			}
+		}
+	})
+	return hostIPv6
+}
+
+// ipv6Setting returns whether to use IPv6 and whether the global config
+// requires it
+func ipv6Setting() (enabled, required bool) {
+	global, err := config.LoadGlobalConfig()
+	if err == nil && global.Network.IPv6 != nil {
+		return *global.Network.IPv6, *global.Network.IPv6
+	}
+	return HostSupportsIPv6(), false
+}
+
+// IPv6Enabled reports whether session networks and the proxy use IPv6: as
+// set by network.ipv6 in the global config, or else if the host supports it
+func IPv6Enabled() bool {
+	enabled, _ := ipv6Setting()
+	return enabled
+}
+
+// createNetwork creates a Docker network, dual-stack when IPv6 is enabled.
+// Internal networks have no outside access.
+// If Docker can't give the network IPv6 addresses, such as when it has no
+// IPv6 address pool, an IPv4 network is created instead unless IPv6 is
+// required.
+func createNetwork(ctx context.Context, networkName string, internal bool) error {
+	args := []string{"network", "create"}
+	if internal {
+		args = append(args, "--internal")
+	}
+
+	enabled, required := ipv6Setting()
+	if enabled {
+		output, err := dockerCommand(ctx, append(args, "--ipv6", networkName)...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if required {
+			return fmt.Errorf("failed to create IPv6 network: %w\nOutput: %s", err, string(output))
+		}
+		fmt.Fprintf(Output, "Docker couldn't enable IPv6 on network '%s', creating it IPv4-only\n", networkName)
+	}
+
+	output, err := dockerCommand(ctx, append(args, networkName)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create network: %w\nOutput: %s", err, string(output))
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+const (
+	// RegistryMirrorContainer is the name of the pull-through cache the
+	// daemon runs, which sessions reach it by on their networks
+	RegistryMirrorContainer = "worklet-registry-mirror"
+	registryMirrorImage     = "registry:2"
+	registryMirrorVolume    = "worklet-registry-cache"
+	registryMirrorAddress   = RegistryMirrorContainer + ":5000"
+	registryMirrorRemote    = "https://registry-1.docker.io"
+
+	// LabelRegistryMirror holds a hash of the settings the mirror was
+	// started with, so it's only recreated when they change
+	LabelRegistryMirror = "worklet.registry-mirror"
+
+	// LabelUsesRegistryMirror marks sessions whose Docker daemon pulls
+	// through the mirror, which it's reconnected to when recreated
+	LabelUsesRegistryMirror = "worklet.registry-mirror.used"
+)
+
+// registryMirrorHash identifies the settings a mirror container runs with
+func registryMirrorHash(cfg config.RegistryMirrorConfig) string {
+	sum := sha256.Sum256([]byte(cfg.Username + "\x00" + cfg.ResolveToken()))
+	return hex.EncodeToString(sum[:8])
+}
+
+// StartRegistryMirror makes sure the Docker Hub mirror runs with cfg and is
+// on every worklet network. A mirror already running with the same settings
+// is kept, so its cache and the sessions using it aren't disturbed; the
+// cached layers live in a volume either way.
+func StartRegistryMirror(ctx context.Context, cfg config.RegistryMirrorConfig) error {
+	hash := registryMirrorHash(cfg)
+	output, err := dockerCommand(ctx, "inspect", "--format",
+		fmt.Sprintf("{{.State.Running}} {{index .Config.Labels %q}}", LabelRegistryMirror), RegistryMirrorContainer).Output()
+	current := err == nil && strings.TrimSpace(string(output)) == "true "+hash
+	if err == nil && !current {
+		if output, err := dockerCommand(ctx, "rm", "-f", RegistryMirrorContainer).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to remove registry mirror: %s", strings.TrimSpace(string(output)))
+		}
+	}
+	if !current {
+		if err := EnsureNetworkExists(); err != nil {
+			return fmt.Errorf("failed to create worklet network: %w", err)
+		}
+		args := []string{"run", "-d",
+			"--name", RegistryMirrorContainer,
+			"--restart", "unless-stopped",
+			"--label", fmt.Sprintf("%s=%s", LabelRegistryMirror, hash),
+			"--network", WorkletNetworkName,
+			"-v", registryMirrorVolume + ":/var/lib/registry",
+			"-e", "REGISTRY_PROXY_REMOTEURL=" + registryMirrorRemote,
+		}
+		if cfg.Username != "" {
+			// The password is passed through the environment so it doesn't
+			// show up in the process list
+			args = append(args, "-e", "REGISTRY_PROXY_USERNAME="+cfg.Username, "-e", "REGISTRY_PROXY_PASSWORD")
+		}
+		cmd := dockerCommand(ctx, append(args, registryMirrorImage)...)
+		cmd.Env = append(os.Environ(), "REGISTRY_PROXY_PASSWORD="+cfg.ResolveToken())
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to start registry mirror: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	// Sessions using the mirror lost it if it was recreated
+	if policy, err := config.LoadPolicy(); err != nil || policy.BlocksEgress() {
+		return err
+	}
+	output, err = dockerCommand(ctx, "ps", "-a", "--filter", "label="+LabelUsesRegistryMirror,
+		"--format", `{{.Label "worklet.session.id"}}`).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	for _, sessionID := range strings.Fields(string(output)) {
+		ConnectRegistryMirror(ctx, GetSessionNetworkName(sessionID))
+	}
+	return nil
+}
+
+// StopRegistryMirror removes the registry mirror container, keeping its
+// cache volume
+func StopRegistryMirror(ctx context.Context) error {
+	if !registryMirrorRunning(ctx) {
+		return nil
+	}
+	if output, err := dockerCommand(ctx, "rm", "-f", RegistryMirrorContainer).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove registry mirror: %s", strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// registryMirrorRunning reports whether the daemon's registry mirror is up
+func registryMirrorRunning(ctx context.Context) bool {
+	running, _ := registryMirrorState(ctx)
+	return running
+}
+
+// registryMirrorState reports whether the daemon's registry mirror is up,
+// and whether it pulls with the user's Docker Hub login
+func registryMirrorState(ctx context.Context) (running, authenticated bool) {
+	output, err := dockerCommand(ctx, "inspect", "--format",
+		`{{.State.Running}}{{range .Config.Env}} {{.}}{{end}}`, RegistryMirrorContainer).Output()
+	if err != nil {
+		return false, false
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 || fields[0] != "true" {
+		return false, false
+	}
+	for _, env := range fields[1:] {
+		if strings.HasPrefix(env, "REGISTRY_PROXY_USERNAME=") {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// ConnectRegistryMirror puts the registry mirror on a session network, so
+// the session's Docker daemon can reach it
+func ConnectRegistryMirror(ctx context.Context, network string) error {
+	output, err := dockerCommand(ctx, "network", "connect", network, RegistryMirrorContainer).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "already exists") {
+		return fmt.Errorf("failed to connect registry mirror to %s: %s", network, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// useRegistryMirror connects the registry mirror to a full isolation
+// session's network and returns the address its Docker daemon should use
+// it at, or "" if there's no mirror to use. A mirror pulling with the
+// user's Docker Hub login is only used by sessions given their registry
+// logins, and sessions cut off from outside by the policy don't get a way
+// out through it.
+func useRegistryMirror(ctx context.Context, opts RunOptions) string {
+	if isolationMode(opts.Config) != "full" {
+		return ""
+	}
+	running, authenticated := registryMirrorState(ctx)
+	if !running {
+		return ""
+	}
+	if authenticated && (opts.Config.Run.Credentials == nil || !opts.Config.Run.Credentials.DockerAuth) {
+		return ""
+	}
+	if policy, err := config.LoadPolicy(); err != nil || policy.BlocksEgress() {
+		return ""
+	}
+	if err := ConnectRegistryMirror(ctx, GetSessionNetworkName(opts.SessionID)); err != nil {
+		fmt.Fprintf(Output, "Warning: the session will pull images without the registry mirror: %v\n", err)
+		return ""
+	}
+	return registryMirrorAddress
+}
+
+// releaseRegistryMirror disconnects the registry mirror from a session
+// network when it's the last container left on it, so the network can be
+// removed. It returns the containers still connected.
+func releaseRegistryMirror(network string, containers []string) []string {
+	if len(containers) != 1 || containers[0] != RegistryMirrorContainer {
+		return containers
+	}
+	if dockerCommand(context.Background(), "network", "disconnect", "-f", network, RegistryMirrorContainer).Run() != nil {
+		return containers
+	}
+	return nil
+}
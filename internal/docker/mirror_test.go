@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestBuildRunArgsRegistryMirror(t *testing.T) {
+	opts := RunOptions{
+		WorkDir:        "/home/me/app",
+		Config:         &config.WorkletConfig{Name: "test", Run: config.RunConfig{Isolation: "full"}},
+		SessionID:      "abc123",
+		RegistryMirror: registryMirrorAddress,
+	}
+	args, err := buildRunArgs(opts, "worklet-app:abc123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `-e WORKLET_DOCKERD_CONFIG={"insecure-registries":["` + registryMirrorAddress + `"],"registry-mirrors":["http://` + registryMirrorAddress + `"]}`
+	if !strings.Contains(strings.Join(args, " "), expected) {
+		t.Errorf("expected the registry mirror in the Docker daemon options, got %v", args)
+	}
+	if !strings.Contains(strings.Join(args, " "), "--label "+LabelUsesRegistryMirror+"=true") {
+		t.Errorf("expected the session to be labeled as using the mirror, got %v", args)
+	}
+
+	opts.RegistryMirror = ""
+	args, err = buildRunArgs(opts, "worklet-app:abc123", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), "WORKLET_DOCKERD_CONFIG") || strings.Contains(strings.Join(args, " "), LabelUsesRegistryMirror) {
+		t.Errorf("expected no registry mirror without one running, got %v", args)
+	}
+}
+
+func TestRegistryMirrorHash(t *testing.T) {
+	anonymous := registryMirrorHash(config.RegistryMirrorConfig{Enabled: true})
+	if anonymous != registryMirrorHash(config.RegistryMirrorConfig{Enabled: true}) {
+		t.Error("expected the same settings to hash the same")
+	}
+	if anonymous == registryMirrorHash(config.RegistryMirrorConfig{Enabled: true, Username: "me", Token: "secret"}) {
+		t.Error("expected a login to change the hash, so the mirror is recreated")
+	}
+}
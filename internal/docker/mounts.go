@@ -0,0 +1,96 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// resolveMounts validates extra mounts and resolves their sources to
+// absolute host paths. Relative sources are resolved against workDir.
+func resolveMounts(workDir, containerWorkDir string, mounts []config.MountConfig) ([]config.MountConfig, error) {
+	resolved := make([]config.MountConfig, 0, len(mounts))
+	targets := map[string]bool{containerWorkDir: true}
+
+	for _, mount := range mounts {
+		source := config.HostPath(mount.Source)
+		if source == "~" || strings.HasPrefix(source, "~"+string(filepath.Separator)) {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get home directory: %w", err)
+			}
+			source = filepath.Join(homeDir, source[1:])
+		}
+		if !filepath.IsAbs(source) {
+			source = filepath.Join(workDir, source)
+		}
+		source = filepath.Clean(source)
+
+		if _, err := os.Stat(source); err != nil {
+			return nil, fmt.Errorf("mount source %s does not exist", source)
+		}
+
+		target := mount.Target
+		if !path.IsAbs(target) {
+			return nil, fmt.Errorf("mount target for %s must be an absolute path: %q", source, target)
+		}
+		target = path.Clean(target)
+		if target == "/" {
+			return nil, fmt.Errorf("mount target for %s cannot be /", source)
+		}
+		if targets[target] {
+			return nil, fmt.Errorf("mount target %s is used more than once", target)
+		}
+		targets[target] = true
+
+		resolved = append(resolved, config.MountConfig{Source: source, Target: target, ReadOnly: mount.ReadOnly, Consistency: mount.Consistency})
+	}
+
+	return resolved, nil
+}
+
+// mountArg formats a mount as a docker -v value
+func mountArg(mount config.MountConfig) string {
+	arg := fmt.Sprintf("%s:%s", mount.Source, mount.Target)
+	var options []string
+	if mount.ReadOnly {
+		options = append(options, "ro")
+	}
+	if mount.Consistency != "" {
+		options = append(options, mount.Consistency)
+	}
+	if len(options) > 0 {
+		arg += ":" + strings.Join(options, ",")
+	}
+	return arg
+}
+
+// remoteDockerHost returns the daemon address if Docker commands go to
+// another machine, in which case host paths refer to that machine's
+// filesystem. It returns "" for local daemons.
+func remoteDockerHost() string {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = dockerContextHost()
+	}
+
+	if host == "" || strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://") {
+		return ""
+	}
+	return host
+}
+
+// dockerContextHost returns the daemon address of the current docker
+// context, or "" if the docker CLI can't tell
+func dockerContextHost() string {
+	output, err := dockerCommand(context.Background(), "context", "inspect", "--format", "{{.Endpoints.docker.Host}}").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
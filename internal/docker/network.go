@@ -1,10 +1,14 @@
 package docker
 
 import (
+	"context"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
+
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+	"github.com/nolanleung/worklet/internal/config"
 )
 
 const WorkletNetworkName = "worklet-network"
@@ -30,7 +34,7 @@ func EnsureNetworkExists() error {
 func EnsureSessionNetworkExists(sessionID string) error {
 	networkName := fmt.Sprintf("worklet-%s", sessionID)
 	
-	fmt.Printf("Ensuring Docker network '%s' exists...\n", networkName)
+	fmt.Fprintf(Output, "Ensuring Docker network '%s' exists...\n", networkName)
 
 	// Check if network exists
 	exists, err := NetworkExists(networkName)
@@ -39,18 +43,18 @@ func EnsureSessionNetworkExists(sessionID string) error {
 	}
 
 	if exists {
-		fmt.Printf("Network '%s' already exists\n", networkName)
+		fmt.Fprintf(Output, "Network '%s' already exists\n", networkName)
 		return nil
 	}
 
 	// Create the network with retry logic
-	fmt.Printf("Creating Docker network '%s'...\n", networkName)
+	fmt.Fprintf(Output, "Creating Docker network '%s'...\n", networkName)
 	
 	var lastErr error
 	for i := 0; i < 3; i++ {
-		if err := CreateNetwork(networkName); err != nil {
+		if err := createSessionNetwork(networkName); err != nil {
 			lastErr = err
-			fmt.Printf("Attempt %d: Failed to create network: %v\n", i+1, err)
+			fmt.Fprintf(Output, "Attempt %d: Failed to create network: %v\n", i+1, err)
 			// Small delay before retry
 			time.Sleep(500 * time.Millisecond)
 			continue
@@ -64,7 +68,7 @@ func EnsureSessionNetworkExists(sessionID string) error {
 		}
 		
 		if exists {
-			fmt.Printf("Successfully created network '%s'\n", networkName)
+			fmt.Fprintf(Output, "Successfully created network '%s'\n", networkName)
 			return nil
 		}
 		
@@ -101,6 +105,7 @@ func RemoveSessionNetworkSafe(sessionID string) error {
 		// If we can't list containers, don't remove the network to be safe
 		return fmt.Errorf("failed to list network containers: %w", err)
 	}
+	containers = releaseRegistryMirror(networkName, containers)
 	
 	if len(containers) > 0 {
 		// Network still has connected containers, don't remove
@@ -118,15 +123,19 @@ func GetSessionNetworkName(sessionID string) string {
 
 // NetworkExists checks if a Docker network exists
 func NetworkExists(networkName string) (bool, error) {
-	cmd := exec.Command("docker", "network", "ls", "--format", "{{.Name}}")
-	output, err := cmd.Output()
+	rt, err := NewRuntime()
+	if err != nil {
+		return false, err
+	}
+	defer rt.Close()
+
+	networks, err := rt.NetworkList(context.Background(), network.ListOptions{})
 	if err != nil {
 		return false, fmt.Errorf("failed to list networks: %w", err)
 	}
 
-	networks := strings.Split(string(output), "\n")
-	for _, network := range networks {
-		if strings.TrimSpace(network) == networkName {
+	for _, existing := range networks {
+		if existing.Name == networkName {
 			return true, nil
 		}
 	}
@@ -134,27 +143,52 @@ func NetworkExists(networkName string) (bool, error) {
 	return false, nil
 }
 
-// CreateNetwork creates a Docker network
-func CreateNetwork(networkName string) error {
-	cmd := exec.Command("docker", "network", "create", networkName)
-	output, err := cmd.CombinedOutput()
+// NetworkGateway returns the IPv4 gateway of a Docker network, the host's
+// address on it
+func NetworkGateway(networkName string) (string, error) {
+	cmd := dockerCommand(context.Background(), "network", "inspect", "-f", "{{range .IPAM.Config}}{{.Gateway}} {{end}}", networkName)
+	output, err := cmd.Output()
 	if err != nil {
-		return fmt.Errorf("failed to create network: %w\nOutput: %s", err, string(output))
+		return "", fmt.Errorf("failed to inspect network %s: %w", networkName, err)
 	}
+	for _, gateway := range strings.Fields(string(output)) {
+		if !strings.Contains(gateway, ":") {
+			return gateway, nil
+		}
+	}
+	return "", fmt.Errorf("network %s has no IPv4 gateway", networkName)
+}
 
-	return nil
+// CreateNetwork creates a Docker network, with IPv6 where it's enabled
+func CreateNetwork(networkName string) error {
+	return createNetwork(context.Background(), networkName, false)
+}
+
+// createSessionNetwork creates a session's network, internal when the
+// policy blocks egress. Sessions still reach each other and the proxy,
+// which joins each session network.
+func createSessionNetwork(networkName string) error {
+	policy, err := config.LoadPolicy()
+	if err != nil {
+		return err
+	}
+	return createNetwork(context.Background(), networkName, policy.BlocksEgress())
 }
 
 // RemoveNetwork removes a Docker network
 func RemoveNetwork(networkName string) error {
-	cmd := exec.Command("docker", "network", "rm", networkName)
-	output, err := cmd.CombinedOutput()
+	rt, err := NewRuntime()
 	if err != nil {
-		// Check if the error is because the network doesn't exist
-		if strings.Contains(string(output), "not found") {
+		return err
+	}
+	defer rt.Close()
+
+	if err := rt.NetworkRemove(context.Background(), networkName); err != nil {
+		// The network may not exist
+		if errdefs.IsNotFound(err) {
 			return nil
 		}
-		return fmt.Errorf("failed to remove network: %w\nOutput: %s", err, string(output))
+		return fmt.Errorf("failed to remove network: %w", err)
 	}
 
 	return nil
@@ -162,47 +196,58 @@ func RemoveNetwork(networkName string) error {
 
 // ListNetworkContainers lists containers connected to a network
 func ListNetworkContainers(networkName string) ([]string, error) {
-	// Use docker network inspect to get connected containers
-	cmd := exec.Command("docker", "network", "inspect", networkName, "--format", "{{range .Containers}}{{.Name}} {{end}}")
-	output, err := cmd.Output()
+	rt, err := NewRuntime()
+	if err != nil {
+		return nil, err
+	}
+	defer rt.Close()
+
+	inspect, err := rt.NetworkInspect(context.Background(), networkName, network.InspectOptions{})
 	if err != nil {
 		// Network might not exist
 		return nil, nil
 	}
 
-	containerNames := strings.Fields(string(output))
+	var containerNames []string
+	for _, endpoint := range inspect.Containers {
+		containerNames = append(containerNames, endpoint.Name)
+	}
 	return containerNames, nil
 }
 
 // CleanupOrphanedNetworks removes all worklet networks that have no connected containers
 func CleanupOrphanedNetworks() (int, error) {
+	rt, err := NewRuntime()
+	if err != nil {
+		return 0, err
+	}
+	defer rt.Close()
+
 	// List all networks
-	cmd := exec.Command("docker", "network", "ls", "--format", "{{.Name}}")
-	output, err := cmd.Output()
+	networks, err := rt.NetworkList(context.Background(), network.ListOptions{})
 	if err != nil {
 		return 0, fmt.Errorf("failed to list networks: %w", err)
 	}
 	
-	networks := strings.Split(string(output), "\n")
 	removedCount := 0
 	
-	for _, network := range networks {
-		network = strings.TrimSpace(network)
+	for _, nw := range networks {
 		// Only process worklet session networks (worklet-* pattern)
-		if !strings.HasPrefix(network, "worklet-") || network == "worklet-network" {
+		if !strings.HasPrefix(nw.Name, "worklet-") || nw.Name == "worklet-network" {
 			continue
 		}
 		
 		// Check for connected containers
-		containers, err := ListNetworkContainers(network)
+		containers, err := ListNetworkContainers(nw.Name)
 		if err != nil {
 			// Skip if we can't check
 			continue
 		}
+		containers = releaseRegistryMirror(nw.Name, containers)
 		
 		if len(containers) == 0 {
 			// No containers connected, safe to remove
-			if err := RemoveNetwork(network); err == nil {
+			if err := RemoveNetwork(nw.Name); err == nil {
 				removedCount++
 			}
 		}
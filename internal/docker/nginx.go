@@ -1,13 +1,19 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
@@ -16,33 +22,65 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/nginx"
+	"github.com/nolanleung/worklet/internal/storage"
+	"github.com/nolanleung/worklet/internal/trace"
 )
 
 const (
 	nginxContainerName = "worklet-nginx-proxy"
-	nginxImage         = "nginx:alpine"
+	nginxImage         = "nginx:1.28-alpine" // Fork upstreams' "server ... resolve" needs nginx 1.27.3+
 	nginxConfigDir     = "/etc/nginx"
 	nginxConfigFile    = "nginx.conf"
+
+	// Suffix of a fork's include files while nginx rejects them
+	disabledSuffix = ".disabled"
+
+	// Directory, relative to the config directory, an update is written
+	// to and tested in before it replaces the files nginx loads
+	nginxStagingDir = "staging"
 )
 
-// NginxManager handles nginx proxy container operations
+// NginxConfigError is returned when nginx rejects a new config for reasons
+// other than one fork's include file. The proxy keeps serving the last config
+// it loaded.
+type NginxConfigError struct {
+	Output     string // nginx's explanation
+	RolledBack bool   // The config was swapped in and reverted after the reload failed
+}
+
+func (e *NginxConfigError) Error() string {
+	if e.RolledBack {
+		return fmt.Sprintf("nginx failed to reload the new config, rolled back to the last good one: %s", e.Output)
+	}
+	return fmt.Sprintf("nginx rejected the new config, keeping the current one: %s", e.Output)
+}
+
+// NginxManager handles nginx proxy container operations. Without a Docker
+// client, as with the fake runtime, it only writes the config.
 type NginxManager struct {
 	client     *client.Client
-	configPath string // Host path where nginx config is stored
+	configPath string       // Host path where nginx config is stored
+	updateMu   sync.Mutex   // Serializes config updates, which share the staging directory
+	ipv6       atomic.Bool  // The container has IPv6, so nginx can listen on it
+	httpPort   atomic.Int32 // Host port HTTP is published on
 }
 
-// NewNginxManager creates a new nginx manager
-func NewNginxManager(configPath string) (*NginxManager, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+// NewNginxManager creates a new nginx manager running the proxy through rt
+func NewNginxManager(configPath string, rt Runtime) (*NginxManager, error) {
+	// Ensure config directory exists, with the forks' include directories
+	for _, dir := range []string{configPath, filepath.Join(configPath, nginx.HTTPIncludeDir), filepath.Join(configPath, nginx.StreamIncludeDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create config directory: %w", err)
+		}
 	}
 
-	// Ensure config directory exists
-	if err := os.MkdirAll(configPath, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create config directory: %w", err)
-	}
+	// Creating the proxy container needs more of the Docker API than
+	// Runtime has, which only a real client provides
+	cli, _ := rt.(*client.Client)
 
 	return &NginxManager{
 		client:     cli,
@@ -50,8 +88,17 @@ func NewNginxManager(configPath string) (*NginxManager, error) {
 	}, nil
 }
 
+// ActivityLogPath returns the host path of nginx's activity log
+func (nm *NginxManager) ActivityLogPath() string {
+	return filepath.Join(nm.configPath, nginx.ActivityLogFile)
+}
+
 // Start starts the nginx proxy container
 func (nm *NginxManager) Start(ctx context.Context) error {
+	if nm.client == nil {
+		return nil
+	}
+
 	// Check if container already exists
 	exists, _, err := nm.containerStatus(ctx)
 	if err != nil {
@@ -70,22 +117,138 @@ func (nm *NginxManager) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to pull nginx image: %w", err)
 	}
 
-	// Create and start new container
+	ipv6 := IPv6Enabled()
+	httpPort, err := nm.createOnFreePort(ctx, ipv6)
+	if err != nil && ipv6 {
+		// Docker may not be able to publish ports on IPv6 even though the
+		// host has it
+		log.Printf("Failed to start nginx with IPv6 ports, retrying IPv4-only: %v", err)
+		if err := nm.Remove(ctx); err != nil {
+			return fmt.Errorf("failed to remove nginx container: %w", err)
+		}
+		httpPort, err = nm.createOnFreePort(ctx, false)
+	}
+	if err != nil {
+		return err
+	}
+	nm.httpPort.Store(int32(httpPort))
+	if err := config.SaveProxyHTTPPort(httpPort); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Ensure the main worklet network exists and connect to it
+	if err := EnsureNetworkExists(); err != nil {
+		log.Printf("Warning: failed to ensure main worklet network exists: %v", err)
+	}
+	
+	// Connect to the main worklet network first
+	if err := nm.ConnectToNetwork(ctx, WorkletNetworkName); err != nil {
+		log.Printf("Warning: failed to connect to main worklet network: %v", err)
+	}
+
+	// Connect to all existing session networks
+	if err := nm.EnsureConnectedToAllNetworks(ctx); err != nil {
+		log.Printf("Warning: failed to connect to all networks: %v", err)
+	}
+
+	// nginx fails to start with IPv6 listeners where the container has no
+	// IPv6, so only use them once its networks give it some
+	nm.ipv6.Store(false)
+	if ipv6 {
+		exitCode, _, err := nm.execInContainer(ctx, "test", "-s", "/proc/net/if_inet6")
+		nm.ipv6.Store(err == nil && exitCode == 0)
+	}
+
+	return nil
+}
+
+// IPv6 reports whether nginx can listen on IPv6 in the proxy container
+func (nm *NginxManager) IPv6() bool {
+	return nm.ipv6.Load()
+}
+
+// HTTPPort returns the host port the proxy serves session URLs on
+func (nm *NginxManager) HTTPPort() int {
+	if port := nm.httpPort.Load(); port != 0 {
+		return int(port)
+	}
+	return config.DefaultHTTPPort
+}
+
+// createOnFreePort creates and starts the proxy container serving HTTP on
+// port 80, or on the first fallback port that can be bound if 80 can't, as
+// happens without root or when another server has it. It returns the port.
+func (nm *NginxManager) createOnFreePort(ctx context.Context, ipv6 bool) (int, error) {
+	var err error
+	for _, port := range append([]int{config.DefaultHTTPPort}, nginx.FallbackHTTPPorts...) {
+		if err = nm.create(ctx, ipv6, port); err == nil {
+			if port != config.DefaultHTTPPort {
+				log.Printf("Serving session URLs on port %d as port %d couldn't be bound", port, config.DefaultHTTPPort)
+			}
+			return port, nil
+		}
+		if !isPortBindError(err, port) {
+			return 0, err
+		}
+		log.Printf("Can't publish the nginx proxy on port %d: %v", port, err)
+		if err := nm.Remove(ctx); err != nil {
+			return 0, fmt.Errorf("failed to remove nginx container: %w", err)
+		}
+	}
+	return 0, err
+}
+
+// isPortBindError reports whether err is Docker failing to bind port on
+// the host
+func isPortBindError(err error, port int) bool {
+	msg := strings.ToLower(err.Error())
+	if !strings.Contains(msg, fmt.Sprintf(":%d:", port)) && !strings.Contains(msg, fmt.Sprintf(":%d ", port)) &&
+		!strings.Contains(msg, fmt.Sprintf("privileged port %d", port)) {
+		return false
+	}
+	return strings.Contains(msg, "bind") || strings.Contains(msg, "already allocated") || strings.Contains(msg, "privileged port")
+}
+
+// create creates and starts the proxy container, publishing HTTP on
+// httpPort, and its ports on IPv6 too if ipv6 is set
+func (nm *NginxManager) create(ctx context.Context, ipv6 bool, httpPort int) error {
 	containerConfig := &container.Config{
 		Image: nginxImage,
 		Labels: map[string]string{
 			"worklet.nginx": "true",
 		},
+		ExposedPorts: nat.PortSet{},
+	}
+
+	portBindings := nat.PortMap{
+		"80/tcp": []nat.PortBinding{
+			{HostIP: "0.0.0.0", HostPort: fmt.Sprint(httpPort)},
+		},
+	}
+	if ipv6 {
+		portBindings["80/tcp"] = append(portBindings["80/tcp"], nat.PortBinding{HostIP: "::", HostPort: fmt.Sprint(httpPort)})
+	}
+
+	// TCP and UDP services are reached on localhost only
+	for port := nginx.StreamPortFirst; port <= nginx.StreamPortLast; port++ {
+		for _, proto := range []string{"tcp", "udp"} {
+			natPort := nat.Port(fmt.Sprintf("%d/%s", port, proto))
+			containerConfig.ExposedPorts[natPort] = struct{}{}
+			portBindings[natPort] = []nat.PortBinding{
+				{HostIP: "127.0.0.1", HostPort: fmt.Sprint(port)},
+			}
+			if ipv6 {
+				portBindings[natPort] = append(portBindings[natPort], nat.PortBinding{HostIP: "::1", HostPort: fmt.Sprint(port)})
+			}
+		}
 	}
 
 	hostConfig := &container.HostConfig{
 		// Use default bridge network mode to allow port binding
 		// The container will be connected to WorkletNetworkName after creation
-		PortBindings: nat.PortMap{
-			"80/tcp": []nat.PortBinding{
-				{HostIP: "0.0.0.0", HostPort: "80"},
-			},
-		},
+		PortBindings: portBindings,
+		// Lets nginx reach the daemon's interceptor for 'worklet tap' and 'worklet chaos'
+		ExtraHosts: []string{"host.docker.internal:host-gateway"},
 		Mounts: []mount.Mount{
 			{
 				Type:   mount.TypeBind,
@@ -106,22 +269,6 @@ func (nm *NginxManager) Start(ctx context.Context) error {
 	if err := nm.client.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
 		return fmt.Errorf("failed to start nginx container: %w", err)
 	}
-
-	// Ensure the main worklet network exists and connect to it
-	if err := EnsureNetworkExists(); err != nil {
-		log.Printf("Warning: failed to ensure main worklet network exists: %v", err)
-	}
-	
-	// Connect to the main worklet network first
-	if err := nm.ConnectToNetwork(ctx, WorkletNetworkName); err != nil {
-		log.Printf("Warning: failed to connect to main worklet network: %v", err)
-	}
-
-	// Connect to all existing session networks
-	if err := nm.EnsureConnectedToAllNetworks(ctx); err != nil {
-		log.Printf("Warning: failed to connect to all networks: %v", err)
-	}
-
 	return nil
 }
 
@@ -160,6 +307,10 @@ func (nm *NginxManager) Remove(ctx context.Context) error {
 
 // ConnectToNetwork connects the nginx container to a specific network
 func (nm *NginxManager) ConnectToNetwork(ctx context.Context, networkName string) error {
+	if nm.client == nil {
+		return nil
+	}
+
 	exists, _, err := nm.containerStatus(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check container status: %w", err)
@@ -194,6 +345,10 @@ func (nm *NginxManager) ConnectToNetwork(ctx context.Context, networkName string
 
 // EnsureConnectedToAllNetworks ensures nginx is connected to all worklet session networks
 func (nm *NginxManager) EnsureConnectedToAllNetworks(ctx context.Context) error {
+	if nm.client == nil {
+		return nil
+	}
+
 	// List all networks
 	networks, err := nm.client.NetworkList(ctx, network.ListOptions{})
 	if err != nil {
@@ -213,7 +368,10 @@ func (nm *NginxManager) EnsureConnectedToAllNetworks(ctx context.Context) error
 }
 
 // Reload reloads the nginx configuration
-func (nm *NginxManager) Reload(ctx context.Context) error {
+func (nm *NginxManager) Reload(ctx context.Context) (err error) {
+	ctx, endSpan := trace.StartSpan(ctx, "nginx reload")
+	defer func() { endSpan(err) }()
+	
 	exists, running, err := nm.containerStatus(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to check container status: %w", err)
@@ -229,102 +387,328 @@ func (nm *NginxManager) Reload(ctx context.Context) error {
 	}
 
 	// Execute nginx reload command
-	exec, err := nm.client.ContainerExecCreate(ctx, nginxContainerName, container.ExecOptions{
-		Cmd:          []string{"nginx", "-s", "reload"},
-		AttachStdout: true,
-		AttachStderr: true,
-	})
+	exitCode, output, err := nm.execNginx(ctx, "-s", "reload")
 	if err != nil {
-		return fmt.Errorf("failed to create exec: %w", err)
+		return err
 	}
 
-	// Attach to exec to capture output
-	attach, err := nm.client.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to attach to exec: %w", err)
+	// Check if reload was successful
+	if exitCode != 0 {
+		return fmt.Errorf("nginx reload failed with exit code %d: %s", exitCode, string(output))
 	}
-	defer attach.Close()
 
-	// Start the exec
-	if err := nm.client.ContainerExecStart(ctx, exec.ID, container.ExecStartOptions{}); err != nil {
-		return fmt.Errorf("failed to start nginx reload: %w", err)
+	// Log successful reload
+	if len(output) > 0 {
+		log.Printf("nginx reload output: %s", string(output))
+	} else {
+		log.Printf("nginx configuration reloaded successfully")
+	}
+
+	return nil
+}
+
+// WriteFixtures writes the fixture files of route overrides, keyed by path
+// relative to the config directory, and removes fixtures no longer used
+func (nm *NginxManager) WriteFixtures(files map[string][]byte) error {
+	dir := filepath.Join(nm.configPath, nginx.FixturesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create fixtures directory: %w", err)
 	}
 
-	// Read output
-	output, err := io.ReadAll(attach.Reader)
+	for name, content := range files {
+		if err := storage.WriteFileAtomic(filepath.Join(nm.configPath, name), content, 0644); err != nil {
+			return fmt.Errorf("failed to write fixture: %w", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read reload output: %w", err)
+		return fmt.Errorf("failed to read fixtures directory: %w", err)
+	}
+	for _, entry := range entries {
+		if _, used := files[filepath.ToSlash(filepath.Join(nginx.FixturesDir, entry.Name()))]; !used {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
 	}
+	return nil
+}
 
-	// Inspect exec to check exit code
-	inspectResp, err := nm.client.ContainerExecInspect(ctx, exec.ID)
+// UpdateConfig writes the nginx configuration, the main config and each
+// fork's include files, and reloads. Only files that changed are written, and
+// nginx isn't reloaded if none did. While nginx is running the files are
+// staged and checked with nginx -t before they're swapped in: a fork whose
+// include file nginx rejects is disabled without touching other sessions'
+// routes, and returned with nginx's explanation. Any other rejection leaves
+// the files nginx loads alone, and a failed reload puts them back as they
+// were; the error is then a *NginxConfigError.
+func (nm *NginxManager) UpdateConfig(ctx context.Context, configs nginx.Configs) (map[string]string, error) {
+	nm.updateMu.Lock()
+	defer nm.updateMu.Unlock()
+
+	// The config serves this page while a session isn't answering
+	pageFile := filepath.Join(nm.configPath, nginx.UnavailablePageFile)
+	if err := storage.WriteFileAtomic(pageFile, []byte(nginx.UnavailablePage), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write nginx unavailable page: %w", err)
+	}
+
+	files := make(map[string]string, len(configs.Files)+1)
+	for name, content := range configs.Files {
+		files[name] = content
+	}
+	files[nginxConfigFile] = configs.Main
+
+	// Reload nginx if running
+	exists, running, err := nm.containerStatus(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to inspect exec: %w", err)
+		return nil, fmt.Errorf("failed to check container status: %w", err)
 	}
 
-	// Check if reload was successful
-	if inspectResp.ExitCode != 0 {
-		return fmt.Errorf("nginx reload failed with exit code %d: %s", inspectResp.ExitCode, string(output))
+	if !exists || !running {
+		if _, err := syncConfig(nm.configPath, files, nil, nil); err != nil {
+			return nil, err
+		}
+		log.Printf("nginx container not running, config updated but not reloaded")
+		return nil, nil
 	}
 
-	// Log successful reload
-	if len(output) > 0 {
-		log.Printf("nginx reload output: %s", string(output))
-	} else {
-		log.Printf("nginx configuration reloaded successfully")
+	return syncConfig(nm.configPath, files,
+		func() (string, error) {
+			return nm.testConfig(ctx, path.Join(nginxConfigDir, nginxStagingDir, nginxConfigFile))
+		},
+		func() error { return nm.reloadWithRetries(ctx) })
+}
+
+// configFile is the state of a file in the config directory before an update
+type configFile struct {
+	content []byte
+	existed bool
+}
+
+// configUpdate tracks the files an update changes so they can be put back
+type configUpdate struct {
+	dir      string
+	previous map[string]configFile // By path relative to dir
+}
+
+// track records a file's content before it is first changed
+func (u *configUpdate) track(name string) {
+	if _, ok := u.previous[name]; ok {
+		return
 	}
+	content, err := os.ReadFile(filepath.Join(u.dir, filepath.FromSlash(name)))
+	u.previous[name] = configFile{content: content, existed: err == nil}
+}
 
+func (u *configUpdate) write(name, content string) error {
+	u.track(name)
+	file := filepath.Join(u.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := storage.WriteFileAtomic(file, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write nginx config: %w", err)
+	}
 	return nil
 }
 
-// UpdateConfig writes a new nginx configuration and reloads
-func (nm *NginxManager) UpdateConfig(ctx context.Context, config string) error {
-	configFile := filepath.Join(nm.configPath, nginxConfigFile)
+func (u *configUpdate) remove(name string) error {
+	u.track(name)
+	if err := os.Remove(filepath.Join(u.dir, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove nginx config: %w", err)
+	}
+	return nil
+}
 
-	// Write config to file
-	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
-		return fmt.Errorf("failed to write nginx config: %w", err)
+// restore puts back every file the update changed
+func (u *configUpdate) restore() {
+	for name, previous := range u.previous {
+		file := filepath.Join(u.dir, filepath.FromSlash(name))
+		if previous.existed {
+			if err := storage.WriteFileAtomic(file, previous.content, 0644); err != nil {
+				log.Printf("Failed to restore nginx config %s: %v", name, err)
+			}
+		} else {
+			os.Remove(file)
+		}
+	}
+}
+
+// rejectedInclude finds the include file nginx -t blames in its output,
+// live or staged
+var rejectedInclude = regexp.MustCompile(`/etc/nginx/(?:` + regexp.QuoteMeta(nginxStagingDir) + `/)?((?:` +
+	regexp.QuoteMeta(nginx.HTTPIncludeDir) + `|` + regexp.QuoteMeta(nginx.StreamIncludeDir) + `)/[^/:\s]+\.conf):\d+`)
+
+// syncConfig makes the config directory hold files, keyed by path relative
+// to it, removing include files of forks that are gone. Given test and
+// reload, the files are first written to the staging directory, where test
+// checks them: forks whose include files test rejects are left out, and
+// returned with the rejection, and anything else test rejects leaves the
+// config directory as it was. Only then are the files swapped in, with the
+// rejected forks' include files set aside, and nginx reloaded; if the
+// reload fails, the files are put back.
+func syncConfig(dir string, files map[string]string, test func() (string, error), reload func() error) (map[string]string, error) {
+	var stale []string
+	for _, includeDir := range []string{nginx.HTTPIncludeDir, nginx.StreamIncludeDir} {
+		entries, err := os.ReadDir(filepath.Join(dir, includeDir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := path.Join(includeDir, entry.Name())
+			if _, ok := files[name]; !ok && !entry.IsDir() {
+				stale = append(stale, name)
+			}
+		}
+	}
+	changed := len(stale) > 0
+	for name, content := range files {
+		current, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(current) != content {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
 	}
 
-	log.Printf("Updated nginx config file: %s", configFile)
+	disabled := make(map[string]string)
+	if test != nil {
+		staging := filepath.Join(dir, nginxStagingDir)
+		if err := stageConfig(staging, files); err != nil {
+			os.RemoveAll(staging)
+			return nil, err
+		}
+		defer os.RemoveAll(staging)
 
-	// Reload nginx if running
-	exists, running, err := nm.containerStatus(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to check container status: %w", err)
+		for {
+			rejection, err := test()
+			if err != nil {
+				return nil, fmt.Errorf("failed to check nginx config: %w", err)
+			}
+			if rejection == "" {
+				break
+			}
+			rejection = strings.ReplaceAll(rejection, path.Join(nginxConfigDir, nginxStagingDir)+"/", nginxConfigDir+"/")
+
+			var forkID string
+			if match := rejectedInclude.FindStringSubmatch(rejection); match != nil {
+				forkID = nginx.IncludeForkID(match[1])
+			}
+			if _, done := disabled[forkID]; forkID == "" || done {
+				return nil, &NginxConfigError{Output: rejection}
+			}
+			log.Printf("nginx rejected the config of fork %s, disabling it: %s", forkID, rejection)
+			for _, includeDir := range []string{nginx.HTTPIncludeDir, nginx.StreamIncludeDir} {
+				os.Remove(filepath.Join(staging, includeDir, forkID+".conf"))
+			}
+			disabled[forkID] = rejection
+		}
 	}
 
-	if exists && running {
-		// Add a small delay to allow containers to fully start
-		// This helps avoid DNS resolution issues when nginx reloads
-		time.Sleep(3 * time.Second)
-		
-		log.Printf("Reloading nginx configuration...")
-		
-		// Try to reload with retries
-		var lastErr error
-		for i := 0; i < 3; i++ {
-			if err := nm.Reload(ctx); err != nil {
-				lastErr = err
-				log.Printf("nginx reload attempt %d failed: %v", i+1, err)
-				if i < 2 {
-					time.Sleep(2 * time.Second)
-				}
-			} else {
-				// Success
-				return nil
+	// Swap the tested files in; a disabled fork's include files are moved
+	// aside, where nginx doesn't include them but they can be inspected
+	update := &configUpdate{dir: dir, previous: make(map[string]configFile)}
+	for name, content := range files {
+		if _, off := disabled[nginx.IncludeForkID(name)]; off {
+			if err := update.write(name+disabledSuffix, content); err != nil {
+				update.restore()
+				return nil, err
+			}
+			if err := update.remove(name); err != nil {
+				update.restore()
+				return nil, err
 			}
+			continue
+		}
+		current, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil && string(current) == content {
+			continue
+		}
+		if err := update.write(name, content); err != nil {
+			update.restore()
+			return nil, err
 		}
-		
-		return fmt.Errorf("failed to reload nginx after 3 attempts: %w", lastErr)
+	}
+	for _, name := range stale {
+		if err := update.remove(name); err != nil {
+			update.restore()
+			return nil, err
+		}
+	}
+
+	if len(update.previous) == 0 || test == nil {
+		return nil, nil
 	}
 
-	log.Printf("nginx container not running, config updated but not reloaded")
+	log.Printf("Updated %d nginx config file(s) in %s", len(update.previous), dir)
+	if err := reload(); err != nil {
+		update.restore()
+		log.Printf("Rolled back the nginx config")
+		if reloadErr := reload(); reloadErr != nil {
+			log.Printf("Failed to reload the previous nginx config: %v", reloadErr)
+		}
+		return nil, &NginxConfigError{Output: err.Error(), RolledBack: true}
+	}
+	return disabled, nil
+}
+
+// stageConfig writes files to the staging directory, with the main
+// config's includes pointing at the staged include files
+func stageConfig(staging string, files map[string]string) error {
+	if err := os.RemoveAll(staging); err != nil {
+		return fmt.Errorf("failed to clear nginx staging directory: %w", err)
+	}
+	for name, content := range files {
+		if name == nginxConfigFile {
+			for _, includeDir := range []string{nginx.HTTPIncludeDir, nginx.StreamIncludeDir} {
+				content = strings.ReplaceAll(content,
+					"include "+path.Join(nginxConfigDir, includeDir)+"/",
+					"include "+path.Join(nginxConfigDir, nginxStagingDir, includeDir)+"/")
+			}
+		}
+		file := filepath.Join(staging, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return fmt.Errorf("failed to create nginx staging directory: %w", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to stage nginx config: %w", err)
+		}
+	}
 	return nil
 }
 
+// reloadWithRetries reloads nginx, retrying a few times
+func (nm *NginxManager) reloadWithRetries(ctx context.Context) error {
+	// Add a small delay to allow containers to fully start
+	// This helps avoid DNS resolution issues when nginx reloads
+	time.Sleep(3 * time.Second)
+
+	log.Printf("Reloading nginx configuration...")
+
+	// Try to reload with retries
+	var lastErr error
+	for i := 0; i < 3; i++ {
+		if err := nm.Reload(ctx); err != nil {
+			lastErr = err
+			log.Printf("nginx reload attempt %d failed: %v", i+1, err)
+			if i < 2 {
+				time.Sleep(2 * time.Second)
+			}
+		} else {
+			// Success
+			return nil
+		}
+	}
+
+	return fmt.Errorf("failed to reload nginx after 3 attempts: %w", lastErr)
+}
+
 // containerStatus checks if the nginx container exists and is running
 func (nm *NginxManager) containerStatus(ctx context.Context) (exists bool, running bool, err error) {
+	if nm.client == nil {
+		return false, false, nil
+	}
+
 	filterArgs := filters.NewArgs()
 	filterArgs.Add("name", nginxContainerName)
 
@@ -356,8 +740,51 @@ func (nm *NginxManager) GetConfigPath() string {
 	return filepath.Join(nm.configPath, nginxConfigFile)
 }
 
+// ReadConfig returns the main config followed by the forks' include files
+// nginx loads, as one text
+func (nm *NginxManager) ReadConfig() (string, error) {
+	return ReadNginxConfig(nm.configPath)
+}
+
+// ReadNginxConfig returns the main config in dir followed by the forks'
+// include files nginx loads, as one text
+func ReadNginxConfig(dir string) (string, error) {
+	main, err := os.ReadFile(filepath.Join(dir, nginxConfigFile))
+	if err != nil {
+		return "", err
+	}
+	config := string(main)
+	for _, includeDir := range []string{nginx.HTTPIncludeDir, nginx.StreamIncludeDir} {
+		includes, _ := filepath.Glob(filepath.Join(dir, includeDir, "*.conf"))
+		sort.Strings(includes)
+		for _, include := range includes {
+			if data, err := os.ReadFile(include); err == nil {
+				config += fmt.Sprintf("\n# %s/%s\n%s", includeDir, filepath.Base(include), data)
+			}
+		}
+	}
+	return config, nil
+}
+
+// testConfig checks the config at file, a path in the container, with
+// nginx -t, returning nginx's explanation if it's rejected
+func (nm *NginxManager) testConfig(ctx context.Context, file string) (string, error) {
+	exitCode, output, err := nm.execNginx(ctx, "-t", "-q", "-c", file)
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return strings.TrimSpace(string(output)), nil
+	}
+	return "", nil
+}
+
 // IsHealthy checks if the nginx container is running and healthy
 func (nm *NginxManager) IsHealthy(ctx context.Context) (bool, error) {
+	if nm.client == nil {
+		return true, nil
+	}
+
 	exists, running, err := nm.containerStatus(ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to check container status: %w", err)
@@ -368,38 +795,57 @@ func (nm *NginxManager) IsHealthy(ctx context.Context) (bool, error) {
 	}
 
 	// Check if nginx process is responding by testing config
+	exitCode, _, err := nm.execNginx(ctx, "-t")
+	if err != nil {
+		return false, err
+	}
+
+	// nginx -t returns 0 if config is valid and nginx is healthy
+	return exitCode == 0, nil
+}
+
+// execNginx runs nginx with args in the proxy container and returns its exit
+// code and combined output
+func (nm *NginxManager) execNginx(ctx context.Context, args ...string) (int, []byte, error) {
+	return nm.execInContainer(ctx, append([]string{"nginx"}, args...)...)
+}
+
+// execInContainer runs a command in the proxy container and returns its exit
+// code and combined output
+func (nm *NginxManager) execInContainer(ctx context.Context, cmd ...string) (int, []byte, error) {
 	exec, err := nm.client.ContainerExecCreate(ctx, nginxContainerName, container.ExecOptions{
-		Cmd:          []string{"nginx", "-t"},
+		Cmd:          cmd,
 		AttachStdout: true,
 		AttachStderr: true,
 	})
 	if err != nil {
-		return false, fmt.Errorf("failed to create exec for health check: %w", err)
+		return 0, nil, fmt.Errorf("failed to create exec: %w", err)
 	}
 
-	// Attach to exec
+	// Attach to exec to capture output
 	attach, err := nm.client.ContainerExecAttach(ctx, exec.ID, container.ExecAttachOptions{})
 	if err != nil {
-		return false, fmt.Errorf("failed to attach to exec: %w", err)
+		return 0, nil, fmt.Errorf("failed to attach to exec: %w", err)
 	}
 	defer attach.Close()
 
 	// Start the exec
 	if err := nm.client.ContainerExecStart(ctx, exec.ID, container.ExecStartOptions{}); err != nil {
-		return false, fmt.Errorf("failed to start health check: %w", err)
+		return 0, nil, fmt.Errorf("failed to start %s: %w", strings.Join(cmd, " "), err)
 	}
 
-	// Read output
-	_, _ = io.ReadAll(attach.Reader)
+	// Read output, demultiplexing stdout and stderr
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, attach.Reader); err != nil {
+		return 0, nil, fmt.Errorf("failed to read nginx output: %w", err)
+	}
 
 	// Inspect exec to check exit code
 	inspectResp, err := nm.client.ContainerExecInspect(ctx, exec.ID)
 	if err != nil {
-		return false, fmt.Errorf("failed to inspect exec: %w", err)
+		return 0, nil, fmt.Errorf("failed to inspect exec: %w", err)
 	}
-
-	// nginx -t returns 0 if config is valid and nginx is healthy
-	return inspectResp.ExitCode == 0, nil
+	return inspectResp.ExitCode, output.Bytes(), nil
 }
 
 // Restart restarts the nginx container with current configuration
@@ -0,0 +1,153 @@
+package docker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncConfig(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-nginx-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	readFile := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if os.IsNotExist(err) {
+			return ""
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	accept := func() (string, error) { return "", nil }
+	// Files are tested in the staging directory before they're swapped in
+	staged := ""
+	acceptStaged := func() (string, error) {
+		data, err := os.ReadFile(filepath.Join(dir, nginxStagingDir, "nginx.conf"))
+		staged = string(data)
+		return "", err
+	}
+	reloads := 0
+	reloadOK := func() error { reloads++; return nil }
+
+	// Accepted files are written and nginx reloaded
+	main := "main\ninclude /etc/nginx/conf.d/*.conf;"
+	files := map[string]string{
+		"nginx.conf":           main,
+		"conf.d/abc123.conf":   "abc",
+		"conf.d/def456.conf":   "def",
+		"stream.d/def456.conf": "def-stream",
+	}
+	if _, err := syncConfig(dir, files, acceptStaged, reloadOK); err != nil {
+		t.Fatalf("syncConfig() error = %v", err)
+	}
+	if staged != "main\ninclude /etc/nginx/staging/conf.d/*.conf;" {
+		t.Errorf("staged main config = %q, want its includes pointing at the staged files", staged)
+	}
+	if _, err := os.Stat(filepath.Join(dir, nginxStagingDir)); !os.IsNotExist(err) {
+		t.Errorf("staging directory wasn't removed: %v", err)
+	}
+	if readFile("conf.d/abc123.conf") != "abc" || readFile("stream.d/def456.conf") != "def-stream" || reloads != 1 {
+		t.Fatalf("files weren't written and reloaded once (%d reloads)", reloads)
+	}
+
+	// Nothing changed, so nothing is reloaded
+	if _, err := syncConfig(dir, files, accept, reloadOK); err != nil || reloads != 1 {
+		t.Fatalf("syncConfig() without changes = %v after %d reloads, want no reload", err, reloads)
+	}
+
+	// A fork whose include nginx rejects is disabled; the others' changes apply
+	rejections := []string{`nginx: [emerg] unknown directive "bogus" in /etc/nginx/staging/conf.d/def456.conf:3`}
+	rejectDef := func() (string, error) {
+		if len(rejections) == 0 {
+			return "", nil
+		}
+		rejection := rejections[0]
+		rejections = rejections[1:]
+		return rejection, nil
+	}
+	files["conf.d/abc123.conf"] = "abc v2"
+	files["conf.d/def456.conf"] = "bogus"
+	disabled, err := syncConfig(dir, files, rejectDef, reloadOK)
+	if err != nil {
+		t.Fatalf("syncConfig() error = %v", err)
+	}
+	if len(disabled) != 1 || disabled["def456"] != `nginx: [emerg] unknown directive "bogus" in /etc/nginx/conf.d/def456.conf:3` {
+		t.Errorf("disabled = %v, want def456 with the live path", disabled)
+	}
+	if readFile("conf.d/abc123.conf") != "abc v2" || reloads != 2 {
+		t.Errorf("other forks' changes weren't applied")
+	}
+	if readFile("conf.d/def456.conf") != "" || readFile("stream.d/def456.conf") != "" {
+		t.Errorf("the rejected fork's includes are still loaded")
+	}
+	if readFile("conf.d/def456.conf.disabled") != "bogus" || readFile("stream.d/def456.conf.disabled") != "def-stream" {
+		t.Errorf("the rejected fork's includes weren't kept for inspection")
+	}
+
+	// A rejection outside a fork's include puts everything back
+	reject := func() (string, error) {
+		return `nginx: [emerg] unknown directive "bogus" in /etc/nginx/nginx.conf:3`, nil
+	}
+	files["nginx.conf"] = "bogus main"
+	files["conf.d/abc123.conf"] = "abc v3"
+	_, err = syncConfig(dir, files, reject, reloadOK)
+	var configErr *NginxConfigError
+	if !errors.As(err, &configErr) || configErr.RolledBack {
+		t.Fatalf("syncConfig(rejected) error = %v, want a NginxConfigError without rollback", err)
+	}
+	if readFile("nginx.conf") != main || readFile("conf.d/abc123.conf") != "abc v2" || reloads != 2 {
+		t.Errorf("live files were changed or reloaded")
+	}
+
+	// A config that fails to reload is rolled back, and forks that are gone
+	// come back with it
+	failures := 1
+	reloadOnce := func() error {
+		reloads++
+		if failures > 0 {
+			failures--
+			return errors.New("bind() to 0.0.0.0:15000 failed")
+		}
+		return nil
+	}
+	files = map[string]string{"nginx.conf": "main v2"}
+	_, err = syncConfig(dir, files, accept, reloadOnce)
+	if !errors.As(err, &configErr) || !configErr.RolledBack {
+		t.Fatalf("syncConfig(broken) error = %v, want a rolled back NginxConfigError", err)
+	}
+	if readFile("nginx.conf") != main || readFile("conf.d/abc123.conf") != "abc v2" || reloads != 4 {
+		t.Errorf("files weren't rolled back and reloaded (%d reloads)", reloads)
+	}
+
+	// Without nginx running, forks that are gone are just removed
+	if _, err := syncConfig(dir, files, nil, nil); err != nil {
+		t.Fatalf("syncConfig() error = %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "conf.d"))
+	if readFile("nginx.conf") != "main v2" || len(entries) != 0 {
+		t.Errorf("includes of forks that are gone weren't removed: %v", entries)
+	}
+}
+
+func TestIsPortBindError(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"driver failed programming external connectivity on endpoint worklet-nginx-proxy: Error starting userland proxy: listen tcp4 0.0.0.0:80: bind: address already in use", true},
+		{"Bind for 0.0.0.0:80 failed: port is already allocated", true},
+		{"rootlesskit: cannot expose privileged port 80, you can add 'net.ipv4.ip_unprivileged_port_start=80' to /etc/sysctl.conf", true},
+		{"Bind for 127.0.0.1:15000 failed: port is already allocated", false},
+		{"No such image: nginx:alpine", false},
+	}
+	for _, tt := range tests {
+		if got := isPortBindError(errors.New(tt.msg), 80); got != tt.want {
+			t.Errorf("isPortBindError(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
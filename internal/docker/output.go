@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Output receives the progress messages and notes this package prints while
+// starting, stopping and cleaning up sessions. Commands run with --quiet set
+// it to io.Discard.
+var Output io.Writer = os.Stdout
+
+// CommandLog receives each docker CLI command before it runs, when set
+var CommandLog io.Writer
+
+// dockerCommand returns a docker CLI command, logging it to CommandLog
+func dockerCommand(ctx context.Context, args ...string) *exec.Cmd {
+	if CommandLog != nil {
+		fmt.Fprintf(CommandLog, "+ docker %s\n", strings.Join(redactEnvArgs(args), " "))
+	}
+	return exec.CommandContext(ctx, "docker", args...)
+}
+
+// redactEnvArgs returns args with the values of -e/--env options hidden,
+// since they may hold credentials
+func redactEnvArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 1; i < len(redacted); i++ {
+		if prev := redacted[i-1]; prev != "-e" && prev != "--env" {
+			continue
+		}
+		if name, _, ok := strings.Cut(redacted[i], "="); ok {
+			redacted[i] = name + "=***"
+		}
+	}
+	return redacted
+}
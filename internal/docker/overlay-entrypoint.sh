@@ -0,0 +1,78 @@
+#!/bin/sh
+# Mounts a worklet session's copy-on-write workspace, then runs the next
+# entrypoint with the container's command. The project is mounted read-only
+# at /worklet/lower and changes go to an upper layer in the session's
+# overlay volume at /worklet/state.
+set -e
+
+lower=/worklet/lower
+state=/worklet/state
+seed=/worklet/seed
+target=${WORKLET_OVERLAY_TARGET:-/workspace}
+
+if ! grep -qs " $target overlay " /proc/mounts; then
+    mkdir -p "$state/upper" "$state/work" "$target"
+
+    # On first start, add generated files and hide the paths a copied
+    # workspace leaves out (.dockerignore, .workletignore, run.include)
+    if [ ! -e "$state/.seeded" ]; then
+        if [ -d "$seed/files" ]; then
+            cp -a "$seed/files/." "$state/upper/"
+        fi
+        if [ -f "$seed/skipped" ]; then
+            while IFS= read -r path; do
+                [ -n "$path" ] || continue
+                [ ! -e "$state/upper/$path" ] || continue
+                mkdir -p "$state/upper/$(dirname "$path")"
+                mknod "$state/upper/$path" c 0 0
+            done < "$seed/skipped"
+        fi
+        touch "$state/.seeded"
+    fi
+
+    # Docker mounts volumes and files inside the workspace before this runs;
+    # move them aside so they stay on top of the overlay
+    staging=/worklet/submounts
+    mkdir -p "$staging"
+    : > "$staging/list"
+    i=0
+    prev=""
+    awk -v t="$target/" 'index($2, t) == 1 { print $2 }' /proc/mounts | sort > "$staging/found"
+    while IFS= read -r m; do
+        case "$m" in "$prev"/*) [ -n "$prev" ] && continue ;; esac
+        i=$((i + 1))
+        if [ -d "$m" ]; then mkdir -p "$staging/$i"; else touch "$staging/$i"; fi
+        mount --move "$m" "$staging/$i"
+        echo "$i $m" >> "$staging/list"
+        prev=$m
+    done < "$staging/found"
+
+    if ! mount -t overlay overlay -o "lowerdir=$lower,upperdir=$state/upper,workdir=$state/work" "$target"; then
+        echo "ERROR: Failed to mount the copy-on-write workspace at $target" >&2
+        echo "Set run.copyStrategy to \"image\" to copy the workspace into an image instead" >&2
+        exit 1
+    fi
+
+    while read -r i m; do
+        if [ -d "$staging/$i" ]; then
+            mkdir -p "$m"
+        elif [ ! -e "$m" ]; then
+            mkdir -p "$(dirname "$m")"
+            touch "$m"
+        fi
+        mount --move "$staging/$i" "$m"
+    done < "$staging/list"
+fi
+
+# Continue with the entrypoint the container would otherwise have run, one
+# argument per line
+if [ -s "$seed/next" ]; then
+    set -f
+    old_ifs=$IFS
+    IFS='
+'
+    set -- $(cat "$seed/next") "$@"
+    IFS=$old_ifs
+    set +f
+fi
+exec "$@"
@@ -0,0 +1,200 @@
+package docker
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/fscopy"
+)
+
+//go:embed overlay-entrypoint.sh
+var overlayEntrypointScript string
+
+// Paths inside a session container whose workspace is mounted copy-on-write
+const (
+	overlayLowerDir = "/worklet/lower" // The project, read-only
+	overlayStateDir = "/worklet/state" // The overlay volume: upper and work dirs
+	overlaySeedDir  = "/worklet/seed"  // Entrypoints and first-start files from the host
+)
+
+// useOverlay reports whether copy mode mounts the workspace copy-on-write
+// instead of copying it into an image
+func useOverlay(opts RunOptions) bool {
+	return !opts.MountMode && opts.Config.Run.CopyStrategy == config.CopyStrategyOverlay
+}
+
+// overlayUnavailable returns why the workspace can't be mounted
+// copy-on-write, or "" if it can
+func overlayUnavailable(opts RunOptions) string {
+	if opts.TemporaryWorkDir {
+		return "the project directory is removed after the run"
+	}
+	if host := remoteDockerHost(); host != "" {
+		return fmt.Sprintf("the Docker daemon is remote (%s)", host)
+	}
+	// A copied workspace is given to the user; the overlay's lower layer
+	// can't be
+	if opts.Config.Run.User != "" {
+		return "run.user is set"
+	}
+	return ""
+}
+
+// overlayVolumeName returns the volume holding a session's changes to its
+// copy-on-write workspace
+func overlayVolumeName(sessionID string) string {
+	return fmt.Sprintf("worklet-overlay-%s", sessionID)
+}
+
+// overlaySeedPath returns the host directory mounted at overlaySeedDir. It
+// outlives the run so the container can be restarted.
+func overlaySeedPath(sessionID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "overlay", sessionID), nil
+}
+
+// prepareOverlay writes the seed directory of a copy-on-write session: the
+// entrypoints, the paths a copied workspace would leave out, and the
+// processed environment templates
+func prepareOverlay(ctx context.Context, opts RunOptions, imageName string) error {
+	seedDir, err := overlaySeedPath(opts.SessionID)
+	if err != nil {
+		return err
+	}
+	os.RemoveAll(seedDir)
+	filesDir := filepath.Join(seedDir, "files")
+	if err := os.MkdirAll(filesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(seedDir, "overlay.sh"), []byte(overlayEntrypointScript), 0755); err != nil {
+		return fmt.Errorf("failed to write overlay entrypoint: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, "entrypoint.sh"), []byte(dindEntrypointScript), 0755); err != nil {
+		return fmt.Errorf("failed to write entrypoint script: %w", err)
+	}
+
+	skipped, err := fscopy.Skipped(opts.WorkDir, workspaceCopyOptions(nil, opts.Config.Run.Include))
+	if err != nil {
+		return fmt.Errorf("failed to list excluded paths: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, "skipped"), []byte(strings.Join(skipped, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write excluded paths: %w", err)
+	}
+
+	if err := processEnvironmentTemplates(opts.WorkDir, filesDir, opts); err != nil {
+		// Log warning but don't fail the run, as in image copy mode
+		fmt.Fprintf(Output, "Warning: Failed to process environment templates: %v\n", err)
+	}
+
+	// The overlay entrypoint replaces the container's, so it runs that next
+	next := []string{overlaySeedDir + "/entrypoint.sh"}
+	if isolationMode(opts.Config) != "full" {
+		if next, err = imageEntrypoint(ctx, imageName); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(seedDir, "next"), []byte(strings.Join(next, "\n")), 0644); err != nil {
+		return fmt.Errorf("failed to write entrypoint: %w", err)
+	}
+
+	return nil
+}
+
+// imageEntrypoint returns the entrypoint of an image, pulling it if it isn't
+// available locally
+func imageEntrypoint(ctx context.Context, imageName string) ([]string, error) {
+	inspect := func() ([]byte, error) {
+		return dockerCommand(ctx, "image", "inspect", "--format", "{{json .Config.Entrypoint}}", imageName).Output()
+	}
+
+	output, err := inspect()
+	if err != nil {
+		if pullOutput, err := dockerCommand(ctx, "pull", imageName).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to pull image %s: %w\n%s", imageName, err, pullOutput)
+		}
+		if output, err = inspect(); err != nil {
+			return nil, fmt.Errorf("failed to inspect image %s: %w", imageName, err)
+		}
+	}
+
+	var entrypoint []string
+	if err := json.Unmarshal(output, &entrypoint); err != nil {
+		return nil, fmt.Errorf("failed to parse entrypoint of image %s: %w", imageName, err)
+	}
+	return entrypoint, nil
+}
+
+// removeOverlay removes a session's overlay volume and seed directory. It is
+// best effort and ignores ones that don't exist.
+func removeOverlay(sessionID string) {
+	RemoveVolume(overlayVolumeName(sessionID))
+	if seedDir, err := overlaySeedPath(sessionID); err == nil {
+		os.RemoveAll(seedDir)
+	}
+}
+
+// WorkspaceChange is a path a copy-on-write session changed
+type WorkspaceChange struct {
+	Status string `json:"status"` // "A" added, "M" modified or "D" deleted
+	Path   string `json:"path"`
+}
+
+// workspaceDiffScript lists the upper layer of a copy-on-write workspace,
+// leaving out the files worklet put there itself
+const workspaceDiffScript = `cd ` + overlayStateDir + `/upper || exit 3
+find . ! -type d | while IFS= read -r p; do
+  p=${p#./}
+  if [ -c "$p" ]; then
+    grep -qxF "$p" ` + overlaySeedDir + `/skipped 2>/dev/null && continue
+    echo "D $p"
+  elif [ -e "` + overlayLowerDir + `/$p" ] || [ -L "` + overlayLowerDir + `/$p" ]; then
+    cmp -s "$p" "` + overlaySeedDir + `/files/$p" 2>/dev/null && continue
+    echo "M $p"
+  else
+    cmp -s "$p" "` + overlaySeedDir + `/files/$p" 2>/dev/null && continue
+    echo "A $p"
+  fi
+done`
+
+// WorkspaceDiff returns the files a running copy-on-write session has added,
+// modified or deleted in its workspace, read from the overlay's upper layer
+func WorkspaceDiff(ctx context.Context, sessionID string) ([]WorkspaceChange, error) {
+	session, err := GetSessionInfo(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Labels[LabelMode] != ModeOverlay {
+		return nil, fmt.Errorf("session %s doesn't use a copy-on-write workspace (run.copyStrategy \"overlay\")", sessionID)
+	}
+
+	output, err := dockerCommand(ctx, "exec", session.ContainerID, "sh", "-c", workspaceDiffScript).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("failed to read workspace changes: %w\n%s", err, exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("failed to read workspace changes: %w", err)
+	}
+
+	var changes []WorkspaceChange
+	for _, line := range strings.Split(string(output), "\n") {
+		status, path, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		changes = append(changes, WorkspaceChange{Status: status, Path: path})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
@@ -0,0 +1,132 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// LabelHostOwner records the uid:gid mount-mode files are handed back to
+const LabelHostOwner = "worklet.host.owner"
+
+// ownershipInterval is how often the ownership shim looks for files the
+// session created as root
+const ownershipInterval = 5 * time.Second
+
+// hostOwner returns the uid:gid files a mount-mode session creates as root
+// should belong to on the host, or "" if they needn't be handed back.
+//
+// That's only needed with a rootful Docker daemon on this Linux machine:
+// Docker Desktop and rootless Docker already map root in the container to
+// the host user, and a remote daemon's files aren't on this machine.
+func hostOwner(cfg *config.WorkletConfig) string {
+	if runtime.GOOS != "linux" || os.Getuid() == 0 || !cfg.Run.KeepsHostOwnership() {
+		return ""
+	}
+	if remoteDockerHost() != "" {
+		return ""
+	}
+	output, err := dockerCommand(context.Background(), "info", "--format", "{{.OperatingSystem}} {{json .SecurityOptions}}").Output()
+	if err != nil {
+		return ""
+	}
+	if info := string(output); strings.Contains(info, "Docker Desktop") || strings.Contains(info, "rootless") {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+}
+
+// Markers the ownership shim keeps in the container: the session's start,
+// before which files aren't handed back, and the last time it looked
+const (
+	ownershipStartMarker = "/tmp/.worklet-ownership-start"
+	ownershipRoundMarker = "/tmp/.worklet-ownership-round"
+	ownershipNextMarker  = "/tmp/.worklet-ownership-next"
+)
+
+// ownershipFixCommand returns a shell command giving the files under dir,
+// the project, that are owned by root and newer than marker to owner.
+// Root-owned files that were there before the session are left alone. It
+// stays on the project's filesystem, so volumes mounted inside the project,
+// such as node_modules volumes, are left alone too.
+func ownershipFixCommand(owner, dir, marker string) string {
+	return fmt.Sprintf("[ -d %[1]s ] && [ -e %[2]s ] && find %[1]s -xdev -mindepth 1 -user 0 -newer %[2]s -exec chown -h %[3]s {} + 2>/dev/null; true",
+		shellQuote(dir), shellQuote(marker), owner)
+}
+
+// ownershipShimCommand returns the command of the ownership shim, which
+// keeps handing files created as root back to owner while the session runs.
+// The start marker is dated when the container started, and each round only
+// looks at files changed since the one before.
+func ownershipShimCommand(owner, dir string, started time.Time) []string {
+	script := fmt.Sprintf("[ -e %[1]s ] || touch -d @%[2]d %[1]s; cp -p %[1]s %[3]s; while :; do touch %[4]s; %[5]s; mv %[4]s %[3]s; sleep %[6]d; done",
+		ownershipStartMarker, started.Unix(), ownershipRoundMarker, ownershipNextMarker,
+		ownershipFixCommand(owner, dir, ownershipRoundMarker), int(ownershipInterval.Seconds()))
+	return []string{"sh", "-c", script}
+}
+
+// startOwnershipShim starts the ownership shim in a mount-mode session's
+// container. It is best effort: without it, files keep the owner they were
+// created with.
+func startOwnershipShim(ctx context.Context, container string, opts RunOptions) {
+	if !opts.MountMode || opts.HostOwner == "" {
+		return
+	}
+	started := time.Now().Add(-time.Minute)
+	if output, err := dockerCommand(ctx, "inspect", "--format", "{{.State.StartedAt}}", container).Output(); err == nil {
+		if t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(output))); err == nil {
+			started = t
+		}
+	}
+	// As root, whoever run.user makes the session's user
+	args := append([]string{"exec", "-d", "-u", "0", container}, ownershipShimCommand(opts.HostOwner, opts.Config.ContainerWorkDir(), started)...)
+	if err := dockerCommand(ctx, args...).Run(); err != nil {
+		fmt.Fprintf(Output, "Warning: files the session creates as root will stay root-owned on the host: %v\n", err)
+	}
+}
+
+// startEphemeralOwnershipShim starts the ownership shim in an ephemeral
+// run's container once it's up, which RunEphemeral doesn't wait for
+func startEphemeralOwnershipShim(opts RunOptions) {
+	container := fmt.Sprintf("%s-%s", containerProjectName(opts.Config), opts.SessionID)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for ctx.Err() == nil {
+		output, err := dockerCommand(ctx, "inspect", "--format", "{{.State.Running}}", container).Output()
+		if err == nil && strings.TrimSpace(string(output)) == "true" {
+			startOwnershipShim(ctx, container, opts)
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// restoreHostOwnership hands the files a mount-mode session created as root
+// in its project back to the host user, before the session is removed. It
+// is best effort, and does nothing if the shim never ran.
+func restoreHostOwnership(ctx context.Context, containerID string) {
+	output, err := dockerCommand(ctx, "inspect", "--format",
+		fmt.Sprintf(`{{.State.Running}} {{index .Config.Labels %q}} {{.Config.WorkingDir}}`, LabelHostOwner),
+		containerID).Output()
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) != 3 || fields[0] != "true" || !strings.Contains(fields[1], ":") || !path.IsAbs(fields[2]) {
+		return
+	}
+	fixCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	dockerCommand(fixCtx, "exec", "-u", "0", containerID, "sh", "-c", ownershipFixCommand(fields[1], fields[2], ownershipStartMarker)).Run()
+}
+
+// shellQuote quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestOwnershipShim(t *testing.T) {
+	fix := ownershipFixCommand("1000:1000", "/it's", ownershipStartMarker)
+	for _, want := range []string{"find '/it'\\''s' -xdev -mindepth 1 -user 0 -newer '" + ownershipStartMarker + "'", "chown -h 1000:1000"} {
+		if !strings.Contains(fix, want) {
+			t.Errorf("fix command %q doesn't contain %q", fix, want)
+		}
+	}
+
+	started := time.Unix(1700000000, 0)
+	shim := ownershipShimCommand("1000:1000", "/workspace", started)
+	if len(shim) != 3 || shim[0] != "sh" {
+		t.Fatalf("unexpected shim command %v", shim)
+	}
+	for _, want := range []string{"touch -d @1700000000 " + ownershipStartMarker, "while :; do touch " + ownershipNextMarker, "-newer '" + ownershipRoundMarker + "'"} {
+		if !strings.Contains(shim[2], want) {
+			t.Errorf("shim command %q doesn't contain %q", shim[2], want)
+		}
+	}
+}
+
+func TestBuildRunArgsHostOwner(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-owner-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := RunOptions{
+		WorkDir:   dir,
+		Config:    &config.WorkletConfig{Name: "test", Run: config.RunConfig{Isolation: "shared"}},
+		SessionID: "abc123",
+		MountMode: true,
+		HostOwner: "1000:1000",
+	}
+	args, err := buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(args, " "), "--label "+LabelHostOwner+"=1000:1000") {
+		t.Errorf("expected the host owner label, got %v", args)
+	}
+
+	// Copy mode has no host files to hand back
+	opts.MountMode = false
+	args, err = buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), LabelHostOwner) {
+		t.Errorf("copy mode shouldn't record a host owner: %v", args)
+	}
+}
@@ -0,0 +1,146 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// RunPlan describes the container RunContainer would create, without
+// creating anything
+type RunPlan struct {
+	ContainerName string
+	Image         string
+	BaseImage     string // Image the workspace is copied onto in image copy mode
+	Network       string
+	Isolation     string
+	MountMode     bool
+	Overlay       bool     // The workspace is mounted copy-on-write
+	Args          []string // docker run arguments, secrets redacted
+	Volumes       []string // Volumes that would be created if missing
+	// Internal is set when the policy cuts the session network off from
+	// outside
+	Internal bool
+	// PolicyViolations lists the ways the session breaks the policy, which
+	// would stop it from starting
+	PolicyViolations []string
+}
+
+// PlanContainer resolves the docker run invocation for opts
+func PlanContainer(opts RunOptions) (*RunPlan, error) {
+	plan := &RunPlan{
+		ContainerName: fmt.Sprintf("%s-%s", containerProjectName(opts.Config), opts.SessionID),
+		Network:       GetSessionNetworkName(opts.SessionID),
+		Isolation:     isolationMode(opts.Config),
+		MountMode:     opts.MountMode,
+		Overlay:       useOverlay(opts),
+	}
+
+	baseImage := opts.Config.Run.Image
+	if baseImage == "" {
+		baseImage = "worklet/base:latest"
+	}
+
+	if opts.MountMode || plan.Overlay {
+		plan.Image = baseImage
+	} else {
+		plan.Image = copyImageName(opts.Config, opts.SessionID)
+		plan.BaseImage = baseImage
+	}
+
+	policy, err := config.LoadPolicy()
+	if err != nil {
+		return nil, err
+	}
+	plan.Internal = policy.BlocksEgress()
+	var policyErr *config.PolicyError
+	if errors.As(policy.Check(policyRun(opts)), &policyErr) {
+		plan.PolicyViolations = policyErr.Violations
+	}
+
+	if opts.MountMode {
+		opts.HostOwner = hostOwner(opts.Config)
+	}
+	args, err := buildRunArgs(opts, plan.Image, "<entrypoint.sh>")
+	if err != nil {
+		return nil, err
+	}
+	plan.Args = RedactArgs(args)
+
+	if plan.Isolation == "full" {
+		plan.Volumes = append(plan.Volumes, fmt.Sprintf("worklet-%s", opts.SessionID))
+	}
+	if plan.Overlay {
+		plan.Volumes = append(plan.Volumes, overlayVolumeName(opts.SessionID))
+	}
+	if _, err := os.Stat(filepath.Join(opts.WorkDir, "pnpm-lock.yaml")); err == nil {
+		plan.Volumes = append(plan.Volumes, pnpmStoreVolumeName(containerProjectName(opts.Config)))
+	}
+	if opts.MountMode {
+		for _, dir := range cacheVolumeDirs(opts) {
+			plan.Volumes = append(plan.Volumes, cacheVolumeName(containerProjectName(opts.Config), dir))
+		}
+	}
+
+	return plan, nil
+}
+
+// secretKeyPattern matches environment variable names that likely hold secrets
+var secretKeyPattern = regexp.MustCompile(`(?i)(secret|token|password|passwd|api_?key|private|credential|auth)`)
+
+// IsSecretEnvKey reports whether an environment variable name looks like it
+// holds a secret
+func IsSecretEnvKey(key string) bool {
+	return secretKeyPattern.MatchString(key)
+}
+
+// RedactArgs returns a copy of docker run args with the values of
+// secret-looking environment variables replaced
+func RedactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 0; i < len(redacted)-1; i++ {
+		if redacted[i] != "-e" {
+			continue
+		}
+		key, _, found := strings.Cut(redacted[i+1], "=")
+		if found && IsSecretEnvKey(key) {
+			redacted[i+1] = key + "=<redacted>"
+		}
+		i++
+	}
+
+	return redacted
+}
+
+// containerProjectName returns the project name used in container names
+func containerProjectName(cfg *config.WorkletConfig) string {
+	if cfg.Name == "" {
+		return "worklet"
+	}
+	return cfg.Name
+}
+
+// isolationMode returns the configured isolation mode, defaulting to full
+func isolationMode(cfg *config.WorkletConfig) string {
+	if cfg.Run.Isolation == "" {
+		return "full"
+	}
+	return cfg.Run.Isolation
+}
+
+// copyImageName returns the name of the temporary image built in copy mode
+func copyImageName(cfg *config.WorkletConfig, sessionID string) string {
+	return fmt.Sprintf("worklet-temp-%s-%s", strings.ToLower(containerProjectName(cfg)), sessionID)
+}
+
+// pnpmStoreVolumeName returns the shared pnpm store volume for a project
+func pnpmStoreVolumeName(projectName string) string {
+	return fmt.Sprintf("worklet-pnpm-store-%s", projectName)
+}
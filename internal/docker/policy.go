@@ -0,0 +1,26 @@
+package docker
+
+import (
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// CheckPolicy returns an error if the session opts describes breaks the
+// organization policy, a *config.PolicyError listing the violations when it
+// does
+func CheckPolicy(opts RunOptions) error {
+	policy, err := config.LoadPolicy()
+	if err != nil {
+		return err
+	}
+	return policy.Check(policyRun(opts))
+}
+
+// policyRun describes the session opts describes for checking the policy
+func policyRun(opts RunOptions) config.PolicyRun {
+	return config.PolicyRun{
+		Image:      opts.baseImage(),
+		Isolation:  isolationMode(opts.Config),
+		MountMode:  opts.MountMode,
+		Privileged: opts.Config.Run.Privileged,
+	}
+}
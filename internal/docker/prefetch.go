@@ -0,0 +1,243 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/projects"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// defaultBaseImage is what sessions start from when nothing else is set
+const defaultBaseImage = "worklet/base:latest"
+
+// prefetchProjectMaxAge is how recently a project must have been run for
+// its images to be prefetched
+const prefetchProjectMaxAge = 30 * 24 * time.Hour
+
+// PrefetchTarget is an image to keep pulled and why
+type PrefetchTarget struct {
+	Image  string
+	Reason string // e.g. "proxy", "base image" or "project shop"
+}
+
+// Outcomes of prefetching an image
+const (
+	PrefetchUpdated = "updated"       // A newer version was pulled
+	PrefetchCurrent = "up to date"    // The image hadn't changed
+	PrefetchLocal   = "built locally" // Skipped: the image isn't from a registry
+	PrefetchFailed  = "failed"
+)
+
+// PrefetchResult is how prefetching an image went
+type PrefetchResult struct {
+	PrefetchTarget
+	Status string
+	Err    error
+}
+
+// PrefetchTargets returns the images worth keeping pulled: the proxy's
+// image, the default base image, the registry mirror's if it's on, the images of the projects run most in the
+// last month and the configured extra images. Images from registries whose
+// prefetch is disabled are left out.
+func PrefetchTargets(global *config.GlobalConfig) []PrefetchTarget {
+	var targets []PrefetchTarget
+	seen := make(map[string]bool)
+	add := func(image, reason string) {
+		if image == "" || seen[image] || !global.Prefetch.Prefetches(config.ImageRegistry(image)) {
+			return
+		}
+		seen[image] = true
+		targets = append(targets, PrefetchTarget{Image: image, Reason: reason})
+	}
+
+	add(nginxImage, "proxy")
+	add(defaultBaseImage, "base image")
+	if global.RegistryMirror.Enabled {
+		add(registryMirrorImage, "registry mirror")
+	}
+	for _, project := range prefetchProjects(global.Prefetch.ProjectCount()) {
+		cfg, err := config.LoadConfig(project.Path)
+		if err != nil {
+			continue
+		}
+		reason := "project " + project.DisplayName()
+		image := cfg.Run.Image
+		if image == "" {
+			image = defaultBaseImage
+		}
+		add(image, reason)
+		if composePath := GetComposePath(project.Path, cfg.Run.ComposePath); composePath != "" {
+			services, err := ParseComposeServices(composePath)
+			if err != nil {
+				continue
+			}
+			for _, svc := range services {
+				add(svc.Image, reason)
+			}
+		}
+	}
+	for _, image := range global.Prefetch.Images {
+		add(image, "configured")
+	}
+	return targets
+}
+
+// prefetchProjects returns up to n of the projects run most, among those run
+// in the last month
+func prefetchProjects(n int) []projects.Project {
+	manager, err := projects.NewManager()
+	if err != nil {
+		return nil
+	}
+	var recent []projects.Project
+	for _, project := range manager.List() {
+		if project.RunCount > 0 && time.Since(project.LastAccessed) < prefetchProjectMaxAge {
+			recent = append(recent, project)
+		}
+	}
+	sort.SliceStable(recent, func(i, j int) bool { return recent[i].RunCount > recent[j].RunCount })
+	if len(recent) > n {
+		recent = recent[:n]
+	}
+	return recent
+}
+
+// Prefetch pulls targets and records when each was pulled. Unless force is
+// set, only images whose registry's interval has passed since they were
+// last pulled are. report, if not nil, is called as each image finishes.
+func Prefetch(ctx context.Context, cfg config.PrefetchConfig, targets []PrefetchTarget, force bool, report func(PrefetchResult)) ([]PrefetchResult, error) {
+	statePath, err := prefetchStatePath()
+	if err != nil {
+		return nil, err
+	}
+	state := loadPrefetchState(statePath)
+
+	var results []PrefetchResult
+	pulled := make(map[string]time.Time)
+	for _, target := range dueTargets(cfg, targets, state, time.Now(), force) {
+		if ctx.Err() != nil {
+			break
+		}
+		status, err := PrefetchImage(ctx, target.Image)
+		result := PrefetchResult{PrefetchTarget: target, Status: status, Err: err}
+		if err == nil {
+			pulled[target.Image] = time.Now()
+		}
+		results = append(results, result)
+		if report != nil {
+			report(result)
+		}
+	}
+	if len(pulled) == 0 {
+		return results, ctx.Err()
+	}
+
+	// The daemon and `worklet prefetch` may both be recording
+	err = storage.WithLock(statePath, func() error {
+		state := loadPrefetchState(statePath)
+		for image, at := range pulled {
+			state.Pulled[image] = at
+		}
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		return storage.WriteFileAtomic(statePath, data, 0644)
+	})
+	if err != nil {
+		return results, fmt.Errorf("failed to save prefetch state: %w", err)
+	}
+	return results, ctx.Err()
+}
+
+// PrefetchDue reports whether any of targets is due to be pulled again
+func PrefetchDue(cfg config.PrefetchConfig, targets []PrefetchTarget) bool {
+	statePath, err := prefetchStatePath()
+	if err != nil {
+		return false
+	}
+	return len(dueTargets(cfg, targets, loadPrefetchState(statePath), time.Now(), false)) > 0
+}
+
+// dueTargets returns the targets whose registry's interval has passed since
+// they were last pulled, or all of them if force is set
+func dueTargets(cfg config.PrefetchConfig, targets []PrefetchTarget, state prefetchState, now time.Time, force bool) []PrefetchTarget {
+	if force {
+		return targets
+	}
+	var due []PrefetchTarget
+	for _, target := range targets {
+		last, ok := state.Pulled[target.Image]
+		if !ok || now.Sub(last) >= cfg.Interval(config.ImageRegistry(target.Image)) {
+			due = append(due, target)
+		}
+	}
+	return due
+}
+
+// PrefetchImage pulls image and reports whether that changed it. Images
+// that exist but weren't pulled from a registry are left alone, since
+// pulling would replace a local build or fail.
+func PrefetchImage(ctx context.Context, image string) (string, error) {
+	before := ""
+	output, err := dockerCommand(ctx, "image", "inspect", "--format", "{{.Id}} {{len .RepoDigests}}", image).Output()
+	if err == nil {
+		fields := strings.Fields(string(output))
+		if len(fields) == 2 && fields[1] == "0" {
+			return PrefetchLocal, nil
+		}
+		if len(fields) > 0 {
+			before = fields[0]
+		}
+	}
+
+	if output, err := dockerCommand(ctx, "pull", "--quiet", image).CombinedOutput(); err != nil {
+		return PrefetchFailed, fmt.Errorf("pull failed: %s", strings.TrimSpace(string(output)))
+	}
+	output, err = dockerCommand(ctx, "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return PrefetchFailed, fmt.Errorf("failed to inspect image: %w", err)
+	}
+	if strings.TrimSpace(string(output)) == before {
+		return PrefetchCurrent, nil
+	}
+	return PrefetchUpdated, nil
+}
+
+// prefetchState records when each image was last prefetched
+type prefetchState struct {
+	Pulled map[string]time.Time `json:"pulled"`
+}
+
+// prefetchStatePath returns ~/.worklet/prefetch.json
+func prefetchStatePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "prefetch.json"), nil
+}
+
+// loadPrefetchState reads the prefetch state at path. A missing or
+// unreadable file yields an empty state, which only means images are
+// pulled again.
+func loadPrefetchState(path string) prefetchState {
+	state := prefetchState{Pulled: make(map[string]time.Time)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return state
+	}
+	json.Unmarshal(data, &state)
+	if state.Pulled == nil {
+		state.Pulled = make(map[string]time.Time)
+	}
+	return state
+}
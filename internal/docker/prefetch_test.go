@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestDueTargets(t *testing.T) {
+	now := time.Now()
+	cfg := config.PrefetchConfig{
+		IntervalHours: 6,
+		Registries:    map[string]config.RegistryPrefetchConfig{"ghcr.io": {IntervalHours: 24}},
+	}
+	targets := []PrefetchTarget{
+		{Image: "nginx:alpine", Reason: "proxy"},
+		{Image: "worklet/base:latest", Reason: "base image"},
+		{Image: "ghcr.io/org/app:1", Reason: "project app"},
+		{Image: "postgres:16", Reason: "configured"},
+	}
+	state := prefetchState{Pulled: map[string]time.Time{
+		"nginx:alpine":        now.Add(-7 * time.Hour),  // Past the 6 hour interval
+		"worklet/base:latest": now.Add(-1 * time.Hour),  // Pulled recently
+		"ghcr.io/org/app:1":   now.Add(-12 * time.Hour), // Within ghcr.io's 24 hours
+	}}
+
+	var due []string
+	for _, target := range dueTargets(cfg, targets, state, now, false) {
+		due = append(due, target.Image)
+	}
+	expected := []string{"nginx:alpine", "postgres:16"}
+	if len(due) != len(expected) {
+		t.Fatalf("due = %v, want %v", due, expected)
+	}
+	for i := range expected {
+		if due[i] != expected[i] {
+			t.Errorf("due = %v, want %v", due, expected)
+		}
+	}
+
+	if got := dueTargets(cfg, targets, state, now, true); len(got) != len(targets) {
+		t.Errorf("forced prefetch returned %d targets, want %d", len(got), len(targets))
+	}
+}
@@ -0,0 +1,201 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Phase is a step of session startup
+type Phase string
+
+const (
+	PhaseClone   Phase = "clone"
+	PhaseScan    Phase = "scan"
+	PhaseBuild   Phase = "build"
+	PhaseCreate  Phase = "create"
+	PhaseInit    Phase = "init"
+	PhaseHealthy Phase = "healthy"
+)
+
+// PhaseState is the state a phase moved into
+type PhaseState int
+
+const (
+	PhaseStarted PhaseState = iota
+	PhaseProgress
+	PhaseDone
+	PhaseFailed
+)
+
+// ProgressEvent reports a change in a startup phase
+type ProgressEvent struct {
+	Phase   Phase
+	State   PhaseState
+	Message string
+	Err     error
+}
+
+// ProgressFunc receives startup progress events. A nil ProgressFunc is valid
+// and discards events.
+type ProgressFunc func(ProgressEvent)
+
+// Start reports that phase has begun
+func (f ProgressFunc) Start(phase Phase, message string) {
+	if f != nil {
+		f(ProgressEvent{Phase: phase, State: PhaseStarted, Message: message})
+	}
+}
+
+// Update reports intermediate output for phase
+func (f ProgressFunc) Update(phase Phase, message string) {
+	if f != nil {
+		f(ProgressEvent{Phase: phase, State: PhaseProgress, Message: message})
+	}
+}
+
+// Done reports that phase finished successfully
+func (f ProgressFunc) Done(phase Phase, message string) {
+	if f != nil {
+		f(ProgressEvent{Phase: phase, State: PhaseDone, Message: message})
+	}
+}
+
+// Fail reports that phase failed
+func (f ProgressFunc) Fail(phase Phase, err error) {
+	if f != nil {
+		f(ProgressEvent{Phase: phase, State: PhaseFailed, Err: err})
+	}
+}
+
+// Writer returns an io.Writer that reports each line written to it as an
+// update for phase
+func (f ProgressFunc) Writer(phase Phase) *ProgressWriter {
+	return &ProgressWriter{progress: f, phase: phase}
+}
+
+// ProgressWriter turns command output into progress updates. It keeps
+// everything written so it can be shown if the phase fails.
+type ProgressWriter struct {
+	progress ProgressFunc
+	phase    Phase
+	partial  []byte
+	output   bytes.Buffer
+}
+
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	w.output.Write(p)
+	w.partial = append(w.partial, p...)
+
+	// Git and docker use \r for in-place progress, treat it as a line break
+	for {
+		idx := bytes.IndexAny(w.partial, "\r\n")
+		if idx == -1 {
+			break
+		}
+		line := strings.TrimSpace(string(w.partial[:idx]))
+		w.partial = w.partial[idx+1:]
+		if line != "" {
+			w.progress.Update(w.phase, line)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Output returns everything written so far
+func (w *ProgressWriter) Output() string {
+	return w.output.String()
+}
+
+// sessionStartedMarker is printed by the entrypoint once init scripts finish
+const sessionStartedMarker = "=== Worklet Session Started ==="
+
+// WaitForReady waits for a session container to finish its init scripts and
+// confirms it is still running. If the container is still initializing when
+// timeout elapses it returns without error; init continues in the background.
+// Containers without the worklet entrypoint have no init scripts and never
+// print its marker, so they aren't waited for.
+func WaitForReady(ctx context.Context, containerID string, timeout time.Duration, progress ProgressFunc) error {
+	if !usesWorkletEntrypoint(ctx, containerID) {
+		return nil
+	}
+	progress.Start(PhaseInit, "Waiting for init scripts")
+
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		running, err := containerRunning(ctx, containerID)
+		if err != nil {
+			progress.Fail(PhaseInit, err)
+			return err
+		}
+
+		logs, _ := dockerCommand(ctx, "logs", "--tail", "50", containerID).CombinedOutput()
+
+		if !running {
+			err := fmt.Errorf("container exited during startup:\n%s", strings.TrimSpace(string(logs)))
+			progress.Fail(PhaseInit, err)
+			return err
+		}
+
+		if strings.Contains(string(logs), sessionStartedMarker) {
+			progress.Done(PhaseInit, "")
+			break
+		}
+
+		if lines := strings.Split(strings.TrimSpace(string(logs)), "\n"); len(lines) > 0 {
+			progress.Update(PhaseInit, lines[len(lines)-1])
+		}
+
+		if time.Now().After(deadline) {
+			progress.Done(PhaseInit, "still running in the background")
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			progress.Fail(PhaseInit, ctx.Err())
+			return ctx.Err()
+		}
+	}
+
+	progress.Start(PhaseHealthy, "Checking container status")
+	running, err := containerRunning(ctx, containerID)
+	if err != nil {
+		progress.Fail(PhaseHealthy, err)
+		return err
+	}
+	if !running {
+		err := fmt.Errorf("container stopped after init")
+		progress.Fail(PhaseHealthy, err)
+		return err
+	}
+	progress.Done(PhaseHealthy, "")
+
+	return nil
+}
+
+// containerRunning reports whether a container is running
+func containerRunning(ctx context.Context, containerID string) (bool, error) {
+	output, err := dockerCommand(ctx, "inspect", "-f", "{{.State.Running}}", containerID).Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	return strings.TrimSpace(string(output)) == "true", nil
+}
+
+// usesWorkletEntrypoint reports whether the container runs the worklet
+// entrypoint script
+func usesWorkletEntrypoint(ctx context.Context, containerID string) bool {
+	output, err := dockerCommand(ctx, "inspect", "-f", "{{json .Config.Entrypoint}}", containerID).Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(output), "/entrypoint.sh")
+}
@@ -0,0 +1,260 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// CredentialProvider is a kind of credentials worklet can give sessions,
+// as managed by `worklet credentials`
+type CredentialProvider interface {
+	// Name is how the provider is named on the command line, e.g. "ssh"
+	Name() string
+	// Description says where the credentials come from
+	Description() string
+	// Configured reports whether there are credentials to give sessions,
+	// without checking that they work
+	Configured() bool
+	// Setup stores or logs in the credentials, interactively
+	Setup() error
+	// Test checks that the credentials work, returning what they're for
+	Test(ctx context.Context) (string, error)
+	// Clear removes the credentials worklet stores
+	Clear() error
+}
+
+// CredentialProviders returns every provider, in the order they're listed
+func CredentialProviders() []CredentialProvider {
+	return []CredentialProvider{
+		claudeProvider{},
+		sshProvider{},
+		&exportedProvider{
+			name:        config.CredentialAWS,
+			description: "AWS CLI profile, exported per session",
+			cli:         "aws",
+			login:       []string{"aws", "sso", "login", "--profile", awsProfile(nil)},
+			logout:      "aws sso logout",
+		},
+		&exportedProvider{
+			name:        config.CredentialGCP,
+			description: "gcloud login and application default credentials",
+			cli:         "gcloud",
+			login:       []string{"gcloud", "auth", "login", "--update-adc"},
+			logout:      "gcloud auth revoke",
+		},
+		&exportedProvider{
+			name:        config.CredentialAzure,
+			description: "Azure CLI login",
+			cli:         "az",
+			login:       []string{"az", "login"},
+			logout:      "az logout",
+		},
+		&exportedProvider{
+			name:        config.CredentialKubeconfig,
+			description: "kube contexts from your kubeconfig",
+			cli:         "kubectl",
+			hint:        "worklet uses your kubeconfig as it is; add contexts with your cluster's tooling",
+			logout:      "kubectl config delete-context",
+		},
+		&exportedProvider{
+			name:        config.CredentialDockerAuth,
+			description: "registry logins from your Docker config",
+			cli:         "docker",
+			hint:        "log in to each registry with docker login <registry>",
+			logout:      "docker logout <registry>",
+		},
+	}
+}
+
+// FindCredentialProvider returns the provider named name
+func FindCredentialProvider(name string) (CredentialProvider, error) {
+	var names []string
+	for _, provider := range CredentialProviders() {
+		if provider.Name() == name {
+			return provider, nil
+		}
+		names = append(names, provider.Name())
+	}
+	return nil, fmt.Errorf("unknown credentials provider %q (must be one of %s)", name, strings.Join(names, ", "))
+}
+
+// claudeProvider is the active Claude profile's login, kept in a volume
+type claudeProvider struct{}
+
+func (claudeProvider) Name() string { return "claude" }
+
+func (claudeProvider) Description() string {
+	return fmt.Sprintf("Claude login, profile %s", config.ActiveClaudeProfile())
+}
+
+func (claudeProvider) Configured() bool {
+	exists, _ := VolumeExists(config.ClaudeVolume(config.ActiveClaudeProfile()))
+	return exists
+}
+
+func (claudeProvider) Setup() error {
+	profile := config.ActiveClaudeProfile()
+	status, err := CheckClaudeCredentials(profile)
+	if err != nil {
+		return fmt.Errorf("failed to check credential status: %w", err)
+	}
+	if status.Configured {
+		fmt.Printf("Claude profile %s is already configured.\n", profile)
+		fmt.Printf("Run 'worklet credentials claude login %s' to log in again.\n", profile)
+		return nil
+	}
+	return SetupClaudeCredentials(profile)
+}
+
+func (claudeProvider) Test(ctx context.Context) (string, error) {
+	profile := config.ActiveClaudeProfile()
+	status, err := CheckClaudeCredentials(profile)
+	if err != nil {
+		return "", err
+	}
+	if problem := status.Problem(); problem != "" {
+		return "", fmt.Errorf("profile %s: %s", profile, problem)
+	}
+	detail := "profile " + profile
+	switch {
+	case status.APIKey:
+		detail += ", API key"
+	case status.Subscription != "":
+		detail += ", " + status.Subscription + " plan"
+	}
+	if !status.ExpiresAt.IsZero() && time.Now().Before(status.ExpiresAt) {
+		detail += ", token valid until " + status.ExpiresAt.Format("2006-01-02 15:04")
+	}
+	return detail, nil
+}
+
+func (claudeProvider) Clear() error {
+	return ClearClaudeCredentials(config.ActiveClaudeProfile())
+}
+
+// sshProvider is a copy of ~/.ssh, kept in a volume
+type sshProvider struct{}
+
+func (sshProvider) Name() string { return "ssh" }
+
+func (sshProvider) Description() string { return "SSH keys and config copied from ~/.ssh" }
+
+func (sshProvider) Configured() bool {
+	exists, _ := VolumeExists(SSHCredentialsVolume)
+	return exists
+}
+
+func (sshProvider) Setup() error { return SetupSSHCredentials() }
+
+func (sshProvider) Test(ctx context.Context) (string, error) {
+	configured, err := CheckSSHCredentials()
+	if err != nil {
+		return "", err
+	}
+	if !configured {
+		return "", fmt.Errorf("no SSH keys stored")
+	}
+	connected, message, err := TestSSHGitHub()
+	if err != nil {
+		return "", err
+	}
+	if !connected {
+		return "", fmt.Errorf("can't authenticate to GitHub: %s", message)
+	}
+	if message != "" {
+		return "authenticated to GitHub as " + message, nil
+	}
+	return "authenticated to GitHub", nil
+}
+
+func (sshProvider) Clear() error { return ClearSSHCredentials() }
+
+// exportedProvider is credentials exported from a CLI on the host into
+// each session that's granted them. worklet doesn't store them, so setting
+// them up is logging in with the CLI.
+type exportedProvider struct {
+	name        string
+	description string
+	cli         string   // Command exporting them
+	login       []string // Command logging the CLI in, if there's one
+	hint        string   // How to set them up, without a login command
+	logout      string   // How to remove them
+}
+
+func (p *exportedProvider) Name() string { return p.name }
+
+func (p *exportedProvider) Description() string { return p.description }
+
+func (p *exportedProvider) Configured() bool {
+	switch p.name {
+	case config.CredentialKubeconfig:
+		if os.Getenv("KUBECONFIG") != "" {
+			return true
+		}
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		_, err = os.Stat(filepath.Join(homeDir, ".kube", "config"))
+		return err == nil
+	case config.CredentialDockerAuth:
+		dir, err := dockerConfigDir()
+		if err != nil {
+			return false
+		}
+		_, err = os.Stat(filepath.Join(dir, "config.json"))
+		return err == nil
+	}
+	_, err := exec.LookPath(p.cli)
+	return err == nil
+}
+
+func (p *exportedProvider) Setup() error {
+	if len(p.login) == 0 {
+		fmt.Printf("Nothing to set up: %s.\n", p.hint)
+		return nil
+	}
+	if _, err := exec.LookPath(p.login[0]); err != nil {
+		return fmt.Errorf("%s isn't installed", p.login[0])
+	}
+	fmt.Printf("Running %s\n", strings.Join(p.login, " "))
+	cmd := exec.Command(p.login[0], p.login[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", strings.Join(p.login, " "), err)
+	}
+	return nil
+}
+
+// Test exports the credentials into a temporary directory, as a session
+// start would
+func (p *exportedProvider) Test(ctx context.Context) (string, error) {
+	dir, err := os.MkdirTemp("", "worklet-credentials-test-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := exportCredential(ctx, p.name, dir, &config.CredentialConfig{}); err != nil {
+		return "", err
+	}
+	entries, _ := os.ReadDir(dir)
+	var files []string
+	for _, entry := range entries {
+		files = append(files, entry.Name())
+	}
+	return "exported " + strings.Join(files, ", "), nil
+}
+
+func (p *exportedProvider) Clear() error {
+	return fmt.Errorf("worklet doesn't store %s credentials, it exports them from %s for each session; remove them there with %s", p.name, p.cli, p.logout)
+}
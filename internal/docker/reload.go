@@ -0,0 +1,338 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// Labels recording the parts of the config `worklet reload` compares a
+// running session against
+const (
+	LabelEnvKeys    = "worklet.config.env"           // Space-separated run.environment keys
+	LabelInitHash   = "worklet.config.init.sha256"   // run.initScript
+	LabelStaticHash = "worklet.config.static.sha256" // Everything but services, environment and init script
+)
+
+// reloadLabels returns the labels reload compares a session against
+func reloadLabels(cfg *config.WorkletConfig) map[string]string {
+	keys := make([]string, 0, len(cfg.Run.Environment))
+	for key := range cfg.Run.Environment {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return map[string]string{
+		LabelEnvKeys:    strings.Join(keys, " "),
+		LabelInitHash:   initScriptHash(cfg),
+		LabelStaticHash: staticConfigHash(cfg),
+	}
+}
+
+// initScriptHash hashes a config's init script
+func initScriptHash(cfg *config.WorkletConfig) string {
+	data, _ := json.Marshal(cfg.Run.InitScript)
+	return sha256Hex(data)
+}
+
+// staticConfigHash hashes the parts of a config only a restart applies
+func staticConfigHash(cfg *config.WorkletConfig) string {
+	static := *cfg
+	static.Services = nil
+	static.Run.Environment = nil
+	static.Run.InitScript = nil
+	data, _ := json.Marshal(static)
+	return sha256Hex(data)
+}
+
+// ReloadState is what reload applied to a running session, kept on the
+// host since the container's labels and environment can't change
+type ReloadState struct {
+	Services    []config.ServiceConfig `json:"services"`
+	Environment map[string]string      `json:"environment"`
+	// ExecEnv is set in commands run in the session from then on: the
+	// environment and the service URL variables
+	ExecEnv    map[string]string `json:"exec_env"`
+	ReloadedAt time.Time         `json:"reloaded_at"`
+}
+
+// reloadStatePath returns where a session's reload state is kept
+func reloadStatePath(sessionID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "reload", sessionID+".json"), nil
+}
+
+// LoadReloadState returns what was reloaded into a session, or nil if it
+// never was
+func LoadReloadState(sessionID string) (*ReloadState, error) {
+	path, err := reloadStatePath(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read reload state: %w", err)
+	}
+	var state ReloadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse reload state: %w", err)
+	}
+	return &state, nil
+}
+
+// SaveReloadState records that cfg was reloaded into a session
+func SaveReloadState(sessionID string, cfg *config.WorkletConfig) error {
+	path, err := reloadStatePath(sessionID)
+	if err != nil {
+		return err
+	}
+	execEnv := getServiceEnvironmentVariables(cfg, sessionID)
+	for key, value := range cfg.Run.Environment {
+		execEnv[key] = value
+	}
+	state := ReloadState{
+		Services:    cfg.Services,
+		Environment: cfg.Run.Environment,
+		ExecEnv:     execEnv,
+		ReloadedAt:  time.Now(),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create reload directory: %w", err)
+	}
+	return storage.WriteFileAtomic(path, data, 0600)
+}
+
+// RemoveReloadState deletes a session's reload state. It is best effort.
+func RemoveReloadState(sessionID string) {
+	if path, err := reloadStatePath(sessionID); err == nil {
+		os.Remove(path)
+	}
+}
+
+// ExecEnvArgs returns the docker exec flags setting the environment
+// reloaded into a session, if it was
+func ExecEnvArgs(sessionID string) []string {
+	state, err := LoadReloadState(sessionID)
+	if err != nil || state == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(state.ExecEnv))
+	for key := range state.ExecEnv {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var args []string
+	for _, key := range keys {
+		args = append(args, "-e", key+"="+state.ExecEnv[key])
+	}
+	return args
+}
+
+// ReloadPlan is how a running session differs from its project's config
+type ReloadPlan struct {
+	ServicesAdded   []string `json:"services_added,omitempty"`
+	ServicesRemoved []string `json:"services_removed,omitempty"`
+	ServicesChanged []string `json:"services_changed,omitempty"`
+	EnvChanged      []string `json:"env_changed,omitempty"` // Keys added or changed
+	// Restart lists the changes reload can't apply in place
+	Restart []string `json:"restart,omitempty"`
+	// Incomplete is set for sessions started before reload labels were
+	// recorded, whose init script and other settings can't be compared
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// ServicesDiffer reports whether the session's services need updating
+func (p *ReloadPlan) ServicesDiffer() bool {
+	return len(p.ServicesAdded)+len(p.ServicesRemoved)+len(p.ServicesChanged) > 0
+}
+
+// InPlace reports whether there's anything reload can apply in place
+func (p *ReloadPlan) InPlace() bool {
+	return p.ServicesDiffer() || len(p.EnvChanged) > 0
+}
+
+// reloadBaseline is what a running session was configured with
+type reloadBaseline struct {
+	services    []config.ServiceConfig
+	environment map[string]string
+	envKnown    bool // Whether keys missing from environment were removed
+	initHash    string
+	staticHash  string
+}
+
+// PlanReload compares a running session with cfg
+func PlanReload(ctx context.Context, session *SessionInfo, cfg *config.WorkletConfig) (*ReloadPlan, error) {
+	output, err := dockerCommand(ctx, "inspect", session.ContainerID).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	var inspected []struct {
+		Config struct {
+			Env    []string          `json:"Env"`
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(output, &inspected); err != nil {
+		return nil, fmt.Errorf("failed to parse container details: %w", err)
+	}
+	if len(inspected) == 0 {
+		return nil, fmt.Errorf("container %s not found", session.ContainerID)
+	}
+
+	state, err := LoadReloadState(session.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	base := baselineFromContainer(inspected[0].Config.Labels, inspected[0].Config.Env, state)
+	return planReload(base, cfg), nil
+}
+
+// baselineFromContainer works out what a session was configured with from
+// its labels and environment, or from what was last reloaded into it
+func baselineFromContainer(labels map[string]string, env []string, state *ReloadState) reloadBaseline {
+	base := reloadBaseline{
+		initHash:   labels[LabelInitHash],
+		staticHash: labels[LabelStaticHash],
+	}
+	if state != nil {
+		base.services = state.Services
+		base.environment = state.Environment
+		base.envKnown = true
+		return base
+	}
+
+	base.services = servicesFromLabels(labels)
+	containerEnv := make(map[string]string)
+	for _, entry := range env {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			containerEnv[key] = value
+		}
+	}
+	keys, known := labels[LabelEnvKeys]
+	base.environment = make(map[string]string)
+	if known {
+		base.envKnown = true
+		for _, key := range strings.Fields(keys) {
+			base.environment[key] = containerEnv[key]
+		}
+	} else {
+		// Without the keys, treat every variable of the container as
+		// possibly coming from the config
+		base.environment = containerEnv
+	}
+	return base
+}
+
+// servicesFromLabels reads a session's services from its labels, sorted by
+// name
+func servicesFromLabels(labels map[string]string) []config.ServiceConfig {
+	byName := make(map[string]*config.ServiceConfig)
+	for key, value := range labels {
+		parts := strings.Split(key, ".")
+		if len(parts) != 4 || parts[0] != "worklet" || parts[1] != "service" {
+			continue
+		}
+		svc, ok := byName[parts[2]]
+		if !ok {
+			svc = &config.ServiceConfig{Name: parts[2]}
+			byName[parts[2]] = svc
+		}
+		switch parts[3] {
+		case "port":
+			svc.Port, _ = strconv.Atoi(value)
+		case "subdomain":
+			svc.Subdomain = value
+		case "protocol":
+			svc.Protocol = value
+		}
+	}
+	var services []config.ServiceConfig
+	for _, svc := range byName {
+		services = append(services, *svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+// labeledService returns svc with only the fields its session labels
+// record, so it compares with a service read back from them
+func labeledService(svc config.ServiceConfig) config.ServiceConfig {
+	return config.ServiceConfig{Name: svc.Name, Port: svc.Port, Subdomain: svc.Subdomain, Protocol: svc.Protocol}
+}
+
+// planReload compares what a session was configured with and cfg
+func planReload(base reloadBaseline, cfg *config.WorkletConfig) *ReloadPlan {
+	plan := &ReloadPlan{}
+
+	current := make(map[string]config.ServiceConfig)
+	for _, svc := range base.services {
+		current[svc.Name] = svc
+	}
+	wanted := make(map[string]bool)
+	for _, svc := range cfg.Services {
+		wanted[svc.Name] = true
+		old, ok := current[svc.Name]
+		switch {
+		case !ok:
+			plan.ServicesAdded = append(plan.ServicesAdded, svc.Name)
+		case old != labeledService(svc):
+			plan.ServicesChanged = append(plan.ServicesChanged, svc.Name)
+		}
+	}
+	for _, svc := range base.services {
+		if !wanted[svc.Name] {
+			plan.ServicesRemoved = append(plan.ServicesRemoved, svc.Name)
+		}
+	}
+
+	for key, value := range cfg.Run.Environment {
+		if old, ok := base.environment[key]; !ok || old != value {
+			plan.EnvChanged = append(plan.EnvChanged, key)
+		}
+	}
+	var removed []string
+	if base.envKnown {
+		for key := range base.environment {
+			if _, ok := cfg.Run.Environment[key]; !ok {
+				removed = append(removed, key)
+			}
+		}
+	}
+	sort.Strings(plan.ServicesAdded)
+	sort.Strings(plan.ServicesRemoved)
+	sort.Strings(plan.ServicesChanged)
+	sort.Strings(plan.EnvChanged)
+	sort.Strings(removed)
+	if len(removed) > 0 {
+		plan.Restart = append(plan.Restart, fmt.Sprintf("environment variables removed (they stay set until a restart): %s", strings.Join(removed, ", ")))
+	}
+
+	if base.initHash == "" || base.staticHash == "" {
+		plan.Incomplete = true
+		return plan
+	}
+	if base.initHash != initScriptHash(cfg) {
+		plan.Restart = append(plan.Restart, "run.initScript changed")
+	}
+	if base.staticHash != staticConfigHash(cfg) {
+		plan.Restart = append(plan.Restart, "settings other than services, environment and initScript changed (such as the image, volumes or credentials)")
+	}
+	return plan
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestPlanReload(t *testing.T) {
+	started := &config.WorkletConfig{
+		Name: "app",
+		Run: config.RunConfig{
+			Image:       "node:20",
+			Environment: map[string]string{"A": "1", "B": "2"},
+			InitScript:  []string{"npm install"},
+		},
+		Services: []config.ServiceConfig{
+			{Name: "api", Port: 3000, Subdomain: "api"},
+			{Name: "web", Port: 8080, Subdomain: "web"},
+		},
+	}
+	labels := reloadLabels(started)
+	labels["worklet.service.api.port"] = "3000"
+	labels["worklet.service.api.subdomain"] = "api"
+	labels["worklet.service.web.port"] = "8080"
+	labels["worklet.service.web.subdomain"] = "web"
+	env := []string{"A=1", "B=2", "PATH=/usr/bin"}
+
+	base := baselineFromContainer(labels, env, nil)
+	if plan := planReload(base, started); plan.InPlace() || len(plan.Restart) > 0 || plan.Incomplete {
+		t.Errorf("unchanged config planned %+v", plan)
+	}
+
+	// Services and environment are applied in place
+	changed := *started
+	changed.Run.Environment = map[string]string{"A": "1", "B": "3", "C": "4"}
+	changed.Services = []config.ServiceConfig{
+		{Name: "api", Port: 4000, Subdomain: "api"},
+		{Name: "db", Port: 5432, Protocol: "tcp"},
+	}
+	plan := planReload(base, &changed)
+	want := &ReloadPlan{
+		ServicesAdded:   []string{"db"},
+		ServicesRemoved: []string{"web"},
+		ServicesChanged: []string{"api"},
+		EnvChanged:      []string{"B", "C"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("plan = %+v, want %+v", plan, want)
+	}
+
+	// Removed variables, the init script and other settings need a restart
+	restart := *started
+	restart.Run.Environment = map[string]string{"A": "1"}
+	restart.Run.InitScript = []string{"npm ci"}
+	restart.Run.Image = "node:22"
+	plan = planReload(base, &restart)
+	if len(plan.Restart) != 3 || plan.InPlace() {
+		t.Errorf("plan = %+v, want 3 changes needing a restart", plan)
+	}
+
+	// Sessions without the labels only compare services and environment
+	old := map[string]string{"worklet.service.api.port": "3000", "worklet.service.api.subdomain": "api"}
+	plan = planReload(baselineFromContainer(old, env, nil), &restart)
+	if !plan.Incomplete || len(plan.Restart) != 0 {
+		t.Errorf("plan = %+v, want an incomplete plan without restarts", plan)
+	}
+}
+
+func TestPlanReloadAddonService(t *testing.T) {
+	cfg := &config.WorkletConfig{
+		Name:   "shop",
+		Addons: []config.AddonConfig{{Type: config.AddonMinIO, Name: "storage"}},
+	}
+	cfg.ApplyAddons()
+	labels := reloadLabels(cfg)
+	labels["worklet.service.storage.port"] = "9001"
+	labels["worklet.service.storage.subdomain"] = "storage"
+	labels["worklet.service.storage.host"] = "shop-abc123-storage"
+
+	base := baselineFromContainer(labels, nil, nil)
+	if plan := planReload(base, cfg); plan.InPlace() || len(plan.Restart) > 0 {
+		t.Errorf("unchanged add-on service planned %+v", plan)
+	}
+	if host := ServiceHost(cfg, "abc123", cfg.Services[0]); host != "shop-abc123-storage" {
+		t.Errorf("ServiceHost() = %q, want shop-abc123-storage", host)
+	}
+}
+
+func TestReloadState(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "worklet-reload-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("HOME", tmpDir)
+
+	if args := ExecEnvArgs("s1"); args != nil {
+		t.Errorf("ExecEnvArgs before a reload = %v, want none", args)
+	}
+
+	cfg := &config.WorkletConfig{
+		Name: "app",
+		Run:  config.RunConfig{Environment: map[string]string{"FOO": "bar"}},
+	}
+	if err := SaveReloadState("s1", cfg); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadReloadState("s1")
+	if err != nil || state == nil {
+		t.Fatalf("LoadReloadState = %v, %v", state, err)
+	}
+
+	// A reloaded session is compared with what was reloaded
+	base := baselineFromContainer(reloadLabels(cfg), []string{"FOO=old"}, state)
+	if plan := planReload(base, cfg); plan.InPlace() {
+		t.Errorf("plan after reload = %+v, want nothing to apply", plan)
+	}
+
+	want := []string{"-e", "FOO=bar", "-e", "WORKLET_PROJECT_NAME=app", "-e", "WORKLET_SESSION_ID=s1"}
+	if args := ExecEnvArgs("s1"); !reflect.DeepEqual(args, want) {
+		t.Errorf("ExecEnvArgs = %v", args)
+	}
+
+	RemoveReloadState("s1")
+	if state, _ := LoadReloadState("s1"); state != nil {
+		t.Errorf("state left after RemoveReloadState: %+v", state)
+	}
+}
@@ -0,0 +1,243 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/nolanleung/worklet/internal/gitcache"
+)
+
+// What a session is assumed to need when nothing caps it. Full isolation
+// runs a Docker daemon of its own, whose data volume starts out holding the
+// compose services' images.
+const (
+	sharedSessionMemory = 256 * units.MiB
+	fullSessionMemory   = 1 * units.GiB
+	dindVolumeBaseline  = 3 * units.GiB
+)
+
+// resourceHeadroom is the share of what's available a session may take
+// before starting it warns
+const resourceHeadroom = 0.8
+
+// ResourceEstimate is what starting a session is expected to take
+type ResourceEstimate struct {
+	Memory int64 // Bytes of memory
+	Disk   int64 // Bytes of disk on the Docker host
+	// Parts describes what the estimate is made of, e.g. "2 GiB DinD volume"
+	Parts []string
+}
+
+// HostResources is what the Docker host has available. Zero means unknown.
+type HostResources struct {
+	Memory int64
+	Disk   int64
+}
+
+// ResourceError is returned when a session would need more than the
+// Docker host has available
+type ResourceError struct {
+	Problems []string
+	Estimate ResourceEstimate
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("not enough resources to start the session: %s (estimated from %s; start it anyway with --ignore-resources)",
+		strings.Join(e.Problems, "; "), strings.Join(e.Estimate.Parts, ", "))
+}
+
+// CheckResources estimates what the session opts describes needs and
+// compares it with what the Docker host has available. It returns a
+// *ResourceError if the session wouldn't fit, and warns when it would leave
+// little to spare. Unless run.memory caps it, a session can of course grow
+// past the estimate.
+func CheckResources(ctx context.Context, opts RunOptions) error {
+	if opts.IgnoreResources {
+		return nil
+	}
+	estimate := EstimateResources(ctx, opts)
+	available := AvailableResources(ctx)
+	problems, warnings := compareResources(estimate, available)
+	for _, warning := range warnings {
+		fmt.Fprintf(Output, "Warning: %s\n", warning)
+	}
+	if len(problems) > 0 {
+		return &ResourceError{Problems: problems, Estimate: estimate}
+	}
+	return nil
+}
+
+// EstimateResources estimates what starting the session opts describes
+// takes: its memory limit or a baseline for its isolation mode, the base
+// image if it still has to be pulled, the workspace copied into an image in
+// copy mode, and the DinD volume in full isolation
+func EstimateResources(ctx context.Context, opts RunOptions) ResourceEstimate {
+	var estimate ResourceEstimate
+
+	limit, _ := opts.Config.Run.MemoryLimit()
+	switch {
+	case limit > 0:
+		estimate.Memory = limit
+		estimate.Parts = append(estimate.Parts, fmt.Sprintf("%s memory limit", units.BytesSize(float64(limit))))
+	case isolationMode(opts.Config) == "full":
+		estimate.Memory = fullSessionMemory
+		estimate.Parts = append(estimate.Parts, fmt.Sprintf("%s memory for a session with its own Docker daemon", units.BytesSize(fullSessionMemory)))
+	default:
+		estimate.Memory = sharedSessionMemory
+		estimate.Parts = append(estimate.Parts, fmt.Sprintf("%s memory", units.BytesSize(sharedSessionMemory)))
+	}
+
+	// Images already on the host are shared by every session using them
+	image := opts.baseImage()
+	if dockerCommand(ctx, "image", "inspect", image).Run() != nil {
+		if size := remoteImageSize(ctx, image); size > 0 {
+			estimate.Disk += size
+			estimate.Parts = append(estimate.Parts, fmt.Sprintf("%s to pull %s", units.HumanSize(float64(size)), image))
+		}
+	}
+
+	if !opts.MountMode && !useOverlay(opts) {
+		size := gitcache.DirSize(opts.WorkDir)
+		estimate.Disk += size
+		estimate.Parts = append(estimate.Parts, fmt.Sprintf("%s workspace image", units.HumanSize(float64(size))))
+	}
+
+	if isolationMode(opts.Config) == "full" {
+		estimate.Disk += dindVolumeBaseline
+		estimate.Parts = append(estimate.Parts, fmt.Sprintf("%s DinD volume", units.BytesSize(dindVolumeBaseline)))
+	}
+	return estimate
+}
+
+// remoteImageSize returns the compressed size of an image in its registry,
+// or 0 if it can't be found out
+func remoteImageSize(ctx context.Context, image string) int64 {
+	output, err := dockerCommand(ctx, "manifest", "inspect", "-v", image).Output()
+	if err != nil {
+		return 0
+	}
+	// A single-platform image is one manifest, a multi-platform image a
+	// list of them; per-platform images are close enough in size for an
+	// estimate, so the first is used
+	type layers struct {
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+	}
+	type manifest struct {
+		SchemaV2Manifest *layers `json:"SchemaV2Manifest"`
+		OCIManifest      *layers `json:"OCIManifest"`
+	}
+	var manifests []manifest
+	if err := json.Unmarshal(output, &manifests); err != nil {
+		var single manifest
+		if err := json.Unmarshal(output, &single); err != nil {
+			return 0
+		}
+		manifests = []manifest{single}
+	}
+	for _, m := range manifests {
+		found := m.SchemaV2Manifest
+		if found == nil {
+			found = m.OCIManifest
+		}
+		if found == nil {
+			continue
+		}
+		var size int64
+		for _, layer := range found.Layers {
+			size += layer.Size
+		}
+		return size
+	}
+	return 0
+}
+
+// AvailableResources returns the memory and disk the Docker host has left:
+// its memory less what running containers use, bounded by what the
+// machine has free when Docker runs on it, and the free space where Docker
+// keeps its data if that's on this machine
+func AvailableResources(ctx context.Context) HostResources {
+	var available HostResources
+
+	output, err := dockerCommand(ctx, "info", "--format", "{{.MemTotal}} {{.DockerRootDir}} {{.OperatingSystem}}").Output()
+	if err != nil {
+		return available
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) < 2 {
+		return available
+	}
+	total, _ := strconv.ParseInt(fields[0], 10, 64)
+	if total > 0 {
+		available.Memory = total - runningContainersMemory(ctx)
+	}
+
+	// Docker Desktop keeps its data and memory in a VM, so the machine's
+	// own figures don't apply
+	local := runtime.GOOS == "linux" && remoteDockerHost() == "" && !strings.Contains(string(output), "Docker Desktop")
+	if !local {
+		return available
+	}
+	if free := hostAvailableMemory(); free > 0 && (available.Memory <= 0 || free < available.Memory) {
+		available.Memory = free
+	}
+	available.Disk = freeDiskSpace(fields[1])
+	return available
+}
+
+// runningContainersMemory sums the memory running containers use
+func runningContainersMemory(ctx context.Context) int64 {
+	stats, err := sampleStats(dockerCommand(ctx, "stats", "--no-stream", "--format", "{{json .}}"))
+	if err != nil {
+		return 0
+	}
+	var used int64
+	for _, s := range stats {
+		used += int64(s.MemUsage)
+	}
+	return used
+}
+
+// hostAvailableMemory returns MemAvailable from /proc/meminfo, or 0
+func hostAvailableMemory() int64 {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "MemAvailable:"); ok {
+			kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			if err != nil {
+				return 0
+			}
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// compareResources returns why a session estimated to need estimate can't
+// start with available left, and warnings if it would leave little
+func compareResources(estimate ResourceEstimate, available HostResources) (problems, warnings []string) {
+	check := func(what string, need, have int64) {
+		if need <= 0 || have <= 0 {
+			return
+		}
+		switch {
+		case need > have:
+			problems = append(problems, fmt.Sprintf("needs about %s of %s but only %s is available", units.BytesSize(float64(need)), what, units.BytesSize(float64(have))))
+		case float64(need) > resourceHeadroom*float64(have):
+			warnings = append(warnings, fmt.Sprintf("the session needs about %s of %s, leaving only %s free", units.BytesSize(float64(need)), what, units.BytesSize(float64(have-need))))
+		}
+	}
+	check("memory", estimate.Memory, available.Memory)
+	check("disk", estimate.Disk, available.Disk)
+	return problems, warnings
+}
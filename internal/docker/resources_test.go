@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/go-units"
+)
+
+func TestCompareResources(t *testing.T) {
+	estimate := ResourceEstimate{Memory: 1 * units.GiB, Disk: 3 * units.GiB}
+
+	// Plenty left
+	problems, warnings := compareResources(estimate, HostResources{Memory: 16 * units.GiB, Disk: 100 * units.GiB})
+	if len(problems) != 0 || len(warnings) != 0 {
+		t.Errorf("expected no problems or warnings, got %v %v", problems, warnings)
+	}
+
+	// Fits, but only just
+	problems, warnings = compareResources(estimate, HostResources{Memory: 1100 * units.MiB, Disk: 100 * units.GiB})
+	if len(problems) != 0 || len(warnings) != 1 || !strings.Contains(warnings[0], "memory") {
+		t.Errorf("expected a memory warning, got %v %v", problems, warnings)
+	}
+
+	// Doesn't fit
+	problems, _ = compareResources(estimate, HostResources{Memory: 16 * units.GiB, Disk: 2 * units.GiB})
+	if len(problems) != 1 || !strings.Contains(problems[0], "disk") {
+		t.Errorf("expected a disk problem, got %v", problems)
+	}
+
+	// Unknown availability is never a problem
+	problems, warnings = compareResources(estimate, HostResources{})
+	if len(problems) != 0 || len(warnings) != 0 {
+		t.Errorf("expected unknown resources to pass, got %v %v", problems, warnings)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package docker
+
+// freeDiskSpace isn't implemented on Windows, where Docker keeps its data
+// in a VM anyway
+func freeDiskSpace(path string) int64 {
+	return 0
+}
@@ -0,0 +1,111 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// FakeDockerEnv switches worklet to an in-memory fake of the Docker API when
+// set to "1" or to the path of a JSON file of containers to start with, so
+// the daemon and TUI can be developed and tested without a Docker daemon
+const FakeDockerEnv = "WORKLET_FAKE_DOCKER"
+
+// Runtime is the part of the Docker API worklet uses to list, stop and
+// follow session containers and to clean up their networks. *client.Client
+// implements it, and FakeRuntime in fake mode.
+type Runtime interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	NetworkList(ctx context.Context, options network.ListOptions) ([]network.Summary, error)
+	NetworkInspect(ctx context.Context, networkID string, options network.InspectOptions) (network.Inspect, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	Ping(ctx context.Context) (types.Ping, error)
+	Close() error
+}
+
+var (
+	_ Runtime = (*client.Client)(nil)
+	_ Runtime = (*FakeRuntime)(nil)
+)
+
+var (
+	fakeRuntimeOnce sync.Once
+	fakeRuntime     *FakeRuntime
+	fakeRuntimeErr  error
+)
+
+// fakeMode reports whether WORKLET_FAKE_DOCKER is set
+func fakeMode() bool {
+	switch strings.ToLower(os.Getenv(FakeDockerEnv)) {
+	case "", "0", "false", "off":
+		return false
+	}
+	return true
+}
+
+// NewRuntime returns a Docker client, or in fake mode the process's fake.
+// This is where the fake is swapped in: code that talks to Docker through
+// the Runtime it returns works the same against either.
+func NewRuntime() (Runtime, error) {
+	if fakeMode() {
+		return SharedFakeRuntime()
+	}
+	opts := []client.Opt{client.FromEnv}
+	if host := contextSocket(); host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+	}
+	return cli, nil
+}
+
+var (
+	contextSocketOnce sync.Once
+	contextSocketHost string
+)
+
+// contextSocket returns the socket of the current docker context when
+// DOCKER_HOST isn't set and the context uses a local socket, as Docker
+// Desktop's and colima's do, so the client talks to the daemon the docker
+// CLI does
+func contextSocket() string {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return ""
+	}
+	contextSocketOnce.Do(func() {
+		host := dockerContextHost()
+		if strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "npipe://") {
+			contextSocketHost = host
+		}
+	})
+	return contextSocketHost
+}
+
+// SharedFakeRuntime returns the fake every part of the process shares in
+// fake mode, loading its containers from WORKLET_FAKE_DOCKER if that names a
+// file
+func SharedFakeRuntime() (*FakeRuntime, error) {
+	fakeRuntimeOnce.Do(func() {
+		fakeRuntime = NewFakeRuntime()
+		switch value := os.Getenv(FakeDockerEnv); strings.ToLower(value) {
+		case "1", "true", "on":
+		default:
+			fakeRuntimeErr = fakeRuntime.Load(value)
+		}
+	})
+	return fakeRuntime, fakeRuntimeErr
+}
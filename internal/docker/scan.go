@@ -0,0 +1,256 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// ScanResult is the outcome of scanning an image for vulnerabilities. It's
+// cached by image ID, so each image is only scanned before its first run.
+type ScanResult struct {
+	Image     string         `json:"image"`
+	ImageID   string         `json:"image_id"`
+	Scanner   string         `json:"scanner"`
+	ScannedAt time.Time      `json:"scanned_at"`
+	Counts    map[string]int `json:"counts"` // Vulnerabilities by lowercase severity
+}
+
+// AtOrAbove returns how many vulnerabilities are of severity or higher
+func (r *ScanResult) AtOrAbove(severity string) int {
+	rank := config.SeverityRank(severity)
+	total := 0
+	for s, n := range r.Counts {
+		if config.SeverityRank(s) >= rank && rank >= 0 {
+			total += n
+		}
+	}
+	return total
+}
+
+// Summary lists the counts of each severity, highest first
+func (r *ScanResult) Summary() string {
+	var parts []string
+	for i := len(config.Severities) - 1; i >= 0; i-- {
+		if n := r.Counts[config.Severities[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, config.Severities[i]))
+		}
+	}
+	if len(parts) == 0 {
+		return "no known vulnerabilities"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scanCachePath returns where the scan of an image ID is cached
+func scanCachePath(imageID string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "scans", strings.TrimPrefix(imageID, "sha256:")+".json"), nil
+}
+
+// scanImage scans a session's base image when the global config or policy
+// turns scanning on, warning about vulnerabilities at or above warnAt and
+// failing at or above blockAt
+func scanImage(ctx context.Context, opts RunOptions) error {
+	policy, err := config.LoadPolicy()
+	if err != nil {
+		return err
+	}
+	var global config.ScanConfig
+	if cfg, err := config.LoadGlobalConfig(); err == nil {
+		global = cfg.Scan
+	}
+	settings, enabled := config.ScanSettings(global, policy)
+	if !enabled {
+		return nil
+	}
+
+	image := opts.baseImage()
+	opts.Progress.Start(PhaseScan, "Scanning "+image)
+	result, err := ScanImage(ctx, image, settings.Scanner)
+	if err != nil {
+		if _, missing := err.(*noScannerError); missing && !settings.Required {
+			opts.Progress.Done(PhaseScan, "skipped")
+			fmt.Fprintf(Output, "Warning: %v; not scanning %s\n", err, image)
+			return nil
+		}
+		opts.Progress.Fail(PhaseScan, err)
+		return fmt.Errorf("failed to scan image %s: %w", image, err)
+	}
+
+	if settings.BlockAt != "" && result.AtOrAbove(settings.BlockAt) > 0 {
+		err := fmt.Errorf("image %s has %s, and vulnerabilities of %s severity or higher block sessions", image, result.Summary(), settings.BlockAt)
+		opts.Progress.Fail(PhaseScan, err)
+		return err
+	}
+	opts.Progress.Done(PhaseScan, result.Summary())
+	if n := result.AtOrAbove(settings.WarnAt); n > 0 {
+		fmt.Fprintf(Output, "Warning: image %s has %s (scanned by %s)\n", image, result.Summary(), result.Scanner)
+	}
+	return nil
+}
+
+// noScannerError is returned when no vulnerability scanner is installed
+type noScannerError struct {
+	scanner string
+}
+
+func (e *noScannerError) Error() string {
+	if e.scanner == config.ScannerAuto {
+		return "no vulnerability scanner found (install trivy or grype)"
+	}
+	return fmt.Sprintf("%s isn't installed", e.scanner)
+}
+
+// findScanner returns the scanner to run for a scan.scanner setting
+func findScanner(scanner string) (string, error) {
+	candidates := []string{scanner}
+	if scanner == config.ScannerAuto || scanner == "" {
+		scanner = config.ScannerAuto
+		candidates = []string{config.ScannerTrivy, config.ScannerGrype}
+	}
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", &noScannerError{scanner: scanner}
+}
+
+// ScanImage scans image with scanner, pulling it first if it's missing.
+// Results are cached by image ID, so an image is only scanned again once
+// it changes.
+func ScanImage(ctx context.Context, image, scanner string) (*ScanResult, error) {
+	imageID, err := localImageID(ctx, image)
+	if err != nil {
+		if output, err := dockerCommand(ctx, "pull", image).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("failed to pull image: %w\nOutput: %s", err, string(output))
+		}
+		if imageID, err = localImageID(ctx, image); err != nil {
+			return nil, err
+		}
+	}
+
+	cachePath, cacheErr := scanCachePath(imageID)
+	if cacheErr == nil {
+		if data, err := os.ReadFile(cachePath); err == nil {
+			var cached ScanResult
+			if json.Unmarshal(data, &cached) == nil {
+				return &cached, nil
+			}
+		}
+	}
+
+	name, err := findScanner(scanner)
+	if err != nil {
+		return nil, err
+	}
+	var severities []string
+	switch name {
+	case config.ScannerTrivy:
+		severities, err = runTrivy(ctx, image)
+	case config.ScannerGrype:
+		severities, err = runGrype(ctx, image)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScanResult{
+		Image:     image,
+		ImageID:   imageID,
+		Scanner:   name,
+		ScannedAt: time.Now(),
+		Counts:    make(map[string]int),
+	}
+	for _, severity := range severities {
+		result.Counts[strings.ToLower(severity)]++
+	}
+
+	if cacheErr == nil {
+		if data, err := json.MarshalIndent(result, "", "  "); err == nil {
+			if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+				storage.WriteFileAtomic(cachePath, data, 0644)
+			}
+		}
+	}
+	return result, nil
+}
+
+// localImageID returns the ID of an image present locally
+func localImageID(ctx context.Context, image string) (string, error) {
+	output, err := dockerCommand(ctx, "image", "inspect", "--format", "{{.Id}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("image %s not found", image)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// runTrivy scans image with Trivy and returns the severity of each
+// vulnerability found
+func runTrivy(ctx context.Context, image string) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "trivy", "image", "--quiet", "--format", "json", "--scanners", "vuln", image).Output()
+	if err != nil {
+		return nil, scannerError("trivy", err)
+	}
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				Severity string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy report: %w", err)
+	}
+	var severities []string
+	for _, result := range report.Results {
+		for _, vuln := range result.Vulnerabilities {
+			severities = append(severities, vuln.Severity)
+		}
+	}
+	return severities, nil
+}
+
+// runGrype scans image with Grype and returns the severity of each
+// vulnerability found
+func runGrype(ctx context.Context, image string) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "grype", "--quiet", "--output", "json", image).Output()
+	if err != nil {
+		return nil, scannerError("grype", err)
+	}
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				Severity string `json:"severity"`
+			} `json:"vulnerability"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse grype report: %w", err)
+	}
+	var severities []string
+	for _, match := range report.Matches {
+		severities = append(severities, match.Vulnerability.Severity)
+	}
+	return severities, nil
+}
+
+// scannerError describes a scanner that failed, with its stderr
+func scannerError(name string, err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%s failed: %w\nStderr: %s", name, err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return fmt.Errorf("%s failed: %w", name, err)
+}
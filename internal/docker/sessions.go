@@ -3,12 +3,17 @@ package docker
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
 	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/nolanleung/worklet/internal/config"
 )
 
 // SessionInfo represents information about a worklet session container
@@ -24,6 +29,10 @@ type SessionInfo struct {
 	CreatedAt     time.Time         `json:"created_at"`
 }
 
+// LabelAlias records the project alias a session is served under while it's
+// the most recently started healthy session with it
+const LabelAlias = "worklet.alias"
+
 // ListSessions returns all running worklet sessions discovered via Docker API
 func ListSessions(ctx context.Context) ([]SessionInfo, error) {
 	return listSessionsWithFilter(ctx, false)
@@ -36,68 +45,49 @@ func ListAllSessions(ctx context.Context) ([]SessionInfo, error) {
 
 // listSessionsWithFilter is the internal implementation that can list running or all sessions
 func listSessionsWithFilter(ctx context.Context, includesStopped bool) ([]SessionInfo, error) {
-	// Build docker command based on whether we want all containers or just running ones
-	args := []string{"ps"}
-	if includesStopped {
-		args = append(args, "-a")
+	rt, err := NewRuntime()
+	if err != nil {
+		return nil, err
 	}
-	args = append(args, "--filter", "label=worklet.session=true", "--format", "json")
+	defer rt.Close()
 
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	output, err := cmd.Output()
+	containers, err := rt.ContainerList(ctx, container.ListOptions{
+		All:     includesStopped,
+		Filters: filters.NewArgs(filters.Arg("label", "worklet.session=true")),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list docker containers: %w", err)
 	}
 
 	var sessions []SessionInfo
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		var container struct {
-			ID        string `json:"ID"`
-			Names     string `json:"Names"`
-			State     string `json:"State"`
-			Status    string `json:"Status"`
-			Labels    string `json:"Labels"`
-			CreatedAt string `json:"CreatedAt"`
-		}
-
-		if err := json.Unmarshal([]byte(line), &container); err != nil {
-			continue // Skip malformed lines
-		}
-
-		// Parse labels
-		labels := parseLabels(container.Labels)
-
+	for _, c := range containers {
 		// Extract session info from labels
-		sessionID := labels["worklet.session.id"]
+		sessionID := c.Labels["worklet.session.id"]
 		if sessionID == "" {
 			continue // Skip containers without session ID
 		}
 
 		session := SessionInfo{
-			SessionID:     sessionID,
-			ProjectName:   labels["worklet.project.name"],
-			ContainerID:   container.ID,
-			ContainerName: container.Names,
-			WorkDir:       labels["worklet.workdir"],
-			Status:        container.State,
-			Labels:        labels,
+			SessionID:   sessionID,
+			ProjectName: c.Labels["worklet.project.name"],
+			ContainerID: c.ID,
+			WorkDir:     c.Labels["worklet.workdir"],
+			Status:      string(c.State),
+			Labels:      c.Labels,
+			CreatedAt:   time.Unix(c.Created, 0),
 		}
-
-		// Parse creation time
-		if container.CreatedAt != "" {
-			session.CreatedAt, _ = time.Parse("2006-01-02 15:04:05 -0700 MST", container.CreatedAt)
-		} else {
-			session.CreatedAt = time.Now() // Fallback to now if parsing fails
+		if len(c.Names) > 0 {
+			session.ContainerName = strings.TrimPrefix(c.Names[0], "/")
 		}
 
-		// Extract services from labels
-		session.Services = extractServicesFromLabels(labels)
+		// Extract services from labels, or what was since reloaded
+		session.Services = extractServicesFromLabels(c.Labels)
+		if state, err := LoadReloadState(sessionID); err == nil && state != nil {
+			session.Services = nil
+			for _, svc := range state.Services {
+				session.Services = append(session.Services, ServiceInfo{Name: svc.Name, Port: svc.Port, Subdomain: svc.Subdomain})
+			}
+		}
 
 		sessions = append(sessions, session)
 	}
@@ -121,6 +111,25 @@ func GetSessionInfo(ctx context.Context, sessionID string) (*SessionInfo, error)
 	return nil, fmt.Errorf("session %s not found", sessionID)
 }
 
+// ContainerNameInUse reports whether a container, running or not, already
+// has the given name
+func ContainerNameInUse(ctx context.Context, name string) (bool, error) {
+	cli, err := NewRuntime()
+	if err != nil {
+		return false, err
+	}
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", "^/"+regexp.QuoteMeta(name)+"$")),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list containers: %w", err)
+	}
+	return len(containers) > 0, nil
+}
+
 // ListSessionsByProject returns all sessions for a specific project
 func ListSessionsByProject(ctx context.Context, projectName string) ([]SessionInfo, error) {
 	sessions, err := ListSessions(ctx)
@@ -145,12 +154,55 @@ func StopSession(ctx context.Context, sessionID string) error {
 		return fmt.Errorf("failed to get session info: %w", err)
 	}
 
-	cmd := exec.CommandContext(ctx, "docker", "stop", session.ContainerID)
-	if err := cmd.Run(); err != nil {
+	rt, err := NewRuntime()
+	if err != nil {
+		return err
+	}
+	defer rt.Close()
+	if err := rt.ContainerStop(ctx, session.ContainerID, container.StopOptions{}); err != nil {
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
 
-	return nil
+	return stopAddons(ctx, sessionID)
+}
+
+// ErrSessionNotFound is returned when no container belongs to a session
+var ErrSessionNotFound = errors.New("session not found")
+
+// WaitSession blocks until a session's main command exits, or ctx is done,
+// and returns its exit code. It returns straight away for a session that
+// has already exited, as long as its container hasn't been removed.
+func WaitSession(ctx context.Context, sessionID string) (int, error) {
+	sessions, err := ListAllSessions(ctx)
+	if err != nil {
+		return -1, err
+	}
+	var session *SessionInfo
+	for i := range sessions {
+		if sessions[i].SessionID == sessionID {
+			session = &sessions[i]
+			break
+		}
+	}
+	if session == nil {
+		return -1, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+
+	rt, err := NewRuntime()
+	if err != nil {
+		return -1, err
+	}
+	defer rt.Close()
+	results, errs := rt.ContainerWait(ctx, session.ContainerID, container.WaitConditionNotRunning)
+	select {
+	case result := <-results:
+		return int(result.StatusCode), nil
+	case err := <-errs:
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		}
+		return -1, fmt.Errorf("failed to wait for container: %w", err)
+	}
 }
 
 // RemoveSession removes a worklet session and all associated resources
@@ -174,8 +226,11 @@ func AttachToSession(ctx context.Context, sessionID string) error {
 
 	// Check if container is running
 	if session.Status != "running" {
-		// Start the container if it's not running
-		startCmd := exec.CommandContext(ctx, "docker", "start", session.ContainerID)
+		// Start the container if it's not running, after its add-ons
+		if err := startStoppedAddons(ctx, sessionID); err != nil {
+			return err
+		}
+		startCmd := dockerCommand(ctx, "start", session.ContainerID)
 		if err := startCmd.Run(); err != nil {
 			return fmt.Errorf("failed to start container: %w", err)
 		}
@@ -188,7 +243,9 @@ func AttachToSession(ctx context.Context, sessionID string) error {
 	}
 
 	// Use docker exec -it for a full interactive terminal experience with a new shell
-	cmd := exec.Command("docker", "exec", "-it", "-e", "TERM="+term, session.ContainerID, "/bin/sh")
+	args := append([]string{"exec", "-it", "-e", "TERM=" + term}, ExecEnvArgs(session.SessionID)...)
+	args = append(args, ExecUserArgs(session.ContainerID)...)
+	cmd := dockerCommand(context.Background(), append(append(args, session.ContainerID), ShellCommand()...)...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -196,24 +253,6 @@ func AttachToSession(ctx context.Context, sessionID string) error {
 	return cmd.Run()
 }
 
-// parseLabels parses Docker labels from a comma-separated string
-func parseLabels(labelStr string) map[string]string {
-	labels := make(map[string]string)
-	if labelStr == "" {
-		return labels
-	}
-
-	pairs := strings.Split(labelStr, ",")
-	for _, pair := range pairs {
-		parts := strings.SplitN(pair, "=", 2)
-		if len(parts) == 2 {
-			labels[parts[0]] = parts[1]
-		}
-	}
-
-	return labels
-}
-
 // extractServicesFromLabels extracts service information from container labels
 func extractServicesFromLabels(labels map[string]string) []ServiceInfo {
 	serviceMap := make(map[string]*ServiceInfo)
@@ -255,7 +294,7 @@ func GetSessionDNSName(session SessionInfo, service ServiceInfo) string {
 	if subdomain == "" {
 		subdomain = service.Name
 	}
-	return fmt.Sprintf("http://%s.%s-%s.local.worklet.sh", subdomain, session.ProjectName, session.SessionID)
+	return config.ServiceURL(subdomain, session.ProjectName, session.SessionID)
 }
 
 func TailLogs(ctx context.Context, containerID string, output chan<- string) error {
@@ -265,7 +304,7 @@ func TailLogs(ctx context.Context, containerID string, output chan<- string) err
 	}
 
 	// Show last 10 lines and follow
-	cmd := exec.CommandContext(ctx, "docker", "logs", "--tail", "10", "-tf", session.ContainerID)
+	cmd := dockerCommand(ctx, "logs", "--tail", "10", "-tf", session.ContainerID)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return fmt.Errorf("failed to get stdout pipe: %w", err)
@@ -314,8 +353,11 @@ func ExecShell(ctx context.Context, sessionID string) (*exec.Cmd, error) {
 
 	// Check if container is running
 	if session.Status != "running" {
-		// Start the container if it's not running
-		startCmd := exec.CommandContext(ctx, "docker", "start", session.ContainerID)
+		// Start the container if it's not running, after its add-ons
+		if err := startStoppedAddons(ctx, sessionID); err != nil {
+			return nil, err
+		}
+		startCmd := dockerCommand(ctx, "start", session.ContainerID)
 		if err := startCmd.Run(); err != nil {
 			return nil, fmt.Errorf("failed to start container: %w", err)
 		}
@@ -329,7 +371,9 @@ func ExecShell(ctx context.Context, sessionID string) (*exec.Cmd, error) {
 
 	// Create an interactive shell command without -t flag (PTY will handle this)
 	// Using -i flag for interactive input and -e to set TERM environment variable
-	cmd := exec.CommandContext(ctx, "docker", "exec", "-i", "-e", "TERM="+term, session.ContainerID, "/bin/sh")
+	args := append([]string{"exec", "-i", "-e", "TERM=" + term}, ExecEnvArgs(session.SessionID)...)
+	args = append(args, ExecUserArgs(session.ContainerID)...)
+	cmd := dockerCommand(ctx, append(append(args, session.ContainerID), ShellCommand()...)...)
 	
 	return cmd, nil
 }
@@ -0,0 +1,46 @@
+package docker
+
+// shellScript starts an interactive shell in a session: $WORKLET_SHELL
+// (run.shell), else the user's login shell if it's bash, zsh or fish, else
+// the first of those the image has, else sh. With $WORKLET_SHELL_LOGIN it's
+// a login shell.
+const shellScript = `login=
+if [ -n "$WORKLET_SHELL_LOGIN" ]; then
+	login=-l
+fi
+if [ -n "$WORKLET_SHELL" ] && command -v "$WORKLET_SHELL" >/dev/null 2>&1; then
+	exec "$WORKLET_SHELL" $login
+fi
+shell=$(awk -F: -v u="$(id -u)" '$3 == u { print $7; exit }' /etc/passwd 2>/dev/null)
+case "${shell##*/}" in
+	bash|zsh|fish)
+		if [ -x "$shell" ]; then
+			exec "$shell" $login
+		fi
+		;;
+esac
+for shell in bash zsh fish; do
+	if command -v "$shell" >/dev/null 2>&1; then
+		exec "$shell" $login
+	fi
+done
+exec sh $login`
+
+// ShellCommand returns the command starting an interactive shell in a
+// session container
+func ShellCommand() []string {
+	return []string{"sh", "-c", shellScript, "worklet-shell"}
+}
+
+// ShellEnvArgs returns the docker exec flags overriding a session's
+// run.shell and run.loginShell for one shell
+func ShellEnvArgs(shell string, login bool) []string {
+	var args []string
+	if shell != "" {
+		args = append(args, "-e", "WORKLET_SHELL="+shell)
+	}
+	if login {
+		args = append(args, "-e", "WORKLET_SHELL_LOGIN=1")
+	}
+	return args
+}
@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestShellEnvArgs(t *testing.T) {
+	if args := ShellEnvArgs("", false); len(args) != 0 {
+		t.Errorf("expected no flags by default, got %v", args)
+	}
+	expected := []string{"-e", "WORKLET_SHELL=zsh", "-e", "WORKLET_SHELL_LOGIN=1"}
+	if args := ShellEnvArgs("zsh", true); !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+}
+
+func TestShellScriptPicksShell(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	tempDir, err := os.MkdirTemp("", "worklet-shell-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A fake fish that reports how it was started
+	fish := filepath.Join(tempDir, "fish")
+	if err := os.WriteFile(fish, []byte("#!/bin/sh\necho \"fish $*\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := ShellCommand()
+	run := exec.Command(cmd[0], cmd[1:]...)
+	run.Env = append(os.Environ(), "PATH="+tempDir+":"+os.Getenv("PATH"), "WORKLET_SHELL=fish", "WORKLET_SHELL_LOGIN=1")
+	out, err := run.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "fish -l" {
+		t.Errorf("expected run.shell started as a login shell, got %q", got)
+	}
+}
+
+func TestBuildRunArgsShell(t *testing.T) {
+	opts := RunOptions{
+		WorkDir:   "/tmp/project",
+		Config:    &config.WorkletConfig{Name: "test", Run: config.RunConfig{Isolation: "shared", Shell: "zsh", LoginShell: true}},
+		SessionID: "abc123",
+		MountMode: true,
+	}
+
+	args, err := buildRunArgs(opts, "node:20", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"-e WORKLET_SHELL=zsh", "-e WORKLET_SHELL_LOGIN=1"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected %s in %v", expected, args)
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package docker
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -63,7 +63,7 @@ func SetupSSHCredentials() error {
 		ls -la /ssh-config/`,
 	}
 
-	cmd := exec.Command("docker", args...)
+	cmd := dockerCommand(context.Background(), args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
@@ -101,7 +101,7 @@ func CheckSSHCredentials() (bool, error) {
 		"ls /ssh-config/id_* 2>/dev/null | grep -q . && echo 'configured' || echo 'not configured'",
 	}
 
-	cmd := exec.Command("docker", args...)
+	cmd := dockerCommand(context.Background(), args...)
 	output, err := cmd.Output()
 	if err != nil {
 		return false, fmt.Errorf("failed to check SSH credentials: %w", err)
@@ -136,7 +136,7 @@ func TestSSHGitHub() (bool, string, error) {
 		 ssh -o StrictHostKeyChecking=no -o ConnectTimeout=5 -T git@github.com 2>&1 || true`,
 	}
 	
-	cmd := exec.Command("docker", args...)
+	cmd := dockerCommand(context.Background(), args...)
 	output, _ := cmd.Output() // Ignore error as SSH returns 1 even on successful auth
 	
 	outputStr := strings.TrimSpace(string(output))
@@ -228,26 +228,28 @@ func GetSSHInitScript(mountSSH bool) string {
 		return ""
 	}
 
-	// Return script to set up SSH configuration
+	// Return script to set up SSH configuration in the home directory of
+	// the session's user
 	return `# Set up SSH configuration
 if [ -d /ssh-config ]; then
-	mkdir -p /root/.ssh
-	chmod 700 /root/.ssh
+	home="${WORKLET_HOME:-$HOME}"
+	mkdir -p "$home/.ssh"
+	chmod 700 "$home/.ssh"
 	
 	# Copy SSH files from volume
-	cp -r /ssh-config/* /root/.ssh/ 2>/dev/null || true
+	cp -r /ssh-config/* "$home/.ssh/" 2>/dev/null || true
 	
 	# Set proper permissions
-	chmod 600 /root/.ssh/id_* 2>/dev/null || true
-	chmod 600 /root/.ssh/config 2>/dev/null || true
-	chmod 644 /root/.ssh/*.pub 2>/dev/null || true
-	chmod 644 /root/.ssh/known_hosts* 2>/dev/null || true
+	chmod 600 "$home"/.ssh/id_* 2>/dev/null || true
+	chmod 600 "$home/.ssh/config" 2>/dev/null || true
+	chmod 644 "$home"/.ssh/*.pub 2>/dev/null || true
+	chmod 644 "$home"/.ssh/known_hosts* 2>/dev/null || true
 	
 	# Start ssh-agent if not running
 	if [ -z "$SSH_AUTH_SOCK" ]; then
 		eval "$(ssh-agent -s)" > /dev/null 2>&1
 		# Add all private keys
-		for key in /root/.ssh/id_*; do
+		for key in "$home"/.ssh/id_*; do
 			if [ -f "$key" ] && [ "${key%.pub}" = "$key" ]; then
 				ssh-add "$key" 2>/dev/null || true
 			fi
@@ -255,8 +257,9 @@ if [ -d /ssh-config ]; then
 	fi
 	
 	# Configure git to use SSH
-	git config --global url."git@github.com:".insteadOf "https://github.com/" 2>/dev/null || true
-	git config --global url."git@gitlab.com:".insteadOf "https://gitlab.com/" 2>/dev/null || true
-	git config --global url."git@bitbucket.org:".insteadOf "https://bitbucket.org/" 2>/dev/null || true
+	HOME="$home" git config --global url."git@github.com:".insteadOf "https://github.com/" 2>/dev/null || true
+	HOME="$home" git config --global url."git@gitlab.com:".insteadOf "https://gitlab.com/" 2>/dev/null || true
+	HOME="$home" git config --global url."git@bitbucket.org:".insteadOf "https://bitbucket.org/" 2>/dev/null || true
+	[ -z "$WORKLET_USER" ] || chown -R "$WORKLET_USER" "$home/.ssh" "$home/.gitconfig" 2>/dev/null || true
 fi`
 }
\ No newline at end of file
@@ -0,0 +1,203 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+)
+
+// ContainerStats is one sample of a container's resource usage
+type ContainerStats struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Nested     bool    `json:"nested,omitempty"` // Runs in the session's Docker-in-Docker daemon
+	CPUPercent float64 `json:"cpu_percent"`
+	MemUsage   uint64  `json:"mem_usage"`
+	MemLimit   uint64  `json:"mem_limit,omitempty"`
+	NetRx      uint64  `json:"net_rx"`
+	NetTx      uint64  `json:"net_tx"`
+	BlockRead  uint64  `json:"block_read"`
+	BlockWrite uint64  `json:"block_write"`
+	PIDs       int     `json:"pids"`
+}
+
+// SessionStats is one sample of a session's resource usage. Total sums the
+// session container and its compose services on the host; nested
+// Docker-in-Docker containers are listed but already counted in the session
+// container's usage.
+type SessionStats struct {
+	SessionID   string           `json:"session_id"`
+	ProjectName string           `json:"project_name"`
+	Time        time.Time        `json:"time"`
+	Total       ContainerStats   `json:"total"`
+	Containers  []ContainerStats `json:"containers"`
+}
+
+// CollectStats takes one sample of resource usage for each session
+func CollectStats(ctx context.Context, sessions []SessionInfo) ([]SessionStats, error) {
+	// Sample every host container in a single docker stats call
+	owners := make(map[string]int)
+	var ids []string
+	for i, session := range sessions {
+		ids = append(ids, session.ContainerID)
+		owners[shortID(session.ContainerID)] = i
+		for _, id := range composeContainers(ctx, session) {
+			ids = append(ids, id)
+			owners[shortID(id)] = i
+		}
+	}
+
+	results := make([]SessionStats, len(sessions))
+	for i, session := range sessions {
+		results[i] = SessionStats{
+			SessionID:   session.SessionID,
+			ProjectName: session.ProjectName,
+			Time:        time.Now(),
+			Total:       ContainerStats{ID: session.ContainerID, Name: session.SessionID},
+		}
+	}
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	host, err := sampleStats(dockerCommand(ctx, append([]string{"stats", "--no-stream", "--format", "{{json .}}"}, ids...)...))
+	if err != nil {
+		return nil, err
+	}
+	for _, stats := range host {
+		i, ok := owners[shortID(stats.ID)]
+		if !ok {
+			continue
+		}
+		results[i].Containers = append(results[i].Containers, stats)
+		results[i].Total.add(stats)
+	}
+
+	// Containers started inside a session's own Docker daemon. Sessions
+	// without one just fail the exec.
+	for i, session := range sessions {
+		cmd := dockerCommand(ctx, "exec", session.ContainerID, "docker", "stats", "--no-stream", "--format", "{{json .}}")
+		nested, err := sampleStats(cmd)
+		if err != nil {
+			continue
+		}
+		for _, stats := range nested {
+			stats.Nested = true
+			results[i].Containers = append(results[i].Containers, stats)
+		}
+	}
+
+	return results, nil
+}
+
+// composeContainers returns the IDs of a session's compose services running
+// on the host
+func composeContainers(ctx context.Context, session SessionInfo) []string {
+	project := strings.ToLower(fmt.Sprintf("%s-%s", session.ProjectName, session.SessionID))
+	cmd := dockerCommand(ctx, "ps", "-q", "--filter", "label=com.docker.compose.project="+project)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(output))
+}
+
+// sampleStats runs a `docker stats --format '{{json .}}'` command and parses
+// its output
+func sampleStats(cmd *exec.Cmd) ([]ContainerStats, error) {
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get container stats: %w", err)
+	}
+
+	var samples []ContainerStats
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line == "" {
+			continue
+		}
+		stats, err := parseStatsLine(line)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, stats)
+	}
+	return samples, nil
+}
+
+// statsLine is a line of `docker stats --format '{{json .}}'`
+type statsLine struct {
+	ID       string `json:"ID"`
+	Name     string `json:"Name"`
+	CPUPerc  string `json:"CPUPerc"`
+	MemUsage string `json:"MemUsage"`
+	NetIO    string `json:"NetIO"`
+	BlockIO  string `json:"BlockIO"`
+	PIDs     string `json:"PIDs"`
+}
+
+// parseStatsLine converts docker's human-readable stats into numbers
+func parseStatsLine(line string) (ContainerStats, error) {
+	var raw statsLine
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return ContainerStats{}, fmt.Errorf("failed to parse container stats: %w", err)
+	}
+
+	stats := ContainerStats{ID: raw.ID, Name: raw.Name}
+	fmt.Sscanf(strings.TrimSuffix(raw.CPUPerc, "%"), "%g", &stats.CPUPercent)
+	fmt.Sscanf(raw.PIDs, "%d", &stats.PIDs)
+	stats.MemUsage, stats.MemLimit = parseSizePair(raw.MemUsage)
+	stats.NetRx, stats.NetTx = parseSizePair(raw.NetIO)
+	stats.BlockRead, stats.BlockWrite = parseSizePair(raw.BlockIO)
+	return stats, nil
+}
+
+// binarySize matches the binary units docker uses for memory, e.g. "1.5GiB"
+var binarySize = regexp.MustCompile(`(?i)^[\d.]+\s*[kmgtp]ib$`)
+
+// parseSizePair parses "<a> / <b>" with sizes like "1.2MiB" or "3.4kB".
+// Unknown values such as "--" for stopped containers parse as zero.
+func parseSizePair(s string) (uint64, uint64) {
+	a, b, _ := strings.Cut(s, "/")
+	return parseSize(a), parseSize(b)
+}
+
+// parseSize parses a single size, returning zero if it isn't one
+func parseSize(s string) uint64 {
+	s = strings.TrimSpace(s)
+	var size int64
+	var err error
+	if binarySize.MatchString(s) {
+		size, err = units.RAMInBytes(s)
+	} else {
+		size, err = units.FromHumanSize(s)
+	}
+	if err != nil || size < 0 {
+		return 0
+	}
+	return uint64(size)
+}
+
+// add accumulates another container's usage into a session total
+func (s *ContainerStats) add(other ContainerStats) {
+	s.CPUPercent += other.CPUPercent
+	s.MemUsage += other.MemUsage
+	s.NetRx += other.NetRx
+	s.NetTx += other.NetTx
+	s.BlockRead += other.BlockRead
+	s.BlockWrite += other.BlockWrite
+	s.PIDs += other.PIDs
+}
+
+// shortID truncates a container ID to the 12 characters docker stats prints
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
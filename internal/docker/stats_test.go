@@ -0,0 +1,38 @@
+package docker
+
+import "testing"
+
+func TestParseStatsLine(t *testing.T) {
+	line := `{"BlockIO":"4.5MB / 12.3kB","CPUPerc":"12.50%","ID":"0123456789ab","MemUsage":"256MiB / 1.5GiB","Name":"worklet-abc","NetIO":"1.5kB / 0B","PIDs":"7"}`
+
+	stats, err := parseStatsLine(line)
+	if err != nil {
+		t.Fatalf("parseStatsLine failed: %v", err)
+	}
+
+	want := ContainerStats{
+		ID:         "0123456789ab",
+		Name:       "worklet-abc",
+		CPUPercent: 12.5,
+		MemUsage:   256 << 20,
+		MemLimit:   1536 << 20,
+		NetRx:      1500,
+		NetTx:      0,
+		BlockRead:  4500000,
+		BlockWrite: 12300,
+		PIDs:       7,
+	}
+	if stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestParseStatsLineStopped(t *testing.T) {
+	stats, err := parseStatsLine(`{"BlockIO":"--","CPUPerc":"--","ID":"0123456789ab","MemUsage":"-- / --","Name":"worklet-abc","NetIO":"--","PIDs":"--"}`)
+	if err != nil {
+		t.Fatalf("parseStatsLine failed: %v", err)
+	}
+	if stats.CPUPercent != 0 || stats.MemUsage != 0 || stats.NetRx != 0 || stats.PIDs != 0 {
+		t.Errorf("expected zero usage for a stopped container, got %+v", stats)
+	}
+}
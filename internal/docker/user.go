@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LabelUser records a session's run.user, which shells and commands run in
+// it use
+const LabelUser = "worklet.user"
+
+// ExecUserArgs returns the docker exec flags running a command in a session
+// container as its run.user. Full isolation containers run as root for
+// their Docker daemon, so docker exec would otherwise be root there.
+func ExecUserArgs(containerID string) []string {
+	output, err := dockerCommand(context.Background(), "inspect", "--format", fmt.Sprintf("{{index .Config.Labels %q}}", LabelUser), containerID).Output()
+	if err != nil {
+		return nil
+	}
+	if user := strings.TrimSpace(string(output)); user != "" && user != "<no value>" {
+		return []string{"-u", user}
+	}
+	return nil
+}
+
+// waitForUser waits for the entrypoint of a full isolation session to
+// create its run.user, which it does as it starts
+func waitForUser(ctx context.Context, container, user string) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for {
+		if dockerCommand(ctx, "exec", "-u", user, container, "true").Run() == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("user %s wasn't created in time", user)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,39 @@
+#!/bin/sh
+# Starts the session's browser endpoints in the background: a virtual
+# display served over noVNC when WORKLET_BROWSERS_VNC is set, and Chromium
+# with its DevTools Protocol when WORKLET_BROWSERS_CDP is set. With a
+# command, it then runs that.
+
+log=/tmp/worklet-browsers.log
+
+if [ -n "$WORKLET_BROWSERS_VNC" ] && ! pgrep -x Xvfb >/dev/null 2>&1; then
+    Xvfb "$WORKLET_BROWSERS_DISPLAY" -screen 0 1920x1080x24 -nolisten tcp >>"$log" 2>&1 &
+    sleep 1
+    x11vnc -display "$WORKLET_BROWSERS_DISPLAY" -forever -shared -nopw -localhost -rfbport 5900 -quiet >>"$log" 2>&1 &
+    websockify --web /usr/share/novnc "$WORKLET_BROWSERS_VNC_PORT" localhost:5900 >>"$log" 2>&1 &
+fi
+
+if [ -n "$WORKLET_BROWSERS_CDP" ] && ! pgrep -f worklet-cdp-proxy >/dev/null 2>&1; then
+    chrome=$(ls -d /ms-playwright/chromium-*/chrome-linux/chrome 2>/dev/null | tail -1)
+    [ -n "$chrome" ] || chrome=$(command -v chromium || command -v chromium-browser || true)
+    if [ -z "$chrome" ]; then
+        echo "Warning: Chromium isn't installed, so the DevTools endpoint isn't started" >&2
+    else
+        # Headed on the virtual display, so it can be watched over VNC
+        headless=--headless=new
+        if [ -n "$WORKLET_BROWSERS_VNC" ]; then
+            headless=
+        fi
+        DISPLAY="$WORKLET_BROWSERS_DISPLAY" "$chrome" $headless --no-sandbox --no-first-run \
+            --disable-dev-shm-usage --user-data-dir=/tmp/worklet-chromium \
+            --remote-debugging-port=9223 about:blank >>"$log" 2>&1 &
+        # Chromium only accepts DevTools connections for localhost, so the
+        # proxy's requests are relayed to it, by a relay that checks their
+        # Origin as Chromium would
+        python3 /usr/local/lib/worklet-cdp-proxy.py "$WORKLET_BROWSERS_CDP_PORT" 9223 >>"$log" 2>&1 &
+    fi
+fi
+
+if [ $# -gt 0 ]; then
+    exec "$@"
+fi
@@ -11,6 +11,26 @@ type TemplateContext struct {
 	SessionID   string
 	ProjectName string
 	Services    []ServiceInfo
+	Domain      string // Base domain of service URLs (default: local.worklet.sh)
+	HTTPPort    int    // Host port the proxy serves URLs on (default: 80)
+	Addons      []AddonInfo
+}
+
+// domain returns the base domain of service URLs
+func (ctx TemplateContext) domain() string {
+	if ctx.Domain != "" {
+		return ctx.Domain
+	}
+	// config.WorkletDomain, which can't be imported here
+	return "local.worklet.sh"
+}
+
+// url returns the URL of a service served at host
+func (ctx TemplateContext) url(host string) string {
+	if ctx.HTTPPort == 0 || ctx.HTTPPort == 80 {
+		return "http://" + host
+	}
+	return fmt.Sprintf("http://%s:%d", host, ctx.HTTPPort)
 }
 
 // ServiceInfo contains service information for templating
@@ -20,17 +40,57 @@ type ServiceInfo struct {
 	Subdomain string
 }
 
+// AddonInfo contains how a session reaches an add-on, for templating
+type AddonInfo struct {
+	Name     string
+	Host     string
+	Port     int
+	URL      string // Connection URL, with credentials if it has them
+	User     string
+	Password string
+	Database string
+}
+
 // templatePattern matches {{ services.<name>.<property> }} syntax
 var templatePattern = regexp.MustCompile(`\{\{\s*services\.(\w+)\.(url|host|port)\s*\}\}`)
 
+// addonPattern matches {{ addons.<name>.<property> }} syntax
+var addonPattern = regexp.MustCompile(`\{\{\s*addons\.(\w+)\.(url|host|port|user|password|database)\s*\}\}`)
+
 // sessionPattern matches {{ session.<property> }} syntax
 var sessionPattern = regexp.MustCompile(`\{\{\s*session\.(id)\s*\}\}`)
 
 // projectPattern matches {{ project.<property> }} syntax
 var projectPattern = regexp.MustCompile(`\{\{\s*project\.(name)\s*\}\}`)
 
+// Placeholder is a template placeholder found in env file content, and what
+// it was replaced with
+type Placeholder struct {
+	Text     string // As written, such as {{services.web.url}}
+	Value    string // What it was replaced with, if resolved
+	Resolved bool   // False if it was left as written
+}
+
+// anyPlaceholderPattern matches anything written like a placeholder, to find
+// those that aren't supported
+var anyPlaceholderPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+
 // ProcessTemplate processes environment file content and replaces template variables
 func ProcessTemplate(content string, ctx TemplateContext) string {
+	result, _ := ProcessTemplateWithPlaceholders(content, ctx)
+	return result
+}
+
+// ProcessTemplateWithPlaceholders is ProcessTemplate that also returns the
+// placeholders found, in the order they were processed. Placeholders of
+// unknown services or properties are left as written and not resolved.
+func ProcessTemplateWithPlaceholders(content string, ctx TemplateContext) (string, []Placeholder) {
+	var placeholders []Placeholder
+	resolve := func(match, value string) string {
+		placeholders = append(placeholders, Placeholder{Text: match, Value: value, Resolved: true})
+		return value
+	}
+
 	// Build service map for quick lookup
 	serviceMap := make(map[string]ServiceInfo)
 	for _, svc := range ctx.Services {
@@ -49,7 +109,7 @@ func ProcessTemplate(content string, ctx TemplateContext) string {
 
 		service, ok := serviceMap[serviceName]
 		if !ok {
-			// Service not found, return original
+			// Service not found, return original, which is reported below
 			return match
 		}
 
@@ -60,17 +120,46 @@ func ProcessTemplate(content string, ctx TemplateContext) string {
 			if subdomain == "" {
 				subdomain = service.Name
 			}
-			return fmt.Sprintf("http://%s.%s-%s.local.worklet.sh", 
-				subdomain, ctx.ProjectName, ctx.SessionID)
+			return resolve(match, ctx.url(fmt.Sprintf("%s.%s-%s.%s",
+				subdomain, ctx.ProjectName, ctx.SessionID, ctx.domain())))
 		case "host":
 			subdomain := service.Subdomain
 			if subdomain == "" {
 				subdomain = service.Name
 			}
-			return fmt.Sprintf("%s.%s-%s.local.worklet.sh", 
-				subdomain, ctx.ProjectName, ctx.SessionID)
+			return resolve(match, fmt.Sprintf("%s.%s-%s.%s",
+				subdomain, ctx.ProjectName, ctx.SessionID, ctx.domain()))
 		case "port":
-			return fmt.Sprintf("%d", service.Port)
+			return resolve(match, fmt.Sprintf("%d", service.Port))
+		default:
+			return match
+		}
+	})
+
+	// Replace add-on references
+	addonMap := make(map[string]AddonInfo)
+	for _, addon := range ctx.Addons {
+		addonMap[addon.Name] = addon
+	}
+	result = addonPattern.ReplaceAllStringFunc(result, func(match string) string {
+		matches := addonPattern.FindStringSubmatch(match)
+		addon, ok := addonMap[matches[1]]
+		if !ok {
+			return match
+		}
+		switch matches[2] {
+		case "url":
+			return resolve(match, addon.URL)
+		case "host":
+			return resolve(match, addon.Host)
+		case "port":
+			return resolve(match, fmt.Sprintf("%d", addon.Port))
+		case "user":
+			return resolve(match, addon.User)
+		case "password":
+			return resolve(match, addon.Password)
+		case "database":
+			return resolve(match, addon.Database)
 		default:
 			return match
 		}
@@ -86,7 +175,7 @@ func ProcessTemplate(content string, ctx TemplateContext) string {
 		property := matches[1]
 		switch property {
 		case "id":
-			return ctx.SessionID
+			return resolve(match, ctx.SessionID)
 		default:
 			return match
 		}
@@ -102,13 +191,18 @@ func ProcessTemplate(content string, ctx TemplateContext) string {
 		property := matches[1]
 		switch property {
 		case "name":
-			return ctx.ProjectName
+			return resolve(match, ctx.ProjectName)
 		default:
 			return match
 		}
 	})
 
-	return result
+	// Whatever is left wasn't resolved
+	for _, match := range anyPlaceholderPattern.FindAllString(result, -1) {
+		placeholders = append(placeholders, Placeholder{Text: match})
+	}
+
+	return result, placeholders
 }
 
 // GetServiceEnvironmentVariables generates environment variables for all services
@@ -121,13 +215,10 @@ func GetServiceEnvironmentVariables(ctx TemplateContext) map[string]string {
 			subdomain = service.Name
 		}
 
-		// Generate URL
-		url := fmt.Sprintf("http://%s.%s-%s.local.worklet.sh", 
-			subdomain, ctx.ProjectName, ctx.SessionID)
-		
-		// Generate host
-		host := fmt.Sprintf("%s.%s-%s.local.worklet.sh", 
-			subdomain, ctx.ProjectName, ctx.SessionID)
+		// Generate host and URL
+		host := fmt.Sprintf("%s.%s-%s.%s",
+			subdomain, ctx.ProjectName, ctx.SessionID, ctx.domain())
+		url := ctx.url(host)
 
 		// Create standard environment variables for each service
 		serviceNameUpper := strings.ToUpper(service.Name)
@@ -136,6 +227,23 @@ func GetServiceEnvironmentVariables(ctx TemplateContext) map[string]string {
 		envVars[fmt.Sprintf("WORKLET_SERVICE_%s_PORT", serviceNameUpper)] = fmt.Sprintf("%d", service.Port)
 	}
 
+	// Add how to reach each add-on
+	for _, addon := range ctx.Addons {
+		prefix := fmt.Sprintf("WORKLET_ADDON_%s_", strings.ToUpper(addon.Name))
+		envVars[prefix+"URL"] = addon.URL
+		envVars[prefix+"HOST"] = addon.Host
+		envVars[prefix+"PORT"] = fmt.Sprintf("%d", addon.Port)
+		if addon.User != "" {
+			envVars[prefix+"USER"] = addon.User
+		}
+		if addon.Password != "" {
+			envVars[prefix+"PASSWORD"] = addon.Password
+		}
+		if addon.Database != "" {
+			envVars[prefix+"DATABASE"] = addon.Database
+		}
+	}
+
 	// Add session and project info
 	envVars["WORKLET_SESSION_ID"] = ctx.SessionID
 	envVars["WORKLET_PROJECT_NAME"] = ctx.ProjectName
@@ -0,0 +1,13 @@
+package fscopy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a copy-on-write clone of src with clonefile(2), which
+// APFS supports. The clone keeps src's permissions.
+func cloneFile(src, dst string, mode os.FileMode) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
@@ -0,0 +1,34 @@
+package fscopy
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a copy-on-write clone of src with the FICLONE ioctl,
+// supported by btrfs and xfs (with reflink=1). It returns an error if the
+// filesystem can't share extents, leaving dst absent.
+func cloneFile(src, dst string, mode os.FileMode) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	err = unix.IoctlFileClone(int(destFile.Fd()), int(sourceFile.Fd()))
+	if closeErr := destFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Chmod(dst, mode)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package fscopy
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile is not supported on this platform; files are always copied
+func cloneFile(src, dst string, mode os.FileMode) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,416 @@
+// Package fscopy copies directory trees with gitignore-style filtering.
+package fscopy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"golang.org/x/sync/errgroup"
+)
+
+// Options controls which files Copy copies
+type Options struct {
+	// Excludes are gitignore-style patterns for paths to skip
+	Excludes []string
+	// Includes, if set, limits the copy to matching paths (gitignore syntax).
+	// Excludes still apply within included paths.
+	Includes []string
+	// IgnoreFiles are files in the source root, like ".dockerignore", whose
+	// patterns are added to Excludes. The files themselves are not copied.
+	IgnoreFiles []string
+	// SkipGit skips .git directories and files
+	SkipGit bool
+	// Log receives notes about skipped symlinks (default: stdout)
+	Log io.Writer
+	// Workers is the number of files copied concurrently (default: number
+	// of CPUs)
+	Workers int
+	// HardLinks hard-links files into dst when the filesystem can't clone
+	// them. Only set this when dst is read but never modified, such as a
+	// build context, since writes through a link change the source file.
+	HardLinks bool
+}
+
+// Copy copies the tree at src into dst according to opts.
+//
+// Symlinks pointing inside src are copied as the files they point to, and as
+// empty directories for directory links (the real directory is copied when
+// the walk reaches it). Symlinks pointing outside src, or that can't be
+// resolved, are skipped.
+//
+// Files are copied by a pool of workers. Each file is cloned copy-on-write
+// where the filesystem supports it (APFS, btrfs, xfs), and files hard-linked
+// to each other in src stay linked in dst.
+func Copy(src, dst string, opts Options) error {
+	log := opts.Log
+	if log == nil {
+		log = os.Stdout
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	var group errgroup.Group
+	group.SetLimit(workers)
+	c := &copier{hardLinks: opts.HardLinks, group: &group, links: make(map[fileKey]*linkedFile)}
+
+	matcher := newExcludeMatcher(src, opts)
+
+	// With include patterns, only matching paths are copied
+	includes := newIncludeMatcher(opts.Includes)
+
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+
+	walkErr := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if c.failed.Load() {
+			return errCopyFailed
+		}
+
+		// Get relative path
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		// Skip the root directory itself
+		if relPath == "." {
+			return nil
+		}
+
+		// Convert path to components for matcher
+		pathComponents := strings.Split(relPath, string(filepath.Separator))
+
+		// Check if path should be excluded BEFORE following symlinks
+		if matcher.Match(pathComponents, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Outside the includes, only walk directories that may contain
+		// included paths; their directories are created on demand
+		if includes != nil && !includes.Match(pathComponents, info.IsDir()) {
+			if info.IsDir() && !includes.MayContain(pathComponents) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Construct destination path
+		dstPath := filepath.Join(dst, relPath)
+
+		// Handle symlinks specially
+		if info.Mode()&os.ModeSymlink != 0 {
+			return copySymlink(c, absSrc, path, relPath, dstPath, log)
+		}
+
+		// Handle regular files and directories
+		if info.IsDir() {
+			return os.MkdirAll(dstPath, info.Mode())
+		}
+
+		// Copy file, creating parents skipped by include filtering
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+			return err
+		}
+		c.schedule(path, dstPath, info)
+		return nil
+	})
+
+	// A worker's error is the real cause of the walk stopping early
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	return walkErr
+}
+
+// Skipped returns the paths in src that Copy would leave out because of
+// opts' patterns, ignore files and includes, relative to src with slash
+// separators. A skipped directory is listed without its contents.
+func Skipped(src string, opts Options) ([]string, error) {
+	matcher := newExcludeMatcher(src, opts)
+	includes := newIncludeMatcher(opts.Includes)
+
+	var skipped []string
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		pathComponents := strings.Split(relPath, string(filepath.Separator))
+
+		skip := matcher.Match(pathComponents, info.IsDir())
+		if !skip && includes != nil && !includes.Match(pathComponents, info.IsDir()) {
+			// Directories that may hold included paths are walked into
+			if info.IsDir() && includes.MayContain(pathComponents) {
+				return nil
+			}
+			skip = true
+		}
+		if !skip {
+			return nil
+		}
+
+		skipped = append(skipped, filepath.ToSlash(relPath))
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return skipped, err
+}
+
+// errCopyFailed stops the walk after a worker fails
+var errCopyFailed = fmt.Errorf("copy failed")
+
+// copier copies files on a bounded pool of goroutines
+type copier struct {
+	hardLinks bool
+	group     *errgroup.Group
+	failed    atomic.Bool
+
+	// Cloning and cross-file hard links are turned off after their first
+	// failure, since the rest of the tree is on the same filesystem
+	noClone atomic.Bool
+	noLink  atomic.Bool
+
+	mu    sync.Mutex
+	links map[fileKey]*linkedFile
+}
+
+// linkedFile tracks the first copy of a file with several hard links in src
+type linkedFile struct {
+	dst  string
+	done chan struct{}
+	err  error
+}
+
+// schedule copies src to dst on a worker. Files already hard-linked in src
+// wait for the first link's copy and link to it.
+func (c *copier) schedule(src, dst string, info os.FileInfo) {
+	var first, wait *linkedFile
+	if key, ok := linkKey(info); ok {
+		c.mu.Lock()
+		if existing, ok := c.links[key]; ok {
+			wait = existing
+		} else {
+			first = &linkedFile{dst: dst, done: make(chan struct{})}
+			c.links[key] = first
+		}
+		c.mu.Unlock()
+	}
+
+	c.group.Go(func() error {
+		var err error
+		if wait != nil {
+			<-wait.done
+			if wait.err != nil || os.Link(wait.dst, dst) != nil {
+				err = c.copyFile(src, dst, info)
+			}
+		} else {
+			err = c.copyFile(src, dst, info)
+		}
+		if first != nil {
+			first.err = err
+			close(first.done)
+		}
+		if err != nil {
+			c.failed.Store(true)
+			return fmt.Errorf("failed to copy %s: %w", src, err)
+		}
+		return nil
+	})
+}
+
+// copyFile copies one file, preferring a copy-on-write clone and then, if
+// enabled, a hard link to src
+func (c *copier) copyFile(src, dst string, info os.FileInfo) error {
+	if !c.noClone.Load() {
+		if err := cloneFile(src, dst, info.Mode()); err == nil {
+			return nil
+		}
+		c.noClone.Store(true)
+	}
+
+	if c.hardLinks && !c.noLink.Load() {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+		c.noLink.Store(true)
+	}
+
+	return CopyFile(src, dst)
+}
+
+// newExcludeMatcher builds the matcher for excluded paths from opts and the
+// ignore files in src
+func newExcludeMatcher(src string, opts Options) gitignore.Matcher {
+	var patterns []gitignore.Pattern
+
+	if opts.SkipGit {
+		patterns = append(patterns, gitignore.ParsePattern(".git", nil))
+	}
+
+	// Ignore files are never copied themselves
+	for _, name := range opts.IgnoreFiles {
+		patterns = append(patterns, gitignore.ParsePattern(name, nil))
+	}
+
+	for _, pattern := range opts.Excludes {
+		pattern = cleanPattern(pattern)
+		if pattern != "" && !strings.HasPrefix(pattern, "#") {
+			patterns = append(patterns, gitignore.ParsePattern(pattern, nil))
+		}
+	}
+
+	// Read and parse ignore files if they exist
+	for _, name := range opts.IgnoreFiles {
+		data, err := os.ReadFile(filepath.Join(src, name))
+		if err != nil {
+			continue
+		}
+		content := strings.TrimPrefix(string(data), "\ufeff")
+		for _, line := range strings.Split(content, "\n") {
+			line = cleanPattern(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				patterns = append(patterns, gitignore.ParsePattern(line, nil))
+			}
+		}
+	}
+
+	return gitignore.NewMatcher(patterns)
+}
+
+// windowsPaths is set where paths use \ as the separator
+var windowsPaths = filepath.Separator == '\\'
+
+// cleanPattern trims a pattern, including the \r of a line saved with
+// Windows line endings. On Windows, \ separates path components, as in
+// .dockerignore files Docker reads there, rather than escaping characters.
+func cleanPattern(pattern string) string {
+	pattern = strings.TrimSpace(pattern)
+	if windowsPaths {
+		pattern = strings.ReplaceAll(pattern, `\`, "/")
+	}
+	return pattern
+}
+
+// within reports whether path is root or inside it. Paths on Windows are
+// compared case-insensitively, since its filesystems are and a drive
+// letter may be given in either case.
+func within(root, path string) bool {
+	sep := string(filepath.Separator)
+	if windowsPaths {
+		sep = `\`
+		root, path = strings.ToLower(root), strings.ToLower(path)
+	}
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, sep)+sep)
+}
+
+// copySymlink copies a symlink found at path, which is relPath inside absSrc
+func copySymlink(c *copier, absSrc, path, relPath, dstPath string, log io.Writer) error {
+	// Read the symlink target
+	target, err := os.Readlink(path)
+	if err != nil {
+		// If we can't read the symlink, skip it
+		fmt.Fprintf(log, "Warning: Skipping unreadable symlink: %s\n", relPath)
+		return nil
+	}
+
+	// Resolve the absolute path of the target
+	absoluteTarget := target
+	if !filepath.IsAbs(target) {
+		absoluteTarget = filepath.Join(filepath.Dir(path), target)
+	}
+
+	// Check if the target is within the source directory
+	absTarget, err := filepath.Abs(absoluteTarget)
+	if err != nil {
+		// Skip symlinks we can't resolve
+		fmt.Fprintf(log, "Warning: Skipping unresolvable symlink: %s\n", relPath)
+		return nil
+	}
+
+	// If the symlink points outside the source tree, skip it
+	if !within(absSrc, absTarget) {
+		fmt.Fprintf(log, "Info: Skipping symlink pointing outside workspace: %s -> %s\n", relPath, target)
+		return nil
+	}
+
+	// For symlinks pointing inside the source tree, copy as regular files/directories
+	targetInfo, err := os.Stat(path)
+	if err != nil {
+		// If we can't stat the target, skip the symlink
+		fmt.Fprintf(log, "Warning: Skipping broken symlink: %s\n", relPath)
+		return nil
+	}
+
+	if targetInfo.IsDir() {
+		// For directory symlinks, create the directory but don't recurse
+		// The actual content will be copied when we walk to the real directory
+		return os.MkdirAll(dstPath, targetInfo.Mode())
+	}
+
+	// For file symlinks, copy the file content
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	// Copy from the resolved path so a hard link or clone never captures
+	// the link itself
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		fmt.Fprintf(log, "Warning: Skipping broken symlink: %s\n", relPath)
+		return nil
+	}
+	c.schedule(resolved, dstPath, targetInfo)
+	return nil
+}
+
+// CopyFile copies a single file, preserving its permissions
+func CopyFile(src, dst string) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	_, err = io.Copy(destFile, sourceFile)
+	if err != nil {
+		return err
+	}
+
+	// Copy file permissions
+	sourceInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	return os.Chmod(dst, sourceInfo.Mode())
+}
@@ -0,0 +1,287 @@
+package fscopy
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCopySymlinksIgnoreFilesAndGit(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "worklet-fscopy-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	// A sibling whose name shares the source prefix must count as outside
+	outsideDir := srcDir + "-outside"
+	if err := os.MkdirAll(outsideDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outsideDir)
+
+	dstDir, err := os.MkdirTemp("", "worklet-fscopy-dst-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	files := map[string]string{
+		"main.go":      "package main",
+		"debug.log":    "log",
+		".git/HEAD":    "ref: refs/heads/main",
+		".copyignore":  "*.log\n",
+		"lib/util.go":  "package lib",
+		"nested/.keep": "",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(srcDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outsideDir, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("lib/util.go", filepath.Join(srcDir, "util-link.go")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outsideDir, "secret"), filepath.Join(srcDir, "secret-link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	opts := Options{IgnoreFiles: []string{".copyignore"}, SkipGit: true, Log: &log}
+	if err := Copy(srcDir, dstDir, opts); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"main.go":      true,
+		"lib/util.go":  true,
+		"nested/.keep": true,
+		"util-link.go": true,
+		"debug.log":    false,
+		".git/HEAD":    false,
+		"secret-link":  false,
+	}
+	for path, shouldExist := range expected {
+		info, err := os.Lstat(filepath.Join(dstDir, path))
+		if shouldExist && err != nil {
+			t.Errorf("Expected file to be copied: %s", path)
+		}
+		if !shouldExist && err == nil {
+			t.Errorf("Expected file to be skipped: %s", path)
+		}
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("Expected symlink to be copied as a file: %s", path)
+		}
+	}
+
+	if !strings.Contains(log.String(), "secret-link") {
+		t.Errorf("Expected skipped symlink to be logged, got %q", log.String())
+	}
+}
+
+func TestIncludeMatcher(t *testing.T) {
+	m := newIncludeMatcher([]string{"/package.json", "services/api", "packages/*/src"})
+
+	tests := []struct {
+		path       string
+		isDir      bool
+		match      bool
+		mayContain bool
+	}{
+		{"package.json", false, true, false},
+		{"services/api", true, true, true},
+		{"services", true, false, true},
+		{"services/web", true, false, false},
+		{"packages/shared/src", true, true, true},
+		{"packages/shared", true, false, true},
+		{"docs", true, false, false},
+	}
+
+	for _, tt := range tests {
+		path := strings.Split(tt.path, "/")
+		if got := m.Match(path, tt.isDir); got != tt.match {
+			t.Errorf("Match(%q) = %v, want %v", tt.path, got, tt.match)
+		}
+		if tt.isDir {
+			if got := m.MayContain(path); got != tt.mayContain {
+				t.Errorf("MayContain(%q) = %v, want %v", tt.path, got, tt.mayContain)
+			}
+		}
+	}
+
+	if newIncludeMatcher([]string{"", "# comment"}) != nil {
+		t.Error("Expected no matcher without include patterns")
+	}
+}
+
+func TestCopyHardLinks(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "worklet-fscopy-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(srcDir, "pkg", fmt.Sprintf("file%d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("content %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files linked to each other in the source stay linked in the copy
+	if err := os.Link(filepath.Join(srcDir, "pkg", "file0.txt"), filepath.Join(srcDir, "linked.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hardLinks := range []bool{false, true} {
+		dstDir, err := os.MkdirTemp("", "worklet-fscopy-dst-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dstDir)
+
+		if err := Copy(srcDir, dstDir, Options{Workers: 4, HardLinks: hardLinks}); err != nil {
+			t.Fatalf("Copy failed: %v", err)
+		}
+
+		for i := 0; i < 50; i++ {
+			data, err := os.ReadFile(filepath.Join(dstDir, "pkg", fmt.Sprintf("file%d.txt", i)))
+			if err != nil || string(data) != fmt.Sprintf("content %d", i) {
+				t.Errorf("file%d.txt not copied correctly: %q, %v", i, data, err)
+			}
+		}
+
+		first, err := os.Stat(filepath.Join(dstDir, "pkg", "file0.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		linked, err := os.Stat(filepath.Join(dstDir, "linked.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(first, linked) {
+			t.Errorf("HardLinks=%v: expected linked files to stay linked", hardLinks)
+		}
+
+		source, err := os.Stat(filepath.Join(srcDir, "pkg", "file1.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		copied, err := os.Stat(filepath.Join(dstDir, "pkg", "file1.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os.SameFile(source, copied) != hardLinks {
+			t.Errorf("HardLinks=%v: unexpected link to the source file", hardLinks)
+		}
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "worklet-fscopy-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	files := map[string]string{
+		".copyignore":           "*.log\nnode_modules/\n",
+		"README.md":             "# Project",
+		"debug.log":             "log",
+		"main.go":               "package main",
+		"node_modules/dep/a.js": "dep",
+		"services/api/main.go":  "package main",
+		"services/web/index.js": "web",
+	}
+	for path, content := range files {
+		fullPath := filepath.Join(srcDir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := Options{IgnoreFiles: []string{".copyignore"}, Includes: []string{"/main.go", "services/api"}}
+	skipped, err := Skipped(srcDir, opts)
+	if err != nil {
+		t.Fatalf("Skipped failed: %v", err)
+	}
+
+	want := []string{".copyignore", "README.md", "debug.log", "node_modules", "services/web"}
+	if strings.Join(skipped, ",") != strings.Join(want, ",") {
+		t.Errorf("Skipped = %q, want %q", skipped, want)
+	}
+}
+
+func TestIgnoreFileWindowsLineEndings(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "worklet-fscopy-src-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	files := map[string]string{
+		".dockerignore":   "\ufeffnode_modules\r\n# Build output\r\ndist/\r\n",
+		"index.js":        "",
+		"node_modules/a":  "",
+		"dist/bundle.js":  "",
+		"src/dist/app.js": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	skipped, err := Skipped(srcDir, Options{IgnoreFiles: []string{".dockerignore"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".dockerignore", "dist", "node_modules", "src/dist"}
+	if strings.Join(skipped, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected %v skipped, got %v", expected, skipped)
+	}
+}
+
+func TestWindowsPatternsAndPaths(t *testing.T) {
+	defer func(saved bool) { windowsPaths = saved }(windowsPaths)
+	windowsPaths = true
+
+	if got := cleanPattern(" services\\api\\dist\r"); got != "services/api/dist" {
+		t.Errorf("expected backslashes to separate components, got %q", got)
+	}
+
+	tests := []struct {
+		root, path string
+		inside     bool
+	}{
+		{`C:\src\app`, `C:\src\app`, true},
+		{`C:\src\app`, `c:\Src\App\lib\index.js`, true},
+		{`C:\src\app`, `C:\src\app-other\index.js`, false},
+		{`C:\`, `C:\src`, true},
+	}
+	for _, tt := range tests {
+		if got := within(tt.root, tt.path); got != tt.inside {
+			t.Errorf("within(%q, %q) = %v, want %v", tt.root, tt.path, got, tt.inside)
+		}
+	}
+}
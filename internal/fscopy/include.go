@@ -0,0 +1,92 @@
+package fscopy
+
+import (
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// includeMatcher selects the paths copied when include patterns are set.
+// Patterns use gitignore syntax; a matching directory includes everything
+// below it.
+type includeMatcher struct {
+	matcher gitignore.Matcher
+	// prefixes holds the literal leading components of each anchored
+	// pattern, used to avoid walking directories that can't match. nil means
+	// some pattern can match at any depth.
+	prefixes [][]string
+}
+
+// newIncludeMatcher returns nil when there are no include patterns, meaning
+// everything is included
+func newIncludeMatcher(patterns []string) *includeMatcher {
+	m := &includeMatcher{}
+	var parsed []gitignore.Pattern
+	anyDepth := false
+
+	for _, pattern := range patterns {
+		pattern = cleanPattern(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		parsed = append(parsed, gitignore.ParsePattern(pattern, nil))
+
+		if strings.HasPrefix(pattern, "!") {
+			continue
+		}
+
+		// Patterns without a leading or inner slash match at any depth
+		trimmed := strings.TrimSuffix(pattern, "/")
+		if !strings.Contains(trimmed, "/") {
+			anyDepth = true
+			continue
+		}
+
+		var prefix []string
+		for _, component := range strings.Split(strings.TrimPrefix(trimmed, "/"), "/") {
+			if strings.ContainsAny(component, "*?[") {
+				break
+			}
+			prefix = append(prefix, component)
+		}
+		m.prefixes = append(m.prefixes, prefix)
+	}
+
+	if len(parsed) == 0 {
+		return nil
+	}
+	m.matcher = gitignore.NewMatcher(parsed)
+	if anyDepth {
+		m.prefixes = nil
+	}
+	return m
+}
+
+// Match reports whether path is included
+func (m *includeMatcher) Match(path []string, isDir bool) bool {
+	return m.matcher.Match(path, isDir)
+}
+
+// MayContain reports whether a directory that isn't itself included could
+// contain included paths
+func (m *includeMatcher) MayContain(dir []string) bool {
+	if m.prefixes == nil {
+		return true
+	}
+	for _, prefix := range m.prefixes {
+		n := min(len(dir), len(prefix))
+		if equalComponents(dir[:n], prefix[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalComponents(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package fscopy
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileKey identifies a file's inode
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+// linkKey returns the inode of a file that has more than one hard link
+func linkKey(info os.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
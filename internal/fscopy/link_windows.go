@@ -0,0 +1,12 @@
+//go:build windows
+
+package fscopy
+
+import "os"
+
+type fileKey struct{}
+
+// Hard links in the source are not detected on Windows; each is copied
+func linkKey(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -0,0 +1,99 @@
+// Package fuzzy ranks strings against a query typed in a hurry: the query's
+// characters must appear in order, and matches at word starts and in runs
+// score higher.
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Scores added per matched character
+const (
+	matchScore       = 1
+	consecutiveBonus = 5 // Follows the previous match directly
+	boundaryBonus    = 8 // Starts the text or a word in it
+)
+
+// Scores added for the whole text
+const (
+	exactBonus  = 100
+	prefixBonus = 50
+)
+
+// Score returns how well query matches text, case-insensitively, and whether
+// it matches at all. Every character of query must appear in text in order;
+// the best placement of them is scored. An empty query matches everything.
+func Score(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	if len(q) == 0 {
+		return 0, true
+	}
+	if len(q) > len(t) {
+		return 0, false
+	}
+
+	// prev[j] is the best score of the query so far with its last character
+	// matched at t[j], or -1 if it can't be matched there
+	prev := make([]int, len(t))
+	cur := make([]int, len(t))
+	for j := range t {
+		prev[j] = -1
+		if t[j] == q[0] {
+			prev[j] = charScore(t, j)
+		}
+	}
+	for i := 1; i < len(q); i++ {
+		best := -1 // Best of prev[:j-1]
+		for j := range t {
+			cur[j] = -1
+			if j >= 2 && prev[j-2] > best {
+				best = prev[j-2]
+			}
+			if t[j] != q[i] || j == 0 {
+				continue
+			}
+			from := best
+			if prev[j-1] >= 0 && prev[j-1]+consecutiveBonus > from {
+				from = prev[j-1] + consecutiveBonus
+			}
+			if from >= 0 {
+				cur[j] = from + charScore(t, j)
+			}
+		}
+		prev, cur = cur, prev
+	}
+
+	score := -1
+	for _, s := range prev {
+		if s > score {
+			score = s
+		}
+	}
+	if score < 0 {
+		return 0, false
+	}
+
+	switch {
+	case len(q) == len(t) && string(q) == string(t):
+		score += exactBonus
+	case strings.HasPrefix(string(t), string(q)):
+		score += prefixBonus
+	}
+	// Prefer shorter texts among equal matches
+	return score*100 - len(t), true
+}
+
+// charScore returns the score of a query character matched at t[j]
+func charScore(t []rune, j int) int {
+	if j == 0 || isSeparator(t[j-1]) {
+		return matchScore + boundaryBonus
+	}
+	return matchScore
+}
+
+// isSeparator reports whether r separates words in names and paths
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("-_./:#@", r)
+}
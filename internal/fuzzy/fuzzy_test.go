@@ -0,0 +1,41 @@
+package fuzzy
+
+import "testing"
+
+func TestScoreMatches(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        bool
+	}{
+		{"", "anything", true},
+		{"shp", "shop", true},
+		{"SHOP", "shop-api", true},
+		{"wa", "worklet-api", true},
+		{"pohs", "shop", false},
+		{"shopx", "shop", false},
+	}
+	for _, tt := range tests {
+		if _, got := Score(tt.query, tt.text); got != tt.want {
+			t.Errorf("Score(%q, %q) matched = %v, want %v", tt.query, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestScoreRanking(t *testing.T) {
+	tests := []struct {
+		query, better, worse string
+	}{
+		{"shop", "shop", "shop-api"},              // Exact beats prefix
+		{"shop", "shop-api", "my-shop"},           // Prefix beats a later word
+		{"api", "shop-api", "rapid"},              // Word start beats mid-word
+		{"wt", "worklet-tools", "worklet"},        // Word starts beat the first occurrence
+		{"web", "my-web", "my-website-generator"}, // Shorter wins a tie
+	}
+	for _, tt := range tests {
+		better, _ := Score(tt.query, tt.better)
+		worse, _ := Score(tt.query, tt.worse)
+		if better <= worse {
+			t.Errorf("Score(%q): %q = %d, want above %q = %d", tt.query, tt.better, better, tt.worse, worse)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+// Package gitauth resolves credentials for cloning git remotes.
+package gitauth
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// Provider resolves credentials for a remote. It returns nil, nil when it
+// has nothing for the endpoint so the next provider is tried.
+type Provider interface {
+	Name() string
+	Auth(ep *transport.Endpoint) (transport.AuthMethod, error)
+}
+
+// Resolver tries a chain of providers in order
+type Resolver struct {
+	providers []Provider
+}
+
+// NewResolver returns a resolver with the given providers
+func NewResolver(providers ...Provider) *Resolver {
+	return &Resolver{providers: providers}
+}
+
+// DefaultResolver returns the standard provider chain: configured hosts,
+// host-scoped environment tokens, git's credential helpers and finally the
+// SSH agent or default keys
+func DefaultResolver(global *config.GlobalConfig) *Resolver {
+	return NewResolver(
+		&HostProvider{Config: global},
+		&EnvProvider{Config: global},
+		&CredentialHelperProvider{},
+		&SSHProvider{},
+	)
+}
+
+// Auth returns credentials for rawURL, or nil if no provider has any
+func (r *Resolver) Auth(rawURL string) (transport.AuthMethod, error) {
+	ep, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse git URL: %w", err)
+	}
+
+	var lastErr error
+	for _, provider := range r.providers {
+		auth, err := provider.Auth(ep)
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", provider.Name(), err)
+			continue
+		}
+		if auth != nil {
+			return auth, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// isHTTP reports whether the endpoint uses an HTTP transport
+func isHTTP(ep *transport.Endpoint) bool {
+	return ep.Protocol == "http" || ep.Protocol == "https"
+}
+
+// sshUser returns the SSH user for an endpoint, defaulting to "git"
+func sshUser(ep *transport.Endpoint, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if ep.User != "" {
+		return ep.User
+	}
+	return "git"
+}
+
+// HostProvider uses per-host credentials from the global config
+type HostProvider struct {
+	Config *config.GlobalConfig
+}
+
+func (p *HostProvider) Name() string { return "host config" }
+
+func (p *HostProvider) Auth(ep *transport.Endpoint) (transport.AuthMethod, error) {
+	if p.Config == nil {
+		return nil, nil
+	}
+	host, ok := p.Config.GitHost(ep.Host, ep.Port)
+	if !ok {
+		return nil, nil
+	}
+
+	if isHTTP(ep) {
+		token := host.ResolveToken()
+		if token == "" {
+			return nil, nil
+		}
+		username := host.Username
+		if username == "" {
+			username = defaultTokenUsername(ep.Host)
+		}
+		return &http.BasicAuth{Username: username, Password: token}, nil
+	}
+
+	if ep.Protocol == "ssh" && host.SSHKey != "" {
+		keyPath := expandHome(host.SSHKey)
+		auth, err := ssh.NewPublicKeysFromFile(sshUser(ep, host.Username), keyPath, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", keyPath, err)
+		}
+		return auth, nil
+	}
+
+	return nil, nil
+}
+
+// defaultTokenUsername returns the username to pair with a token when none
+// is configured. Most hosts ignore it; Azure DevOps and GitHub accept any
+// non-empty value.
+func defaultTokenUsername(host string) string {
+	switch {
+	case isAzureDevOpsHost(host):
+		return "pat"
+	case host == "github.com":
+		return "x-access-token"
+	default:
+		return "oauth2"
+	}
+}
+
+// isAzureDevOpsHost reports whether host belongs to Azure DevOps
+func isAzureDevOpsHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "dev.azure.com" || host == "ssh.dev.azure.com" || strings.HasSuffix(host, ".visualstudio.com")
+}
+
+// EnvProvider uses tokens from well-known environment variables. Tokens are
+// scoped to their host so, for example, GITHUB_TOKEN is never sent to a
+// self-hosted server. GITLAB_TOKEN and BITBUCKET_TOKEN also go to the
+// self-hosted servers configured with "api": "gitlab" or "bitbucket".
+// GIT_USERNAME/GIT_PASSWORD apply to any HTTP host.
+type EnvProvider struct {
+	Config *config.GlobalConfig
+}
+
+func (p *EnvProvider) Name() string { return "environment" }
+
+func (p *EnvProvider) Auth(ep *transport.Endpoint) (transport.AuthMethod, error) {
+	if !isHTTP(ep) {
+		return nil, nil
+	}
+
+	host := strings.ToLower(ep.Host)
+	var tokenVars []string
+	switch {
+	case host == "github.com":
+		tokenVars = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+	case host == "gitlab.com" || p.configuredAPI(ep) == "gitlab":
+		tokenVars = []string{"GITLAB_TOKEN"}
+	case isAzureDevOpsHost(host):
+		tokenVars = []string{"AZURE_DEVOPS_TOKEN", "AZURE_DEVOPS_EXT_PAT"}
+	case host == "bitbucket.org" || p.configuredAPI(ep) == "bitbucket":
+		tokenVars = []string{"BITBUCKET_TOKEN"}
+	}
+
+	for _, name := range tokenVars {
+		if token := os.Getenv(name); token != "" {
+			username := os.Getenv("GIT_USERNAME")
+			if username == "" {
+				username = defaultTokenUsername(host)
+			}
+			return &http.BasicAuth{Username: username, Password: token}, nil
+		}
+	}
+
+	if username := os.Getenv("GIT_USERNAME"); username != "" {
+		if password := os.Getenv("GIT_PASSWORD"); password != "" {
+			return &http.BasicAuth{Username: username, Password: password}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// configuredAPI returns the API set for the endpoint's host in the global
+// config, or "" if it has none
+func (p *EnvProvider) configuredAPI(ep *transport.Endpoint) string {
+	if p.Config == nil {
+		return ""
+	}
+	host, ok := p.Config.GitHost(ep.Host, ep.Port)
+	if !ok {
+		return ""
+	}
+	return strings.ToLower(host.API)
+}
+
+// credentialHelperTimeout bounds how long a credential helper may take
+const credentialHelperTimeout = 10 * time.Second
+
+// CredentialHelperProvider asks git's configured credential helpers
+// (osxkeychain, manager, store, ...) via `git credential fill`
+type CredentialHelperProvider struct{}
+
+func (p *CredentialHelperProvider) Name() string { return "git credential helper" }
+
+func (p *CredentialHelperProvider) Auth(ep *transport.Endpoint) (transport.AuthMethod, error) {
+	if !isHTTP(ep) {
+		return nil, nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, nil
+	}
+
+	host := ep.Host
+	if ep.Port > 0 {
+		host = fmt.Sprintf("%s:%d", ep.Host, ep.Port)
+	}
+
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%s\nhost=%s\n", ep.Protocol, host)
+	if ep.User != "" {
+		fmt.Fprintf(&input, "username=%s\n", ep.User)
+	}
+	input.WriteString("\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialHelperTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", "credential", "fill")
+	cmd.Stdin = &input
+	// Never prompt; a missing credential just means "not found"
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GCM_INTERACTIVE=never")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, nil
+	}
+
+	values := parseCredentialOutput(output)
+	if values["password"] == "" {
+		return nil, nil
+	}
+	return &http.BasicAuth{Username: values["username"], Password: values["password"]}, nil
+}
+
+// parseCredentialOutput parses the key=value lines printed by `git credential fill`
+func parseCredentialOutput(output []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// SSHProvider uses the SSH agent, falling back to the default key files
+type SSHProvider struct{}
+
+func (p *SSHProvider) Name() string { return "ssh" }
+
+func (p *SSHProvider) Auth(ep *transport.Endpoint) (transport.AuthMethod, error) {
+	if ep.Protocol != "ssh" {
+		return nil, nil
+	}
+	user := sshUser(ep, "")
+
+	// Try to use SSH agent first
+	if auth, err := ssh.NewSSHAgentAuth(user); err == nil {
+		return auth, nil
+	}
+
+	// Fall back to default SSH key
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	// Try common SSH key locations
+	keyPaths := []string{
+		filepath.Join(homeDir, ".ssh", "id_rsa"),
+		filepath.Join(homeDir, ".ssh", "id_ed25519"),
+		filepath.Join(homeDir, ".ssh", "id_ecdsa"),
+	}
+
+	for _, keyPath := range keyPaths {
+		if _, err := os.Stat(keyPath); err == nil {
+			auth, err := ssh.NewPublicKeysFromFile(user, keyPath, "")
+			if err == nil {
+				return auth, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no SSH key found")
+}
+
+// expandHome expands a leading ~ in path
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(homeDir, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,132 @@
+package gitauth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestHostProviderFromGlobalConfig(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-gitauth-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.jsonc")
+	content := `{
+  // Self-hosted servers
+  "git": {
+    "hosts": {
+      "git.corp.example": {"username": "alice", "token": "secret"},
+      "bitbucket.corp:8443": {"tokenEnv": "WORKLET_TEST_BB_TOKEN"}
+    }
+  }
+}`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	global, err := config.LoadGlobalConfigFrom(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WORKLET_TEST_BB_TOKEN", "from-env")
+
+	resolver := NewResolver(&HostProvider{Config: global})
+
+	tests := []struct {
+		url      string
+		username string
+		password string
+	}{
+		{"https://git.corp.example/team/repo.git", "alice", "secret"},
+		{"https://GIT.CORP.EXAMPLE/team/repo.git", "alice", "secret"},
+		{"https://bitbucket.corp:8443/scm/proj/repo.git", "oauth2", "from-env"},
+	}
+
+	for _, tt := range tests {
+		auth, err := resolver.Auth(tt.url)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		basic, ok := auth.(*http.BasicAuth)
+		if !ok {
+			t.Fatalf("%s: expected basic auth, got %T", tt.url, auth)
+		}
+		if basic.Username != tt.username || basic.Password != tt.password {
+			t.Errorf("%s: got %s/%s, want %s/%s", tt.url, basic.Username, basic.Password, tt.username, tt.password)
+		}
+	}
+
+	// Unconfigured hosts and ports fall through
+	for _, url := range []string{"https://other.example/repo.git", "https://bitbucket.corp/scm/proj/repo.git"} {
+		if auth, _ := resolver.Auth(url); auth != nil {
+			t.Errorf("%s: expected no auth, got %T", url, auth)
+		}
+	}
+}
+
+func TestEnvProviderScopesTokensToHost(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "gh")
+	t.Setenv("GITLAB_TOKEN", "gl")
+	t.Setenv("AZURE_DEVOPS_TOKEN", "az")
+	t.Setenv("BITBUCKET_TOKEN", "bb")
+	t.Setenv("GIT_USERNAME", "")
+	t.Setenv("GIT_PASSWORD", "")
+
+	provider := &EnvProvider{Config: &config.GlobalConfig{Git: config.GitConfig{Hosts: map[string]config.GitHostConfig{
+		"git.corp.example": {API: "gitlab"},
+	}}}}
+
+	tests := []struct {
+		url      string
+		password string
+	}{
+		{"https://github.com/user/repo.git", "gh"},
+		{"https://dev.azure.com/org/project/_git/repo", "az"},
+		{"https://org.visualstudio.com/project/_git/repo", "az"},
+		{"https://gitlab.com/user/repo.git", "gl"},
+		{"https://bitbucket.org/user/repo.git", "bb"},
+		{"https://git.corp.example/user/repo.git", "gl"},
+		{"https://gitlab.attacker.example/user/repo.git", ""},
+		{"https://bitbucket.attacker.example/user/repo.git", ""},
+		{"https://other.example/user/repo.git", ""},
+	}
+
+	for _, tt := range tests {
+		ep, err := transport.NewEndpoint(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := provider.Auth(ep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.password == "" {
+			if auth != nil {
+				t.Errorf("%s: token leaked to unrelated host", tt.url)
+			}
+			continue
+		}
+		basic, ok := auth.(*http.BasicAuth)
+		if !ok || basic.Password != tt.password {
+			t.Errorf("%s: expected token %q, got %v", tt.url, tt.password, auth)
+		}
+	}
+}
+
+func TestParseCredentialOutput(t *testing.T) {
+	values := parseCredentialOutput([]byte("protocol=https\nhost=example.com\nusername=bob\npassword=a=b\n"))
+
+	if values["username"] != "bob" {
+		t.Errorf("expected username bob, got %q", values["username"])
+	}
+	if values["password"] != "a=b" {
+		t.Errorf("expected password a=b, got %q", values["password"])
+	}
+}
@@ -0,0 +1,327 @@
+package gitcache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// DefaultMaxSize is the cache size limit when WORKLET_GIT_CACHE_MAX_MB is unset
+const DefaultMaxSize = 5 << 30 // 5GB
+
+// mirrorScheme is the URL scheme Clone reads mirrors through. It has its
+// own transport rather than replacing go-git's file one, which the rest of
+// the process keeps using.
+const mirrorScheme = "worklet-mirror"
+
+var installMirrorTransport sync.Once
+
+// Cache keeps bare mirrors of git remotes so repeated runs of the same
+// repository only fetch new objects
+type Cache struct {
+	dir     string
+	maxSize int64
+}
+
+// Entry describes a single cached mirror
+type Entry struct {
+	URL      string    `json:"url"`
+	LastUsed time.Time `json:"last_used"`
+	Path     string    `json:"-"`
+	Size     int64     `json:"-"`
+}
+
+// New returns the cache under ~/.worklet/git-cache
+func New() (*Cache, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	maxSize := int64(DefaultMaxSize)
+	if mb := os.Getenv("WORKLET_GIT_CACHE_MAX_MB"); mb != "" {
+		if parsed, err := strconv.ParseInt(mb, 10, 64); err == nil && parsed > 0 {
+			maxSize = parsed << 20
+		}
+	}
+
+	return NewAt(filepath.Join(homeDir, ".worklet", "git-cache"), maxSize), nil
+}
+
+// NewAt returns a cache rooted at dir
+func NewAt(dir string, maxSize int64) *Cache {
+	return &Cache{dir: dir, maxSize: maxSize}
+}
+
+// Dir returns the cache directory
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Enabled reports whether the cache should be used
+func Enabled() bool {
+	return os.Getenv("WORKLET_GIT_CACHE") != "false"
+}
+
+// key returns the directory name for a remote URL
+func key(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// MirrorPath returns where the bare mirror for url is stored
+func (c *Cache) MirrorPath(url string) string {
+	return filepath.Join(c.dir, key(url)+".git")
+}
+
+func (c *Cache) metaPath(url string) string {
+	return filepath.Join(c.dir, key(url)+".json")
+}
+
+// Sync creates or updates the mirror for url and returns its path
+func (c *Cache) Sync(ctx context.Context, url string, auth transport.AuthMethod, progress io.Writer) (string, error) {
+	path := c.MirrorPath(url)
+
+	err := storage.WithLock(path, func() error {
+		repo, err := git.PlainOpen(path)
+		if err != nil {
+			// No usable mirror yet, start from scratch
+			os.RemoveAll(path)
+			_, err = git.PlainCloneContext(ctx, path, true, &git.CloneOptions{
+				URL:      url,
+				Auth:     auth,
+				Mirror:   true,
+				Progress: progress,
+			})
+			if err != nil {
+				os.RemoveAll(path)
+				return err
+			}
+		} else {
+			err = repo.FetchContext(ctx, &git.FetchOptions{
+				RemoteName: "origin",
+				RefSpecs:   []gitconfig.RefSpec{"+refs/*:refs/*"},
+				Auth:       auth,
+				Progress:   progress,
+				Force:      true,
+			})
+			if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+				return fmt.Errorf("failed to fetch into cache: %w", err)
+			}
+		}
+
+		return c.touch(url)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Keep the cache within its size limit, never evicting what we just used
+	if _, err := c.Prune(0, c.maxSize, url); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to prune git cache: %v\n", err)
+	}
+
+	return path, nil
+}
+
+// Clone clones url into targetDir from the mirror synced by Sync. The origin
+// remote of the result points at url, not the cache. The mirror is locked
+// while it's read, so Prune can't evict it part way through.
+func (c *Cache) Clone(ctx context.Context, url, targetDir string, opts *git.CloneOptions) (*git.Repository, error) {
+	// Serve the mirror in-process so no git binary is needed
+	installMirrorTransport.Do(func() {
+		client.InstallProtocol(mirrorScheme, server.DefaultServer)
+	})
+
+	path := c.MirrorPath(url)
+	cloneOpts := *opts
+	cloneOpts.URL = mirrorScheme + "://" + filepath.ToSlash(path)
+	cloneOpts.Auth = nil
+	// Local clones are cheap, and the in-process server can't do shallow fetches
+	cloneOpts.Depth = 0
+
+	var repo *git.Repository
+	err := storage.WithLock(path, func() error {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("cached mirror of %s was evicted: %w", RedactURL(url), err)
+		}
+		var err error
+		repo, err = git.PlainCloneContext(ctx, targetDir, false, &cloneOpts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Point origin back at the real remote so pushes and fetches work
+	if err := repo.DeleteRemote("origin"); err != nil {
+		return nil, fmt.Errorf("failed to reset origin: %w", err)
+	}
+	if _, err := repo.CreateRemote(&gitconfig.RemoteConfig{
+		Name:  "origin",
+		URLs:  []string{url},
+		Fetch: []gitconfig.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to reset origin: %w", err)
+	}
+
+	return repo, nil
+}
+
+// RedactURL removes the user info from a remote URL, so tokens embedded in
+// it aren't written to disk or shown
+func RedactURL(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote
+	}
+	u.User = nil
+	return u.String()
+}
+
+// touch records that url was just used
+func (c *Cache) touch(url string) error {
+	data, err := json.MarshalIndent(Entry{URL: RedactURL(url), LastUsed: time.Now()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFileAtomic(c.metaPath(url), data, 0644)
+}
+
+// List returns all cached mirrors, most recently used first
+func (c *Cache) List() ([]Entry, error) {
+	files, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		entry.Path = strings.TrimSuffix(file, ".json") + ".git"
+		entry.Size = DirSize(entry.Path)
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	return entries, nil
+}
+
+// Prune removes mirrors unused for longer than maxAge (if non-zero), then
+// evicts the least recently used until the cache fits in maxSize (if
+// non-zero). URLs in keep are never removed. Each mirror is evicted while
+// holding its lock, so a Clone reading it finishes first, and is kept if a
+// Sync used it since it was listed. It returns the removed entries.
+func (c *Cache) Prune(maxAge time.Duration, maxSize int64, keep ...string) ([]Entry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	keepSet := make(map[string]bool)
+	for _, url := range keep {
+		keepSet[RedactURL(url)] = true
+	}
+
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+
+	var removed []Entry
+	// Walk from least to most recently used
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if keepSet[entry.URL] {
+			continue
+		}
+
+		expired := maxAge > 0 && time.Since(entry.LastUsed) > maxAge
+		oversized := maxSize > 0 && total > maxSize
+		if !expired && !oversized {
+			continue
+		}
+
+		evicted, err := c.remove(entry)
+		if err != nil {
+			return removed, err
+		}
+		if !evicted {
+			continue
+		}
+		total -= entry.Size
+		removed = append(removed, entry)
+	}
+
+	return removed, nil
+}
+
+// Clear removes every cached mirror
+func (c *Cache) Clear() error {
+	return os.RemoveAll(c.dir)
+}
+
+// remove evicts entry's mirror unless it was used since entry was listed,
+// and reports whether it did. The lock file is left in place, as removing it
+// would let the next process lock a new file while another still holds the
+// old one.
+func (c *Cache) remove(entry Entry) (bool, error) {
+	metaPath := strings.TrimSuffix(entry.Path, ".git") + ".json"
+	evicted := false
+	err := storage.WithLock(entry.Path, func() error {
+		if data, err := os.ReadFile(metaPath); err == nil {
+			var current Entry
+			if json.Unmarshal(data, &current) == nil && current.LastUsed.After(entry.LastUsed) {
+				return nil
+			}
+		}
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", entry.Path, err)
+		}
+		os.Remove(metaPath)
+		evicted = true
+		return nil
+	})
+	return evicted, err
+}
+
+// DirSize returns the total size of files under dir
+func DirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,139 @@
+package har
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBodyTruncates(t *testing.T) {
+	var body Body
+	body.Write(bytes.Repeat([]byte("a"), MaxBodySize-10))
+	body.Write(bytes.Repeat([]byte("b"), 20))
+
+	if len(body.Data) != MaxBodySize {
+		t.Errorf("recorded %d bytes, want %d", len(body.Data), MaxBodySize)
+	}
+	if body.Size != MaxBodySize+10 {
+		t.Errorf("size = %d, want %d", body.Size, MaxBodySize+10)
+	}
+	if !body.Truncated() {
+		t.Error("body should be truncated")
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/items?b=2&a=1", strings.NewReader(`{"name":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	reqBody := &Body{}
+	reqBody.Write([]byte(`{"name":"x"}`))
+
+	resp := &http.Response{
+		StatusCode: 201,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"image/png"}},
+	}
+	respBody := &Body{}
+	respBody.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+
+	started := time.Now()
+	entry := NewEntry(req, "http://app.local/api/items?b=2&a=1", reqBody, resp, respBody, started, 30*time.Millisecond, 50*time.Millisecond)
+
+	if entry.Request.Method != "POST" || entry.Request.URL != "http://app.local/api/items?b=2&a=1" {
+		t.Errorf("request = %s %s", entry.Request.Method, entry.Request.URL)
+	}
+	if got := entry.Request.QueryString; len(got) != 2 || got[0].Name != "a" || got[1].Name != "b" {
+		t.Errorf("query string = %v, want a and b sorted", got)
+	}
+	if got := entry.Request.Cookies; len(got) != 1 || got[0].Value != "abc" {
+		t.Errorf("cookies = %v", got)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"name":"x"}` {
+		t.Errorf("post data = %+v", entry.Request.PostData)
+	}
+	if entry.Response.Status != 201 || entry.Response.StatusText != "Created" {
+		t.Errorf("status = %d %s", entry.Response.Status, entry.Response.StatusText)
+	}
+	if entry.Response.Content.Encoding != "base64" {
+		t.Errorf("binary response should be base64 encoded, got %+v", entry.Response.Content)
+	}
+	if entry.Time != 50 || entry.Timings.Wait != 30 || entry.Timings.Receive != 20 {
+		t.Errorf("timings = %v %+v", entry.Time, entry.Timings)
+	}
+}
+
+func TestNewEntryFailedRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	entry := NewEntry(req, "http://app.local/", &Body{}, nil, &Body{}, time.Now(), 0, time.Millisecond)
+
+	if entry.Response.Status != 0 {
+		t.Errorf("status = %d, want 0 for a failed request", entry.Response.Status)
+	}
+	if entry.Request.PostData != nil {
+		t.Error("request without a body should have no post data")
+	}
+}
+
+func TestIsText(t *testing.T) {
+	tests := map[string]bool{
+		"text/html; charset=utf-8": true,
+		"application/json":         true,
+		"application/problem+json": true,
+		"application/atom+xml":     true,
+		"application/octet-stream": false,
+		"image/png":                false,
+	}
+	for contentType, want := range tests {
+		if got := isText(contentType); got != want {
+			t.Errorf("isText(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestAppendAndReadEntries(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "har-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "taps", "1.jsonl")
+
+	entries, err := ReadEntries(path)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("missing recording: entries = %v, err = %v", entries, err)
+	}
+
+	for _, service := range []string{"web", "api"} {
+		if err := Append(path, Entry{Service: service}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	// A line cut short by a crash is skipped
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"request":{"method":"GE`)
+	file.Close()
+
+	entries, err = ReadEntries(path)
+	if err != nil {
+		t.Fatalf("ReadEntries() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].Service != "web" || entries[1].Service != "api" {
+		t.Errorf("entries = %+v, want web and api", entries)
+	}
+
+	doc := Build(nil)
+	if doc.Log.Version != "1.2" || doc.Log.Entries == nil {
+		t.Errorf("Build(nil) = %+v, want version 1.2 with an empty entry list", doc.Log)
+	}
+}
@@ -0,0 +1,194 @@
+package har
+
+import (
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxBodySize is how much of a request or response body is recorded
+const MaxBodySize = 1 << 20 // 1MB
+
+// Body is a recorded request or response body, cut at MaxBodySize
+type Body struct {
+	Data []byte
+	Size int64 // Full size, which is more than len(Data) if it was cut
+}
+
+// Write records p, keeping at most MaxBodySize bytes. It never fails, so a
+// Body can sit behind an io.TeeReader.
+func (b *Body) Write(p []byte) (int, error) {
+	b.Size += int64(len(p))
+	if room := MaxBodySize - len(b.Data); room > 0 {
+		if len(p) > room {
+			b.Data = append(b.Data, p[:room]...)
+		} else {
+			b.Data = append(b.Data, p...)
+		}
+	}
+	return len(p), nil
+}
+
+// Truncated reports whether part of the body wasn't recorded
+func (b *Body) Truncated() bool {
+	return b.Size > int64(len(b.Data))
+}
+
+// comment explains a cut body
+func (b *Body) comment() string {
+	if !b.Truncated() {
+		return ""
+	}
+	return fmt.Sprintf("truncated to the first %d of %d bytes", len(b.Data), b.Size)
+}
+
+// NewEntry builds an entry from a proxied exchange. url is the URL the
+// client asked for, wait is the time until the response headers arrived
+// and total the time until the response body was read. resp is nil when
+// the request failed, which is recorded as a response with status 0.
+func NewEntry(req *http.Request, url string, reqBody *Body, resp *http.Response, respBody *Body, started time.Time, wait, total time.Duration) Entry {
+	entry := Entry{
+		StartedDateTime: started,
+		Time:            millis(total),
+		Request: Request{
+			Method:      req.Method,
+			URL:         url,
+			HTTPVersion: req.Proto,
+			Cookies:     requestCookies(req),
+			Headers:     headers(req.Header),
+			QueryString: queryString(req),
+			HeadersSize: -1,
+			BodySize:    reqBody.Size,
+		},
+		Timings: Timings{
+			Wait:    millis(wait),
+			Receive: millis(total - wait),
+		},
+	}
+	if reqBody.Size > 0 {
+		entry.Request.PostData = postData(req.Header.Get("Content-Type"), reqBody)
+	}
+
+	if resp == nil {
+		entry.Response = Response{
+			Cookies:     []NameValue{},
+			Headers:     []NameValue{},
+			Content:     Content{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		return entry
+	}
+
+	entry.Response = Response{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     responseCookies(resp),
+		Headers:     headers(resp.Header),
+		Content:     content(resp.Header.Get("Content-Type"), respBody),
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    respBody.Size,
+	}
+	return entry
+}
+
+// postData records a request body. HAR can't hold binary request bodies, so
+// only their size is kept.
+func postData(contentType string, body *Body) *PostData {
+	data := &PostData{MimeType: contentType, Comment: body.comment()}
+	if utf8.Valid(body.Data) {
+		data.Text = string(body.Data)
+	} else {
+		data.Comment = fmt.Sprintf("binary body of %d bytes not recorded", body.Size)
+	}
+	return data
+}
+
+// content records a response body, base64 encoding binary ones
+func content(contentType string, body *Body) Content {
+	c := Content{
+		Size:     body.Size,
+		MimeType: contentType,
+		Comment:  body.comment(),
+	}
+	if c.MimeType == "" {
+		c.MimeType = "x-unknown"
+	}
+	if len(body.Data) == 0 {
+		return c
+	}
+	if isText(contentType) && utf8.Valid(body.Data) {
+		c.Text = string(body.Data)
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString(body.Data)
+		c.Encoding = "base64"
+	}
+	return c
+}
+
+// isText reports whether a content type is stored as text
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// Without a usable content type, fall back to the bytes themselves
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/x-www-form-urlencoded", "application/graphql", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml")
+}
+
+// headers returns headers sorted by name
+func headers(h http.Header) []NameValue {
+	pairs := []NameValue{}
+	for name, values := range h {
+		for _, value := range values {
+			pairs = append(pairs, NameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+func queryString(req *http.Request) []NameValue {
+	pairs := []NameValue{}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			pairs = append(pairs, NameValue{Name: name, Value: value})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+func requestCookies(req *http.Request) []NameValue {
+	cookies := []NameValue{}
+	for _, cookie := range req.Cookies() {
+		cookies = append(cookies, NameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+func responseCookies(resp *http.Response) []NameValue {
+	cookies := []NameValue{}
+	for _, cookie := range resp.Cookies() {
+		cookies = append(cookies, NameValue{Name: cookie.Name, Value: cookie.Value})
+	}
+	return cookies
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,335 @@
+package logfile
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayout is the prefix the standard log package writes
+const timestampLayout = "2006/01/02 15:04:05"
+
+// RotateOptions limits how large and how old a log gets
+type RotateOptions struct {
+	MaxSize int64         // Rotate once the log is larger than this
+	MaxAge  time.Duration // Remove rotated logs last written longer ago than this
+	Keep    int           // Keep at most this many rotated logs
+}
+
+// DefaultRotateOptions keeps 5 rotated logs of up to 10 MB for a week
+var DefaultRotateOptions = RotateOptions{
+	MaxSize: 10 << 20,
+	MaxAge:  7 * 24 * time.Hour,
+	Keep:    5,
+}
+
+// Rotate moves path to path.1, shifting older rotations up, if it is larger
+// than opts.MaxSize, then removes rotations beyond opts.Keep or older than
+// opts.MaxAge. A missing log is not an error.
+func Rotate(path string, opts RotateOptions) error {
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	if err == nil && opts.MaxSize > 0 && info.Size() > opts.MaxSize {
+		if err := shiftRotated(path); err != nil {
+			return err
+		}
+		if err := os.Rename(path, rotatedPath(path, 1)); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+	}
+
+	pruneRotated(path, opts)
+	return nil
+}
+
+// RotateCopy rotates a log that a running process keeps open for appending,
+// such as the daemon's own: rather than moving it, which would leave the
+// process writing to path.1, it copies it to path.1 and truncates it. Lines
+// written between the copy and the truncation are lost.
+func RotateCopy(path string, opts RotateOptions) error {
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	if err == nil && opts.MaxSize > 0 && info.Size() > opts.MaxSize {
+		if err := shiftRotated(path); err != nil {
+			return err
+		}
+		if err := copyFile(path, rotatedPath(path, 1)); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+		if err := os.Truncate(path, 0); err != nil {
+			return fmt.Errorf("failed to truncate %s: %w", path, err)
+		}
+	}
+
+	pruneRotated(path, opts)
+	return nil
+}
+
+// shiftRotated renames each rotated log of path to the next number, the
+// oldest first so none is overwritten
+func shiftRotated(path string) error {
+	rotated := Rotated(path)
+	for i := len(rotated) - 1; i >= 0; i-- {
+		n, _ := strconv.Atoi(strings.TrimPrefix(rotated[i], path+"."))
+		if err := os.Rename(rotated[i], rotatedPath(path, n+1)); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// pruneRotated removes rotations beyond opts.Keep or older than opts.MaxAge
+func pruneRotated(path string, opts RotateOptions) {
+	for i, old := range Rotated(path) {
+		info, err := os.Stat(old)
+		if err != nil {
+			continue
+		}
+		expired := opts.MaxAge > 0 && time.Since(info.ModTime()) > opts.MaxAge
+		if i >= opts.Keep || expired {
+			os.Remove(old)
+		}
+	}
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Rotated returns the rotated logs of path, newest first
+func Rotated(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+	numbers := make(map[string]int, len(matches))
+	var rotated []string
+	for _, match := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(match, path+"."))
+		if err != nil || n < 1 {
+			continue
+		}
+		numbers[match] = n
+		rotated = append(rotated, match)
+	}
+	sort.Slice(rotated, func(i, j int) bool { return numbers[rotated[i]] < numbers[rotated[j]] })
+	return rotated
+}
+
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// Filter selects log lines. Lines without a timestamp belong to the last
+// timestamped line before them.
+type Filter struct {
+	Since   time.Time      // Only lines logged at or after this time
+	Pattern *regexp.Regexp // Only lines matching this
+}
+
+// Match reports whether a line logged at stamp passes the filter. A zero
+// stamp is taken to be before Since.
+func (f Filter) Match(line string, stamp time.Time) bool {
+	if !f.Since.IsZero() && stamp.Before(f.Since) {
+		return false
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(line)
+}
+
+// Timestamp returns the time the standard log package wrote at the start of
+// line, if any
+func Timestamp(line string) (time.Time, bool) {
+	if len(line) < len(timestampLayout) {
+		return time.Time{}, false
+	}
+	stamp, err := time.ParseInLocation(timestampLayout, line[:len(timestampLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return stamp, true
+}
+
+// Query writes the lines of path and its rotated logs, oldest first, that
+// pass filter. With tail above zero only the last tail of those are written.
+func Query(w io.Writer, path string, filter Filter, tail int) error {
+	files := Rotated(path)
+	for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+		files[i], files[j] = files[j], files[i]
+	}
+	files = append(files, path)
+
+	var kept []string
+	var stamp time.Time
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("failed to open %s: %w", file, err)
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if t, ok := Timestamp(line); ok {
+				stamp = t
+			}
+			if !filter.Match(line, stamp) {
+				continue
+			}
+			kept = append(kept, line)
+			if tail > 0 && len(kept) > 2*tail {
+				kept = append(kept[:0], kept[len(kept)-tail:]...)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+	}
+
+	if tail > 0 && len(kept) > tail {
+		kept = kept[len(kept)-tail:]
+	}
+	for _, line := range kept {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Follow writes lines appended to path that pass filter until ctx is done,
+// starting at its current end. It keeps following the log when it is
+// rotated or truncated.
+func Follow(ctx context.Context, w io.Writer, path string, filter Filter) error {
+	var f *os.File
+	var reader *bufio.Reader
+	var offset int64
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+
+	open := func(fromEnd bool) error {
+		if f != nil {
+			f.Close()
+			f = nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		offset = 0
+		if fromEnd {
+			if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+				file.Close()
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+		}
+		f, reader = file, bufio.NewReader(file)
+		return nil
+	}
+	if err := open(true); err != nil {
+		return err
+	}
+
+	var partial string
+	var stamp time.Time
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if f != nil {
+			for {
+				chunk, err := reader.ReadString('\n')
+				offset += int64(len(chunk))
+				if err != nil {
+					// Keep an unfinished line until the rest is written
+					partial += chunk
+					break
+				}
+				line := strings.TrimRight(partial+chunk, "\r\n")
+				partial = ""
+				if t, ok := Timestamp(line); ok {
+					stamp = t
+				}
+				if filter.Match(line, stamp) {
+					fmt.Fprintln(w, line)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Reopen the log if it was rotated away or truncated
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			continue
+		case f == nil:
+			partial = ""
+			if err := open(false); err != nil {
+				return err
+			}
+		default:
+			current, statErr := f.Stat()
+			if statErr != nil || !os.SameFile(info, current) || info.Size() < offset {
+				partial = ""
+				if err := open(false); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// ParseSince parses a --since value: a duration before now such as "90m" or
+// "2h", a date, or a date and time
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid time %q: duration must be positive", value)
+		}
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (expected a duration like 2h or a date like 2006-01-02 15:04)", value)
+}
@@ -0,0 +1,184 @@
+package logfile
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logfile-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "daemon.log")
+	opts := RotateOptions{MaxSize: 10, MaxAge: time.Hour, Keep: 2}
+
+	// Small logs stay put
+	os.WriteFile(path, []byte("short\n"), 0644)
+	if err := Rotate(path, opts); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if rotated := Rotated(path); len(rotated) != 0 {
+		t.Fatalf("rotated a small log: %v", rotated)
+	}
+
+	for _, content := range []string{"first log line\n", "second log line\n", "third log line\n"} {
+		os.WriteFile(path, []byte(content), 0644)
+		if err := Rotate(path, opts); err != nil {
+			t.Fatalf("Rotate failed: %v", err)
+		}
+	}
+	rotated := Rotated(path)
+	if len(rotated) != 2 {
+		t.Fatalf("rotated = %v, want 2 kept", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "third log line\n" {
+		t.Errorf("newest rotation = %q, want the third log", data)
+	}
+	if data, _ := os.ReadFile(rotated[1]); string(data) != "second log line\n" {
+		t.Errorf("oldest rotation = %q, want the second log", data)
+	}
+
+	// Old rotations are removed
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(rotated[1], old, old)
+	if err := Rotate(path, opts); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if rotated := Rotated(path); len(rotated) != 1 {
+		t.Errorf("rotated = %v, want the expired log removed", rotated)
+	}
+}
+
+func TestRotateCopy(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logfile-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "daemon.log")
+	opts := RotateOptions{MaxSize: 10, MaxAge: time.Hour, Keep: 2}
+
+	// The daemon keeps writing to the log it was started with
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("first log line\n")
+
+	if err := RotateCopy(path, opts); err != nil {
+		t.Fatalf("RotateCopy failed: %v", err)
+	}
+	rotated := Rotated(path)
+	if len(rotated) != 1 {
+		t.Fatalf("rotated = %v, want 1", rotated)
+	}
+	if data, _ := os.ReadFile(rotated[0]); string(data) != "first log line\n" {
+		t.Errorf("rotation = %q, want the first log", data)
+	}
+
+	f.WriteString("second\n")
+	if data, _ := os.ReadFile(path); string(data) != "second\n" {
+		t.Errorf("log = %q, want only what was written after rotating", data)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logfile-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "daemon.log")
+	os.WriteFile(path+".1", []byte("2024/05/01 10:00:00 started\n2024/05/01 11:00:00 nginx reloaded\n"), 0644)
+	os.WriteFile(path, []byte("2024/05/01 12:00:00 session abc registered\ncontinued without a timestamp\n2024/05/01 13:00:00 nginx reloaded\n"), 0644)
+
+	since := time.Date(2024, 5, 1, 11, 30, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		filter Filter
+		tail   int
+		want   []string
+	}{
+		{"all", Filter{}, 0, []string{"started", "11:00:00 nginx", "abc", "continued", "13:00:00 nginx"}},
+		{"since", Filter{Since: since}, 0, []string{"abc", "continued", "13:00:00 nginx"}},
+		{"grep", Filter{Pattern: regexp.MustCompile("nginx")}, 0, []string{"11:00:00 nginx", "13:00:00 nginx"}},
+		{"tail", Filter{}, 2, []string{"continued", "13:00:00 nginx"}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := Query(&out, path, tt.filter, tt.tail); err != nil {
+			t.Fatalf("%s: Query failed: %v", tt.name, err)
+		}
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if len(lines) != len(tt.want) {
+			t.Errorf("%s: got %q, want %d lines", tt.name, lines, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(lines[i], want) {
+				t.Errorf("%s: line %d = %q, want it to contain %q", tt.name, i, lines[i], want)
+			}
+		}
+	}
+}
+
+func TestFollowAcrossRotation(t *testing.T) {
+	dir, err := os.MkdirTemp("", "logfile-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "daemon.log")
+	os.WriteFile(path, []byte("before following\n"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var out bytes.Buffer
+	done := make(chan error)
+	go func() { done <- Follow(ctx, &out, path, Filter{Pattern: regexp.MustCompile("keep")}) }()
+
+	time.Sleep(100 * time.Millisecond)
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("keep one\nskip this\n")
+	f.Close()
+	time.Sleep(400 * time.Millisecond)
+
+	os.Rename(path, path+".1")
+	os.WriteFile(path, []byte("keep two\n"), 0644)
+	time.Sleep(800 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+
+	if got := out.String(); got != "keep one\nkeep two\n" {
+		t.Errorf("Follow wrote %q", got)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	if got, err := ParseSince("90m", now); err != nil || !got.Equal(now.Add(-90*time.Minute)) {
+		t.Errorf("ParseSince(90m) = %v, %v", got, err)
+	}
+	if got, err := ParseSince("2024-04-30 08:15", now); err != nil || !got.Equal(time.Date(2024, 4, 30, 8, 15, 0, 0, time.Local)) {
+		t.Errorf("ParseSince(date) = %v, %v", got, err)
+	}
+	for _, bad := range []string{"yesterday", "-1h"} {
+		if _, err := ParseSince(bad, now); err == nil {
+			t.Errorf("ParseSince(%q) succeeded, want an error", bad)
+		}
+	}
+}
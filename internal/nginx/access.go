@@ -0,0 +1,50 @@
+package nginx
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AccessEntry is a proxied request read from the activity log
+type AccessEntry struct {
+	Time     time.Time
+	Host     string
+	ForkID   string // Empty for requests that matched no session
+	Service  string
+	Method   string
+	Status   int
+	Duration time.Duration
+	URI      string
+}
+
+// ParseAccessLine parses a line of the activity log. Lines written by
+// older versions only have the time and host.
+func ParseAccessLine(line string) (AccessEntry, bool) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 7)
+	if len(fields) < 2 {
+		return AccessEntry{}, false
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return AccessEntry{}, false
+	}
+	entry := AccessEntry{
+		Time: time.UnixMilli(int64(seconds * 1000)),
+		Host: fields[1],
+	}
+	if len(fields) < 7 {
+		return entry, true
+	}
+
+	if forkID, service, ok := strings.Cut(fields[2], "/"); ok {
+		entry.ForkID, entry.Service = forkID, service
+	}
+	entry.Method = fields[3]
+	entry.Status, _ = strconv.Atoi(fields[4])
+	if requestTime, err := strconv.ParseFloat(fields[5], 64); err == nil {
+		entry.Duration = time.Duration(requestTime * float64(time.Second))
+	}
+	entry.URI = fields[6]
+	return entry, true
+}
@@ -2,36 +2,201 @@ package nginx
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"path"
+	"strings"
 	"text/template"
-	
+
 	"github.com/nolanleung/worklet/internal/config"
 )
 
 // ForkService represents a service within a fork
 type ForkService struct {
-	ForkID      string
-	ProjectName string
-	Service     string
-	Port        int
-	Subdomain   string
+	ForkID           string
+	ProjectName      string
+	Service          string
+	Port             int
+	Subdomain        string
+	Protocol         string // "tcp" or "udp" for stream services, otherwise HTTP
+	HostPort         int    // Port the proxy listens on for a stream service
+	Host             string // Container serving it, if not the fork's, such as an add-on's
+	InterceptAddress string // Daemon proxy requests go through while the service is tapped or has chaos
+	Routes           []Route
+	// Aliases are names the service is also served under in place of
+	// "<project>-<fork>", such as the project's stable name
+	Aliases []string
+}
+
+// Route overrides a path of a service, answering it with a fixture file or
+// proxying it to another upstream
+type Route struct {
+	Location    string // Location match, "= /path" or "/prefix"
+	Fixture     string // File served, relative to the config directory
+	ContentType string
+	Upstream    string // Upstream the path is proxied to instead
+}
+
+// FixturesDir holds route fixture files, relative to the config directory
+const FixturesDir = "fixtures"
+
+// FixtureFile returns where a fixture with the given content is kept,
+// relative to the config directory
+func FixtureFile(content []byte) string {
+	sum := sha256.Sum256(content)
+	return path.Join(FixturesDir, hex.EncodeToString(sum[:8]))
 }
 
+// Ports the proxy publishes on localhost for TCP and UDP services, one per
+// service
+const (
+	StreamPortFirst = 15000
+	StreamPortLast  = 15031
+)
+
+// FallbackHTTPPorts are the host ports the proxy serves session URLs on, in
+// order of preference, when it can't bind port 80
+var FallbackHTTPPorts = []int{8480, 8481, 8482, 8483, 8484}
+
+// IsStream reports whether the service is proxied as a TCP or UDP stream
+func (s ForkService) IsStream() bool {
+	return s.Protocol == "tcp" || s.Protocol == "udp"
+}
+
+// ActivityLogFile is the access log, relative to the nginx config directory,
+// with one "<unix time> <host> <fork>/<service> <method> <status> <seconds>
+// <uri>" line per proxied request
+const ActivityLogFile = "activity.log"
+
+// UnmatchedHeader is set on the default server's 404, which answers for
+// hosts no fork is routed at, such as a session's before the daemon has
+// registered it
+const UnmatchedHeader = "X-Worklet-Unmatched"
+
+// UnavailablePageFile is the page, relative to the nginx config directory,
+// served while a session's server isn't accepting connections
+const UnavailablePageFile = "unavailable.html"
+
+// UnavailablePage is shown instead of a 502 while a session is starting or
+// its server is down. nginx fills in the host with SSI, and the page reloads
+// itself until the session answers.
+const UnavailablePage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta http-equiv="refresh" content="3">
+  <title>Session starting - worklet</title>
+  <style>
+    body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #0f172a; color: #e2e8f0; display: flex; align-items: center; justify-content: center; height: 100vh; margin: 0; }
+    main { text-align: center; max-width: 32rem; padding: 2rem; }
+    h1 { font-size: 1.5rem; margin-bottom: 0.5rem; }
+    p { color: #94a3b8; line-height: 1.5; }
+    code { color: #e2e8f0; }
+    .spinner { width: 2rem; height: 2rem; margin: 0 auto 1.5rem; border: 3px solid #334155; border-top-color: #38bdf8; border-radius: 50%; animation: spin 1s linear infinite; }
+    @keyframes spin { to { transform: rotate(360deg); } }
+  </style>
+</head>
+<body>
+  <main>
+    <div class="spinner"></div>
+    <h1>Session starting</h1>
+    <p><code><!--# echo var="host" --></code> isn't answering yet. The session may still be starting up, or its server may have stopped.</p>
+    <p>This page reloads automatically. Check the session with <code>worklet forks</code> if it doesn't come up.</p>
+  </main>
+</body>
+</html>
+`
+
+// Directories, relative to the config directory, holding one include file
+// per fork: its HTTP servers in HTTPIncludeDir and its TCP and UDP servers in
+// StreamIncludeDir
+const (
+	HTTPIncludeDir   = "conf.d"
+	StreamIncludeDir = "stream.d"
+)
+
 // Config holds the nginx configuration data
 type Config struct {
-	Services      []ForkService
-	WorkletDomain string
+	Services         []ForkService
+	WorkletDomain    string
+	ActivityLog      string
+	UnavailablePage  string
+	UnmatchedHeader  string
+	HTTPIncludeDir   string
+	StreamIncludeDir string
+	IPv6             bool
+	InterceptSecret  string
+}
+
+// Options are settings of the proxy the config is generated for
+type Options struct {
+	// IPv6 has nginx listen on IPv6 as well and resolve sessions' IPv6
+	// addresses. The proxy container must have IPv6.
+	IPv6 bool
+	// InterceptSecret authenticates nginx and the daemon's interceptor to
+	// each other, for services with an InterceptAddress
+	InterceptSecret string
+}
+
+// HTTPServices returns the services proxied by host name
+func (c Config) HTTPServices() []ForkService {
+	var services []ForkService
+	for _, svc := range c.Services {
+		if !svc.IsStream() {
+			services = append(services, svc)
+		}
+	}
+	return services
+}
+
+// StreamServices returns the TCP and UDP services that have a port assigned
+func (c Config) StreamServices() []ForkService {
+	var services []ForkService
+	for _, svc := range c.Services {
+		if svc.IsStream() && svc.HostPort > 0 {
+			services = append(services, svc)
+		}
+	}
+	return services
+}
+
+// ServerNames returns the host names the service is served at under domain
+func (s ForkService) ServerNames(domain string) string {
+	names := []string{s.ProjectName + "-" + s.ForkID}
+	names = append(names, s.Aliases...)
+	for i, name := range names {
+		if s.Subdomain != "" {
+			name = s.Subdomain + "." + name
+		}
+		names[i] = name + "." + domain
+	}
+	return strings.Join(names, " ")
 }
 
-// nginxTemplate is the base nginx configuration template
-const nginxTemplate = `
+// Server returns the container nginx proxies the service to
+func (s ForkService) Server() string {
+	if s.Host != "" {
+		return s.Host
+	}
+	return s.ProjectName + "-" + s.ForkID
+}
+
+// Upstream returns the name of the service's nginx upstream
+func (s ForkService) Upstream() string {
+	return fmt.Sprintf("%s-%s-%s", s.ProjectName, s.ForkID, s.Service)
+}
+
+// mainTemplate is the base nginx configuration, which includes every fork's
+// configuration
+const mainTemplate = `
 events {
     worker_connections 1024;
 }
 
 http {
     # Docker DNS resolver - use Docker's embedded DNS server
-    resolver 127.0.0.11 valid=1s ipv6=off;
+    resolver 127.0.0.11 valid=1s ipv6={{if .IPv6}}on{{else}}off{{end}};
     resolver_timeout 5s;
 
     # Basic settings
@@ -45,6 +210,18 @@ http {
     access_log /var/log/nginx/access.log;
     error_log /var/log/nginx/error.log;
 
+    # Requests per host, read by the daemon to track session activity and by
+    # 'worklet requests'. Requests the daemon intercepts pass through twice
+    # and are only logged the first time.
+    map $http_x_worklet_intercepted $worklet_log_request {
+        default 1;
+        {{- if .InterceptSecret}}
+        "{{.InterceptSecret}}" 0;
+        {{- end}}
+    }
+    log_format worklet_activity '$msec $host $worklet_service $request_method $status $request_time $request_uri';
+    access_log /etc/nginx/{{.ActivityLog}} worklet_activity if=$worklet_log_request;
+
     # Gzip compression
     gzip on;
     gzip_vary on;
@@ -64,60 +241,252 @@ http {
         '' close;
     }
 
-    {{range .Services}}
-    # Service: {{.Service}} for fork {{.ForkID}}
-    server {
-        listen 80;
-        server_name {{if .Subdomain}}{{.Subdomain}}.{{.ProjectName}}-{{.ForkID}}{{else}}{{.ProjectName}}-{{.ForkID}}{{end}}.{{$.WorkletDomain}};
-
-        location / {
-            # Use variable to force runtime DNS resolution
-            set $upstream {{.ProjectName}}-{{.ForkID}}:{{.Port}};
-            proxy_pass http://$upstream;
-            proxy_http_version 1.1;
-            proxy_set_header Upgrade $http_upgrade;
-            proxy_set_header Connection $connection_upgrade;
-            proxy_read_timeout 86400;
-            
-            # Disable buffering for streaming responses
-            proxy_buffering off;
-            proxy_cache off;
-            
-            # Buffer settings for dynamic resolution
-            proxy_buffer_size 4k;
-            proxy_buffers 8 4k;
-            proxy_busy_buffers_size 8k;
-        }
-    }
-    {{end}}
+    # One include per fork, written by the daemon
+    include /etc/nginx/{{.HTTPIncludeDir}}/*.conf;
 
     # Default server to handle unmatched requests
     server {
         listen 80 default_server;
+        {{- if .IPv6}}
+        listen [::]:80 default_server;
+        {{- end}}
         server_name _;
+        set $worklet_service "-";
+        add_header {{.UnmatchedHeader}} 1 always;
         return 404;
     }
 }
+
+# TCP and UDP services, each on its own port
+stream {
+    resolver 127.0.0.11 valid=1s ipv6={{if .IPv6}}on{{else}}off{{end}};
+
+    # One include per fork with TCP or UDP services
+    include /etc/nginx/{{.StreamIncludeDir}}/*.conf;
+}
+`
+
+// forkHTTPTemplate is a fork's HTTP configuration, included in the main
+// config's http block
+const forkHTTPTemplate = `{{range .HTTPServices}}
+# Service: {{.Service}} for fork {{.ForkID}}
+upstream {{.Upstream}} {
+    # Resolved at runtime (nginx 1.27.3+), so sessions that aren't up yet
+    # don't fail the config. After repeated connection failures the server is skipped
+    # for a while instead of every request waiting on it.
+    zone {{.Upstream}} 64k;
+    server {{.Server}}:{{.Port}} resolve max_fails=3 fail_timeout=5s;
+}
+{{if .InterceptAddress}}
+upstream {{.Upstream}}-intercept {
+    server {{.InterceptAddress}};
+}
+{{end}}
+server {
+    listen 80;
+    {{- if $.IPv6}}
+    listen [::]:80;
+    {{- end}}
+    server_name {{.ServerNames $.WorkletDomain}};
+    set $worklet_service "{{.ForkID}}/{{.Service}}";
+
+    # Explain a session that isn't answering instead of a bare 502
+    error_page 502 504 =503 /__worklet/unavailable;
+
+    location = /__worklet/unavailable {
+        internal;
+        ssi on;
+        default_type text/html;
+        alias /etc/nginx/{{$.UnavailablePage}};
+        add_header Retry-After 3 always;
+        add_header Cache-Control "no-store" always;
+    }
+
+    {{- range .Routes}}
+
+    # Route override from 'worklet route add'
+    location {{.Location}} {
+        {{- if .Fixture}}
+        add_header X-Worklet-Route fixture always;
+        root /etc/nginx;
+        default_type {{.ContentType}};
+        try_files /{{.Fixture}} =404;
+        {{- else}}
+        add_header X-Worklet-Route {{.Upstream}} always;
+        proxy_pass http://{{.Upstream}};
+        proxy_connect_timeout 5s;
+        proxy_http_version 1.1;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection $connection_upgrade;
+        proxy_read_timeout 86400;
+        proxy_buffering off;
+        {{- end}}
+    }
+    {{- end}}
+
+    location / {
+        {{- if .InterceptAddress}}
+        # Tapped or with chaos: requests go through the daemon, which
+        # sends them back here marked as intercepted with the secret they
+        # authenticate with
+        set $worklet_upstream {{.Upstream}}-intercept;
+        set $worklet_intercept "{{.ForkID}}/{{.Service}}";
+        set $worklet_intercept_secret "{{$.InterceptSecret}}";
+        if ($http_x_worklet_intercepted = "{{$.InterceptSecret}}") {
+            set $worklet_upstream {{.Upstream}};
+            set $worklet_intercept "";
+            set $worklet_intercept_secret "";
+        }
+        proxy_pass http://$worklet_upstream;
+        proxy_set_header X-Worklet-Intercept $worklet_intercept;
+        proxy_set_header X-Worklet-Intercept-Secret $worklet_intercept_secret;
+        proxy_set_header X-Worklet-Intercepted "";
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        {{- else}}
+        proxy_pass http://{{.Upstream}};
+        {{- end}}
+        proxy_connect_timeout 5s;
+        proxy_http_version 1.1;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection $connection_upgrade;
+        proxy_read_timeout 86400;
+        
+        # Disable buffering for streaming responses
+        proxy_buffering off;
+        proxy_cache off;
+        
+        # Buffer settings for dynamic resolution
+        proxy_buffer_size 4k;
+        proxy_buffers 8 4k;
+        proxy_busy_buffers_size 8k;
+    }
+}
+{{end}}
+`
+
+// forkStreamTemplate is a fork's TCP and UDP configuration, included in the
+// main config's stream block
+const forkStreamTemplate = `{{range .StreamServices}}
+# {{.Protocol}} service: {{.Service}} for fork {{.ForkID}}
+upstream {{.Upstream}} {
+    zone {{.Upstream}} 64k;
+    server {{.Server}}:{{.Port}} resolve max_fails=3 fail_timeout=5s;
+}
+
+server {
+    listen {{.HostPort}}{{if eq .Protocol "udp"}} udp{{end}};
+    {{- if $.IPv6}}
+    listen [::]:{{.HostPort}}{{if eq .Protocol "udp"}} udp{{end}};
+    {{- end}}
+    proxy_pass {{.Upstream}};
+    proxy_connect_timeout 5s;
+}
+{{end}}
 `
 
-// GenerateConfig generates an nginx configuration from the provided services
-func GenerateConfig(services []ForkService) (string, error) {
-	tmpl, err := template.New("nginx").Parse(nginxTemplate)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse nginx template: %w", err)
+// Configs is the proxy's configuration: the main config and the include
+// files of each fork
+type Configs struct {
+	Main  string
+	Files map[string]string // Include files by path relative to the config directory
+}
+
+var (
+	mainTmpl   = template.Must(template.New("nginx").Parse(mainTemplate))
+	httpTmpl   = template.Must(template.New("fork-http").Parse(forkHTTPTemplate))
+	streamTmpl = template.Must(template.New("fork-stream").Parse(forkStreamTemplate))
+)
+
+// GenerateConfigs generates the main nginx config and an include file per
+// fork from the provided services, so changing one fork's routes only
+// rewrites its files
+func GenerateConfigs(services []ForkService, opts Options) (Configs, error) {
+	configs := Configs{Files: make(map[string]string)}
+
+	var main bytes.Buffer
+	if err := mainTmpl.Execute(&main, templateData(nil, opts)); err != nil {
+		return Configs{}, fmt.Errorf("failed to execute nginx template: %w", err)
 	}
+	configs.Main = main.String()
 
-	cfg := Config{
-		Services:      services,
-		WorkletDomain: config.WorkletDomain,
+	byFork := make(map[string][]ForkService)
+	for _, svc := range services {
+		byFork[svc.ForkID] = append(byFork[svc.ForkID], svc)
+	}
+	for forkID, forkServices := range byFork {
+		if !validForkID(forkID) {
+			return Configs{}, fmt.Errorf("invalid fork ID %q for an nginx include file", forkID)
+		}
+		cfg := templateData(forkServices, opts)
+		for _, include := range []struct {
+			tmpl  *template.Template
+			dir   string
+			empty bool
+		}{
+			{httpTmpl, HTTPIncludeDir, len(cfg.HTTPServices()) == 0},
+			{streamTmpl, StreamIncludeDir, len(cfg.StreamServices()) == 0},
+		} {
+			if include.empty {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := include.tmpl.Execute(&buf, cfg); err != nil {
+				return Configs{}, fmt.Errorf("failed to execute nginx template for fork %s: %w", forkID, err)
+			}
+			configs.Files[path.Join(include.dir, forkID+".conf")] = buf.String()
+		}
 	}
+	return configs, nil
+}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, cfg); err != nil {
-		return "", fmt.Errorf("failed to execute nginx template: %w", err)
+func templateData(services []ForkService, opts Options) Config {
+	return Config{
+		Services:         services,
+		WorkletDomain:    config.Domain(),
+		ActivityLog:      ActivityLogFile,
+		UnavailablePage:  UnavailablePageFile,
+		UnmatchedHeader:  UnmatchedHeader,
+		HTTPIncludeDir:   HTTPIncludeDir,
+		StreamIncludeDir: StreamIncludeDir,
+		IPv6:             opts.IPv6,
+		InterceptSecret:  opts.InterceptSecret,
 	}
+}
 
-	return buf.String(), nil
+// validForkID reports whether a fork ID can name an include file
+func validForkID(forkID string) bool {
+	return forkID != "" && !strings.ContainsAny(forkID, "/\\ ") && !strings.HasPrefix(forkID, ".")
+}
+
+// IncludeForkID returns the fork whose include file a path names, such as
+// "conf.d/abc123.conf" or "/etc/nginx/stream.d/abc123.conf", or "" if it
+// isn't an include file
+func IncludeForkID(file string) string {
+	dir, name := path.Split(strings.TrimPrefix(file, "/etc/nginx/"))
+	dir = strings.TrimSuffix(dir, "/")
+	if (dir != HTTPIncludeDir && dir != StreamIncludeDir) || !strings.HasSuffix(name, ".conf") {
+		return ""
+	}
+	return strings.TrimSuffix(name, ".conf")
+}
+
+// ServerNames returns the host names a generated config routes, in the
+// order they appear, leaving out the default server
+func ServerNames(config string) []string {
+	var names []string
+	for _, line := range strings.Split(config, "\n") {
+		fields := strings.Fields(strings.TrimSuffix(strings.TrimSpace(line), ";"))
+		if len(fields) < 2 || fields[0] != "server_name" {
+			continue
+		}
+		for _, name := range fields[1:] {
+			if name != "_" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
 }
 
 // AddService creates a ForkService entry
@@ -129,4 +498,4 @@ func AddService(forkID, projectName, serviceName string, port int, subdomain str
 		Port:        port,
 		Subdomain:   subdomain,
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,308 @@
+package nginx
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestGenerateConfigUpstreams(t *testing.T) {
+	conf, err := generateIncludes([]ForkService{
+		AddService("abc123", "myapp", "web", 3000, "app"),
+		AddService("abc123", "myapp", "api", 3001, "api"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"upstream myapp-abc123-web {",
+		"server myapp-abc123:3000 resolve max_fails=3 fail_timeout=5s;",
+		"proxy_pass http://myapp-abc123-api;",
+		"server_name app.myapp-abc123.",
+		"error_page 502 504 =503 /__worklet/unavailable;",
+		"alias /etc/nginx/" + UnavailablePageFile + ";",
+	}
+	for _, want := range expected {
+		if !strings.Contains(conf, want) {
+			t.Errorf("expected %q in config:\n%s", want, conf)
+		}
+	}
+}
+
+func TestGenerateConfigAliases(t *testing.T) {
+	web := AddService("abc123", "myapp", "web", 3000, "app")
+	web.Aliases = []string{"myapp"}
+	conf, err := generateIncludes([]ForkService{web})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "server_name app.myapp-abc123." + config.Domain() + " app.myapp." + config.Domain() + ";"; !strings.Contains(conf, want) {
+		t.Errorf("expected %q in config:\n%s", want, conf)
+	}
+}
+
+func TestGenerateConfigHost(t *testing.T) {
+	console := AddService("abc123", "myapp", "minio", 9001, "minio")
+	console.Host = "myapp-abc123-minio"
+	conf, err := generateIncludes([]ForkService{console})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "server myapp-abc123-minio:9001 resolve"; !strings.Contains(conf, want) {
+		t.Errorf("expected %q in config:\n%s", want, conf)
+	}
+}
+
+func TestGenerateConfigStreams(t *testing.T) {
+	db := AddService("abc123", "myapp", "db", 5432, "")
+	db.Protocol, db.HostPort = "tcp", StreamPortFirst
+	dns := AddService("abc123", "myapp", "dns", 53, "")
+	dns.Protocol, dns.HostPort = "udp", StreamPortFirst+1
+	unassigned := AddService("abc123", "myapp", "cache", 6379, "")
+	unassigned.Protocol = "tcp"
+
+	conf, err := generateIncludes([]ForkService{db, dns, unassigned})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"server myapp-abc123:5432 resolve",
+		"listen 15000;",
+		"listen 15001 udp;",
+		"proxy_pass myapp-abc123-db;",
+	}
+	for _, want := range expected {
+		if !strings.Contains(conf, want) {
+			t.Errorf("expected %q in config:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(conf, "server_name ") || strings.Contains(conf, "myapp-abc123-cache") {
+		t.Errorf("expected stream services to be left out of HTTP and unassigned ones skipped:\n%s", conf)
+	}
+
+	// Without stream services the fork has no stream include
+	configs, err := GenerateConfigs([]ForkService{AddService("abc123", "myapp", "web", 3000, "app")}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := configs.Files["stream.d/abc123.conf"]; ok || len(configs.Files) != 1 {
+		t.Errorf("unexpected include files %v", configs.Files)
+	}
+}
+
+func TestGenerateConfigIntercept(t *testing.T) {
+	web := AddService("abc123", "myapp", "web", 3000, "app")
+	web.InterceptAddress = "host.docker.internal:41000"
+	api := AddService("abc123", "myapp", "api", 3001, "api")
+
+	configs, err := GenerateConfigs([]ForkService{web, api}, Options{InterceptSecret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := configs.Files["conf.d/abc123.conf"]
+
+	expected := []string{
+		"upstream myapp-abc123-web-intercept {",
+		"server host.docker.internal:41000;",
+		`if ($http_x_worklet_intercepted = "s3cret") {`,
+		`set $worklet_intercept_secret "s3cret";`,
+		"proxy_set_header X-Worklet-Intercept-Secret $worklet_intercept_secret;",
+		"set $worklet_upstream myapp-abc123-web-intercept;",
+		`set $worklet_intercept "abc123/web";`,
+		"proxy_pass http://$worklet_upstream;",
+		"proxy_pass http://myapp-abc123-api;",
+	}
+	for _, want := range expected {
+		if !strings.Contains(conf, want) {
+			t.Errorf("expected %q in config:\n%s", want, conf)
+		}
+	}
+	if strings.Contains(conf, "myapp-abc123-api-intercept") {
+		t.Errorf("service that isn't intercepted should go straight to its upstream:\n%s", conf)
+	}
+	// Only requests the interceptor sent back are left out of the log
+	if !strings.Contains(configs.Main, `"s3cret" 0;`) {
+		t.Errorf("expected the secret in the log map:\n%s", configs.Main)
+	}
+}
+
+func TestGenerateConfigRoutes(t *testing.T) {
+	web := AddService("abc123", "myapp", "web", 3000, "app")
+	web.Routes = []Route{
+		{Location: "= /api/flags", Fixture: FixtureFile([]byte(`{"beta":true}`)), ContentType: "application/json"},
+		{Location: "/api/", Upstream: "myapp-def456-api"},
+	}
+
+	conf, err := generateIncludes([]ForkService{web})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"location = /api/flags {",
+		"default_type application/json;",
+		"try_files /" + FixturesDir + "/",
+		"location /api/ {",
+		"proxy_pass http://myapp-def456-api;",
+		"proxy_pass http://myapp-abc123-web;",
+	}
+	for _, want := range expected {
+		if !strings.Contains(conf, want) {
+			t.Errorf("expected %q in config:\n%s", want, conf)
+		}
+	}
+}
+
+func TestGenerateConfigsIncludes(t *testing.T) {
+	configs, err := GenerateConfigs([]ForkService{
+		AddService("abc123", "myapp", "web", 3000, "app"),
+		AddService("def456", "shop", "web", 8080, ""),
+	}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"include /etc/nginx/conf.d/*.conf;", "include /etc/nginx/stream.d/*.conf;", "default_server", "add_header X-Worklet-Unmatched 1 always;"} {
+		if !strings.Contains(configs.Main, want) {
+			t.Errorf("expected %q in main config:\n%s", want, configs.Main)
+		}
+	}
+	if strings.Contains(configs.Main, "abc123") {
+		t.Errorf("main config should only include forks' configs:\n%s", configs.Main)
+	}
+	if len(configs.Files) != 2 || !strings.Contains(configs.Files["conf.d/abc123.conf"], "upstream myapp-abc123-web") ||
+		strings.Contains(configs.Files["conf.d/abc123.conf"], "def456") {
+		t.Errorf("expected one include per fork, got %v", configs.Files)
+	}
+
+	if _, err := GenerateConfigs([]ForkService{AddService("../etc", "myapp", "web", 3000, "")}, Options{}); err == nil {
+		t.Error("expected a fork ID that isn't a file name to be rejected")
+	}
+}
+
+func TestGenerateConfigsIPv6(t *testing.T) {
+	db := AddService("abc123", "myapp", "db", 5432, "")
+	db.Protocol, db.HostPort = "tcp", StreamPortFirst
+	services := []ForkService{AddService("abc123", "myapp", "web", 3000, "app"), db}
+
+	configs, err := GenerateConfigs(services, Options{IPv6: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"nginx.conf":           "listen [::]:80 default_server;",
+		"conf.d/abc123.conf":   "listen [::]:80;",
+		"stream.d/abc123.conf": "listen [::]:15000;",
+	}
+	for file, want := range expected {
+		conf := configs.Files[file]
+		if file == "nginx.conf" {
+			conf = configs.Main
+		}
+		if !strings.Contains(conf, want) {
+			t.Errorf("expected %q in %s:\n%s", want, file, conf)
+		}
+	}
+	if strings.Contains(configs.Main, "ipv6=off") {
+		t.Errorf("expected the resolver to look up IPv6 addresses:\n%s", configs.Main)
+	}
+
+	configs, err = GenerateConfigs(services, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, conf := range append([]string{configs.Main}, configs.Files["conf.d/abc123.conf"], configs.Files["stream.d/abc123.conf"]) {
+		if strings.Contains(conf, "[::]") {
+			t.Errorf("unexpected IPv6 listener without IPv6:\n%s", conf)
+		}
+	}
+}
+
+func TestIncludeForkID(t *testing.T) {
+	tests := map[string]string{
+		"conf.d/abc123.conf":               "abc123",
+		"/etc/nginx/stream.d/myapp-2.conf": "myapp-2",
+		"nginx.conf":                       "",
+		"conf.d/abc123.conf.disabled":      "",
+		"/etc/nginx/other/abc123.conf":     "",
+	}
+	for file, want := range tests {
+		if got := IncludeForkID(file); got != want {
+			t.Errorf("IncludeForkID(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+// generateIncludes returns the include files generated for services, in
+// order of their paths
+func generateIncludes(services []ForkService) (string, error) {
+	configs, err := GenerateConfigs(services, Options{})
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for name := range configs.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var conf strings.Builder
+	for _, name := range names {
+		conf.WriteString(configs.Files[name])
+	}
+	return conf.String(), nil
+}
+
+func TestParseAccessLine(t *testing.T) {
+	entry, ok := ParseAccessLine("1760000000.250 app.myapp-3.local.worklet.sh 3/web POST 201 0.042 /api/items?page=2\n")
+	if !ok {
+		t.Fatal("expected the line to parse")
+	}
+	if entry.ForkID != "3" || entry.Service != "web" || entry.Method != "POST" || entry.Status != 201 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry.Duration != 42*time.Millisecond {
+		t.Errorf("duration = %v, want 42ms", entry.Duration)
+	}
+	if entry.URI != "/api/items?page=2" {
+		t.Errorf("uri = %q", entry.URI)
+	}
+	if entry.Time.UnixMilli() != 1760000000250 {
+		t.Errorf("time = %v", entry.Time)
+	}
+
+	// Lines from older versions only have the time and host
+	entry, ok = ParseAccessLine("1760000000.250 app.myapp-3.local.worklet.sh")
+	if !ok || entry.Host != "app.myapp-3.local.worklet.sh" || entry.Method != "" {
+		t.Errorf("unexpected entry for an old line %+v, %v", entry, ok)
+	}
+
+	// Requests that matched no session
+	entry, ok = ParseAccessLine("1760000000.250 unknown.example - GET 404 0.000 /")
+	if !ok || entry.ForkID != "" || entry.Status != 404 {
+		t.Errorf("unexpected entry for an unmatched request %+v, %v", entry, ok)
+	}
+
+	if _, ok := ParseAccessLine("garbage"); ok {
+		t.Error("expected garbage not to parse")
+	}
+}
+
+func TestServerNames(t *testing.T) {
+	conf, err := generateIncludes([]ForkService{
+		AddService("abc123", "myapp", "web", 3000, "app"),
+		AddService("def456", "myapp", "api", 3001, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := ServerNames(conf)
+	if len(names) != 2 || !strings.HasPrefix(names[0], "app.myapp-abc123.") || !strings.HasPrefix(names[1], "myapp-def456.") {
+		t.Errorf("ServerNames = %v", names)
+	}
+}
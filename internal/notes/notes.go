@@ -0,0 +1,98 @@
+// Package notes stores free-form notes attached to sessions, so it's easy to
+// remember why each one exists.
+package notes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// Note is the text attached to a session
+type Note struct {
+	Text      string    `json:"text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store keeps notes keyed by session ID in a single JSON file
+type Store struct {
+	path string
+}
+
+// New returns the store at ~/.worklet/notes.json
+func New() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return NewAt(filepath.Join(homeDir, ".worklet", "notes.json")), nil
+}
+
+// NewAt returns a store backed by the file at path
+func NewAt(path string) *Store {
+	return &Store{path: path}
+}
+
+// All returns every note keyed by session ID
+func (s *Store) All() (map[string]Note, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]Note{}, nil
+		}
+		return nil, fmt.Errorf("failed to read notes: %w", err)
+	}
+
+	notes := make(map[string]Note)
+	if err := json.Unmarshal(data, &notes); err != nil {
+		return nil, fmt.Errorf("failed to parse notes: %w", err)
+	}
+	return notes, nil
+}
+
+// Get returns the note for a session, or "" if it has none
+func (s *Store) Get(sessionID string) (string, error) {
+	notes, err := s.All()
+	if err != nil {
+		return "", err
+	}
+	return notes[sessionID].Text, nil
+}
+
+// Set attaches text to a session, replacing any existing note. Empty text
+// removes the note.
+func (s *Store) Set(sessionID, text string) error {
+	return s.update(func(notes map[string]Note) {
+		if text == "" {
+			delete(notes, sessionID)
+		} else {
+			notes[sessionID] = Note{Text: text, UpdatedAt: time.Now()}
+		}
+	})
+}
+
+// Remove deletes the note for a session
+func (s *Store) Remove(sessionID string) error {
+	return s.Set(sessionID, "")
+}
+
+// update applies fn to the notes while holding the store's lock
+func (s *Store) update(fn func(map[string]Note)) error {
+	return storage.WithLock(s.path, func() error {
+		notes, err := s.All()
+		if err != nil {
+			return err
+		}
+		fn(notes)
+
+		data, err := json.MarshalIndent(notes, "", "  ")
+		if err != nil {
+			return err
+		}
+		return storage.WriteFileAtomic(s.path, data, 0644)
+	})
+}
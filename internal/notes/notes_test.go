@@ -0,0 +1,46 @@
+package notes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetGetRemove(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-notes-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewAt(filepath.Join(dir, "notes.json"))
+
+	if text, err := store.Get("1"); err != nil || text != "" {
+		t.Fatalf("Expected no note in an empty store, got %q, %v", text, err)
+	}
+
+	if err := store.Set("1", "trying pg16 upgrade"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("2", "flaky test repro"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set("1", "pg16 upgrade works"); err != nil {
+		t.Fatal(err)
+	}
+
+	if text, _ := store.Get("1"); text != "pg16 upgrade works" {
+		t.Errorf("Expected updated note, got %q", text)
+	}
+
+	if err := store.Remove("2"); err != nil {
+		t.Fatal(err)
+	}
+	all, err := store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all["1"].UpdatedAt.IsZero() {
+		t.Errorf("Expected a single timestamped note, got %v", all)
+	}
+}
@@ -6,18 +6,89 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
 )
 
 // Project represents a worklet project
 type Project struct {
-	Path         string    `json:"path"`
-	Name         string    `json:"name"`
-	LastAccessed time.Time `json:"last_accessed"`
-	RunCount     int       `json:"run_count"`
-	ForkID       string    `json:"fork_id,omitempty"`
-	IsRunning    bool      `json:"is_running,omitempty"`
+	Path         string      `json:"path"`
+	Name         string      `json:"name"`
+	LastAccessed time.Time   `json:"last_accessed"`
+	RunCount     int         `json:"run_count"`
+	ForkID       string      `json:"fork_id,omitempty"`
+	IsRunning    bool        `json:"is_running,omitempty"`
+	Runs         []RunRecord `json:"runs,omitempty"` // Most recent first
+	Favorite     bool        `json:"favorite,omitempty"`
+	Group        string      `json:"group,omitempty"` // e.g. "work", "oss"; empty if ungrouped
+	// Timings of runs started with --time-report, most recent first
+	Timings []StartupTiming `json:"timings,omitempty"`
+}
+
+// DisplayName returns the project's name, or its directory name if unnamed
+func (p Project) DisplayName() string {
+	if p.Name == "" {
+		return filepath.Base(p.Path)
+	}
+	return p.Name
+}
+
+// MaxRunHistory is how many runs are kept per project
+const MaxRunHistory = 10
+
+// RunRecord is a `worklet run` invocation, kept so it can be repeated
+type RunRecord struct {
+	Dir   string    `json:"dir"`             // Directory worklet run was invoked in
+	Flags []string  `json:"flags,omitempty"` // Flags given, as --name=value
+	Args  []string  `json:"args,omitempty"`  // Positional arguments: a git URL and/or the command
+	Time  time.Time `json:"time"`
+}
+
+// MaxTimingHistory is how many startup timings are kept per project
+const MaxTimingHistory = 20
+
+// StartupTiming is where the time of a session's startup went
+type StartupTiming struct {
+	Time   time.Time     `json:"time"`
+	Mode   string        `json:"mode"` // "copy" or "mount"; runs are only compared within a mode
+	Total  time.Duration `json:"total"`
+	Phases []PhaseTiming `json:"phases"`
+}
+
+// PhaseTiming is how long one phase of a startup took
+type PhaseTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Phase returns how long the named phase took, and whether it ran
+func (t StartupTiming) Phase(name string) (time.Duration, bool) {
+	for _, phase := range t.Phases {
+		if phase.Name == name {
+			return phase.Duration, true
+		}
+	}
+	return 0, false
+}
+
+// Command returns the worklet arguments that repeat the run
+func (r RunRecord) Command() []string {
+	args := append([]string{"run"}, r.Flags...)
+	if len(r.Args) > 0 {
+		args = append(args, "--")
+		args = append(args, r.Args...)
+	}
+	return args
+}
+
+// sameInvocation reports whether two records ran the same command
+func (r RunRecord) sameInvocation(other RunRecord) bool {
+	return r.Dir == other.Dir &&
+		strings.Join(r.Flags, "\x00") == strings.Join(other.Flags, "\x00") &&
+		strings.Join(r.Args, "\x00") == strings.Join(other.Args, "\x00")
 }
 
 // Manager manages the project history
@@ -35,7 +106,7 @@ func NewManager() (*Manager, error) {
 	}
 
 	storePath := filepath.Join(homeDir, ".worklet", "projects.json")
-	
+
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(storePath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
@@ -56,15 +127,19 @@ func NewManager() (*Manager, error) {
 
 // AddOrUpdate adds a new project or updates an existing one
 func (m *Manager) AddOrUpdate(path, name string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	// Clean the path
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
+	return m.update(func() error {
+		return m.addOrUpdate(absPath, name)
+	})
+}
+
+func (m *Manager) addOrUpdate(absPath, name string) error {
+
 	// Check if project already exists
 	found := false
 	for i, p := range m.projects {
@@ -89,7 +164,7 @@ func (m *Manager) AddOrUpdate(path, name string) error {
 		})
 	}
 
-	return m.save()
+	return nil
 }
 
 // List returns all projects sorted by last accessed time
@@ -111,49 +186,232 @@ func (m *Manager) List() []Project {
 
 // Remove removes a project from the history
 func (m *Manager) Remove(path string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Find and remove the project
-	newProjects := []Project{}
-	for _, p := range m.projects {
-		if p.Path != absPath {
-			newProjects = append(newProjects, p)
+	return m.update(func() error {
+		// Find and remove the project
+		newProjects := []Project{}
+		for _, p := range m.projects {
+			if p.Path != absPath {
+				newProjects = append(newProjects, p)
+			}
 		}
-	}
 
-	m.projects = newProjects
-	return m.save()
+		m.projects = newProjects
+		return nil
+	})
 }
 
 // Clear removes all projects from history
 func (m *Manager) Clear() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	m.projects = []Project{}
-	return m.save()
+	return m.update(func() error {
+		m.projects = []Project{}
+		return nil
+	})
 }
 
 // CleanStale removes projects with non-existent directories
 func (m *Manager) CleanStale() error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.update(func() error {
+		newProjects := []Project{}
+		for _, p := range m.projects {
+			if _, err := os.Stat(p.Path); err == nil {
+				newProjects = append(newProjects, p)
+			}
+		}
+
+		m.projects = newProjects
+		return nil
+	})
+}
+
+// RecordRun adds a run to the front of a project's history. An earlier
+// identical run is moved to the front rather than repeated.
+func (m *Manager) RecordRun(path string, run RunRecord) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if run.Time.IsZero() {
+		run.Time = time.Now()
+	}
+
+	return m.update(func() error {
+		for i, p := range m.projects {
+			if p.Path != absPath {
+				continue
+			}
+			runs := []RunRecord{run}
+			for _, earlier := range p.Runs {
+				if !earlier.sameInvocation(run) && len(runs) < MaxRunHistory {
+					runs = append(runs, earlier)
+				}
+			}
+			m.projects[i].Runs = runs
+			return nil
+		}
+
+		return fmt.Errorf("project not found")
+	})
+}
 
-	newProjects := []Project{}
+// RecordTiming adds a startup timing to the front of a project's history
+func (m *Manager) RecordTiming(path string, timing StartupTiming) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if timing.Time.IsZero() {
+		timing.Time = time.Now()
+	}
+
+	return m.update(func() error {
+		for i, p := range m.projects {
+			if p.Path != absPath {
+				continue
+			}
+			timings := append([]StartupTiming{timing}, p.Timings...)
+			if len(timings) > MaxTimingHistory {
+				timings = timings[:MaxTimingHistory]
+			}
+			m.projects[i].Timings = timings
+			return nil
+		}
+
+		return fmt.Errorf("project not found")
+	})
+}
+
+// Find returns the project with the given name or path. When several
+// projects share a name, the most recently accessed one is returned.
+func (m *Manager) Find(query string) (*Project, error) {
+	if absPath, err := filepath.Abs(query); err == nil {
+		if project, err := m.GetProject(absPath); err == nil {
+			return project, nil
+		}
+	}
+
+	for _, p := range m.List() {
+		if strings.EqualFold(p.DisplayName(), query) {
+			return &p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("project %q not found", query)
+}
+
+// SetFavorite pins or unpins a project
+func (m *Manager) SetFavorite(path string, favorite bool) error {
+	return m.set(path, func(p *Project) { p.Favorite = favorite })
+}
+
+// SetGroup moves a project into a group, or out of any group if group is
+// empty
+func (m *Manager) SetGroup(path, group string) error {
+	group = strings.TrimSpace(group)
+	return m.set(path, func(p *Project) { p.Group = group })
+}
+
+// set applies fn to the project at path and saves it
+func (m *Manager) set(path string, fn func(*Project)) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	return m.update(func() error {
+		for i, p := range m.projects {
+			if p.Path == absPath {
+				fn(&m.projects[i])
+				return nil
+			}
+		}
+
+		return fmt.Errorf("project not found")
+	})
+}
+
+// Groups returns the names of the groups in use, sorted
+func (m *Manager) Groups() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var groups []string
 	for _, p := range m.projects {
-		if _, err := os.Stat(p.Path); err == nil {
-			newProjects = append(newProjects, p)
+		if p.Group != "" && !seen[p.Group] {
+			seen[p.Group] = true
+			groups = append(groups, p.Group)
 		}
 	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i]) < strings.ToLower(groups[j])
+	})
+	return groups
+}
 
-	m.projects = newProjects
-	return m.save()
+// Section is a heading of a project list and the projects under it
+type Section struct {
+	Name      string // Group name; empty for favorites and for ungrouped projects
+	Favorites bool
+	Projects  []Project
+}
+
+// Title returns the section's heading
+func (s Section) Title() string {
+	switch {
+	case s.Favorites:
+		return "Favorites"
+	case s.Name == "":
+		return "Other"
+	default:
+		return s.Name
+	}
+}
+
+// Sections splits projects into favorites, then each group by name, then
+// the ungrouped ones. A favorite is listed only under favorites. Projects
+// keep their order within a section, and empty sections are left out.
+func Sections(projects []Project) []Section {
+	favorites := Section{Favorites: true}
+	ungrouped := Section{}
+	groups := map[string]*Section{}
+	var names []string
+
+	for _, p := range projects {
+		switch {
+		case p.Favorite:
+			favorites.Projects = append(favorites.Projects, p)
+		case p.Group == "":
+			ungrouped.Projects = append(ungrouped.Projects, p)
+		default:
+			section, ok := groups[p.Group]
+			if !ok {
+				section = &Section{Name: p.Group}
+				groups[p.Group] = section
+				names = append(names, p.Group)
+			}
+			section.Projects = append(section.Projects, p)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	var sections []Section
+	if len(favorites.Projects) > 0 {
+		sections = append(sections, favorites)
+	}
+	for _, name := range names {
+		sections = append(sections, *groups[name])
+	}
+	if len(ungrouped.Projects) > 0 {
+		sections = append(sections, ungrouped)
+	}
+	return sections
 }
 
 // GetProject returns a project by path
@@ -178,23 +436,42 @@ func (m *Manager) GetProject(path string) (*Project, error) {
 
 // UpdateForkStatus updates the fork status for a project
 func (m *Manager) UpdateForkStatus(path, forkID string, isRunning bool) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	absPath, err := filepath.Abs(path)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	for i, p := range m.projects {
-		if p.Path == absPath {
-			m.projects[i].ForkID = forkID
-			m.projects[i].IsRunning = isRunning
-			return m.save()
+	return m.update(func() error {
+		for i, p := range m.projects {
+			if p.Path == absPath {
+				m.projects[i].ForkID = forkID
+				m.projects[i].IsRunning = isRunning
+				return nil
+			}
 		}
-	}
 
-	return fmt.Errorf("project not found")
+		return fmt.Errorf("project not found")
+	})
+}
+
+// update reloads the projects from disk under the file lock, applies fn and
+// saves the result, so concurrent worklet processes don't lose each other's
+// changes
+func (m *Manager) update(fn func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return storage.WithLock(m.storePath, func() error {
+		if err := m.load(); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to load projects: %w", err)
+		}
+
+		if err := fn(); err != nil {
+			return err
+		}
+
+		return m.save()
+	})
 }
 
 // save persists the projects to disk
@@ -204,7 +481,7 @@ func (m *Manager) save() error {
 		return fmt.Errorf("failed to marshal projects: %w", err)
 	}
 
-	return os.WriteFile(m.storePath, data, 0644)
+	return storage.WriteFileAtomic(m.storePath, data, 0644)
 }
 
 // load reads the projects from disk
@@ -214,5 +491,11 @@ func (m *Manager) load() error {
 		return err
 	}
 
-	return json.Unmarshal(data, &m.projects)
-}
\ No newline at end of file
+	// Decode into a fresh slice so reloads don't inherit stale fields
+	var projects []Project
+	if err := json.Unmarshal(data, &projects); err != nil {
+		return err
+	}
+	m.projects = projects
+	return nil
+}
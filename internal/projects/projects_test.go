@@ -0,0 +1,179 @@
+package projects
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordRun(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-projects-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectDir := filepath.Join(home, "shop")
+	if err := manager.AddOrUpdate(projectDir, "shop"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.RecordRun(filepath.Join(home, "missing"), RunRecord{Dir: home}); err == nil {
+		t.Error("RecordRun for an unknown project succeeded")
+	}
+
+	for i := 0; i < MaxRunHistory+2; i++ {
+		run := RunRecord{Dir: projectDir, Flags: []string{"--temp=true"}, Args: []string{"npm", "test", fmt.Sprint(i)}}
+		if err := manager.RecordRun(projectDir, run); err != nil {
+			t.Fatalf("RecordRun failed: %v", err)
+		}
+	}
+	// Repeating an earlier run moves it to the front
+	repeated := RunRecord{Dir: projectDir, Flags: []string{"--temp=true"}, Args: []string{"npm", "test", "5"}}
+	if err := manager.RecordRun(projectDir, repeated); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload from disk
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := manager.Find("SHOP")
+	if err != nil {
+		t.Fatalf("Find failed: %v", err)
+	}
+	if len(project.Runs) != MaxRunHistory {
+		t.Fatalf("got %d runs, want %d", len(project.Runs), MaxRunHistory)
+	}
+	if got := strings.Join(project.Runs[0].Command(), " "); got != "run --temp=true -- npm test 5" {
+		t.Errorf("last run = %q", got)
+	}
+	if got := project.Runs[1].Args[2]; got != "11" {
+		t.Errorf("second run is %s, want 11", got)
+	}
+	for _, run := range project.Runs[1:] {
+		if run.Args[2] == "5" {
+			t.Error("repeated run is listed twice")
+		}
+	}
+
+	if _, err := manager.Find(projectDir); err != nil {
+		t.Errorf("Find by path failed: %v", err)
+	}
+	if _, err := manager.Find("other"); err == nil {
+		t.Error("Find of an unknown project succeeded")
+	}
+}
+
+func TestFavoritesAndGroups(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-projects-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"api", "blog", "shop", "sandbox"} {
+		if err := manager.AddOrUpdate(filepath.Join(home, name), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manager.SetGroup(filepath.Join(home, "api"), " work "); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.SetGroup(filepath.Join(home, "shop"), "work"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.SetGroup(filepath.Join(home, "blog"), "OSS"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.SetFavorite(filepath.Join(home, "shop"), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.SetFavorite(filepath.Join(home, "missing"), true); err == nil {
+		t.Error("SetFavorite for an unknown project succeeded")
+	}
+
+	// Reload from disk
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(manager.Groups(), ","); got != "OSS,work" {
+		t.Errorf("Groups() = %s, want OSS,work", got)
+	}
+
+	var got []string
+	for _, section := range Sections(manager.List()) {
+		var names []string
+		for _, p := range section.Projects {
+			names = append(names, p.DisplayName())
+		}
+		got = append(got, section.Title()+":"+strings.Join(names, ","))
+	}
+	want := "Favorites:shop OSS:blog work:api Other:sandbox"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Sections() = %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestRecordTiming(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-projects-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	manager, err := NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectDir := filepath.Join(home, "shop")
+	if err := manager.AddOrUpdate(projectDir, "shop"); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < MaxTimingHistory+3; i++ {
+		timing := StartupTiming{
+			Mode:   "copy",
+			Total:  time.Duration(i) * time.Second,
+			Phases: []PhaseTiming{{Name: "image build", Duration: time.Duration(i) * time.Second}},
+		}
+		if err := manager.RecordTiming(projectDir, timing); err != nil {
+			t.Fatalf("RecordTiming failed: %v", err)
+		}
+	}
+
+	manager, err = NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := manager.Find("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Timings) != MaxTimingHistory {
+		t.Fatalf("got %d timings, want %d", len(project.Timings), MaxTimingHistory)
+	}
+	latest := project.Timings[0]
+	if build, ok := latest.Phase("image build"); !ok || build != time.Duration(MaxTimingHistory+2)*time.Second {
+		t.Errorf("latest image build = %v, %v", build, ok)
+	}
+	if _, ok := latest.Phase("clone"); ok {
+		t.Error("a phase that didn't run was found")
+	}
+}
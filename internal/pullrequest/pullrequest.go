@@ -0,0 +1,199 @@
+// Package pullrequest opens pull requests (GitHub) and merge requests
+// (GitLab) for a pushed branch.
+package pullrequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+// Supported APIs
+const (
+	GitHub = "github"
+	GitLab = "gitlab"
+)
+
+// Request describes the pull request to open
+type Request struct {
+	Title string
+	Body  string
+	Head  string // Branch with the changes
+	Base  string // Branch to merge into
+	Draft bool
+}
+
+// Remote is a repository on a host with a supported API
+type Remote struct {
+	API     string // GitHub or GitLab
+	APIBase string // e.g. https://api.github.com
+	Host    string
+	Path    string // owner/repo, or group/subgroup/repo on GitLab
+}
+
+// ParseRemote works out the API for a clone URL. api names the API for
+// self-hosted servers ("github" or "gitlab"); github.com and gitlab.com are
+// recognized without it.
+func ParseRemote(rawURL, api string) (*Remote, error) {
+	ep, err := transport.NewEndpoint(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote URL: %w", err)
+	}
+
+	if ep.Host == "" {
+		return nil, fmt.Errorf("remote %s is not hosted on a git server", rawURL)
+	}
+
+	host := strings.ToLower(ep.Host)
+	if api == "" {
+		switch {
+		case host == "github.com":
+			api = GitHub
+		case host == "gitlab.com":
+			api = GitLab
+		default:
+			return nil, fmt.Errorf("don't know how to open pull requests on %s; set \"api\" for it under git.hosts in ~/.worklet/config.jsonc", ep.Host)
+		}
+	}
+
+	remote := &Remote{
+		API:  api,
+		Host: ep.Host,
+		Path: strings.TrimSuffix(strings.Trim(ep.Path, "/"), ".git"),
+	}
+
+	// API calls always go over HTTPS, even for SSH remotes
+	webHost := ep.Host
+	if ep.Protocol != "ssh" && ep.Port > 0 {
+		webHost = fmt.Sprintf("%s:%d", ep.Host, ep.Port)
+	}
+
+	switch api {
+	case GitHub:
+		if host == "github.com" {
+			remote.APIBase = "https://api.github.com"
+		} else {
+			remote.APIBase = fmt.Sprintf("https://%s/api/v3", webHost)
+		}
+		if strings.Count(remote.Path, "/") != 1 {
+			return nil, fmt.Errorf("unexpected GitHub repository path: %s", remote.Path)
+		}
+	case GitLab:
+		remote.APIBase = fmt.Sprintf("https://%s/api/v4", webHost)
+	default:
+		return nil, fmt.Errorf("unsupported pull request API %q (use %q or %q)", api, GitHub, GitLab)
+	}
+
+	return remote, nil
+}
+
+// Create opens the pull request and returns its web URL
+func (r *Remote) Create(ctx context.Context, token string, req Request) (string, error) {
+	if token == "" {
+		return "", fmt.Errorf("no API token for %s; set one in ~/.worklet/config.jsonc or the environment", r.Host)
+	}
+
+	var endpoint string
+	var payload any
+	header := make(http.Header)
+
+	switch r.API {
+	case GitHub:
+		endpoint = fmt.Sprintf("%s/repos/%s/pulls", r.APIBase, r.Path)
+		payload = map[string]any{
+			"title": req.Title,
+			"body":  req.Body,
+			"head":  req.Head,
+			"base":  req.Base,
+			"draft": req.Draft,
+		}
+		header.Set("Authorization", "Bearer "+token)
+		header.Set("Accept", "application/vnd.github+json")
+	case GitLab:
+		endpoint = fmt.Sprintf("%s/projects/%s/merge_requests", r.APIBase, url.PathEscape(r.Path))
+		title := req.Title
+		if req.Draft {
+			title = "Draft: " + title
+		}
+		payload = map[string]any{
+			"title":         title,
+			"description":   req.Body,
+			"source_branch": req.Head,
+			"target_branch": req.Base,
+		}
+		header.Set("PRIVATE-TOKEN", token)
+	default:
+		return "", fmt.Errorf("unsupported pull request API %q", r.API)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header = header
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("failed to create pull request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to create pull request: %s: %s", resp.Status, apiMessage(body))
+	}
+
+	var result struct {
+		HTMLURL string `json:"html_url"` // GitHub
+		WebURL  string `json:"web_url"`  // GitLab
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if result.HTMLURL != "" {
+		return result.HTMLURL, nil
+	}
+	return result.WebURL, nil
+}
+
+// apiMessage extracts the error message from a GitHub or GitLab error
+// response, falling back to the raw body
+func apiMessage(body []byte) string {
+	var apiErr struct {
+		Message any `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Message == nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	message := fmt.Sprint(apiErr.Message)
+	for _, e := range apiErr.Errors {
+		if e.Message != "" {
+			message += "; " + e.Message
+		}
+	}
+	return message
+}
@@ -0,0 +1,94 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		url     string
+		api     string
+		apiBase string
+		path    string
+	}{
+		{"https://github.com/user/repo.git", "", "https://api.github.com", "user/repo"},
+		{"git@github.com:user/repo.git", "", "https://api.github.com", "user/repo"},
+		{"https://gitlab.com/group/sub/repo.git", "", "https://gitlab.com/api/v4", "group/sub/repo"},
+		{"ssh://git@ghe.corp:2222/team/repo.git", "github", "https://ghe.corp/api/v3", "team/repo"},
+		{"https://git.corp:8443/team/repo", "gitlab", "https://git.corp:8443/api/v4", "team/repo"},
+	}
+
+	for _, tt := range tests {
+		remote, err := ParseRemote(tt.url, tt.api)
+		if err != nil {
+			t.Errorf("ParseRemote(%q) failed: %v", tt.url, err)
+			continue
+		}
+		if remote.APIBase != tt.apiBase || remote.Path != tt.path {
+			t.Errorf("ParseRemote(%q) = %s %s, want %s %s", tt.url, remote.APIBase, remote.Path, tt.apiBase, tt.path)
+		}
+	}
+
+	for _, url := range []string{"https://git.corp/team/repo.git", "https://gitlab.attacker.example/team/repo.git"} {
+		if _, err := ParseRemote(url, ""); err == nil {
+			t.Errorf("Expected an error for %s without an API", url)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://example.com/pr/1", "web_url": "https://example.com/mr/1"}`))
+	}))
+	defer server.Close()
+
+	req := Request{Title: "Add feature", Body: "- Add feature\n", Head: "feat", Base: "main", Draft: true}
+
+	github := &Remote{API: GitHub, APIBase: server.URL, Host: "github.com", Path: "user/repo"}
+	url, err := github.Create(context.Background(), "token", req)
+	if err != nil {
+		t.Fatalf("GitHub Create failed: %v", err)
+	}
+	if url != "https://example.com/pr/1" || gotPath != "/repos/user/repo/pulls" || gotAuth != "Bearer token" {
+		t.Errorf("Unexpected GitHub request: %s %s -> %s", gotPath, gotAuth, url)
+	}
+	if gotBody["head"] != "feat" || gotBody["draft"] != true {
+		t.Errorf("Unexpected GitHub payload: %v", gotBody)
+	}
+
+	gitlab := &Remote{API: GitLab, APIBase: server.URL, Host: "gitlab.com", Path: "group/sub/repo"}
+	if _, err := gitlab.Create(context.Background(), "token", req); err != nil {
+		t.Fatalf("GitLab Create failed: %v", err)
+	}
+	if gotPath != "/projects/group%2Fsub%2Frepo/merge_requests" || gotAuth != "token" {
+		t.Errorf("Unexpected GitLab request: %s %s", gotPath, gotAuth)
+	}
+	if gotBody["title"] != "Draft: Add feature" || gotBody["source_branch"] != "feat" {
+		t.Errorf("Unexpected GitLab payload: %v", gotBody)
+	}
+}
+
+func TestCreateReportsAPIErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		w.Write([]byte(`{"message": "Validation Failed", "errors": [{"message": "A pull request already exists"}]}`))
+	}))
+	defer server.Close()
+
+	remote := &Remote{API: GitHub, APIBase: server.URL, Host: "github.com", Path: "user/repo"}
+	_, err := remote.Create(context.Background(), "token", Request{Head: "feat", Base: "main"})
+	if err == nil || !strings.Contains(err.Error(), "A pull request already exists") {
+		t.Errorf("Expected the API error message, got %v", err)
+	}
+}
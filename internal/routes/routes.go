@@ -0,0 +1,199 @@
+// Package routes stores per-session route overrides: paths the proxy answers
+// with a fixture file or sends to a different session instead of the
+// session's own service.
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// Route overrides a path of a session's HTTP services
+type Route struct {
+	// Path is matched exactly, or as a prefix when it ends in "*"
+	Path string `json:"path"`
+
+	// Service limits the route to one HTTP service; empty applies it to all
+	Service string `json:"service,omitempty"`
+
+	// File is served for the path, with ContentType
+	File        string `json:"file,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+
+	// Target is a session, optionally "<session>/<service>", the path is
+	// proxied to
+	Target string `json:"target,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsPrefix reports whether the route matches every path under Prefix
+func (r Route) IsPrefix() bool {
+	return strings.HasSuffix(r.Path, "*")
+}
+
+// Prefix returns the path without the trailing "*" of a prefix route
+func (r Route) Prefix() string {
+	return strings.TrimSuffix(r.Path, "*")
+}
+
+// TargetSession returns the session and service a proxied route goes to.
+// The service is empty when the target didn't name one.
+func (r Route) TargetSession() (string, string) {
+	session, service, _ := strings.Cut(r.Target, "/")
+	return session, service
+}
+
+// AppliesTo reports whether the route overrides a service
+func (r Route) AppliesTo(service string) bool {
+	return r.Service == "" || r.Service == service
+}
+
+// Describe returns what the route does, for listings
+func (r Route) Describe() string {
+	if r.File != "" {
+		return fmt.Sprintf("file %s (%s)", r.File, r.ContentType)
+	}
+	return "session " + r.Target
+}
+
+// unsafeChars can't appear in paths and content types, which are written
+// into the nginx config unquoted
+const unsafeChars = " \t\r\n;{}\"'\\$#"
+
+// Validate checks that a route can be written into the nginx config
+func (r Route) Validate() error {
+	if !strings.HasPrefix(r.Path, "/") {
+		return fmt.Errorf("path %q must start with /", r.Path)
+	}
+	if strings.ContainsAny(r.Path, unsafeChars) {
+		return fmt.Errorf("path %q contains characters that aren't allowed in a route", r.Path)
+	}
+	if strings.Contains(r.Prefix(), "*") {
+		return fmt.Errorf("path %q may only end in *", r.Path)
+	}
+	if (r.File == "") == (r.Target == "") {
+		return fmt.Errorf("route %s needs either a file or a target session", r.Path)
+	}
+	if strings.ContainsAny(r.ContentType, unsafeChars) {
+		return fmt.Errorf("invalid content type %q (parameters aren't supported)", r.ContentType)
+	}
+	return nil
+}
+
+// Store keeps routes keyed by session ID in a single JSON file
+type Store struct {
+	path string
+}
+
+// New returns the store at ~/.worklet/routes.json
+func New() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return NewAt(filepath.Join(homeDir, ".worklet", "routes.json")), nil
+}
+
+// NewAt returns a store backed by the file at path
+func NewAt(path string) *Store {
+	return &Store{path: path}
+}
+
+// All returns every session's routes keyed by session ID
+func (s *Store) All() (map[string][]Route, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string][]Route{}, nil
+		}
+		return nil, fmt.Errorf("failed to read routes: %w", err)
+	}
+
+	routes := make(map[string][]Route)
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+	return routes, nil
+}
+
+// Get returns a session's routes
+func (s *Store) Get(sessionID string) ([]Route, error) {
+	routes, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	return routes[sessionID], nil
+}
+
+// Add adds a route to a session, replacing the route for the same path and
+// service
+func (s *Store) Add(sessionID string, route Route) error {
+	if err := route.Validate(); err != nil {
+		return err
+	}
+	if route.CreatedAt.IsZero() {
+		route.CreatedAt = time.Now()
+	}
+	return s.update(func(routes map[string][]Route) {
+		var kept []Route
+		for _, existing := range routes[sessionID] {
+			if existing.Path != route.Path || existing.Service != route.Service {
+				kept = append(kept, existing)
+			}
+		}
+		routes[sessionID] = append(kept, route)
+	})
+}
+
+// Remove deletes a session's route for a path and service, and reports
+// whether there was one
+func (s *Store) Remove(sessionID, path, service string) (bool, error) {
+	removed := false
+	err := s.update(func(routes map[string][]Route) {
+		var kept []Route
+		for _, existing := range routes[sessionID] {
+			if existing.Path == path && existing.Service == service {
+				removed = true
+				continue
+			}
+			kept = append(kept, existing)
+		}
+		if len(kept) == 0 {
+			delete(routes, sessionID)
+		} else {
+			routes[sessionID] = kept
+		}
+	})
+	return removed, err
+}
+
+// Clear deletes every route of a session
+func (s *Store) Clear(sessionID string) error {
+	return s.update(func(routes map[string][]Route) {
+		delete(routes, sessionID)
+	})
+}
+
+// update applies fn to the routes while holding the store's lock
+func (s *Store) update(fn func(map[string][]Route)) error {
+	return storage.WithLock(s.path, func() error {
+		routes, err := s.All()
+		if err != nil {
+			return err
+		}
+		fn(routes)
+
+		data, err := json.MarshalIndent(routes, "", "  ")
+		if err != nil {
+			return err
+		}
+		return storage.WriteFileAtomic(s.path, data, 0644)
+	})
+}
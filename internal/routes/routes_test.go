@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddRemove(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-test-routes-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewAt(filepath.Join(dir, "routes.json"))
+
+	if routes, err := store.Get("1"); err != nil || len(routes) != 0 {
+		t.Fatalf("Expected no routes in an empty store, got %v, %v", routes, err)
+	}
+
+	flags := Route{Path: "/api/flags", File: "/tmp/flags.json", ContentType: "application/json"}
+	if err := store.Add("1", flags); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add("1", Route{Path: "/api/*", Target: "2/api"}); err != nil {
+		t.Fatal(err)
+	}
+	// The same path for the same service replaces the route
+	if err := store.Add("1", Route{Path: "/api/flags", Target: "3"}); err != nil {
+		t.Fatal(err)
+	}
+	// For another service it doesn't
+	if err := store.Add("1", Route{Path: "/api/flags", Service: "web", File: "/tmp/flags.json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := store.Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %+v", routes)
+	}
+	if routes[1].Path != "/api/flags" || routes[1].Target != "3" {
+		t.Errorf("Expected the replaced route to target session 3, got %+v", routes[1])
+	}
+
+	removed, err := store.Remove("1", "/api/*", "")
+	if err != nil || !removed {
+		t.Fatalf("Expected /api/* to be removed, got %v, %v", removed, err)
+	}
+	if removed, _ := store.Remove("1", "/missing", ""); removed {
+		t.Error("Expected nothing to be removed for an unknown path")
+	}
+
+	if err := store.Clear("1"); err != nil {
+		t.Fatal(err)
+	}
+	all, err := store.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 0 {
+		t.Errorf("Expected no sessions after clearing, got %v", all)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		route   Route
+		wantErr bool
+	}{
+		{Route{Path: "/api/flags", File: "/tmp/f.json", ContentType: "application/json"}, false},
+		{Route{Path: "/api/*", Target: "2"}, false},
+		{Route{Path: "api/flags", Target: "2"}, true},
+		{Route{Path: "/api/flags; return 200", Target: "2"}, true},
+		{Route{Path: "/a*/b", Target: "2"}, true},
+		{Route{Path: "/api", Target: "2", File: "/tmp/f.json"}, true},
+		{Route{Path: "/api"}, true},
+		{Route{Path: "/api", File: "/tmp/f", ContentType: "text/html; charset=utf-8"}, true},
+	}
+	for _, tt := range tests {
+		err := tt.route.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.route, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTargetSession(t *testing.T) {
+	session, service := Route{Target: "2/api"}.TargetSession()
+	if session != "2" || service != "api" {
+		t.Errorf("TargetSession() = %q, %q, want 2, api", session, service)
+	}
+	session, service = Route{Target: "2"}.TargetSession()
+	if session != "2" || service != "" {
+		t.Errorf("TargetSession() = %q, %q, want 2 and no service", session, service)
+	}
+}
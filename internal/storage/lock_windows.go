@@ -0,0 +1,14 @@
+//go:build windows
+
+package storage
+
+import "os"
+
+// File locking is not implemented on Windows; atomic renames still apply
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,193 @@
+// Package support builds the tarballs `worklet support-bundle` attaches to
+// bug reports, redacting secrets from the configs and container details
+// they hold.
+package support
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tidwall/jsonc"
+)
+
+// Redacted replaces secret values
+const Redacted = "[REDACTED]"
+
+// Bundle writes files into a gzipped tarball. Files that can't be collected
+// are listed in SUMMARY.txt instead of failing the bundle.
+type Bundle struct {
+	gz      *gzip.Writer
+	tw      *tar.Writer
+	created time.Time
+	added   []string
+	missing []string
+}
+
+// NewBundle starts a bundle written to w
+func NewBundle(w io.Writer) *Bundle {
+	gz := gzip.NewWriter(w)
+	return &Bundle{gz: gz, tw: tar.NewWriter(gz), created: time.Now()}
+}
+
+// Add writes a file to the bundle
+func (b *Bundle) Add(name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: b.created,
+	}
+	if err := b.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := b.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	b.added = append(b.added, name)
+	return nil
+}
+
+// AddFile writes the last maxSize bytes of the file at path to the bundle,
+// or all of it if maxSize is 0
+func (b *Bundle) AddFile(name, path string, maxSize int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if maxSize > 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxSize {
+			if _, err := file.Seek(info.Size()-maxSize, io.SeekStart); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	return b.Add(name, data)
+}
+
+// Missing notes a file that couldn't be collected and why
+func (b *Bundle) Missing(name string, err error) {
+	b.missing = append(b.missing, fmt.Sprintf("%s: %v", name, err))
+}
+
+// Close writes SUMMARY.txt and finishes the tarball
+func (b *Bundle) Close() error {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "worklet support bundle created %s\n\n", b.created.Format(time.RFC3339))
+	summary.WriteString("Collected:\n")
+	for _, name := range b.added {
+		fmt.Fprintf(&summary, "  %s\n", name)
+	}
+	if len(b.missing) > 0 {
+		summary.WriteString("\nNot collected:\n")
+		for _, line := range b.missing {
+			fmt.Fprintf(&summary, "  %s\n", line)
+		}
+	}
+	if err := b.Add("SUMMARY.txt", []byte(summary.String())); err != nil {
+		return err
+	}
+
+	if err := b.tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if err := b.gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	return nil
+}
+
+// RedactJSON returns JSON or JSONC with secret values replaced, indented.
+// Values of keys that look secret are redacted, as is every value in
+// environment variable and header maps and in "KEY=value" env lists, since
+// their names don't say whether they hold secrets.
+func RedactJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(jsonc.ToJSON(data), &v); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return json.MarshalIndent(redact(v, ""), "", "  ")
+}
+
+func redact(v any, key string) any {
+	switch {
+	case isSecretKey(key):
+		if v == nil {
+			return nil
+		}
+		return Redacted
+	case isValueMapKey(key):
+		switch v := v.(type) {
+		case map[string]any:
+			redacted := make(map[string]any, len(v))
+			for name := range v {
+				redacted[name] = Redacted
+			}
+			return redacted
+		case []any:
+			redacted := make([]any, len(v))
+			for i, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					redacted[i] = redact(item, "")
+					continue
+				}
+				if name, _, found := strings.Cut(s, "="); found {
+					redacted[i] = name + "=" + Redacted
+				} else {
+					redacted[i] = s
+				}
+			}
+			return redacted
+		}
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for name, value := range v {
+			v[name] = redact(value, name)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = redact(item, "")
+		}
+	}
+	return v
+}
+
+// isSecretKey reports whether a key's value is likely a secret
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"token", "secret", "password", "passwd", "credential", "auth", "apikey", "api_key", "private"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return strings.HasSuffix(key, "key") && key != "key"
+}
+
+// isValueMapKey reports whether a key holds variables whose values are all
+// redacted
+func isValueMapKey(key string) bool {
+	switch strings.ToLower(key) {
+	case "env", "environment", "headers", "buildargs", "build_args":
+		return true
+	}
+	return false
+}
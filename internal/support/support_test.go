@@ -0,0 +1,114 @@
+package support
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactJSON(t *testing.T) {
+	input := `{
+		// Global config
+		"git": {"hosts": {"github.com": {"username": "me", "token": "ghp_abc", "tokenEnv": "GH_TOKEN"}}},
+		"telemetry": {"endpoint": "http://localhost:4318", "headers": {"X-Team": "a"}},
+		"run": {"env": {"DATABASE_URL": "postgres://u:p@db"}},
+		"Config": {"Env": ["PATH=/usr/bin", "API_KEY=xyz", "EMPTY"], "Image": "node:20"}
+	}`
+
+	out, err := RedactJSON([]byte(input))
+	if err != nil {
+		t.Fatalf("RedactJSON failed: %v", err)
+	}
+	for _, secret := range []string{"ghp_abc", "GH_TOKEN", "postgres://", "xyz", `"a"`, "/usr/bin"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("redacted output still contains %q:\n%s", secret, out)
+		}
+	}
+
+	var redacted struct {
+		Git struct {
+			Hosts map[string]map[string]string `json:"hosts"`
+		} `json:"git"`
+		Telemetry struct {
+			Endpoint string `json:"endpoint"`
+		} `json:"telemetry"`
+		Config struct {
+			Env   []string `json:"Env"`
+			Image string   `json:"Image"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(out, &redacted); err != nil {
+		t.Fatalf("redacted output isn't JSON: %v", err)
+	}
+	if got := redacted.Git.Hosts["github.com"]["username"]; got != "me" {
+		t.Errorf("username = %q, want it kept", got)
+	}
+	if redacted.Telemetry.Endpoint != "http://localhost:4318" || redacted.Config.Image != "node:20" {
+		t.Errorf("non-secret values weren't kept: %s", out)
+	}
+	wantEnv := []string{"PATH=" + Redacted, "API_KEY=" + Redacted, "EMPTY"}
+	if strings.Join(redacted.Config.Env, ",") != strings.Join(wantEnv, ",") {
+		t.Errorf("Env = %v, want %v", redacted.Config.Env, wantEnv)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	dir, err := os.MkdirTemp("", "support-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logPath := filepath.Join(dir, "daemon.log")
+	if err := os.WriteFile(logPath, []byte("old line\nnew line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	bundle := NewBundle(&buf)
+	if err := bundle.Add("version.txt", []byte("1.0\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bundle.AddFile("daemon/daemon.log", logPath, 9); err != nil {
+		t.Fatal(err)
+	}
+	bundle.Missing("docker/inspect.json", errors.New("docker is not running"))
+	if err := bundle.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[header.Name] = string(data)
+	}
+
+	if files["version.txt"] != "1.0\n" {
+		t.Errorf("version.txt = %q", files["version.txt"])
+	}
+	if files["daemon/daemon.log"] != "new line\n" {
+		t.Errorf("daemon.log = %q, want only its tail", files["daemon/daemon.log"])
+	}
+	if !strings.Contains(files["SUMMARY.txt"], "docker/inspect.json: docker is not running") {
+		t.Errorf("SUMMARY.txt doesn't list the missing file:\n%s", files["SUMMARY.txt"])
+	}
+}
@@ -0,0 +1,219 @@
+// Package templates reads the catalog of starter projects behind `worklet
+// new` and scaffolds projects from them.
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/fscopy"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// DefaultIndex is the catalog used unless another is configured
+const DefaultIndex = "https://raw.githubusercontent.com/nolanleung/worklet-templates/main/index.json"
+
+// IndexEnv overrides the catalog's location
+const IndexEnv = "WORKLET_TEMPLATES_INDEX"
+
+// fetchTimeout bounds downloading the catalog
+const fetchTimeout = 10 * time.Second
+
+// Catalog is the index of starter projects
+type Catalog struct {
+	Templates []Template `json:"templates"`
+}
+
+// Template is a starter project kept in a git repository
+type Template struct {
+	Name        string   `json:"name"` // e.g. "nextjs"
+	Description string   `json:"description"`
+	Repo        string   `json:"repo"`                // Git URL of the repository holding it
+	Ref         string   `json:"ref,omitempty"`       // Branch, tag or commit (default: the default branch)
+	Path        string   `json:"path,omitempty"`      // Directory within the repository (default: its root)
+	Platforms   []string `json:"platforms,omitempty"` // e.g. "linux/amd64"; empty means any
+}
+
+// Platform is the platform session containers run on here
+func Platform() string {
+	return "linux/" + runtime.GOARCH
+}
+
+// Supports reports whether the template's images run on platform
+func (t Template) Supports(platform string) bool {
+	return len(t.Platforms) == 0 || slices.Contains(t.Platforms, platform)
+}
+
+// Find returns the template with the given name
+func (c *Catalog) Find(name string) (Template, error) {
+	for _, t := range c.Templates {
+		if strings.EqualFold(t.Name, name) {
+			return t, nil
+		}
+	}
+	var names []string
+	for _, t := range c.Templates {
+		names = append(names, t.Name)
+	}
+	return Template{}, fmt.Errorf("no template named %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// IndexLocation returns where the catalog is read from: the
+// WORKLET_TEMPLATES_INDEX environment variable, then configured, then
+// DefaultIndex
+func IndexLocation(configured string) string {
+	if index := os.Getenv(IndexEnv); index != "" {
+		return index
+	}
+	if configured != "" {
+		return configured
+	}
+	return DefaultIndex
+}
+
+// cachePath is where the last catalog downloaded is kept for offline use
+func cachePath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".worklet", "templates", "index.json"), nil
+}
+
+// Load reads the catalog at location, an http(s) URL or a file path. A
+// downloaded catalog is cached, and the cached copy is used when the
+// download fails; stale reports whether that happened.
+func Load(location string) (catalog *Catalog, stale bool, err error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		data, err := os.ReadFile(location)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read template catalog: %w", err)
+		}
+		catalog, err := Parse(data)
+		return catalog, false, err
+	}
+
+	data, fetchErr := fetch(location)
+	if fetchErr == nil {
+		catalog, err := Parse(data)
+		if err != nil {
+			return nil, false, err
+		}
+		if path, err := cachePath(); err == nil {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err == nil {
+				storage.WriteFileAtomic(path, data, 0644)
+			}
+		}
+		return catalog, false, nil
+	}
+
+	path, err := cachePath()
+	if err != nil {
+		return nil, false, fetchErr
+	}
+	cached, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fetchErr
+	}
+	catalog, err = Parse(cached)
+	if err != nil {
+		return nil, false, fetchErr
+	}
+	return catalog, true, nil
+}
+
+func fetch(url string) ([]byte, error) {
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download template catalog: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download template catalog: %s returned %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download template catalog: %w", err)
+	}
+	return data, nil
+}
+
+// Parse parses and checks a catalog
+func Parse(data []byte) (*Catalog, error) {
+	var catalog Catalog
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse template catalog: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, t := range catalog.Templates {
+		// The name is the directory worklet new creates by default
+		nameErr := config.ValidateName(t.Name)
+		switch {
+		case t.Name == "" || t.Repo == "":
+			return nil, fmt.Errorf("invalid template catalog: every template needs a name and a repo")
+		case nameErr != nil:
+			return nil, fmt.Errorf("invalid template catalog: %w", nameErr)
+		case seen[strings.ToLower(t.Name)]:
+			return nil, fmt.Errorf("invalid template catalog: template %q is listed twice", t.Name)
+		case filepath.IsAbs(t.Path) || slices.Contains(strings.Split(filepath.ToSlash(t.Path), "/"), ".."):
+			return nil, fmt.Errorf("invalid template catalog: template %q has path %q outside its repository", t.Name, t.Path)
+		}
+		seen[strings.ToLower(t.Name)] = true
+	}
+	return &catalog, nil
+}
+
+// topLevelName matches the first "name" key of a .worklet.jsonc, which is
+// the project's by convention
+var topLevelName = regexp.MustCompile(`("name"\s*:\s*)"[^"]*"`)
+
+// Scaffold copies the template's files from checkout, a clone of its
+// repository, into dir, which must not exist or be empty. The project in the
+// template's .worklet.jsonc is renamed after dir.
+func Scaffold(t Template, checkout, dir string) error {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s already exists and isn't empty", dir)
+	}
+
+	src := filepath.Join(checkout, filepath.FromSlash(t.Path))
+	if info, err := os.Stat(src); err != nil || !info.IsDir() {
+		return fmt.Errorf("template %s has no directory %s", t.Name, t.Path)
+	}
+	if err := fscopy.Copy(src, dir, fscopy.Options{SkipGit: true, Log: io.Discard}); err != nil {
+		return fmt.Errorf("failed to copy template %s: %w", t.Name, err)
+	}
+
+	configPath := filepath.Join(dir, ".worklet.jsonc")
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+	name := config.SanitizeName(filepath.Base(dir))
+	if name == "" {
+		return nil
+	}
+	if loc := topLevelName.FindSubmatchIndex(data); loc != nil {
+		renamed := append([]byte{}, data[:loc[0]]...)
+		renamed = append(renamed, data[loc[2]:loc[3]]...)
+		renamed = append(renamed, fmt.Sprintf("%q", name)...)
+		renamed = append(renamed, data[loc[1]:]...)
+		data = renamed
+	}
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", configPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package templates
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCatalog = `{
+  "templates": [
+    {"name": "nextjs", "description": "Next.js app", "repo": "https://github.com/example/templates.git", "path": "nextjs"},
+    {"name": "go-api", "description": "Go API", "repo": "https://github.com/example/templates.git", "path": "go-api", "platforms": ["linux/s390x"]}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	catalog, err := Parse([]byte(testCatalog))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(catalog.Templates) != 2 {
+		t.Fatalf("Parse() returned %d templates, want 2", len(catalog.Templates))
+	}
+
+	invalid := map[string]string{
+		"missing repo":   `{"templates": [{"name": "a"}]}`,
+		"duplicate":      `{"templates": [{"name": "a", "repo": "r"}, {"name": "A", "repo": "r"}]}`,
+		"escaping path":  `{"templates": [{"name": "a", "repo": "r", "path": "../etc"}]}`,
+		"absolute path":  `{"templates": [{"name": "a", "repo": "r", "path": "/etc"}]}`,
+		"escaping name":  `{"templates": [{"name": "../x", "repo": "r"}]}`,
+		"malformed json": `{"templates": [`,
+	}
+	for name, data := range invalid {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestFindAndSupports(t *testing.T) {
+	catalog, err := Parse([]byte(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := catalog.Find("NextJS")
+	if err != nil {
+		t.Fatalf("Find(NextJS) error = %v", err)
+	}
+	if tmpl.Name != "nextjs" || !tmpl.Supports("linux/arm64") {
+		t.Errorf("Find(NextJS) = %+v, want nextjs supporting any platform", tmpl)
+	}
+
+	goAPI, _ := catalog.Find("go-api")
+	if goAPI.Supports("linux/amd64") || !goAPI.Supports("linux/s390x") {
+		t.Errorf("go-api should only support linux/s390x")
+	}
+
+	if _, err := catalog.Find("rails"); err == nil || !strings.Contains(err.Error(), "nextjs, go-api") {
+		t.Errorf("Find(rails) error = %v, want one listing the templates", err)
+	}
+}
+
+func TestLoadCachesDownloadedCatalog(t *testing.T) {
+	home, err := os.MkdirTemp("", "worklet-templates-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+
+	up := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(testCatalog))
+	}))
+	defer server.Close()
+
+	catalog, stale, err := Load(server.URL)
+	if err != nil || stale || len(catalog.Templates) != 2 {
+		t.Fatalf("Load() = %v, %v, %v; want the served catalog", catalog, stale, err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".worklet", "templates", "index.json")); err != nil {
+		t.Fatalf("catalog wasn't cached: %v", err)
+	}
+
+	up = false
+	catalog, stale, err = Load(server.URL)
+	if err != nil || !stale || len(catalog.Templates) != 2 {
+		t.Fatalf("Load() while down = %v, %v, %v; want the cached catalog", catalog, stale, err)
+	}
+
+	os.RemoveAll(filepath.Join(home, ".worklet"))
+	if _, _, err := Load(server.URL); err == nil {
+		t.Fatalf("Load() while down without a cache succeeded, want an error")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-templates-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "index.json")
+	if err := os.WriteFile(path, []byte(testCatalog), 0644); err != nil {
+		t.Fatal(err)
+	}
+	catalog, stale, err := Load(path)
+	if err != nil || stale || len(catalog.Templates) != 2 {
+		t.Fatalf("Load(%s) = %v, %v, %v", path, catalog, stale, err)
+	}
+}
+
+func TestIndexLocation(t *testing.T) {
+	t.Setenv(IndexEnv, "")
+	if got := IndexLocation(""); got != DefaultIndex {
+		t.Errorf("IndexLocation(\"\") = %q, want the default", got)
+	}
+	if got := IndexLocation("/srv/index.json"); got != "/srv/index.json" {
+		t.Errorf("IndexLocation() = %q, want the configured index", got)
+	}
+	t.Setenv(IndexEnv, "https://example.com/index.json")
+	if got := IndexLocation("/srv/index.json"); got != "https://example.com/index.json" {
+		t.Errorf("IndexLocation() = %q, want the environment's index", got)
+	}
+}
+
+func TestScaffold(t *testing.T) {
+	root, err := os.MkdirTemp("", "worklet-templates-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	checkout := filepath.Join(root, "checkout")
+	files := map[string]string{
+		".git/HEAD":             "ref: refs/heads/main\n",
+		"nextjs/.worklet.jsonc": "{\n  // Starter\n  \"name\": \"nextjs-starter\",\n  \"services\": [{\"name\": \"app\", \"port\": 3000}]\n}\n",
+		"nextjs/package.json":   "{}\n",
+		"nextjs/app/page.tsx":   "export default function Page() {}\n",
+		"go-api/.worklet.jsonc": "{}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(checkout, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpl := Template{Name: "nextjs", Repo: "r", Path: "nextjs"}
+	dir := filepath.Join(root, "My Shop")
+	if err := Scaffold(tmpl, checkout, dir); err != nil {
+		t.Fatalf("Scaffold() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "app", "page.tsx")); err != nil {
+		t.Errorf("template files weren't copied: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "go-api")); !os.IsNotExist(err) {
+		t.Errorf("files outside the template's path were copied")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".worklet.jsonc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  // Starter\n  \"name\": \"my-shop\",\n  \"services\": [{\"name\": \"app\", \"port\": 3000}]\n}\n"
+	if string(data) != want {
+		t.Errorf(".worklet.jsonc = %q, want %q", data, want)
+	}
+
+	if err := Scaffold(tmpl, checkout, dir); err == nil {
+		t.Errorf("Scaffold() into a non-empty directory succeeded, want an error")
+	}
+	if err := Scaffold(Template{Name: "missing", Repo: "r", Path: "missing"}, checkout, filepath.Join(root, "other")); err == nil {
+		t.Errorf("Scaffold() of a missing path succeeded, want an error")
+	}
+}
@@ -0,0 +1,39 @@
+package testutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/nolanleung/worklet/cmd/worklet"
+)
+
+// RunCLI runs a worklet command in-process, e.g. RunCLI(t, "forks"), and
+// returns what it printed to stdout and stderr along with its error. Start a
+// daemon with StartDaemon first for commands that need one.
+func RunCLI(t testing.TB, args ...string) (string, error) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+
+	output := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		output <- buf.Bytes()
+	}()
+
+	runErr := worklet.ExecuteArgs(args)
+
+	os.Stdout, os.Stderr = stdout, stderr
+	w.Close()
+	out := <-output
+	r.Close()
+	return string(out), runErr
+}
@@ -0,0 +1,378 @@
+// Package testutil runs a disposable worklet daemon for end-to-end tests,
+// against the in-memory Docker fake or a real Docker daemon, and runs CLI
+// commands against it in-process.
+//
+// The daemon and the CLI share process-wide state (HOME, environment, the
+// fake, log output and command flags), so tests using this package must not
+// run in parallel.
+package testutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+)
+
+// WaitTimeout bounds how long the Wait helpers poll the daemon
+const WaitTimeout = 5 * time.Second
+
+// Options configures a test daemon
+type Options struct {
+	// RealDocker uses the Docker daemon instead of the fake. The test is
+	// skipped when Docker isn't available.
+	RealDocker bool
+
+	// API has the daemon also serve its TCP API, on a free loopback port
+	API bool
+
+	// APITLS serves the TCP API over TLS with a self-signed certificate,
+	// which APIClient trusts
+	APITLS bool
+}
+
+// Daemon is a worklet daemon running in the test process with its own home
+// directory and socket
+type Daemon struct {
+	t          testing.TB
+	Home       string              // Temporary HOME, holding ~/.worklet
+	SocketPath string              // Socket the daemon listens on
+	Docker     *docker.FakeRuntime // The fake, or nil with real Docker
+	daemon     *daemon.Daemon
+	apiTLS     *tls.Config // Client TLS config of the API with APITLS
+}
+
+// StartDaemon starts a daemon for the test and stops it when the test ends.
+// HOME and WORKLET_SOCKET point at temporary paths for the test's duration,
+// so CLI commands run with RunCLI use it.
+func StartDaemon(t testing.TB, opts Options) *Daemon {
+	t.Helper()
+
+	if opts.RealDocker {
+		if err := exec.Command("docker", "info").Run(); err != nil {
+			t.Skip("Docker is not available")
+		}
+		t.Setenv(docker.FakeDockerEnv, "")
+	} else {
+		t.Setenv(docker.FakeDockerEnv, "1")
+	}
+
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir
+	// paths can exceed
+	home, err := os.MkdirTemp("", "worklet-test-*")
+	if err != nil {
+		t.Fatalf("failed to create home directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(home) })
+
+	socketPath := filepath.Join(home, "worklet.sock")
+	t.Setenv("HOME", home)
+	t.Setenv(daemon.SocketPathEnv, socketPath)
+
+	d := &Daemon{t: t, Home: home, SocketPath: socketPath}
+	if !opts.RealDocker {
+		fake, err := docker.SharedFakeRuntime()
+		if err != nil {
+			t.Fatalf("failed to create Docker fake: %v", err)
+		}
+		fake.Reset()
+		d.Docker = fake
+	}
+
+	if opts.API || opts.APITLS {
+		global := filepath.Join(home, ".worklet", "config.jsonc")
+		if err := os.MkdirAll(filepath.Dir(global), 0755); err != nil {
+			t.Fatal(err)
+		}
+		api := `{"api": {"listen": "127.0.0.1:0"}}`
+		if opts.APITLS {
+			certFile, keyFile := filepath.Join(home, "api.crt"), filepath.Join(home, "api.key")
+			d.apiTLS = writeSelfSignedCert(t, certFile, keyFile)
+			api = fmt.Sprintf(`{"api": {"listen": "127.0.0.1:0", "tlsCert": %q, "tlsKey": %q}}`, certFile, keyFile)
+		}
+		if err := os.WriteFile(global, []byte(api), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The daemon logs freely; keep test output readable unless -v is given
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+		t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	}
+
+	d.daemon = daemon.NewDaemon(socketPath)
+	if err := d.daemon.Start(); err != nil {
+		t.Fatalf("failed to start daemon: %v", err)
+	}
+	t.Cleanup(func() { d.daemon.Stop() })
+
+	// Containers added before the daemon subscribes to events would only be
+	// found by its next full scan
+	if d.Docker != nil {
+		d.waitFor("the daemon to subscribe to Docker events", func() bool {
+			return d.Docker.Subscribers() > 0
+		})
+	}
+
+	return d
+}
+
+// Restart stops the daemon and starts a new one with the same home
+// directory and socket, as after a reboot or upgrade
+func (d *Daemon) Restart() {
+	d.t.Helper()
+
+	if err := d.daemon.Stop(); err != nil {
+		d.t.Fatalf("failed to stop daemon: %v", err)
+	}
+	if d.Docker != nil {
+		d.waitFor("the daemon to unsubscribe from Docker events", func() bool {
+			return d.Docker.Subscribers() == 0
+		})
+	}
+
+	d.daemon = daemon.NewDaemon(d.SocketPath)
+	if err := d.daemon.Start(); err != nil {
+		d.t.Fatalf("failed to restart daemon: %v", err)
+	}
+	if d.Docker != nil {
+		d.waitFor("the daemon to subscribe to Docker events", func() bool {
+			return d.Docker.Subscribers() > 0
+		})
+	}
+}
+
+// Client returns a client connected to the daemon, closed when the test ends
+func (d *Daemon) Client() *daemon.Client {
+	d.t.Helper()
+
+	client := daemon.NewClient(d.SocketPath)
+	if err := client.Connect(); err != nil {
+		d.t.Fatalf("failed to connect to daemon: %v", err)
+	}
+	d.t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// APIClient returns a client of the daemon's TCP API authenticating with
+// token, closed when the test ends. The daemon must be started with API.
+func (d *Daemon) APIClient(token string) *daemon.Client {
+	d.t.Helper()
+
+	client := daemon.NewAPIClient(d.daemon.APIAddress(), token, d.apiTLS)
+	if err := client.Connect(); err != nil {
+		d.t.Fatalf("failed to connect to the daemon's API: %v", err)
+	}
+	d.t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Service is an HTTP service of a fake session
+type Service struct {
+	Name      string
+	Port      int
+	Subdomain string
+}
+
+// AddSession adds a running session container to the fake and returns its
+// container ID. The daemon registers it from the start event.
+func (d *Daemon) AddSession(sessionID, project string, services ...Service) string {
+	d.t.Helper()
+	if d.Docker == nil {
+		d.t.Fatal("AddSession needs the Docker fake")
+	}
+
+	id := make([]byte, 32)
+	rand.Read(id)
+	containerID := hex.EncodeToString(id)
+
+	labels := map[string]string{
+		"worklet.session":      "true",
+		"worklet.session.id":   sessionID,
+		"worklet.project.name": project,
+	}
+	for _, svc := range services {
+		labels["worklet.service."+svc.Name+".port"] = fmt.Sprint(svc.Port)
+		labels["worklet.service."+svc.Name+".subdomain"] = svc.Subdomain
+	}
+
+	d.Docker.Add(docker.FakeContainer{
+		ID:     containerID,
+		Name:   project + "-" + sessionID,
+		Labels: labels,
+	})
+	return containerID
+}
+
+// Forks returns the forks registered with the daemon
+func (d *Daemon) Forks() []daemon.ForkInfo {
+	d.t.Helper()
+
+	client := daemon.NewClient(d.SocketPath)
+	if err := client.Connect(); err != nil {
+		d.t.Fatalf("failed to connect to daemon: %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), WaitTimeout)
+	defer cancel()
+	forks, err := client.ListForks(ctx)
+	if err != nil {
+		d.t.Fatalf("failed to list forks: %v", err)
+	}
+	return forks
+}
+
+// WaitForFork waits until a fork is registered and returns it
+func (d *Daemon) WaitForFork(forkID string) daemon.ForkInfo {
+	d.t.Helper()
+
+	var found *daemon.ForkInfo
+	d.waitFor(fmt.Sprintf("fork %s to be registered", forkID), func() bool {
+		for _, fork := range d.Forks() {
+			if fork.ForkID == forkID {
+				found = &fork
+				return true
+			}
+		}
+		return false
+	})
+	return *found
+}
+
+// WaitForForkRemoved waits until a fork is no longer registered
+func (d *Daemon) WaitForForkRemoved(forkID string) {
+	d.t.Helper()
+
+	d.waitFor(fmt.Sprintf("fork %s to be removed", forkID), func() bool {
+		for _, fork := range d.Forks() {
+			if fork.ForkID == forkID {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// NginxConfig returns the proxy config the daemon last wrote, the main
+// config followed by the forks' include files, or "" if it hasn't written one
+func (d *Daemon) NginxConfig() string {
+	d.t.Helper()
+
+	config, err := docker.ReadNginxConfig(filepath.Join(d.Home, ".worklet", "nginx"))
+	if err != nil && !os.IsNotExist(err) {
+		d.t.Fatalf("failed to read nginx config: %v", err)
+	}
+	return config
+}
+
+// WaitForNginxConfig waits until the proxy config contains every substring,
+// e.g. a session's server_name
+func (d *Daemon) WaitForNginxConfig(substrings ...string) string {
+	d.t.Helper()
+
+	var config string
+	d.waitFor(fmt.Sprintf("nginx config to contain %q", substrings), func() bool {
+		config = d.NginxConfig()
+		for _, s := range substrings {
+			if !strings.Contains(config, s) {
+				return false
+			}
+		}
+		return true
+	})
+	return config
+}
+
+// WaitForNginxConfigWithout waits until the proxy config contains none of
+// the substrings
+func (d *Daemon) WaitForNginxConfigWithout(substrings ...string) string {
+	d.t.Helper()
+
+	var config string
+	d.waitFor(fmt.Sprintf("nginx config not to contain %q", substrings), func() bool {
+		config = d.NginxConfig()
+		for _, s := range substrings {
+			if strings.Contains(config, s) {
+				return false
+			}
+		}
+		return true
+	})
+	return config
+}
+
+// waitFor polls cond until it holds, failing the test after WaitTimeout
+func (d *Daemon) waitFor(what string, cond func() bool) {
+	d.t.Helper()
+
+	deadline := time.Now().Add(WaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			d.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key, and
+// returns a client config trusting it
+func writeSelfSignedCert(t testing.TB, certFile, keyFile string) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "worklet test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+}
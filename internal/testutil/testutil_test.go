@@ -0,0 +1,461 @@
+package testutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/pkg/daemon"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	d := StartDaemon(t, Options{})
+
+	containerID := d.AddSession("12", "shop", Service{Name: "web", Port: 3000, Subdomain: "web"})
+
+	fork := d.WaitForFork("12")
+	if fork.ProjectName != "shop" || fork.ContainerID != containerID {
+		t.Errorf("registered fork = %+v", fork)
+	}
+	if len(fork.Services) != 1 || fork.Services[0].Port != 3000 {
+		t.Errorf("Services = %+v, want web on 3000", fork.Services)
+	}
+	d.WaitForNginxConfig("web.shop-12.", "3000")
+
+	out, err := RunCLI(t, "forks")
+	if err != nil {
+		t.Fatalf("worklet forks failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Session: 12") || !strings.Contains(out, "Project: shop") {
+		t.Errorf("worklet forks output is missing the session:\n%s", out)
+	}
+
+	if err := d.Docker.Remove(containerID); err != nil {
+		t.Fatal(err)
+	}
+	d.WaitForForkRemoved("12")
+	d.WaitForNginxConfigWithout("shop-12")
+}
+
+func TestPsShowsForksByActivity(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	web := Service{Name: "web", Port: 3000, Subdomain: "web"}
+	first := d.AddSession("1", "shop", web)
+	d.WaitForFork("1")
+	crashing := d.AddSession("2", "shop", web)
+	d.WaitForFork("2")
+	d.Docker.Add(docker.FakeContainer{
+		ID:    "stopped",
+		Name:  "shop-4",
+		State: "exited",
+		Labels: map[string]string{
+			"worklet.session":      "true",
+			"worklet.session.id":   "4",
+			"worklet.project.name": "shop",
+		},
+	})
+
+	// Using the first session makes it the most recently used
+	if err := d.Docker.Exec(first, "sh"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Docker.Exit(crashing, 3, true); err != nil {
+		t.Fatal(err)
+	}
+	d.waitFor("session 1 to be used and 2 to crash", func() bool {
+		var used, crashed time.Time
+		restarting := false
+		for _, fork := range d.Forks() {
+			switch fork.ForkID {
+			case "1":
+				used = fork.LastActivityAt
+			case "2":
+				crashed, restarting = fork.LastActivityAt, fork.Restarting
+			}
+		}
+		return restarting && used.After(crashed)
+	})
+
+	out, err := RunCLI(t, "ps")
+	if err != nil {
+		t.Fatalf("worklet ps failed: %v\n%s", err, out)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "1 ") || !strings.HasPrefix(lines[2], "2 ") {
+		t.Fatalf("worklet ps = \n%s\nwant 1 then 2", out)
+	}
+	if !strings.Contains(lines[1], "running") || !strings.Contains(lines[1], "http://web.shop-1.") {
+		t.Errorf("session 1 = %q, want running with its URL", lines[1])
+	}
+	if !strings.Contains(lines[2], "restarting (exit 3)") {
+		t.Errorf("session 2 = %q, want restarting after exiting with 3", lines[2])
+	}
+
+	out, err = RunCLI(t, "ps", "-a")
+	if err != nil {
+		t.Fatalf("worklet ps -a failed: %v\n%s", err, out)
+	}
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[3], "4 ") || !strings.Contains(lines[3], "exited") {
+		t.Errorf("worklet ps -a = \n%s\nwant the stopped session last", out)
+	}
+}
+
+func TestRunCLIResetsFlags(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	d.AddSession("3", "shop", Service{Name: "web", Port: 3000, Subdomain: "web"})
+	d.WaitForFork("3")
+
+	if out, err := RunCLI(t, "chaos", "set", "3", "--latency", "200ms"); err != nil {
+		t.Fatalf("worklet chaos set failed: %v\n%s", err, out)
+	}
+	if out, err := RunCLI(t, "chaos", "set", "3", "--error-rate", "0.5"); err != nil {
+		t.Fatalf("worklet chaos set failed: %v\n%s", err, out)
+	}
+
+	got := d.WaitForFork("3").Chaos["web"]
+	if got.LatencyMS != 0 || got.ErrorRate != 0.5 {
+		t.Errorf("chaos = %+v, want only the second run's error rate", got)
+	}
+}
+
+func TestWaitReturnsExitCode(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	containerID := d.AddSession("5", "shop")
+	d.WaitForFork("5")
+
+	if out, err := RunCLI(t, "wait", "5", "--timeout", "200ms"); err == nil || err.Error() != "exit status 124" {
+		t.Errorf("wait on a running session = %v, want a timeout\n%s", err, out)
+	}
+
+	if err := d.Docker.Exit(containerID, 3, false); err != nil {
+		t.Fatal(err)
+	}
+	out, err := RunCLI(t, "wait", "5")
+	if err == nil || err.Error() != "exit status 3" || strings.TrimSpace(out) != "3" {
+		t.Errorf("wait = %v, %q; want exit status 3", err, out)
+	}
+
+	// Once the container is gone, the daemon's record is used
+	d.WaitForForkRemoved("5")
+	if err := d.Docker.Remove(containerID); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := RunCLI(t, "wait", "5"); err == nil || err.Error() != "exit status 3" {
+		t.Errorf("wait after removal = %v, want exit status 3\n%s", err, out)
+	}
+
+	if _, err := RunCLI(t, "wait", "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("wait for an unknown session = %v, want not found", err)
+	}
+}
+
+func TestDaemonHealthRecoversEventStream(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	client := d.Client()
+
+	report, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if !report.Healthy || !report.EventsConnected {
+		t.Fatalf("report = %+v, want healthy and subscribed", report)
+	}
+
+	d.Docker.SetPingError(errors.New("connection refused"))
+	report, err = client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if report.Healthy || !strings.Contains(report.DockerError, "connection refused") {
+		t.Errorf("report with Docker down = %+v, want unhealthy", report)
+	}
+
+	// Once Docker is back, the event stream is renewed
+	d.Docker.SetPingError(nil)
+	report, err = client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if len(report.Recoveries) != 1 || !strings.Contains(report.Recoveries[0].Action, "event stream") {
+		t.Errorf("Recoveries = %+v, want the event stream reconnected", report.Recoveries)
+	}
+	d.waitFor("the daemon to resubscribe to Docker events", func() bool {
+		report, err := client.Health(context.Background())
+		return err == nil && report.EventReconnects == 1 && report.EventsConnected && d.Docker.Subscribers() == 1
+	})
+
+	// Events still drive the registry
+	d.AddSession("8", "shop")
+	d.WaitForFork("8")
+
+	out, err := RunCLI(t, "daemon", "status", "--verbose")
+	if err != nil {
+		t.Fatalf("worklet daemon status failed: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Health: healthy") || !strings.Contains(out, "1 reconnects") {
+		t.Errorf("worklet daemon status --verbose output:\n%s", out)
+	}
+}
+
+func TestStartupReconciliation(t *testing.T) {
+	d := StartDaemon(t, Options{})
+
+	project, err := os.MkdirTemp("", "worklet-project-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(project)
+	config := `{"services": [{"name": "web", "port": 3000, "subdomain": "web"}]}`
+	if err := os.WriteFile(filepath.Join(project, ".worklet.jsonc"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	web := Service{Name: "web", Port: 3000, Subdomain: "web"}
+	d.AddSession("1", "shop", web)
+	d.Docker.Add(docker.FakeContainer{
+		ID:   "deleted-project",
+		Name: "shop-2",
+		Labels: map[string]string{
+			"worklet.session":           "true",
+			"worklet.session.id":        "2",
+			"worklet.project.name":      "shop",
+			"worklet.workdir":           project,
+			"worklet.workdir.temporary": "false",
+		},
+	})
+	unhealthy := d.AddSession("3", "shop", web)
+	d.WaitForNginxConfig("web.shop-1.", "web.shop-2.", "web.shop-3.")
+
+	// While the daemon is down, a project is deleted and a session fails its
+	// health check
+	os.RemoveAll(project)
+	if err := d.Docker.SetHealth(unhealthy, "unhealthy"); err != nil {
+		t.Fatal(err)
+	}
+	d.Restart()
+
+	report, err := d.Client().Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	r := report.Reconciliation
+	if r == nil {
+		t.Fatal("no reconciliation report")
+	}
+	if len(r.Registered) != 2 || r.Registered[0] != "1" || r.Registered[1] != "3" {
+		t.Errorf("Registered = %v, want 1 and 3", r.Registered)
+	}
+	if len(r.Pruned) != 1 || r.Pruned[0].ForkID != "2" || !strings.Contains(r.Pruned[0].Reason, "no longer exists") {
+		t.Errorf("Pruned = %+v, want 2", r.Pruned)
+	}
+	if len(r.Unhealthy) != 1 || r.Unhealthy[0] != "3" {
+		t.Errorf("Unhealthy = %v, want 3", r.Unhealthy)
+	}
+	if len(r.RemovedRoutes) != 1 {
+		t.Errorf("RemovedRoutes = %v, want the route of 2", r.RemovedRoutes)
+	}
+	d.WaitForNginxConfigWithout("shop-2")
+
+	// The unhealthy session stays routed, so nginx can say it's unavailable
+	d.WaitForNginxConfig("web.shop-3.")
+	if fork := d.WaitForFork("3"); !fork.Unhealthy {
+		t.Errorf("fork 3 = %+v, want unhealthy", fork)
+	}
+	if err := d.Docker.SetHealth(unhealthy, "healthy"); err != nil {
+		t.Fatal(err)
+	}
+	d.waitFor("fork 3 to be healthy", func() bool {
+		for _, fork := range d.Forks() {
+			if fork.ForkID == "3" {
+				return !fork.Unhealthy
+			}
+		}
+		return false
+	})
+}
+
+func TestRequestForkIDSkipsIDsInUse(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	d.AddSession("1", "shop")
+	d.Docker.Add(docker.FakeContainer{
+		ID:    "stopped",
+		Name:  "shop-2",
+		State: "exited",
+		Labels: map[string]string{
+			"worklet.session":      "true",
+			"worklet.session.id":   "2",
+			"worklet.project.name": "shop",
+		},
+	})
+	d.WaitForFork("1")
+
+	client := d.Client()
+	ctx := context.Background()
+	var got []string
+	for _, project := range []string{"shop", "shop", "api"} {
+		id, err := client.RequestForkID(ctx, project, true)
+		if err != nil {
+			t.Fatalf("RequestForkID failed: %v", err)
+		}
+		got = append(got, id)
+	}
+	if strings.Join(got, ",") != "3,4,5" {
+		t.Errorf("sequential IDs = %v, want 3,4,5", got)
+	}
+
+	// Concurrent requests never share an ID
+	ids := make(chan string, 20)
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		client := d.Client()
+		go func(sequential bool) {
+			id, err := client.RequestForkID(ctx, "shop", sequential)
+			ids <- id
+			errs <- err
+		}(i%2 == 0)
+	}
+	seen := map[string]bool{"1": true, "2": true, "3": true, "4": true, "5": true}
+	for i := 0; i < 20; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("RequestForkID failed: %v", err)
+		}
+		id := <-ids
+		if seen[id] {
+			t.Errorf("ID %s was handed out twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestAPITokenRoles(t *testing.T) {
+	d := StartDaemon(t, Options{API: true})
+	d.AddSession("7", "shop", Service{Name: "web", Port: 3000, Subdomain: "web"})
+	d.WaitForFork("7")
+
+	store, err := daemon.NewTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := store.Issue("reader", daemon.RoleReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operator, err := store.Issue("operator", daemon.RoleOperator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	code := func(err error) string {
+		var daemonErr *daemon.DaemonError
+		if errors.As(err, &daemonErr) {
+			return daemonErr.Code
+		}
+		return ""
+	}
+
+	// Requests without a known token are refused
+	if _, err := d.APIClient("").ListForks(ctx); code(err) != daemon.ErrCodeUnauthorized {
+		t.Errorf("ListForks() without a token error = %v, want %s", err, daemon.ErrCodeUnauthorized)
+	}
+	if _, err := d.APIClient("wkt_nope").ListForks(ctx); code(err) != daemon.ErrCodeUnauthorized {
+		t.Errorf("ListForks() with an unknown token error = %v, want %s", err, daemon.ErrCodeUnauthorized)
+	}
+
+	// A read-only token can list forks, but not change them
+	client := d.APIClient(reader)
+	if forks, err := client.ListForks(ctx); err != nil || len(forks) != 1 {
+		t.Errorf("ListForks() = %v, %v; want the session", forks, err)
+	}
+	if err := client.SetNote(ctx, "7", "hi"); code(err) != daemon.ErrCodeForbidden {
+		t.Errorf("SetNote() with a read-only token error = %v, want %s", err, daemon.ErrCodeForbidden)
+	}
+
+	// An operator can, but can't swap forks
+	client = d.APIClient(operator)
+	if err := client.SetNote(ctx, "7", "hi"); err != nil {
+		t.Errorf("SetNote() with an operator token error = %v", err)
+	}
+	if _, err := client.SetStable(ctx, "shop", "7"); code(err) != daemon.ErrCodeForbidden {
+		t.Errorf("SetStable() with an operator token error = %v, want %s", err, daemon.ErrCodeForbidden)
+	}
+	if _, err := client.SetServices(ctx, "7", []daemon.ServiceInfo{{Name: "web", Port: 4000, Subdomain: "web"}}); code(err) != daemon.ErrCodeForbidden {
+		t.Errorf("SetServices() with an operator token error = %v, want %s", err, daemon.ErrCodeForbidden)
+	}
+
+	// Revoking takes effect right away
+	if err := store.Revoke("operator"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetNote(ctx, "7", "bye"); code(err) != daemon.ErrCodeUnauthorized {
+		t.Errorf("SetNote() with a revoked token error = %v, want %s", err, daemon.ErrCodeUnauthorized)
+	}
+}
+
+func TestAPIOverTLS(t *testing.T) {
+	d := StartDaemon(t, Options{APITLS: true})
+	d.AddSession("7", "shop", Service{Name: "web", Port: 3000, Subdomain: "web"})
+	d.WaitForFork("7")
+
+	store, err := daemon.NewTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := store.Issue("reader", daemon.RoleReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if forks, err := d.APIClient(reader).ListForks(ctx); err != nil || len(forks) != 1 {
+		t.Errorf("ListForks() over TLS = %v, %v; want the session", forks, err)
+	}
+
+	// A client speaking plain TCP gets no answer
+	plain := daemon.NewAPIClient(d.daemon.APIAddress(), reader, nil)
+	if err := plain.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if _, err := plain.ListForks(ctx); err == nil {
+		t.Error("ListForks() over plain TCP succeeded, want an error")
+	}
+}
+
+func TestRestartKeepsSocketServices(t *testing.T) {
+	d := StartDaemon(t, Options{})
+	containerID := d.AddSession("8", "shop", Service{Name: "web", Port: 3000, Subdomain: "web"})
+	d.WaitForFork("8")
+
+	services := []daemon.ServiceInfo{
+		{Name: "web", Port: 3000, Subdomain: "web"},
+		{Name: "api", Port: 4000, Subdomain: "api"},
+	}
+	if _, err := d.Client().SetServices(context.Background(), "8", services); err != nil {
+		t.Fatal(err)
+	}
+
+	// Docker restarting the container registers it again
+	if err := d.Docker.Exit(containerID, 1, true); err != nil {
+		t.Fatal(err)
+	}
+	d.waitFor("the fork to be restarting", func() bool {
+		return d.WaitForFork("8").Restarting
+	})
+	if err := d.Docker.Start(containerID); err != nil {
+		t.Fatal(err)
+	}
+	d.waitFor("the restarted fork", func() bool {
+		fork := d.WaitForFork("8")
+		return fork.RestartCount == 1 && !fork.Restarting
+	})
+	if got := d.WaitForFork("8").Services; len(got) != 2 {
+		t.Errorf("Services = %+v, want web and api", got)
+	}
+	d.WaitForNginxConfig("api.shop-8.", "4000")
+}
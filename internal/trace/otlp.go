@@ -0,0 +1,208 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies worklet's spans and metrics to the OpenTelemetry SDK
+const tracerName = "github.com/nolanleung/worklet"
+
+// DurationMetric is the histogram every span's duration is recorded in,
+// with the span's name as the operation attribute
+const DurationMetric = "worklet.operation.duration"
+
+// IDAttribute is the span attribute holding the worklet trace ID, so spans
+// can be matched with WORKLET_TRACE output and daemon log lines
+const IDAttribute = "worklet.trace_id"
+
+// ExportConfig configures OTLP export. Spans and metrics are only exported
+// when an endpoint is set here or through the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or
+// OTEL_EXPORTER_OTLP_METRICS_ENDPOINT environment variables, which also take
+// precedence.
+type ExportConfig struct {
+	Endpoint string            // OTLP/HTTP collector URL, e.g. http://localhost:4318
+	Headers  map[string]string // Extra request headers, e.g. for authentication
+}
+
+// ExportEnabled reports whether cfg or the environment names a collector
+func ExportEnabled(cfg ExportConfig) bool {
+	return signalEnabled(cfg, "TRACES") || signalEnabled(cfg, "METRICS")
+}
+
+// signalEnabled reports whether cfg or the environment names a collector for
+// a signal, "TRACES" or "METRICS"
+func signalEnabled(cfg ExportConfig, signal string) bool {
+	return cfg.Endpoint != "" || envEndpointSet(signal)
+}
+
+// metricInterval is how often metrics are sent while the process runs.
+// Whatever is left is sent when it exits.
+const metricInterval = 30 * time.Second
+
+// SetupExport installs global tracer and meter providers that send spans
+// and metrics to an OTLP collector over HTTP, and returns a function that
+// flushes and stops them. Without a configured endpoint nothing is
+// installed and spans and metrics cost almost nothing.
+func SetupExport(ctx context.Context, service, version string, cfg ExportConfig) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if !ExportEnabled(cfg) {
+		return noop, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", service),
+		attribute.String("service.version", version),
+	))
+	if err != nil {
+		return noop, fmt.Errorf("failed to build telemetry resource: %w", err)
+	}
+
+	var shutdowns []func(context.Context) error
+	shutdown := func(ctx context.Context) error {
+		var errs []error
+		for _, stop := range shutdowns {
+			errs = append(errs, stop(ctx))
+		}
+		return errors.Join(errs...)
+	}
+
+	if signalEnabled(cfg, "TRACES") {
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" && !envEndpointSet("TRACES") {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return noop, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+		)
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+		shutdowns = append(shutdowns, provider.Shutdown)
+	}
+
+	if signalEnabled(cfg, "METRICS") {
+		var opts []otlpmetrichttp.Option
+		if cfg.Endpoint != "" && !envEndpointSet("METRICS") {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(cfg.Endpoint))
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlpmetrichttp.WithHeaders(cfg.Headers))
+		}
+
+		exporter, err := otlpmetrichttp.New(ctx, opts...)
+		if err != nil {
+			shutdown(ctx)
+			return noop, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+		}
+
+		provider := sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(metricInterval))),
+			sdkmetric.WithResource(res),
+		)
+		otel.SetMeterProvider(provider)
+		shutdowns = append(shutdowns, provider.Shutdown)
+	}
+
+	return shutdown, nil
+}
+
+// envEndpointSet reports whether the OTLP endpoint of a signal comes from
+// the environment
+func envEndpointSet(signal string) bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT") != ""
+}
+
+// durations is the histogram of DurationMetric. The global meter provider
+// hands instruments created before SetupExport on to the one it installs.
+var durations = sync.OnceValue(func() metric.Float64Histogram {
+	histogram, _ := otel.Meter(tracerName).Float64Histogram(DurationMetric,
+		metric.WithDescription("Duration of CLI commands and daemon operations"),
+		metric.WithUnit("s"))
+	return histogram
+})
+
+// ObserveGauge reports the value observe returns as a gauge each time
+// metrics are collected, such as the number of forks a daemon has
+// registered
+func ObserveGauge(name, description string, observe func() int64) error {
+	_, err := otel.Meter(tracerName).Int64ObservableGauge(name,
+		metric.WithDescription(description),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(observe())
+			return nil
+		}))
+	return err
+}
+
+// StartSpan starts an OpenTelemetry span as a child of any span in ctx and
+// returns a function that ends it, marking it failed when err is non-nil.
+// The worklet trace ID of a recorder in ctx is attached to the span, and
+// its duration is recorded in DurationMetric.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	if id := IDFromContext(ctx); id != "" {
+		attrs = append(attrs, attribute.String(IDAttribute, id))
+	}
+	start := time.Now()
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, oteltrace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		outcome := "ok"
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			outcome = "error"
+		}
+		span.End()
+		// Trace IDs and other per-span attributes would make every
+		// series unique, so only the operation and outcome are kept
+		durations().Record(context.Background(), time.Since(start).Seconds(), metric.WithAttributes(
+			attribute.String("operation", name),
+			attribute.String("outcome", outcome),
+		))
+	}
+}
+
+// TraceParent returns the W3C traceparent header for the span in ctx, or ""
+// if there is none, so a span can be continued in another process
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// WithTraceParent returns a context whose spans continue the trace described
+// by a traceparent header from TraceParent
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{"traceparent": traceParent}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
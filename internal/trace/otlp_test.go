@@ -0,0 +1,77 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSetupExportSendsSpansAndMetrics(t *testing.T) {
+	var spans, metrics atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/traces":
+			spans.Add(1)
+		case "/v1/metrics":
+			metrics.Add(1)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Token") != "secret" {
+			t.Errorf("missing configured header")
+		}
+	}))
+	defer collector.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+
+	shutdown, err := SetupExport(context.Background(), "worklet-test", "0.0.0", ExportConfig{
+		Endpoint: collector.URL,
+		Headers:  map[string]string{"X-Token": "secret"},
+	})
+	if err != nil {
+		t.Fatalf("SetupExport failed: %v", err)
+	}
+
+	ctx, end := StartSpan(context.Background(), "parent")
+	parent := TraceParent(ctx)
+	if parent == "" {
+		t.Fatal("expected a traceparent for a recording span")
+	}
+
+	// A span continued from the traceparent joins the same trace
+	_, child := StartSpan(WithTraceParent(context.Background(), parent), "child")
+	child(nil)
+	end(nil)
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if spans.Load() == 0 {
+		t.Error("expected spans to be exported")
+	}
+	if metrics.Load() == 0 {
+		t.Error("expected span durations to be exported as metrics")
+	}
+}
+
+func TestSetupExportDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", "")
+
+	if ExportEnabled(ExportConfig{}) {
+		t.Fatal("expected export to be disabled without an endpoint")
+	}
+	shutdown, err := SetupExport(context.Background(), "worklet-test", "0.0.0", ExportConfig{})
+	if err != nil {
+		t.Fatalf("SetupExport failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+}
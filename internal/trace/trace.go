@@ -0,0 +1,136 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Span records how long a single phase of an operation took
+type Span struct {
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Recorder collects the spans of one traced operation, such as a single
+// `worklet run`, under a shared trace ID
+type Recorder struct {
+	id     string
+	mu     sync.Mutex
+	spans  []Span
+	parent context.Context // Parent of exported spans, set by WithRecorder
+}
+
+type contextKey struct{}
+
+// New creates a recorder with a fresh trace ID, or the one in
+// WORKLET_TRACE_ID if set so callers can correlate across processes
+func New() *Recorder {
+	id := os.Getenv("WORKLET_TRACE_ID")
+	if id == "" {
+		id = uuid.New().String()[:16]
+	}
+	return &Recorder{id: id}
+}
+
+// Enabled reports whether phase timings should be printed
+func Enabled() bool {
+	return os.Getenv("WORKLET_TRACE") == "true"
+}
+
+// ID returns the trace ID
+func (r *Recorder) ID() string {
+	if r == nil {
+		return ""
+	}
+	return r.id
+}
+
+// Start begins a span and returns a function that ends it. The span is also
+// exported when SetupExport is configured.
+func (r *Recorder) Start(name string) func() {
+	if r == nil {
+		return func() {}
+	}
+	start := time.Now()
+
+	r.mu.Lock()
+	parent := r.parent
+	r.mu.Unlock()
+	if parent == nil {
+		parent = context.Background()
+	}
+	_, endExported := StartSpan(parent, name, attribute.String(IDAttribute, r.id))
+
+	return func() {
+		endExported(nil)
+		r.mu.Lock()
+		r.spans = append(r.spans, Span{
+			Name:     name,
+			Start:    start,
+			Duration: time.Since(start),
+		})
+		r.mu.Unlock()
+	}
+}
+
+// Spans returns a copy of the recorded spans in completion order
+func (r *Recorder) Spans() []Span {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	spans := make([]Span, len(r.spans))
+	copy(spans, r.spans)
+	return spans
+}
+
+// PrintSummary writes a phase breakdown of the trace
+func (r *Recorder) PrintSummary(w io.Writer) {
+	spans := r.Spans()
+	if len(spans) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "Trace %s:\n", r.id)
+	for _, span := range spans {
+		fmt.Fprintf(w, "  %-12s %v\n", span.Name, span.Duration.Round(time.Millisecond))
+	}
+}
+
+// WithRecorder returns a context carrying the recorder. Exported spans
+// started by the recorder become children of the span in ctx.
+func WithRecorder(ctx context.Context, r *Recorder) context.Context {
+	if r != nil {
+		r.mu.Lock()
+		if r.parent == nil {
+			r.parent = ctx
+		}
+		r.mu.Unlock()
+	}
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the recorder in ctx, or nil. All Recorder methods are
+// safe to call on nil.
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(contextKey{}).(*Recorder)
+	return r
+}
+
+// IDFromContext returns the trace ID carried by ctx, if any
+func IDFromContext(ctx context.Context) string {
+	return FromContext(ctx).ID()
+}
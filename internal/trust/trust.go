@@ -0,0 +1,225 @@
+// Package trust remembers which cloned repositories the user has allowed
+// to use credentials, privileged containers and host mounts, so they're
+// only asked once.
+package trust
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// Grant is something a session's config gives it access to beyond its own
+// sandbox, described for the user, e.g. "your SSH keys"
+type Grant string
+
+// Grants lists what cfg grants a session. Full isolation's Docker-in-Docker
+// container is worklet's default sandbox and isn't listed; host mounts only
+// apply in mount mode.
+func Grants(cfg *config.WorkletConfig, mountMode bool) []Grant {
+	var grants []Grant
+	if creds := cfg.Run.Credentials; creds != nil {
+		if creds.Claude {
+			grants = append(grants, "your Claude credentials (credentials.claude)")
+		}
+		if creds.SSH {
+			grants = append(grants, "your SSH keys (credentials.ssh)")
+		}
+		if creds.AWS {
+			grants = append(grants, "your AWS credentials (credentials.aws)")
+		}
+		if creds.GCP {
+			grants = append(grants, "your Google Cloud credentials (credentials.gcp)")
+		}
+		if creds.Azure {
+			grants = append(grants, "your Azure login (credentials.azure)")
+		}
+		if creds.Kubeconfig {
+			grants = append(grants, "your Kubernetes contexts (credentials.kubeconfig)")
+		}
+		if creds.DockerAuth {
+			grants = append(grants, "your container registry logins (credentials.dockerAuth)")
+		}
+	}
+	if cfg.Run.Isolation == "shared" {
+		grants = append(grants, `the host's Docker daemon, which can control the host ("isolation": "shared")`)
+		if cfg.Run.Privileged {
+			grants = append(grants, `a privileged container ("privileged": true)`)
+		}
+	}
+	if cfg.Run.Display != "" {
+		grants = append(grants, Grant(fmt.Sprintf("your display, which can see and control your screen (display: %s)", cfg.Run.Display)))
+	}
+	if len(cfg.Run.GPUs) > 0 {
+		grants = append(grants, Grant(fmt.Sprintf("host GPUs %s (gpus)", strings.Join(cfg.Run.GPUs, ", "))))
+	}
+	for _, device := range cfg.Run.Devices {
+		grants = append(grants, Grant(fmt.Sprintf("host device %s (devices)", device.Path)))
+		if device.CgroupRule != "" {
+			grants = append(grants, Grant(fmt.Sprintf("host devices matching %q that appear under %s (devices cgroupRule)", device.CgroupRule, device.Path)))
+		}
+	}
+	for _, volume := range cfg.Run.Volumes {
+		// None of the configured volumes is created for the session alone,
+		// so a named one may hold what other sessions or worklet itself
+		// keep there, such as credentials or a sandbox's Docker data
+		switch source := config.VolumeSource(volume); {
+		case source == "":
+		case config.IsHostPathSource(source):
+			grants = append(grants, Grant(fmt.Sprintf("host path %s (volumes: %s)", source, volume)))
+		case strings.HasPrefix(source, "worklet-"):
+			grants = append(grants, Grant(fmt.Sprintf("worklet's volume %s, which can hold credentials or other sessions' data (volumes: %s)", source, volume)))
+		default:
+			grants = append(grants, Grant(fmt.Sprintf("named volume %s, shared with other sessions (volumes: %s)", source, volume)))
+		}
+	}
+	if mountMode {
+		for _, mount := range cfg.Run.Mounts {
+			access := "read-write"
+			if mount.ReadOnly {
+				access = "read-only"
+			}
+			grants = append(grants, Grant(fmt.Sprintf("host path %s, %s (mounts)", mount.Source, access)))
+		}
+	}
+	return grants
+}
+
+// ExtendsGrant is the grant to read a base config a cloned repository's
+// config extends from outside the repository, which can add to what the
+// config grants
+func ExtendsGrant(source string) Grant {
+	return Grant(fmt.Sprintf("base config %s (extends)", source))
+}
+
+// Approval records the grants the user allowed a repository
+type Approval struct {
+	Grants     []Grant   `json:"grants"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
+
+// Store keeps approvals keyed by repository in a single JSON file
+type Store struct {
+	path string
+}
+
+// New returns the store at ~/.worklet/trust.json
+func New() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return NewAt(filepath.Join(homeDir, ".worklet", "trust.json")), nil
+}
+
+// NewAt returns a store backed by the file at path
+func NewAt(path string) *Store {
+	return &Store{path: path}
+}
+
+// RepoKey normalizes a repository URL, so that the forms of one repository
+// share an approval
+func RepoKey(url string) string {
+	key := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(url), "/"), ".git")
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://"} {
+		key = strings.TrimPrefix(key, prefix)
+	}
+	if user, rest, ok := strings.Cut(key, "@"); ok && !strings.Contains(user, "/") {
+		key = rest
+	}
+	// git@host:owner/repo
+	if host, path, ok := strings.Cut(key, ":"); ok && !strings.Contains(host, "/") {
+		if _, err := fmt.Sscanf(path, "%d", new(int)); err != nil {
+			key = host + "/" + path
+		}
+	}
+	return strings.ToLower(key)
+}
+
+// All returns every approval keyed by repository
+func (s *Store) All() (map[string]Approval, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]Approval{}, nil
+		}
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+
+	approvals := make(map[string]Approval)
+	if err := json.Unmarshal(data, &approvals); err != nil {
+		return nil, fmt.Errorf("failed to parse trust store: %w", err)
+	}
+	return approvals, nil
+}
+
+// Unapproved returns the grants the user hasn't allowed repo
+func (s *Store) Unapproved(repo string, grants []Grant) ([]Grant, error) {
+	approvals, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	approved := approvals[RepoKey(repo)].Grants
+	var missing []Grant
+	for _, grant := range grants {
+		if !slices.Contains(approved, grant) {
+			missing = append(missing, grant)
+		}
+	}
+	return missing, nil
+}
+
+// Approve records that the user allowed repo grants, adding to what it was
+// allowed before
+func (s *Store) Approve(repo string, grants []Grant) error {
+	key := RepoKey(repo)
+	return s.update(func(approvals map[string]Approval) {
+		approval := approvals[key]
+		for _, grant := range grants {
+			if !slices.Contains(approval.Grants, grant) {
+				approval.Grants = append(approval.Grants, grant)
+			}
+		}
+		approval.ApprovedAt = time.Now()
+		approvals[key] = approval
+	})
+}
+
+// Revoke forgets what repo was allowed. It reports whether it had any
+// approval.
+func (s *Store) Revoke(repo string) (bool, error) {
+	key := RepoKey(repo)
+	found := false
+	err := s.update(func(approvals map[string]Approval) {
+		_, found = approvals[key]
+		delete(approvals, key)
+	})
+	return found, err
+}
+
+// update applies fn to the approvals while holding the store's lock
+func (s *Store) update(fn func(map[string]Approval)) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create worklet directory: %w", err)
+	}
+	return storage.WithLock(s.path, func() error {
+		approvals, err := s.All()
+		if err != nil {
+			return err
+		}
+		fn(approvals)
+
+		data, err := json.MarshalIndent(approvals, "", "  ")
+		if err != nil {
+			return err
+		}
+		return storage.WriteFileAtomic(s.path, data, 0600)
+	})
+}
@@ -0,0 +1,103 @@
+package trust
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+func TestGrants(t *testing.T) {
+	cfg := &config.WorkletConfig{Run: config.RunConfig{
+		Credentials: &config.CredentialConfig{SSH: true},
+		Isolation:   "shared",
+		Privileged:  true,
+		Volumes:     []string{"/etc:/host-etc", "cache:/cache"},
+		Mounts:      []config.MountConfig{{Source: "~/data", Target: "/data", ReadOnly: true}},
+	}}
+
+	if grants := Grants(cfg, false); len(grants) != 5 {
+		t.Errorf("Grants() = %q, want SSH, Docker socket, privileged, /etc and the cache volume", grants)
+	}
+	if grants := Grants(cfg, true); len(grants) != 6 {
+		t.Errorf("Grants() in mount mode = %q, want the mount too", grants)
+	}
+	if grants := Grants(&config.WorkletConfig{Run: config.RunConfig{Display: config.DisplayAuto}}, false); len(grants) != 1 {
+		t.Errorf("Grants() = %q, want the display", grants)
+	}
+	devices := &config.WorkletConfig{Run: config.RunConfig{Devices: []config.DeviceConfig{
+		{Path: "/dev/ttyUSB0"},
+		{Path: "/dev/bus/usb", CgroupRule: "c 189:* rwm"},
+	}}}
+	if grants := Grants(devices, false); len(grants) != 3 {
+		t.Errorf("Grants() = %q, want both devices and the cgroup rule", grants)
+	}
+	volumes := &config.WorkletConfig{Run: config.RunConfig{Volumes: []string{
+		"worklet-claude-credentials:/x",
+		`C:\Users\me:/home`,
+		"/anonymous",
+	}}}
+	grants := Grants(volumes, false)
+	if len(grants) != 2 || !strings.Contains(string(grants[0]), "worklet-claude-credentials") || !strings.Contains(string(grants[1]), `host path C:\Users\me`) {
+		t.Errorf("Grants() = %q, want worklet's volume and the drive path", grants)
+	}
+	if grants := Grants(&config.WorkletConfig{Run: config.RunConfig{GPUs: config.GPUList{"all"}}}, false); len(grants) != 1 {
+		t.Errorf("Grants() = %q, want the GPUs", grants)
+	}
+	if grants := Grants(&config.WorkletConfig{Run: config.RunConfig{Privileged: true}}, true); len(grants) != 0 {
+		t.Errorf("Grants() = %q for the default sandbox, want none", grants)
+	}
+}
+
+func TestRepoKey(t *testing.T) {
+	want := "github.com/acme/shop"
+	for _, url := range []string{
+		"https://github.com/acme/shop",
+		"https://github.com/Acme/shop.git",
+		"git@github.com:acme/shop.git",
+		"ssh://git@github.com/acme/shop",
+		"github.com/acme/shop/",
+	} {
+		if key := RepoKey(url); key != want {
+			t.Errorf("RepoKey(%q) = %q, want %q", url, key, want)
+		}
+	}
+	if key := RepoKey("ssh://git@git.corp:2222/team/app.git"); key != "git.corp:2222/team/app" {
+		t.Errorf("RepoKey() = %q, want the port kept", key)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "worklet-trust-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store := NewAt(filepath.Join(dir, "trust.json"))
+
+	grants := []Grant{"your SSH keys (credentials.ssh)"}
+	if missing, err := store.Unapproved("https://github.com/acme/shop", grants); err != nil || len(missing) != 1 {
+		t.Fatalf("Unapproved() = %q, %v before approval", missing, err)
+	}
+	if err := store.Approve("https://github.com/acme/shop", grants); err != nil {
+		t.Fatal(err)
+	}
+	if missing, _ := store.Unapproved("git@github.com:acme/shop.git", grants); len(missing) != 0 {
+		t.Errorf("Unapproved() = %q after approval", missing)
+	}
+
+	// Asking for more needs approval again, for just what's new
+	more := append(grants, "host path /etc (volumes: /etc:/etc)")
+	if missing, _ := store.Unapproved("https://github.com/acme/shop", more); len(missing) != 1 || missing[0] != more[1] {
+		t.Errorf("Unapproved() = %q, want only the new grant", missing)
+	}
+
+	if found, err := store.Revoke("github.com/acme/shop"); err != nil || !found {
+		t.Fatalf("Revoke() = %v, %v", found, err)
+	}
+	if missing, _ := store.Unapproved("https://github.com/acme/shop", grants); len(missing) != 1 {
+		t.Errorf("Unapproved() = %q after revoking", missing)
+	}
+}
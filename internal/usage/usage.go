@@ -0,0 +1,308 @@
+// Package usage collects anonymous usage statistics for users who opt in:
+// which commands run, how long they take and what category of failure they
+// end in. Arguments, paths, names and error messages are never recorded.
+// Events are queued locally and sent in batches.
+package usage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+const (
+	// EndpointEnv names the URL batches of events are sent to. There is no
+	// default: worklet doesn't run a collector, so nothing is recorded or
+	// sent until one is configured.
+	EndpointEnv = "WORKLET_TELEMETRY_ENDPOINT"
+
+	// FlushBatch is how many queued events trigger a flush
+	FlushBatch = 20
+
+	// FlushInterval is how old the oldest queued event gets before a flush
+	FlushInterval = 24 * time.Hour
+
+	// MaxQueued is how many events are kept while they can't be sent; older
+	// ones are dropped
+	MaxQueued = 500
+)
+
+// Settings is the user's choice about usage statistics
+type Settings struct {
+	Enabled   bool      `json:"enabled"`
+	InstallID string    `json:"install_id,omitempty"` // Random, regenerated each time statistics are turned on
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Event is a single command run
+type Event struct {
+	InstallID  string    `json:"install_id"`
+	Command    string    `json:"command"` // Command path, e.g. "worklet run"
+	Outcome    string    `json:"outcome"` // "ok" or a failure category
+	DurationMS int64     `json:"duration_ms"`
+	Version    string    `json:"version"`
+	OS         string    `json:"os"`
+	Arch       string    `json:"arch"`
+	Time       time.Time `json:"time"` // Truncated to the hour
+}
+
+// Store keeps the settings and the event queue in a directory
+type Store struct {
+	dir string
+}
+
+// New returns the store in ~/.worklet/usage
+func New() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return NewAt(filepath.Join(homeDir, ".worklet", "usage")), nil
+}
+
+// NewAt returns a store backed by dir
+func NewAt(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) settingsPath() string { return filepath.Join(s.dir, "settings.json") }
+func (s *Store) queuePath() string    { return filepath.Join(s.dir, "queue.jsonl") }
+
+// DisabledByEnv reports whether the environment turns statistics off
+// regardless of the settings, via DO_NOT_TRACK or WORKLET_TELEMETRY=off
+func DisabledByEnv() bool {
+	if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+		return true
+	}
+	switch strings.ToLower(os.Getenv("WORKLET_TELEMETRY")) {
+	case "0", "off", "false", "no":
+		return true
+	}
+	return false
+}
+
+// Endpoint returns the URL events are sent to, or "" if none is configured
+func Endpoint() string {
+	return os.Getenv(EndpointEnv)
+}
+
+// Settings returns the user's choice. Statistics are off until turned on.
+func (s *Store) Settings() (Settings, error) {
+	data, err := os.ReadFile(s.settingsPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Settings{}, nil
+		}
+		return Settings{}, fmt.Errorf("failed to read usage settings: %w", err)
+	}
+
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return Settings{}, fmt.Errorf("failed to parse usage settings: %w", err)
+	}
+	return settings, nil
+}
+
+// Enabled reports whether events are recorded
+func (s *Store) Enabled() bool {
+	if DisabledByEnv() {
+		return false
+	}
+	settings, err := s.Settings()
+	return err == nil && settings.Enabled && settings.InstallID != ""
+}
+
+// SetEnabled turns statistics on or off. Turning them on picks a new install
+// ID; turning them off forgets it and drops every queued event.
+func (s *Store) SetEnabled(enabled bool) (Settings, error) {
+	settings := Settings{Enabled: enabled, UpdatedAt: time.Now()}
+	if enabled {
+		settings.InstallID = uuid.New().String()
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return Settings{}, err
+	}
+	err = storage.WithLock(s.queuePath(), func() error {
+		if err := storage.WriteFileAtomic(s.settingsPath(), data, 0644); err != nil {
+			return fmt.Errorf("failed to save usage settings: %w", err)
+		}
+		if !enabled {
+			if err := os.Remove(s.queuePath()); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove queued usage events: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Settings{}, err
+	}
+	return settings, nil
+}
+
+// Record queues an event if statistics are on. The install ID and time are
+// filled in.
+func (s *Store) Record(event Event) error {
+	if DisabledByEnv() {
+		return nil
+	}
+	settings, err := s.Settings()
+	if err != nil || !settings.Enabled || settings.InstallID == "" {
+		return err
+	}
+	event.InstallID = settings.InstallID
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC().Truncate(time.Hour)
+
+	return storage.WithLock(s.queuePath(), func() error {
+		events, err := s.readQueue()
+		if err != nil {
+			return err
+		}
+		events = append(events, event)
+		if len(events) > MaxQueued {
+			events = events[len(events)-MaxQueued:]
+		}
+		return s.writeQueue(events)
+	})
+}
+
+// Pending returns the queued events, oldest first
+func (s *Store) Pending() ([]Event, error) {
+	return s.readQueue()
+}
+
+// Due reports whether the queue should be flushed
+func (s *Store) Due(now time.Time) bool {
+	events, err := s.readQueue()
+	if err != nil || len(events) == 0 {
+		return false
+	}
+	return len(events) >= FlushBatch || now.Sub(events[0].Time) >= FlushInterval
+}
+
+// Flush sends the queued events to endpoint as a JSON array and removes them
+// from the queue once accepted. It returns how many were sent.
+func (s *Store) Flush(ctx context.Context, client *http.Client, endpoint string) (int, error) {
+	if endpoint == "" {
+		return 0, fmt.Errorf("no usage endpoint configured; set %s", EndpointEnv)
+	}
+	var sent int
+	err := storage.WithLock(s.queuePath(), func() error {
+		events, err := s.readQueue()
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		body, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create usage request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to send usage events: %w", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("failed to send usage events: %s", resp.Status)
+		}
+
+		sent = len(events)
+		if err := os.Remove(s.queuePath()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to clear usage queue: %w", err)
+		}
+		return nil
+	})
+	return sent, err
+}
+
+func (s *Store) readQueue() ([]Event, error) {
+	file, err := os.Open(s.queuePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read usage queue: %w", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// Skip a line corrupted by a crash mid-write
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+func (s *Store) writeQueue(events []Event) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+	if err := storage.WriteFileAtomic(s.queuePath(), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write usage queue: %w", err)
+	}
+	return nil
+}
+
+// Categorize reduces a command's error to a coarse category, so no detail
+// of the user's environment leaves the machine
+func Categorize(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "canceled"
+	}
+
+	msg := strings.ToLower(err.Error())
+	categories := []struct {
+		category string
+		keywords []string
+	}{
+		{"usage", []string{"unknown command", "unknown flag", "unknown shorthand flag", "accepts ", "requires at least", "invalid argument", "required flag"}},
+		{"daemon", []string{"daemon"}},
+		{"docker", []string{"docker", "container", "compose"}},
+		{"config", []string{"config", ".worklet.json"}},
+		{"git", []string{"git", "clone", "worktree", "branch"}},
+		{"network", []string{"connection refused", "timeout", "no such host", "dial "}},
+		{"not_found", []string{"not found", "no such", "does not exist"}},
+		{"permission", []string{"permission denied"}},
+	}
+	for _, c := range categories {
+		for _, keyword := range c.keywords {
+			if strings.Contains(msg, keyword) {
+				return c.category
+			}
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Setenv("DO_NOT_TRACK", "")
+	t.Setenv("WORKLET_TELEMETRY", "")
+
+	dir, err := os.MkdirTemp("", "usage-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return NewAt(dir)
+}
+
+func TestRecordRequiresOptIn(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.Record(Event{Command: "worklet run", Outcome: "ok"}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if events, _ := store.Pending(); len(events) != 0 {
+		t.Fatalf("recorded %d events before opting in", len(events))
+	}
+
+	settings, err := store.SetEnabled(true)
+	if err != nil {
+		t.Fatalf("SetEnabled failed: %v", err)
+	}
+	if settings.InstallID == "" {
+		t.Fatal("opting in didn't pick an install ID")
+	}
+
+	started := time.Date(2025, 3, 1, 14, 35, 12, 0, time.UTC)
+	if err := store.Record(Event{Command: "worklet run", Outcome: "ok", Time: started}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	events, err := store.Pending()
+	if err != nil {
+		t.Fatalf("Pending failed: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if events[0].InstallID != settings.InstallID {
+		t.Errorf("InstallID = %q, want %q", events[0].InstallID, settings.InstallID)
+	}
+	if want := started.Truncate(time.Hour); !events[0].Time.Equal(want) {
+		t.Errorf("Time = %v, want %v", events[0].Time, want)
+	}
+
+	t.Setenv("DO_NOT_TRACK", "1")
+	store.Record(Event{Command: "worklet run", Outcome: "ok"})
+	if events, _ := store.Pending(); len(events) != 1 {
+		t.Errorf("recorded an event with DO_NOT_TRACK set")
+	}
+	t.Setenv("DO_NOT_TRACK", "")
+
+	if _, err := store.SetEnabled(false); err != nil {
+		t.Fatalf("SetEnabled failed: %v", err)
+	}
+	if events, _ := store.Pending(); len(events) != 0 {
+		t.Errorf("opting out kept %d queued events", len(events))
+	}
+}
+
+func TestFlush(t *testing.T) {
+	store := newTestStore(t)
+	store.SetEnabled(true)
+	for i := 0; i < FlushBatch; i++ {
+		store.Record(Event{Command: "worklet forks", Outcome: "ok"})
+	}
+	if !store.Due(time.Now()) {
+		t.Fatal("a full batch should be due")
+	}
+
+	var received []Event
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	if _, err := store.Flush(context.Background(), server.Client(), ""); err == nil {
+		t.Fatal("Flush should fail without an endpoint")
+	}
+	if _, err := store.Flush(context.Background(), server.Client(), server.URL); err == nil {
+		t.Fatal("Flush should fail when the endpoint does")
+	}
+	if events, _ := store.Pending(); len(events) != FlushBatch {
+		t.Fatalf("a failed flush left %d events, want %d", len(events), FlushBatch)
+	}
+
+	fail = false
+	sent, err := store.Flush(context.Background(), server.Client(), server.URL)
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if sent != FlushBatch || len(received) != FlushBatch {
+		t.Errorf("sent %d and received %d events, want %d", sent, len(received), FlushBatch)
+	}
+	if events, _ := store.Pending(); len(events) != 0 {
+		t.Errorf("%d events left after flushing", len(events))
+	}
+}
+
+func TestCategorize(t *testing.T) {
+	tests := map[error]string{
+		nil:                                 "ok",
+		context.Canceled:                    "canceled",
+		errors.New(`unknown flag: --foo`):   "usage",
+		errors.New("daemon is not running"): "daemon",
+		fmt.Errorf("failed to start container: %w", errors.New("boom")): "docker",
+		errors.New("failed to clone repository"):                        "git",
+		errors.New("/home/me/secret: permission denied"):                "permission",
+		errors.New("something odd"):                                     "other",
+	}
+	for err, want := range tests {
+		if got := Categorize(err); got != want {
+			t.Errorf("Categorize(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package worktrees
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// manifest records the content of a worktree when it was created, so
+// changes can be detected without git
+type manifest struct {
+	Files map[string]manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+// manifestPath returns where the manifest for the worktree at path is kept,
+// next to the worktree rather than inside it so it never shows up as an
+// untracked file
+func manifestPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".manifest.json")
+}
+
+// WriteManifest records a content hash of every file in the worktree at
+// path for HasChanges to compare against later
+func WriteManifest(path string) error {
+	m := manifest{Files: make(map[string]manifestEntry)}
+	err := walkFiles(path, func(relPath, fullPath string, info os.FileInfo) error {
+		sum, err := hashFile(fullPath)
+		if err != nil {
+			return err
+		}
+		m.Files[relPath] = manifestEntry{Size: info.Size(), ModTime: info.ModTime(), SHA256: sum}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to hash worktree: %w", err)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return storage.WriteFileAtomic(manifestPath(path), data, 0644)
+}
+
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(manifestPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// errChanged stops the walk at the first difference
+var errChanged = fmt.Errorf("changed")
+
+// changed compares the worktree at path with the manifest. Files whose size
+// and modification time match are assumed unchanged; the rest are hashed.
+func (m *manifest) changed(path string) (bool, error) {
+	seen := 0
+	err := walkFiles(path, func(relPath, fullPath string, info os.FileInfo) error {
+		entry, ok := m.Files[relPath]
+		if !ok || entry.Size != info.Size() {
+			return errChanged
+		}
+		seen++
+		if entry.ModTime.Equal(info.ModTime()) {
+			return nil
+		}
+		sum, err := hashFile(fullPath)
+		if err != nil {
+			return err
+		}
+		if sum != entry.SHA256 {
+			return errChanged
+		}
+		return nil
+	})
+	if err == errChanged {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Anything left over was deleted
+	return seen != len(m.Files), nil
+}
+
+// walkFiles calls fn for each regular file and symlink under root, skipping
+// the .git file
+func walkFiles(root string, fn func(relPath, fullPath string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(fullPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, fullPath)
+		if err != nil {
+			return err
+		}
+		if relPath == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		return fn(filepath.ToSlash(relPath), fullPath, info)
+	})
+}
+
+// hashFile returns the hex SHA-256 of a file, or of the link target for
+// symlinks
+func hashFile(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		hash.Write([]byte(target))
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(hash, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,281 @@
+// Package worktrees manages the git worktrees that worklet creates for
+// branch sessions under ~/.worklet/worktrees.
+package worktrees
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lockReason is recorded with `git worktree lock` when a worktree is pinned
+const lockReason = "pinned by worklet"
+
+// Store is the directory holding managed worktrees, laid out as
+// <repo>-<hash>/<branch>
+type Store struct {
+	dir string
+}
+
+// Worktree describes a single managed worktree
+type Worktree struct {
+	Path     string
+	Repo     string // <repo>-<hash> directory name
+	Branch   string // Branch directory name: the sanitized branch and its hash
+	Size     int64
+	LastUsed time.Time // Newest modification time of any file
+	Pinned   bool      // Locked with `git worktree lock`
+}
+
+// Policy limits which worktrees are kept. Zero values disable a limit.
+type Policy struct {
+	MaxCount int
+	MaxSize  int64
+	MaxAge   time.Duration
+}
+
+// New returns the store under ~/.worklet/worktrees
+func New() (*Store, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return NewAt(filepath.Join(homeDir, ".worklet", "worktrees")), nil
+}
+
+// NewAt returns a store rooted at dir
+func NewAt(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the store directory
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// List returns all managed worktrees, most recently used first
+func (s *Store) List() ([]Worktree, error) {
+	worktrees, err := s.Names()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range worktrees {
+		worktree := &worktrees[i]
+		worktree.Size, worktree.LastUsed = usage(worktree.Path)
+		if gitDir, err := linkedGitDir(worktree.Path); err == nil {
+			_, err := os.Stat(filepath.Join(gitDir, "locked"))
+			worktree.Pinned = err == nil
+		}
+	}
+
+	sort.Slice(worktrees, func(i, j int) bool {
+		return worktrees[i].LastUsed.After(worktrees[j].LastUsed)
+	})
+
+	return worktrees, nil
+}
+
+// Names returns all managed worktrees with only their path, repo and
+// branch set. Unlike List it doesn't walk the worktrees, so it's fast.
+func (s *Store) Names() ([]Worktree, error) {
+	dotGits, err := filepath.Glob(filepath.Join(s.dir, "*", "*", ".git"))
+	if err != nil {
+		return nil, err
+	}
+
+	var worktrees []Worktree
+	for _, dotGit := range dotGits {
+		path := filepath.Dir(dotGit)
+		worktrees = append(worktrees, Worktree{
+			Path:   path,
+			Repo:   filepath.Base(filepath.Dir(path)),
+			Branch: filepath.Base(path),
+		})
+	}
+	return worktrees, nil
+}
+
+// Select returns the worktrees policy would remove, oldest first. Worktrees
+// are expired by age, then the least recently used are evicted until the
+// count and total size fit. Pinned worktrees count towards the limits but
+// are never selected, and neither are ones keep returns true for, such as
+// worktrees in use; older worktrees are evicted in their place. keep is only
+// asked about worktrees that would otherwise be selected, and may be nil.
+// worktrees must be sorted most recently used first, as returned by List.
+func Select(worktrees []Worktree, policy Policy, now time.Time, keep func(Worktree) bool) []Worktree {
+	count := len(worktrees)
+	var total int64
+	for _, worktree := range worktrees {
+		total += worktree.Size
+	}
+
+	var selected []Worktree
+	for i := len(worktrees) - 1; i >= 0; i-- {
+		worktree := worktrees[i]
+		if worktree.Pinned {
+			continue
+		}
+
+		expired := policy.MaxAge > 0 && now.Sub(worktree.LastUsed) > policy.MaxAge
+		tooMany := policy.MaxCount > 0 && count > policy.MaxCount
+		oversized := policy.MaxSize > 0 && total > policy.MaxSize
+		if !expired && !tooMany && !oversized {
+			continue
+		}
+		if keep != nil && keep(worktree) {
+			continue
+		}
+
+		selected = append(selected, worktree)
+		count--
+		total -= worktree.Size
+	}
+
+	return selected
+}
+
+// Remove deletes a linked worktree and its registration in the main
+// repository with git. Anything else, a main repository included, is
+// refused. Only a worktree in the store whose main repository is gone is
+// deleted without git, which can no longer remove it.
+func (s *Store) Remove(worktree Worktree) error {
+	gitDir, err := linkedGitDir(worktree.Path)
+	if err != nil {
+		return fmt.Errorf("not removing %s: %w", worktree.Path, err)
+	}
+
+	if _, err := os.Stat(gitDir); os.IsNotExist(err) && s.contains(worktree.Path) {
+		if err := os.RemoveAll(worktree.Path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", worktree.Path, err)
+		}
+		s.removeEmptyRepoDir(worktree.Path)
+		return nil
+	}
+
+	commonDir := filepath.Dir(filepath.Dir(gitDir))
+	cmd := exec.Command("git", "--git-dir", commonDir, "worktree", "remove", "--force", worktree.Path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git worktree remove failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	if s.contains(worktree.Path) {
+		s.removeEmptyRepoDir(worktree.Path)
+	}
+	return nil
+}
+
+// CheckLinked returns an error unless path is a linked worktree, one that
+// Remove would remove with git
+func CheckLinked(path string) error {
+	_, err := linkedGitDir(path)
+	return err
+}
+
+// contains reports whether path is a worktree in the store, at
+// <repo>-<hash>/<branch>
+func (s *Store) contains(path string) bool {
+	return filepath.Dir(filepath.Dir(filepath.Clean(path))) == filepath.Clean(s.dir)
+}
+
+// removeEmptyRepoDir removes the worktree's manifest, then the
+// <repo>-<hash> directory once its last worktree is gone
+func (s *Store) removeEmptyRepoDir(path string) {
+	os.Remove(manifestPath(path))
+	os.Remove(filepath.Dir(path))
+}
+
+// SetPinned locks or unlocks a worktree so Select never picks it
+func SetPinned(path string, pinned bool) error {
+	args := []string{"worktree", "unlock", path}
+	if pinned {
+		args = []string{"worktree", "lock", "--reason", lockReason, path}
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = path
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s failed: %s", strings.Join(args[:2], " "), strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// HasChanges reports whether a worktree has uncommitted or untracked
+// changes. It asks git first and falls back to the manifest written by
+// WriteManifest when git can't read the worktree, for example because the
+// main repository was moved or deleted.
+func HasChanges(path string) (bool, error) {
+	cmd := exec.Command("git", "status", "--porcelain")
+	cmd.Dir = path
+	if output, err := cmd.Output(); err == nil {
+		return len(bytes.TrimSpace(output)) > 0, nil
+	}
+
+	manifest, err := readManifest(path)
+	if err != nil {
+		return false, fmt.Errorf("cannot check %s for changes: git status failed and no manifest is available", path)
+	}
+	return manifest.changed(path)
+}
+
+// linkedGitDir returns the git directory a worktree's .git file points to,
+// <common dir>/worktrees/<name>
+func linkedGitDir(path string) (string, error) {
+	dotGit := filepath.Join(path, ".git")
+	info, err := os.Lstat(dotGit)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s is not a git worktree", path)
+		}
+		return "", err
+	}
+	// A main repository has a .git directory instead
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a linked worktree", path)
+	}
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s is not a linked worktree", path)
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(path, gitDir)
+	}
+	gitDir = filepath.Clean(gitDir)
+	// Linked worktrees are registered in <main repository>/worktrees/<name>
+	if filepath.Base(filepath.Dir(gitDir)) != "worktrees" {
+		return "", fmt.Errorf("%s is not a linked worktree: its gitdir %s isn't in a repository's worktrees", path, gitDir)
+	}
+	return gitDir, nil
+}
+
+// usage returns the total size and newest modification time of the files
+// under dir
+func usage(dir string) (int64, time.Time) {
+	var size int64
+	var newest time.Time
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return nil
+	})
+	return size, newest
+}
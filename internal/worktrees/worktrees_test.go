@@ -0,0 +1,233 @@
+package worktrees
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelect(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	// Most recently used first, as List returns them
+	list := []Worktree{
+		{Path: "a", Size: 100, LastUsed: now.Add(-1 * day)},
+		{Path: "b", Size: 100, LastUsed: now.Add(-2 * day), Pinned: true},
+		{Path: "c", Size: 100, LastUsed: now.Add(-3 * day)},
+		{Path: "d", Size: 100, LastUsed: now.Add(-40 * day)},
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		expected []string
+	}{
+		{"no limits", Policy{}, nil},
+		{"max age", Policy{MaxAge: 30 * day}, []string{"d"}},
+		{"max count", Policy{MaxCount: 2}, []string{"d", "c"}},
+		{"max size", Policy{MaxSize: 250}, []string{"d", "c"}},
+		{"pinned never selected", Policy{MaxCount: 1}, []string{"d", "c", "a"}},
+	}
+
+	for _, tt := range tests {
+		selected := Select(list, tt.policy, now, nil)
+		var paths []string
+		for _, worktree := range selected {
+			paths = append(paths, worktree.Path)
+		}
+		if len(paths) != len(tt.expected) {
+			t.Errorf("%s: got %v, want %v", tt.name, paths, tt.expected)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != tt.expected[i] {
+				t.Errorf("%s: got %v, want %v", tt.name, paths, tt.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestSelectKeep(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	var list []Worktree
+	for i := 0; i < 12; i++ {
+		list = append(list, Worktree{Path: fmt.Sprint(i), Size: 100, LastUsed: now.Add(-time.Duration(i) * day)})
+	}
+
+	// The oldest is in use, so the two next oldest go in its place
+	asked := 0
+	keep := func(worktree Worktree) bool {
+		asked++
+		return worktree.Path == "11"
+	}
+	selected := Select(list, Policy{MaxCount: 10}, now, keep)
+	var paths []string
+	for _, worktree := range selected {
+		paths = append(paths, worktree.Path)
+	}
+	if len(paths) != 2 || paths[0] != "10" || paths[1] != "9" {
+		t.Errorf("Select() = %v, want [10 9]", paths)
+	}
+	if asked != 3 {
+		t.Errorf("keep asked about %d worktrees, want only the 3 candidates", asked)
+	}
+}
+
+func TestListPinAndRemove(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "worktrees-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoDir := filepath.Join(tmpDir, "repo")
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	git(repoDir, "init", "-q")
+	git(repoDir, "commit", "-q", "--allow-empty", "-m", "initial")
+
+	store := NewAt(filepath.Join(tmpDir, "worktrees"))
+	for _, branch := range []string{"one", "two"} {
+		git(repoDir, "worktree", "add", "-q", "-b", branch, filepath.Join(store.Dir(), "repo-1234", branch))
+	}
+
+	if err := SetPinned(filepath.Join(store.Dir(), "repo-1234", "one"), true); err != nil {
+		t.Fatalf("SetPinned failed: %v", err)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 worktrees, got %d", len(list))
+	}
+	for _, worktree := range list {
+		if worktree.Repo != "repo-1234" {
+			t.Errorf("Expected repo-1234, got %s", worktree.Repo)
+		}
+		if worktree.Pinned != (worktree.Branch == "one") {
+			t.Errorf("%s: unexpected pinned state %v", worktree.Branch, worktree.Pinned)
+		}
+	}
+
+	selected := Select(list, Policy{MaxCount: 1}, time.Now(), nil)
+	if len(selected) != 1 || selected[0].Branch != "two" {
+		t.Fatalf("Expected only the unpinned worktree to be selected, got %v", selected)
+	}
+	if err := store.Remove(selected[0]); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := os.Stat(selected[0].Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed", selected[0].Path)
+	}
+
+	// The main repository no longer lists the removed worktree
+	output, err := exec.Command("git", "-C", repoDir, "worktree", "list").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), selected[0].Path) {
+		t.Errorf("Expected worktree to be unregistered, got:\n%s", output)
+	}
+
+	// The main repository and plain directories aren't linked worktrees
+	plainDir := filepath.Join(tmpDir, "plain")
+	if err := os.MkdirAll(plainDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(plainDir, ".git"), []byte("gitdir: "+filepath.Join(repoDir, ".git")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{repoDir, plainDir, tmpDir} {
+		if err := store.Remove(Worktree{Path: path}); err == nil {
+			t.Errorf("Remove(%s) succeeded, want it refused", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected %s to be kept: %v", path, err)
+		}
+	}
+}
+
+func TestHasChangesFallsBackToManifest(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "worktrees-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A worktree whose main repository is gone, so git status fails
+	path := filepath.Join(tmpDir, "repo-1234", "feat")
+	files := map[string]string{
+		".git":        "gitdir: /nonexistent/.git/worktrees/feat\n",
+		"main.go":     "package main",
+		"lib/util.go": "package lib",
+	}
+	for name, content := range files {
+		fullPath := filepath.Join(path, name)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := HasChanges(path); err == nil {
+		t.Error("Expected an error without git or a manifest")
+	}
+
+	if err := WriteManifest(path); err != nil {
+		t.Fatalf("WriteManifest failed: %v", err)
+	}
+	if changed, err := HasChanges(path); err != nil || changed {
+		t.Fatalf("Expected no changes, got %v, %v", changed, err)
+	}
+
+	// Same size, new content and mtime
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(path, "main.go"), []byte("package mian"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(path, "main.go"), later, later)
+	if changed, err := HasChanges(path); err != nil || !changed {
+		t.Errorf("Expected modified file to be detected, got %v, %v", changed, err)
+	}
+
+	// Restoring the content counts as unchanged even with a new mtime
+	if err := os.WriteFile(filepath.Join(path, "main.go"), []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := HasChanges(path); err != nil || changed {
+		t.Errorf("Expected restored file to be unchanged, got %v, %v", changed, err)
+	}
+
+	if err := os.Remove(filepath.Join(path, "lib", "util.go")); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := HasChanges(path); err != nil || !changed {
+		t.Errorf("Expected deleted file to be detected, got %v, %v", changed, err)
+	}
+}
@@ -0,0 +1,178 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/nginx"
+)
+
+// activityPollInterval is how often the nginx activity log is read and idle
+// sessions are checked
+const activityPollInterval = 15 * time.Second
+
+// maxActivityLogSize is the size at which the activity log is truncated
+// after it has been read. nginx appends, so truncating is safe.
+const maxActivityLogSize = 10 << 20
+
+// touchFork records activity for a fork at the given time
+func (d *Daemon) touchFork(forkID string, at time.Time) {
+	if forkID == "" {
+		return
+	}
+	d.forksMu.Lock()
+	defer d.forksMu.Unlock()
+	if fork, ok := d.forks[forkID]; ok && at.After(fork.LastActivityAt) {
+		fork.LastActivityAt = at
+	}
+}
+
+// startActivityMonitor periodically picks up proxied requests from nginx's
+// activity log, stops sessions that have been idle for too long and revokes
+// expired credentials
+func (d *Daemon) startActivityMonitor() {
+	ticker := time.NewTicker(activityPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.readActivityLog()
+			d.stopIdleForks()
+			d.revokeExpiredCredentials()
+			d.refreshExportedCredentials()
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// readActivityLog reads the lines nginx has appended to the activity log
+// since the last call and records them against the forks they were for
+func (d *Daemon) readActivityLog() {
+	if d.nginxManager == nil {
+		return
+	}
+
+	path := d.nginxManager.ActivityLogPath()
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to open nginx activity log: %v", err)
+		}
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() < d.activityOffset {
+		// Truncated or recreated
+		d.activityOffset = 0
+	}
+	if _, err := file.Seek(d.activityOffset, io.SeekStart); err != nil {
+		return
+	}
+
+	// Map "<project>-<fork>" host labels to forks
+	d.forksMu.RLock()
+	hosts := make(map[string]string, len(d.forks))
+	for _, fork := range d.forks {
+		hosts[strings.ToLower(fork.ProjectName+"-"+fork.ForkID)] = fork.ForkID
+	}
+	d.forksMu.RUnlock()
+
+	latest := make(map[string]time.Time)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// Leave a partially written line for the next read
+			break
+		}
+		d.activityOffset += int64(len(line))
+
+		entry, ok := nginx.ParseAccessLine(line)
+		if !ok {
+			continue
+		}
+		if forkID, ok := hosts[forkHostLabel(entry.Host)]; ok && entry.Time.After(latest[forkID]) {
+			latest[forkID] = entry.Time
+		}
+	}
+
+	for forkID, at := range latest {
+		d.touchFork(forkID, at)
+	}
+
+	if d.activityOffset >= maxActivityLogSize {
+		if err := os.Truncate(path, 0); err != nil {
+			log.Printf("Failed to truncate nginx activity log: %v", err)
+			return
+		}
+		d.activityOffset = 0
+	}
+}
+
+// forkHostLabel returns the "<project>-<fork>" label of a proxied host name,
+// which is the last label before the worklet domain
+func forkHostLabel(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), "."+config.Domain())
+	if i := strings.LastIndex(host, "."); i >= 0 {
+		host = host[i+1:]
+	}
+	return host
+}
+
+// stopIdleForks stops the containers of forks without activity for longer
+// than the configured idle timeout. The Docker event listener unregisters
+// them once they exit.
+func (d *Daemon) stopIdleForks() {
+	if d.idleTimeout <= 0 {
+		return
+	}
+
+	var idle []*ForkInfo
+	d.forksMu.RLock()
+	for _, fork := range d.forks {
+		if fork.ContainerID != "" && time.Since(fork.LastActivityAt) > d.idleTimeout {
+			forkCopy := *fork
+			idle = append(idle, &forkCopy)
+		}
+	}
+	d.forksMu.RUnlock()
+
+	if len(idle) == 0 {
+		return
+	}
+
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		log.Printf("Failed to create Docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	for _, fork := range idle {
+		log.Printf("Stopping session %s: no activity since %s", fork.ForkID, fork.LastActivityAt.Format(time.RFC3339))
+		ctx, cancel := context.WithTimeout(d.ctx, time.Minute)
+		if err := cli.ContainerStop(ctx, fork.ContainerID, container.StopOptions{}); err != nil {
+			log.Printf("Failed to stop idle session %s: %v", fork.ForkID, err)
+		}
+		cancel()
+	}
+}
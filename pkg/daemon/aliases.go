@@ -0,0 +1,112 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// handleSetStable points a project's stable host names, such as
+// api.myapp.<domain>, at one of its forks. The proxy switches over in a
+// single config reload.
+func (d *Daemon) handleSetStable(msg *Message) *Message {
+	var req SetStableRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+
+	d.forksMu.Lock()
+	fork, exists := d.forks[req.ForkID]
+	if !exists {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
+	}
+	if fork.ProjectName != req.ProjectName {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, fmt.Sprintf("fork %s belongs to project %s, not %s", req.ForkID, fork.ProjectName, req.ProjectName))
+	}
+	previous := d.stableSessions[req.ProjectName]
+	d.stableSessions[req.ProjectName] = req.ForkID
+	d.forksMu.Unlock()
+
+	log.Printf("Pointed stable host names of project %s at fork %s", req.ProjectName, req.ForkID)
+	d.updateNginxConfig()
+	if err := d.saveState(); err != nil {
+		log.Printf("Failed to save state: %v", err)
+	}
+
+	stable := StableSession{ProjectName: req.ProjectName, ForkID: req.ForkID}
+	if previous != req.ForkID {
+		stable.Previous = previous
+	}
+	return &Message{
+		Type:    MsgStable,
+		ID:      msg.ID,
+		Payload: mustMarshal(stable),
+	}
+}
+
+// forkAliases returns the names each fork's HTTP services are served under
+// besides their own, keyed by fork ID. A project's stable name goes to the
+// fork deploy-swap pointed it at. A configured alias goes to the most
+// recently started healthy fork with it, unless a swap pinned that name.
+// Callers hold forksMu.
+func (d *Daemon) forkAliases() map[string][]string {
+	targets := make(map[string]string) // Alias to fork ID
+	for project, forkID := range d.stableSessions {
+		if _, ok := d.forks[forkID]; ok {
+			targets[project] = forkID
+		}
+	}
+
+	latest := make(map[string]*ForkInfo)
+	for _, fork := range d.forks {
+		if fork.Alias == "" || fork.Unhealthy || fork.Restarting {
+			continue
+		}
+		current := latest[fork.Alias]
+		if current == nil || fork.StartedAt.After(current.StartedAt) ||
+			(fork.StartedAt.Equal(current.StartedAt) && fork.ForkID > current.ForkID) {
+			latest[fork.Alias] = fork
+		}
+	}
+	for alias, fork := range latest {
+		if _, pinned := targets[alias]; !pinned {
+			targets[alias] = fork.ForkID
+		}
+	}
+
+	aliases := make(map[string][]string)
+	for alias, forkID := range targets {
+		aliases[forkID] = append(aliases[forkID], alias)
+	}
+	for _, names := range aliases {
+		sort.Strings(names)
+	}
+	return aliases
+}
+
+// setForkHealth records whether a registered fork passes its health check,
+// moving its alias if that changed. It reports whether the fork is
+// registered.
+func (d *Daemon) setForkHealth(forkID string, healthy bool) bool {
+	d.forksMu.Lock()
+	fork, exists := d.forks[forkID]
+	changed := exists && fork.Unhealthy == healthy
+	aliased := exists && fork.Alias != ""
+	if changed {
+		fork.Unhealthy = !healthy
+	}
+	d.forksMu.Unlock()
+
+	if changed && aliased {
+		if healthy {
+			log.Printf("Fork %s is healthy, updating aliases", forkID)
+		} else {
+			log.Printf("Fork %s is unhealthy, updating aliases", forkID)
+		}
+		d.updateNginxConfig()
+	}
+	return exists
+}
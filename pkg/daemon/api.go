@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nolanleung/worklet/internal/config"
+)
+
+// startAPI listens on the configured TCP address for requests from other
+// machines or containers. It speaks the same protocol as the Unix socket,
+// but every request must carry a token from the token store, whose role
+// has to allow it. The tokens are bearer secrets, so the API is served over
+// TLS when a certificate is configured, and only on a loopback address
+// otherwise.
+func (d *Daemon) startAPI() error {
+	if d.tokens == nil {
+		return fmt.Errorf("can't serve the API on %s without a token store", d.api.Listen)
+	}
+	tlsConfig, err := apiTLSConfig(d.api)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil && !isLoopbackAddress(d.api.Listen) {
+		return fmt.Errorf("refusing to serve the API on %s without TLS: set api.tlsCert and api.tlsKey, or listen on a loopback address such as 127.0.0.1", d.api.Listen)
+	}
+
+	listener, err := net.Listen("tcp", d.api.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", d.api.Listen, err)
+	}
+	scheme := "plain TCP"
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "TLS"
+	}
+	d.apiListener = listener
+	go d.acceptConnections(listener, true)
+	log.Printf("Serving the API on %s over %s", listener.Addr(), scheme)
+	return nil
+}
+
+// apiTLSConfig loads the certificate the API is served with, or returns nil
+// if none is configured
+func apiTLSConfig(api config.APIConfig) (*tls.Config, error) {
+	if api.TLSCert == "" && api.TLSKey == "" {
+		return nil, nil
+	}
+	if api.TLSCert == "" || api.TLSKey == "" {
+		return nil, fmt.Errorf("api.tlsCert and api.tlsKey must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(expandHome(api.TLSCert), expandHome(api.TLSKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the API's TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// expandHome expands a leading ~ in a path from the global config
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[1:])
+}
+
+// isLoopbackAddress reports whether a listen address only accepts
+// connections from this machine. An empty host listens on every interface.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// APIAddress returns the address the TCP API listens on, or "" when it
+// isn't served
+func (d *Daemon) APIAddress() string {
+	if d.apiListener == nil {
+		return ""
+	}
+	return d.apiListener.Addr().String()
+}
+
+// authorizeRemote checks the token of a request to the TCP API. It returns
+// the error response to send instead of handling the request, or nil if
+// the token's role allows it.
+func (d *Daemon) authorizeRemote(msg *Message, addr net.Addr) *Message {
+	token, ok := d.tokens.Authenticate(msg.Token)
+	if !ok {
+		log.Printf("Rejecting %s request from %v: missing or unknown API token", msg.Type, addr)
+		return errorResponseWithCode(msg.ID, ErrCodeUnauthorized, "missing or unknown API token")
+	}
+	if need := requiredRole(msg.Type); !token.Role.allows(need) {
+		log.Printf("Rejecting %s request from %v: token %s is %s, needs %s", msg.Type, addr, token.Name, token.Role, need)
+		return errorResponseWithCode(msg.ID, ErrCodeForbidden, fmt.Sprintf("token %s is %s; %s needs %s", token.Name, token.Role, msg.Type, need))
+	}
+	return nil
+}
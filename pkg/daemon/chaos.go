@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/nolanleung/worklet/internal/chaos"
+)
+
+// handleSetChaos sets or clears the chaos of a fork's HTTP services
+func (d *Daemon) handleSetChaos(msg *Message) *Message {
+	var req SetChaosRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+
+	enable := !req.Clear && !req.Config.IsZero()
+	if enable {
+		if err := req.Config.Validate(); err != nil {
+			return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, err.Error())
+		}
+		if _, err := d.startInterceptor(); err != nil {
+			log.Printf("Failed to start interceptor: %v", err)
+			return errorResponseWithCode(msg.ID, ErrCodeInternal, fmt.Sprintf("failed to start interceptor: %v", err))
+		}
+	}
+
+	d.forksMu.Lock()
+	fork, exists := d.forks[req.ForkID]
+	if !exists {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
+	}
+
+	selected, err := selectHTTPServices(fork, req.Services)
+	if err != nil {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, err.Error())
+	}
+	if enable && len(selected) == 0 {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, fmt.Sprintf("fork %s has no HTTP services", req.ForkID))
+	}
+
+	for _, name := range selected {
+		if enable {
+			if fork.Chaos == nil {
+				fork.Chaos = make(map[string]chaos.Config)
+			}
+			fork.Chaos[name] = req.Config
+		} else {
+			delete(fork.Chaos, name)
+		}
+	}
+	if len(fork.Chaos) == 0 {
+		fork.Chaos = nil
+	}
+	info := *fork
+	info.Chaos = make(map[string]chaos.Config, len(fork.Chaos))
+	for name, config := range fork.Chaos {
+		info.Chaos[name] = config
+	}
+	d.forksMu.Unlock()
+
+	d.updateNginxConfig()
+
+	return &Message{
+		Type:    MsgForkInfo,
+		ID:      msg.ID,
+		Payload: mustMarshal(info),
+	}
+}
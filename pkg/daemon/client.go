@@ -2,7 +2,9 @@ package daemon
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -10,11 +12,53 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/nolanleung/worklet/internal/chaos"
+	"github.com/nolanleung/worklet/internal/trace"
 )
 
+// DaemonError is an error reported by the daemon
+type DaemonError struct {
+	Code    string
+	Message string
+}
+
+func (e *DaemonError) Error() string {
+	return fmt.Sprintf("daemon error: %s", e.Message)
+}
+
+// IsRetryable reports whether err was caused by the daemon shedding load,
+// in which case the request can be retried later
+func IsRetryable(err error) bool {
+	var daemonErr *DaemonError
+	if !errors.As(err, &daemonErr) {
+		return false
+	}
+	return daemonErr.Code == ErrCodeBusy || daemonErr.Code == ErrCodeTooManyConnections
+}
+
+// IsNotFound reports whether err was caused by the daemon not knowing the
+// requested fork
+func IsNotFound(err error) bool {
+	var daemonErr *DaemonError
+	return errors.As(err, &daemonErr) && daemonErr.Code == ErrCodeNotFound
+}
+
+// responseError converts an error response into a DaemonError
+func responseError(resp *Message) error {
+	var errResp ErrorResponse
+	json.Unmarshal(resp.Payload, &errResp)
+	return &DaemonError{
+		Code:    errResp.Code,
+		Message: errResp.Error,
+	}
+}
+
 // Client represents a client connection to the worklet daemon
 type Client struct {
 	socketPath string
+	apiAddress string      // TCP API address instead of the socket
+	token      string      // API token sent with every request over TCP
+	tlsConfig  *tls.Config // TLS of the TCP API, or nil for plain TCP
 	conn       net.Conn
 	encoder    *json.Encoder
 	decoder    *json.Decoder
@@ -29,8 +73,28 @@ func NewClient(socketPath string) *Client {
 	}
 }
 
+// NewAPIClient creates a client of a daemon's TCP API at address, which
+// authenticates with token. tlsConfig is needed when the daemon serves the
+// API over TLS, and may be nil for a plain loopback one.
+func NewAPIClient(address, token string, tlsConfig *tls.Config) *Client {
+	return &Client{
+		apiAddress: address,
+		token:      token,
+		tlsConfig:  tlsConfig,
+		timeout:    10 * time.Second,
+	}
+}
+
+// SocketPathEnv overrides the default socket path, e.g. to run a second
+// daemon for tests
+const SocketPathEnv = "WORKLET_SOCKET"
+
 // GetDefaultSocketPath returns the default socket path
 func GetDefaultSocketPath() string {
+	if path := os.Getenv(SocketPathEnv); path != "" {
+		return path
+	}
+
 	// Check if running as root
 	if os.Geteuid() == 0 {
 		return "/var/run/worklet.sock"
@@ -47,7 +111,17 @@ func GetDefaultSocketPath() string {
 
 // Connect establishes a connection to the daemon
 func (c *Client) Connect() error {
-	conn, err := net.Dial("unix", c.socketPath)
+	network, address := "unix", c.socketPath
+	if c.apiAddress != "" {
+		network, address = "tcp", c.apiAddress
+	}
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = tls.Dial(network, address, c.tlsConfig)
+	} else {
+		conn, err = net.Dial(network, address)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to connect to daemon: %w", err)
 	}
@@ -81,9 +155,7 @@ func (c *Client) RegisterFork(ctx context.Context, req RegisterForkRequest) erro
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return fmt.Errorf("daemon error: %s", errResp.Error)
+		return responseError(resp)
 	}
 	
 	return nil
@@ -107,9 +179,7 @@ func (c *Client) UnregisterFork(ctx context.Context, forkID string) error {
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return fmt.Errorf("daemon error: %s", errResp.Error)
+		return responseError(resp)
 	}
 	
 	return nil
@@ -128,9 +198,7 @@ func (c *Client) ListForks(ctx context.Context) ([]ForkInfo, error) {
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return nil, fmt.Errorf("daemon error: %s", errResp.Error)
+		return nil, responseError(resp)
 	}
 	
 	var listResp ListForksResponse
@@ -159,9 +227,7 @@ func (c *Client) GetForkInfo(ctx context.Context, forkID string) (*ForkInfo, err
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return nil, fmt.Errorf("daemon error: %s", errResp.Error)
+		return nil, responseError(resp)
 	}
 	
 	var forkInfo ForkInfo
@@ -184,6 +250,9 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 		return err
 	}
 	
+	if resp.Type == MsgError {
+		return responseError(resp)
+	}
 	if resp.Type != MsgSuccess {
 		return fmt.Errorf("unexpected response type: %s", resp.Type)
 	}
@@ -203,11 +272,10 @@ func (c *Client) TriggerDiscovery(ctx context.Context) error {
 		return err
 	}
 	
+	if resp.Type == MsgError {
+		return fmt.Errorf("failed to trigger discovery: %w", responseError(resp))
+	}
 	if resp.Type != MsgSuccess {
-		var errorResp ErrorResponse
-		if err := json.Unmarshal(resp.Payload, &errorResp); err == nil {
-			return fmt.Errorf("failed to trigger discovery: %s", errorResp.Error)
-		}
 		return fmt.Errorf("unexpected response type: %s", resp.Type)
 	}
 	
@@ -227,6 +295,15 @@ func (c *Client) sendRequest(ctx context.Context, msg *Message) (*Message, error
 	}
 	c.conn.SetDeadline(deadline)
 	
+	// Propagate the caller's trace ID so daemon logs can be correlated
+	if msg.TraceID == "" {
+		msg.TraceID = trace.IDFromContext(ctx)
+	}
+	if msg.TraceParent == "" {
+		msg.TraceParent = trace.TraceParent(ctx)
+	}
+	msg.Token = c.token
+	
 	// Send request
 	if err := c.encoder.Encode(msg); err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
@@ -238,6 +315,11 @@ func (c *Client) sendRequest(ctx context.Context, msg *Message) (*Message, error
 		return nil, fmt.Errorf("failed to receive response: %w", err)
 	}
 	
+	// Connection-level rejections are not tied to a request
+	if resp.Type == MsgError && resp.ID == "" {
+		return nil, responseError(&resp)
+	}
+	
 	// Verify response ID matches request
 	if resp.ID != msg.ID {
 		return nil, fmt.Errorf("response ID mismatch")
@@ -264,14 +346,154 @@ func (c *Client) RefreshFork(ctx context.Context, forkID string) error {
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return fmt.Errorf("daemon error: %s", errResp.Error)
+		return responseError(resp)
 	}
 	
 	return nil
 }
 
+// SetNote attaches a note to a registered fork, or clears it when note is empty
+func (c *Client) SetNote(ctx context.Context, forkID, note string) error {
+	req := SetNoteRequest{
+		ForkID: forkID,
+		Note:   note,
+	}
+	
+	msg := Message{
+		Type:    MsgSetNote,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(req),
+	}
+	
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return err
+	}
+	
+	if resp.Type == MsgError {
+		return responseError(resp)
+	}
+	
+	return nil
+}
+
+// SetTap starts or stops recording a fork's HTTP services, all of them when
+// services is empty, and returns the updated fork
+func (c *Client) SetTap(ctx context.Context, forkID string, services []string, enabled bool) (*ForkInfo, error) {
+	req := SetTapRequest{
+		ForkID:   forkID,
+		Services: services,
+		Enabled:  enabled,
+	}
+	
+	msg := Message{
+		Type:    MsgSetTap,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(req),
+	}
+	
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+	
+	if resp.Type == MsgError {
+		return nil, responseError(resp)
+	}
+	
+	var forkInfo ForkInfo
+	if err := json.Unmarshal(resp.Payload, &forkInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	
+	return &forkInfo, nil
+}
+
+// SetServices replaces the services of a running fork and returns the
+// updated fork
+func (c *Client) SetServices(ctx context.Context, forkID string, services []ServiceInfo) (*ForkInfo, error) {
+	msg := Message{
+		Type:    MsgSetServices,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(SetServicesRequest{ForkID: forkID, Services: services}),
+	}
+	
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+	
+	if resp.Type == MsgError {
+		return nil, responseError(resp)
+	}
+	
+	var forkInfo ForkInfo
+	if err := json.Unmarshal(resp.Payload, &forkInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	
+	return &forkInfo, nil
+}
+
+// SetStable points a project's stable host names at one of its forks and
+// returns the fork they pointed at before, if any
+func (c *Client) SetStable(ctx context.Context, projectName, forkID string) (*StableSession, error) {
+	msg := Message{
+		Type:    MsgSetStable,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(SetStableRequest{ProjectName: projectName, ForkID: forkID}),
+	}
+	
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+	
+	if resp.Type == MsgError {
+		return nil, responseError(resp)
+	}
+	
+	var stable StableSession
+	if err := json.Unmarshal(resp.Payload, &stable); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	
+	return &stable, nil
+}
+
+// SetChaos sets the chaos of a fork's HTTP services, all of them when
+// services is empty, or clears it, and returns the updated fork
+func (c *Client) SetChaos(ctx context.Context, forkID string, services []string, config chaos.Config, clear bool) (*ForkInfo, error) {
+	req := SetChaosRequest{
+		ForkID:   forkID,
+		Services: services,
+		Config:   config,
+		Clear:    clear,
+	}
+	
+	msg := Message{
+		Type:    MsgSetChaos,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(req),
+	}
+	
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+	
+	if resp.Type == MsgError {
+		return nil, responseError(resp)
+	}
+	
+	var forkInfo ForkInfo
+	if err := json.Unmarshal(resp.Payload, &forkInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	
+	return &forkInfo, nil
+}
+
 // RefreshAll refreshes information for all forks
 func (c *Client) RefreshAll(ctx context.Context) error {
 	msg := Message{
@@ -285,19 +507,22 @@ func (c *Client) RefreshAll(ctx context.Context) error {
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return fmt.Errorf("daemon error: %s", errResp.Error)
+		return responseError(resp)
 	}
 	
 	return nil
 }
 
-// RequestForkID requests a new fork ID from the daemon
-func (c *Client) RequestForkID(ctx context.Context) (string, error) {
+// RequestForkID requests a new session ID for project from the daemon,
+// numbered per project when sequential is set
+func (c *Client) RequestForkID(ctx context.Context, project string, sequential bool) (string, error) {
 	msg := Message{
 		Type: MsgRequestForkID,
 		ID:   uuid.New().String(),
+		Payload: mustMarshal(RequestForkIDRequest{
+			Project:    project,
+			Sequential: sequential,
+		}),
 	}
 	
 	resp, err := c.sendRequest(ctx, &msg)
@@ -306,9 +531,7 @@ func (c *Client) RequestForkID(ctx context.Context) (string, error) {
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return "", fmt.Errorf("daemon error: %s", errResp.Error)
+		return "", responseError(resp)
 	}
 	
 	var idResp RequestForkIDResponse
@@ -332,9 +555,7 @@ func (c *Client) GetVersion(ctx context.Context) (*GetVersionResponse, error) {
 	}
 	
 	if resp.Type == MsgError {
-		var errResp ErrorResponse
-		json.Unmarshal(resp.Payload, &errResp)
-		return nil, fmt.Errorf("daemon error: %s", errResp.Error)
+		return nil, responseError(resp)
 	}
 	
 	var versionResp GetVersionResponse
@@ -357,4 +578,55 @@ func IsDaemonRunning(socketPath string) bool {
 	defer cancel()
 	
 	return client.HealthCheck(ctx) == nil
-}
\ No newline at end of file
+}
+
+// GetExit returns how a session's main command exited, if the daemon saw it
+// exit. IsNotFound reports a session with no recorded exit.
+func (c *Client) GetExit(ctx context.Context, forkID string) (*SessionExit, error) {
+	msg := Message{
+		Type:    MsgGetExit,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(GetExitRequest{ForkID: forkID}),
+	}
+
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Type == MsgError {
+		return nil, responseError(resp)
+	}
+
+	var exit SessionExit
+	if err := json.Unmarshal(resp.Payload, &exit); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &exit, nil
+}
+
+// Health runs the daemon's self-check and returns its report
+func (c *Client) Health(ctx context.Context) (*HealthReport, error) {
+	msg := Message{
+		Type:    MsgHealthCheck,
+		ID:      uuid.New().String(),
+		Payload: mustMarshal(HealthCheckRequest{Details: true}),
+	}
+
+	resp, err := c.sendRequest(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Type == MsgError {
+		return nil, responseError(resp)
+	}
+
+	var report HealthReport
+	if err := json.Unmarshal(resp.Payload, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &report, nil
+}
@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/nolanleung/worklet/internal/docker"
+)
+
+// revokeExpiredCredentials removes the credentials of running sessions
+// whose time-boxed credentials have expired. A session restarted after
+// expiry doesn't set them up again, so each container is only revoked once
+// it has succeeded. Failures are tried again on the next tick, but only the
+// first is reported, so a session that can't be revoked doesn't raise a
+// notification on every tick.
+func (d *Daemon) revokeExpiredCredentials() {
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		log.Printf("Failed to create Docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(d.ctx, time.Minute)
+	defer cancel()
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", docker.LabelCredentialsExpires)),
+	})
+	if err != nil {
+		log.Printf("Failed to list sessions with time-boxed credentials: %v", err)
+		return
+	}
+
+	if d.revokedCredentials == nil {
+		d.revokedCredentials = make(map[string]bool)
+	}
+	if d.revokeFailures == nil {
+		d.revokeFailures = make(map[string]int)
+	}
+	running := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		running[c.ID] = true
+		if d.revokedCredentials[c.ID] {
+			continue
+		}
+		expires, err := time.Parse(time.RFC3339, c.Labels[docker.LabelCredentialsExpires])
+		if err != nil || time.Now().Before(expires) {
+			continue
+		}
+
+		sessionID := c.Labels["worklet.session.id"]
+		if err := docker.RevokeCredentials(ctx, c.ID); err != nil {
+			d.revokeFailures[c.ID]++
+			if d.revokeFailures[c.ID] == 1 {
+				log.Printf("Revoking expired credentials of session %s: %v (retrying)", sessionID, err)
+				d.notifyRevokeFailure(sessionID, err)
+			} else {
+				debugLog("Revoking expired credentials of session %s failed again (attempt %d): %v", sessionID, d.revokeFailures[c.ID], err)
+			}
+			continue
+		}
+		if failures := d.revokeFailures[c.ID]; failures > 0 {
+			log.Printf("Revoked expired credentials of session %s after %d failed attempts", sessionID, failures)
+		} else {
+			log.Printf("Revoked expired credentials of session %s", sessionID)
+		}
+		d.revokedCredentials[c.ID] = true
+		delete(d.revokeFailures, c.ID)
+	}
+
+	// Forget containers that are gone
+	for id := range d.revokedCredentials {
+		if !running[id] {
+			delete(d.revokedCredentials, id)
+		}
+	}
+	for id := range d.revokeFailures {
+		if !running[id] {
+			delete(d.revokeFailures, id)
+		}
+	}
+}
+
+// refreshExportedCredentials exports the credentials of running sessions
+// again every docker.ExportedCredentialsRefreshInterval, so short-lived ones
+// don't expire under them. Sessions whose time-boxed credentials have
+// expired aren't refreshed.
+func (d *Daemon) refreshExportedCredentials() {
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		log.Printf("Failed to create Docker client: %v", err)
+		return
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(d.ctx, 2*time.Minute)
+	defer cancel()
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", docker.LabelExportedCredentials)),
+	})
+	if err != nil {
+		log.Printf("Failed to list sessions with exported credentials: %v", err)
+		return
+	}
+
+	if d.exportedRefreshedAt == nil {
+		d.exportedRefreshedAt = make(map[string]time.Time)
+	}
+	running := make(map[string]bool, len(containers))
+	for _, c := range containers {
+		running[c.ID] = true
+		if time.Since(d.exportedRefreshedAt[c.ID]) < docker.ExportedCredentialsRefreshInterval {
+			continue
+		}
+		if value, ok := c.Labels[docker.LabelCredentialsExpires]; ok {
+			if expires, err := time.Parse(time.RFC3339, value); err != nil || !time.Now().Before(expires) {
+				continue
+			}
+		}
+
+		sessionID := c.Labels["worklet.session.id"]
+		if err := docker.RefreshExportedCredentials(ctx, sessionID, c.Labels); err != nil {
+			log.Printf("Refreshing exported credentials of session %s: %v", sessionID, err)
+		}
+		d.exportedRefreshedAt[c.ID] = time.Now()
+	}
+
+	for id := range d.exportedRefreshedAt {
+		if !running[id] {
+			delete(d.exportedRefreshedAt, id)
+		}
+	}
+}
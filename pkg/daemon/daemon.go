@@ -3,12 +3,15 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,10 +21,14 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/client"
+	"github.com/nolanleung/worklet/internal/config"
 	"github.com/nolanleung/worklet/internal/docker"
 	"github.com/nolanleung/worklet/internal/nginx"
+	"github.com/nolanleung/worklet/internal/notes"
+	"github.com/nolanleung/worklet/internal/storage"
+	"github.com/nolanleung/worklet/internal/trace"
 	"github.com/nolanleung/worklet/internal/version"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var debugMode = os.Getenv("WORKLET_DEBUG") == "true"
@@ -36,6 +43,12 @@ func debugLog(format string, args ...interface{}) {
 type Daemon struct {
 	socketPath   string
 	listener     net.Listener
+	
+	// TCP API, when the global config sets an address to listen on, and
+	// the tokens requests over it authenticate with
+	api         config.APIConfig
+	apiListener net.Listener
+	tokens      *TokenStore
 	forks        map[string]*ForkInfo
 	forksMu      sync.RWMutex
 	nextForkID   int
@@ -46,13 +59,90 @@ type Daemon struct {
 	nginxManager *docker.NginxManager
 	startTime    time.Time
 	
-	// Cache for container information
-	forksCache      []ForkInfo
-	forksCacheMu    sync.RWMutex
-	forksCacheTime  time.Time
-	forksCacheTTL   time.Duration
+	// Sessions idle for longer than this are stopped; zero disables it
+	idleTimeout    time.Duration
+	
+	// Announcements of exited sessions, and the containers that were
+	// signalled to stop and so aren't announced
+	notifications config.NotificationsConfig
+	stoppedMu     sync.Mutex
+	stopped       map[string]bool
+	
+	// Pull-through cache full isolation sessions use as a mirror
+	registryMirror config.RegistryMirrorConfig
+	
+	// How the main command of recently exited sessions ended, guarded by
+	// forksMu
+	exits map[string]SessionExit
+	
+	// Session ID allocation, serialized by idMu. projectSequences holds the
+	// last sequential number per project and is guarded by forksMu like
+	// nextForkID; reservedIDs holds IDs handed out whose containers may not
+	// exist yet.
+	idMu             sync.Mutex
+	projectSequences map[string]int
+	reservedIDs      map[string]time.Time
+	
+	activityOffset int64 // Bytes of the nginx activity log already read
+	
+	// Proxy ports of TCP and UDP services, keyed by streamPortKey
+	streamPorts map[string]int
+	
+	// Fork each project's stable host names point at, set by
+	// 'worklet deploy-swap' and guarded by forksMu
+	stableSessions map[string]string
+	
+	// Proxy for tapped services and services with chaos, started on first use
+	interceptMu     sync.Mutex
+	interceptHost   string
+	interceptPort   int
+	interceptSecret string // Authenticates nginx and the interceptor to each other
+	recordMu      sync.Mutex // Serializes writes to recordings
+	chaosMu       sync.Mutex // Guards chaosRand
+	chaosRand     *rand.Rand
+	
+	// Limits on concurrent connections and expensive handlers
+	connSem   chan struct{}
+	workerSem chan struct{}
+	
+	// Self-check state: the Docker event subscription and how it has fared,
+	// the recovery actions taken and how nginx config updates went
+	healthMu        sync.Mutex
+	eventsCancel    context.CancelFunc // Ends the current subscription; nil when not subscribed
+	eventReconnects int
+	lastEventAt     time.Time
+	dockerDown      bool
+	recoveries      []HealthRecovery
+	reconcileReport *ReconcileReport // From startup
+	nginxStatus     NginxStatus
+	
+	// Containers whose time-boxed credentials have been revoked, touched
+	// only by the activity monitor
+	revokedCredentials map[string]bool
+	// How often revoking each container's credentials has failed since
+	// its last success, touched only by the activity monitor
+	revokeFailures map[string]int
+	// When each container's credentials were last exported, touched
+	// only by the activity monitor
+	exportedRefreshedAt map[string]time.Time
 }
 
+// reconcileInterval is how often the daemon does a full container scan as a
+// fallback for any Docker events that were missed
+const reconcileInterval = 5 * time.Minute
+
+// Connection limits
+const (
+	maxConnections      = 64
+	maxMessageSize      = 1 << 20 // 1MB
+	connIdleTimeout     = 2 * time.Minute
+	maxExpensiveWorkers = 2
+	workerWaitTimeout   = 30 * time.Second
+)
+
+// errPayloadTooLarge is returned when a single message exceeds maxMessageSize
+var errPayloadTooLarge = errors.New("message exceeds maximum size")
+
 // NewDaemon creates a new daemon instance
 func NewDaemon(socketPath string) *Daemon {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -64,22 +154,57 @@ func NewDaemon(socketPath string) *Daemon {
 	
 	// Create nginx manager
 	nginxConfigPath := filepath.Join(homeDir, ".worklet", "nginx")
-	nginxManager, err := docker.NewNginxManager(nginxConfigPath)
+	var nginxManager *docker.NginxManager
+	rt, err := docker.NewRuntime()
+	if err == nil {
+		nginxManager, err = docker.NewNginxManager(nginxConfigPath, rt)
+	}
 	if err != nil {
 		log.Printf("Failed to create nginx manager: %v", err)
 	}
 	
+	var idleTimeout time.Duration
+	var notifications config.NotificationsConfig
+	var registryMirror config.RegistryMirrorConfig
+	var api config.APIConfig
+	if globalConfig, err := config.LoadGlobalConfig(); err != nil {
+		log.Printf("Failed to load global config: %v", err)
+	} else {
+		idleTimeout = time.Duration(globalConfig.Sessions.IdleStopMinutes) * time.Minute
+		notifications = globalConfig.Notifications
+		registryMirror = globalConfig.RegistryMirror
+		api = globalConfig.API
+	}
+	tokens, err := NewTokenStore()
+	if err != nil {
+		log.Printf("Failed to open API token store: %v", err)
+	}
+	
 	return &Daemon{
-		socketPath:   socketPath,
-		forks:        make(map[string]*ForkInfo),
-		nextForkID:   1,
-		ctx:          ctx,
-		cancel:       cancel,
-		stateFile:    stateFile,
-		pidFile:      pidFile,
-		nginxManager: nginxManager,
-		startTime:    time.Now(),
-		forksCacheTTL: 5 * time.Second, // Cache TTL of 5 seconds
+		socketPath:       socketPath,
+		forks:            make(map[string]*ForkInfo),
+		streamPorts:      make(map[string]int),
+		stableSessions:   make(map[string]string),
+		chaosRand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		interceptSecret:  newInterceptSecret(),
+		nextForkID:       1,
+		ctx:              ctx,
+		cancel:           cancel,
+		stateFile:        stateFile,
+		pidFile:          pidFile,
+		nginxManager:     nginxManager,
+		startTime:        time.Now(),
+		idleTimeout:      idleTimeout,
+		notifications:    notifications,
+		registryMirror:   registryMirror,
+		api:              api,
+		tokens:           tokens,
+		stopped:          make(map[string]bool),
+		exits:            make(map[string]SessionExit),
+		projectSequences: make(map[string]int),
+		reservedIDs:      make(map[string]time.Time),
+		connSem:          make(chan struct{}, maxConnections),
+		workerSem:        make(chan struct{}, maxExpensiveWorkers),
 	}
 }
 
@@ -113,10 +238,8 @@ func (d *Daemon) Start() error {
 		log.Printf("Failed to load state: %v", err)
 	}
 	
-	// Discover any running worklet containers
-	if err := d.discoverContainers(); err != nil {
-		log.Printf("Failed to discover containers: %v", err)
-	}
+	// Rebuild the registry and nginx config from the containers that exist
+	d.reconcileOnStartup(context.Background())
 	
 	// Clean up any orphaned networks from previous runs
 	if removedCount, err := docker.CleanupOrphanedNetworks(); err != nil {
@@ -125,8 +248,16 @@ func (d *Daemon) Start() error {
 		log.Printf("Cleaned up %d orphaned network(s) at startup", removedCount)
 	}
 	
+	// Serve the TCP API if configured
+	if d.api.Listen != "" {
+		if err := d.startAPI(); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	
 	// Start accepting connections
-	go d.acceptConnections()
+	go d.acceptConnections(d.listener, false)
 	
 	// Start Docker event listener for real-time container monitoring
 	go d.startEventListener()
@@ -134,20 +265,42 @@ func (d *Daemon) Start() error {
 	// Start PID file checker to ensure only one daemon runs
 	go d.startPIDChecker()
 	
-	// Start background container discovery for periodic updates
-	go d.startPeriodicDiscovery()
+	// Start slow fallback reconcile in case any events were missed
+	go d.startFallbackReconcile()
+	
+	// Track proxy traffic and stop idle sessions
+	go d.startActivityMonitor()
+	
+	// Check the daemon's own health and recover from what it can
+	go d.startSelfCheck()
+	
+	// Pull images sessions are likely to need while nothing is starting
+	go d.startPrefetcher()
+	
+	// Start or remove the registry mirror to match the config
+	go d.startRegistryMirror()
+	
+	// Keep the daemon's log from growing without bound
+	go d.startLogRotation()
+	
+	// Report how many forks are registered with the exported metrics
+	if err := trace.ObserveGauge("worklet.forks", "Forks registered with the daemon", d.forkCount); err != nil {
+		log.Printf("Failed to register the forks metric: %v", err)
+	}
 	
 	// Start nginx proxy container
 	if d.nginxManager != nil {
-		// Generate fresh nginx config from validated state
-		d.updateNginxConfig()
-		
-		// Now start nginx with the fresh config
+		// Start nginx with the config reconcileOnStartup generated
 		if err := d.nginxManager.Start(d.ctx); err != nil {
 			log.Printf("Failed to start nginx proxy: %v", err)
 		} else {
 			log.Printf("Started nginx proxy container")
 			
+			// Listen on IPv6 if the container turned out to have it
+			if d.nginxManager.IPv6() {
+				d.updateNginxConfig()
+			}
+			
 			// Start nginx health check goroutine
 			go d.startNginxHealthCheck()
 		}
@@ -164,6 +317,9 @@ func (d *Daemon) Stop() error {
 	if d.listener != nil {
 		d.listener.Close()
 	}
+	if d.apiListener != nil {
+		d.apiListener.Close()
+	}
 	
 	// Save state before stopping
 	if err := d.saveState(); err != nil {
@@ -186,10 +342,11 @@ func (d *Daemon) Stop() error {
 	return nil
 }
 
-// acceptConnections handles incoming client connections
-func (d *Daemon) acceptConnections() {
+// acceptConnections handles incoming client connections. Connections to
+// the TCP API are remote: their requests must carry an API token.
+func (d *Daemon) acceptConnections(listener net.Listener, remote bool) {
 	for {
-		conn, err := d.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			select {
 			case <-d.ctx.Done():
@@ -200,33 +357,100 @@ func (d *Daemon) acceptConnections() {
 			}
 		}
 		
-		go d.handleConnection(conn)
+		// Reject the connection if we're already at capacity
+		select {
+		case d.connSem <- struct{}{}:
+		default:
+			log.Printf("Rejecting connection: too many concurrent connections (%d)", maxConnections)
+			go rejectConnection(conn, ErrCodeTooManyConnections, "too many concurrent connections")
+			continue
+		}
+		
+		go d.handleConnection(conn, remote)
 	}
 }
 
+// rejectConnection sends a single error response and closes the connection
+func rejectConnection(conn net.Conn, code, errMsg string) {
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	json.NewEncoder(conn).Encode(errorResponseWithCode("", code, errMsg))
+}
+
+// limitedReader caps how much can be read for a single message
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errPayloadTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
 // handleConnection handles a single client connection
-func (d *Daemon) handleConnection(conn net.Conn) {
+func (d *Daemon) handleConnection(conn net.Conn, remote bool) {
+	defer func() { <-d.connSem }()
 	defer conn.Close()
 	
 	debugLog("New client connection from %v", conn.RemoteAddr())
 	
-	decoder := json.NewDecoder(conn)
+	reader := &limitedReader{r: conn}
+	decoder := json.NewDecoder(reader)
 	encoder := json.NewEncoder(conn)
 	
 	for {
 		var msg Message
 		decodeStart := time.Now()
+		
+		// Each message gets a fresh size budget and idle deadline
+		reader.remaining = maxMessageSize
+		conn.SetReadDeadline(time.Now().Add(connIdleTimeout))
+		
 		if err := decoder.Decode(&msg); err != nil {
-			if err != io.EOF {
+			var netErr net.Error
+			switch {
+			case errors.Is(err, errPayloadTooLarge):
+				log.Printf("Rejecting message from %v: exceeds %d bytes", conn.RemoteAddr(), maxMessageSize)
+				encoder.Encode(errorResponseWithCode("", ErrCodePayloadTooLarge, errPayloadTooLarge.Error()))
+			case errors.As(err, &netErr) && netErr.Timeout():
+				debugLog("Connection from %v idle for %v, closing", conn.RemoteAddr(), connIdleTimeout)
+			case err != io.EOF:
 				log.Printf("Failed to decode message: %v", err)
 			}
 			debugLog("Connection closed from %v", conn.RemoteAddr())
 			return
 		}
-		debugLog("Received message: Type=%s, ID=%s (decode took %v)", msg.Type, msg.ID, time.Since(decodeStart))
+		debugLog("Received message: Type=%s, ID=%s, Trace=%s (decode took %v)", msg.Type, msg.ID, msg.TraceID, time.Since(decodeStart))
 		
 		handleStart := time.Now()
-		response := d.handleMessage(&msg)
+		
+		// Handlers continue the trace from the message's span
+		ctx, endSpan := trace.StartSpan(msgContext(&msg), "daemon "+string(msg.Type), attribute.String(trace.IDAttribute, msg.TraceID))
+		msg.TraceParent = trace.TraceParent(ctx)
+		var response *Message
+		if remote {
+			response = d.authorizeRemote(&msg, conn.RemoteAddr())
+		}
+		if response == nil {
+			response = d.handleMessage(&msg)
+		}
+		var handleErr error
+		if response.Type == MsgError {
+			handleErr = responseError(response)
+		}
+		endSpan(handleErr)
+		response.TraceID = msg.TraceID
+		if msg.TraceID != "" {
+			log.Printf("[trace %s] %s -> %s (took %v)", msg.TraceID, msg.Type, response.Type, time.Since(handleStart))
+		}
 		debugLog("Handled message: Type=%s, ID=%s, ResponseType=%s (took %v)", msg.Type, msg.ID, response.Type, time.Since(handleStart))
 		
 		encodeStart := time.Now()
@@ -250,35 +474,61 @@ func (d *Daemon) handleMessage(msg *Message) *Message {
 	case MsgGetForkInfo:
 		return d.handleGetForkInfo(msg)
 	case MsgRefreshFork:
-		return d.handleRefreshFork(msg)
+		return d.withWorker(msg, d.handleRefreshFork)
 	case MsgRefreshAll:
-		return d.handleRefreshAll(msg)
+		return d.withWorker(msg, d.handleRefreshAll)
 	case MsgRequestForkID:
-		return d.handleRequestForkID(msg)
+		return d.withWorker(msg, d.handleRequestForkID)
 	case MsgHealthCheck:
-		return &Message{
-			Type: MsgSuccess,
-			ID:   msg.ID,
-		}
+		return d.handleHealthCheck(msg)
 	case MsgTriggerDiscovery:
-		return d.handleTriggerDiscovery(msg)
+		return d.withWorker(msg, d.handleTriggerDiscovery)
 	case MsgGetVersion:
 		return d.handleGetVersion(msg)
+	case MsgSetNote:
+		return d.handleSetNote(msg)
+	case MsgSetTap:
+		return d.handleSetTap(msg)
+	case MsgGetExit:
+		return d.handleGetExit(msg)
+	case MsgSetChaos:
+		return d.handleSetChaos(msg)
+	case MsgSetServices:
+		return d.handleSetServices(msg)
+	case MsgSetStable:
+		return d.handleSetStable(msg)
 	default:
-		return &Message{
-			Type: MsgError,
-			ID:   msg.ID,
-			Payload: mustMarshal(ErrorResponse{
-				Error: fmt.Sprintf("unknown message type: %s", msg.Type),
-			}),
-		}
+		return errorResponseWithCode(msg.ID, ErrCodeUnknownMessage, fmt.Sprintf("unknown message type: %s", msg.Type))
+	}
+}
+
+// msgContext returns a context continuing the trace of the message's sender
+func msgContext(msg *Message) context.Context {
+	return trace.WithTraceParent(context.Background(), msg.TraceParent)
+}
+
+// withWorker runs an expensive handler (one that talks to Docker) once a
+// worker slot is free, rejecting the request if none frees up in time
+func (d *Daemon) withWorker(msg *Message, handler func(*Message) *Message) *Message {
+	timer := time.NewTimer(workerWaitTimeout)
+	defer timer.Stop()
+	
+	select {
+	case d.workerSem <- struct{}{}:
+		defer func() { <-d.workerSem }()
+		return handler(msg)
+	case <-timer.C:
+		log.Printf("Rejecting %s request: all %d workers busy", msg.Type, maxExpensiveWorkers)
+		return errorResponseWithCode(msg.ID, ErrCodeBusy, "daemon is busy, try again later")
+	case <-d.ctx.Done():
+		return errorResponseWithCode(msg.ID, ErrCodeInternal, "daemon is shutting down")
 	}
 }
 
 func (d *Daemon) handleRegisterFork(msg *Message) *Message {
 	var req RegisterForkRequest
 	if err := json.Unmarshal(msg.Payload, &req); err != nil {
-		return errorResponse(msg.ID, "invalid request payload")
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
 	}
 	
 	d.forksMu.Lock()
@@ -288,15 +538,13 @@ func (d *Daemon) handleRegisterFork(msg *Message) *Message {
 		ContainerID:  req.ContainerID,
 		WorkDir:      req.WorkDir,
 		Services:     req.Services,
-		Metadata:     req.Metadata,
-		RegisteredAt: time.Now(),
-		LastSeenAt:   time.Now(),
+		Metadata:     withNote(req.ForkID, req.Metadata),
+		RegisteredAt:   time.Now(),
+		LastSeenAt:     time.Now(),
+		LastActivityAt: time.Now(),
 	}
 	d.forksMu.Unlock()
 	
-	// Invalidate cache since we modified forks
-	d.invalidateCache()
-	
 	// Update nginx configuration and ensure it's connected to the fork's network
 	d.updateNginxConfig()
 	
@@ -320,16 +568,13 @@ func (d *Daemon) handleRegisterFork(msg *Message) *Message {
 func (d *Daemon) handleUnregisterFork(msg *Message) *Message {
 	var req UnregisterForkRequest
 	if err := json.Unmarshal(msg.Payload, &req); err != nil {
-		return errorResponse(msg.ID, "invalid request payload")
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
 	}
 	
 	d.forksMu.Lock()
 	delete(d.forks, req.ForkID)
 	d.forksMu.Unlock()
 	
-	// Invalidate cache since we modified forks
-	d.invalidateCache()
-	
 	// Update nginx configuration
 	d.updateNginxConfig()
 	
@@ -347,49 +592,23 @@ func (d *Daemon) handleUnregisterFork(msg *Message) *Message {
 	}
 }
 
+// forkCount returns how many forks are registered
+func (d *Daemon) forkCount() int64 {
+	d.forksMu.RLock()
+	defer d.forksMu.RUnlock()
+	return int64(len(d.forks))
+}
+
 func (d *Daemon) handleListForks(msg *Message) *Message {
-	startTime := time.Now()
-	debugLog("handleListForks started for message ID=%s", msg.ID)
-	
-	// Check if we have valid cached data
-	d.forksCacheMu.RLock()
-	cacheValid := time.Since(d.forksCacheTime) < d.forksCacheTTL && len(d.forksCache) > 0
-	cachedForks := d.forksCache
-	d.forksCacheMu.RUnlock()
-	
-	if cacheValid {
-		debugLog("Returning cached forks (cache age: %v)", time.Since(d.forksCacheTime))
-		debugLog("handleListForks completed for message ID=%s (total time: %v, from cache)", msg.ID, time.Since(startTime))
-		
-		return &Message{
-			Type: MsgForkList,
-			ID:   msg.ID,
-			Payload: mustMarshal(ListForksResponse{
-				Forks: cachedForks,
-			}),
-		}
-	}
-	
-	// Cache miss or expired - rebuild cache
-	debugLog("Cache miss or expired, rebuilding...")
-	
-	// Get current forks from memory (fast operation)
-	lockStart := time.Now()
+	// The registry is kept current by the Docker event listener, so it can be
+	// served straight from memory
 	d.forksMu.RLock()
 	forks := make([]ForkInfo, 0, len(d.forks))
 	for _, fork := range d.forks {
 		forks = append(forks, *fork)
 	}
 	d.forksMu.RUnlock()
-	debugLog("Read %d forks from map (lock held for %v)", len(forks), time.Since(lockStart))
-	
-	// Update cache
-	d.forksCacheMu.Lock()
-	d.forksCache = forks
-	d.forksCacheTime = time.Now()
-	d.forksCacheMu.Unlock()
-	
-	debugLog("handleListForks completed for message ID=%s (total time: %v, cache rebuilt)", msg.ID, time.Since(startTime))
+	debugLog("Listing %d forks for message ID=%s", len(forks), msg.ID)
 	
 	return &Message{
 		Type: MsgForkList,
@@ -403,7 +622,7 @@ func (d *Daemon) handleListForks(msg *Message) *Message {
 func (d *Daemon) handleGetForkInfo(msg *Message) *Message {
 	var req GetForkInfoRequest
 	if err := json.Unmarshal(msg.Payload, &req); err != nil {
-		return errorResponse(msg.ID, "invalid request payload")
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
 	}
 	
 	d.forksMu.RLock()
@@ -411,7 +630,7 @@ func (d *Daemon) handleGetForkInfo(msg *Message) *Message {
 	d.forksMu.RUnlock()
 	
 	if !exists {
-		return errorResponse(msg.ID, fmt.Sprintf("fork %s not found", req.ForkID))
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
 	}
 	
 	return &Message{
@@ -424,7 +643,14 @@ func (d *Daemon) handleGetForkInfo(msg *Message) *Message {
 func (d *Daemon) handleRefreshFork(msg *Message) *Message {
 	var req RefreshForkRequest
 	if err := json.Unmarshal(msg.Payload, &req); err != nil {
-		return errorResponse(msg.ID, "invalid request payload")
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+	
+	d.forksMu.RLock()
+	_, exists := d.forks[req.ForkID]
+	d.forksMu.RUnlock()
+	if !exists {
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
 	}
 	
 	// Refresh the specific fork
@@ -449,7 +675,7 @@ func (d *Daemon) handleRefreshFork(msg *Message) *Message {
 
 func (d *Daemon) handleRefreshAll(msg *Message) *Message {
 	// First discover any running containers not in our state
-	if err := d.discoverContainers(); err != nil {
+	if err := d.discoverContainers(msgContext(msg), nil); err != nil {
 		log.Printf("Failed to discover containers during refresh: %v", err)
 	}
 	
@@ -475,14 +701,13 @@ func (d *Daemon) handleRefreshAll(msg *Message) *Message {
 
 func (d *Daemon) handleTriggerDiscovery(msg *Message) *Message {
 	// Trigger container discovery immediately
-	if err := d.discoverContainers(); err != nil {
-		return &Message{
-			Type: MsgError,
-			ID:   msg.ID,
-			Payload: mustMarshal(ErrorResponse{
-				Error: fmt.Sprintf("failed to discover containers: %v", err),
-			}),
-		}
+	discoveryStart := time.Now()
+	err := d.discoverContainers(msgContext(msg), nil)
+	if msg.TraceID != "" {
+		log.Printf("[trace %s] discovery took %v", msg.TraceID, time.Since(discoveryStart))
+	}
+	if err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInternal, fmt.Sprintf("failed to discover containers: %v", err))
 	}
 	
 	return &Message{
@@ -494,20 +719,36 @@ func (d *Daemon) handleTriggerDiscovery(msg *Message) *Message {
 	}
 }
 
-func (d *Daemon) handleRequestForkID(msg *Message) *Message {
+func (d *Daemon) handleSetNote(msg *Message) *Message {
+	var req SetNoteRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+	
+	// The CLI persists the note; the daemon only mirrors it for listings
 	d.forksMu.Lock()
-	forkID := fmt.Sprintf("%d", d.nextForkID)
-	d.nextForkID++
+	fork, exists := d.forks[req.ForkID]
+	if exists {
+		if fork.Metadata == nil {
+			fork.Metadata = make(map[string]string)
+		}
+		if req.Note == "" {
+			delete(fork.Metadata, NoteMetadataKey)
+		} else {
+			fork.Metadata[NoteMetadataKey] = req.Note
+		}
+	}
 	d.forksMu.Unlock()
 	
-	// Save state with updated counter
-	go d.saveState()
+	if !exists {
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
+	}
 	
 	return &Message{
-		Type: MsgForkID,
+		Type: MsgSuccess,
 		ID:   msg.ID,
-		Payload: mustMarshal(RequestForkIDResponse{
-			ForkID: forkID,
+		Payload: mustMarshal(SuccessResponse{
+			Message: fmt.Sprintf("Note set for fork %s", req.ForkID),
 		}),
 	}
 }
@@ -535,9 +776,9 @@ func (d *Daemon) validateAndCleanupForks() error {
 	
 	// Create Docker client
 	clientStart := time.Now()
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := docker.NewRuntime()
 	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %w", err)
+		return err
 	}
 	defer cli.Close()
 	debugLog("Docker client created (took %v)", time.Since(clientStart))
@@ -556,9 +797,13 @@ func (d *Daemon) validateAndCleanupForks() error {
 	}
 	debugLog("Listed %d containers with worklet.session label (took %v)", len(containers), time.Since(listStart))
 
-	// Create a map of existing session IDs for quick lookup
+	// Create a map of running session IDs for quick lookup
 	existingSessionIDs := make(map[string]bool)
 	for _, c := range containers {
+		// Restarting containers keep their registration until they're back
+		if c.State != "running" && c.State != "restarting" {
+			continue
+		}
 		if sessionID, ok := c.Labels["worklet.session.id"]; ok && sessionID != "" {
 			existingSessionIDs[sessionID] = true
 		}
@@ -588,9 +833,6 @@ func (d *Daemon) validateAndCleanupForks() error {
 	debugLog("Released write lock after validation (lock held for %v)", time.Since(lockStart))
 
 	if len(forksToRemove) > 0 {
-		// Invalidate cache since we modified forks
-		d.invalidateCache()
-		
 		// Update nginx configuration (now safe to call)
 		nginxStart := time.Now()
 		d.updateNginxConfig()
@@ -603,26 +845,29 @@ func (d *Daemon) validateAndCleanupForks() error {
 	return nil
 }
 
-// discoverContainers finds running worklet containers by labels and registers them
-func (d *Daemon) discoverContainers() error {
+// discoverContainers finds running worklet containers by labels and registers
+// them. Containers whose project is gone are left out, and they and ones
+// failing their health check are recorded in report when it isn't nil.
+func (d *Daemon) discoverContainers(ctx context.Context, report *ReconcileReport) (err error) {
 	startTime := time.Now()
 	debugLog("discoverContainers started")
 	
+	ctx, endSpan := trace.StartSpan(ctx, "discover containers")
+	defer func() { endSpan(err) }()
+	
 	// Create Docker client
-	clientStart := time.Now()
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := docker.NewRuntime()
 	if err != nil {
-		return fmt.Errorf("failed to create Docker client: %w", err)
+		return err
 	}
 	defer cli.Close()
-	debugLog("Docker client created (took %v)", time.Since(clientStart))
 	
 	// List containers with worklet.session=true label
 	filters := filters.NewArgs()
 	filters.Add("label", "worklet.session=true")
 	
 	listStart := time.Now()
-	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
 		All:     true,
 		Filters: filters,
 	})
@@ -632,167 +877,55 @@ func (d *Daemon) discoverContainers() error {
 	debugLog("Listed %d containers (took %v)", len(containers), time.Since(listStart))
 	
 	// Prepare fork information without holding the lock
-	type pendingFork struct {
-		forkID      string
-		projectName string
-		containerID string
-		workDir     string
-		services    []ServiceInfo
-		containerName string
-	}
-	
-	var pendingForks []pendingFork
-	
-	processStart := time.Now()
-	debugLog("Starting to process %d containers", len(containers))
+	var pendingForks []*ForkInfo
 	
-	for i, container := range containers {
-		containerStart := time.Now()
+	for _, container := range containers {
 		containerName := "(unnamed)"
 		if len(container.Names) > 0 {
 			containerName = container.Names[0]
 		}
-		debugLog("Processing container %d/%d: %s (state: %s)", i+1, len(containers), containerName, container.State)
 		
 		// Skip if container is not running
 		if container.State != "running" {
-			debugLog("  Skipping non-running container %s", containerName)
+			debugLog("Skipping non-running container %s", containerName)
 			continue
 		}
 		
-		// Extract fork information from labels
 		forkID := container.Labels["worklet.session.id"]
-		projectName := container.Labels["worklet.project.name"]
-		workDir := container.Labels["worklet.workdir"]
-		debugLog("  Container %s: forkID=%s, project=%s, workdir=%s", containerName, forkID, projectName, workDir)
-		
 		if forkID == "" {
-			debugLog("  Skipping container %s: no session ID", containerName)
+			debugLog("Skipping container %s: no session ID", containerName)
 			continue
 		}
 		
 		// Check if fork is already registered (quick check with read lock)
-		lockCheckStart := time.Now()
 		d.forksMu.RLock()
 		_, exists := d.forks[forkID]
 		d.forksMu.RUnlock()
-		debugLog("  Checked fork existence for %s: exists=%v (took %v)", forkID, exists, time.Since(lockCheckStart))
-		
 		if exists {
-			debugLog("  Fork %s already registered, skipping", forkID)
 			continue
 		}
 		
-		// Load services from .worklet.jsonc if workdir is available
-		// This is done OUTSIDE the lock
-		var services []ServiceInfo
-		
-		if workDir != "" {
-			// Try to load config from workdir
-			configPath := filepath.Join(workDir, ".worklet.jsonc")
-			debugLog("  Attempting to read config from %s", configPath)
-			readStart := time.Now()
-			if configData, err := os.ReadFile(configPath); err == nil {
-				debugLog("  Successfully read config file %s (%d bytes, took %v)", configPath, len(configData), time.Since(readStart))
-				// Parse the config to get services
-				parseStart := time.Now()
-				var cfg struct {
-					Services []struct {
-						Name      string `json:"name"`
-						Port      int    `json:"port"`
-						Subdomain string `json:"subdomain"`
-					} `json:"services"`
-				}
-				
-				if err := json.Unmarshal(configData, &cfg); err == nil {
-					debugLog("  Parsed config successfully, found %d services (took %v)", len(cfg.Services), time.Since(parseStart))
-					// Use services from config file
-					for _, svc := range cfg.Services {
-						services = append(services, ServiceInfo{
-							Name:      svc.Name,
-							Port:      svc.Port,
-							Subdomain: svc.Subdomain,
-						})
-					}
-				} else {
-					log.Printf("Failed to parse config for fork %s: %v", forkID, err)
-					debugLog("  Config parse failed (took %v): %v", time.Since(parseStart), err)
-				}
-			} else {
-				log.Printf("Failed to read config for fork %s: %v", forkID, err)
-				debugLog("  Config read failed (took %v): %v", time.Since(readStart), err)
-			}
-		} else {
-			debugLog("  No workdir specified, skipping config file load")
-		}
-		
-		// If we couldn't load from config, fall back to labels (for backward compatibility)
-		if len(services) == 0 {
-			labelStart := time.Now()
-			serviceMap := make(map[string]*ServiceInfo)
-			serviceLabels := 0
-			
-			for label, value := range container.Labels {
-				if strings.HasPrefix(label, "worklet.service.") {
-					serviceLabels++
-					parts := strings.Split(label, ".")
-					if len(parts) == 4 {
-						serviceName := parts[2]
-						field := parts[3]
-						
-						if _, ok := serviceMap[serviceName]; !ok {
-							serviceMap[serviceName] = &ServiceInfo{Name: serviceName}
-						}
-						
-						switch field {
-						case "port":
-							if port, err := strconv.Atoi(value); err == nil {
-								serviceMap[serviceName].Port = port
-							}
-						case "subdomain":
-							serviceMap[serviceName].Subdomain = value
-						}
-					}
-				}
-			}
-			
-			debugLog("  Found %d service labels, extracted %d services (took %v)", serviceLabels, len(serviceMap), time.Since(labelStart))
-			
-			// Convert service map to slice
-			for _, svc := range serviceMap {
-				services = append(services, *svc)
+		if reason := staleReason(container.Labels); reason != "" {
+			debugLog("Skipping container %s: %s", containerName, reason)
+			if report != nil {
+				report.Pruned = append(report.Pruned, PrunedFork{ForkID: forkID, Reason: reason})
 			}
+			continue
 		}
 		
-		// If still no services defined, add a default service
-		// This ensures containers without explicit services still get nginx routing
-		if len(services) == 0 {
-			services = append(services, ServiceInfo{
-				Name:      "app",
-				Port:      3000,
-				Subdomain: "app",
-			})
-			log.Printf("No services defined for fork %s, using default service (app:3000)", forkID)
+		// Unhealthy containers stay routed, as they are when started, so
+		// nginx serves the unavailable page rather than a 404
+		fork := forkFromContainer(container.ID, container.Labels)
+		fork.StartedAt = time.Unix(container.Created, 0)
+		fork.Unhealthy = strings.Contains(container.Status, "(health: starting)") || unhealthyStatus(container.Status)
+		if unhealthyStatus(container.Status) && report != nil {
+			report.Unhealthy = append(report.Unhealthy, forkID)
 		}
-		
-		// Store pending fork info to register later
-		pendingForks = append(pendingForks, pendingFork{
-			forkID:      forkID,
-			projectName: projectName,
-			containerID: container.ID,
-			workDir:     workDir,
-			services:    services,
-			containerName: containerName,
-		})
-		debugLog("  Added fork %s to pending registration list (container processing took %v)", forkID, time.Since(containerStart))
+		pendingForks = append(pendingForks, fork)
 	}
 	
-	debugLog("Finished processing all containers (took %v, %d pending forks)", time.Since(processStart), len(pendingForks))
-	
 	// Now acquire the lock and register all pending forks
-	lockStart := time.Now()
 	d.forksMu.Lock()
-	debugLog("Acquired write lock for registration (took %v)", time.Since(lockStart))
 	
 	// Ensure forks map is initialized (defensive check)
 	if d.forks == nil {
@@ -800,39 +933,28 @@ func (d *Daemon) discoverContainers() error {
 	}
 	
 	discoveredCount := 0
-	for _, pending := range pendingForks {
+	for _, fork := range pendingForks {
 		// Double-check fork doesn't exist (in case it was added while we were preparing)
-		if _, exists := d.forks[pending.forkID]; !exists {
-			d.forks[pending.forkID] = &ForkInfo{
-				ForkID:       pending.forkID,
-				ProjectName:  pending.projectName,
-				ContainerID:  pending.containerID,
-				WorkDir:      pending.workDir,
-				Services:     pending.services,
-				RegisteredAt: time.Now(),
-				LastSeenAt:   time.Now(),
-			}
+		if _, exists := d.forks[fork.ForkID]; !exists {
+			d.forks[fork.ForkID] = fork
 			discoveredCount++
-			log.Printf("Discovered and registered fork %s from container %s", pending.forkID, pending.containerName)
+			if report != nil {
+				report.Registered = append(report.Registered, fork.ForkID)
+			}
+			log.Printf("Discovered and registered fork %s from container %s", fork.ForkID, fork.ContainerID)
 		}
 	}
 	
 	// Release the lock before calling other methods
 	d.forksMu.Unlock()
-	debugLog("Released write lock after registration (lock held for %v)", time.Since(lockStart))
 	
 	if discoveredCount > 0 {
-		// Invalidate cache since we modified forks
-		d.invalidateCache()
-		
 		// Update nginx configuration (now safe to call)
-		nginxStart := time.Now()
 		d.updateNginxConfig()
-		debugLog("Updated nginx config (took %v)", time.Since(nginxStart))
 		
 		// Ensure nginx is connected to all discovered session networks
 		if d.nginxManager != nil {
-			if err := d.nginxManager.EnsureConnectedToAllNetworks(context.Background()); err != nil {
+			if err := d.nginxManager.EnsureConnectedToAllNetworks(ctx); err != nil {
 				log.Printf("Warning: failed to connect nginx to all networks: %v", err)
 			}
 		}
@@ -844,33 +966,265 @@ func (d *Daemon) discoverContainers() error {
 	return nil
 }
 
+// registerContainer inspects a single container and registers it as a fork.
+// It is used by the event listener so a start event costs one inspect
+// instead of a full container list.
+func (d *Daemon) registerContainer(containerID string) error {
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	
+	info, err := cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	
+	if info.State == nil || !info.State.Running || info.Config == nil {
+		debugLog("Container %s is not running, skipping registration", containerID)
+		return nil
+	}
+	
+	fork := forkFromContainer(info.ID, info.Config.Labels)
+	if fork.ForkID == "" {
+		return nil
+	}
+	fork.StartedAt, _ = time.Parse(time.RFC3339Nano, info.State.StartedAt)
+	// Until a health check passes the fork isn't given aliases
+	fork.Unhealthy = info.State.Health != nil && info.State.Health.Status != "healthy"
+	
+	d.forksMu.Lock()
+	if existing, exists := d.forks[fork.ForkID]; exists {
+		// Update the existing registration with the container's state,
+		// keeping what was set over the socket. Services registered or
+		// reloaded there aren't in the labels, so they're kept unless this
+		// is a different container, such as a recreated session's.
+		merged := *existing
+		if len(merged.Services) == 0 || (existing.ContainerID != "" && existing.ContainerID != fork.ContainerID) {
+			merged.Services = fork.Services
+		}
+		merged.ContainerID = fork.ContainerID
+		merged.ProjectName = fork.ProjectName
+		merged.WorkDir = fork.WorkDir
+		merged.Alias = fork.Alias
+		merged.StartedAt = fork.StartedAt
+		merged.Unhealthy = fork.Unhealthy
+		merged.Restarting = false
+		merged.LastSeenAt = fork.LastSeenAt
+		fork = &merged
+	}
+	fork.RestartCount = info.RestartCount
+	d.forks[fork.ForkID] = fork
+	d.forksMu.Unlock()
+	
+	log.Printf("Registered fork %s from container %s", fork.ForkID, strings.TrimPrefix(info.Name, "/"))
+	
+	d.updateNginxConfig()
+	
+	// Connect nginx to the session's network
+	if d.nginxManager != nil {
+		networkName := docker.GetSessionNetworkName(fork.ForkID)
+		if err := d.nginxManager.ConnectToNetwork(context.Background(), networkName); err != nil {
+			log.Printf("Warning: failed to connect nginx to network %s: %v", networkName, err)
+		}
+	}
+	
+	return nil
+}
+
+// forkFromContainer builds fork information from a container's labels,
+// loading services from the project's config file when available
+func forkFromContainer(containerID string, labels map[string]string) *ForkInfo {
+	forkID := labels["worklet.session.id"]
+	workDir := labels["worklet.workdir"]
+	
+	var services []ServiceInfo
+	
+	if workDir != "" {
+		// Try to load config from workdir, in whichever format it's in
+		if configData, _, _, err := config.ReadConfigFile(workDir); err == nil {
+			var cfg struct {
+				Services []struct {
+					Name      string `json:"name"`
+					Port      int    `json:"port"`
+					Subdomain string `json:"subdomain"`
+					Protocol  string `json:"protocol"`
+				} `json:"services"`
+			}
+			
+			if err := json.Unmarshal(configData, &cfg); err == nil {
+				for _, svc := range cfg.Services {
+					services = append(services, ServiceInfo{
+						Name:      svc.Name,
+						Port:      svc.Port,
+						Subdomain: svc.Subdomain,
+						Protocol:  svc.Protocol,
+					})
+				}
+			} else {
+				log.Printf("Failed to parse config for fork %s: %v", forkID, err)
+			}
+		} else {
+			log.Printf("Failed to read config for fork %s: %v", forkID, err)
+		}
+	}
+	
+	// Fall back to labels (for backward compatibility), which also carry
+	// services worklet adds to the config's, such as run.browsers' endpoints
+	for _, svc := range servicesFromLabels(labels) {
+		if !hasService(services, svc.Name) {
+			services = append(services, svc)
+		}
+	}
+	
+	// If still no services defined, add a default service
+	// This ensures containers without explicit services still get nginx routing
+	if len(services) == 0 && forkID != "" {
+		services = append(services, ServiceInfo{
+			Name:      "app",
+			Port:      3000,
+			Subdomain: "app",
+		})
+		log.Printf("No services defined for fork %s, using default service (app:3000)", forkID)
+	}
+	
+	return &ForkInfo{
+		ForkID:       forkID,
+		ProjectName:  labels["worklet.project.name"],
+		ContainerID:  containerID,
+		WorkDir:      workDir,
+		Services:     services,
+		Alias:        labels[docker.LabelAlias],
+		Metadata:     withNote(forkID, nil),
+		RegisteredAt:   time.Now(),
+		LastSeenAt:     time.Now(),
+		LastActivityAt: time.Now(),
+	}
+}
+
+// servicesFromLabels returns the services recorded in a session
+// container's labels
+func servicesFromLabels(labels map[string]string) []ServiceInfo {
+	serviceMap := make(map[string]*ServiceInfo)
+	for label, value := range labels {
+		if !strings.HasPrefix(label, "worklet.service.") {
+			continue
+		}
+		parts := strings.Split(label, ".")
+		if len(parts) != 4 {
+			continue
+		}
+		serviceName := parts[2]
+		if _, ok := serviceMap[serviceName]; !ok {
+			serviceMap[serviceName] = &ServiceInfo{Name: serviceName}
+		}
+		switch parts[3] {
+		case "port":
+			if port, err := strconv.Atoi(value); err == nil {
+				serviceMap[serviceName].Port = port
+			}
+		case "subdomain":
+			serviceMap[serviceName].Subdomain = value
+		case "protocol":
+			serviceMap[serviceName].Protocol = value
+		case "host":
+			serviceMap[serviceName].Host = value
+		}
+	}
+
+	var services []ServiceInfo
+	for _, svc := range serviceMap {
+		services = append(services, *svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services
+}
+
+// hasService reports whether services include one named name
+func hasService(services []ServiceInfo, name string) bool {
+	for _, svc := range services {
+		if svc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withNote adds the fork's stored note, if any, to metadata
+func withNote(forkID string, metadata map[string]string) map[string]string {
+	store, err := notes.New()
+	if err != nil {
+		return metadata
+	}
+	text, err := store.Get(forkID)
+	if err != nil || text == "" {
+		return metadata
+	}
+	
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[NoteMetadataKey] = text
+	return metadata
+}
+
+// StateVersion is the daemon.state schema version this build writes. Files
+// without a version are version 0, which may still hold the fork map the
+// daemon kept before it rebuilt forks from Docker on startup.
+const StateVersion = 1
+
 // DaemonState represents the persistent state of the daemon
 type DaemonState struct {
-	NextForkID int `json:"next_fork_id"`
+	Version     int                    `json:"version"`
+	NextForkID  int                    `json:"next_fork_id"`
+	StreamPorts map[string]int         `json:"stream_ports,omitempty"`
+	Exits       map[string]SessionExit `json:"exits,omitempty"`
+	// Last sequential session number handed out per project
+	ProjectSequences map[string]int `json:"project_sequences,omitempty"`
+	// Fork each project's stable host names point at
+	StableSessions map[string]string `json:"stable_sessions,omitempty"`
 }
 
 // State persistence methods
 func (d *Daemon) saveState() error {
 	d.forksMu.RLock()
-	nextForkID := d.nextForkID
-	d.forksMu.RUnlock()
-	
 	state := DaemonState{
-		NextForkID: nextForkID,
+		Version:     StateVersion,
+		NextForkID:  d.nextForkID,
+		StreamPorts: make(map[string]int, len(d.streamPorts)),
+	}
+	for key, port := range d.streamPorts {
+		state.StreamPorts[key] = port
+	}
+	if len(d.exits) > 0 {
+		state.Exits = make(map[string]SessionExit, len(d.exits))
+		for sessionID, exit := range d.exits {
+			state.Exits[sessionID] = exit
+		}
+	}
+	if len(d.projectSequences) > 0 {
+		state.ProjectSequences = make(map[string]int, len(d.projectSequences))
+		for project, n := range d.projectSequences {
+			state.ProjectSequences[project] = n
+		}
+	}
+	if len(d.stableSessions) > 0 {
+		state.StableSessions = make(map[string]string, len(d.stableSessions))
+		for project, forkID := range d.stableSessions {
+			state.StableSessions[project] = forkID
+		}
 	}
+	d.forksMu.RUnlock()
 	
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return err
 	}
 	
-	// Ensure directory exists
-	stateDir := filepath.Dir(d.stateFile)
-	if err := os.MkdirAll(stateDir, 0755); err != nil {
-		return err
-	}
-	
-	return os.WriteFile(d.stateFile, data, 0600)
+	return storage.WithLock(d.stateFile, func() error {
+		return storage.WriteFileAtomic(d.stateFile, data, 0600)
+	})
 }
 
 func (d *Daemon) loadState() error {
@@ -885,20 +1239,22 @@ func (d *Daemon) loadState() error {
 	d.forksMu.Lock()
 	defer d.forksMu.Unlock()
 	
-	var state DaemonState
-	if err := json.Unmarshal(data, &state); err != nil {
-		// Try to handle old format gracefully
-		var oldState struct {
-			Forks      map[string]*ForkInfo `json:"forks"`
-			NextForkID int                  `json:"next_fork_id"`
-		}
-		if err := json.Unmarshal(data, &oldState); err != nil {
-			return err
-		}
-		// Only use nextForkID from old state
-		d.nextForkID = oldState.NextForkID
-	} else {
-		d.nextForkID = state.NextForkID
+	state, err := migrateState(data)
+	if err != nil {
+		return err
+	}
+	d.nextForkID = state.NextForkID
+	for key, port := range state.StreamPorts {
+		d.streamPorts[key] = port
+	}
+	for sessionID, exit := range state.Exits {
+		d.exits[sessionID] = exit
+	}
+	for project, n := range state.ProjectSequences {
+		d.projectSequences[project] = n
+	}
+	for project, forkID := range state.StableSessions {
+		d.stableSessions[project] = forkID
 	}
 	
 	if d.nextForkID < 1 {
@@ -908,6 +1264,42 @@ func (d *Daemon) loadState() error {
 	return nil
 }
 
+// migrateState parses a state file written by any version of the daemon,
+// upgrading older formats in memory; the next save rewrites it as
+// StateVersion
+func migrateState(data []byte) (DaemonState, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return DaemonState{}, fmt.Errorf("failed to parse state: %w", err)
+	}
+	if header.Version > StateVersion {
+		return DaemonState{}, fmt.Errorf("state version %d is newer than this daemon supports (%d)", header.Version, StateVersion)
+	}
+
+	var state DaemonState
+	switch header.Version {
+	case 0:
+		// Version 0 may hold a map of forks, which are now rediscovered
+		// from Docker; only the fork ID counter carries over
+		var old struct {
+			NextForkID  int            `json:"next_fork_id"`
+			StreamPorts map[string]int `json:"stream_ports"`
+		}
+		if err := json.Unmarshal(data, &old); err != nil {
+			return DaemonState{}, fmt.Errorf("failed to parse state: %w", err)
+		}
+		state = DaemonState{NextForkID: old.NextForkID, StreamPorts: old.StreamPorts}
+	default:
+		if err := json.Unmarshal(data, &state); err != nil {
+			return DaemonState{}, fmt.Errorf("failed to parse state: %w", err)
+		}
+	}
+	state.Version = StateVersion
+	return state, nil
+}
+
 // refreshFork refreshes information for a specific fork
 func (d *Daemon) refreshFork(forkID string) (bool, error) {
 	// Get fork info with read lock first
@@ -920,9 +1312,9 @@ func (d *Daemon) refreshFork(forkID string) (bool, error) {
 	}
 	
 	// Create Docker client
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := docker.NewRuntime()
 	if err != nil {
-		return false, fmt.Errorf("failed to create Docker client: %w", err)
+		return false, err
 	}
 	defer cli.Close()
 	
@@ -1004,9 +1396,23 @@ func (d *Daemon) updateNginxConfig() {
 		return
 	}
 	
+	updateStart := time.Now()
+	
+	d.forksMu.Lock()
+	portsChanged := d.assignStreamPorts()
+	d.forksMu.Unlock()
+	if portsChanged {
+		go d.saveState()
+	}
+	
 	d.forksMu.RLock()
 	defer d.forksMu.RUnlock()
 	
+	interceptAddress := d.interceptAddress()
+	overrides := loadRoutes()
+	fixtures := make(map[string][]byte)
+	aliases := d.forkAliases()
+	
 	var services []nginx.ForkService
 	
 	for _, fork := range d.forks {
@@ -1017,84 +1423,233 @@ func (d *Daemon) updateNginxConfig() {
 		
 		// Add each service from the fork
 		for _, svc := range fork.Services {
-			services = append(services, nginx.AddService(
+			service := nginx.AddService(
 				fork.ForkID,
 				fork.ProjectName,
 				svc.Name,
 				svc.Port,
 				svc.Subdomain,
-			))
+			)
+			service.Protocol = svc.Protocol
+			service.HostPort = svc.HostPort
+			service.Host = svc.Host
+			if interceptAddress != "" && !svc.IsStream() && intercepted(fork, svc.Name) {
+				service.InterceptAddress = interceptAddress
+			}
+			if !svc.IsStream() {
+				service.Routes = d.serviceRoutes(fork, svc, overrides[fork.ForkID], fixtures)
+				service.Aliases = aliases[fork.ForkID]
+			}
+			services = append(services, service)
 		}
 	}
 	
 	// Generate nginx config
-	nginxConfig, err := nginx.GenerateConfig(services)
+	nginxConfigs, err := nginx.GenerateConfigs(services, nginx.Options{IPv6: d.nginxManager.IPv6(), InterceptSecret: d.interceptSecret})
 	if err != nil {
 		log.Printf("Failed to generate nginx config: %v", err)
+		d.recordNginxUpdate(nil, fmt.Errorf("failed to generate nginx config: %w", err))
 		return
 	}
 	
+	if err := d.nginxManager.WriteFixtures(fixtures); err != nil {
+		log.Printf("Failed to write route fixtures: %v", err)
+	}
+	
 	// Update nginx configuration
-	if err := d.nginxManager.UpdateConfig(context.Background(), nginxConfig); err != nil {
+	ctx, endSpan := trace.StartSpan(context.Background(), "update nginx config", attribute.Int("worklet.services", len(services)))
+	disabled, err := d.nginxManager.UpdateConfig(ctx, nginxConfigs)
+	endSpan(err)
+	d.recordNginxUpdate(disabled, err)
+	if err != nil {
 		log.Printf("Failed to update nginx config: %v", err)
 		return
 	}
 	
-	log.Printf("Updated nginx configuration with %d services", len(services))
+	log.Printf("Updated nginx configuration with %d services (took %v)", len(services), time.Since(updateStart))
 }
 
-// startEventListener listens for Docker container events and updates fork state in real-time
+// startEventListener listens for Docker container events and drives the fork
+// registry from them in real-time, subscribing again whenever the stream
+// ends until the daemon stops
 func (d *Daemon) startEventListener() {
+	for {
+		failed := d.listenEvents()
+		
+		// Give Docker a moment after a failure; a subscription ended by
+		// reconnectEvents is renewed straight away
+		retryDelay := time.Duration(0)
+		if failed {
+			retryDelay = 5 * time.Second
+		}
+		select {
+		case <-d.ctx.Done():
+			log.Printf("Stopping Docker event listener")
+			return
+		case <-time.After(retryDelay):
+		}
+		
+		d.healthMu.Lock()
+		d.eventReconnects++
+		d.healthMu.Unlock()
+		
+		// Catch up on anything that changed while we weren't subscribed
+		d.reconcile()
+	}
+}
+
+// listenEvents subscribes to Docker events and handles them until the
+// stream fails, the daemon stops or reconnectEvents ends the subscription. It
+// reports whether the stream failed.
+func (d *Daemon) listenEvents() bool {
 	// Create Docker client
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	cli, err := docker.NewRuntime()
 	if err != nil {
 		log.Printf("Failed to create Docker client for event listener: %v", err)
-		return
+		return true
 	}
 	defer cli.Close()
 	
-	// Set up filters for worklet containers
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	
+	// Set up filters for worklet container lifecycle events
 	eventFilters := filters.NewArgs()
 	eventFilters.Add("type", string(events.ContainerEventType))
 	eventFilters.Add("label", "worklet.session=true")
+	for _, action := range []events.Action{
+		events.ActionCreate,
+		events.ActionStart,
+		events.ActionKill,
+		events.ActionDie,
+		events.ActionDestroy,
+		events.ActionExecStart,
+		events.ActionHealthStatus,
+	} {
+		eventFilters.Add("event", string(action))
+	}
 	
 	// Subscribe to events
-	eventsChan, errChan := cli.Events(d.ctx, events.ListOptions{
+	eventsChan, errChan := cli.Events(ctx, events.ListOptions{
 		Filters: eventFilters,
 	})
+	d.setEventStream(cancel)
+	defer d.setEventStream(nil)
 	
 	log.Printf("Started Docker event listener for worklet containers")
 	
 	for {
 		select {
 		case event := <-eventsChan:
-			// Handle container lifecycle events
+			d.noteEvent()
+			sessionID := event.Actor.Attributes["worklet.session.id"]
+			debugLog("Docker event: %s for container %s (session %s)", event.Action, event.Actor.ID, sessionID)
+			
+			// Exec actions carry the command, e.g. "exec_start: sh"
+			if strings.HasPrefix(string(event.Action), string(events.ActionExecStart)) {
+				d.touchFork(sessionID, time.Unix(0, event.TimeNano))
+				continue
+			}
+			
+			// Containers not registered yet are routed once they're
+			// healthy; aliases follow the health of registered ones
+			if strings.HasPrefix(string(event.Action), string(events.ActionHealthStatus)) {
+				healthy := event.Action == events.ActionHealthStatus+": healthy"
+				if !d.setForkHealth(sessionID, healthy) && healthy {
+					if err := d.registerContainer(event.Actor.ID); err != nil {
+						log.Printf("Failed to register container after health event: %v", err)
+					}
+				}
+				continue
+			}
+			
 			switch event.Action {
-			case "die", "stop", "kill", "remove":
-				// Extract session ID from event attributes
-				sessionID := event.Actor.Attributes["worklet.session.id"]
+			case events.ActionCreate:
+				// Nothing is routable until the container starts
+			case events.ActionStart:
+				d.clearExit(sessionID)
+				if err := d.registerContainer(event.Actor.ID); err != nil {
+					log.Printf("Failed to register container after start event: %v", err)
+				}
+			case events.ActionKill:
+				// Stopped or killed rather than finished on its own
+				d.markStopped(event.Actor.ID)
+			case events.ActionDie:
 				if sessionID != "" {
-					d.handleContainerRemoved(sessionID)
+					d.handleContainerDied(event.Actor.ID, sessionID, event.Actor.Attributes)
 				}
-			case "start":
-				// When a container starts, re-discover to pick it up
-				if err := d.discoverContainers(); err != nil {
-					log.Printf("Failed to discover containers after start event: %v", err)
+			case events.ActionDestroy:
+				if sessionID != "" {
+					d.handleContainerRemoved(sessionID)
 				}
 			}
 		case err := <-errChan:
 			if err != nil {
+				if ctx.Err() != nil {
+					return false
+				}
 				log.Printf("Docker event stream error: %v", err)
-				// Try to reconnect after a delay
-				time.Sleep(5 * time.Second)
-				go d.startEventListener() // Restart the listener
-				return
+				return true
 			}
-		case <-d.ctx.Done():
-			log.Printf("Stopping Docker event listener")
-			return
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// handleContainerDied removes a fork when its container exits, unless
+// Docker is about to restart it under its restart policy. Its routes are kept
+// until then. The exit is recorded for `worklet wait`, and announced as
+// configured in the notifications settings.
+func (d *Daemon) handleContainerDied(containerID, sessionID string, attributes map[string]string) {
+	exitCode, _ := strconv.Atoi(attributes["exitCode"])
+	stopped := d.takeStopped(containerID)
+	restarting, startedAt := containerExitState(containerID)
+
+	if !restarting {
+		exit := SessionExit{
+			SessionID:   sessionID,
+			ProjectName: attributes["worklet.project.name"],
+			ExitCode:    exitCode,
+			Succeeded:   exitCode == 0,
+			Stopped:     stopped,
+			FinishedAt:  time.Now(),
+		}
+		if !startedAt.IsZero() {
+			exit.Duration = exit.FinishedAt.Sub(startedAt).Seconds()
 		}
+		d.recordExit(exit)
+		go d.notifyExit(exit)
+		d.handleContainerRemoved(sessionID)
+		return
+	}
+
+	d.forksMu.Lock()
+	if fork, ok := d.forks[sessionID]; ok {
+		fork.Restarting = true
+		fork.LastExitCode = exitCode
+	}
+	d.forksMu.Unlock()
+
+	log.Printf("Container for session %s exited with code %d, waiting for Docker to restart it", sessionID, exitCode)
+}
+
+// containerExitState reports whether Docker will restart an exited
+// container, and when it last started. Docker decides on the restart before
+// it sends the die event.
+func containerExitState(containerID string) (bool, time.Time) {
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		return false, time.Time{}
+	}
+	defer cli.Close()
+
+	info, err := cli.ContainerInspect(context.Background(), containerID)
+	if err != nil || info.State == nil {
+		return false, time.Time{}
 	}
+	startedAt, _ := time.Parse(time.RFC3339Nano, info.State.StartedAt)
+	return info.State.Restarting, startedAt
 }
 
 // handleContainerRemoved removes a fork when its container is removed
@@ -1106,6 +1661,10 @@ func (d *Daemon) handleContainerRemoved(sessionID string) {
 	if exists {
 		log.Printf("Container for session %s was removed, cleaning up fork registration", sessionID)
 		delete(d.forks, sessionID)
+		if d.stableSessions[fork.ProjectName] == sessionID {
+			delete(d.stableSessions, fork.ProjectName)
+			go d.saveState()
+		}
 	}
 	
 	// Release lock before calling updateNginxConfig to avoid deadlock
@@ -1113,9 +1672,6 @@ func (d *Daemon) handleContainerRemoved(sessionID string) {
 	
 	// Update nginx configuration if a fork was removed (now safe to call)
 	if exists {
-		// Invalidate cache since we modified forks
-		d.invalidateCache()
-		
 		d.updateNginxConfig()
 		
 		// Clean up the session network if no containers are using it
@@ -1134,21 +1690,18 @@ func (d *Daemon) handleContainerRemoved(sessionID string) {
 	}
 }
 
-// invalidateCache marks the forks cache as invalid
-func (d *Daemon) invalidateCache() {
-	d.forksCacheMu.Lock()
-	d.forksCacheTime = time.Time{} // Zero time means cache is invalid
-	d.forksCacheMu.Unlock()
-	debugLog("Fork cache invalidated")
-}
-
 // Helper functions
 func errorResponse(id, errMsg string) *Message {
+	return errorResponseWithCode(id, "", errMsg)
+}
+
+func errorResponseWithCode(id, code, errMsg string) *Message {
 	return &Message{
 		Type: MsgError,
 		ID:   id,
 		Payload: mustMarshal(ErrorResponse{
 			Error: errMsg,
+			Code:  code,
 		}),
 	}
 }
@@ -1161,38 +1714,41 @@ func mustMarshal(v interface{}) json.RawMessage {
 	return data
 }
 
-// startPeriodicDiscovery periodically discovers containers in the background
-func (d *Daemon) startPeriodicDiscovery() {
-	// Initial delay to let the daemon start up
-	time.Sleep(5 * time.Second)
-	
-	ticker := time.NewTicker(30 * time.Second)
+// startFallbackReconcile periodically does a full container scan. The event
+// listener keeps the registry current; this only catches missed events.
+func (d *Daemon) startFallbackReconcile() {
+	ticker := time.NewTicker(reconcileInterval)
 	defer ticker.Stop()
 	
 	for {
 		select {
 		case <-ticker.C:
-			debugLog("Running periodic container discovery")
-			if err := d.discoverContainers(); err != nil {
-				log.Printf("Periodic container discovery failed: %v", err)
-			}
-			if err := d.validateAndCleanupForks(); err != nil {
-				log.Printf("Periodic fork validation failed: %v", err)
-			}
-			
-			// Clean up orphaned networks
-			if removedCount, err := docker.CleanupOrphanedNetworks(); err != nil {
-				log.Printf("Failed to cleanup orphaned networks: %v", err)
-			} else if removedCount > 0 {
-				log.Printf("Cleaned up %d orphaned network(s)", removedCount)
-			}
+			debugLog("Running fallback reconcile")
+			d.reconcile()
 		case <-d.ctx.Done():
-			debugLog("Stopping periodic discovery")
+			debugLog("Stopping fallback reconcile")
 			return
 		}
 	}
 }
 
+// reconcile syncs the fork registry with the containers Docker reports
+func (d *Daemon) reconcile() {
+	if err := d.discoverContainers(context.Background(), nil); err != nil {
+		log.Printf("Container discovery failed: %v", err)
+	}
+	if err := d.validateAndCleanupForks(); err != nil {
+		log.Printf("Fork validation failed: %v", err)
+	}
+	
+	// Clean up orphaned networks
+	if removedCount, err := docker.CleanupOrphanedNetworks(); err != nil {
+		log.Printf("Failed to cleanup orphaned networks: %v", err)
+	} else if removedCount > 0 {
+		log.Printf("Cleaned up %d orphaned network(s)", removedCount)
+	}
+}
+
 // startNginxHealthCheck periodically checks nginx health and restarts if needed
 func (d *Daemon) startNginxHealthCheck() {
 	if d.nginxManager == nil {
@@ -1287,6 +1843,12 @@ func (d *Daemon) startPIDChecker() {
 
 // checkAndUpdatePIDFile checks for other daemons and updates PID file
 func (d *Daemon) checkAndUpdatePIDFile() error {
+	lock, err := storage.Lock(d.pidFile)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	
 	// Read current PID file
 	data, err := os.ReadFile(d.pidFile)
 	if err != nil && !os.IsNotExist(err) {
@@ -1333,27 +1895,30 @@ func (d *Daemon) checkAndUpdatePIDFile() error {
 // updatePIDFile writes the current PID to file
 func (d *Daemon) updatePIDFile() error {
 	myPID := os.Getpid()
-	return d.writePIDFile([]int{myPID})
+	return storage.WithLock(d.pidFile, func() error {
+		return d.writePIDFile([]int{myPID})
+	})
 }
 
-// writePIDFile writes PIDs to the file
+// writePIDFile writes PIDs to the file. Callers must hold the PID file lock.
 func (d *Daemon) writePIDFile(pids []int) error {
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(d.pidFile), 0755); err != nil {
-		return err
-	}
-	
 	var lines []string
 	for _, pid := range pids {
 		lines = append(lines, strconv.Itoa(pid))
 	}
 	
 	data := []byte(strings.Join(lines, "\n") + "\n")
-	return os.WriteFile(d.pidFile, data, 0644)
+	return storage.WriteFileAtomic(d.pidFile, data, 0644)
 }
 
 // removePIDFromFile removes current PID from the file
 func (d *Daemon) removePIDFromFile() {
+	lock, err := storage.Lock(d.pidFile)
+	if err != nil {
+		return
+	}
+	defer lock.Unlock()
+	
 	data, err := os.ReadFile(d.pidFile)
 	if err != nil {
 		return
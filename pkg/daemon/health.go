@@ -0,0 +1,253 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/docker"
+)
+
+// Self-check limits
+const (
+	selfCheckInterval     = 30 * time.Second
+	selfCheckTimeout      = 2 * time.Second
+	slowAcceptThreshold   = time.Second
+	maxHealthyGoroutines  = 5000
+	openFilesWarnPercent  = 80
+	maxRecordedRecoveries = 20
+)
+
+// startSelfCheck periodically checks the daemon's own health and recovers
+// from what it can
+func (d *Daemon) startSelfCheck() {
+	ticker := time.NewTicker(selfCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			report := d.selfCheck()
+			if !report.Healthy {
+				log.Printf("Self-check found problems: %v", report.Problems)
+			}
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// selfCheck measures the socket's latency, Docker's reachability and the
+// process's resources. When Docker comes back after being unreachable, the
+// event stream is reconnected, since it may have silently stopped.
+func (d *Daemon) selfCheck() HealthReport {
+	report := HealthReport{
+		Uptime:     time.Since(d.startTime).Seconds(),
+		Goroutines: runtime.NumGoroutine(),
+		OpenFiles:  countOpenFiles(),
+		CheckedAt:  time.Now(),
+	}
+	report.MaxOpenFiles = maxOpenFiles()
+
+	if latency, err := d.measureAccept(); err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("socket health check failed: %v", err))
+	} else {
+		report.AcceptLatency = milliseconds(latency)
+		if latency > slowAcceptThreshold {
+			report.Problems = append(report.Problems, fmt.Sprintf("socket health check took %v", latency.Round(time.Millisecond)))
+		}
+	}
+
+	latency, dockerErr := pingDocker(d.ctx)
+	if dockerErr != nil {
+		report.DockerError = dockerErr.Error()
+		report.Problems = append(report.Problems, fmt.Sprintf("Docker is unreachable: %v", dockerErr))
+	} else {
+		report.DockerLatency = milliseconds(latency)
+	}
+
+	if report.Goroutines > maxHealthyGoroutines {
+		report.Problems = append(report.Problems, fmt.Sprintf("%d goroutines are running", report.Goroutines))
+	}
+	if report.MaxOpenFiles > 0 && report.OpenFiles*100 > report.MaxOpenFiles*openFilesWarnPercent {
+		report.Problems = append(report.Problems, fmt.Sprintf("%d of %d file descriptors are open", report.OpenFiles, report.MaxOpenFiles))
+	}
+
+	d.healthMu.Lock()
+	dockerWasDown := d.dockerDown
+	d.dockerDown = dockerErr != nil
+	d.healthMu.Unlock()
+	if dockerErr == nil && dockerWasDown {
+		d.reconnectEvents("Docker became reachable again")
+	}
+
+	d.healthMu.Lock()
+	report.EventsConnected = d.eventsCancel != nil
+	report.EventReconnects = d.eventReconnects
+	report.LastEventAt = d.lastEventAt
+	report.Recoveries = append([]HealthRecovery(nil), d.recoveries...)
+	report.Reconciliation = d.reconcileReport
+	report.Nginx = d.nginxStatus
+	d.healthMu.Unlock()
+	if !report.EventsConnected {
+		report.Problems = append(report.Problems, "not subscribed to Docker events")
+	}
+	if report.Nginx.Error != "" {
+		report.Problems = append(report.Problems, fmt.Sprintf("the last nginx config update failed: %s", report.Nginx.Error))
+	}
+	for _, forkID := range slices.Sorted(maps.Keys(report.Nginx.Disabled)) {
+		report.Problems = append(report.Problems, fmt.Sprintf("fork %s's routes are disabled: nginx rejected its config", forkID))
+	}
+
+	report.Healthy = len(report.Problems) == 0
+	return report
+}
+
+// measureAccept times a health check round trip over the daemon's socket
+func (d *Daemon) measureAccept() (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("unix", d.socketPath, selfCheckTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(selfCheckTimeout))
+
+	if err := json.NewEncoder(conn).Encode(Message{Type: MsgHealthCheck, ID: "self-check"}); err != nil {
+		return 0, err
+	}
+	var resp Message
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return 0, err
+	}
+	if resp.Type != MsgSuccess {
+		return 0, fmt.Errorf("unexpected response type: %s", resp.Type)
+	}
+	return time.Since(start), nil
+}
+
+// pingDocker times a ping of the Docker API
+func pingDocker(ctx context.Context) (time.Duration, error) {
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		return 0, err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	if _, err := cli.Ping(ctx); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+// reconnectEvents ends the current Docker event subscription so the
+// listener subscribes again and catches up
+func (d *Daemon) reconnectEvents(reason string) {
+	d.healthMu.Lock()
+	cancel := d.eventsCancel
+	if cancel != nil {
+		d.recordRecovery("reconnected the Docker event stream", reason)
+	}
+	d.healthMu.Unlock()
+
+	if cancel != nil {
+		log.Printf("Reconnecting the Docker event stream: %s", reason)
+		cancel()
+	}
+}
+
+// recordRecovery keeps a recovery action for the health report. healthMu
+// must be held.
+func (d *Daemon) recordRecovery(action, reason string) {
+	d.recoveries = append(d.recoveries, HealthRecovery{Action: action, Reason: reason, At: time.Now()})
+	if len(d.recoveries) > maxRecordedRecoveries {
+		d.recoveries = d.recoveries[len(d.recoveries)-maxRecordedRecoveries:]
+	}
+}
+
+// recordNginxUpdate records the outcome of an nginx config update: the forks
+// whose config nginx rejected, or why the whole update failed
+func (d *Daemon) recordNginxUpdate(disabled map[string]string, err error) {
+	d.healthMu.Lock()
+	defer d.healthMu.Unlock()
+
+	if err == nil {
+		d.nginxStatus = NginxStatus{LastUpdateAt: time.Now(), Disabled: disabled}
+		return
+	}
+	d.nginxStatus.Error = err.Error()
+	d.nginxStatus.FailedAt = time.Now()
+	d.nginxStatus.RolledBack = false
+	var configErr *docker.NginxConfigError
+	if errors.As(err, &configErr) {
+		d.nginxStatus.Error = configErr.Output
+		d.nginxStatus.RolledBack = configErr.RolledBack
+		if configErr.RolledBack {
+			d.recordRecovery("rolled back the nginx config", configErr.Output)
+		}
+	}
+}
+
+// setEventStream records whether the daemon is subscribed to Docker events,
+// and how to end the subscription
+func (d *Daemon) setEventStream(cancel context.CancelFunc) {
+	d.healthMu.Lock()
+	defer d.healthMu.Unlock()
+	d.eventsCancel = cancel
+}
+
+// noteEvent records that a Docker event arrived
+func (d *Daemon) noteEvent() {
+	d.healthMu.Lock()
+	defer d.healthMu.Unlock()
+	d.lastEventAt = time.Now()
+}
+
+// handleHealthCheck answers a health check, with the self-check's report
+// when details are asked for
+func (d *Daemon) handleHealthCheck(msg *Message) *Message {
+	var req HealthCheckRequest
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+		}
+	}
+	if !req.Details {
+		return &Message{
+			Type: MsgSuccess,
+			ID:   msg.ID,
+		}
+	}
+
+	return &Message{
+		Type:    MsgSuccess,
+		ID:      msg.ID,
+		Payload: mustMarshal(d.selfCheck()),
+	}
+}
+
+// countOpenFiles returns how many file descriptors the process has open, or
+// -1 where that can't be read
+func countOpenFiles() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries)
+		}
+	}
+	return -1
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
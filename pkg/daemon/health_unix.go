@@ -0,0 +1,15 @@
+//go:build !windows
+
+package daemon
+
+import "syscall"
+
+// maxOpenFiles returns the soft limit on open file descriptors, or 0 if it
+// can't be read
+func maxOpenFiles() int {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	return int(limit.Cur)
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package daemon
+
+// maxOpenFiles is not known on Windows
+func maxOpenFiles() int {
+	return 0
+}
@@ -0,0 +1,124 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/google/uuid"
+	"github.com/nolanleung/worklet/internal/docker"
+)
+
+// reservationTTL is how long a handed out session ID stays reserved for its
+// container to be created
+const reservationTTL = 10 * time.Minute
+
+// handleRequestForkID hands out a session ID that no container, registered
+// fork or recent reservation uses, so concurrent runs never collide
+func (d *Daemon) handleRequestForkID(msg *Message) *Message {
+	var req RequestForkIDRequest
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+		}
+	}
+
+	d.idMu.Lock()
+	defer d.idMu.Unlock()
+
+	used, err := d.sessionIDsInUse(msgContext(msg))
+	if err != nil {
+		log.Printf("Failed to check session IDs in use: %v", err)
+		return errorResponseWithCode(msg.ID, ErrCodeInternal, fmt.Sprintf("failed to check existing sessions: %v", err))
+	}
+
+	var forkID string
+	d.forksMu.Lock()
+	switch {
+	case req.Sequential && req.Project != "":
+		n := d.projectSequences[req.Project]
+		for {
+			n++
+			if forkID = strconv.Itoa(n); !used[forkID] {
+				break
+			}
+		}
+		d.projectSequences[req.Project] = n
+	case req.Sequential:
+		for {
+			forkID = strconv.Itoa(d.nextForkID)
+			d.nextForkID++
+			if !used[forkID] {
+				break
+			}
+		}
+	default:
+		for {
+			if forkID = uuid.New().String()[:8]; !used[forkID] {
+				break
+			}
+		}
+	}
+	d.forksMu.Unlock()
+	d.reservedIDs[forkID] = time.Now()
+
+	if req.Sequential {
+		// Save state with updated counter
+		go d.saveState()
+	}
+
+	return &Message{
+		Type: MsgForkID,
+		ID:   msg.ID,
+		Payload: mustMarshal(RequestForkIDResponse{
+			ForkID: forkID,
+		}),
+	}
+}
+
+// sessionIDsInUse returns the session IDs of every session container,
+// running or not, registered forks and unexpired reservations. idMu must be
+// held.
+func (d *Daemon) sessionIDsInUse(ctx context.Context) (map[string]bool, error) {
+	used := make(map[string]bool)
+
+	for forkID, at := range d.reservedIDs {
+		if time.Since(at) > reservationTTL {
+			delete(d.reservedIDs, forkID)
+			continue
+		}
+		used[forkID] = true
+	}
+
+	d.forksMu.RLock()
+	for forkID := range d.forks {
+		used[forkID] = true
+	}
+	d.forksMu.RUnlock()
+
+	cli, err := docker.NewRuntime()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	// Ephemeral containers carry a session ID too
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", "worklet.session.id")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	for _, c := range containers {
+		if forkID := c.Labels["worklet.session.id"]; forkID != "" {
+			used[forkID] = true
+		}
+	}
+	return used, nil
+}
@@ -0,0 +1,286 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/chaos"
+	"github.com/nolanleung/worklet/internal/docker"
+	"github.com/nolanleung/worklet/internal/har"
+)
+
+// The interceptor is an HTTP proxy in the daemon that nginx sends requests
+// of tapped services and services with chaos through. nginx names the fork
+// and service of each request it sends, and the interceptor marks the
+// request it sends back so nginx passes it on to the session. Both carry
+// the daemon's intercept secret, so neither trusts a client's headers.
+const (
+	interceptHeader       = "X-Worklet-Intercept"
+	interceptSecretHeader = "X-Worklet-Intercept-Secret"
+	interceptedHeader     = "X-Worklet-Intercepted"
+)
+
+// newInterceptSecret returns a random secret for a daemon's interceptor
+func newInterceptSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate intercept secret: %v", err))
+	}
+	return hex.EncodeToString(secret)
+}
+
+// interceptProxyAddress returns the address the interceptor sends requests
+// back to nginx on. The proxy is reached through localhost, which works
+// whether or not the host has IPv4.
+func (d *Daemon) interceptProxyAddress() string {
+	return net.JoinHostPort("localhost", strconv.Itoa(d.nginxManager.HTTPPort()))
+}
+
+// intercepted reports whether a service's requests go through the
+// interceptor. The caller must hold forksMu.
+func intercepted(fork *ForkInfo, service string) bool {
+	_, hasChaos := fork.Chaos[service]
+	return hasChaos || containsString(fork.Taps, service)
+}
+
+// selectHTTPServices returns the requested HTTP services of a fork, or all
+// of them when none are requested. The caller must hold forksMu.
+func selectHTTPServices(fork *ForkInfo, requested []string) ([]string, error) {
+	var httpServices []string
+	for _, svc := range fork.Services {
+		if !svc.IsStream() {
+			httpServices = append(httpServices, svc.Name)
+		}
+	}
+	for _, name := range requested {
+		if !containsString(httpServices, name) {
+			return nil, fmt.Errorf("fork %s has no HTTP service %s", fork.ForkID, name)
+		}
+	}
+	if len(requested) > 0 {
+		return requested, nil
+	}
+	return httpServices, nil
+}
+
+// interceptAddress returns the address nginx reaches the interceptor at, or
+// "" if it isn't running
+func (d *Daemon) interceptAddress() string {
+	d.interceptMu.Lock()
+	defer d.interceptMu.Unlock()
+
+	if d.interceptPort == 0 {
+		return ""
+	}
+	return net.JoinHostPort(d.interceptHost, strconv.Itoa(d.interceptPort))
+}
+
+// startInterceptor starts the interceptor if it isn't running and returns
+// its port. It listens on the host's address on the proxy network, which
+// nginx connects from. Where that address isn't the host's, as with Docker
+// Desktop's VM, it listens on localhost, which Docker Desktop forwards
+// host.docker.internal to.
+func (d *Daemon) startInterceptor() (int, error) {
+	d.interceptMu.Lock()
+	defer d.interceptMu.Unlock()
+
+	if d.interceptPort != 0 {
+		return d.interceptPort, nil
+	}
+
+	var listener net.Listener
+	host := "host.docker.internal"
+	if gateway, err := docker.NetworkGateway(docker.WorkletNetworkName); err == nil {
+		if l, err := net.Listen("tcp", net.JoinHostPort(gateway, "0")); err == nil {
+			listener, host = l, gateway
+		}
+	}
+	if listener == nil {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, fmt.Errorf("failed to listen: %w", err)
+		}
+		listener = l
+	}
+	d.interceptHost = host
+	d.interceptPort = listener.Addr().(*net.TCPAddr).Port
+
+	server := &http.Server{
+		Handler:           http.HandlerFunc(d.serveIntercepted),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	go func() {
+		<-d.ctx.Done()
+		server.Close()
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Interceptor stopped: %v", err)
+		}
+	}()
+
+	log.Printf("Started interceptor on %s", listener.Addr())
+	return d.interceptPort, nil
+}
+
+// serveIntercepted applies a service's chaos to a request nginx sent to the
+// interceptor, passes it back to nginx marked as intercepted, and records
+// the exchange if the service is tapped
+func (d *Daemon) serveIntercepted(w http.ResponseWriter, r *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(interceptSecretHeader)), []byte(d.interceptSecret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	r.Header.Del(interceptSecretHeader)
+
+	forkID, service, ok := strings.Cut(r.Header.Get(interceptHeader), "/")
+	if !ok || forkID == "" || service == "" {
+		http.Error(w, "not an intercepted request", http.StatusBadRequest)
+		return
+	}
+	r.Header.Del(interceptHeader)
+
+	d.forksMu.RLock()
+	var tapped bool
+	var chaosConfig chaos.Config
+	if fork, exists := d.forks[forkID]; exists {
+		tapped = containsString(fork.Taps, service)
+		chaosConfig = fork.Chaos[service]
+	}
+	d.forksMu.RUnlock()
+
+	started := time.Now()
+	record := func(*http.Response, *har.Body, *har.Body, time.Duration) {}
+	if tapped {
+		record = d.recorder(forkID, service, r, started)
+	}
+
+	reqBody := &har.Body{}
+	if r.Body != nil {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, reqBody), r.Body}
+	}
+
+	if !chaosConfig.IsZero() {
+		d.chaosMu.Lock()
+		delay := chaosConfig.Delay(d.chaosRand)
+		fail := chaosConfig.ShouldFail(d.chaosRand)
+		d.chaosMu.Unlock()
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+
+		if fail {
+			status := chaosConfig.Status()
+			body := fmt.Sprintf("worklet chaos: injected %d error\n", status)
+			resp := &http.Response{
+				StatusCode: status,
+				Proto:      "HTTP/1.1",
+				Header: http.Header{
+					"Content-Type":    {"text/plain; charset=utf-8"},
+					"X-Worklet-Chaos": {"error"},
+				},
+			}
+			for name, values := range resp.Header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+
+			respBody := &har.Body{}
+			respBody.Write([]byte(body))
+			record(resp, reqBody, respBody, time.Since(started))
+			return
+		}
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(&url.URL{Scheme: "http", Host: d.interceptProxyAddress()})
+			pr.Out.Host = pr.In.Host
+			pr.Out.Header.Set(interceptedHeader, d.interceptSecret)
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			wait := time.Since(started)
+			respBody := &har.Body{}
+			if resp.StatusCode == http.StatusSwitchingProtocols {
+				// Upgraded connections like WebSockets are recorded but
+				// their traffic isn't
+				record(resp, reqBody, respBody, wait)
+				return nil
+			}
+			resp.Body = &recordingBody{
+				Reader:  io.TeeReader(resp.Body, respBody),
+				Closer:  resp.Body,
+				onClose: func() { record(resp, reqBody, respBody, wait) },
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Interceptor failed to forward request for fork %s: %v", forkID, err)
+			record(nil, reqBody, &har.Body{}, time.Since(started))
+			w.WriteHeader(http.StatusBadGateway)
+		},
+		FlushInterval: -1,
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// recorder returns a function that appends an exchange to a fork's
+// recording, once
+func (d *Daemon) recorder(forkID, service string, r *http.Request, started time.Time) func(*http.Response, *har.Body, *har.Body, time.Duration) {
+	path, err := har.RecordingPath(forkID)
+	if err != nil {
+		log.Printf("Failed to record request for fork %s: %v", forkID, err)
+		return func(*http.Response, *har.Body, *har.Body, time.Duration) {}
+	}
+	clientURL := "http://" + r.Host + r.URL.RequestURI()
+	recorded := r.Clone(r.Context())
+
+	var once sync.Once
+	return func(resp *http.Response, reqBody, respBody *har.Body, wait time.Duration) {
+		once.Do(func() {
+			entry := har.NewEntry(recorded, clientURL, reqBody, resp, respBody, started, wait, time.Since(started))
+			entry.Service = service
+
+			d.recordMu.Lock()
+			err := har.Append(path, entry)
+			d.recordMu.Unlock()
+			if err != nil {
+				log.Printf("Failed to record request for fork %s: %v", forkID, err)
+			}
+		})
+	}
+}
+
+// recordingBody is a response body that records the exchange once the
+// client has been sent all of it
+type recordingBody struct {
+	io.Reader
+	io.Closer
+	onClose func()
+}
+
+func (b *recordingBody) Close() error {
+	err := b.Closer.Close()
+	b.onClose()
+	return err
+}
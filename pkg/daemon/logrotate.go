@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/logfile"
+)
+
+// logRotateInterval is how often the daemon checks the size of its log
+const logRotateInterval = 5 * time.Minute
+
+// startLogRotation rotates the daemon's log while it runs. worklet daemon
+// start rotates it before starting a daemon, but one launchd or systemd
+// starts, or that runs for weeks, would otherwise grow it without bound.
+// Only the log the daemon's output goes to is rotated, so a daemon in the
+// foreground leaves another's log alone.
+func (d *Daemon) startLogRotation() {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+	path := filepath.Join(homeDir, ".worklet", "logs", "daemon.log")
+	if !writesTo(os.Stdout, path) {
+		return
+	}
+
+	ticker := time.NewTicker(logRotateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := logfile.RotateCopy(path, logfile.DefaultRotateOptions); err != nil {
+				log.Printf("Failed to rotate the daemon log: %v", err)
+			}
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// writesTo reports whether f is the file at path
+func writesTo(f *os.File, path string) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	logInfo, err := os.Stat(path)
+	return err == nil && os.SameFile(info, logInfo)
+}
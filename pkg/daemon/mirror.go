@@ -0,0 +1,24 @@
+package daemon
+
+import (
+	"log"
+
+	"github.com/nolanleung/worklet/internal/docker"
+)
+
+// startRegistryMirror starts the registry mirror if the global config turns
+// it on, and removes one left from before it was turned off. Its cache
+// volume is kept either way.
+func (d *Daemon) startRegistryMirror() {
+	if !d.registryMirror.Enabled {
+		if err := docker.StopRegistryMirror(d.ctx); err != nil {
+			log.Printf("Failed to remove registry mirror: %v", err)
+		}
+		return
+	}
+	if err := docker.StartRegistryMirror(d.ctx, d.registryMirror); err != nil {
+		log.Printf("Failed to start registry mirror: %v", err)
+		return
+	}
+	log.Printf("Registry mirror %s is running", docker.RegistryMirrorContainer)
+}
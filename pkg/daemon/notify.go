@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// notifyTimeout bounds a desktop notification or webhook call
+const notifyTimeout = 10 * time.Second
+
+// sessionExitEvent is posted to the notifications webhook when a session's
+// main command exits
+type sessionExitEvent struct {
+	Event string `json:"event"` // Always "session.exited"
+	SessionExit
+}
+
+// markStopped records that a container was sent a signal, so its exit is
+// not announced as the command finishing
+func (d *Daemon) markStopped(containerID string) {
+	d.stoppedMu.Lock()
+	defer d.stoppedMu.Unlock()
+	d.stopped[containerID] = true
+}
+
+// takeStopped reports whether a container was signalled before it exited,
+// and forgets it
+func (d *Daemon) takeStopped(containerID string) bool {
+	d.stoppedMu.Lock()
+	defer d.stoppedMu.Unlock()
+	stopped := d.stopped[containerID]
+	delete(d.stopped, containerID)
+	return stopped
+}
+
+// notifyExit announces a session exit as configured in the notifications
+// section of the global config. It is best effort: failures are logged.
+func (d *Daemon) notifyExit(event SessionExit) {
+	settings := d.notifications
+	if !settings.Desktop && settings.Webhook == "" {
+		return
+	}
+	if event.Stopped || (settings.FailuresOnly && event.Succeeded) {
+		return
+	}
+
+	if settings.Desktop {
+		title, message := exitMessage(event)
+		if err := desktopNotify(title, message); err != nil {
+			log.Printf("Failed to show notification for session %s: %v", event.SessionID, err)
+		}
+	}
+	if settings.Webhook != "" {
+		if err := postWebhook(settings.Webhook, event); err != nil {
+			log.Printf("Failed to send webhook for session %s: %v", event.SessionID, err)
+		}
+	}
+}
+
+// notifyRevokeFailure warns, with desktop notifications on, that a
+// session's expired credentials couldn't be revoked, since it may still be
+// able to read them
+func (d *Daemon) notifyRevokeFailure(sessionID string, err error) {
+	if !d.notifications.Desktop {
+		return
+	}
+	message := fmt.Sprintf("Couldn't revoke the expired credentials of %s: %v", sessionID, err)
+	if err := desktopNotify("worklet: credentials not revoked", message); err != nil {
+		log.Printf("Failed to show notification for session %s: %v", sessionID, err)
+	}
+}
+
+// exitMessage returns the title and text of an exit notification
+func exitMessage(event SessionExit) (string, string) {
+	name := event.SessionID
+	if event.ProjectName != "" {
+		name = fmt.Sprintf("%s (%s)", event.ProjectName, event.SessionID)
+	}
+	duration := time.Duration(event.Duration * float64(time.Second)).Round(time.Second)
+
+	if event.Succeeded {
+		return "worklet: session finished", fmt.Sprintf("%s finished after %s", name, duration)
+	}
+	return "worklet: session failed", fmt.Sprintf("%s exited with code %d after %s", name, event.ExitCode, duration)
+}
+
+// desktopNotify shows a desktop notification with osascript on macOS or
+// notify-send on Linux
+func desktopNotify(title, message string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", message, title)
+		cmd = exec.CommandContext(ctx, "osascript", "-e", script)
+	case "linux":
+		cmd = exec.CommandContext(ctx, "notify-send", "--app-name=worklet", title, message)
+	default:
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, bytes.TrimSpace(output))
+	}
+	return nil
+}
+
+// postWebhook posts an event as JSON to url
+func postWebhook(url string, exit SessionExit) error {
+	body, err := json.Marshal(sessionExitEvent{Event: "session.exited", SessionExit: exit})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// maxRecordedExits is how many session exits the daemon remembers
+const maxRecordedExits = 200
+
+// recordExit remembers how a session's main command exited, dropping the
+// oldest records beyond maxRecordedExits, and saves the state
+func (d *Daemon) recordExit(exit SessionExit) {
+	d.forksMu.Lock()
+	d.exits[exit.SessionID] = exit
+	for len(d.exits) > maxRecordedExits {
+		oldest := ""
+		for sessionID, other := range d.exits {
+			if oldest == "" || other.FinishedAt.Before(d.exits[oldest].FinishedAt) {
+				oldest = sessionID
+			}
+		}
+		delete(d.exits, oldest)
+	}
+	d.forksMu.Unlock()
+
+	go d.saveState()
+}
+
+// clearExit forgets the exit of a session whose container started again
+func (d *Daemon) clearExit(sessionID string) {
+	d.forksMu.Lock()
+	_, ok := d.exits[sessionID]
+	delete(d.exits, sessionID)
+	d.forksMu.Unlock()
+
+	if ok {
+		go d.saveState()
+	}
+}
+
+func (d *Daemon) handleGetExit(msg *Message) *Message {
+	var req GetExitRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+
+	d.forksMu.RLock()
+	exit, ok := d.exits[req.ForkID]
+	d.forksMu.RUnlock()
+
+	if !ok {
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("no recorded exit for session %s", req.ForkID))
+	}
+	return &Message{
+		Type:    MsgExit,
+		ID:      msg.ID,
+		Payload: mustMarshal(exit),
+	}
+}
@@ -0,0 +1,75 @@
+package daemon
+
+import (
+	"log"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/docker"
+)
+
+// prefetchCheckInterval is how often the daemon looks for images due to be
+// prefetched
+const prefetchCheckInterval = 15 * time.Minute
+
+// prefetchIdleTime is how long no session must have started for the daemon
+// to consider itself idle, so prefetching doesn't compete with a startup
+// for bandwidth
+const prefetchIdleTime = 10 * time.Minute
+
+// startPrefetcher periodically pulls the images sessions are likely to
+// need while the daemon is idle
+func (d *Daemon) startPrefetcher() {
+	ticker := time.NewTicker(prefetchCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.prefetch()
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// prefetch pulls the images that are due, if the daemon is idle
+func (d *Daemon) prefetch() {
+	global, err := config.LoadGlobalConfig()
+	if err != nil {
+		log.Printf("Failed to load global config for prefetch: %v", err)
+		return
+	}
+	if global.Prefetch.Disabled || !d.idleSince(time.Now().Add(-prefetchIdleTime)) {
+		return
+	}
+	targets := docker.PrefetchTargets(global)
+	if !docker.PrefetchDue(global.Prefetch, targets) {
+		return
+	}
+
+	results, err := docker.Prefetch(d.ctx, global.Prefetch, targets, false, nil)
+	if err != nil && d.ctx.Err() == nil {
+		log.Printf("Prefetch: %v", err)
+	}
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			log.Printf("Failed to prefetch %s: %v", result.Image, result.Err)
+		case result.Status == docker.PrefetchUpdated:
+			log.Printf("Prefetched a newer %s (%s)", result.Image, result.Reason)
+		}
+	}
+}
+
+// idleSince reports whether no session has registered or started since t
+func (d *Daemon) idleSince(t time.Time) bool {
+	d.forksMu.RLock()
+	defer d.forksMu.RUnlock()
+	for _, fork := range d.forks {
+		if fork.RegisteredAt.After(t) || fork.StartedAt.After(t) {
+			return false
+		}
+	}
+	return true
+}
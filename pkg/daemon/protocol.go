@@ -3,6 +3,8 @@ package daemon
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/nolanleung/worklet/internal/chaos"
 )
 
 // MessageType represents the type of message sent between client and daemon
@@ -21,6 +23,12 @@ const (
 	MsgRequestForkID    MessageType = "REQUEST_FORK_ID"
 	MsgTriggerDiscovery MessageType = "TRIGGER_DISCOVERY"
 	MsgGetVersion       MessageType = "GET_VERSION"
+	MsgSetNote          MessageType = "SET_NOTE"
+	MsgSetTap           MessageType = "SET_TAP"
+	MsgSetChaos         MessageType = "SET_CHAOS"
+	MsgGetExit          MessageType = "GET_EXIT"
+	MsgSetServices      MessageType = "SET_SERVICES"
+	MsgSetStable        MessageType = "SET_STABLE"
 	
 	// Daemon -> Client responses
 	MsgSuccess        MessageType = "SUCCESS"
@@ -29,13 +37,18 @@ const (
 	MsgForkInfo       MessageType = "FORK_INFO"
 	MsgForkID         MessageType = "FORK_ID"
 	MsgVersion        MessageType = "VERSION"
+	MsgExit           MessageType = "EXIT"
+	MsgStable         MessageType = "STABLE"
 )
 
 // Message represents a message between client and daemon
 type Message struct {
-	Type    MessageType     `json:"type"`
-	ID      string          `json:"id,omitempty"`      // Request ID for correlation
-	Payload json.RawMessage `json:"payload,omitempty"`
+	Type        MessageType     `json:"type"`
+	ID          string          `json:"id,omitempty"`          // Request ID for correlation
+	TraceID     string          `json:"trace_id,omitempty"`    // Trace ID of the originating CLI operation
+	TraceParent string          `json:"traceparent,omitempty"` // W3C traceparent of the caller's span
+	Token       string          `json:"token,omitempty"`       // API token, needed over TCP
+	Payload     json.RawMessage `json:"payload,omitempty"`
 }
 
 // RegisterForkRequest is sent when a new fork is created
@@ -53,6 +66,14 @@ type ServiceInfo struct {
 	Name      string `json:"name"`
 	Port      int    `json:"port"`
 	Subdomain string `json:"subdomain"`
+	Protocol  string `json:"protocol,omitempty"`  // "tcp" or "udp" for stream services, otherwise HTTP
+	HostPort  int    `json:"host_port,omitempty"` // Localhost port of a stream service
+	Host      string `json:"host,omitempty"`      // Container serving it, if not the session's, such as an add-on's
+}
+
+// IsStream reports whether the service is proxied as a TCP or UDP stream
+func (s ServiceInfo) IsStream() bool {
+	return s.Protocol == "tcp" || s.Protocol == "udp"
 }
 
 // UnregisterForkRequest is sent when a fork is being removed
@@ -65,16 +86,41 @@ type GetForkInfoRequest struct {
 	ForkID string `json:"fork_id"`
 }
 
+// GetExitRequest asks how a session's main command exited
+type GetExitRequest struct {
+	ForkID string `json:"fork_id"`
+}
+
+// SessionExit records how a session's main command exited
+type SessionExit struct {
+	SessionID   string    `json:"session_id"`
+	ProjectName string    `json:"project_name,omitempty"`
+	ExitCode    int       `json:"exit_code"`
+	Succeeded   bool      `json:"succeeded"`
+	Stopped     bool      `json:"stopped,omitempty"` // Stopped or killed rather than exiting on its own
+	Duration    float64   `json:"duration_seconds"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
 // ForkInfo contains information about a registered fork
 type ForkInfo struct {
-	ForkID       string            `json:"fork_id"`
-	ProjectName  string            `json:"project_name"`
-	ContainerID  string            `json:"container_id,omitempty"`
-	WorkDir      string            `json:"work_dir"`
-	Services     []ServiceInfo     `json:"services,omitempty"`
-	Metadata     map[string]string `json:"metadata,omitempty"`
-	RegisteredAt time.Time         `json:"registered_at"`
-	LastSeenAt   time.Time         `json:"last_seen_at"`
+	ForkID         string            `json:"fork_id"`
+	ProjectName    string            `json:"project_name"`
+	ContainerID    string            `json:"container_id,omitempty"`
+	WorkDir        string            `json:"work_dir"`
+	Services       []ServiceInfo     `json:"services,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+	RegisteredAt   time.Time         `json:"registered_at"`
+	LastSeenAt     time.Time         `json:"last_seen_at"`
+	LastActivityAt time.Time         `json:"last_activity_at"`         // Last proxied request or exec, or registration
+	Restarting     bool              `json:"restarting,omitempty"`     // Exited and waiting to be restarted by its restart policy
+	RestartCount   int               `json:"restart_count,omitempty"`  // Times Docker restarted the container
+	LastExitCode   int               `json:"last_exit_code,omitempty"` // Exit code of the last crash
+	Taps           []string          `json:"taps,omitempty"`           // HTTP services whose requests are being recorded
+	Chaos          map[string]chaos.Config `json:"chaos,omitempty"`    // Faults injected into HTTP services' requests
+	Alias          string            `json:"alias,omitempty"`          // Project alias, from the config
+	StartedAt      time.Time         `json:"started_at,omitempty"`     // When the container last started
+	Unhealthy      bool              `json:"unhealthy,omitempty"`      // Failing its health check, or yet to pass it
 }
 
 // ListForksResponse contains a list of all registered forks
@@ -88,6 +134,19 @@ type ErrorResponse struct {
 	Code  string `json:"code,omitempty"`
 }
 
+// Error codes sent in ErrorResponse.Code
+const (
+	ErrCodeInvalidRequest     = "INVALID_REQUEST"
+	ErrCodeUnknownMessage     = "UNKNOWN_MESSAGE"
+	ErrCodeNotFound           = "NOT_FOUND"
+	ErrCodePayloadTooLarge    = "PAYLOAD_TOO_LARGE"
+	ErrCodeTooManyConnections = "TOO_MANY_CONNECTIONS"
+	ErrCodeBusy               = "BUSY"
+	ErrCodeInternal           = "INTERNAL"
+	ErrCodeUnauthorized       = "UNAUTHORIZED" // Missing or unknown API token
+	ErrCodeForbidden          = "FORBIDDEN"    // The token's role doesn't allow the request
+)
+
 // SuccessResponse is sent for successful operations
 type SuccessResponse struct {
 	Message string `json:"message,omitempty"`
@@ -103,6 +162,119 @@ type RefreshAllRequest struct {
 	// No fields needed for refresh all
 }
 
+// SetNoteRequest attaches a note to a fork, or clears it when Note is empty
+type SetNoteRequest struct {
+	ForkID string `json:"fork_id"`
+	Note   string `json:"note"`
+}
+
+// SetTapRequest starts or stops recording a fork's HTTP services. Without
+// services it applies to every HTTP service of the fork.
+type SetTapRequest struct {
+	ForkID   string   `json:"fork_id"`
+	Services []string `json:"services,omitempty"`
+	Enabled  bool     `json:"enabled"`
+}
+
+// SetChaosRequest sets the chaos of a fork's HTTP services, or clears it.
+// Without services it applies to every HTTP service of the fork.
+type SetChaosRequest struct {
+	ForkID   string       `json:"fork_id"`
+	Services []string     `json:"services,omitempty"`
+	Config   chaos.Config `json:"config"`
+	Clear    bool         `json:"clear,omitempty"`
+}
+
+// SetServicesRequest replaces the services of a running fork, as when its
+// config is reloaded
+type SetServicesRequest struct {
+	ForkID   string        `json:"fork_id"`
+	Services []ServiceInfo `json:"services"`
+}
+
+// SetStableRequest points a project's stable host names at one of its forks
+type SetStableRequest struct {
+	ProjectName string `json:"project_name"`
+	ForkID      string `json:"fork_id"`
+}
+
+// StableSession is the fork a project's stable host names point at
+type StableSession struct {
+	ProjectName string `json:"project_name"`
+	ForkID      string `json:"fork_id"`
+	Previous    string `json:"previous,omitempty"` // Fork they pointed at before, if any
+}
+
+// NoteMetadataKey is the ForkInfo.Metadata key holding the fork's note
+const NoteMetadataKey = "note"
+
+// HealthCheckRequest asks for the daemon's self-check along with the health
+// check. Without a payload only reachability is checked.
+type HealthCheckRequest struct {
+	Details bool `json:"details,omitempty"`
+}
+
+// HealthReport is the result of the daemon's self-check
+type HealthReport struct {
+	Healthy         bool             `json:"healthy"`
+	Problems        []string         `json:"problems,omitempty"`
+	Uptime          float64          `json:"uptime_seconds"`
+	AcceptLatency   float64          `json:"accept_latency_ms"` // Health check round trip over the socket
+	DockerLatency   float64          `json:"docker_ping_ms"`
+	DockerError     string           `json:"docker_error,omitempty"`
+	EventsConnected bool             `json:"events_connected"`
+	EventReconnects int              `json:"event_reconnects"`
+	LastEventAt     time.Time        `json:"last_event_at,omitempty"`
+	Goroutines      int              `json:"goroutines"`
+	OpenFiles       int              `json:"open_files"`               // -1 where they can't be counted
+	MaxOpenFiles    int              `json:"max_open_files,omitempty"` // Soft limit, where known
+	Recoveries      []HealthRecovery `json:"recoveries,omitempty"`
+	Reconciliation  *ReconcileReport `json:"reconciliation,omitempty"` // What startup reconciliation changed
+	Nginx           NginxStatus      `json:"nginx"`
+	CheckedAt       time.Time        `json:"checked_at"`
+}
+
+// NginxStatus is how the daemon's latest nginx config updates went
+type NginxStatus struct {
+	LastUpdateAt time.Time `json:"last_update_at,omitempty"` // When nginx last took a new config
+	Error        string    `json:"error,omitempty"`          // Why the latest update failed; nginx keeps serving the last good config
+	RolledBack   bool      `json:"rolled_back,omitempty"`    // The failed config was loaded and reverted
+	FailedAt     time.Time `json:"failed_at,omitempty"`
+
+	// Disabled holds the forks whose config nginx rejected at the last
+	// update, with its explanation. Other forks' routes are unaffected.
+	Disabled map[string]string `json:"disabled,omitempty"`
+}
+
+// HealthRecovery is an action the daemon took to fix itself
+type HealthRecovery struct {
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// ReconcileReport is what the daemon found when it rebuilt its registry and
+// nginx config from Docker at startup
+type ReconcileReport struct {
+	Registered    []string     `json:"registered,omitempty"`     // Forks with running, healthy containers
+	Pruned        []PrunedFork `json:"pruned,omitempty"`         // Forks left out because their project is gone
+	Unhealthy     []string     `json:"unhealthy,omitempty"`      // Forks registered while failing their health checks
+	RemovedRoutes []string     `json:"removed_routes,omitempty"` // Hosts the previous nginx config routed that are gone
+	At            time.Time    `json:"at"`
+}
+
+// PrunedFork is a fork reconciliation left out, and why
+type PrunedFork struct {
+	ForkID string `json:"fork_id"`
+	Reason string `json:"reason"`
+}
+
+// RequestForkIDRequest asks for a session ID that no container uses yet
+type RequestForkIDRequest struct {
+	Project    string `json:"project,omitempty"`    // Project the session belongs to
+	Sequential bool   `json:"sequential,omitempty"` // Number IDs per project instead of generating random ones
+}
+
 // RequestForkIDResponse contains the next available fork ID
 type RequestForkIDResponse struct {
 	ForkID string `json:"fork_id"`
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/config"
+	"github.com/nolanleung/worklet/internal/nginx"
+)
+
+// reconcileOnStartup builds the registry from session containers that exist,
+// are running and pass their health checks, regenerates the nginx config
+// from it, and reports what changed since the previous daemon's config. Routes
+// of forks that went away while no daemon was running are dropped here rather
+// than lingering until a manual restart.
+func (d *Daemon) reconcileOnStartup(ctx context.Context) {
+	report := &ReconcileReport{At: time.Now()}
+	previous := d.routedHosts()
+
+	if err := d.discoverContainers(ctx, report); err != nil {
+		log.Printf("Failed to discover containers: %v", err)
+	}
+
+	// Always rewrite the config, even with nothing registered, so the
+	// previous daemon's routes don't survive
+	d.updateNginxConfig()
+
+	current := make(map[string]bool)
+	for _, host := range d.routedHosts() {
+		current[host] = true
+	}
+	for _, host := range previous {
+		if !current[host] {
+			report.RemovedRoutes = append(report.RemovedRoutes, host)
+		}
+	}
+	sort.Strings(report.Registered)
+
+	d.healthMu.Lock()
+	d.reconcileReport = report
+	d.healthMu.Unlock()
+
+	log.Printf("Startup reconciliation: %d fork(s) registered, %d pruned, %d unhealthy, %d stale route(s) removed",
+		len(report.Registered), len(report.Pruned), len(report.Unhealthy), len(report.RemovedRoutes))
+	for _, pruned := range report.Pruned {
+		log.Printf("  Pruned fork %s: %s", pruned.ForkID, pruned.Reason)
+	}
+	for _, forkID := range report.Unhealthy {
+		log.Printf("  Fork %s is failing its health check", forkID)
+	}
+	for _, host := range report.RemovedRoutes {
+		log.Printf("  Removed route %s", host)
+	}
+}
+
+// routedHosts returns the host names the nginx config on disk routes
+func (d *Daemon) routedHosts() []string {
+	if d.nginxManager == nil {
+		return nil
+	}
+	config, err := d.nginxManager.ReadConfig()
+	if err != nil {
+		return nil
+	}
+	return nginx.ServerNames(config)
+}
+
+// staleReason returns why a session container's project is gone, or "" if
+// it isn't. Temporary work directories, such as fresh clones, are removed
+// after every run, and containers from before the label was added can't tell,
+// so only work directories known to be kept are checked.
+func staleReason(labels map[string]string) string {
+	if workDir := labels["worklet.workdir"]; workDir != "" && labels["worklet.workdir.temporary"] == "false" {
+		if _, err := os.Stat(workDir); os.IsNotExist(err) {
+			return fmt.Sprintf("work directory %s no longer exists", workDir)
+		}
+	}
+	if configFile := labels["worklet.config.file"]; configFile != "" {
+		// The config may have been converted to another format since
+		if _, err := os.Stat(configFile); os.IsNotExist(err) {
+			if _, err := config.FindConfigFile(filepath.Dir(configFile)); errors.Is(err, os.ErrNotExist) {
+				return fmt.Sprintf("config %s no longer exists", configFile)
+			}
+		}
+	}
+	return ""
+}
+
+// unhealthyStatus reports whether a container list status, such as
+// "Up 5 minutes (unhealthy)", shows a failing health check
+func unhealthyStatus(status string) bool {
+	return strings.Contains(status, "(unhealthy)")
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"log"
+	"os"
+
+	"github.com/nolanleung/worklet/internal/nginx"
+	"github.com/nolanleung/worklet/internal/routes"
+)
+
+// loadRoutes returns every session's route overrides. A broken routes file
+// is logged and ignored so it can't take the proxy down.
+func loadRoutes() map[string][]routes.Route {
+	store, err := routes.New()
+	if err != nil {
+		log.Printf("Failed to open routes: %v", err)
+		return nil
+	}
+	all, err := store.All()
+	if err != nil {
+		log.Printf("Failed to load routes: %v", err)
+		return nil
+	}
+	return all
+}
+
+// serviceRoutes resolves the route overrides of a fork's HTTP service for
+// nginx, adding the fixture files they serve to fixtures. Routes to sessions
+// that aren't registered and fixtures that can't be read are skipped. The
+// caller must hold forksMu.
+func (d *Daemon) serviceRoutes(fork *ForkInfo, svc ServiceInfo, overrides []routes.Route, fixtures map[string][]byte) []nginx.Route {
+	var resolved []nginx.Route
+	for _, route := range overrides {
+		if !route.AppliesTo(svc.Name) || route.Validate() != nil {
+			continue
+		}
+
+		location := "= " + route.Path
+		if route.IsPrefix() {
+			location = route.Prefix()
+		}
+
+		if route.File != "" {
+			content, err := os.ReadFile(route.File)
+			if err != nil {
+				log.Printf("Skipping route %s of fork %s: %v", route.Path, fork.ForkID, err)
+				continue
+			}
+			name := nginx.FixtureFile(content)
+			fixtures[name] = content
+			resolved = append(resolved, nginx.Route{
+				Location:    location,
+				Fixture:     name,
+				ContentType: route.ContentType,
+			})
+			continue
+		}
+
+		upstream, ok := d.routeUpstream(route, svc.Name)
+		if !ok {
+			log.Printf("Skipping route %s of fork %s: target %s isn't running", route.Path, fork.ForkID, route.Target)
+			continue
+		}
+		resolved = append(resolved, nginx.Route{
+			Location: location,
+			Upstream: upstream,
+		})
+	}
+	return resolved
+}
+
+// routeUpstream returns the upstream of the session a route proxies to. A
+// target without a service goes to the service with the same name as the
+// one being overridden, or else the target's first HTTP service.
+func (d *Daemon) routeUpstream(route routes.Route, serviceName string) (string, bool) {
+	targetID, targetService := route.TargetSession()
+	target, exists := d.forks[targetID]
+	if !exists {
+		return "", false
+	}
+
+	var match *ServiceInfo
+	for i, svc := range target.Services {
+		if svc.IsStream() {
+			continue
+		}
+		if targetService != "" {
+			if svc.Name == targetService {
+				match = &target.Services[i]
+				break
+			}
+			continue
+		}
+		if svc.Name == serviceName {
+			match = &target.Services[i]
+			break
+		}
+		if match == nil {
+			match = &target.Services[i]
+		}
+	}
+	if match == nil {
+		return "", false
+	}
+
+	return nginx.AddService(target.ForkID, target.ProjectName, match.Name, match.Port, match.Subdomain).Upstream(), true
+}
@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/nolanleung/worklet/internal/chaos"
+)
+
+// handleSetServices replaces a fork's services and routes them. Recording
+// and chaos carry over to the services that are kept.
+func (d *Daemon) handleSetServices(msg *Message) *Message {
+	var req SetServicesRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+
+	d.forksMu.Lock()
+	fork, exists := d.forks[req.ForkID]
+	if !exists {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
+	}
+
+	kept := make(map[string]bool)
+	for _, svc := range req.Services {
+		if !svc.IsStream() {
+			kept[svc.Name] = true
+		}
+	}
+	var taps []string
+	for _, name := range fork.Taps {
+		if kept[name] {
+			taps = append(taps, name)
+		}
+	}
+	for name := range fork.Chaos {
+		if !kept[name] {
+			delete(fork.Chaos, name)
+		}
+	}
+	if len(fork.Chaos) == 0 {
+		fork.Chaos = nil
+	}
+	fork.Taps = taps
+	fork.Services = req.Services
+	d.forksMu.Unlock()
+
+	log.Printf("Updated services of fork %s (%d services)", req.ForkID, len(req.Services))
+	d.updateNginxConfig()
+
+	// Stream services get their proxy ports while nginx is configured
+	d.forksMu.RLock()
+	info := *fork
+	info.Services = append([]ServiceInfo(nil), fork.Services...)
+	if fork.Chaos != nil {
+		info.Chaos = make(map[string]chaos.Config, len(fork.Chaos))
+		for name, config := range fork.Chaos {
+			info.Chaos[name] = config
+		}
+	}
+	d.forksMu.RUnlock()
+
+	return &Message{
+		Type:    MsgForkInfo,
+		ID:      msg.ID,
+		Payload: mustMarshal(info),
+	}
+}
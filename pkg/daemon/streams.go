@@ -0,0 +1,67 @@
+package daemon
+
+import (
+	"log"
+
+	"github.com/nolanleung/worklet/internal/nginx"
+)
+
+// streamPortKey identifies a fork's service in the stream port assignments
+func streamPortKey(forkID, service string) string {
+	return forkID + "/" + service
+}
+
+// assignStreamPorts gives every TCP and UDP service of a registered fork a
+// proxy port, keeping the port it had before, including across daemon
+// restarts. Ports of services that are gone are released. It reports
+// whether the assignments changed. The caller must hold forksMu for writing.
+func (d *Daemon) assignStreamPorts() bool {
+	changed := false
+
+	live := make(map[string]bool)
+	for _, fork := range d.forks {
+		for _, svc := range fork.Services {
+			if svc.IsStream() {
+				live[streamPortKey(fork.ForkID, svc.Name)] = true
+			}
+		}
+	}
+	used := make(map[int]bool)
+	for key, port := range d.streamPorts {
+		if !live[key] || port < nginx.StreamPortFirst || port > nginx.StreamPortLast {
+			delete(d.streamPorts, key)
+			changed = true
+			continue
+		}
+		used[port] = true
+	}
+
+	next := nginx.StreamPortFirst
+	for _, fork := range d.forks {
+		for i := range fork.Services {
+			svc := &fork.Services[i]
+			if !svc.IsStream() {
+				continue
+			}
+			key := streamPortKey(fork.ForkID, svc.Name)
+			port, ok := d.streamPorts[key]
+			if !ok {
+				for next <= nginx.StreamPortLast && used[next] {
+					next++
+				}
+				if next > nginx.StreamPortLast {
+					log.Printf("No proxy port left for %s service %s of fork %s", svc.Protocol, svc.Name, fork.ForkID)
+					svc.HostPort = 0
+					continue
+				}
+				port = next
+				used[port] = true
+				d.streamPorts[key] = port
+				changed = true
+			}
+			svc.HostPort = port
+		}
+	}
+
+	return changed
+}
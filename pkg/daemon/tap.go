@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// handleSetTap starts or stops recording a fork's HTTP services
+func (d *Daemon) handleSetTap(msg *Message) *Message {
+	var req SetTapRequest
+	if err := json.Unmarshal(msg.Payload, &req); err != nil {
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, "invalid request payload")
+	}
+
+	if req.Enabled {
+		if _, err := d.startInterceptor(); err != nil {
+			log.Printf("Failed to start interceptor: %v", err)
+			return errorResponseWithCode(msg.ID, ErrCodeInternal, fmt.Sprintf("failed to start recorder: %v", err))
+		}
+	}
+
+	d.forksMu.Lock()
+	fork, exists := d.forks[req.ForkID]
+	if !exists {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeNotFound, fmt.Sprintf("fork %s not found", req.ForkID))
+	}
+
+	selected, err := selectHTTPServices(fork, req.Services)
+	if err != nil {
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, err.Error())
+	}
+
+	switch {
+	case req.Enabled && len(selected) == 0:
+		d.forksMu.Unlock()
+		return errorResponseWithCode(msg.ID, ErrCodeInvalidRequest, fmt.Sprintf("fork %s has no HTTP services to record", req.ForkID))
+	case req.Enabled:
+		for _, name := range selected {
+			if !containsString(fork.Taps, name) {
+				fork.Taps = append(fork.Taps, name)
+			}
+		}
+		sort.Strings(fork.Taps)
+	default:
+		var kept []string
+		for _, name := range fork.Taps {
+			if !containsString(selected, name) {
+				kept = append(kept, name)
+			}
+		}
+		fork.Taps = kept
+	}
+	info := *fork
+	d.forksMu.Unlock()
+
+	d.updateNginxConfig()
+
+	return &Message{
+		Type:    MsgForkInfo,
+		ID:      msg.ID,
+		Payload: mustMarshal(info),
+	}
+}
+
+// containsString reports whether s is in list
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
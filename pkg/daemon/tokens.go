@@ -0,0 +1,217 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
+)
+
+// Role limits what a token may ask of the daemon over its TCP API. Each
+// role may do everything the ones before it may.
+type Role string
+
+const (
+	RoleReadOnly Role = "read-only" // List forks and read their state
+	RoleOperator Role = "operator"  // Also refresh forks and change notes, taps and chaos
+	RoleAdmin    Role = "admin"     // Also register, unregister and swap forks and change their routes
+)
+
+// Roles are the roles a token can have, from least to most allowed
+var Roles = []Role{RoleReadOnly, RoleOperator, RoleAdmin}
+
+// ParseRole checks a role given on the command line
+func ParseRole(s string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == s {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("invalid role %q (must be read-only, operator or admin)", s)
+}
+
+// allows reports whether a token with role r may do what needs role need
+func (r Role) allows(need Role) bool {
+	rank := func(role Role) int {
+		for i, known := range Roles {
+			if known == role {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(r) >= 0 && rank(r) >= rank(need)
+}
+
+// messageRoles is the role each message needs over the TCP API. Messages
+// that aren't listed need RoleAdmin.
+var messageRoles = map[MessageType]Role{
+	MsgListForks:        RoleReadOnly,
+	MsgGetForkInfo:      RoleReadOnly,
+	MsgHealthCheck:      RoleReadOnly,
+	MsgGetVersion:       RoleReadOnly,
+	MsgGetExit:          RoleReadOnly,
+	MsgRefreshFork:      RoleOperator,
+	MsgRefreshAll:       RoleOperator,
+	MsgTriggerDiscovery: RoleOperator,
+	MsgSetNote:          RoleOperator,
+	MsgSetTap:           RoleOperator,
+	MsgSetChaos:         RoleOperator,
+	MsgRequestForkID:    RoleOperator,
+}
+
+// requiredRole returns the role a message type needs over the TCP API
+func requiredRole(msgType MessageType) Role {
+	if role, ok := messageRoles[msgType]; ok {
+		return role
+	}
+	return RoleAdmin
+}
+
+// APIToken is an issued token. Only a hash of its secret is kept.
+type APIToken struct {
+	Name      string    `json:"name"`
+	Role      Role      `json:"role"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenStore holds the tokens of the daemon's TCP API in
+// ~/.worklet/daemon-tokens.json. The daemon reads it for every request, so
+// issuing, rotating and revoking take effect without a restart.
+type TokenStore struct {
+	path string
+}
+
+// NewTokenStore returns the store in the user's worklet directory
+func NewTokenStore() (*TokenStore, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return &TokenStore{path: filepath.Join(homeDir, ".worklet", "daemon-tokens.json")}, nil
+}
+
+// List returns the issued tokens, sorted by name
+func (s *TokenStore) List() ([]APIToken, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokens: %w", err)
+	}
+	var tokens []APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens, nil
+}
+
+func (s *TokenStore) save(tokens []APIToken) error {
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFileAtomic(s.path, data, 0600)
+}
+
+// Issue creates a token named name with role and returns its secret, which
+// isn't stored and so can't be shown again. Issuing a name that exists
+// rotates it: the old secret stops working.
+func (s *TokenStore) Issue(name string, role Role) (string, error) {
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return "", fmt.Errorf("invalid token name %q", name)
+	}
+	tokens, err := s.List()
+	if err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	secret := "wkt_" + hex.EncodeToString(buf)
+
+	token := APIToken{Name: name, Role: role, Hash: hashToken(secret), CreatedAt: time.Now()}
+	replaced := false
+	for i := range tokens {
+		if tokens[i].Name == name {
+			tokens[i] = token
+			replaced = true
+		}
+	}
+	if !replaced {
+		tokens = append(tokens, token)
+	}
+	if err := s.save(tokens); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Rotate gives the token named name a new secret, keeping its role
+func (s *TokenStore) Rotate(name string) (string, error) {
+	tokens, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	for _, token := range tokens {
+		if token.Name == name {
+			return s.Issue(name, token.Role)
+		}
+	}
+	return "", fmt.Errorf("no token named %s", name)
+}
+
+// Revoke removes the token named name
+func (s *TokenStore) Revoke(name string) error {
+	tokens, err := s.List()
+	if err != nil {
+		return err
+	}
+	kept := tokens[:0]
+	for _, token := range tokens {
+		if token.Name != name {
+			kept = append(kept, token)
+		}
+	}
+	if len(kept) == len(tokens) {
+		return fmt.Errorf("no token named %s", name)
+	}
+	return s.save(kept)
+}
+
+// Authenticate returns the token a secret belongs to
+func (s *TokenStore) Authenticate(secret string) (APIToken, bool) {
+	if secret == "" {
+		return APIToken{}, false
+	}
+	tokens, err := s.List()
+	if err != nil {
+		return APIToken{}, false
+	}
+	hash := hashToken(secret)
+	for _, token := range tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) == 1 {
+			return token, true
+		}
+	}
+	return APIToken{}, false
+}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"syscall"
 	"time"
+
+	"github.com/nolanleung/worklet/internal/storage"
 )
 
 type LockInfo struct {
@@ -81,7 +83,7 @@ func CreateLockFile(port int) error {
 		return fmt.Errorf("failed to marshal lock info: %w", err)
 	}
 	
-	if err := os.WriteFile(lockPath, data, 0644); err != nil {
+	if err := storage.WriteFileAtomic(lockPath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write lock file: %w", err)
 	}
 	
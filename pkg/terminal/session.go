@@ -14,6 +14,7 @@ import (
 	"github.com/docker/docker/client"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/nolanleung/worklet/internal/docker"
 )
 
 type SessionState int
@@ -40,6 +41,8 @@ type Session struct {
 	lastActivity time.Time
 	outputBuffer []byte // Buffer to store recent output for replay
 	bufferMu     sync.RWMutex
+	size         [2]uint // Height and width of the terminal, kept for the shell when it starts
+	sizeMu       sync.Mutex
 }
 
 type SessionManager struct {
@@ -108,6 +111,7 @@ func (sm *SessionManager) CreateOrAttachSession(forkID string, conn *websocket.C
 		state:        SessionStateActive,
 		lastActivity: time.Now(),
 		outputBuffer: make([]byte, 0, 64*1024), // 64KB buffer
+		size:         [2]uint{40, 140},
 	}
 
 	sm.sessions[session.ID] = session
@@ -160,13 +164,21 @@ func (sm *SessionManager) TerminateSession(sessionID string) {
 func (s *Session) Start() error {
 	// Only create exec if this is a new session
 	if s.execID == "" {
+		s.sizeMu.Lock()
+		size := s.size
+		s.sizeMu.Unlock()
 		execConfig := container.ExecOptions{
 			AttachStdin:  true,
 			AttachStdout: true,
 			AttachStderr: true,
 			Tty:          true,
-			Cmd:          []string{"/bin/sh"},
-			ConsoleSize:  &[2]uint{40, 140}, // height, width
+			Env:          []string{"TERM=xterm-256color"}, // What the browser's xterm.js emulates
+			Cmd:          docker.ShellCommand(),
+			ConsoleSize:  &size, // height, width
+		}
+		// Shells run as the session's run.user, if it has one
+		if info, err := s.docker.ContainerInspect(s.ctx, s.ContainerID); err == nil && info.Config != nil {
+			execConfig.User = info.Config.Labels[docker.LabelUser]
 		}
 
 		execResp, err := s.docker.ContainerExecCreate(s.ctx, s.ContainerID, execConfig)
@@ -178,7 +190,7 @@ func (s *Session) Start() error {
 		// Attach to exec
 		attachResp, err := s.docker.ContainerExecAttach(s.ctx, s.execID, container.ExecStartOptions{
 			Tty:         true,
-			ConsoleSize: &[2]uint{40, 140}, // height, width
+			ConsoleSize: &size, // height, width
 		})
 		if err != nil {
 			return fmt.Errorf("failed to attach to exec: %w", err)
@@ -277,6 +289,16 @@ func (s *Session) readFromWebSocket(conn *websocket.Conn) {
 }
 
 func (s *Session) resize(rows, cols int) error {
+	if rows <= 0 || cols <= 0 {
+		return nil
+	}
+	// A resize before the shell starts sets the size it starts with
+	s.sizeMu.Lock()
+	s.size = [2]uint{uint(rows), uint(cols)}
+	s.sizeMu.Unlock()
+	if s.execID == "" {
+		return nil
+	}
 	return s.docker.ContainerExecResize(s.ctx, s.execID, container.ResizeOptions{
 		Height: uint(rows),
 		Width:  uint(cols),
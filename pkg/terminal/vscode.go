@@ -15,7 +15,8 @@ func LaunchVSCode(containerID string) error {
 	projectName := docker.GetProjectNameFromContainer(containerID)
 	
 	// Ensure devcontainer config exists for extension support
-	if err := docker.EnsureDevContainerConfig(containerID, projectName); err != nil {
+	workDir := docker.GetContainerWorkDir(containerID)
+	if err := docker.EnsureDevContainerConfig(containerID, projectName, workDir); err != nil {
 		// Log warning but continue - VSCode will still work without it
 		fmt.Printf("Note: Could not set up VSCode extensions: %v\n", err)
 	}
@@ -25,7 +26,7 @@ func LaunchVSCode(containerID string) error {
 	containerHex := hex.EncodeToString([]byte(containerID))
 	
 	// Build the VSCode remote URI for attached container
-	vscodeURI := fmt.Sprintf("vscode-remote://attached-container+%s/workspace", containerHex)
+	vscodeURI := fmt.Sprintf("vscode-remote://attached-container+%s%s", containerHex, workDir)
 	
 	// Determine the command based on the platform
 	var cmd *exec.Cmd
@@ -51,5 +52,5 @@ func LaunchVSCode(containerID string) error {
 // GetVSCodeCommand returns the command to open VSCode with the container
 func GetVSCodeCommand(containerID string) string {
 	containerHex := hex.EncodeToString([]byte(containerID))
-	return fmt.Sprintf("code --folder-uri vscode-remote://attached-container+%s/workspace", containerHex)
+	return fmt.Sprintf("code --folder-uri vscode-remote://attached-container+%s%s", containerHex, docker.GetContainerWorkDir(containerID))
 }
\ No newline at end of file